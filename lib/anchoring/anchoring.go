@@ -0,0 +1,119 @@
+package anchoring
+
+/*
+* Publishing of block hashes to an external public blockchain. An anchor is a transaction there
+* with the hash in its data. Anyone can check later that the block existed at that time
+ */
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	AdapterCommand  = "command"
+	AdapterEthereum = "ethereum"
+	AdapterBitcoin  = "bitcoin"
+)
+
+// Data of an anchor starts with this prefix, it helps to find anchors in an external chain
+const dataPrefix = "OURSQL"
+
+// Default seconds between anchors
+const DefaultInterval = 3600
+
+// Options of anchoring. Empty Adapter means anchoring is off
+type Config struct {
+	Adapter string
+	// seconds between anchors. An anchor is not made if the top block was not changed
+	Interval int
+	// RPC URL of an external node, like http://127.0.0.1:8545 for geth or http://127.0.0.1:8332 for bitcoind
+	URL string
+	// RPC user and password of bitcoind
+	User     string
+	Password string
+	// Ethereum account to send transactions from. It must be unlocked in the node. To is same account if empty
+	From string
+	To   string
+	// Program for the command adapter. It is called with "publish HEXDATA" and prints a reference,
+	// and with "get REFERENCE" and prints HEXDATA and optional number of confirmations
+	Command string
+}
+
+type Adapter interface {
+	// Sends data to the external chain. Returns a reference of it, like a transaction ID
+	Publish(data []byte) (string, error)
+	// Returns data published with the reference and number of confirmations
+	GetData(ref string) ([]byte, int, error)
+}
+
+// State of an anchor in the external chain
+type Verification struct {
+	Found         bool // data of the reference is the block hash
+	Confirmations int
+}
+
+// Creates adapter by config options
+func NewAdapter(config Config) (Adapter, error) {
+	switch config.Adapter {
+	case AdapterCommand:
+		return newCommandAdapter(config)
+	case AdapterEthereum:
+		return newEthereumAdapter(config)
+	case AdapterBitcoin:
+		return newBitcoinAdapter(config)
+	}
+	return nil, errors.New(fmt.Sprintf("Unknown anchoring adapter %s", config.Adapter))
+}
+
+// Data to publish for a block hash
+func MakeData(hash []byte) []byte {
+	return append([]byte(dataPrefix), hash...)
+}
+
+// Publishes block hash. Returns a reference to verify it later
+func Publish(adapter Adapter, hash []byte) (string, error) {
+	ref, err := adapter.Publish(MakeData(hash))
+
+	if err != nil {
+		return "", err
+	}
+
+	if ref == "" {
+		return "", errors.New("Anchoring adapter returned empty reference")
+	}
+	return ref, nil
+}
+
+// Checks that the reference in the external chain has the block hash
+func Verify(adapter Adapter, ref string, hash []byte) (Verification, error) {
+	v := Verification{}
+
+	data, confirmations, err := adapter.GetData(ref)
+
+	if err != nil {
+		return v, err
+	}
+
+	v.Found = bytes.Equal(data, MakeData(hash))
+
+	if v.Found {
+		v.Confirmations = confirmations
+	}
+	return v, nil
+}
+
+func getHTTPClient() *http.Client {
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+func decodeHex(s string) ([]byte, error) {
+	if len(s) > 1 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		s = s[2:]
+	}
+	return hex.DecodeString(s)
+}
@@ -0,0 +1,116 @@
+package anchoring
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Fake RPC server. Keeps data of sent transactions
+func testRPCServer(t *testing.T, handle func(method string, params []interface{}) interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := struct {
+			ID     int           `json:"id"`
+			Method string        `json:"method"`
+			Params []interface{} `json:"params"`
+		}{}
+
+		err := json.NewDecoder(r.Body).Decode(&request)
+
+		if err != nil {
+			t.Fatalf("Wrong RPC request %s", err.Error())
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": request.ID, "result": handle(request.Method, request.Params)})
+	}))
+}
+
+func TestEthereumAdapter(t *testing.T) {
+	sent := map[string]string{}
+
+	server := testRPCServer(t, func(method string, params []interface{}) interface{} {
+		switch method {
+		case "eth_sendTransaction":
+			sent["0xaa"] = params[0].(map[string]interface{})["data"].(string)
+			return "0xaa"
+		case "eth_getTransactionByHash":
+			return map[string]interface{}{"input": sent[params[0].(string)], "blockNumber": "0x10"}
+		case "eth_blockNumber":
+			return "0x12"
+		}
+		return nil
+	})
+	defer server.Close()
+
+	adapter, err := NewAdapter(Config{Adapter: AdapterEthereum, URL: server.URL, From: "0x01"})
+
+	if err != nil {
+		t.Fatalf("Adapter error %s", err.Error())
+	}
+
+	hash, _ := hex.DecodeString("00ff00ff")
+
+	ref, err := Publish(adapter, hash)
+
+	if err != nil || ref != "0xaa" {
+		t.Fatalf("Publish returned %s, %v", ref, err)
+	}
+
+	v, err := Verify(adapter, ref, hash)
+
+	if err != nil || !v.Found || v.Confirmations != 3 {
+		t.Fatalf("Verify returned %v, %v", v, err)
+	}
+
+	v, err = Verify(adapter, ref, []byte{1})
+
+	if err != nil || v.Found {
+		t.Fatalf("Verify of other hash returned %v, %v", v, err)
+	}
+}
+
+func TestBitcoinAdapter(t *testing.T) {
+	data := ""
+
+	server := testRPCServer(t, func(method string, params []interface{}) interface{} {
+		switch method {
+		case "createrawtransaction":
+			data = params[1].([]interface{})[0].(map[string]interface{})["data"].(string)
+			return "raw"
+		case "fundrawtransaction":
+			return map[string]interface{}{"hex": "funded"}
+		case "signrawtransactionwithwallet":
+			return map[string]interface{}{"hex": "signed", "complete": true}
+		case "sendrawtransaction":
+			return "txid"
+		case "getrawtransaction":
+			return map[string]interface{}{
+				"confirmations": 6,
+				"vout": []interface{}{
+					map[string]interface{}{"scriptPubKey": map[string]interface{}{"type": "witness_v0_keyhash", "asm": "0 abcd"}},
+					map[string]interface{}{"scriptPubKey": map[string]interface{}{"type": "nulldata", "asm": "OP_RETURN " + data}},
+				},
+			}
+		}
+		return nil
+	})
+	defer server.Close()
+
+	adapter, _ := NewAdapter(Config{Adapter: AdapterBitcoin, URL: server.URL})
+
+	hash := []byte{1, 2, 3}
+
+	ref, err := Publish(adapter, hash)
+
+	if err != nil || ref != "txid" {
+		t.Fatalf("Publish returned %s, %v", ref, err)
+	}
+
+	v, err := Verify(adapter, ref, hash)
+
+	if err != nil || !v.Found || v.Confirmations != 6 {
+		t.Fatalf("Verify returned %v, %v", v, err)
+	}
+}
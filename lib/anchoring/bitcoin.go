@@ -0,0 +1,107 @@
+package anchoring
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// Anchors are transactions with OP_RETURN output. bitcoind wallet funds and signs them, fee is paid from the wallet.
+// Verification uses getrawtransaction, bitcoind needs txindex=1 for transactions not in its wallet
+type bitcoinAdapter struct {
+	rpc *rpcClient
+}
+
+func newBitcoinAdapter(config Config) (*bitcoinAdapter, error) {
+	a := &bitcoinAdapter{}
+
+	var err error
+
+	a.rpc, err = newRPCClient(config)
+
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *bitcoinAdapter) Publish(data []byte) (string, error) {
+	var raw string
+
+	outputs := []interface{}{map[string]string{"data": hex.EncodeToString(data)}}
+
+	err := a.rpc.call("createrawtransaction", []interface{}{[]interface{}{}, outputs}, &raw)
+
+	if err != nil {
+		return "", err
+	}
+
+	funded := struct {
+		Hex string `json:"hex"`
+	}{}
+
+	err = a.rpc.call("fundrawtransaction", []interface{}{raw}, &funded)
+
+	if err != nil {
+		return "", err
+	}
+
+	signed := struct {
+		Hex      string `json:"hex"`
+		Complete bool   `json:"complete"`
+	}{}
+
+	err = a.rpc.call("signrawtransactionwithwallet", []interface{}{funded.Hex}, &signed)
+
+	if err != nil {
+		return "", err
+	}
+
+	if !signed.Complete {
+		return "", errors.New("Bitcoin wallet could not sign anchor transaction")
+	}
+
+	var txID string
+
+	err = a.rpc.call("sendrawtransaction", []interface{}{signed.Hex}, &txID)
+
+	return txID, err
+}
+
+func (a *bitcoinAdapter) GetData(ref string) ([]byte, int, error) {
+	tx := struct {
+		Confirmations int `json:"confirmations"`
+		Vout          []struct {
+			ScriptPubKey struct {
+				Type string `json:"type"`
+				Asm  string `json:"asm"`
+			} `json:"scriptPubKey"`
+		} `json:"vout"`
+	}{}
+
+	err := a.rpc.call("getrawtransaction", []interface{}{ref, true}, &tx)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for _, out := range tx.Vout {
+		if out.ScriptPubKey.Type != "nulldata" {
+			continue
+		}
+		// asm is like OP_RETURN 4f5552...
+		parts := strings.Fields(out.ScriptPubKey.Asm)
+
+		if len(parts) != 2 {
+			continue
+		}
+
+		data, err := hex.DecodeString(parts[1])
+
+		if err != nil {
+			continue
+		}
+		return data, tx.Confirmations, nil
+	}
+	return nil, 0, errors.New("Bitcoin transaction " + ref + " has no OP_RETURN output")
+}
@@ -0,0 +1,69 @@
+package anchoring
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Adapter for any other chain or service. An external program does the work
+type commandAdapter struct {
+	command string
+}
+
+func newCommandAdapter(config Config) (*commandAdapter, error) {
+	if config.Command == "" {
+		return nil, errors.New("Command of anchoring adapter is not set")
+	}
+	return &commandAdapter{config.Command}, nil
+}
+
+func (a *commandAdapter) run(args ...string) (string, error) {
+	out, err := exec.Command(a.command, args...).Output()
+
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", errors.New(fmt.Sprintf("Anchoring command failed: %s", strings.TrimSpace(string(exitErr.Stderr))))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (a *commandAdapter) Publish(data []byte) (string, error) {
+	return a.run("publish", hex.EncodeToString(data))
+}
+
+func (a *commandAdapter) GetData(ref string) ([]byte, int, error) {
+	out, err := a.run("get", ref)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	parts := strings.Fields(out)
+
+	if len(parts) == 0 {
+		return nil, 0, errors.New("Anchoring command returned no data for " + ref)
+	}
+
+	data, err := decodeHex(parts[0])
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	confirmations := 0
+
+	if len(parts) > 1 {
+		confirmations, err = strconv.Atoi(parts[1])
+
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return data, confirmations, nil
+}
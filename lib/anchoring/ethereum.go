@@ -0,0 +1,108 @@
+package anchoring
+
+import (
+	"encoding/hex"
+	"errors"
+	"strconv"
+)
+
+// Anchors are transactions with zero value and the hash in input data. The From account is unlocked in the node,
+// the node signs transactions
+type ethereumAdapter struct {
+	config Config
+	rpc    *rpcClient
+}
+
+func newEthereumAdapter(config Config) (*ethereumAdapter, error) {
+	if config.From == "" {
+		return nil, errors.New("Ethereum account to send anchors from is not set")
+	}
+
+	if config.To == "" {
+		config.To = config.From
+	}
+
+	a := &ethereumAdapter{}
+	a.config = config
+
+	var err error
+
+	a.rpc, err = newRPCClient(config)
+
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *ethereumAdapter) Publish(data []byte) (string, error) {
+	tx := map[string]string{
+		"from":  a.config.From,
+		"to":    a.config.To,
+		"value": "0x0",
+		"data":  "0x" + hex.EncodeToString(data),
+	}
+
+	var txHash string
+
+	err := a.rpc.call("eth_sendTransaction", []interface{}{tx}, &txHash)
+
+	return txHash, err
+}
+
+func (a *ethereumAdapter) GetData(ref string) ([]byte, int, error) {
+	tx := struct {
+		Input       string  `json:"input"`
+		BlockNumber *string `json:"blockNumber"`
+	}{}
+
+	err := a.rpc.call("eth_getTransactionByHash", []interface{}{ref}, &tx)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if tx.Input == "" {
+		return nil, 0, errors.New("Ethereum transaction " + ref + " is not found")
+	}
+
+	data, err := decodeHex(tx.Input)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if tx.BlockNumber == nil {
+		// still in the pool
+		return data, 0, nil
+	}
+
+	var top string
+
+	err = a.rpc.call("eth_blockNumber", nil, &top)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	txBlock, err := parseQuantity(*tx.BlockNumber)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	topBlock, err := parseQuantity(top)
+
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, int(topBlock-txBlock) + 1, nil
+}
+
+// Numbers in Ethereum RPC are hex strings like 0x1b4
+func parseQuantity(s string) (int64, error) {
+	if len(s) > 1 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		s = s[2:]
+	}
+	return strconv.ParseInt(s, 16, 64)
+}
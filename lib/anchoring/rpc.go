@@ -0,0 +1,95 @@
+package anchoring
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// JSON-RPC client. geth and bitcoind use same format of requests
+type rpcClient struct {
+	url      string
+	user     string
+	password string
+	client   *http.Client
+	id       int
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func newRPCClient(config Config) (*rpcClient, error) {
+	if config.URL == "" {
+		return nil, errors.New(fmt.Sprintf("RPC URL is not set for anchoring adapter %s", config.Adapter))
+	}
+
+	c := &rpcClient{}
+	c.url = config.URL
+	c.user = config.User
+	c.password = config.Password
+	c.client = getHTTPClient()
+
+	return c, nil
+}
+
+// Executes a method. Result is decoded to a result argument
+func (c *rpcClient) call(method string, params []interface{}, result interface{}) error {
+	c.id++
+
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      c.id,
+		"method":  method,
+		"params":  params,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", c.url, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	response := struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}{}
+
+	err = json.NewDecoder(resp.Body).Decode(&response)
+
+	if err != nil {
+		return errors.New(fmt.Sprintf("RPC %s returned status %d and wrong response: %s", method, resp.StatusCode, err.Error()))
+	}
+
+	if response.Error != nil {
+		return errors.New(fmt.Sprintf("RPC %s error %d: %s", method, response.Error.Code, response.Error.Message))
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Result, result)
+}
@@ -4,12 +4,22 @@ const ApplicationTitle = "OurSQL"
 const ApplicationVersion = "0.1.8 beta"
 
 const Version = byte(0x00)
+
+// Signature schemes. Ed25519 public keys and signatures start with the scheme byte.
+// ECDSA keys have no prefix for compatibility. Version byte of an address is the scheme of a key
+const (
+	SignatureSchemeECDSA   = byte(0x00)
+	SignatureSchemeEd25519 = byte(0x01)
+)
 const AddressChecksumLen = 4
 
 const CurrencySmallestUnit = 0.00000001
 
 const NullAddressString = "NULLADDRESS"
 
+// Table of the names registry. Every row maps unique name to a public key
+const NamesTable = "_usernames"
+
 const (
 	TXFlagsNothing                    = 0 // 0
 	TXFlagsExecute                    = 1 // 1
@@ -20,4 +30,8 @@ const (
 	TXFlagsVerifyAllowMissed          = 32
 	TXFlagsBasedOnTopOfChain          = 64
 	TXFlagsVerifyAllowMissedForDelete = 128
+	// a new query made on this node, not a query of a transaction from other node or from a block
+	TXFlagsNewQuery = 256
+	// signature of a transaction was checked before, by the verification pipeline
+	TXFlagsSignatureVerified = 512
 )
@@ -0,0 +1,260 @@
+package dbproxy
+
+/*
+* Capture of a result set returned by a server for a text query of a client. The client gets the response
+* as usual, a filter gets values of it. It is used to fill a cache with results executed in a session of a client
+ */
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// Max size of a captured response. Bigger results are passed to a client without capture
+const maxCaptureSize = 1 << 20
+
+// server status flag. Other result sets follow this one
+const serverMoreResultsExists = 0x0008
+
+// Called when all result set of a query is received
+type CaptureResultCallback func(columns []CustomResponseColumn, rows [][]CustomResponseValue)
+
+// Request to pass a query to a server and capture the result
+type customRequestCapture struct {
+	callback CaptureResultCallback
+}
+
+func (r *customRequestCapture) getPacket() []byte {
+	return nil
+}
+
+type resultCapture struct {
+	callback     CaptureResultCallback
+	deprecateEOF bool
+	// bytes of not complete packet
+	data         []byte
+	size         int
+	columnsCount int
+	columnsDone  bool
+	columns      []CustomResponseColumn
+	rows         [][]CustomResponseValue
+}
+
+// Adds bytes of a response. Returns true when capture is finished. The callback is called only if full
+// result set is received
+func (c *resultCapture) write(p []byte) bool {
+	c.size += len(p)
+
+	if c.size > maxCaptureSize {
+		return true
+	}
+	c.data = append(c.data, p...)
+
+	for len(c.data) >= 4 {
+		length := int(c.data[0]) | int(c.data[1])<<8 | int(c.data[2])<<16
+
+		if len(c.data) < 4+length {
+			return false
+		}
+		payload := c.data[4 : 4+length]
+		c.data = c.data[4+length:]
+
+		done, err := c.packet(payload)
+
+		if done {
+			if err == nil {
+				c.callback(c.columns, c.rows)
+			}
+			return true
+		}
+
+		if err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Processes one packet of a response. done is true when it is the last packet
+func (c *resultCapture) packet(p []byte) (done bool, err error) {
+	if len(p) == 0 {
+		return true, errInvalidPacketLength
+	}
+
+	if c.columnsCount == 0 {
+		if p[0] == responseOk || p[0] == responseErr || p[0] == responseLocalinfile {
+			return true, errors.New("Not a result set")
+		}
+		count, _ := readLenEncodedInteger(bytes.NewReader(p))
+
+		if count == 0 {
+			return true, errInvalidPacketType
+		}
+		c.columnsCount = int(count)
+		return false, nil
+	}
+
+	if len(c.columns) < c.columnsCount {
+		column, err := decodeColumnDefinition(p)
+
+		if err != nil {
+			return true, err
+		}
+		c.columns = append(c.columns, column)
+
+		// there is no EOF after columns if it is deprecated
+		c.columnsDone = len(c.columns) == c.columnsCount && c.deprecateEOF
+		return false, nil
+	}
+
+	if !c.columnsDone {
+		if p[0] != responseEof {
+			return true, errInvalidPacketType
+		}
+		c.columnsDone = true
+		return false, nil
+	}
+
+	if p[0] == responseErr {
+		return true, errors.New("Error in a result set")
+	}
+
+	// a row can start with 0xfe only if a value is longer 16M, it is more than the capture limit
+	if p[0] == responseEof {
+		if getResultEndStatus(p, c.deprecateEOF)&serverMoreResultsExists != 0 {
+			return true, errors.New("Many result sets")
+		}
+		return true, nil
+	}
+
+	row, err := decodeTextRow(p, c.columnsCount)
+
+	if err != nil {
+		return true, err
+	}
+	c.rows = append(c.rows, row)
+
+	return false, nil
+}
+
+// Status flags of EOF packet or OK packet in the end of a result set.
+// EOF is 0xfe, warnings, status. OK is 0xfe, affected rows, last insert ID, status
+func getResultEndStatus(p []byte, deprecateEOF bool) uint16 {
+	r := bytes.NewReader(p[1:])
+
+	if deprecateEOF {
+		readLenEncodedInteger(r)
+		readLenEncodedInteger(r)
+	} else {
+		r.Seek(2, io.SeekCurrent)
+	}
+
+	status := make([]byte, 2)
+
+	if n, _ := r.Read(status); n < 2 {
+		return 0
+	}
+	return uint16(status[0]) | uint16(status[1])<<8
+}
+
+// Column definition packet. Names are length encoded strings: catalog, schema, table, original table,
+// name, original name. Then length of fixed fields, charset, column length and type
+func decodeColumnDefinition(p []byte) (column CustomResponseColumn, err error) {
+	r := bytes.NewReader(p)
+
+	names := []string{}
+
+	for i := 0; i < 6; i++ {
+		name, err := readLenEncodedValue(r)
+
+		if err != nil {
+			return column, err
+		}
+		names = append(names, name)
+	}
+
+	// length of fixed fields, charset and length
+	if _, err = r.Seek(1+2+4, io.SeekCurrent); err != nil {
+		return
+	}
+
+	fieldType, err := r.ReadByte()
+
+	if err != nil {
+		return
+	}
+	column.Name = names[4]
+	column.Type = getFieldTypeName(fieldType)
+
+	return
+}
+
+// Row of text protocol. Values are length encoded strings, NULL is 0xfb
+func decodeTextRow(p []byte, count int) ([]CustomResponseValue, error) {
+	r := bytes.NewReader(p)
+
+	row := []CustomResponseValue{}
+
+	for i := 0; i < count; i++ {
+		b, err := r.ReadByte()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if b == 0xfb {
+			row = append(row, CustomResponseValue{"", true})
+			continue
+		}
+		r.UnreadByte()
+
+		value, err := readLenEncodedValue(r)
+
+		if err != nil {
+			return nil, err
+		}
+		row = append(row, CustomResponseValue{value, false})
+	}
+
+	if r.Len() > 0 {
+		return nil, errInvalidPacketLength
+	}
+	return row, nil
+}
+
+// Length encoded string. Unlike readLenEncodedString it fails if a packet is shorter than the length
+func readLenEncodedValue(r *bytes.Reader) (string, error) {
+	length, offset := readLenEncodedInteger(r)
+
+	if offset == 0 || length > uint64(r.Len()) {
+		return "", errInvalidPacketLength
+	}
+	value := make([]byte, length)
+
+	if _, err := io.ReadFull(r, value); err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+// Type name for a MySQL field type. Names are same as getFieldType expects
+func getFieldTypeName(fieldType byte) string {
+	switch fieldType {
+	case fieldTypeTiny, fieldTypeShort, fieldTypeLong, fieldTypeInt24, fieldTypeLongLong, fieldTypeYear:
+		return "BIGINT"
+	case fieldTypeFloat, fieldTypeDouble:
+		return "DOUBLE"
+	case fieldTypeNewDecimal, 0x00:
+		return "DECIMAL"
+	case fieldTypeDate:
+		return "DATE"
+	case fieldTypeDateTime:
+		return "DATETIME"
+	case fieldTypeTimestamp:
+		return "TIMESTAMP"
+	case fieldTypeString, 0x0f, 0xfe:
+		return "VARCHAR"
+	}
+	return "BLOB"
+}
@@ -12,9 +12,22 @@ const (
 	responseLocalinfile = 0xfb
 
 	// MySQL field types constants
-	fieldTypeString   = 0xfd
-	fieldTypeLongLong = 0x08
-	fieldTypeDouble   = 0x05
+	fieldTypeString     = 0xfd
+	fieldTypeLongLong   = 0x08
+	fieldTypeDouble     = 0x05
+	fieldTypeTimestamp  = 0x07
+	fieldTypeDate       = 0x0a
+	fieldTypeDateTime   = 0x0c
+	fieldTypeNewDecimal = 0xf6
+	fieldTypeBlob       = 0xfc
+	fieldTypeTiny       = 0x01
+	fieldTypeShort      = 0x02
+	fieldTypeLong       = 0x03
+	fieldTypeFloat      = 0x04
+	fieldTypeNull       = 0x06
+	fieldTypeInt24      = 0x09
+	fieldTypeTime       = 0x0b
+	fieldTypeYear       = 0x0d
 
 	// There is no code for Resultset in MySQL internal protocol
 	// so it's defined here for convenience
@@ -86,4 +99,7 @@ const (
 	clientCanHandleExpiredPasswords
 	clientSessionTrack
 	clientDeprecateEOF
+	clientOptionalResultsetMetadata
+	clientZstdCompressionAlgorithm
+	clientQueryAttributes
 )
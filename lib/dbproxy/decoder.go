@@ -218,6 +218,8 @@ func decodeHandshakeV10(packet []byte) (*handshakeV10, error) {
 type handshakeResponse41 struct {
 	ClientCapabilities uint32
 	ClientCharset      byte
+	Username           string
+	Database           string
 }
 
 // DecodeHandshakeResponse41 decodes handshake response packet send by client.
@@ -249,7 +251,50 @@ func decodeHandshakeResponse41(packet []byte) (*handshakeResponse41, error) {
 		return nil, err
 	}
 
-	return &handshakeResponse41{clientCapabilities, charset}, nil
+	// Skip filler (23 bytes) and read Username. It is missed in SSL request
+	username := ""
+	database := ""
+
+	if _, err := r.Seek(23, io.SeekCurrent); err == nil {
+		username = readNullTerminatedString(r)
+
+		// auth response, then the database
+		switch {
+		case clientCapabilities&clientPluginAuthLenEncClientData != 0:
+			length, _ := readLenEncodedInteger(r)
+			r.Seek(int64(length), io.SeekCurrent)
+		case clientCapabilities&clientSecureConnection != 0:
+			length, _ := r.ReadByte()
+			r.Seek(int64(length), io.SeekCurrent)
+		default:
+			readNullTerminatedString(r)
+		}
+
+		if clientCapabilities&clientConnectWithDB != 0 && r.Len() > 0 {
+			database = readNullTerminatedString(r)
+		}
+	}
+
+	return &handshakeResponse41{clientCapabilities, charset, username, database}, nil
+}
+
+// Decodes user and database of COM_CHANGE_USER request.
+// int<1> Command, string<NUL> User, auth response (int<1> length and data if CLIENT_SECURE_CONNECTION is set,
+// else string<NUL>), string<NUL> Database
+func decodeChangeUserRequest(packet []byte, client *handshakeResponse41) (user string, database string) {
+	r := bytes.NewReader(packet[5:])
+
+	user = readNullTerminatedString(r)
+
+	if client != nil && client.ClientCapabilities&clientSecureConnection != 0 {
+		length, _ := r.ReadByte()
+		r.Seek(int64(length), io.SeekCurrent)
+	} else {
+		readNullTerminatedString(r)
+	}
+	database = readNullTerminatedString(r)
+
+	return
 }
 
 // QueryRequest represents COM_QUERY or COM_STMT_PREPARE command sent by client to server.
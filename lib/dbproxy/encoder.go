@@ -3,6 +3,7 @@ package dbproxy
 import (
 	"bytes"
 	"encoding/binary"
+	"strings"
 )
 
 // Encode custom responses by a proxy
@@ -12,10 +13,17 @@ type customResponseError struct {
 	Code    uint16
 }
 
-type customResponseRowsKeyValues struct {
-	rows     []CustomResponseKeyValue
+type customResponseRows struct {
+	schema   string
+	table    string
+	columns  []CustomResponseColumn
+	rows     [][]CustomResponseValue
 	counter  uint
 	protocol *protocolInfo
+	// rows are a result set of a query. Otherwise it is data prepared by a filter
+	resultSet bool
+	// rows are sent in binary protocol, as a response on COM_STMT_EXECUTE
+	binary bool
 }
 
 type customResponseOK struct {
@@ -61,19 +69,22 @@ func (e customResponseError) Error() string {
 }
 
 // =========================================================
-// KeyValues response
+// Rows response
 // Prepare response packet. which contains list of rows
 // https://github.com/siddontang/mixer/blob/master/doc/mysql-proxy/protocol.txt
 // https://dev.mysql.com/doc/internals/en/com-query-response.html
-func (r *customResponseRowsKeyValues) getPacket() []byte {
+func (r *customResponseRows) getPacket() []byte {
 	r.counter = 0
 
 	var b bytes.Buffer
 
-	b.Write(r.completePacket([]byte{2})) // 2 columns
+	b.Write(r.completePacket(getLengthEncodedInt(uint64(len(r.columns))))) // number of columns
 
-	b.Write(r.getColumnDefPacket("BC", "CustomResponse", "Key"))
-	b.Write(r.getColumnDefPacket("BC", "CustomResponse", "Value"))
+	types := r.getColumnTypes()
+
+	for i, column := range r.columns {
+		b.Write(r.getColumnDefPacket(r.schema, r.table, column, types[i]))
+	}
 
 	if !r.protocol.deprecateEOFSet() {
 		// EOF
@@ -82,7 +93,11 @@ func (r *customResponseRowsKeyValues) getPacket() []byte {
 
 	// send rows
 	for _, row := range r.rows {
-		b.Write(r.getRowData(row.Key, row.Value))
+		if r.binary {
+			b.Write(r.getBinaryRowData(row, types))
+		} else {
+			b.Write(r.getRowData(row))
+		}
 	}
 	if !r.protocol.deprecateEOFSet() {
 		// EOF
@@ -95,12 +110,27 @@ func (r *customResponseRowsKeyValues) getPacket() []byte {
 	return b.Bytes()
 }
 
-func (r *customResponseRowsKeyValues) setProtocolInfo(pi protocolInfo) {
+// Rows as text. Used to return data in an error message
+func (r *customResponseRows) String() string {
+	rows := []string{}
+
+	for _, row := range r.rows {
+		values := []string{}
+
+		for _, v := range row {
+			values = append(values, v.Value)
+		}
+		rows = append(rows, strings.Join(values, ": "))
+	}
+	return strings.Join(rows, "; ")
+}
+
+func (r *customResponseRows) setProtocolInfo(pi protocolInfo) {
 	r.protocol = &pi
 }
 
 // make a data to be a packet in a sequence
-func (r *customResponseRowsKeyValues) completePacket(data []byte) []byte {
+func (r *customResponseRows) completePacket(data []byte) []byte {
 	r.counter = r.counter + 1
 
 	length := make([]byte, 4)
@@ -113,7 +143,27 @@ func (r *customResponseRowsKeyValues) completePacket(data []byte) []byte {
 	return res
 }
 
-func (r *customResponseRowsKeyValues) getColumnDefPacket(schema, table, column string) []byte {
+// Types of columns. In binary protocol a column gets a type of its values only if all values can be converted
+func (r *customResponseRows) getColumnTypes() []byte {
+	types := []byte{}
+
+	for i, column := range r.columns {
+		t := getFieldType(column.Type)
+
+		if r.binary {
+			for _, row := range r.rows {
+				if _, ok := encodeBinaryValue(row[i].Value, t); !row[i].Null && !ok {
+					t = fieldTypeString
+					break
+				}
+			}
+		}
+		types = append(types, t)
+	}
+	return types
+}
+
+func (r *customResponseRows) getColumnDefPacket(schema, table string, column CustomResponseColumn, fieldType byte) []byte {
 	var b bytes.Buffer
 
 	b.Write(r.getLengEncStr("def"))
@@ -124,15 +174,15 @@ func (r *customResponseRowsKeyValues) getColumnDefPacket(schema, table, column s
 
 	b.Write(r.getLengEncStr(table))
 
-	b.Write(r.getLengEncStr(column))
+	b.Write(r.getLengEncStr(column.Name))
 
-	b.Write(r.getLengEncStr(column))
+	b.Write(r.getLengEncStr(column.Name))
 
 	b.WriteByte(0x0c)
 
 	b.Write([]byte{0x21, 0x00, 0xfd, 0xff, 0x02, 0x00}) // charset and max length
 
-	b.WriteByte(0xfc) // type MYSQL_TYPE_BLOB
+	b.WriteByte(fieldType)
 
 	b.Write([]byte{0x10, 0x00, 0x00, 0x00, 0x00})
 
@@ -140,34 +190,86 @@ func (r *customResponseRowsKeyValues) getColumnDefPacket(schema, table, column s
 }
 
 // Returns length encoded string for MySQL protocol
-func (r *customResponseRowsKeyValues) getLengEncStr(data string) []byte {
-	str := []byte(data)
+func (r *customResponseRows) getLengEncStr(data string) []byte {
+	return getLengthEncodedString(data)
+}
 
-	length := len(str)
+// Create row packet
+func (r *customResponseRows) getRowData(values []CustomResponseValue) []byte {
+	row := []byte{}
+
+	for _, v := range values {
+		if v.Null {
+			row = append(row, 0xfb)
+			continue
+		}
+		row = append(row, r.getLengEncStr(v.Value)...)
+	}
 
-	res := []byte{}
+	return r.completePacket(row)
+}
 
-	// we don't expect to have strings longer 65000
-	if length > 251 {
-		lb := make([]byte, 4)
-		binary.LittleEndian.PutUint32(lb, uint32(length))
-		res = []byte{0xfc, lb[0], lb[1]}
-	} else {
-		res = append(res, uint8(length))
+// Create row packet of binary protocol. NULL values are marked in a bitmap with offset 2
+func (r *customResponseRows) getBinaryRowData(values []CustomResponseValue, types []byte) []byte {
+	nullBitmap := make([]byte, (len(values)+7+2)/8)
+	data := []byte{}
+
+	for i, v := range values {
+		if v.Null {
+			nullBitmap[(i+2)/8] |= 1 << uint((i+2)%8)
+			continue
+		}
+		encoded, _ := encodeBinaryValue(v.Value, types[i])
+
+		data = append(data, encoded...)
 	}
 
-	res = append(res, str...)
+	row := []byte{0x00}
+	row = append(row, nullBitmap...)
 
-	return res
+	return r.completePacket(append(row, data...))
 }
 
-// Create row packet
-func (r *customResponseRowsKeyValues) getRowData(val1, val2 string) []byte {
-	row := r.getLengEncStr(val1)
+// Length encoded integer. See https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_basic_dt_integers.html
+func getLengthEncodedInt(n uint64) []byte {
+	lb := make([]byte, 8)
+	binary.LittleEndian.PutUint64(lb, n)
+
+	switch {
+	case n < 251:
+		return []byte{uint8(n)}
+	case n < 1<<16:
+		return []byte{0xfc, lb[0], lb[1]}
+	case n < 1<<24:
+		return []byte{0xfd, lb[0], lb[1], lb[2]}
+	}
+	return append([]byte{0xfe}, lb...)
+}
 
-	row = append(row, r.getLengEncStr(val2)...)
+// Length encoded string. See https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_basic_dt_strings.html
+func getLengthEncodedString(data string) []byte {
+	return append(getLengthEncodedInt(uint64(len(data))), data...)
+}
 
-	return r.completePacket(row)
+// MySQL field type for a type name returned by a driver. Values are sent as text anyway
+func getFieldType(typeName string) byte {
+	switch strings.ToUpper(typeName) {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT":
+		return fieldTypeLongLong
+	case "FLOAT", "DOUBLE", "REAL":
+		return fieldTypeDouble
+	case "DECIMAL":
+		return fieldTypeNewDecimal
+	case "DATE":
+		return fieldTypeDate
+	case "DATETIME":
+		return fieldTypeDateTime
+	case "TIMESTAMP":
+		return fieldTypeTimestamp
+	case "CHAR", "VARCHAR", "TEXT", "TINYTEXT", "MEDIUMTEXT", "LONGTEXT":
+		return fieldTypeString
+	}
+	return fieldTypeBlob
 }
 
 // ======================================================
@@ -177,6 +279,15 @@ func (p protocolInfo) deprecateEOFSet() bool {
 		((clientDeprecateEOF & p.clientInfo.ClientCapabilities) != 0)
 }
 
+// COM_STMT_EXECUTE contains query attributes
+func (p protocolInfo) queryAttributesSet() bool {
+	if p.serverInfo == nil || p.clientInfo == nil {
+		return false
+	}
+	return ((clientQueryAttributes & p.serverInfo.ServerCapabilities) != 0) &&
+		((clientQueryAttributes & p.clientInfo.ClientCapabilities) != 0)
+}
+
 func (p protocolInfo) clientTransactionsSet() bool {
 	return ((clientDeprecateEOF & p.serverInfo.ServerCapabilities) != 0) &&
 		((clientDeprecateEOF & p.clientInfo.ClientCapabilities) != 0)
@@ -204,6 +315,7 @@ func (r customResponseReplaceQuery) getPacket() []byte {
 	binary.LittleEndian.PutUint32(lb, uint32(l))
 	p[0] = lb[0]
 	p[1] = lb[1]
+	p[2] = lb[2]
 
 	return p
 }
@@ -32,14 +32,33 @@ type CustomResponseKeyValue struct {
 	Value string
 }
 
+// Column of a custom rows response. Type is a type name like INT or VARCHAR
+type CustomResponseColumn struct {
+	Name string
+	Type string
+}
+
+type CustomResponseValue struct {
+	Value string
+	Null  bool
+}
+
 type RequestQueryFilterCallback func(query string, sessionID string) (CustomRequestActionInterface, error)
-type ResponseFilterCallback func(sessionID string, err error)
+
+// If a response callback returns error, the client receives this error instead of server response
+type ResponseFilterCallback func(sessionID string, err error) error
 
 // Interface for a filter structure
 // It is alternative for callbacks and can keep some state inside
 type DBProxyFilter interface {
 	RequestCallback(query string, sessionID string) (CustomRequestActionInterface, error)
-	ResponseCallback(sessionID string, err error)
+	ResponseCallback(sessionID string, err error) error
+	// MySQL user of a session. Called when a server accepted auth of a client handshake or COM_CHANGE_USER
+	SessionUserCallback(sessionID string, user string)
+	// Current database of a session. Called when a server accepted a database of a handshake, COM_INIT_DB or USE
+	SessionDatabaseCallback(sessionID string, database string)
+	// Client connection is closed
+	SessionCloseCallback(sessionID string)
 }
 
 // Custom responses constructors
@@ -51,11 +70,32 @@ func NewCustomErrorResponse(err string, code uint16) CustomRequestActionInterfac
 	return &r
 }
 func NewCustomDataKeyValueResponse(rows []CustomResponseKeyValue) CustomRequestActionInterface {
-	r := customResponseRowsKeyValues{}
+	r := customResponseRows{}
+	r.schema = "BC"
+	r.table = "CustomResponse"
+	r.columns = []CustomResponseColumn{CustomResponseColumn{"Key", ""}, CustomResponseColumn{"Value", ""}}
+
+	for _, row := range rows {
+		r.rows = append(r.rows, []CustomResponseValue{CustomResponseValue{row.Key, false}, CustomResponseValue{row.Value, false}})
+	}
+	return &r
+}
+
+// Make response with rows of a result set. It is used when a query was executed not by the proxied server
+func NewCustomDataRowsResponse(columns []CustomResponseColumn, rows [][]CustomResponseValue) CustomRequestActionInterface {
+	r := customResponseRows{}
+	r.columns = columns
 	r.rows = rows
+	r.resultSet = true
 	return &r
 }
 
+// Pass a query to a server and give the result set to the callback. Used only for text queries,
+// a prepared statement is passed to a server without capture
+func NewCaptureResultRequest(callback CaptureResultCallback) CustomRequestActionInterface {
+	return &customRequestCapture{callback}
+}
+
 func NewCustomOKResponse(ar uint) CustomRequestActionInterface {
 	r := customResponseOK{}
 	r.rowsUpdated = ar
@@ -7,9 +7,15 @@ import (
 	"io/ioutil"
 	"log"
 	"net"
+	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
+// USE query. A database of a session is changed when a server accepts it
+var useDatabaseRegexp = regexp.MustCompile("(?i)^\\s*use\\s+`?([^`\\s;]+)`?\\s*;?\\s*$")
+
 // proxy implements server for capturing and forwarding MySQL traffic.
 type mysqlProxy struct {
 	mysqlHost        string
@@ -202,6 +208,10 @@ func (p *mysqlProxy) handleConnection(client net.Conn) {
 
 	sessionID := randString(10)
 
+	if p.queryFilter != nil {
+		defer p.queryFilter.SessionCloseCallback(sessionID)
+	}
+
 	requestFilter := p.getRequestManager(server, client, sessionID)
 
 	// read request in parallel routine
@@ -221,6 +231,7 @@ func (p *mysqlProxy) getRequestManager(server net.Conn, client net.Conn, sessID
 	r.client = client
 	r.sessionID = sessID
 	r.protocol = protocolInfo{}
+	r.statements = newPreparedStatements()
 	r.requestCallback = p.requestCallback
 	r.queryFilter = p.queryFilter
 	r.traceLog = p.traceLog
@@ -249,10 +260,21 @@ type requestPacketParser struct {
 	sessionID          string
 	initialResponseSet bool
 	protocol           protocolInfo
+	statements         *preparedStatements
 	requestCallback    RequestQueryFilterCallback
 	queryFilter        DBProxyFilter
 	traceLog           *log.Logger
 	errorLog           *log.Logger
+	// 1 when the server accepted auth of a client. Before this packets are not commands.
+	// It is set by the response parser, so it is accessed with atomic
+	authComplete int32
+	// state shared with the response parser. A result to capture, a user and a database to set when a server answers OK
+	stateLock          sync.Mutex
+	capture            *resultCapture
+	pendingUser        string
+	hasPendingUser     bool
+	pendingDatabase    string
+	hasPendingDatabase bool
 }
 
 // data posted from client to server
@@ -261,41 +283,104 @@ func (pp *requestPacketParser) Write(p []byte) (n int, err error) {
 
 	pp.traceLog.Printf("Request: %d bytes with type %x", len(p), getPacketType(p))
 
-	if !pp.initialResponseSet {
-		// clients sends data back on server's handshake
+	if atomic.LoadInt32(&pp.authComplete) == 0 {
+		if !pp.initialResponseSet {
+			// clients sends data back on server's handshake
 
-		pp.parseHandshakeClientResponse(p)
-		pp.initialResponseSet = true
+			pp.parseHandshakeClientResponse(p)
+			pp.initialResponseSet = true
+		}
+		// auth data, like scramble of caching_sha2_password or a request of a public key.
+		// It can start with any byte, it must not be parsed as a command
+		io.Copy(pp.server, bytes.NewReader(p))
+
+		return
 	}
 	// pass request to server or return error response
 
 	var clientErr error
 	var customResponse CustomRequestActionInterface
 
+	// a request to modify by filters
+	request := p
+
 	switch getPacketType(p) {
 
 	case comStmtPrepare:
+		// statement is checked by filters when it is executed
+		decoded, err := decodeQueryRequest(p)
+
+		if err == nil {
+			pp.statements.prepareRequested(decoded.Query)
+
+			pp.traceLog.Printf("Prepare: %s", decoded)
+		}
+
+	case comStmtExecute:
+		customResponse, clientErr = pp.executeStatement(p)
+
+		if _, ok := customResponse.(customRequestModifyInterface); ok {
+			// replaced query is sent as a text query. A server response on an update is same OK packet
+			request = []byte{0, 0, 0, 0, comQuery}
+		}
+
+	case comStmtSendLongData:
+		pp.statements.setLongData(p)
+
+	case comStmtReset:
+		pp.statements.reset(p)
+
+	case comStmtClose:
+		pp.statements.close(p)
+
+	case comChangeUser:
+		// int<1> Command, string<NUL> User, ...
+		if len(p) > 5 && pp.queryFilter != nil {
+			user, database := decodeChangeUserRequest(p, pp.protocol.clientInfo)
+
+			pp.traceLog.Printf("Change user to %s", user)
+
+			pp.setPendingUser(user)
+			pp.setPendingDatabase(database)
+		}
+		// a server answers with auth exchange again
+		atomic.StoreInt32(&pp.authComplete, 0)
+
+	case comInitDB:
+		if len(p) > 5 {
+			pp.setPendingDatabase(string(p[5:]))
+		}
+
 	case comQuery:
 
 		decoded, err := decodeQueryRequest(p)
 
 		if err == nil {
-			// pass through filters
-			if pp.queryFilter != nil {
-				customResponse, clientErr = pp.queryFilter.RequestCallback(decoded.Query, pp.sessionID)
-			}
-			if customResponse == nil && clientErr == nil && pp.requestCallback != nil {
-				customResponse, clientErr = pp.requestCallback(decoded.Query, pp.sessionID)
-			}
+			customResponse, clientErr = pp.filterQuery(decoded.Query)
 
 			pp.traceLog.Printf("Request: %s", decoded)
+
+			if m := useDatabaseRegexp.FindStringSubmatch(decoded.Query); m != nil && customResponse == nil {
+				pp.setPendingDatabase(m[1])
+			}
+		}
+	}
+
+	if capture, ok := customResponse.(*customRequestCapture); ok {
+		// the query goes to the server as is
+		customResponse = nil
+
+		if pp.protocol.serverInfo != nil && pp.protocol.clientInfo != nil {
+			pp.stateLock.Lock()
+			pp.capture = &resultCapture{callback: capture.callback, deprecateEOF: pp.protocol.deprecateEOFSet()}
+			pp.stateLock.Unlock()
 		}
 	}
 
 	if clientErr != nil {
 		// send error response to client
 		pp.traceLog.Printf("Custom error response: %s", clientErr)
-		customResponse = NewCustomErrorResponse(err.Error(), 3001)
+		customResponse = NewCustomErrorResponse(clientErr.Error(), 3001)
 
 	}
 	if customResponse != nil {
@@ -308,7 +393,7 @@ func (pp *requestPacketParser) Write(p []byte) (n int, err error) {
 		if customRequest, ok := customResponse.(customRequestModifyInterface); ok {
 
 			// means return data back to client
-			customRequest.setOriginalRequest(p)
+			customRequest.setOriginalRequest(request)
 
 			// request was modified. send it to a server
 			packet := customResponse.getPacket()
@@ -333,6 +418,54 @@ func (pp *requestPacketParser) Write(p []byte) (n int, err error) {
 	return
 }
 
+// pass a query through filters
+func (pp *requestPacketParser) filterQuery(query string) (customResponse CustomRequestActionInterface, err error) {
+	if pp.queryFilter != nil {
+		customResponse, err = pp.queryFilter.RequestCallback(query, pp.sessionID)
+	}
+	if customResponse == nil && err == nil && pp.requestCallback != nil {
+		customResponse, err = pp.requestCallback(query, pp.sessionID)
+	}
+	return
+}
+
+// Binds parameters of a prepared statement and passes the final query to filters.
+// If nil is returned, the original request is sent to a server
+func (pp *requestPacketParser) executeStatement(p []byte) (CustomRequestActionInterface, error) {
+	bound, err := pp.statements.bindExecute(p, pp.protocol.queryAttributesSet())
+
+	if err != nil {
+		// the query is not known. It must not go to a server without filtering
+		return nil, err
+	}
+
+	pp.traceLog.Printf("Execute statement: %s", bound.query)
+
+	customResponse, err := pp.filterQuery(bound.query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := customResponse.(*customRequestCapture); ok {
+		// results in binary form are not captured
+		return nil, nil
+	}
+
+	if rows, ok := customResponse.(*customResponseRows); ok {
+		if !rows.resultSet {
+			// data prepared by a filter can be returned only for a text query
+			return nil, errors.New("Prepared statement can not return data. Send the query as text query. " + rows.String())
+		}
+		if bound.cursor {
+			// a client waits for a cursor, let the server do this
+			return nil, nil
+		}
+		rows.binary = true
+	}
+	return customResponse, nil
+}
+
 // extract protocol info from initial handshake
 // this info will be needed to make custom responses later
 func (pp *requestPacketParser) parseHandshake(packet []byte) {
@@ -343,6 +476,8 @@ func (pp *requestPacketParser) parseHandshake(packet []byte) {
 		return
 	}
 	pp.protocol.serverInfo = serverHandshake
+
+	pp.traceLog.Printf("MySQL server %s, auth plugin %s", serverHandshake.ServerVersion, serverHandshake.AuthPlugin)
 }
 
 // extract client capabilities from a response on handshake from server
@@ -354,6 +489,63 @@ func (pp *requestPacketParser) parseHandshakeClientResponse(packet []byte) {
 		return
 	}
 	pp.protocol.clientInfo = clientHandshake
+
+	pp.traceLog.Printf("Client user %s", clientHandshake.Username)
+
+	pp.setPendingUser(clientHandshake.Username)
+	pp.setPendingDatabase(clientHandshake.Database)
+}
+
+// User of a session after the server accepts auth
+func (pp *requestPacketParser) setPendingUser(user string) {
+	pp.stateLock.Lock()
+	defer pp.stateLock.Unlock()
+
+	pp.pendingUser = user
+	pp.hasPendingUser = true
+}
+
+// Called with a type of a server response on auth. A client can not use a user not accepted by the server
+func (pp *requestPacketParser) completePendingUser(responseType byte) {
+	pp.stateLock.Lock()
+	user, has := pp.pendingUser, pp.hasPendingUser
+	pp.hasPendingUser = false
+	pp.stateLock.Unlock()
+
+	if has && responseType == responseOk && pp.queryFilter != nil {
+		pp.queryFilter.SessionUserCallback(pp.sessionID, user)
+	}
+}
+
+// Database of a session after the server answers OK on current request
+func (pp *requestPacketParser) setPendingDatabase(database string) {
+	pp.stateLock.Lock()
+	defer pp.stateLock.Unlock()
+
+	pp.pendingDatabase = database
+	pp.hasPendingDatabase = true
+}
+
+// Called with a type of a server response. Database is changed only if the server accepted it
+func (pp *requestPacketParser) completePendingDatabase(responseType byte) {
+	pp.stateLock.Lock()
+	database, has := pp.pendingDatabase, pp.hasPendingDatabase
+	pp.hasPendingDatabase = false
+	pp.stateLock.Unlock()
+
+	if has && responseType == responseOk && pp.queryFilter != nil {
+		pp.queryFilter.SessionDatabaseCallback(pp.sessionID, database)
+	}
+}
+
+// Passes bytes of a server response to a capture if it waits for a result
+func (pp *requestPacketParser) captureResponse(p []byte) {
+	pp.stateLock.Lock()
+	defer pp.stateLock.Unlock()
+
+	if pp.capture != nil && pp.capture.write(p) {
+		pp.capture = nil
+	}
 }
 
 // Response manager. Reads responses from server and sends to a client.
@@ -374,6 +566,18 @@ type responsePacketParser struct {
 func (pp *responsePacketParser) Write(p []byte) (n int, err error) {
 	pp.traceLog.Printf("Write to Response , bytes received %d, type %x\n", len(p), getPacketType(p))
 
+	if atomic.LoadInt32(&pp.requestParser.authComplete) == 0 {
+		return pp.writeAuthResponse(p)
+	}
+
+	if pp.requestParser.statements.waitsPrepareResponse() {
+		// remember ID of a new prepared statement
+		pp.requestParser.statements.parseResponse(p)
+	}
+
+	pp.requestParser.captureResponse(p)
+	pp.requestParser.completePendingDatabase(getPacketType(p))
+
 	switch getPacketType(p) {
 
 	case responseErr:
@@ -389,17 +593,23 @@ func (pp *responsePacketParser) Write(p []byte) (n int, err error) {
 
 	default:
 		pp.traceLog.Printf("Response OK")
+
+		var filterErr error
+
 		if pp.queryFilter != nil {
-			pp.queryFilter.ResponseCallback(pp.sessionID, nil)
+			filterErr = pp.queryFilter.ResponseCallback(pp.sessionID, nil)
 		}
-		if pp.responseCallback != nil {
-			pp.responseCallback(pp.sessionID, nil)
+		if filterErr == nil && pp.responseCallback != nil {
+			filterErr = pp.responseCallback(pp.sessionID, nil)
 		}
 
-		if !pp.initialResponseSet {
-			pp.traceLog.Printf("Initial handshake")
-			pp.requestParser.parseHandshake(p)
-			pp.initialResponseSet = true
+		if filterErr != nil {
+			// the query was executed but a filter could not complete it. Client must not get OK
+			pp.traceLog.Printf("Response filter error: %s", filterErr.Error())
+
+			io.Copy(pp.client, bytes.NewReader(NewCustomErrorResponse(filterErr.Error(), 3002).getPacket()))
+
+			return len(p), nil
 		}
 	}
 	pp.traceLog.Printf("Send response to client. %d bytes", len(p))
@@ -408,3 +618,24 @@ func (pp *responsePacketParser) Write(p []byte) (n int, err error) {
 
 	return len(p), nil
 }
+
+// Packets of the connection phase. A handshake, auth switch request or more data of auth plugin (caching_sha2_password
+// sends a result of fast auth or a public key). Auth is complete when the server sends OK or error
+func (pp *responsePacketParser) writeAuthResponse(p []byte) (n int, err error) {
+	if !pp.initialResponseSet {
+		pp.traceLog.Printf("Initial handshake")
+		pp.requestParser.parseHandshake(p)
+		pp.initialResponseSet = true
+
+	} else if getPacketType(p) == responseOk || getPacketType(p) == responseErr {
+		pp.traceLog.Printf("Auth complete")
+		atomic.StoreInt32(&pp.requestParser.authComplete, 1)
+
+		pp.requestParser.completePendingUser(getPacketType(p))
+		pp.requestParser.completePendingDatabase(getPacketType(p))
+	}
+
+	io.Copy(pp.client, bytes.NewReader(p))
+
+	return len(p), nil
+}
@@ -0,0 +1,524 @@
+package dbproxy
+
+/*
+* Prepared statements. A statement is prepared on the server as usual, but the proxy keeps its query.
+* On execute the proxy binds parameters to the query text, so filters get same final SQL as for a text query
+ */
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gelembjuk/oursql/node/database"
+)
+
+// COM_STMT_EXECUTE flags
+const (
+	stmtCursorTypeMask          = 0x07
+	stmtParameterCountAvailable = 0x08
+)
+
+type preparedStatement struct {
+	query     string
+	paramsNum uint16
+	// type and flag of each parameter. A client sends them usually only on first execute
+	paramTypes []byte
+	// some parameter was sent with COM_STMT_SEND_LONG_DATA
+	longData bool
+}
+
+// Statement execute request with parameters bound to a query
+type boundStatement struct {
+	query  string
+	cursor bool
+}
+
+// Prepared statements of a client session
+type preparedStatements struct {
+	lock       sync.Mutex
+	statements map[uint32]*preparedStatement
+	// queries of prepare requests waiting for a server response
+	pending []string
+}
+
+func newPreparedStatements() *preparedStatements {
+	return &preparedStatements{statements: map[uint32]*preparedStatement{}}
+}
+
+// Client sent COM_STMT_PREPARE
+func (ps *preparedStatements) prepareRequested(query string) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	ps.pending = append(ps.pending, query)
+}
+
+// Server response on a prepare request. A statement ID is known only from this response
+func (ps *preparedStatements) parseResponse(packet []byte) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if len(ps.pending) == 0 {
+		return
+	}
+
+	query := ps.pending[0]
+	ps.pending = ps.pending[1:]
+
+	if getPacketType(packet) != responsePrepareOk {
+		return
+	}
+
+	decoded, err := decodeComStmtPrepareOkResponse(packet)
+
+	if err != nil {
+		return
+	}
+	ps.statements[decoded.StatementID] = &preparedStatement{query: query, paramsNum: decoded.ParametersNum}
+}
+
+func (ps *preparedStatements) waitsPrepareResponse() bool {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	return len(ps.pending) > 0
+}
+
+// COM_STMT_SEND_LONG_DATA, COM_STMT_CLOSE and COM_STMT_RESET have statement ID right after a command
+func (ps *preparedStatements) getStatement(packet []byte) (*preparedStatement, uint32, bool) {
+	if len(packet) < 9 {
+		return nil, 0, false
+	}
+	id := binary.LittleEndian.Uint32(packet[5:9])
+
+	stmt, ok := ps.statements[id]
+
+	return stmt, id, ok
+}
+
+func (ps *preparedStatements) setLongData(packet []byte) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if stmt, _, ok := ps.getStatement(packet); ok {
+		stmt.longData = true
+	}
+}
+
+func (ps *preparedStatements) reset(packet []byte) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if stmt, _, ok := ps.getStatement(packet); ok {
+		stmt.longData = false
+	}
+}
+
+func (ps *preparedStatements) close(packet []byte) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if _, id, ok := ps.getStatement(packet); ok {
+		delete(ps.statements, id)
+	}
+}
+
+// Decodes COM_STMT_EXECUTE and returns the statement query with parameters values
+func (ps *preparedStatements) bindExecute(packet []byte, queryAttributes bool) (*boundStatement, error) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if err := checkPacketLength(14, packet); err != nil {
+		return nil, err
+	}
+
+	stmt, id, ok := ps.getStatement(packet)
+
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Prepared statement %d is not known to the proxy", id))
+	}
+
+	if stmt.longData {
+		stmt.longData = false
+		return nil, errors.New("Parameters sent with COM_STMT_SEND_LONG_DATA are not supported by the proxy")
+	}
+
+	values, err := decodeStmtExecuteValues(packet, stmt, queryAttributes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := bindStatementParams(stmt.query, values)
+
+	if err != nil {
+		return nil, err
+	}
+	return &boundStatement{query, packet[9]&stmtCursorTypeMask != 0}, nil
+}
+
+// Decodes parameters of COM_STMT_EXECUTE to SQL literals.
+// See https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_com_stmt_execute.html
+//
+// int<1> Command COM_STMT_EXECUTE (0x17)
+// int<4> StatementID
+// int<1> Flags
+// int<4> IterationCount = 1
+// if ParamCount > 0 or clientQueryAttributes and Flags has PARAMETER_COUNT_AVAILABLE:
+// int<lenenc> ParameterCount (only with clientQueryAttributes, parameters and query attributes)
+// byte<(ParameterCount + 7) / 8> NullBitmap
+// byte<1> NewParamsBindFlag
+// int<2> Type and flag, string<lenenc> Name (only with clientQueryAttributes) for each parameter if NewParamsBindFlag
+// byte<n> Value for each not NULL parameter
+func decodeStmtExecuteValues(packet []byte, stmt *preparedStatement, queryAttributes bool) ([]string, error) {
+	flags := packet[9]
+
+	r := bytes.NewReader(packet[14:])
+
+	count := uint64(stmt.paramsNum)
+
+	if queryAttributes && (count > 0 || flags&stmtParameterCountAvailable != 0) {
+		count, _ = readLenEncodedInteger(r)
+	}
+
+	if count < uint64(stmt.paramsNum) {
+		return nil, errInvalidPacketLength
+	}
+
+	values := []string{}
+
+	if count == 0 {
+		return values, nil
+	}
+
+	nullBitmap := make([]byte, (count+7)/8)
+
+	if _, err := io.ReadFull(r, nullBitmap); err != nil {
+		return nil, err
+	}
+
+	bindFlag, err := r.ReadByte()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if bindFlag == 1 {
+		types := make([]byte, 0, count*2)
+
+		for i := uint64(0); i < count; i++ {
+			t := make([]byte, 2)
+
+			if _, err := io.ReadFull(r, t); err != nil {
+				return nil, err
+			}
+			types = append(types, t...)
+
+			if queryAttributes {
+				// name of a query attribute. Parameters have empty names
+				if _, err := readBinaryString(r); err != nil {
+					return nil, err
+				}
+			}
+		}
+		stmt.paramTypes = types
+	}
+
+	if uint64(len(stmt.paramTypes)) < count*2 {
+		return nil, errors.New("Types of prepared statement parameters are not known")
+	}
+
+	// query attributes follow parameters, they are not needed
+	for i := 0; i < int(stmt.paramsNum); i++ {
+		if nullBitmap[i/8]&(1<<uint(i%8)) != 0 {
+			values = append(values, "NULL")
+			continue
+		}
+		value, err := readBinaryValue(r, stmt.paramTypes[i*2], stmt.paramTypes[i*2+1]&0x80 != 0)
+
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// Reads a value of the binary protocol and returns it as SQL literal
+func readBinaryValue(r *bytes.Reader, fieldType byte, unsigned bool) (string, error) {
+	switch fieldType {
+	case fieldTypeNull:
+		return "NULL", nil
+
+	case fieldTypeTiny, fieldTypeShort, fieldTypeYear, fieldTypeLong, fieldTypeInt24, fieldTypeLongLong:
+		size := 8
+
+		switch fieldType {
+		case fieldTypeTiny:
+			size = 1
+		case fieldTypeShort, fieldTypeYear:
+			size = 2
+		case fieldTypeLong, fieldTypeInt24:
+			size = 4
+		}
+
+		b := make([]byte, 8)
+
+		if _, err := io.ReadFull(r, b[:size]); err != nil {
+			return "", err
+		}
+		v := binary.LittleEndian.Uint64(b)
+
+		if unsigned {
+			return strconv.FormatUint(v, 10), nil
+		}
+		// extend sign of short values
+		shift := uint(64 - size*8)
+
+		return strconv.FormatInt(int64(v<<shift)>>shift, 10), nil
+
+	case fieldTypeFloat:
+		b := make([]byte, 4)
+
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", err
+		}
+		return strconv.FormatFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), 'g', -1, 32), nil
+
+	case fieldTypeDouble:
+		b := make([]byte, 8)
+
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", err
+		}
+		return strconv.FormatFloat(math.Float64frombits(binary.LittleEndian.Uint64(b)), 'g', -1, 64), nil
+
+	case fieldTypeDate, fieldTypeDateTime, fieldTypeTimestamp:
+		return readBinaryDateTime(r, fieldType)
+
+	case fieldTypeTime:
+		return readBinaryTime(r)
+	}
+
+	// strings, decimals, blobs, JSON etc are sent as length encoded strings
+	b, err := readBinaryString(r)
+
+	if err != nil {
+		return "", err
+	}
+	return quoteBinaryString(b), nil
+}
+
+// int<1> Length (0, 4, 7 or 11), int<2> Year, int<1> Month, int<1> Day, int<1> Hour, int<1> Minute, int<1> Second, int<4> Microseconds
+func readBinaryDateTime(r *bytes.Reader, fieldType byte) (string, error) {
+	b, err := readBinaryLengthBytes(r)
+
+	if err != nil {
+		return "", err
+	}
+
+	v := make([]byte, 11)
+	copy(v, b)
+
+	value := fmt.Sprintf("%04d-%02d-%02d", binary.LittleEndian.Uint16(v[0:2]), v[2], v[3])
+
+	if fieldType != fieldTypeDate || len(b) > 4 {
+		value += fmt.Sprintf(" %02d:%02d:%02d", v[4], v[5], v[6])
+	}
+
+	if micro := binary.LittleEndian.Uint32(v[7:11]); micro > 0 {
+		value += fmt.Sprintf(".%06d", micro)
+	}
+	return "'" + value + "'", nil
+}
+
+// int<1> Length (0, 8 or 12), int<1> IsNegative, int<4> Days, int<1> Hour, int<1> Minute, int<1> Second, int<4> Microseconds
+func readBinaryTime(r *bytes.Reader) (string, error) {
+	b, err := readBinaryLengthBytes(r)
+
+	if err != nil {
+		return "", err
+	}
+
+	v := make([]byte, 12)
+	copy(v, b)
+
+	value := ""
+
+	if v[0] == 1 {
+		value = "-"
+	}
+
+	hours := binary.LittleEndian.Uint32(v[1:5])*24 + uint32(v[5])
+
+	value += fmt.Sprintf("%02d:%02d:%02d", hours, v[6], v[7])
+
+	if micro := binary.LittleEndian.Uint32(v[8:12]); micro > 0 {
+		value += fmt.Sprintf(".%06d", micro)
+	}
+	return "'" + value + "'", nil
+}
+
+// Value with 1 byte length before it
+func readBinaryLengthBytes(r *bytes.Reader) ([]byte, error) {
+	length, err := r.ReadByte()
+
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, length)
+
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Length encoded string. It can be empty, but the length must be in a packet
+func readBinaryString(r *bytes.Reader) ([]byte, error) {
+	length, offset := readLenEncodedInteger(r)
+
+	if offset == 0 || length > uint64(r.Len()) {
+		return nil, errInvalidPacketLength
+	}
+
+	b := make([]byte, length)
+
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// String literal. It is same as in SQL built by a node, it doesn't depend on sql_mode of the server
+func quoteBinaryString(b []byte) string {
+	return database.Quoter{}.Literal(string(b))
+}
+
+// Replaces ? placeholders with values. Placeholders in quoted strings and comments are not replaced
+func bindStatementParams(query string, values []string) (string, error) {
+	var b strings.Builder
+
+	index := 0
+	var quote byte
+	escaped := false
+	comment := ""
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+
+		switch {
+		case comment == "*/":
+			if c == '*' && i+1 < len(query) && query[i+1] == '/' {
+				b.WriteByte(c)
+				i++
+				c = query[i]
+				comment = ""
+			}
+
+		case comment == "\n":
+			if c == '\n' {
+				comment = ""
+			}
+
+		case quote != 0:
+			if escaped {
+				escaped = false
+			} else if c == '\\' && quote != '`' {
+				escaped = true
+			} else if c == quote {
+				quote = 0
+			}
+
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+
+		case c == '#' || c == '-' && strings.HasPrefix(query[i:], "-- "):
+			comment = "\n"
+
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			comment = "*/"
+			b.WriteByte(c)
+			i++
+			c = query[i]
+
+		case c == '?':
+			if index >= len(values) {
+				return "", errors.New("Prepared statement has more placeholders than parameters")
+			}
+			b.WriteString(values[index])
+			index++
+			continue
+		}
+		b.WriteByte(c)
+	}
+
+	if index != len(values) {
+		return "", errors.New("Prepared statement has less placeholders than parameters")
+	}
+	return b.String(), nil
+}
+
+// Encode a value of a row in binary protocol. Returns false if the value can not be converted to this type
+func encodeBinaryValue(value string, fieldType byte) ([]byte, bool) {
+	switch fieldType {
+	case fieldTypeLongLong:
+		b := make([]byte, 8)
+
+		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+			binary.LittleEndian.PutUint64(b, uint64(v))
+			return b, true
+		}
+		return nil, false
+
+	case fieldTypeDouble:
+		b := make([]byte, 8)
+
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			binary.LittleEndian.PutUint64(b, math.Float64bits(v))
+			return b, true
+		}
+		return nil, false
+
+	case fieldTypeDate, fieldTypeDateTime, fieldTypeTimestamp:
+		layout := "2006-01-02 15:04:05.999999"
+
+		if fieldType == fieldTypeDate {
+			layout = "2006-01-02"
+		}
+
+		t, err := time.Parse(layout, value)
+
+		if err != nil {
+			return nil, false
+		}
+
+		b := []byte{4, 0, 0, byte(t.Month()), byte(t.Day())}
+		binary.LittleEndian.PutUint16(b[1:3], uint16(t.Year()))
+
+		if fieldType == fieldTypeDate {
+			return b, true
+		}
+
+		b = append(b, byte(t.Hour()), byte(t.Minute()), byte(t.Second()))
+		b[0] = 7
+
+		if micro := t.Nanosecond() / 1000; micro > 0 {
+			mb := make([]byte, 4)
+			binary.LittleEndian.PutUint32(mb, uint32(micro))
+			b = append(b, mb...)
+			b[0] = 11
+		}
+		return b, true
+	}
+	return getLengthEncodedString(value), true
+}
@@ -0,0 +1,263 @@
+package dbproxy
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBindStatementParams(t *testing.T) {
+
+	type BindStatementParamsAssert struct {
+		Query    string
+		Values   []string
+		Expected string
+		HasError bool
+	}
+
+	testData := []*BindStatementParamsAssert{
+		{"SELECT a FROM t WHERE id=? AND b=?", []string{"1", "'x'"}, "SELECT a FROM t WHERE id=1 AND b='x'", false},
+		{"INSERT INTO t VALUES (?,?,?)", []string{"NULL", "X'00ff'", "''"}, "INSERT INTO t VALUES (NULL,X'00ff','')", false},
+		// placeholders in quoted strings and names are not replaced
+		{"SELECT '?', \"?\", `?` FROM t WHERE id=?", []string{"1"}, "SELECT '?', \"?\", `?` FROM t WHERE id=1", false},
+		{"SELECT 'it\\'s ?' FROM t WHERE id=?", []string{"1"}, "SELECT 'it\\'s ?' FROM t WHERE id=1", false},
+		{"SELECT 'it''s ?' FROM t WHERE id=?", []string{"1"}, "SELECT 'it''s ?' FROM t WHERE id=1", false},
+		{"SELECT `a``?` FROM t WHERE id=?", []string{"1"}, "SELECT `a``?` FROM t WHERE id=1", false},
+		// comments
+		{"SELECT a /* ? */ FROM t WHERE id=?", []string{"1"}, "SELECT a /* ? */ FROM t WHERE id=1", false},
+		{"SELECT a FROM t -- ?\nWHERE id=?", []string{"1"}, "SELECT a FROM t -- ?\nWHERE id=1", false},
+		{"SELECT a FROM t # ?\nWHERE id=?", []string{"1"}, "SELECT a FROM t # ?\nWHERE id=1", false},
+		{"SELECT a FROM t WHERE id=?-1", []string{"2"}, "SELECT a FROM t WHERE id=2-1", false},
+		// a value with a placeholder is not bound again
+		{"SELECT a FROM t WHERE b=? AND c=?", []string{"'?'", "2"}, "SELECT a FROM t WHERE b='?' AND c=2", false},
+		{"SELECT a FROM t", []string{}, "SELECT a FROM t", false},
+		{"SELECT a FROM t WHERE id=? AND b=?", []string{"1"}, "", true},
+		{"SELECT a FROM t WHERE id=?", []string{"1", "2"}, "", true},
+		{"SELECT a FROM t WHERE b='?'", []string{"1"}, "", true},
+	}
+
+	for _, asserted := range testData {
+		query, err := bindStatementParams(asserted.Query, asserted.Values)
+
+		if asserted.HasError {
+			assert.NotNil(t, err, asserted.Query)
+			continue
+		}
+		assert.Nil(t, err, asserted.Query)
+		assert.Equal(t, asserted.Expected, query)
+	}
+}
+
+func TestReadBinaryValue(t *testing.T) {
+
+	type ReadBinaryValueAssert struct {
+		FieldType byte
+		Unsigned  bool
+		Data      []byte
+		Expected  string
+		HasError  bool
+	}
+
+	testData := []*ReadBinaryValueAssert{
+		{fieldTypeNull, false, []byte{}, "NULL", false},
+		{fieldTypeTiny, false, []byte{0xff}, "-1", false},
+		{fieldTypeTiny, true, []byte{0xff}, "255", false},
+		{fieldTypeShort, false, []byte{0xfe, 0xff}, "-2", false},
+		{fieldTypeShort, true, []byte{0xfe, 0xff}, "65534", false},
+		{fieldTypeYear, false, []byte{0xe1, 0x07}, "2017", false},
+		{fieldTypeLong, false, []byte{0xc7, 0xcf, 0xff, 0xff}, "-12345", false},
+		{fieldTypeInt24, false, []byte{0x39, 0x30, 0x00, 0x00}, "12345", false},
+		{fieldTypeLongLong, false, []byte{0xc7, 0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, "-12345", false},
+		{fieldTypeLongLong, true, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, "18446744073709551615", false},
+		{fieldTypeFloat, false, []byte{0x00, 0x00, 0xc0, 0x3f}, "1.5", false},
+		{fieldTypeDouble, false, []byte{0xcd, 0xcc, 0xcc, 0xcc, 0xcc, 0xdc, 0x5e, 0xc0}, "-123.45", false},
+		{fieldTypeDate, false, []byte{0x04, 0xe1, 0x07, 0x06, 0x19}, "'2017-06-25'", false},
+		{fieldTypeDate, false, []byte{0x00}, "'0000-00-00'", false},
+		{fieldTypeDateTime, false, []byte{0x04, 0xe1, 0x07, 0x06, 0x19}, "'2017-06-25 00:00:00'", false},
+		{fieldTypeDateTime, false, []byte{0x07, 0xe1, 0x07, 0x06, 0x19, 0x12, 0x13, 0x14}, "'2017-06-25 18:19:20'", false},
+		{fieldTypeTimestamp, false, []byte{0x0b, 0xe1, 0x07, 0x06, 0x19, 0x12, 0x13, 0x14, 0x20, 0xa1, 0x07, 0x00},
+			"'2017-06-25 18:19:20.500000'", false},
+		{fieldTypeTime, false, []byte{0x00}, "'00:00:00'", false},
+		{fieldTypeTime, false, []byte{0x08, 0x01, 0x01, 0x00, 0x00, 0x00, 0x02, 0x03, 0x04}, "'-26:03:04'", false},
+		{fieldTypeTime, false, []byte{0x0c, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x03, 0x04, 0x01, 0x00, 0x00, 0x00},
+			"'02:03:04.000001'", false},
+		{fieldTypeString, false, []byte{0x04, 0x69, 0x74, 0x27, 0x73}, "'it''s'", false},
+		{fieldTypeString, false, []byte{0x00}, "''", false},
+		{fieldTypeString, false, []byte{0x03, 0x61, 0x5c, 0x62}, "X'615c62'", false},
+		{fieldTypeBlob, false, []byte{0x02, 0x00, 0xff}, "X'00ff'", false},
+		{fieldTypeNewDecimal, false, []byte{0x04, 0x31, 0x32, 0x2e, 0x35}, "'12.5'", false},
+		// not complete values
+		{fieldTypeLong, false, []byte{0x01, 0x02}, "", true},
+		{fieldTypeDouble, false, []byte{0x01}, "", true},
+		{fieldTypeDateTime, false, []byte{0x07, 0xe1, 0x07}, "", true},
+		{fieldTypeString, false, []byte{0x05, 0x61}, "", true},
+		{fieldTypeString, false, []byte{}, "", true},
+	}
+
+	for index, asserted := range testData {
+		value, err := readBinaryValue(bytes.NewReader(asserted.Data), asserted.FieldType, asserted.Unsigned)
+
+		if asserted.HasError {
+			assert.NotNil(t, err, "ID = %d", index)
+			continue
+		}
+		assert.Nil(t, err, "ID = %d", index)
+		assert.Equal(t, asserted.Expected, value, "ID = %d", index)
+	}
+}
+
+// COM_STMT_EXECUTE of statement 1 with flags and a body after iteration count
+func testStmtExecutePacket(flags byte, body ...byte) []byte {
+	packet := []byte{0x00, 0x00, 0x00, 0x00, comStmtExecute, 0x01, 0x00, 0x00, 0x00, flags, 0x01, 0x00, 0x00, 0x00}
+	packet = append(packet, body...)
+
+	length := len(packet) - 4
+	packet[0], packet[1], packet[2] = byte(length), byte(length>>8), byte(length>>16)
+
+	return packet
+}
+
+func TestDecodeStmtExecuteValues(t *testing.T) {
+
+	type DecodeStmtExecuteValuesAssert struct {
+		Id              int
+		ParamsNum       uint16
+		ParamTypes      []byte
+		QueryAttributes bool
+		Packet          []byte
+		Expected        []string
+		HasError        bool
+	}
+
+	testData := []*DecodeStmtExecuteValuesAssert{
+		{1, 0, nil, false, testStmtExecutePacket(0), []string{}, false},
+		{
+			2,
+			// second parameter is NULL, types are sent
+			3, nil, false,
+			testStmtExecutePacket(0, 0x02, 0x01,
+				fieldTypeLongLong, 0x00, fieldTypeString, 0x00, fieldTypeTiny, 0x80,
+				0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0xc8),
+			[]string{"5", "NULL", "200"},
+			false,
+		},
+		{
+			3,
+			// types are known from a previous execute
+			2, []byte{fieldTypeString, 0x00, fieldTypeLong, 0x00}, false,
+			testStmtExecutePacket(0, 0x00, 0x00, 0x01, 0x78, 0xff, 0xff, 0xff, 0xff),
+			[]string{"'x'", "-1"},
+			false,
+		},
+		{
+			4,
+			// types are not sent and not known
+			1, nil, false,
+			testStmtExecutePacket(0, 0x00, 0x00, 0x01, 0x78),
+			nil,
+			true,
+		},
+		{
+			5,
+			// 9 parameters, NULL bitmap has 2 bytes. First and last parameters are NULL
+			9, nil, false,
+			testStmtExecutePacket(0, 0x01, 0x01, 0x01,
+				fieldTypeNull, 0x00, fieldTypeTiny, 0x00, fieldTypeTiny, 0x00, fieldTypeTiny, 0x00, fieldTypeTiny, 0x00,
+				fieldTypeTiny, 0x00, fieldTypeTiny, 0x00, fieldTypeTiny, 0x00, fieldTypeString, 0x00,
+				0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08),
+			[]string{"NULL", "2", "3", "4", "5", "6", "7", "8", "NULL"},
+			false,
+		},
+		{
+			6,
+			// query attributes: count of parameters and attributes, names. The attribute value is not needed
+			1, nil, true,
+			testStmtExecutePacket(stmtParameterCountAvailable, 0x02, 0x00, 0x01,
+				fieldTypeTiny, 0x00, 0x00, fieldTypeString, 0x00, 0x01, 0x61,
+				0x07, 0x01, 0x62),
+			[]string{"7"},
+			false,
+		},
+		{
+			7,
+			// query attributes without parameters
+			0, nil, true,
+			testStmtExecutePacket(stmtParameterCountAvailable, 0x01, 0x00, 0x01, fieldTypeString, 0x00, 0x01, 0x61, 0x01, 0x62),
+			[]string{},
+			false,
+		},
+		{
+			8,
+			// less parameters than the statement has
+			2, nil, true,
+			testStmtExecutePacket(0, 0x01, 0x00, 0x01, fieldTypeTiny, 0x00, 0x00, 0x01),
+			nil,
+			true,
+		},
+		{
+			9,
+			// not complete value
+			1, nil, false,
+			testStmtExecutePacket(0, 0x00, 0x01, fieldTypeLongLong, 0x00, 0x01, 0x02),
+			nil,
+			true,
+		},
+		{
+			10,
+			// not complete NULL bitmap
+			9, nil, false,
+			testStmtExecutePacket(0, 0x00),
+			nil,
+			true,
+		},
+	}
+
+	for _, asserted := range testData {
+		stmt := &preparedStatement{query: "", paramsNum: asserted.ParamsNum, paramTypes: asserted.ParamTypes}
+
+		values, err := decodeStmtExecuteValues(asserted.Packet, stmt, asserted.QueryAttributes)
+
+		if asserted.HasError {
+			assert.NotNil(t, err, "ID = %d", asserted.Id)
+			continue
+		}
+		assert.Nil(t, err, "ID = %d", asserted.Id)
+		assert.Equal(t, asserted.Expected, values, "ID = %d", asserted.Id)
+	}
+}
+
+func TestBindExecuteLongData(t *testing.T) {
+	ps := newPreparedStatements()
+	ps.statements[1] = &preparedStatement{query: "SELECT a FROM t WHERE id=?", paramsNum: 1}
+
+	execute := testStmtExecutePacket(0, 0x00, 0x01, fieldTypeTiny, 0x00, 0x05)
+
+	bound, err := ps.bindExecute(execute, false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT a FROM t WHERE id=5", bound.query)
+
+	// COM_STMT_SEND_LONG_DATA of statement 1, parameter 0
+	ps.setLongData([]byte{0x08, 0x00, 0x00, 0x00, comStmtSendLongData, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x61, 0x62})
+
+	_, err = ps.bindExecute(execute, false)
+
+	assert.NotNil(t, err)
+
+	// the flag is cleared by the failed execute and by COM_STMT_RESET
+	ps.setLongData([]byte{0x08, 0x00, 0x00, 0x00, comStmtSendLongData, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x61, 0x62})
+	ps.reset([]byte{0x05, 0x00, 0x00, 0x00, comStmtReset, 0x01, 0x00, 0x00, 0x00})
+
+	_, err = ps.bindExecute(execute, false)
+
+	assert.Nil(t, err)
+
+	// not known statement
+	ps.close([]byte{0x05, 0x00, 0x00, 0x00, comStmtClose, 0x01, 0x00, 0x00, 0x00})
+
+	_, err = ps.bindExecute(execute, false)
+
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,282 @@
+package graphql
+
+/*
+* Execution of queries. A schema is a tree of objects, every field of an object has a resolver.
+* A resolver returns a scalar, an Object, a list of Objects or nil.
+* Fields are resolved only when they are requested, so nested objects can be loaded lazily
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Max nesting of selections in a query
+const MaxDepth = 15
+
+// Max fields resolved for one query. Lists and aliases multiply fields, a query over this fails fully
+const MaxFields = 10000
+
+type Args map[string]interface{}
+
+type Resolver func(args Args) (interface{}, error)
+
+// Object of a schema. Keys are field names
+type Object map[string]Resolver
+
+type Error struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+type Response struct {
+	Data   interface{} `json:"data"`
+	Errors []Error     `json:"errors,omitempty"`
+}
+
+// Result object. Keeps order of fields same as in a query
+type resultMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+type executor struct {
+	variables map[string]interface{}
+	errors    []Error
+	resolved  int
+	exceeded  bool
+}
+
+// Resolver of a constant value
+func Value(v interface{}) Resolver {
+	return func(args Args) (interface{}, error) {
+		return v, nil
+	}
+}
+
+// Parses and executes a query on the root object
+func Execute(root Object, query string, variables map[string]interface{}, operationName string) Response {
+	doc, err := Parse(query)
+
+	if err != nil {
+		return Response{Errors: []Error{Error{Message: err.Error()}}}
+	}
+
+	op, err := doc.GetOperation(operationName)
+
+	if err != nil {
+		return Response{Errors: []Error{Error{Message: err.Error()}}}
+	}
+
+	e := &executor{variables: map[string]interface{}{}}
+
+	for name, def := range op.Variables {
+		e.variables[name] = def
+
+		if v, ok := variables[name]; ok {
+			e.variables[name] = v
+		}
+	}
+
+	data := e.resolveObject(root, op.Selection, []interface{}{}, 1)
+
+	if e.exceeded {
+		return Response{Errors: []Error{Error{Message: fmt.Sprintf("Query resolves more than %d fields", MaxFields)}}}
+	}
+	return Response{Data: data, Errors: e.errors}
+}
+
+func (e *executor) resolveObject(obj Object, selection []*Field, path []interface{}, depth int) *resultMap {
+	if depth > MaxDepth {
+		e.addError(errors.New(fmt.Sprintf("Query is deeper than %d levels", MaxDepth)), path)
+		return nil
+	}
+
+	result := &resultMap{values: map[string]interface{}{}}
+
+	for _, f := range selection {
+		key := f.ResultKey()
+
+		if _, ok := result.values[key]; ok {
+			// same field selected again, for example from a fragment
+			continue
+		}
+
+		e.resolved++
+
+		// the rest of the query is not resolved, it fails anyway
+		if e.resolved > MaxFields {
+			e.exceeded = true
+			return nil
+		}
+
+		fieldPath := append(append([]interface{}{}, path...), key)
+
+		result.keys = append(result.keys, key)
+		result.values[key] = e.resolveField(obj, f, fieldPath, depth)
+	}
+	return result
+}
+
+func (e *executor) resolveField(obj Object, f *Field, path []interface{}, depth int) interface{} {
+	resolver, ok := obj[f.Name]
+
+	if !ok {
+		e.addError(errors.New(fmt.Sprintf("Unknown field %s", f.Name)), path)
+		return nil
+	}
+
+	args := Args{}
+
+	for name, v := range f.Arguments {
+		args[name] = e.substitute(v)
+	}
+
+	value, err := resolver(args)
+
+	if err != nil {
+		e.addError(err, path)
+		return nil
+	}
+	return e.completeValue(value, f, path, depth)
+}
+
+func (e *executor) completeValue(value interface{}, f *Field, path []interface{}, depth int) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+
+	case Object:
+		if v == nil {
+			return nil
+		}
+		if len(f.Selection) == 0 {
+			e.addError(errors.New(fmt.Sprintf("Field %s must have a selection of subfields", f.Name)), path)
+			return nil
+		}
+		return e.resolveObject(v, f.Selection, path, depth+1)
+
+	case []Object:
+		if len(f.Selection) == 0 {
+			e.addError(errors.New(fmt.Sprintf("Field %s must have a selection of subfields", f.Name)), path)
+			return nil
+		}
+		list := []interface{}{}
+
+		for i, o := range v {
+			if e.exceeded {
+				return nil
+			}
+			list = append(list, e.resolveObject(o, f.Selection, append(append([]interface{}{}, path...), i), depth+1))
+		}
+		return list
+	}
+
+	if len(f.Selection) > 0 {
+		e.addError(errors.New(fmt.Sprintf("Field %s has no subfields", f.Name)), path)
+		return nil
+	}
+	return value
+}
+
+// Replaces variables in an argument value
+func (e *executor) substitute(v interface{}) interface{} {
+	switch val := v.(type) {
+	case Variable:
+		return e.variables[string(val)]
+
+	case []interface{}:
+		list := []interface{}{}
+
+		for _, item := range val {
+			list = append(list, e.substitute(item))
+		}
+		return list
+
+	case map[string]interface{}:
+		obj := map[string]interface{}{}
+
+		for k, item := range val {
+			obj[k] = e.substitute(item)
+		}
+		return obj
+	}
+	return v
+}
+
+func (e *executor) addError(err error, path []interface{}) {
+	e.errors = append(e.errors, Error{Message: err.Error(), Path: path})
+}
+
+func (r *resultMap) MarshalJSON() ([]byte, error) {
+	if r == nil {
+		return []byte("null"), nil
+	}
+
+	var b bytes.Buffer
+
+	b.WriteByte('{')
+
+	for i, key := range r.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.Quote(key))
+		b.WriteByte(':')
+
+		data, err := json.Marshal(r.values[key])
+
+		if err != nil {
+			return nil, err
+		}
+		b.Write(data)
+	}
+	b.WriteByte('}')
+
+	return b.Bytes(), nil
+}
+
+// Integer argument. Variables from JSON are float numbers
+func (a Args) Int(name string, def int) (int, error) {
+	v, ok := a[name]
+
+	if !ok || v == nil {
+		return def, nil
+	}
+
+	switch n := v.(type) {
+	case int:
+		return n, nil
+	case float64:
+		if n == float64(int(n)) {
+			return int(n), nil
+		}
+	}
+	return 0, errors.New(fmt.Sprintf("Argument %s must be an integer", name))
+}
+
+// String argument. Enum values are accepted as strings
+func (a Args) String(name string, def string) (string, error) {
+	v, ok := a[name]
+
+	if !ok || v == nil {
+		return def, nil
+	}
+
+	switch s := v.(type) {
+	case string:
+		return s, nil
+	case EnumValue:
+		return string(s), nil
+	}
+	return "", errors.New(fmt.Sprintf("Argument %s must be a string", name))
+}
+
+func (a Args) Has(name string) bool {
+	v, ok := a[name]
+
+	return ok && v != nil
+}
@@ -0,0 +1,170 @@
+package graphql
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+func testSchema() Object {
+	var item func(id int) Object
+
+	item = func(id int) Object {
+		return Object{
+			"id":   Value(id),
+			"name": Value("item" + string(rune('0'+id))),
+			"next": func(args Args) (interface{}, error) {
+				return item(id + 1), nil
+			},
+			"broken": func(args Args) (interface{}, error) {
+				return nil, errors.New("Broken field")
+			},
+		}
+	}
+
+	return Object{
+		"item": func(args Args) (interface{}, error) {
+			id, err := args.Int("id", 1)
+			return item(id), err
+		},
+		"items": func(args Args) (interface{}, error) {
+			limit, err := args.Int("limit", 2)
+			list := []Object{}
+
+			for i := 0; i < limit; i++ {
+				list = append(list, item(i))
+			}
+			return list, err
+		},
+		"echo": func(args Args) (interface{}, error) {
+			return args.String("s", "")
+		},
+	}
+}
+
+func TestExecute(t *testing.T) {
+	cases := map[string]string{
+		`{ item(id: 3) { id name } }`:                             `{"data":{"item":{"id":3,"name":"item3"}}}`,
+		`{ b: item { next { next { id } } } a: echo(s: "x\"y") }`: `{"data":{"b":{"next":{"next":{"id":3}}},"a":"x\"y"}}`,
+		`query Q($n: Int = 1) { items(limit: $n) { id } }`:        `{"data":{"items":[{"id":0}]}}`,
+		`{ items { ...F } } fragment F on Item { id, name }`:      `{"data":{"items":[{"id":0,"name":"item0"},{"id":1,"name":"item1"}]}}`,
+		`{ item { ... on Item { id } } echo(s: ENUMVAL) }`:        `{"data":{"item":{"id":1},"echo":"ENUMVAL"}}`,
+		`{ item { id broken } }`:                                  `{"data":{"item":{"id":1,"broken":null}},"errors":[{"message":"Broken field","path":["item","broken"]}]}`,
+		`{ item { unknown } }`:                                    `{"data":{"item":{"unknown":null}},"errors":[{"message":"Unknown field unknown","path":["item","unknown"]}]}`,
+		`# comment
+		{ echo(s: """ block """) }`: `{"data":{"echo":"block"}}`,
+	}
+
+	for query, expected := range cases {
+		data, err := json.Marshal(Execute(testSchema(), query, nil, ""))
+
+		if err != nil {
+			t.Fatalf("Marshal error %s for %s", err.Error(), query)
+		}
+
+		if string(data) != expected {
+			t.Fatalf("Result %s, expected %s for %s", data, expected, query)
+		}
+	}
+}
+
+func TestVariables(t *testing.T) {
+	resp := Execute(testSchema(), `query A($id: Int!) { item(id: $id) { id } } query B { echo(s: "b") }`,
+		map[string]interface{}{"id": float64(5)}, "A")
+
+	data, _ := json.Marshal(resp)
+
+	if string(data) != `{"data":{"item":{"id":5}}}` {
+		t.Fatalf("Result %s", data)
+	}
+
+	resp = Execute(testSchema(), `query A { echo } query B { echo }`, nil, "")
+
+	if len(resp.Errors) != 1 || resp.Data != nil {
+		t.Fatalf("Expected error for many operations without name, got %v", resp)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	queries := []string{
+		`{ item { id }`,
+		`mutation { item }`,
+		`{ item @include(if: true) }`,
+		`{ items { ...F } }`,
+		`{ items { ...F } } fragment F on Item { ...F }`,
+		`{ echo(s: "abc) }`,
+		`{ }`,
+	}
+
+	for _, query := range queries {
+		_, err := Parse(query)
+
+		if err == nil {
+			t.Fatalf("Expected error for %s", query)
+		}
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	query := "{ item "
+
+	for i := 0; i < MaxDepth+1; i++ {
+		query += "{ next "
+	}
+	query += "{ id }"
+
+	for i := 0; i < MaxDepth+2; i++ {
+		query += " }"
+	}
+
+	resp := Execute(testSchema(), query, nil, "")
+
+	if len(resp.Errors) != 1 {
+		t.Fatalf("Expected depth error, got %v", resp.Errors)
+	}
+}
+
+func TestMaxFields(t *testing.T) {
+	aliases := func(n int) string {
+		query := "{"
+
+		for i := 0; i < n; i++ {
+			query += " a" + strconv.Itoa(i) + ": echo"
+		}
+		return query + " }"
+	}
+
+	resp := Execute(testSchema(), aliases(MaxFields), nil, "")
+
+	if len(resp.Errors) != 0 {
+		t.Fatalf("Expected no errors, got %v", resp.Errors)
+	}
+
+	// lists multiply fields of a selection
+	queries := []string{
+		aliases(MaxFields + 1),
+		`{ a: items(limit: 5000) { id } b: items(limit: 5000) { id } }`,
+	}
+
+	for _, query := range queries {
+		resp := Execute(testSchema(), query, nil, "")
+
+		if len(resp.Errors) != 1 || resp.Data != nil {
+			t.Fatalf("Expected fields limit error, got %v", resp.Errors)
+		}
+	}
+
+	// every fragment doubles fields of the query
+	query := "{ item { ...F0 } }"
+
+	for i := 0; i < 20; i++ {
+		query += fmt.Sprintf(" fragment F%d on Item { ...F%d ...F%d }", i, i+1, i+1)
+	}
+	query += " fragment F20 on Item { id }"
+
+	if _, err := Parse(query); err == nil {
+		t.Fatalf("Expected fields limit error for fragments")
+	}
+}
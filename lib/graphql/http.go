@@ -0,0 +1,79 @@
+package graphql
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+)
+
+// Max size of a request body
+const maxRequestSize = 1 << 20
+
+type request struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// Executes a query of one HTTP request
+type ExecuteFunc func(query string, variables map[string]interface{}, operationName string) Response
+
+// HTTP handler of queries. Accepts POST with JSON body or GET with query arguments
+func Handler(execute ExecuteFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{}
+
+		switch r.Method {
+		case http.MethodGet:
+			req.Query = r.URL.Query().Get("query")
+			req.OperationName = r.URL.Query().Get("operationName")
+
+			if v := r.URL.Query().Get("variables"); v != "" {
+				if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+					writeResponse(w, http.StatusBadRequest, Response{Errors: []Error{Error{Message: "Variables are not valid JSON"}}})
+					return
+				}
+			}
+
+		case http.MethodPost:
+			body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+
+			if err != nil {
+				writeResponse(w, http.StatusBadRequest, Response{Errors: []Error{Error{Message: err.Error()}}})
+				return
+			}
+
+			if r.Header.Get("Content-Type") == "application/graphql" {
+				req.Query = string(body)
+			} else if err := json.Unmarshal(body, &req); err != nil {
+				writeResponse(w, http.StatusBadRequest, Response{Errors: []Error{Error{Message: "Request is not valid JSON"}}})
+				return
+			}
+
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeResponse(w, http.StatusMethodNotAllowed, Response{Errors: []Error{Error{Message: "Use GET or POST"}}})
+			return
+		}
+
+		if req.Query == "" {
+			writeResponse(w, http.StatusBadRequest, Response{Errors: []Error{Error{Message: "Query is missed"}}})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, execute(req.Query, req.Variables, req.OperationName))
+	})
+}
+
+func writeResponse(w http.ResponseWriter, status int, resp Response) {
+	data, err := json.Marshal(resp)
+
+	if err != nil {
+		status = http.StatusInternalServerError
+		data, _ = json.Marshal(Response{Errors: []Error{Error{Message: err.Error()}}})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
@@ -0,0 +1,716 @@
+package graphql
+
+/*
+* Parser of GraphQL queries. Supports queries with variables, aliases, arguments and fragments.
+* Mutations, subscriptions and directives are not supported
+ */
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	tokenEOF = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind  int
+	value string
+	pos   int
+}
+
+// Variable used as argument value. It is replaced with a value on execution
+type Variable string
+
+// Enum value used as argument. Resolvers get it as a string
+type EnumValue string
+
+type Field struct {
+	Alias     string
+	Name      string
+	Arguments map[string]interface{}
+	Selection []*Field
+
+	// fragment spread. It is replaced with fields of the fragment after parsing
+	spread string
+}
+
+type Operation struct {
+	Name string
+	// default values of variables
+	Variables map[string]interface{}
+	Selection []*Field
+}
+
+type Document struct {
+	Operations []*Operation
+	fragments  map[string][]*Field
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// Key of a field in a result
+func (f *Field) ResultKey() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// Parses a query document
+func Parse(query string) (*Document, error) {
+	tokens, err := tokenize(query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+
+	doc := &Document{fragments: map[string][]*Field{}}
+
+	for p.peek().kind != tokenEOF {
+		t := p.peek()
+
+		switch {
+		case t.kind == tokenPunct && t.value == "{":
+			sel, err := p.parseSelectionSet()
+
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, &Operation{Selection: sel, Variables: map[string]interface{}{}})
+
+		case t.kind == tokenName && t.value == "query":
+			op, err := p.parseOperation()
+
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, op)
+
+		case t.kind == tokenName && t.value == "fragment":
+			err := p.parseFragment(doc)
+
+			if err != nil {
+				return nil, err
+			}
+
+		case t.kind == tokenName && (t.value == "mutation" || t.value == "subscription"):
+			return nil, errors.New(fmt.Sprintf("Operation %s is not supported", t.value))
+
+		default:
+			return nil, p.unexpected(t)
+		}
+	}
+
+	if len(doc.Operations) == 0 {
+		return nil, errors.New("No operations in a query")
+	}
+
+	for _, op := range doc.Operations {
+		count := 0
+		op.Selection, err = doc.expandFragments(op.Selection, map[string]bool{}, &count)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// Returns an operation by name. Name can be empty if a document has one operation
+func (d *Document) GetOperation(name string) (*Operation, error) {
+	if name == "" {
+		if len(d.Operations) > 1 {
+			return nil, errors.New("Operation name is required when a query has many operations")
+		}
+		return d.Operations[0], nil
+	}
+
+	for _, op := range d.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("Operation %s not found", name))
+}
+
+// Count of fields is checked, fragments spreading other fragments many times could make a huge query
+func (d *Document) expandFragments(fields []*Field, visited map[string]bool, count *int) ([]*Field, error) {
+	result := []*Field{}
+
+	for _, f := range fields {
+		if f.spread == "" {
+			*count++
+
+			if *count > MaxFields {
+				return nil, errors.New(fmt.Sprintf("Query has more than %d fields", MaxFields))
+			}
+
+			if len(f.Selection) > 0 {
+				sel, err := d.expandFragments(f.Selection, visited, count)
+
+				if err != nil {
+					return nil, err
+				}
+				f.Selection = sel
+			}
+			result = append(result, f)
+			continue
+		}
+
+		fragment, ok := d.fragments[f.spread]
+
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("Fragment %s is not defined", f.spread))
+		}
+
+		if visited[f.spread] {
+			return nil, errors.New(fmt.Sprintf("Fragment %s spreads itself", f.spread))
+		}
+		visited[f.spread] = true
+
+		sel, err := d.expandFragments(fragment, visited, count)
+
+		if err != nil {
+			return nil, err
+		}
+		delete(visited, f.spread)
+
+		result = append(result, sel...)
+	}
+	return result, nil
+}
+
+func (p *parser) parseOperation() (*Operation, error) {
+	p.next() // query
+
+	op := &Operation{Variables: map[string]interface{}{}}
+
+	if p.peek().kind == tokenName {
+		op.Name = p.next().value
+	}
+
+	if p.isPunct("(") {
+		p.next()
+
+		for !p.isPunct(")") {
+			err := p.expectPunct("$")
+
+			if err != nil {
+				return nil, err
+			}
+
+			name, err := p.expectName()
+
+			if err != nil {
+				return nil, err
+			}
+
+			err = p.expectPunct(":")
+
+			if err != nil {
+				return nil, err
+			}
+
+			// types are not checked, resolvers convert values
+			err = p.skipType()
+
+			if err != nil {
+				return nil, err
+			}
+
+			op.Variables[name] = nil
+
+			if p.isPunct("=") {
+				p.next()
+
+				op.Variables[name], err = p.parseValue(true)
+
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		p.next()
+	}
+
+	if p.isPunct("@") {
+		return nil, errors.New("Directives are not supported")
+	}
+
+	sel, err := p.parseSelectionSet()
+
+	if err != nil {
+		return nil, err
+	}
+	op.Selection = sel
+
+	return op, nil
+}
+
+func (p *parser) parseFragment(doc *Document) error {
+	p.next() // fragment
+
+	name, err := p.expectName()
+
+	if err != nil {
+		return err
+	}
+
+	if t := p.next(); t.kind != tokenName || t.value != "on" {
+		return p.unexpected(t)
+	}
+
+	_, err = p.expectName()
+
+	if err != nil {
+		return err
+	}
+
+	sel, err := p.parseSelectionSet()
+
+	if err != nil {
+		return err
+	}
+
+	if _, ok := doc.fragments[name]; ok {
+		return errors.New(fmt.Sprintf("Fragment %s is defined twice", name))
+	}
+	doc.fragments[name] = sel
+
+	return nil
+}
+
+func (p *parser) skipType() error {
+	if p.isPunct("[") {
+		p.next()
+
+		err := p.skipType()
+
+		if err != nil {
+			return err
+		}
+
+		err = p.expectPunct("]")
+
+		if err != nil {
+			return err
+		}
+	} else {
+		_, err := p.expectName()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.isPunct("!") {
+		p.next()
+	}
+	return nil
+}
+
+func (p *parser) parseSelectionSet() ([]*Field, error) {
+	err := p.expectPunct("{")
+
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []*Field{}
+
+	for !p.isPunct("}") {
+		if p.peek().kind == tokenEOF {
+			return nil, errors.New("Unexpected end of a query")
+		}
+
+		if p.isPunct("...") {
+			p.next()
+
+			t := p.peek()
+
+			if t.kind == tokenName && t.value != "on" {
+				p.next()
+				fields = append(fields, &Field{spread: t.value})
+				continue
+			}
+
+			// inline fragment. Type condition is not checked, there are no unions in schemas
+			if t.kind == tokenName {
+				p.next()
+
+				_, err := p.expectName()
+
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			sel, err := p.parseSelectionSet()
+
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, sel...)
+			continue
+		}
+
+		f, err := p.parseField()
+
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	p.next()
+
+	if len(fields) == 0 {
+		return nil, errors.New("Selection set is empty")
+	}
+	return fields, nil
+}
+
+func (p *parser) parseField() (*Field, error) {
+	name, err := p.expectName()
+
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Field{Name: name, Arguments: map[string]interface{}{}}
+
+	if p.isPunct(":") {
+		p.next()
+
+		f.Alias = name
+
+		f.Name, err = p.expectName()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.isPunct("(") {
+		p.next()
+
+		for !p.isPunct(")") {
+			argName, err := p.expectName()
+
+			if err != nil {
+				return nil, err
+			}
+
+			err = p.expectPunct(":")
+
+			if err != nil {
+				return nil, err
+			}
+
+			f.Arguments[argName], err = p.parseValue(false)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+		p.next()
+	}
+
+	if p.isPunct("@") {
+		return nil, errors.New("Directives are not supported")
+	}
+
+	if p.isPunct("{") {
+		f.Selection, err = p.parseSelectionSet()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Parses argument value. Variables are not allowed in default values of variables
+func (p *parser) parseValue(constant bool) (interface{}, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokenInt:
+		return strconv.Atoi(t.value)
+
+	case tokenFloat:
+		return strconv.ParseFloat(t.value, 64)
+
+	case tokenString:
+		return t.value, nil
+
+	case tokenName:
+		switch t.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return EnumValue(t.value), nil
+
+	case tokenPunct:
+		switch t.value {
+		case "$":
+			if constant {
+				return nil, errors.New("Variable can not be used in a default value")
+			}
+			name, err := p.expectName()
+
+			if err != nil {
+				return nil, err
+			}
+			return Variable(name), nil
+
+		case "[":
+			list := []interface{}{}
+
+			for !p.isPunct("]") {
+				if p.peek().kind == tokenEOF {
+					return nil, errors.New("Unexpected end of a query")
+				}
+				v, err := p.parseValue(constant)
+
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			p.next()
+
+			return list, nil
+
+		case "{":
+			obj := map[string]interface{}{}
+
+			for !p.isPunct("}") {
+				name, err := p.expectName()
+
+				if err != nil {
+					return nil, err
+				}
+
+				err = p.expectPunct(":")
+
+				if err != nil {
+					return nil, err
+				}
+
+				obj[name], err = p.parseValue(constant)
+
+				if err != nil {
+					return nil, err
+				}
+			}
+			p.next()
+
+			return obj, nil
+		}
+	}
+	return nil, p.unexpected(t)
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isPunct(value string) bool {
+	t := p.peek()
+	return t.kind == tokenPunct && t.value == value
+}
+
+func (p *parser) expectPunct(value string) error {
+	t := p.next()
+
+	if t.kind != tokenPunct || t.value != value {
+		return p.unexpected(t)
+	}
+	return nil
+}
+
+func (p *parser) expectName() (string, error) {
+	t := p.next()
+
+	if t.kind != tokenName {
+		return "", p.unexpected(t)
+	}
+	return t.value, nil
+}
+
+func (p *parser) unexpected(t token) error {
+	if t.kind == tokenEOF {
+		return errors.New("Unexpected end of a query")
+	}
+	return errors.New(fmt.Sprintf("Unexpected %s at position %d", t.value, t.pos))
+}
+
+func tokenize(query string) ([]token, error) {
+	tokens := []token{}
+
+	i := 0
+
+	for i < len(query) {
+		c := query[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+
+		case c == '#':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+
+		case strings.IndexByte("!$():=@[]{}|", c) >= 0:
+			tokens = append(tokens, token{tokenPunct, string(c), i})
+			i++
+
+		case c == '.':
+			if !strings.HasPrefix(query[i:], "...") {
+				return nil, errors.New(fmt.Sprintf("Unexpected . at position %d", i))
+			}
+			tokens = append(tokens, token{tokenPunct, "...", i})
+			i += 3
+
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			start := i
+
+			for i < len(query) && isNameChar(query[i]) {
+				i++
+			}
+			tokens = append(tokens, token{tokenName, query[start:i], start})
+
+		case c == '-' || (c >= '0' && c <= '9'):
+			start := i
+			kind := tokenInt
+
+			i++
+
+			for i < len(query) {
+				d := query[i]
+
+				if d >= '0' && d <= '9' {
+					i++
+				} else if d == '.' || d == 'e' || d == 'E' || ((d == '-' || d == '+') && (query[i-1] == 'e' || query[i-1] == 'E')) {
+					kind = tokenFloat
+					i++
+				} else {
+					break
+				}
+			}
+			tokens = append(tokens, token{kind, query[start:i], start})
+
+		case c == '"':
+			start := i
+
+			value, end, err := readString(query, i)
+
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokenString, value, start})
+			i = end
+
+		default:
+			return nil, errors.New(fmt.Sprintf("Unexpected character %q at position %d", c, i))
+		}
+	}
+	tokens = append(tokens, token{tokenEOF, "", len(query)})
+
+	return tokens, nil
+}
+
+// Reads a string starting with a quote. Returns a value and a position after the string
+func readString(query string, start int) (string, int, error) {
+	if strings.HasPrefix(query[start:], `"""`) {
+		end := strings.Index(query[start+3:], `"""`)
+
+		if end < 0 {
+			return "", 0, errors.New(fmt.Sprintf("String at position %d is not closed", start))
+		}
+		return strings.TrimSpace(query[start+3 : start+3+end]), start + 6 + end, nil
+	}
+
+	var b strings.Builder
+
+	i := start + 1
+
+	for i < len(query) {
+		c := query[i]
+
+		if c == '"' {
+			return b.String(), i + 1, nil
+		}
+
+		if c == '\n' {
+			break
+		}
+
+		if c == '\\' && i+1 < len(query) {
+			i++
+
+			switch query[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'u':
+				if i+4 >= len(query) {
+					return "", 0, errors.New(fmt.Sprintf("Bad escape in string at position %d", i))
+				}
+				code, err := strconv.ParseUint(query[i+1:i+5], 16, 32)
+
+				if err != nil {
+					return "", 0, errors.New(fmt.Sprintf("Bad escape in string at position %d", i))
+				}
+				b.WriteRune(rune(code))
+				i += 4
+			default:
+				b.WriteByte(query[i])
+			}
+			i++
+			continue
+		}
+		b.WriteByte(c)
+		i++
+	}
+	return "", 0, errors.New(fmt.Sprintf("String at position %d is not closed", start))
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
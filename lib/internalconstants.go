@@ -8,5 +8,6 @@ const (
 	QueryKindDelete = "delete"
 	QueryKindCreate = "create"
 	QueryKindDrop   = "drop"
+	QueryKindAlter  = "alter"
 	QueryKindOther  = "other"
 )
@@ -0,0 +1,215 @@
+package jsonrpc
+
+/*
+* JSON-RPC 2.0 over HTTP. A request is POST with one call or a batch, params are an object or an array.
+* Calls need HTTP basic auth of a user from config, every user has a list of allowed methods.
+* Public methods can be called without auth
+ */
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// Max size of a request body
+const maxRequestSize = 1 << 20
+
+// Codes of errors
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	// errors of a server
+	CodeServerError  = -32000
+	CodeUnauthorized = -32001
+)
+
+type Config struct {
+	// host:port of HTTP server. Empty means off
+	Address string
+	Users   []User
+	// methods which don't need auth. nil means a default list of a server
+	PublicMethods []string
+}
+
+type User struct {
+	User     string
+	Password string
+	// allowed methods. Empty means all
+	Methods []string
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func NewError(code int, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Executes a call. Params are raw JSON, null if they are not set
+type HandleFunc func(r *http.Request, method string, params Params) (interface{}, error)
+
+// Returns an error if a client of the HTTP request can not call the method
+func (c Config) Authorize(r *http.Request, method string, public []string) error {
+	if c.PublicMethods != nil {
+		public = c.PublicMethods
+	}
+
+	if inList(public, method) {
+		return nil
+	}
+
+	name, password, ok := r.BasicAuth()
+
+	if !ok {
+		return NewError(CodeUnauthorized, "Auth is required for "+method)
+	}
+
+	for _, user := range c.Users {
+		if user.User != name || subtle.ConstantTimeCompare([]byte(user.Password), []byte(password)) != 1 {
+			continue
+		}
+
+		if len(user.Methods) > 0 && !inList(user.Methods, method) {
+			return NewError(CodeUnauthorized, fmt.Sprintf("User %s can not call %s", name, method))
+		}
+		return nil
+	}
+	return NewError(CodeUnauthorized, "Wrong user or password")
+}
+
+func inList(list []string, method string) bool {
+	for _, m := range list {
+		if m == method || m == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// HTTP handler of calls
+func Handler(handle HandleFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			writeResponse(w, http.StatusMethodNotAllowed, errorResponse(nil, NewError(CodeInvalidRequest, "Use POST")))
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+
+		if err != nil {
+			writeResponse(w, http.StatusBadRequest, errorResponse(nil, NewError(CodeParseError, err.Error())))
+			return
+		}
+
+		body = bytes.TrimSpace(body)
+
+		if len(body) > 0 && body[0] == '[' {
+			batch := []json.RawMessage{}
+
+			if json.Unmarshal(body, &batch) != nil {
+				writeResponse(w, http.StatusOK, errorResponse(nil, NewError(CodeParseError, "Request is not valid JSON")))
+				return
+			}
+
+			if len(batch) == 0 {
+				writeResponse(w, http.StatusOK, errorResponse(nil, NewError(CodeInvalidRequest, "Batch is empty")))
+				return
+			}
+
+			responses := []map[string]interface{}{}
+
+			for _, call := range batch {
+				if resp := execute(r, handle, call); resp != nil {
+					responses = append(responses, resp)
+				}
+			}
+
+			if len(responses) == 0 {
+				// only notifications
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			writeResponse(w, http.StatusOK, responses)
+			return
+		}
+
+		resp := execute(r, handle, body)
+
+		if resp == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeResponse(w, http.StatusOK, resp)
+	})
+}
+
+// Executes one call. Returns nil for a notification
+func execute(r *http.Request, handle HandleFunc, data []byte) map[string]interface{} {
+	req := request{}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		return errorResponse(nil, NewError(CodeParseError, "Request is not valid JSON"))
+	}
+
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return errorResponse(req.ID, NewError(CodeInvalidRequest, "Request is not JSON-RPC 2.0"))
+	}
+
+	result, err := handle(r, req.Method, Params(req.Params))
+
+	if req.ID == nil {
+		return nil
+	}
+
+	if err != nil {
+		rerr, ok := err.(*Error)
+
+		if !ok {
+			rerr = NewError(CodeServerError, err.Error())
+		}
+		return errorResponse(req.ID, rerr)
+	}
+	return map[string]interface{}{"jsonrpc": "2.0", "result": result, "id": req.ID}
+}
+
+func errorResponse(id json.RawMessage, err *Error) map[string]interface{} {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return map[string]interface{}{"jsonrpc": "2.0", "error": err, "id": id}
+}
+
+func writeResponse(w http.ResponseWriter, status int, resp interface{}) {
+	data, err := json.Marshal(resp)
+
+	if err != nil {
+		status = http.StatusInternalServerError
+		data, _ = json.Marshal(errorResponse(nil, NewError(CodeInternalError, err.Error())))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
@@ -0,0 +1,109 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testServer() *httptest.Server {
+	config := Config{Users: []User{
+		User{User: "admin", Password: "secret"},
+		User{User: "reader", Password: "pass", Methods: []string{"echo"}}}}
+
+	return httptest.NewServer(Handler(func(r *http.Request, method string, params Params) (interface{}, error) {
+		if err := config.Authorize(r, method, []string{"echo"}); err != nil {
+			return nil, err
+		}
+
+		switch method {
+		case "echo":
+			s := ""
+			err := params.Require("s", 0, &s)
+
+			return s, err
+		case "stop":
+			return true, nil
+		}
+		return nil, NewError(CodeMethodNotFound, "Method not found")
+	}))
+}
+
+func call(t *testing.T, server *httptest.Server, user, password, body string) (int, string) {
+	req, _ := http.NewRequest("POST", server.URL, strings.NewReader(body))
+
+	if user != "" {
+		req.SetBasicAuth(user, password)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		t.Fatalf("Request error: %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	data, _ := ioutil.ReadAll(resp.Body)
+
+	return resp.StatusCode, string(data)
+}
+
+func TestCalls(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+
+	tests := []struct {
+		user     string
+		password string
+		body     string
+		expected string
+	}{
+		{"", "", `{"jsonrpc":"2.0","method":"echo","params":{"s":"hi"},"id":1}`, `{"id":1,"jsonrpc":"2.0","result":"hi"}`},
+		{"", "", `{"jsonrpc":"2.0","method":"echo","params":["hi"],"id":"a"}`, `{"id":"a","jsonrpc":"2.0","result":"hi"}`},
+		{"", "", `{"jsonrpc":"2.0","method":"echo","id":2}`, `{"error":{"code":-32602,"message":"Param s is required"},"id":2,"jsonrpc":"2.0"}`},
+		{"", "", `{"jsonrpc":"2.0","method":"stop","id":3}`, `{"error":{"code":-32001,"message":"Auth is required for stop"},"id":3,"jsonrpc":"2.0"}`},
+		{"reader", "pass", `{"jsonrpc":"2.0","method":"stop","id":4}`, `{"error":{"code":-32001,"message":"User reader can not call stop"},"id":4,"jsonrpc":"2.0"}`},
+		{"admin", "wrong", `{"jsonrpc":"2.0","method":"stop","id":5}`, `{"error":{"code":-32001,"message":"Wrong user or password"},"id":5,"jsonrpc":"2.0"}`},
+		{"admin", "secret", `{"jsonrpc":"2.0","method":"stop","id":6}`, `{"id":6,"jsonrpc":"2.0","result":true}`},
+		{"admin", "secret", `{"jsonrpc":"2.0","method":"nope","id":7}`, `{"error":{"code":-32601,"message":"Method not found"},"id":7,"jsonrpc":"2.0"}`},
+		{"", "", `{"method":"echo","id":8}`, `{"error":{"code":-32600,"message":"Request is not JSON-RPC 2.0"},"id":8,"jsonrpc":"2.0"}`},
+		{"", "", `{bad`, `{"error":{"code":-32700,"message":"Request is not valid JSON"},"id":null,"jsonrpc":"2.0"}`},
+		// a notification has no response
+		{"", "", `[{"jsonrpc":"2.0","method":"echo","params":["a"],"id":1},{"jsonrpc":"2.0","method":"echo","params":["b"]}]`,
+			`[{"id":1,"jsonrpc":"2.0","result":"a"}]`},
+	}
+
+	for _, test := range tests {
+		status, body := call(t, server, test.user, test.password, test.body)
+
+		if status != http.StatusOK || body != test.expected {
+			t.Fatalf("For %s got %d %s", test.body, status, body)
+		}
+	}
+
+	if status, _ := call(t, server, "", "", `{"jsonrpc":"2.0","method":"echo","params":["b"]}`); status != http.StatusNoContent {
+		t.Fatalf("Notification got status %d", status)
+	}
+}
+
+func TestParams(t *testing.T) {
+	params := Params(json.RawMessage(`{"height":5,"hash":null}`))
+
+	height := 0
+	hash := ""
+
+	if ok, err := params.Get("height", 0, &height); !ok || err != nil || height != 5 {
+		t.Fatalf("Got %d %v %v", height, ok, err)
+	}
+
+	if ok, _ := params.Get("hash", 1, &hash); ok {
+		t.Fatalf("Null param is set")
+	}
+
+	if _, err := params.Get("height", 0, &hash); err == nil {
+		t.Fatalf("Param of wrong type is read")
+	}
+}
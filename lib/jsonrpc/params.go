@@ -0,0 +1,68 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Params of a call. An object with names or an array with positions
+type Params json.RawMessage
+
+// Reads a param by name from an object or by position from an array. Returns false if it is not set
+func (p Params) Get(name string, pos int, value interface{}) (bool, error) {
+	data := bytes.TrimSpace(p)
+
+	if len(data) == 0 || string(data) == "null" {
+		return false, nil
+	}
+
+	var raw json.RawMessage
+
+	if data[0] == '[' {
+		list := []json.RawMessage{}
+
+		if json.Unmarshal(data, &list) != nil {
+			return false, NewError(CodeInvalidParams, "Params are not valid JSON")
+		}
+
+		if pos >= len(list) {
+			return false, nil
+		}
+		raw = list[pos]
+	} else {
+		obj := map[string]json.RawMessage{}
+
+		if json.Unmarshal(data, &obj) != nil {
+			return false, NewError(CodeInvalidParams, "Params must be an object or an array")
+		}
+
+		var ok bool
+
+		if raw, ok = obj[name]; !ok {
+			return false, nil
+		}
+	}
+
+	if string(raw) == "null" {
+		return false, nil
+	}
+
+	if json.Unmarshal(raw, value) != nil {
+		return false, NewError(CodeInvalidParams, "Param "+name+" has wrong type")
+	}
+	return true, nil
+}
+
+// Reads a param which must be set
+func (p Params) Require(name string, pos int, value interface{}) error {
+	ok, err := p.Get(name, pos, value)
+
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return NewError(CodeInvalidParams, "Param "+name+" is required")
+	}
+	return nil
+}
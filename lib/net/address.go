@@ -0,0 +1,175 @@
+package net
+
+/*
+* Hosts of nodes. A host is an IP address, v4 or v6, or a DNS name. In strings IPv6 is in brackets, like [::1]:8765.
+* Names are resolved when a node connects and kept in a cache for some time, so a name is resolved again
+* periodically and a node which moved to other IP is found. If a name has many IPs, connections rotate over them,
+* next IP is tried when one is not available
+ */
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long resolved IPs of a name are used
+var DNSCacheTTL = 5 * time.Minute
+
+type resolvedHost struct {
+	ips     []string
+	expires time.Time
+	next    int
+}
+
+var resolvedHosts = map[string]*resolvedHost{}
+var resolveLock sync.Mutex
+
+// Resolver of names. It is replaced in tests
+var lookupHost = net.DefaultResolver.LookupHost
+
+// Checks if a host is an IP address or a valid DNS name. IPv6 can be in brackets
+func ValidateHost(host string) error {
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+
+	if host == "" {
+		return errors.New("Host is empty")
+	}
+
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+
+	name := strings.TrimSuffix(host, ".")
+
+	if len(name) > 253 {
+		return errors.New(fmt.Sprintf("Host name %s is too long", host))
+	}
+
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return errors.New(fmt.Sprintf("Host name %s has wrong part", host))
+		}
+
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return errors.New(fmt.Sprintf("Host name %s has wrong part %s", host, label))
+		}
+
+		for _, c := range label {
+			// underscore is not allowed by RFC 1123, but names of containers often have it
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return errors.New(fmt.Sprintf("Host name %s has wrong symbol %q", host, c))
+			}
+		}
+	}
+	return nil
+}
+
+// Host without brackets of IPv6
+func (n NodeAddr) hostName() string {
+	return strings.TrimSuffix(strings.TrimPrefix(n.Host, "["), "]")
+}
+
+// Splits host:port. IPv6 must be in brackets, the host is returned without them
+func splitHostPort(addr string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	port, err := strconv.Atoi(portStr)
+
+	if err != nil {
+		return "", 0, err
+	}
+	return host, port, nil
+}
+
+// Returns IPs of a host. A name is resolved again when its cache is expired
+func resolveHost(ctx context.Context, host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+
+	resolveLock.Lock()
+	r, ok := resolvedHosts[host]
+	resolveLock.Unlock()
+
+	if ok && time.Now().Before(r.expires) {
+		return r.rotate(), nil
+	}
+
+	ips, err := lookupHost(ctx, host)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ips) == 0 {
+		return nil, errors.New(fmt.Sprintf("No addresses for %s", host))
+	}
+
+	r = &resolvedHost{ips: ips, expires: time.Now().Add(DNSCacheTTL)}
+
+	resolveLock.Lock()
+	resolvedHosts[host] = r
+	resolveLock.Unlock()
+
+	return r.rotate(), nil
+}
+
+// Returns IPs starting from next one. Every call starts from other IP
+func (r *resolvedHost) rotate() []string {
+	resolveLock.Lock()
+	defer resolveLock.Unlock()
+
+	ips := make([]string, 0, len(r.ips))
+	ips = append(ips, r.ips[r.next:]...)
+	ips = append(ips, r.ips[:r.next]...)
+
+	r.next = (r.next + 1) % len(r.ips)
+
+	return ips
+}
+
+// Removes a name from the cache. It is resolved again on next connection
+func forgetHost(host string) {
+	resolveLock.Lock()
+	delete(resolvedHosts, host)
+	resolveLock.Unlock()
+}
+
+// Connects to one of IPs of a host. If none of them is available, the name is resolved again next time
+func dialHost(ctx context.Context, dialer *net.Dialer, addr NodeAddr) (net.Conn, error) {
+	ips, err := resolveHost(ctx, addr.hostName())
+
+	if err != nil {
+		return nil, err
+	}
+
+	port := strconv.Itoa(addr.Port)
+
+	for _, ip := range ips {
+		var conn net.Conn
+
+		conn, err = dialer.DialContext(ctx, Protocol, net.JoinHostPort(ip, port))
+
+		if err == nil {
+			return conn, nil
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	forgetHost(addr.hostName())
+
+	return nil, err
+}
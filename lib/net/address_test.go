@@ -0,0 +1,83 @@
+package net
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLoadAddress(t *testing.T) {
+	tests := map[string]NodeAddr{
+		"localhost:8765":        NodeAddr{Host: "localhost", Port: 8765},
+		"192.168.1.10:8765":     NodeAddr{Host: "192.168.1.10", Port: 8765},
+		"[::1]:8765":            NodeAddr{Host: "::1", Port: 8765},
+		"[2001:db8::1]:8765":    NodeAddr{Host: "2001:db8::1", Port: 8765},
+		"node-1.example.com:80": NodeAddr{Host: "node-1.example.com", Port: 80},
+	}
+
+	for str, expected := range tests {
+		addr := NodeAddr{}
+
+		err := addr.LoadFromString(str)
+
+		if err != nil {
+			t.Fatalf("Parse %s error: %s", str, err.Error())
+		}
+
+		if addr.Host != expected.Host || addr.Port != expected.Port {
+			t.Fatalf("Parsed %s as %s %d", str, addr.Host, addr.Port)
+		}
+
+		if addr.String() != str {
+			t.Fatalf("Address %s is converted to %s", str, addr.String())
+		}
+	}
+
+	for _, str := range []string{"::1:8765", "localhost", "bad host:8765", "-node.com:8765", "node..com:8765", "node.com:port"} {
+		addr := NodeAddr{}
+
+		if addr.LoadFromString(str) == nil {
+			t.Fatalf("Wrong address %s is parsed", str)
+		}
+	}
+
+	if !(NodeAddr{Host: "2001:db8::1", Port: 80}).CompareToAddress(NodeAddr{Host: "2001:0db8:0:0::1", Port: 80}) {
+		t.Fatalf("Same IPv6 addresses are not equal")
+	}
+}
+
+func TestResolveRotation(t *testing.T) {
+	original := lookupHost
+
+	defer func() {
+		lookupHost = original
+		resolvedHosts = map[string]*resolvedHost{}
+	}()
+
+	lookups := 0
+
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		lookups++
+		return []string{"10.0.0.1", "10.0.0.2"}, nil
+	}
+
+	ips1, _ := resolveHost(context.Background(), "node.example.com")
+	ips2, _ := resolveHost(context.Background(), "node.example.com")
+
+	if lookups != 1 {
+		t.Fatalf("Name is resolved %d times", lookups)
+	}
+
+	if ips1[0] != "10.0.0.1" || ips2[0] != "10.0.0.2" || len(ips2) != 2 {
+		t.Fatalf("IPs are not rotated %v %v", ips1, ips2)
+	}
+
+	// cache is expired
+	resolvedHosts["node.example.com"].expires = time.Now().Add(-time.Second)
+
+	resolveHost(context.Background(), "node.example.com")
+
+	if lookups != 2 {
+		t.Fatalf("Name is not resolved again")
+	}
+}
@@ -0,0 +1,203 @@
+package net
+
+/*
+* Limits of bandwidth of a node. A node which syncs from us can take all the uplink, so traffic is limited for
+* every peer and for all peers together. Every limit is a bucket of bytes, a read or a write takes bytes from
+* the bucket of the peer and the global bucket and waits when there are not enough. Peers are known by host
+ */
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// Bytes per second. 0 means no limit
+type BandwidthConfig struct {
+	// for all peers together
+	Upload   int64
+	Download int64
+	// for every peer
+	PeerUpload   int64
+	PeerDownload int64
+}
+
+type bandwidthBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// Buckets of all peers. Connections of clients and of the server share it
+type Bandwidth struct {
+	config   BandwidthConfig
+	lock     sync.Mutex
+	upload   *bandwidthBucket
+	download *bandwidthBucket
+	peers    map[string][2]*bandwidthBucket
+}
+
+type throttledConn struct {
+	net.Conn
+	bandwidth *Bandwidth
+	peer      string
+}
+
+// Returns nil if no limits are set
+func NewBandwidth(config BandwidthConfig) *Bandwidth {
+	if config.Upload <= 0 && config.Download <= 0 && config.PeerUpload <= 0 && config.PeerDownload <= 0 {
+		return nil
+	}
+
+	b := &Bandwidth{config: config, peers: map[string][2]*bandwidthBucket{}}
+
+	b.upload = newBandwidthBucket(config.Upload)
+	b.download = newBandwidthBucket(config.Download)
+
+	return b
+}
+
+func newBandwidthBucket(rate int64) *bandwidthBucket {
+	if rate <= 0 {
+		return nil
+	}
+	return &bandwidthBucket{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// Takes bytes and returns how long to wait till they are available. Must be called with the lock
+func (b *bandwidthBucket) take(n int, now time.Time) time.Duration {
+	if b == nil {
+		return 0
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	b.last = now
+
+	// a second of traffic can go at once
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+
+	// tokens can be less than 0, next reads and writes wait longer
+	b.tokens -= float64(n)
+
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Returns true if the bucket was not used for a second. It is same as a new one
+func (b *bandwidthBucket) full(now time.Time) bool {
+	return b == nil || b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.rate
+}
+
+// Wraps a connection with a peer to limit its traffic. The connection is not changed if there are no limits
+func (b *Bandwidth) Wrap(conn net.Conn, peer string) net.Conn {
+	if b == nil {
+		return conn
+	}
+	return &throttledConn{conn, b, peer}
+}
+
+// Largest part of data which is read or written at once, so waits are short
+func (b *Bandwidth) chunk(upload bool) int {
+	chunk := 32 * 1024
+
+	limits := []int64{b.config.Download, b.config.PeerDownload}
+
+	if upload {
+		limits = []int64{b.config.Upload, b.config.PeerUpload}
+	}
+
+	for _, limit := range limits {
+		if limit > 0 && int64(chunk) > limit {
+			chunk = int(limit)
+		}
+	}
+	return chunk
+}
+
+// Takes bytes of a peer and returns how long to wait
+func (b *Bandwidth) take(peer string, n int, upload bool) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+
+	buckets, ok := b.peers[peer]
+
+	if !ok {
+		if len(b.peers) > 10000 {
+			b.forget(now)
+		}
+		buckets = [2]*bandwidthBucket{newBandwidthBucket(b.config.PeerUpload), newBandwidthBucket(b.config.PeerDownload)}
+		b.peers[peer] = buckets
+	}
+
+	global := b.download
+	bucket := buckets[1]
+
+	if upload {
+		global = b.upload
+		bucket = buckets[0]
+	}
+
+	pause := global.take(n, now)
+
+	if p := bucket.take(n, now); p > pause {
+		pause = p
+	}
+	return pause
+}
+
+// Removes buckets of peers which have no traffic now, the map can not grow forever
+func (b *Bandwidth) forget(now time.Time) {
+	for peer, buckets := range b.peers {
+		if buckets[0].full(now) && buckets[1].full(now) {
+			delete(b.peers, peer)
+		}
+	}
+}
+
+func (c *throttledConn) Read(p []byte) (int, error) {
+	if chunk := c.bandwidth.chunk(false); len(p) > chunk {
+		p = p[:chunk]
+	}
+
+	n, err := c.Conn.Read(p)
+
+	if n > 0 {
+		time.Sleep(c.bandwidth.take(c.peer, n, false))
+	}
+	return n, err
+}
+
+func (c *throttledConn) Write(p []byte) (int, error) {
+	chunk := c.bandwidth.chunk(true)
+	written := 0
+
+	for len(p) > 0 {
+		part := p
+
+		if len(part) > chunk {
+			part = part[:chunk]
+		}
+
+		time.Sleep(c.bandwidth.take(c.peer, len(part), true))
+
+		n, err := c.Conn.Write(part)
+
+		written += n
+
+		if err != nil {
+			return written, err
+		}
+		p = p[len(part):]
+	}
+	return written, nil
+}
+
+func (c *throttledConn) NetConn() net.Conn {
+	return c.Conn
+}
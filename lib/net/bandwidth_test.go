@@ -0,0 +1,58 @@
+package net
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+// Writes data to a throttled pipe and returns time of the write
+func writeThrottled(t *testing.T, b *Bandwidth, peer string, size int) time.Duration {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	go io.Copy(ioutil.Discard, server)
+
+	conn := b.Wrap(client, peer)
+
+	start := time.Now()
+
+	n, err := conn.Write(make([]byte, size))
+
+	if err != nil || n != size {
+		t.Fatalf("Write error %v, %d bytes", err, n)
+	}
+	return time.Since(start)
+}
+
+func TestBandwidth(t *testing.T) {
+	if NewBandwidth(BandwidthConfig{}) != nil {
+		t.Fatalf("Limiter without limits is created")
+	}
+
+	b := NewBandwidth(BandwidthConfig{PeerUpload: 100000})
+
+	// a second of traffic goes at once
+	if d := writeThrottled(t, b, "10.0.0.1", 100000); d > 200*time.Millisecond {
+		t.Fatalf("First write waited %s", d)
+	}
+
+	if d := writeThrottled(t, b, "10.0.0.1", 50000); d < 400*time.Millisecond {
+		t.Fatalf("Write over the limit didn't wait, %s", d)
+	}
+
+	// other peer has own limit
+	if d := writeThrottled(t, b, "10.0.0.2", 100000); d > 200*time.Millisecond {
+		t.Fatalf("Write of other peer waited %s", d)
+	}
+
+	global := NewBandwidth(BandwidthConfig{Upload: 100000})
+
+	writeThrottled(t, global, "10.0.0.1", 100000)
+
+	if d := writeThrottled(t, global, "10.0.0.2", 50000); d < 400*time.Millisecond {
+		t.Fatalf("Write over the global limit didn't wait, %s", d)
+	}
+}
@@ -0,0 +1,303 @@
+package net
+
+/*
+* Misbehavior score of peers. A peer which sends invalid blocks, payloads which can not be parsed or too many
+* requests gets points, with Threshold points it is banned for Duration seconds and its connections are closed
+* at once. Points are forgotten slowly, a point a minute. Peers are known by IP, a node address can be spoofed
+ */
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Points for kinds of misbehavior
+const (
+	BanPointsBadRequest     = 20
+	BanPointsUnknownCommand = 10
+	BanPointsInvalidBlock   = 50
+	BanPointsTooManyRequest = 1
+)
+
+// Defaults of banning
+const (
+	defaultBanThreshold         = 100
+	defaultBanDuration          = 24 * 3600
+	defaultBanRequestsPerMinute = 3000
+)
+
+// Options of banning. 0 means a default, Threshold -1 means banning is off, RequestsPerMinute -1 means no limit
+type BanConfig struct {
+	Threshold         int
+	Duration          int // seconds
+	RequestsPerMinute int
+}
+
+type Ban struct {
+	Host   string `proto:"1"`
+	Until  int64  `proto:"2"` // unix time
+	Reason string `proto:"3"`
+}
+
+type banScore struct {
+	points  int
+	updated int64
+	// requests in current minute
+	minute   int64
+	requests int
+}
+
+type BanList struct {
+	config BanConfig
+	lock   sync.Mutex
+	scores map[string]*banScore
+	bans   map[string]Ban
+	// bans are saved to the file if it is set
+	file string
+}
+
+// Creates a list with bans loaded from the file. The file can be empty, then bans are only in memory
+func NewBanList(config BanConfig, file string) (*BanList, error) {
+	if config.Threshold == 0 {
+		config.Threshold = defaultBanThreshold
+	}
+
+	if config.Duration <= 0 {
+		config.Duration = defaultBanDuration
+	}
+
+	if config.RequestsPerMinute == 0 {
+		config.RequestsPerMinute = defaultBanRequestsPerMinute
+	}
+
+	l := &BanList{config: config, scores: map[string]*banScore{}, bans: map[string]Ban{}, file: file}
+
+	if file == "" {
+		return l, nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	bans := []Ban{}
+
+	err = json.Unmarshal(data, &bans)
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+
+	for _, ban := range bans {
+		if ban.Until > now {
+			l.bans[ban.Host] = ban
+		}
+	}
+	return l, nil
+}
+
+// Returns IP of a peer. Empty if a connection is not by IP, like a local socket
+func PeerHost(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+
+	if err != nil || net.ParseIP(host) == nil {
+		return ""
+	}
+	return host
+}
+
+// Check if banning is on
+func (l *BanList) Enabled() bool {
+	return l != nil && l.config.Threshold > 0
+}
+
+func (l *BanList) IsBanned(host string) bool {
+	if !l.Enabled() || host == "" {
+		return false
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	ban, ok := l.bans[host]
+
+	if !ok {
+		return false
+	}
+
+	if ban.Until <= time.Now().Unix() {
+		delete(l.bans, host)
+		return false
+	}
+	return true
+}
+
+// Adds points to a peer. Returns true if the peer is banned now
+func (l *BanList) Misbehaving(host string, points int, reason string) bool {
+	if !l.Enabled() || host == "" || points <= 0 {
+		return false
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if _, ok := l.bans[host]; ok {
+		return false
+	}
+
+	now := time.Now().Unix()
+
+	score := l.getScore(host, now)
+	score.points += points
+
+	if score.points < l.config.Threshold {
+		return false
+	}
+
+	delete(l.scores, host)
+
+	l.bans[host] = Ban{Host: host, Until: now + int64(l.config.Duration), Reason: reason}
+	l.save()
+
+	return true
+}
+
+// Counts a request of a peer. Returns true if the peer sent more requests in this minute than allowed
+func (l *BanList) CountRequest(host string) bool {
+	if !l.Enabled() || host == "" || l.config.RequestsPerMinute < 0 {
+		return false
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now().Unix()
+
+	score := l.getScore(host, now)
+
+	if score.minute != now/60 {
+		score.minute = now / 60
+		score.requests = 0
+	}
+	score.requests++
+
+	return score.requests > l.config.RequestsPerMinute
+}
+
+// Returns a score with points after forgetting. Must be called with the lock
+func (l *BanList) getScore(host string, now int64) *banScore {
+	score, ok := l.scores[host]
+
+	if !ok {
+		if len(l.scores) > 10000 {
+			l.forget(now)
+		}
+		score = &banScore{updated: now}
+		l.scores[host] = score
+	}
+
+	if minutes := int((now - score.updated) / 60); minutes > 0 {
+		score.points -= minutes
+		score.updated += int64(minutes) * 60
+
+		if score.points < 0 {
+			score.points = 0
+		}
+	}
+	return score
+}
+
+// Removes scores of peers which didn't do anything long time, the map can not grow forever
+func (l *BanList) forget(now int64) {
+	for host, score := range l.scores {
+		if now/60 != score.minute && score.points <= int((now-score.updated)/60) {
+			delete(l.scores, host)
+		}
+	}
+}
+
+// Returns current bans, sorted by host
+func (l *BanList) GetBans() []Ban {
+	bans := []Ban{}
+
+	if l == nil {
+		return bans
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now().Unix()
+
+	for _, ban := range l.bans {
+		if ban.Until > now {
+			bans = append(bans, ban)
+		}
+	}
+
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Host < bans[j].Host
+	})
+	return bans
+}
+
+// Removes a ban of a host and its points. Empty host means all bans. Returns number of removed bans
+func (l *BanList) ClearBans(host string) int {
+	if l == nil {
+		return 0
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	count := 0
+
+	for h := range l.bans {
+		if host == "" || h == host {
+			delete(l.bans, h)
+			count++
+		}
+	}
+
+	if host == "" {
+		l.scores = map[string]*banScore{}
+	} else {
+		delete(l.scores, host)
+	}
+
+	l.save()
+
+	return count
+}
+
+// Must be called with the lock
+func (l *BanList) save() {
+	if l.file == "" {
+		return
+	}
+
+	bans := []Ban{}
+
+	for _, ban := range l.bans {
+		bans = append(bans, ban)
+	}
+
+	data, err := json.Marshal(bans)
+
+	if err == nil {
+		ioutil.WriteFile(l.file, data, 0600)
+	}
+}
@@ -0,0 +1,99 @@
+package net
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBanList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oursqlbans")
+
+	if err != nil {
+		t.Fatalf("Temp dir error: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "bans.json")
+
+	bans, err := NewBanList(BanConfig{}, path)
+
+	if err != nil {
+		t.Fatalf("Create ban list error: %s", err.Error())
+	}
+
+	for i := 0; i < 4; i++ {
+		if bans.Misbehaving("10.0.0.1", BanPointsBadRequest, "bad request") {
+			t.Fatalf("Peer is banned after %d bad requests", i+1)
+		}
+	}
+
+	if bans.IsBanned("10.0.0.1") {
+		t.Fatalf("Peer is banned before threshold")
+	}
+
+	if !bans.Misbehaving("10.0.0.1", BanPointsBadRequest, "bad request") {
+		t.Fatalf("Peer is not banned on threshold")
+	}
+
+	if !bans.IsBanned("10.0.0.1") || bans.IsBanned("10.0.0.2") {
+		t.Fatalf("Wrong ban state")
+	}
+
+	// points are forgotten with time
+	bans.Misbehaving("10.0.0.2", BanPointsInvalidBlock, "invalid block")
+	bans.scores["10.0.0.2"].updated -= 60 * 60
+
+	if bans.Misbehaving("10.0.0.2", BanPointsInvalidBlock, "invalid block") {
+		t.Fatalf("Peer is banned with old points")
+	}
+
+	// bans are loaded after restart
+	loaded, err := NewBanList(BanConfig{}, path)
+
+	if err != nil {
+		t.Fatalf("Load ban list error: %s", err.Error())
+	}
+
+	list := loaded.GetBans()
+
+	if len(list) != 1 || list[0].Host != "10.0.0.1" || list[0].Reason != "bad request" {
+		t.Fatalf("Wrong loaded bans %v", list)
+	}
+
+	if loaded.ClearBans("10.0.0.1") != 1 || loaded.IsBanned("10.0.0.1") {
+		t.Fatalf("Ban is not removed")
+	}
+
+	loaded, _ = NewBanList(BanConfig{}, path)
+
+	if len(loaded.GetBans()) != 0 {
+		t.Fatalf("Removed ban is loaded")
+	}
+}
+
+func TestBanListRequests(t *testing.T) {
+	bans, _ := NewBanList(BanConfig{RequestsPerMinute: 3}, "")
+
+	for i := 0; i < 3; i++ {
+		if bans.CountRequest("10.0.0.1") {
+			t.Fatalf("Request %d is over limit", i+1)
+		}
+	}
+
+	if !bans.CountRequest("10.0.0.1") {
+		t.Fatalf("Request is not over limit")
+	}
+
+	off, _ := NewBanList(BanConfig{Threshold: -1}, "")
+
+	if off.Misbehaving("10.0.0.1", 1000, "test") || off.IsBanned("10.0.0.1") {
+		t.Fatalf("Peer is banned when banning is off")
+	}
+
+	// local connections are not banned
+	if bans.Misbehaving("", 1000, "test") {
+		t.Fatalf("Peer without host is banned")
+	}
+}
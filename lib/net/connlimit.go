@@ -0,0 +1,274 @@
+package net
+
+/*
+* Limits of connections with other nodes. When all inbound slots are taken, a new connection replaces the
+* connection of a peer with lowest score, or the longest idle one, so a flood of connections can not take
+* the listener. A connection of a peer worse than all others is closed at once. Outbound requests wait for
+* a free slot. Limits can be changed while connections are open
+ */
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultMaxInbound  = 125
+	defaultMaxOutbound = 32
+)
+
+// Policies of eviction of inbound connections
+const (
+	EvictionScore = "score"
+	EvictionIdle  = "idle"
+)
+
+// Maximums of connections at same time. 0 means a default, -1 means no limit. Eviction is score (default) or idle
+type ConnLimits struct {
+	Inbound  int
+	Outbound int
+	Eviction string
+}
+
+// Open inbound connections
+type InboundSlots struct {
+	max      int
+	eviction string
+	// score of a peer by host, from 0 to 1
+	score func(host string) float64
+	lock  sync.Mutex
+	conns map[*slotConn]bool
+}
+
+type slotConn struct {
+	net.Conn
+	slots *InboundSlots
+	host  string
+	// unix nano of last read or write
+	active int64
+	once   sync.Once
+}
+
+type OutboundSlots struct {
+	max  int
+	used int
+	lock sync.Mutex
+	// closed when a slot is free or the limit is changed
+	changed chan struct{}
+}
+
+func limitOrDefault(limit int, def int) int {
+	if limit == 0 {
+		return def
+	}
+	return limit
+}
+
+// Score can be nil, then all peers are same
+func NewInboundSlots(limits ConnLimits, score func(host string) float64) *InboundSlots {
+	if score == nil {
+		score = func(host string) float64 { return 0 }
+	}
+
+	s := &InboundSlots{score: score, conns: map[*slotConn]bool{}}
+	s.SetLimits(limits)
+
+	return s
+}
+
+// Changes the limit and the eviction. Connections over a lower limit are not closed, new connections replace them
+func (s *InboundSlots) SetLimits(limits ConnLimits) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.max = limitOrDefault(limits.Inbound, defaultMaxInbound)
+	s.eviction = limits.Eviction
+}
+
+// Current limit and eviction
+func (s *InboundSlots) Limits() ConnLimits {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return ConnLimits{Inbound: s.max, Eviction: s.eviction}
+}
+
+// Takes a slot for a connection. If there are no free slots other connection is closed, or false is returned
+// if this peer is the worst. The slot is free when the returned connection is closed
+func (s *InboundSlots) Accept(conn net.Conn, host string) (net.Conn, bool) {
+	if s == nil {
+		return conn, true
+	}
+
+	c := &slotConn{Conn: conn, slots: s, host: host, active: time.Now().UnixNano()}
+
+	s.lock.Lock()
+
+	var victim *slotConn
+
+	if s.max >= 0 && len(s.conns) >= s.max {
+		victim = s.chooseVictim(host)
+
+		if victim == nil {
+			s.lock.Unlock()
+			return nil, false
+		}
+		delete(s.conns, victim)
+	}
+	s.conns[c] = true
+
+	s.lock.Unlock()
+
+	if victim != nil {
+		victim.Close()
+	}
+	return c, true
+}
+
+// Returns a connection to close for a new connection of a host. Nil if the new one is worse. Must be called with the lock
+func (s *InboundSlots) chooseVictim(host string) *slotConn {
+	scores := map[string]float64{}
+
+	getScore := func(h string) float64 {
+		if s.eviction == EvictionIdle {
+			return 0
+		}
+		if score, ok := scores[h]; ok {
+			return score
+		}
+		scores[h] = s.score(h)
+		return scores[h]
+	}
+
+	var victim *slotConn
+
+	for c := range s.conns {
+		if victim == nil {
+			victim = c
+			continue
+		}
+
+		cs, vs := getScore(c.host), getScore(victim.host)
+
+		if cs < vs || cs == vs && atomic.LoadInt64(&c.active) < atomic.LoadInt64(&victim.active) {
+			victim = c
+		}
+	}
+
+	if victim != nil && getScore(host) < getScore(victim.host) {
+		return nil
+	}
+	return victim
+}
+
+// Number of open connections
+func (s *InboundSlots) Count() int {
+	if s == nil {
+		return 0
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.conns)
+}
+
+func (c *slotConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.StoreInt64(&c.active, time.Now().UnixNano())
+	return n, err
+}
+
+func (c *slotConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	atomic.StoreInt64(&c.active, time.Now().UnixNano())
+	return n, err
+}
+
+func (c *slotConn) Close() error {
+	err := c.Conn.Close()
+
+	c.once.Do(func() {
+		c.slots.lock.Lock()
+		delete(c.slots.conns, c)
+		c.slots.lock.Unlock()
+	})
+	return err
+}
+
+func (c *slotConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+func NewOutboundSlots(limits ConnLimits) *OutboundSlots {
+	s := &OutboundSlots{changed: make(chan struct{})}
+	s.SetLimits(limits)
+
+	return s
+}
+
+// Changes the limit. Waiting requests get slots if the limit is higher
+func (s *OutboundSlots) SetLimits(limits ConnLimits) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.max = limitOrDefault(limits.Outbound, defaultMaxOutbound)
+	s.notify()
+}
+
+// Current limit
+func (s *OutboundSlots) Limits() ConnLimits {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return ConnLimits{Outbound: s.max}
+}
+
+// Wakes up waiting requests. Must be called with the lock
+func (s *OutboundSlots) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Waits for a free slot not longer than timeout. Returned function frees the slot
+func (s *OutboundSlots) Acquire(ctx context.Context, timeout time.Duration) (func(), error) {
+	if s == nil {
+		return func() {}, nil
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		s.lock.Lock()
+
+		if s.max < 0 || s.used < s.max {
+			s.used++
+			s.lock.Unlock()
+
+			return s.release, nil
+		}
+		changed := s.changed
+
+		s.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return nil, NewCanNotConnectError("No free outbound connection slots")
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (s *OutboundSlots) release() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.used--
+	s.notify()
+}
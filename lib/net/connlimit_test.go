@@ -0,0 +1,119 @@
+package net
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func pipeConn() net.Conn {
+	client, server := net.Pipe()
+	go func() {
+		buf := make([]byte, 10)
+		server.Read(buf)
+		server.Close()
+	}()
+	return client
+}
+
+func isClosed(conn net.Conn) bool {
+	_, err := conn.Write([]byte("x"))
+	return err == io.ErrClosedPipe
+}
+
+func TestInboundSlots(t *testing.T) {
+	scores := map[string]float64{"good": 0.9, "bad": 0.1}
+
+	slots := NewInboundSlots(ConnLimits{Inbound: 2}, func(host string) float64 { return scores[host] })
+
+	first := pipeConn()
+	second := pipeConn()
+
+	c1, ok1 := slots.Accept(first, "good")
+	_, ok2 := slots.Accept(second, "bad")
+
+	if !ok1 || !ok2 || slots.Count() != 2 {
+		t.Fatalf("Connections are not accepted")
+	}
+
+	// a peer without score is worse than all
+	if _, ok := slots.Accept(pipeConn(), "unknown"); ok || slots.Count() != 2 {
+		t.Fatalf("Connection of worst peer is accepted")
+	}
+
+	if _, ok := slots.Accept(pipeConn(), "good"); !ok {
+		t.Fatalf("Connection of good peer is not accepted")
+	}
+
+	if !isClosed(second) || isClosed(first) {
+		t.Fatalf("Wrong connection is closed")
+	}
+
+	c1.Close()
+
+	if slots.Count() != 1 {
+		t.Fatalf("Slot is not free after close, %d", slots.Count())
+	}
+
+	unlimited := NewInboundSlots(ConnLimits{Inbound: -1}, nil)
+
+	for i := 0; i < 3; i++ {
+		if _, ok := unlimited.Accept(pipeConn(), "unknown"); !ok {
+			t.Fatalf("Connection is not accepted without limit")
+		}
+	}
+}
+
+func TestInboundSlotsIdle(t *testing.T) {
+	slots := NewInboundSlots(ConnLimits{Inbound: 2, Eviction: EvictionIdle}, func(host string) float64 { return 1 })
+
+	first := pipeConn()
+	second := pipeConn()
+
+	slots.Accept(first, "a")
+	time.Sleep(10 * time.Millisecond)
+	slots.Accept(second, "b")
+
+	if _, ok := slots.Accept(pipeConn(), "c"); !ok {
+		t.Fatalf("Connection is not accepted")
+	}
+
+	if !isClosed(first) || isClosed(second) {
+		t.Fatalf("Longest idle connection is not closed")
+	}
+}
+
+func TestOutboundSlots(t *testing.T) {
+	slots := NewOutboundSlots(ConnLimits{Outbound: 1})
+
+	release, err := slots.Acquire(context.Background(), time.Second)
+
+	if err != nil {
+		t.Fatalf("Slot is not acquired: %s", err.Error())
+	}
+
+	if _, err := slots.Acquire(context.Background(), 50*time.Millisecond); err == nil {
+		t.Fatalf("Slot over the limit is acquired")
+	}
+
+	// a waiting request gets a slot when the limit is changed
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		slots.SetLimits(ConnLimits{Outbound: 2})
+	}()
+
+	second, err := slots.Acquire(context.Background(), time.Second)
+
+	if err != nil {
+		t.Fatalf("Slot is not acquired after the limit is changed: %s", err.Error())
+	}
+	second()
+
+	release()
+
+	if _, err := slots.Acquire(context.Background(), 50*time.Millisecond); err != nil {
+		t.Fatalf("Free slot is not acquired: %s", err.Error())
+	}
+}
@@ -0,0 +1,70 @@
+package net
+
+/*
+* Deadlines of connections of nodes. A deadline is set before every read and write, so a connection with
+* a stalled peer fails after a timeout, and a slow peer which still sends or reads data is not cut
+ */
+
+import (
+	"net"
+	"time"
+)
+
+// Defaults in milliseconds
+const (
+	DefaultConnReadTimeout  = 60000
+	DefaultConnWriteTimeout = 120000
+)
+
+// Longest pauses of reading and writing in milliseconds. 0 means a default, -1 means no deadline
+type ConnTimeouts struct {
+	Read  int
+	Write int
+}
+
+type deadlineConn struct {
+	net.Conn
+	read  time.Duration
+	write time.Duration
+}
+
+func connTimeout(ms int, def int) time.Duration {
+	if ms == 0 {
+		ms = def
+	}
+	if ms < 0 {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// Wraps a connection to set a deadline before every read and write
+func WithDeadlines(conn net.Conn, timeouts ConnTimeouts) net.Conn {
+	d := &deadlineConn{Conn: conn}
+
+	d.read = connTimeout(timeouts.Read, DefaultConnReadTimeout)
+	d.write = connTimeout(timeouts.Write, DefaultConnWriteTimeout)
+
+	if d.read == 0 && d.write == 0 {
+		return conn
+	}
+	return d
+}
+
+func (c *deadlineConn) Read(p []byte) (int, error) {
+	if c.read > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(c.read))
+	}
+	return c.Conn.Read(p)
+}
+
+func (c *deadlineConn) Write(p []byte) (int, error) {
+	if c.write > 0 {
+		c.Conn.SetWriteDeadline(time.Now().Add(c.write))
+	}
+	return c.Conn.Write(p)
+}
+
+func (c *deadlineConn) NetConn() net.Conn {
+	return c.Conn
+}
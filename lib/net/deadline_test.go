@@ -0,0 +1,49 @@
+package net
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnDeadlines(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	conn := WithDeadlines(server, ConnTimeouts{Read: 50, Write: 50})
+	defer conn.Close()
+
+	start := time.Now()
+
+	_, err := conn.Read(make([]byte, 1))
+
+	if e, ok := err.(net.Error); !ok || !e.Timeout() {
+		t.Fatalf("Read of a stalled connection returned %v", err)
+	}
+
+	if _, err = conn.Write([]byte{1}); err == nil {
+		t.Fatalf("Write to a peer which doesn't read is complete")
+	}
+
+	if time.Since(start) > time.Second {
+		t.Fatalf("Deadlines took %s", time.Since(start))
+	}
+
+	// a peer which sends data is not cut
+	go func() {
+		for i := 0; i < 4; i++ {
+			time.Sleep(30 * time.Millisecond)
+			client.Write([]byte{1})
+		}
+	}()
+
+	for i := 0; i < 4; i++ {
+		if _, err = conn.Read(make([]byte, 1)); err != nil {
+			t.Fatalf("Read error %s", err.Error())
+		}
+	}
+
+	if WithDeadlines(server, ConnTimeouts{Read: -1, Write: -1}) != server {
+		t.Fatalf("Connection without deadlines is wrapped")
+	}
+}
@@ -0,0 +1,220 @@
+package net
+
+/*
+* Codes of errors returned by nodes. An error response has the message (as before, older clients read only it)
+* followed by RemoteError with a code from the catalog. Client code checks a code or a category instead of a message.
+* An error of a node package gets a code if it has ErrorCode() method, other errors are internal
+ */
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+const (
+	ErrorCodeUnknown = 0
+
+	// network, between a client and a node
+	ErrorCodeCanNotConnect       = 1001
+	ErrorCodeCanNotSend          = 1002
+	ErrorCodeNoResponse          = 1003
+	ErrorCodeCanNotParseResponse = 1004
+	ErrorCodeResponseTooLarge    = 1005
+	ErrorCodeChecksumMismatch    = 1006
+
+	// a request is not correct
+	ErrorCodeBadRequest     = 2001
+	ErrorCodeUnknownCommand = 2002
+	ErrorCodeAuthRequired   = 2003
+	ErrorCodeTooManyRequest = 2004
+
+	ErrorCodeNotFound = 3001
+
+	// a transaction or a block is not accepted
+	ErrorCodeTransactionVerify = 4001
+	ErrorCodeNoEnoughFunds     = 4002
+	ErrorCodeSQLBaseDifferent  = 4003
+	ErrorCodeBlockVerify       = 4004
+	ErrorCodePoolFull          = 4005
+
+	// DB of a node
+	ErrorCodeDatabase      = 5001
+	ErrorCodeDBUnavailable = 5002
+	ErrorCodeDBTimeout     = 5003
+
+	ErrorCodeInternal = 9001
+)
+
+// Categories of errors
+const (
+	ErrorCategoryUnknown      = "unknown"
+	ErrorCategoryNetwork      = "network"
+	ErrorCategoryRequest      = "request"
+	ErrorCategoryNotFound     = "notfound"
+	ErrorCategoryVerification = "verification"
+	ErrorCategoryDatabase     = "database"
+	ErrorCategoryInternal     = "internal"
+)
+
+type ErrorDescription struct {
+	Category string
+	Message  string
+	// same request can succeed later
+	Retryable bool
+}
+
+var errorCatalog = map[int]ErrorDescription{
+	ErrorCodeUnknown:             ErrorDescription{ErrorCategoryUnknown, "Unknown error", false},
+	ErrorCodeCanNotConnect:       ErrorDescription{ErrorCategoryNetwork, "Node is not available", true},
+	ErrorCodeCanNotSend:          ErrorDescription{ErrorCategoryNetwork, "Data transfer failed", true},
+	ErrorCodeNoResponse:          ErrorDescription{ErrorCategoryNetwork, "No response", true},
+	ErrorCodeCanNotParseResponse: ErrorDescription{ErrorCategoryNetwork, "Response can not be parsed", false},
+	ErrorCodeResponseTooLarge:    ErrorDescription{ErrorCategoryNetwork, "Response is too large", false},
+	ErrorCodeChecksumMismatch:    ErrorDescription{ErrorCategoryNetwork, "Response is corrupted", true},
+	ErrorCodeBadRequest:          ErrorDescription{ErrorCategoryRequest, "Request can not be parsed", false},
+	ErrorCodeUnknownCommand:      ErrorDescription{ErrorCategoryRequest, "Unknown command", false},
+	ErrorCodeAuthRequired:        ErrorDescription{ErrorCategoryRequest, "Local network auth is required", false},
+	ErrorCodeTooManyRequest:      ErrorDescription{ErrorCategoryRequest, "Too many requests", true},
+	ErrorCodeNotFound:            ErrorDescription{ErrorCategoryNotFound, "Not found", false},
+	ErrorCodeTransactionVerify:   ErrorDescription{ErrorCategoryVerification, "Transaction verify failed", false},
+	ErrorCodeNoEnoughFunds:       ErrorDescription{ErrorCategoryVerification, "No enough funds", false},
+	ErrorCodePoolFull:            ErrorDescription{ErrorCategoryVerification, "Pool of transactions is full", true},
+	// a row was changed by other transaction. The transaction must be prepared again
+	ErrorCodeSQLBaseDifferent: ErrorDescription{ErrorCategoryVerification, "Row was changed by other transaction", true},
+	ErrorCodeBlockVerify:      ErrorDescription{ErrorCategoryVerification, "Block verify failed", false},
+	ErrorCodeDatabase:         ErrorDescription{ErrorCategoryDatabase, "Database error", false},
+	ErrorCodeDBUnavailable:    ErrorDescription{ErrorCategoryDatabase, "Database server is not available", true},
+	ErrorCodeDBTimeout:        ErrorDescription{ErrorCategoryDatabase, "Database timeout", true},
+	ErrorCodeInternal:         ErrorDescription{ErrorCategoryInternal, "Internal error", false},
+}
+
+// Error returned by a node. Message is same as a node has in its error
+type RemoteError struct {
+	Code      int    `proto:"1"`
+	Category  string `proto:"2"`
+	Message   string `proto:"3"`
+	Retryable bool   `proto:"4"`
+}
+
+func (e *RemoteError) Error() string {
+	return e.Message
+}
+
+func (e *RemoteError) ErrorCode() int {
+	return e.Code
+}
+
+// Returns a description of a code. Unknown codes are in unknown category
+func GetErrorDescription(code int) ErrorDescription {
+	if d, ok := errorCatalog[code]; ok {
+		return d
+	}
+	return errorCatalog[ErrorCodeUnknown]
+}
+
+func NewRemoteError(code int, message string) *RemoteError {
+	d := GetErrorDescription(code)
+
+	if message == "" {
+		message = d.Message
+	}
+	return &RemoteError{code, d.Category, message, d.Retryable}
+}
+
+// Errors with a code. Errors of nodes packages implement it
+type codedError interface {
+	ErrorCode() int
+}
+
+// Code of an error. Errors without a code are internal
+func GetErrorCode(err error) int {
+	if err == nil {
+		return ErrorCodeUnknown
+	}
+	if e, ok := err.(codedError); ok {
+		return e.ErrorCode()
+	}
+	return ErrorCodeInternal
+}
+
+// Builds an error to send to a client
+func MakeRemoteError(err error) *RemoteError {
+	if e, ok := err.(*RemoteError); ok {
+		return e
+	}
+	return NewRemoteError(GetErrorCode(err), err.Error())
+}
+
+func IsRetryableError(err error) bool {
+	if e, ok := err.(*RemoteError); ok {
+		return e.Retryable
+	}
+	return GetErrorDescription(GetErrorCode(err)).Retryable
+}
+
+// Builds data of an error response, without the status byte. The message goes first, for older clients
+func EncodeErrorResponse(err error) ([]byte, error) {
+	remote := MakeRemoteError(err)
+
+	var buff bytes.Buffer
+
+	enc := gob.NewEncoder(&buff)
+
+	e := enc.Encode(remote.Message)
+
+	if e != nil {
+		return nil, e
+	}
+
+	e = enc.Encode(remote)
+
+	if e != nil {
+		return nil, e
+	}
+	return buff.Bytes(), nil
+}
+
+// Parses data of an error response. A node of older version sends only a message, the code is unknown then
+func DecodeErrorResponse(data []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(data))
+
+	var message string
+
+	err := dec.Decode(&message)
+
+	if err != nil {
+		return NewCanNotParseResponseError(err.Error())
+	}
+
+	remote := RemoteError{}
+
+	if dec.Decode(&remote) != nil {
+		return NewRemoteError(ErrorCodeUnknown, message)
+	}
+	remote.Message = message
+
+	return &remote
+}
+
+// Same as EncodeErrorResponse for a request in a format. Protobuf error is RemoteError message
+func EncodeErrorResponseAs(format string, err error) ([]byte, error) {
+	if format != WireFormatProtobuf {
+		return EncodeErrorResponse(err)
+	}
+	return ProtobufEncode(MakeRemoteError(err))
+}
+
+// Same as DecodeErrorResponse for a response in a format
+func DecodeErrorResponseAs(format string, data []byte) error {
+	if format != WireFormatProtobuf {
+		return DecodeErrorResponse(data)
+	}
+	remote := RemoteError{}
+
+	err := ProtobufDecode(data, &remote)
+
+	if err != nil {
+		return NewCanNotParseResponseError(err.Error())
+	}
+	return &remote
+}
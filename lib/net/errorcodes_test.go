@@ -0,0 +1,56 @@
+package net
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"testing"
+)
+
+func TestErrorResponse(t *testing.T) {
+	data, err := EncodeErrorResponse(NewRemoteError(ErrorCodeNotFound, "Table is not found"))
+
+	if err != nil {
+		t.Fatalf("Encode error: %s", err.Error())
+	}
+
+	// older client reads only a message
+	var message string
+
+	gob.NewDecoder(bytes.NewReader(data)).Decode(&message)
+
+	if message != "Table is not found" {
+		t.Fatalf("Got message %s", message)
+	}
+
+	remote, ok := DecodeErrorResponse(data).(*RemoteError)
+
+	if !ok || remote.Code != ErrorCodeNotFound || remote.Category != ErrorCategoryNotFound || remote.Message != message {
+		t.Fatalf("Got wrong error %v", remote)
+	}
+
+	// error from an older node has only a message
+	data, _ = GobEncode("Some error")
+
+	remote, ok = DecodeErrorResponse(data).(*RemoteError)
+
+	if !ok || remote.Code != ErrorCodeUnknown || remote.Message != "Some error" {
+		t.Fatalf("Got wrong error %v", remote)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	if GetErrorCode(errors.New("error")) != ErrorCodeInternal {
+		t.Fatalf("Error without a code is not internal")
+	}
+
+	err := NewCanNotConnectError("host is down")
+
+	if GetErrorCode(err) != ErrorCodeCanNotConnect || !IsRetryableError(err) {
+		t.Fatalf("Wrong code of network error")
+	}
+
+	if MakeRemoteError(err).Message != err.Error() {
+		t.Fatalf("Message is changed")
+	}
+}
@@ -9,6 +9,8 @@ const (
 	errorCanNotSend          = "cannotsend"
 	errorNoResponse          = "noresponse"
 	errorCanNotParseResponse = "cannotparseresponse"
+	errorResponseTooLarge    = "responsetoolarge"
+	errorChecksumMismatch    = "checksummismatch"
 )
 
 type NetworkError struct {
@@ -29,6 +31,12 @@ func (e NetworkError) Error() string {
 	if e.kind == errorCanNotParseResponse {
 		return fmt.Sprintf("Can Not Parse Network Response: %s", e.errStr)
 	}
+	if e.kind == errorResponseTooLarge {
+		return fmt.Sprintf("Network Response Is Too Large: %s", e.errStr)
+	}
+	if e.kind == errorChecksumMismatch {
+		return fmt.Sprintf("Network Response Checksum Mismatch: %s", e.errStr)
+	}
 	return fmt.Sprintf("Network Error: %s", e.errStr)
 }
 
@@ -54,3 +62,29 @@ func NewNoResponseError(err string) error {
 func NewCanNotParseResponseError(err string) error {
 	return &NetworkError{err, errorCanNotParseResponse}
 }
+
+func NewResponseTooLargeError(err string) error {
+	return &NetworkError{err, errorResponseTooLarge}
+}
+
+func NewChecksumMismatchError(err string) error {
+	return &NetworkError{err, errorChecksumMismatch}
+}
+
+func (e NetworkError) ErrorCode() int {
+	switch e.kind {
+	case errorCanNotConnect:
+		return ErrorCodeCanNotConnect
+	case errorCanNotSend:
+		return ErrorCodeCanNotSend
+	case errorNoResponse:
+		return ErrorCodeNoResponse
+	case errorCanNotParseResponse:
+		return ErrorCodeCanNotParseResponse
+	case errorResponseTooLarge:
+		return ErrorCodeResponseTooLarge
+	case errorChecksumMismatch:
+		return ErrorCodeChecksumMismatch
+	}
+	return ErrorCodeInternal
+}
@@ -0,0 +1,160 @@
+package net
+
+/*
+* Fault injection for resilience testing. When it is enabled in config, every connection of a node (requests sent
+* and accepted) gets artificial latency, and some connections are dropped, truncated or reset.
+* Decisions are made with a random generator created from a seed, same seed gives same sequence of faults
+* for same sequence of connections
+ */
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gelembjuk/oursql/lib/utils"
+)
+
+type FaultsConfig struct {
+	// milliseconds added before every write and max random addition to it
+	Latency       int
+	LatencyJitter int
+	// part of connections, from 0 to 1. Drop - written data is lost and connection is closed,
+	// Truncate - only a half of first write is sent, Reset - connection is reset on first write
+	DropRate     float64
+	TruncateRate float64
+	ResetRate    float64
+	// 0 means random seed
+	Seed int64
+}
+
+const (
+	faultNone = iota
+	faultDrop
+	faultTruncate
+	faultReset
+)
+
+type faultInjector struct {
+	config FaultsConfig
+	rand   *rand.Rand
+	lock   sync.Mutex
+	logger *utils.LoggerMan
+}
+
+type faultyConn struct {
+	net.Conn
+	injector *faultInjector
+	fault    int
+	latency  time.Duration
+	done     bool
+}
+
+var faultsObj *faultInjector
+
+// Enables faults. Has no effect when nothing is set in the config
+func InitFaults(config FaultsConfig, logger *utils.LoggerMan) {
+	if config.Latency <= 0 && config.LatencyJitter <= 0 &&
+		config.DropRate <= 0 && config.TruncateRate <= 0 && config.ResetRate <= 0 {
+		faultsObj = nil
+		return
+	}
+	faultsObj = newFaultInjector(config, logger)
+
+	if logger != nil {
+		logger.Trace.Printf("Network faults are enabled: %+v", config)
+	}
+}
+
+func newFaultInjector(config FaultsConfig, logger *utils.LoggerMan) *faultInjector {
+	seed := config.Seed
+
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &faultInjector{config: config, rand: rand.New(rand.NewSource(seed)), logger: logger}
+}
+
+// Wraps a connection to inject faults. Returns same connection if faults are not enabled
+func WrapConn(conn net.Conn) net.Conn {
+	if faultsObj == nil {
+		return conn
+	}
+	return faultsObj.wrap(conn)
+}
+
+func (f *faultInjector) wrap(conn net.Conn) net.Conn {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	c := &faultyConn{Conn: conn, injector: f}
+
+	c.latency = time.Duration(f.config.Latency) * time.Millisecond
+
+	if f.config.LatencyJitter > 0 {
+		c.latency += time.Duration(f.rand.Intn(f.config.LatencyJitter+1)) * time.Millisecond
+	}
+
+	r := f.rand.Float64()
+
+	switch {
+	case r < f.config.DropRate:
+		c.fault = faultDrop
+	case r < f.config.DropRate+f.config.TruncateRate:
+		c.fault = faultTruncate
+	case r < f.config.DropRate+f.config.TruncateRate+f.config.ResetRate:
+		c.fault = faultReset
+	}
+	return c
+}
+
+func (f *faultInjector) log(format string, v ...interface{}) {
+	if f.logger != nil {
+		f.logger.Trace.Printf(format, v...)
+	}
+}
+
+func (c *faultyConn) Write(b []byte) (int, error) {
+	if c.latency > 0 {
+		time.Sleep(c.latency)
+	}
+
+	if c.done {
+		return 0, errors.New("Connection is closed by fault injection")
+	}
+
+	switch c.fault {
+	case faultDrop:
+		// other side doesn't get anything, writer thinks all is sent
+		c.injector.log("Fault: drop %d bytes to %s", len(b), c.RemoteAddr())
+		c.done = true
+		c.Conn.Close()
+		return len(b), nil
+
+	case faultTruncate:
+		c.injector.log("Fault: truncate %d bytes to %s", len(b), c.RemoteAddr())
+		c.done = true
+		c.Conn.Write(b[:len(b)/2])
+		c.Conn.Close()
+		return len(b), nil
+
+	case faultReset:
+		c.injector.log("Fault: reset connection to %s", c.RemoteAddr())
+		c.done = true
+
+		if tc, ok := c.Conn.(*net.TCPConn); ok {
+			// closing with 0 linger sends RST instead of FIN
+			tc.SetLinger(0)
+		}
+		c.Conn.Close()
+		return 0, &net.OpError{Op: "write", Net: "tcp", Err: syscall.ECONNRESET}
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *faultyConn) NetConn() net.Conn {
+	return c.Conn
+}
@@ -0,0 +1,53 @@
+package net
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+func TestFaultsTruncate(t *testing.T) {
+	f := newFaultInjector(FaultsConfig{TruncateRate: 1}, nil)
+
+	client, server := net.Pipe()
+
+	conn := f.wrap(server)
+
+	go func() {
+		n, err := conn.Write(make([]byte, 100))
+
+		if n != 100 || err != nil {
+			t.Errorf("Truncated write returned %d, %v", n, err)
+		}
+	}()
+
+	data, _ := ioutil.ReadAll(client)
+
+	if len(data) != 50 {
+		t.Fatalf("Received %d bytes, expected 50", len(data))
+	}
+}
+
+func TestFaultsSeed(t *testing.T) {
+	config := FaultsConfig{LatencyJitter: 100, DropRate: 0.2, TruncateRate: 0.2, ResetRate: 0.2, Seed: 42}
+
+	list := func() []faultyConn {
+		f := newFaultInjector(config, nil)
+		conns := []faultyConn{}
+
+		for i := 0; i < 20; i++ {
+			c, _ := net.Pipe()
+			conns = append(conns, *f.wrap(c).(*faultyConn))
+		}
+		return conns
+	}
+
+	l1 := list()
+	l2 := list()
+
+	for i := range l1 {
+		if l1[i].fault != l2[i].fault || l1[i].latency != l2[i].latency {
+			t.Fatalf("Different faults for same seed on connection %d", i)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package net
+
+/*
+* Responses of nodes. A response is a status byte followed by a payload. In old format a client reads the payload
+* till the connection is closed. In framed format the status is followed by 4 bytes of the payload length, a client
+* decodes the payload directly from the connection and knows when it is complete.
+* A client asks for framed response with a flag in extra data of a request, older nodes ignore it
+* and respond in old format. A client limits a size of a response, so a node can not fill its memory.
+* With RequestFlagChecksum a framed response has CRC32 of the payload after the length. The checksum is calculated
+* while a client decodes the payload, a corrupted or truncated payload fails at its end. A decoder can stop
+* before the end, so a client calls FinishPayload after decoding
+ */
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+)
+
+// Longest response a client reads by default
+const DefaultMaxResponseSize = 64 << 20
+
+// Longest request a node reads by default
+const DefaultMaxRequestSize = 64 << 20
+
+const (
+	ResponseError         byte = 0
+	ResponseSuccess       byte = 1
+	ResponseErrorFramed   byte = 2
+	ResponseSuccessFramed byte = 3
+	// framed with a checksum
+	ResponseErrorChecked   byte = 5
+	ResponseSuccessChecked byte = 6
+)
+
+// CRC32 with Castagnoli polynomial, it is calculated by CPU instructions on most platforms
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Flags of a request, sent after an auth string and a trace context in extra data
+const (
+	RequestFlagFramedResponse byte = 1
+	// payload is protobuf, a response is in protobuf too
+	RequestFlagProtobuf byte = 2
+	// a response is streamed in chunks, see stream.go
+	RequestFlagStreamResponse byte = 4
+	// a signature made with the auth string goes after flags, see requestauth.go
+	RequestFlagSigned byte = 8
+	// a response has a checksum of the payload
+	RequestFlagChecksum byte = 16
+)
+
+// Writes a response in the format a client asked for with flags of its request
+func WriteResponseForFlags(w io.Writer, flags byte, success bool, payload []byte) error {
+	if flags&RequestFlagChecksum > 0 {
+		return WriteCheckedResponse(w, success, payload)
+	}
+	return WriteResponse(w, flags&RequestFlagFramedResponse > 0, success, payload)
+}
+
+// Writes a framed response with a checksum. It goes after the length, before the payload
+func WriteCheckedResponse(w io.Writer, success bool, payload []byte) error {
+	header := make([]byte, 9)
+	header[0] = ResponseErrorChecked
+
+	if success {
+		header[0] = ResponseSuccessChecked
+	}
+
+	binary.LittleEndian.PutUint32(header[1:], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(header[5:], crc32.Checksum(payload, checksumTable))
+
+	_, err := w.Write(header)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(payload)
+
+	return err
+}
+
+// Writes a response. Payload is written as is, it is not copied to a buffer with the header
+func WriteResponse(w io.Writer, framed bool, success bool, payload []byte) error {
+	header := []byte{ResponseError}
+
+	if success {
+		header[0] = ResponseSuccess
+	}
+
+	if framed {
+		header[0] += ResponseErrorFramed
+
+		bs := make([]byte, 4)
+		binary.LittleEndian.PutUint32(bs, uint32(len(payload)))
+
+		header = append(header, bs...)
+	}
+
+	_, err := w.Write(header)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(payload)
+
+	return err
+}
+
+// Reads a status of a response. Returned reader gives the payload, for framed response it stops on the end of a frame.
+// io.EOF means a node closed connection without a response
+func ReadResponse(r io.Reader) (success bool, payload io.Reader, err error) {
+	return ReadResponseMax(r, 0)
+}
+
+// Same as ReadResponse, a payload longer than max bytes is an error of ErrorCodeResponseTooLarge code.
+// For framed response the error is returned at once. 0 max means no limit
+func ReadResponseMax(r io.Reader, max int64) (success bool, payload io.Reader, err error) {
+	status := make([]byte, 1)
+
+	_, err = io.ReadFull(r, status)
+
+	if err != nil {
+		return
+	}
+
+	switch status[0] {
+	case ResponseError, ResponseSuccess:
+		if max > 0 {
+			return status[0] == ResponseSuccess, &maxReader{r, max}, nil
+		}
+		return status[0] == ResponseSuccess, r, nil
+
+	case ResponseErrorFramed, ResponseSuccessFramed:
+		bs := make([]byte, 4)
+
+		_, err = io.ReadFull(r, bs)
+
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return
+		}
+
+		length := int64(binary.LittleEndian.Uint32(bs))
+
+		if max > 0 && length > max {
+			err = NewResponseTooLargeError(fmt.Sprintf("Response of %d bytes, limit is %d", length, max))
+			return
+		}
+
+		return status[0] == ResponseSuccessFramed, io.LimitReader(r, length), nil
+
+	case ResponseErrorChecked, ResponseSuccessChecked:
+		bs := make([]byte, 8)
+
+		_, err = io.ReadFull(r, bs)
+
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return
+		}
+
+		length := int64(binary.LittleEndian.Uint32(bs))
+
+		if max > 0 && length > max {
+			err = NewResponseTooLargeError(fmt.Sprintf("Response of %d bytes, limit is %d", length, max))
+			return
+		}
+
+		return status[0] == ResponseSuccessChecked, newCheckedReader(r, length, binary.LittleEndian.Uint32(bs[4:])), nil
+
+	case ResponseStream, ResponseStreamChecked:
+		// payload is read by chunks, max is a limit of a chunk
+		return true, &StreamReader{r: r, max: max, checksum: status[0] == ResponseStreamChecked}, nil
+	}
+	// unknown status is an error without a message
+	return false, r, nil
+}
+
+// Reader of a response in old format, it fails when a node sends more than max bytes
+type maxReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (m *maxReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > m.remaining+1 {
+		p = p[:m.remaining+1]
+	}
+
+	n, err := m.r.Read(p)
+
+	if int64(n) > m.remaining {
+		return 0, NewResponseTooLargeError("Response is longer than the limit")
+	}
+	m.remaining -= int64(n)
+
+	return n, err
+}
+
+// Reads a payload of a known length and calculates its checksum. The last bytes come with io.EOF or
+// with an error if the checksum is wrong. A truncated payload is a checksum error too
+type checkedReader struct {
+	r         io.Reader
+	length    int64
+	remaining int64
+	checksum  uint32
+	hash      hash.Hash32
+	err       error
+}
+
+func newCheckedReader(r io.Reader, length int64, checksum uint32) *checkedReader {
+	return &checkedReader{io.LimitReader(r, length), length, length, checksum, crc32.New(checksumTable), nil}
+}
+
+func (c *checkedReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	n, err := c.r.Read(p)
+
+	c.hash.Write(p[:n])
+	c.remaining -= int64(n)
+
+	if c.remaining == 0 {
+		err = io.EOF
+
+		if sum := c.hash.Sum32(); sum != c.checksum {
+			err = NewChecksumMismatchError(fmt.Sprintf("Checksum of payload is %08x, expected %08x", sum, c.checksum))
+		}
+	} else if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = NewChecksumMismatchError(fmt.Sprintf("Payload is truncated, expected %d bytes", c.length))
+	}
+
+	if err != nil {
+		c.err = err
+	}
+	return n, err
+}
+
+// Reads the rest of a payload with a checksum and returns an error if the checksum is wrong.
+// A decoder can stop before the end of a payload. Other payloads are not read
+func FinishPayload(payload io.Reader) error {
+	c, ok := payload.(*checkedReader)
+
+	if !ok {
+		return nil
+	}
+
+	_, err := io.Copy(ioutil.Discard, c)
+
+	return err
+}
+
+// Reads length bytes and compares their checksum
+func readChecked(r io.Reader, length int64, checksum uint32) ([]byte, error) {
+	data := bytes.NewBuffer(make([]byte, 0, length))
+
+	_, err := data.ReadFrom(newCheckedReader(r, length, checksum))
+
+	if err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
@@ -0,0 +1,186 @@
+package net
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestResponseFrames(t *testing.T) {
+	payload, _ := GobEncode("block data")
+
+	for _, framed := range []bool{true, false} {
+		buff := new(bytes.Buffer)
+
+		err := WriteResponse(buff, framed, true, payload)
+
+		if err != nil {
+			t.Fatalf("Write error: %s", err.Error())
+		}
+
+		// garbage after a frame must not be read
+		if framed {
+			buff.Write([]byte{5, 5, 5})
+		}
+
+		success, r, err := ReadResponse(buff)
+
+		if err != nil || !success {
+			t.Fatalf("Read error %v, success %v, framed %v", err, success, framed)
+		}
+
+		var data string
+
+		err = gob.NewDecoder(r).Decode(&data)
+
+		if err != nil || data != "block data" {
+			t.Fatalf("Decoded %s, error %v, framed %v", data, err, framed)
+		}
+
+		if framed && buff.Len() != 3 {
+			t.Fatalf("Frame end is not respected, %d bytes left", buff.Len())
+		}
+	}
+
+	// error without payload
+	buff := new(bytes.Buffer)
+	WriteResponse(buff, true, false, []byte{})
+
+	success, r, err := ReadResponse(buff)
+
+	if err != nil || success {
+		t.Fatalf("Error response is not read, error %v", err)
+	}
+
+	if n, _ := r.Read(make([]byte, 10)); n != 0 {
+		t.Fatalf("Got %d bytes of empty payload", n)
+	}
+}
+
+func TestResponseMaxSize(t *testing.T) {
+	payload := bytes.Repeat([]byte{1}, 100)
+
+	for _, framed := range []bool{false, true} {
+		buff := new(bytes.Buffer)
+		WriteResponse(buff, framed, true, payload)
+
+		success, r, err := ReadResponseMax(buff, 100)
+
+		if err == nil {
+			_, err = ioutil.ReadAll(r)
+		}
+
+		if err != nil || !success {
+			t.Fatalf("Response of the limit is not read, error %v, framed %v", err, framed)
+		}
+
+		buff = new(bytes.Buffer)
+		WriteResponse(buff, framed, true, payload)
+
+		_, r, err = ReadResponseMax(buff, 99)
+
+		if err == nil {
+			_, err = ioutil.ReadAll(r)
+		}
+
+		if GetErrorCode(err) != ErrorCodeResponseTooLarge {
+			t.Fatalf("Got error %v, framed %v", err, framed)
+		}
+	}
+
+	// chunk of a stream
+	buff := new(bytes.Buffer)
+	NewStreamWriter(buff).WriteChunk(payload)
+
+	_, r, _ := ReadResponseMax(buff, 50)
+
+	if _, err := ioutil.ReadAll(r); GetErrorCode(err) != ErrorCodeResponseTooLarge {
+		t.Fatalf("Got stream error %v", err)
+	}
+}
+
+func TestResponseChecksum(t *testing.T) {
+	payload := bytes.Repeat([]byte{1, 2, 3}, 100)
+
+	buff := new(bytes.Buffer)
+	WriteResponseForFlags(buff, RequestFlagFramedResponse|RequestFlagChecksum, true, payload)
+
+	success, r, err := ReadResponse(buff)
+
+	if err == nil {
+		var data []byte
+		data, err = ioutil.ReadAll(r)
+
+		if !bytes.Equal(data, payload) {
+			t.Fatalf("Got other payload")
+		}
+	}
+
+	if err != nil || !success {
+		t.Fatalf("Checked response is not read, error %v", err)
+	}
+
+	// corrupted, the error is at the end of the payload
+	buff = new(bytes.Buffer)
+	WriteCheckedResponse(buff, true, payload)
+	buff.Bytes()[20] ^= 0xff
+
+	_, r, err = ReadResponse(buff)
+
+	if err != nil {
+		t.Fatalf("Status of corrupted response is not read, error %v", err)
+	}
+
+	if _, err = ioutil.ReadAll(r); GetErrorCode(err) != ErrorCodeChecksumMismatch {
+		t.Fatalf("Got error %v for corrupted response", err)
+	}
+
+	// truncated
+	buff = new(bytes.Buffer)
+	WriteCheckedResponse(buff, true, payload)
+	buff.Truncate(100)
+
+	_, r, _ = ReadResponse(buff)
+
+	if _, err = ioutil.ReadAll(r); GetErrorCode(err) != ErrorCodeChecksumMismatch {
+		t.Fatalf("Got error %v for truncated response", err)
+	}
+
+	// a decoder stopped before the end
+	buff = new(bytes.Buffer)
+	WriteCheckedResponse(buff, true, payload)
+	buff.Bytes()[len(payload)] ^= 0xff
+
+	_, r, _ = ReadResponse(buff)
+
+	if _, err = io.ReadFull(r, make([]byte, 10)); err != nil {
+		t.Fatalf("Start of corrupted response is not read, error %v", err)
+	}
+
+	if err = FinishPayload(r); GetErrorCode(err) != ErrorCodeChecksumMismatch {
+		t.Fatalf("Got error %v finishing corrupted response", err)
+	}
+
+	buff = new(bytes.Buffer)
+	WriteCheckedResponse(buff, true, payload)
+
+	_, r, _ = ReadResponse(buff)
+	io.ReadFull(r, make([]byte, 10))
+
+	if err = FinishPayload(r); err != nil {
+		t.Fatalf("Got error %v finishing response", err)
+	}
+
+	// chunk of a stream
+	buff = new(bytes.Buffer)
+	NewCheckedStreamWriter(buff).WriteChunk(payload)
+	buff.Bytes()[20] ^= 0xff
+
+	_, r, _ = ReadResponse(buff)
+
+	if _, err := ioutil.ReadAll(r); GetErrorCode(err) != ErrorCodeChecksumMismatch {
+		t.Fatalf("Got stream error %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package net
+
+/*
+* Identity of a node. It is a long lived Ed25519 key, kept in the config folder, it is not a wallet and has no coins.
+* A node signs an announcement of own address with it, this is sent in every command as AddrFrom and relayed
+* in addresses lists, so other nodes can check an address belongs to the node which announced it.
+* First identity seen for an address is remembered and messages for this address with other identity are rejected
+ */
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gelembjuk/oursql/lib"
+	"github.com/gelembjuk/oursql/lib/utils"
+)
+
+type NodeIdentity struct {
+	privKey ed25519.PrivateKey
+}
+
+// Loads identity key from a file. New key is generated and saved when the file doesn't exist
+func LoadNodeIdentity(filepath string) (*NodeIdentity, error) {
+	data, err := ioutil.ReadFile(filepath)
+
+	if os.IsNotExist(err) {
+		_, privKey, err := ed25519.GenerateKey(rand.Reader)
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = ioutil.WriteFile(filepath, []byte(hex.EncodeToString(privKey.Seed())), 0600)
+
+		if err != nil {
+			return nil, err
+		}
+		return &NodeIdentity{privKey}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, errors.New(fmt.Sprintf("Identity key in %s has wrong format", filepath))
+	}
+	return &NodeIdentity{ed25519.NewKeyFromSeed(seed)}, nil
+}
+
+// Public key in same format as keys of transactions, with the scheme byte in front
+func (i *NodeIdentity) PublicKey() []byte {
+	return utils.MakeEd25519PubKey(i.privKey.Public().(ed25519.PublicKey))
+}
+
+func (i *NodeIdentity) ID() string {
+	return IdentityID(i.PublicKey())
+}
+
+func (i *NodeIdentity) Sign(data []byte) []byte {
+	return utils.SignDataEd25519(i.privKey, data)
+}
+
+// Short readable ID of an identity key. Empty for empty key
+func IdentityID(pubKey []byte) string {
+	if len(pubKey) == 0 {
+		return ""
+	}
+	hash := sha256.Sum256(pubKey)
+
+	return hex.EncodeToString(hash[:16])
+}
+
+// Checks a signature made by an identity key. Only Ed25519 keys are identities
+func VerifyIdentitySignature(pubKey []byte, data []byte, signature []byte) error {
+	if len(pubKey) == 0 || utils.GetPubKeyScheme(pubKey) != lib.SignatureSchemeEd25519 {
+		return errors.New("Wrong identity key")
+	}
+
+	valid, err := utils.VerifySignature(signature, data, pubKey)
+
+	if err != nil {
+		return err
+	}
+
+	if !valid {
+		return errors.New("Wrong identity signature")
+	}
+	return nil
+}
+
+func (n NodeAddr) announcementData() []byte {
+	return []byte(n.Host + ":" + strconv.Itoa(n.Port) + "/" + strconv.FormatInt(n.Announced, 10))
+}
+
+// Signs the address by the identity of the node which listens on it
+func (n *NodeAddr) SignAnnouncement(identity *NodeIdentity) {
+	n.Identity = identity.PublicKey()
+	n.Announced = time.Now().Unix()
+	n.Signature = identity.Sign(n.announcementData())
+}
+
+// Check if the address is announced with an identity. Addresses from older nodes are not signed.
+// Addresses loaded from the DB have only the identity
+func (n NodeAddr) IsSigned() bool {
+	return len(n.Identity) > 0 && len(n.Signature) > 0
+}
+
+// Checks the announcement is signed by the identity in it. A replayed announcement is fine,
+// it only tells again the address belongs to the identity
+func (n NodeAddr) VerifyAnnouncement() error {
+	if !n.IsSigned() {
+		return errors.New(fmt.Sprintf("Address %s is not signed", n.String()))
+	}
+	return VerifyIdentitySignature(n.Identity, n.announcementData(), n.Signature)
+}
+
+// Returns address without the announcement. It is used when the announcement is wrong
+func (n NodeAddr) WithoutAnnouncement() NodeAddr {
+	n.Identity = nil
+	n.Announced = 0
+	n.Signature = nil
+	return n
+}
+
+// Data of a message to sign. Every part has a length in front, so parts can not be moved from one to other
+func messageData(parts [][]byte) []byte {
+	var buff bytes.Buffer
+
+	for _, part := range parts {
+		binary.Write(&buff, binary.BigEndian, uint32(len(part)))
+		buff.Write(part)
+	}
+	return buff.Bytes()
+}
+
+// Signs a message by the identity of this node
+func (i *NodeIdentity) SignMessage(parts ...[]byte) []byte {
+	return i.Sign(messageData(parts))
+}
+
+// Checks a message is signed by the identity of the address it is sent from.
+// Messages from addresses without an identity are not checked, they are from older nodes
+func (n NodeAddr) VerifyMessage(signature []byte, parts ...[]byte) error {
+	if !n.IsSigned() {
+		return nil
+	}
+
+	if len(signature) == 0 {
+		return errors.New(fmt.Sprintf("Message from %s is not signed", n.String()))
+	}
+	return VerifyIdentityMessage(n.Identity, signature, parts...)
+}
+
+// Checks a message is signed by an identity key
+func VerifyIdentityMessage(pubKey []byte, signature []byte, parts ...[]byte) error {
+	return VerifyIdentitySignature(pubKey, messageData(parts), signature)
+}
@@ -0,0 +1,155 @@
+package net
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNodeIdentity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oursqlidentity")
+
+	if err != nil {
+		t.Fatalf("Temp dir error: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "nodeidentity.key")
+
+	identity, err := LoadNodeIdentity(path)
+
+	if err != nil {
+		t.Fatalf("Create identity error: %s", err.Error())
+	}
+
+	loaded, err := LoadNodeIdentity(path)
+
+	if err != nil || loaded.ID() != identity.ID() {
+		t.Fatalf("Identity is not same after load %v", err)
+	}
+
+	addr := NewNodeAddr("10.0.0.1", 8765)
+	addr.SignAnnouncement(identity)
+
+	if err := addr.VerifyAnnouncement(); err != nil {
+		t.Fatalf("Announcement is not valid: %s", err.Error())
+	}
+
+	spoofed := addr
+	spoofed.Host = "10.0.0.2"
+
+	if spoofed.VerifyAnnouncement() == nil {
+		t.Fatalf("Announcement is valid for other host")
+	}
+
+	signature := identity.SignMessage([]byte("inv"), []byte("block"))
+
+	if err := addr.VerifyMessage(signature, []byte("inv"), []byte("block")); err != nil {
+		t.Fatalf("Message is not valid: %s", err.Error())
+	}
+
+	if addr.VerifyMessage(signature, []byte("invb"), []byte("lock")) == nil {
+		t.Fatalf("Message with moved parts is valid")
+	}
+
+	if addr.VerifyMessage(nil, []byte("inv")) == nil {
+		t.Fatalf("Message without signature is valid")
+	}
+}
+
+func TestCheckIdentity(t *testing.T) {
+	first, _ := LoadNodeIdentity(filepath.Join(os.TempDir(), "oursqlidentity1.key"))
+	defer os.Remove(filepath.Join(os.TempDir(), "oursqlidentity1.key"))
+
+	second, _ := LoadNodeIdentity(filepath.Join(os.TempDir(), "oursqlidentity2.key"))
+	defer os.Remove(filepath.Join(os.TempDir(), "oursqlidentity2.key"))
+
+	n := NodeNetwork{}
+	n.Init()
+	n.AddNodeToKnown(NewNodeAddr("10.0.0.1", 8765))
+
+	addr := NewNodeAddr("10.0.0.1", 8765)
+	addr.SignAnnouncement(first)
+
+	if err := n.CheckIdentity(addr); err != nil {
+		t.Fatalf("Identity of old node is not accepted: %s", err.Error())
+	}
+
+	spoofed := NewNodeAddr("10.0.0.1", 8765)
+	spoofed.SignAnnouncement(second)
+
+	if n.CheckIdentity(spoofed) == nil {
+		t.Fatalf("Other identity is accepted for known address")
+	}
+
+	if n.CheckIdentity(NewNodeAddr("10.0.0.1", 8765)) == nil {
+		t.Fatalf("Address without identity is accepted")
+	}
+
+	// relayed address with other identity doesn't replace known
+	n.AddNodeToKnown(spoofed)
+
+	if IdentityID(n.GetNodes()[0].Identity) != first.ID() {
+		t.Fatalf("Identity is replaced")
+	}
+
+	if n.CheckIdentity(addr) != nil {
+		t.Fatalf("Identity is not accepted")
+	}
+}
+
+func TestMovedIdentity(t *testing.T) {
+	own, _ := LoadNodeIdentity(filepath.Join(os.TempDir(), "oursqlidentity3.key"))
+	defer os.Remove(filepath.Join(os.TempDir(), "oursqlidentity3.key"))
+
+	other, _ := LoadNodeIdentity(filepath.Join(os.TempDir(), "oursqlidentity4.key"))
+	defer os.Remove(filepath.Join(os.TempDir(), "oursqlidentity4.key"))
+
+	announce := func(host string, identity *NodeIdentity, announced int64) NodeAddr {
+		addr := NewNodeAddr(host, 8765)
+		addr.Identity = identity.PublicKey()
+		addr.Announced = announced
+		addr.Signature = identity.Sign(addr.announcementData())
+		return addr
+	}
+
+	n := NodeNetwork{Identity: own.PublicKey()}
+	n.Init()
+
+	// other address of this node
+	if n.AddNodeToKnown(announce("10.0.0.9", own, 1000)) || n.CheckIdentity(announce("10.0.0.9", own, 1000)) == nil {
+		t.Fatalf("Address of this node is accepted")
+	}
+
+	n.AddNodeToKnown(announce("10.0.0.1", other, 1000))
+	n.Nodes[0].SuccessConnections = 5
+
+	// the node got new IP, it is same node with same score
+	n.AddNodeToKnown(announce("10.0.0.2", other, 2000))
+
+	nodes := n.GetNodes()
+
+	if len(nodes) != 1 || nodes[0].Host != "10.0.0.2" || nodes[0].SuccessConnections != 5 {
+		t.Fatalf("Node is not moved %v", nodes)
+	}
+
+	// old announcement is relayed later
+	if n.AddNodeToKnown(announce("10.0.0.1", other, 1000)) || len(n.GetNodes()) != 1 {
+		t.Fatalf("Old address is added")
+	}
+
+	// new address was known without identity
+	n.AddNodeToKnown(NewNodeAddr("10.0.0.3", 8765))
+	n.Nodes[1].SuccessConnections = 2
+
+	if err := n.CheckIdentity(announce("10.0.0.3", other, 3000)); err != nil {
+		t.Fatalf("Identity is not accepted: %s", err.Error())
+	}
+
+	nodes = n.GetNodes()
+
+	if len(nodes) != 1 || nodes[0].Host != "10.0.0.3" || nodes[0].SuccessConnections != 7 {
+		t.Fatalf("Nodes are not merged %v", nodes)
+	}
+}
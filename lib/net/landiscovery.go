@@ -0,0 +1,133 @@
+package net
+
+/*
+* Discovery of nodes in a local network. A node sends its port and the name of its network with UDP broadcast
+* regularly, and listens announcements of other nodes. A node of same network is added to known nodes,
+* so nodes of a private cluster find each other without seed nodes. Announcements of other networks are ignored
+ */
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// Defaults of discovery
+const (
+	defaultLANDiscoveryPort     = 8766
+	defaultLANDiscoveryInterval = 30
+	defaultLANBroadcastAddress  = "255.255.255.255"
+)
+
+const lanProtocol = "oursql-lan"
+
+type LANDiscoveryConfig struct {
+	Enabled bool
+	// UDP port of announcements. Default 8766
+	Port int
+	// seconds between announcements. Default 30
+	Interval int
+	// nodes of other networks are ignored. Default is set by a node
+	Network string
+	// where announcements are sent. Default 255.255.255.255
+	BroadcastAddress string
+}
+
+type LANAnnouncement struct {
+	Protocol string
+	Network  string
+	// port of the node, the host is the address of the sender
+	Port int
+	// random ID to skip own announcements
+	Instance string
+}
+
+type LANDiscovery struct {
+	Interval     int
+	conn         *net.UDPConn
+	target       *net.UDPAddr
+	announcement LANAnnouncement
+}
+
+// Starts listening of announcements. nodePort is announced
+func ListenLAN(config LANDiscoveryConfig, nodePort int) (*LANDiscovery, error) {
+	if config.Port <= 0 {
+		config.Port = defaultLANDiscoveryPort
+	}
+
+	if config.Interval <= 0 {
+		config.Interval = defaultLANDiscoveryInterval
+	}
+
+	if config.BroadcastAddress == "" {
+		config.BroadcastAddress = defaultLANBroadcastAddress
+	}
+
+	target, err := net.ResolveUDPAddr("udp4", net.JoinHostPort(config.BroadcastAddress, strconv.Itoa(config.Port)))
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Wrong broadcast address %s: %s", config.BroadcastAddress, err.Error()))
+	}
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: config.Port})
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Can not listen UDP port %d: %s", config.Port, err.Error()))
+	}
+
+	instance := make([]byte, 8)
+	rand.Read(instance)
+
+	d := &LANDiscovery{Interval: config.Interval, conn: conn, target: target}
+	d.announcement = LANAnnouncement{Protocol: lanProtocol, Network: config.Network, Port: nodePort,
+		Instance: hex.EncodeToString(instance)}
+
+	return d, nil
+}
+
+// Sends the announcement of this node
+func (d *LANDiscovery) Announce() error {
+	data, err := json.Marshal(d.announcement)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = d.conn.WriteToUDP(data, d.target)
+
+	return err
+}
+
+// Waits an announcement of other node of same network. Returns an error when the listening is closed
+func (d *LANDiscovery) Receive() (NodeAddr, error) {
+	buf := make([]byte, 1024)
+
+	for {
+		n, from, err := d.conn.ReadFromUDP(buf)
+
+		if err != nil {
+			return NodeAddr{}, err
+		}
+
+		a := LANAnnouncement{}
+
+		if json.Unmarshal(buf[:n], &a) != nil {
+			continue
+		}
+
+		if a.Protocol != lanProtocol || a.Network != d.announcement.Network ||
+			a.Instance == d.announcement.Instance || a.Port <= 0 || a.Port > 65535 {
+			continue
+		}
+		return NodeAddr{Host: from.IP.String(), Port: a.Port}, nil
+	}
+}
+
+// Stops listening. Receive returns an error then
+func (d *LANDiscovery) Close() error {
+	return d.conn.Close()
+}
@@ -0,0 +1,72 @@
+package net
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLANDiscovery(t *testing.T) {
+	free, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+
+	if err != nil {
+		t.Fatalf("UDP listen error: %s", err.Error())
+	}
+	port := free.LocalAddr().(*net.UDPAddr).Port
+	free.Close()
+
+	d, err := ListenLAN(LANDiscoveryConfig{Port: port, Network: "cluster", BroadcastAddress: "127.0.0.1"}, 8765)
+
+	if err != nil {
+		t.Fatalf("Listen error: %s", err.Error())
+	}
+	defer d.Close()
+
+	sender, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+
+	if err != nil {
+		t.Fatalf("UDP dial error: %s", err.Error())
+	}
+	defer sender.Close()
+
+	// own announcement, other network and garbage are skipped
+	if err = d.Announce(); err != nil {
+		t.Fatalf("Announce error: %s", err.Error())
+	}
+
+	for _, a := range []LANAnnouncement{
+		LANAnnouncement{Protocol: lanProtocol, Network: "other", Port: 8000, Instance: "a"},
+		LANAnnouncement{Protocol: lanProtocol, Network: "cluster", Port: 0, Instance: "b"},
+		LANAnnouncement{Protocol: lanProtocol, Network: "cluster", Port: 8001, Instance: "c"}} {
+
+		data, _ := json.Marshal(a)
+		sender.Write(data)
+		sender.Write([]byte("not json"))
+	}
+
+	received := make(chan NodeAddr, 1)
+
+	go func() {
+		addr, err := d.Receive()
+
+		if err == nil {
+			received <- addr
+		}
+	}()
+
+	select {
+	case addr := <-received:
+		if addr.Host != "127.0.0.1" || addr.Port != 8001 {
+			t.Fatalf("Wrong address %s", addr.NodeAddrToString())
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Announcement is not received")
+	}
+
+	d.Close()
+
+	if _, err = d.Receive(); err == nil {
+		t.Fatalf("Receive must fail after close")
+	}
+}
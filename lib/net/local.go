@@ -0,0 +1,94 @@
+package net
+
+/*
+* Local transport for clients on same machine, like wallets, proxies and admin tools. Same command protocol
+* over a unix domain socket, so TCP port is not needed. Access is controlled by permissions of the socket file.
+* Windows 10 and later has unix sockets too, named pipes are not used
+ */
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Address of a local socket is "unix:/path/to/node.sock"
+const LocalSocketPrefix = "unix:"
+
+// Only owner of the node process can connect by default
+const DefaultLocalSocketMode = 0600
+
+func NewLocalAddr(path string) NodeAddr {
+	a := NodeAddr{}
+	a.Host = LocalSocketPrefix + path
+	return a
+}
+
+// Check if it is an address of a local socket
+func (n NodeAddr) IsLocal() bool {
+	return strings.HasPrefix(n.Host, LocalSocketPrefix)
+}
+
+// Path of a local socket file
+func (n NodeAddr) LocalPath() string {
+	return strings.TrimPrefix(n.Host, LocalSocketPrefix)
+}
+
+// Local sockets are only for clients of this machine. Such addresses from other nodes are dropped,
+// a node must never connect to a socket because it was told by the network
+func filterLocalAddrs(nodes []NodeAddr) []NodeAddr {
+	list := []NodeAddr{}
+
+	for _, node := range nodes {
+		if !node.IsLocal() {
+			list = append(list, node)
+		}
+	}
+	return list
+}
+
+// Parses permissions of a socket file in octal format, like 0660. Empty string is default mode
+func ParseLocalSocketMode(mode string) (os.FileMode, error) {
+	if mode == "" {
+		return DefaultLocalSocketMode, nil
+	}
+
+	m, err := strconv.ParseUint(mode, 8, 32)
+
+	if err != nil || m > 0777 {
+		return 0, errors.New(fmt.Sprintf("Wrong socket mode %s, expected octal like 0660", mode))
+	}
+	return os.FileMode(m), nil
+}
+
+// Starts listening on a unix socket. Socket file left by a killed process is removed
+func ListenLocal(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, errors.New(fmt.Sprintf("%s exists and is not a socket", path))
+		}
+
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, errors.New(fmt.Sprintf("Socket %s is used by other process", path))
+		}
+		os.Remove(path)
+	}
+
+	ln, err := net.Listen("unix", path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Chmod(path, mode)
+
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
@@ -0,0 +1,91 @@
+package net
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLocalSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oursqlsock")
+
+	if err != nil {
+		t.Fatalf("Temp dir error: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "node.sock")
+
+	addr := NodeAddr{}
+	addr.LoadFromString("unix:" + path)
+
+	if !addr.IsLocal() || addr.LocalPath() != path || addr.String() != "unix:"+path {
+		t.Fatalf("Wrong local address %v", addr)
+	}
+
+	mode, _ := ParseLocalSocketMode("0660")
+
+	ln, err := ListenLocal(path, mode)
+
+	if err != nil {
+		t.Fatalf("Listen error: %s", err.Error())
+	}
+
+	info, _ := os.Stat(path)
+
+	if info.Mode().Perm() != 0660 {
+		t.Fatalf("Socket has mode %o", info.Mode().Perm())
+	}
+
+	if _, err := ListenLocal(path, mode); err == nil {
+		t.Fatalf("Second listener is started on same socket")
+	}
+
+	// the second listener checked the socket with a connection too
+	go func() {
+		for {
+			conn, err := ln.Accept()
+
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("ok"))
+			conn.Close()
+		}
+	}()
+
+	conn, err := Dial(addr, time.Second)
+
+	if err != nil {
+		t.Fatalf("Dial error: %s", err.Error())
+	}
+
+	data, _ := ioutil.ReadAll(conn)
+	conn.Close()
+
+	if string(data) != "ok" {
+		t.Fatalf("Got %s", data)
+	}
+	ln.Close()
+
+	if _, err := ParseLocalSocketMode("999"); err == nil {
+		t.Fatalf("Wrong mode is accepted")
+	}
+}
+
+func TestLocalAddrsNotKnown(t *testing.T) {
+	n := NodeNetwork{}
+	n.Init()
+
+	if n.AddNodeToKnown(NewLocalAddr("/var/run/docker.sock")) {
+		t.Fatalf("Local address is added to known nodes")
+	}
+
+	n.SetNodes([]NodeAddr{NewNodeAddr("10.0.0.1", 8765), NewLocalAddr("/tmp/node.sock")}, true)
+
+	if len(n.GetNodes()) != 1 {
+		t.Fatalf("Got nodes %v", n.GetNodes())
+	}
+}
@@ -0,0 +1,232 @@
+package net
+
+/*
+* Nodes added by an operator with addnode. They are kept in own file, not with nodes found from other nodes,
+* so they are not lost after restart and are not aged out when they are not seen long time. A node tries to
+* connect them again and again, a pause after every failed attempt is twice longer, to the maximum
+ */
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Seconds of pauses between attempts to connect a node: after first failure, longest, and for a connected node
+const (
+	manualNodeRetryMin      = 5
+	manualNodeRetryMax      = 600
+	manualNodeCheckInterval = 60
+)
+
+type ManualNode struct {
+	Address string
+	Added   int64 // unix time
+}
+
+type manualNodeState struct {
+	ManualNode
+	// attempts failed in a row and unix time of next attempt
+	failures  int
+	next      int64
+	connected bool
+}
+
+type ManualNodes struct {
+	lock  sync.Mutex
+	nodes map[string]*manualNodeState
+	// nodes are saved to the file if it is set
+	file string
+}
+
+// Creates a list with nodes loaded from the file. The file can be empty, then nodes are only in memory
+func NewManualNodes(file string) (*ManualNodes, error) {
+	m := &ManualNodes{nodes: map[string]*manualNodeState{}, file: file}
+
+	if file == "" {
+		return m, nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []ManualNode{}
+
+	err = json.Unmarshal(data, &nodes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, node := range nodes {
+		m.nodes[node.Address] = &manualNodeState{ManualNode: node}
+	}
+	return m, nil
+}
+
+// Adds a node. Returns false if it is in the list already
+func (m *ManualNodes) Add(addr NodeAddr) bool {
+	if m == nil || addr.IsLocal() {
+		return false
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	key := addr.NodeAddrToString()
+
+	if _, ok := m.nodes[key]; ok {
+		return false
+	}
+
+	m.nodes[key] = &manualNodeState{ManualNode: ManualNode{Address: key, Added: time.Now().Unix()}}
+	m.save()
+
+	return true
+}
+
+// Removes a node. Returns false if it was not in the list
+func (m *ManualNodes) Remove(addr NodeAddr) bool {
+	if m == nil {
+		return false
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	key := addr.NodeAddrToString()
+
+	if _, ok := m.nodes[key]; !ok {
+		return false
+	}
+
+	delete(m.nodes, key)
+	m.save()
+
+	return true
+}
+
+func (m *ManualNodes) IsManual(addr NodeAddr) bool {
+	if m == nil {
+		return false
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	_, ok := m.nodes[addr.NodeAddrToString()]
+
+	return ok
+}
+
+// Returns all nodes, sorted by address
+func (m *ManualNodes) GetNodes() []NodeAddr {
+	return m.getNodes(func(node *manualNodeState) bool { return true })
+}
+
+// Returns nodes which must be connected now
+func (m *ManualNodes) GetDue(now int64) []NodeAddr {
+	return m.getNodes(func(node *manualNodeState) bool { return node.next <= now })
+}
+
+func (m *ManualNodes) getNodes(filter func(node *manualNodeState) bool) []NodeAddr {
+	nodes := []NodeAddr{}
+
+	if m == nil {
+		return nodes
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	keys := []string{}
+
+	for key, node := range m.nodes {
+		if filter(node) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		node := NodeAddr{}
+		node.LoadFromString(key)
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// Remembers a result of an attempt to connect a node and sets time of next attempt.
+// Returns true if the node is connected now and was not connected before
+func (m *ManualNodes) ReportAttempt(addr NodeAddr, ok bool, now int64) bool {
+	if m == nil {
+		return false
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	node, exists := m.nodes[addr.NodeAddrToString()]
+
+	if !exists {
+		return false
+	}
+
+	if ok {
+		reconnected := !node.connected
+		node.connected = true
+		node.failures = 0
+		node.next = now + manualNodeCheckInterval
+
+		return reconnected
+	}
+
+	node.connected = false
+	node.failures++
+
+	pause := int64(manualNodeRetryMax)
+
+	if node.failures < 8 {
+		pause = int64(manualNodeRetryMin) << uint(node.failures-1)
+	}
+
+	if pause > manualNodeRetryMax {
+		pause = manualNodeRetryMax
+	}
+	node.next = now + pause
+
+	return false
+}
+
+// Must be called with the lock
+func (m *ManualNodes) save() {
+	if m.file == "" {
+		return
+	}
+
+	nodes := []ManualNode{}
+
+	for _, node := range m.nodes {
+		nodes = append(nodes, node.ManualNode)
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Address < nodes[j].Address
+	})
+
+	data, err := json.Marshal(nodes)
+
+	if err == nil {
+		ioutil.WriteFile(m.file, data, 0600)
+	}
+}
@@ -0,0 +1,93 @@
+package net
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManualNodes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oursqlmanual")
+
+	if err != nil {
+		t.Fatalf("Temp dir error: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "manualnodes.json")
+
+	manual, err := NewManualNodes(path)
+
+	if err != nil {
+		t.Fatalf("Create list error: %s", err.Error())
+	}
+
+	node1 := NodeAddr{Host: "10.0.0.1", Port: 8765}
+	node2 := NodeAddr{Host: "10.0.0.2", Port: 8765}
+
+	if !manual.Add(node1) || !manual.Add(node2) || manual.Add(node1) {
+		t.Fatalf("Wrong result of add")
+	}
+
+	if manual.Add(NodeAddr{Host: LocalSocketPrefix + "/tmp/node.sock"}) {
+		t.Fatalf("Local socket is added")
+	}
+
+	// nodes are loaded after restart
+	manual, err = NewManualNodes(path)
+
+	if err != nil {
+		t.Fatalf("Load list error: %s", err.Error())
+	}
+
+	nodes := manual.GetNodes()
+
+	if len(nodes) != 2 || !nodes[0].CompareToAddress(node1) || !manual.IsManual(node2) {
+		t.Fatalf("Loaded nodes %v", nodes)
+	}
+
+	// pause after every failure is longer
+	now := int64(1000)
+
+	if len(manual.GetDue(now)) != 2 {
+		t.Fatalf("New nodes must be connected at once")
+	}
+
+	manual.ReportAttempt(node1, false, now)
+
+	if len(manual.GetDue(now+manualNodeRetryMin-1)) != 1 || len(manual.GetDue(now+manualNodeRetryMin)) != 2 {
+		t.Fatalf("Wrong pause after first failure")
+	}
+
+	for i := 0; i < 20; i++ {
+		manual.ReportAttempt(node1, false, now)
+	}
+
+	if len(manual.GetDue(now+manualNodeRetryMax-1)) != 1 || len(manual.GetDue(now+manualNodeRetryMax)) != 2 {
+		t.Fatalf("Pause is longer than maximum")
+	}
+
+	if !manual.ReportAttempt(node1, true, now) || manual.ReportAttempt(node1, true, now) {
+		t.Fatalf("Wrong reconnect state")
+	}
+
+	// manual nodes are not aged out
+	n := NodeNetwork{Manual: manual}
+	n.Init()
+	n.SetNodes([]NodeAddr{node1, NodeAddr{Host: "10.0.0.3", Port: 8765}}, true)
+
+	for _, node := range n.GetNodes() {
+		n.ReportMissedPing(node, 1)
+	}
+
+	removed := n.AgeOutNodes(3600, 0)
+
+	if len(removed) != 1 || removed[0].CompareToAddress(node1) {
+		t.Fatalf("Removed %v", removed)
+	}
+
+	if !manual.Remove(node1) || manual.Remove(node1) || manual.IsManual(node1) {
+		t.Fatalf("Wrong result of remove")
+	}
+}
@@ -0,0 +1,152 @@
+package net
+
+/*
+* Connections of nodes. Normally it is TCP. For simulations of many nodes in one process connections can be made
+* in memory, a node listens a port in a map and a client connects to it by a port, a host is not used
+ */
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type memoryListener struct {
+	port   int
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+type memoryAddr string
+
+var memoryListeners map[int]*memoryListener
+var memoryLock sync.Mutex
+
+// Switches all connections of this process to memory. Must be called before nodes are started
+func UseMemoryTransport(on bool) {
+	memoryLock.Lock()
+	defer memoryLock.Unlock()
+
+	if on && memoryListeners == nil {
+		memoryListeners = map[int]*memoryListener{}
+	} else if !on {
+		memoryListeners = nil
+	}
+}
+
+// Starts listening of node connections on a port on all interfaces
+func Listen(port int) (net.Listener, error) {
+	memoryLock.Lock()
+	defer memoryLock.Unlock()
+
+	if memoryListeners == nil {
+		ln, err := net.Listen(Protocol, listenAddress(port))
+
+		if err != nil {
+			return nil, err
+		}
+		return listenTLS(ln)
+	}
+
+	if _, ok := memoryListeners[port]; ok {
+		return nil, errors.New(fmt.Sprintf("Port %d is already used", port))
+	}
+
+	l := &memoryListener{port: port, conns: make(chan net.Conn), closed: make(chan struct{})}
+
+	memoryListeners[port] = l
+
+	return l, nil
+}
+
+// Connects to a node
+func Dial(addr NodeAddr, timeout time.Duration) (net.Conn, error) {
+	return DialContext(context.Background(), addr, timeout)
+}
+
+// Same as Dial, connecting is stopped when the context is done
+func DialContext(ctx context.Context, addr NodeAddr, timeout time.Duration) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+
+	if addr.IsLocal() {
+		return dialer.DialContext(ctx, "unix", addr.LocalPath())
+	}
+
+	if addr.IsWebSocket() {
+		return dialWebSocket(ctx, dialer, addr)
+	}
+
+	memoryLock.Lock()
+
+	if memoryListeners == nil {
+		memoryLock.Unlock()
+
+		conn, err := dialTCP(ctx, dialer, addr)
+
+		if err != nil || clientTLS == nil {
+			return conn, err
+		}
+		return dialTLS(ctx, conn, timeout, addr)
+	}
+
+	l, ok := memoryListeners[addr.Port]
+	memoryLock.Unlock()
+
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Connection refused to %s", addr.NodeAddrToString()))
+	}
+
+	client, server := net.Pipe()
+
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.closed:
+	case <-ctx.Done():
+	case <-time.After(timeout):
+	}
+	client.Close()
+	server.Close()
+
+	return nil, errors.New(fmt.Sprintf("Can not connect to %s", addr.NodeAddrToString()))
+}
+
+func (l *memoryListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, errors.New("Listener is closed")
+	}
+}
+
+func (l *memoryListener) Close() error {
+	l.once.Do(func() {
+		close(l.closed)
+
+		memoryLock.Lock()
+
+		if memoryListeners != nil && memoryListeners[l.port] == l {
+			delete(memoryListeners, l.port)
+		}
+		memoryLock.Unlock()
+	})
+	return nil
+}
+
+func (l *memoryListener) Addr() net.Addr {
+	return memoryAddr(":" + strconv.Itoa(l.port))
+}
+
+func (a memoryAddr) Network() string {
+	return "memory"
+}
+
+func (a memoryAddr) String() string {
+	return string(a)
+}
@@ -5,8 +5,10 @@ import (
 	"encoding/gob"
 	"errors"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const Protocol = "tcp"
@@ -14,13 +16,29 @@ const NodeVersion = 1
 const CommandLength = 12
 const AuthStringLength = 20
 
+// Flags of services a node provides, in Services of its address
+const (
+	// keeps the blockchain and relays blocks and transactions
+	ServiceNetwork uint64 = 1
+)
+
 // Represents a node address
 type NodeAddr struct {
-	Host                     string
-	Port                     int
-	SuccessConnections       uint
-	FailedConnections        uint
-	SuccessIncomeConnections uint
+	Host                     string `proto:"1"`
+	Port                     int    `proto:"2"`
+	SuccessConnections       uint   `proto:"3"`
+	FailedConnections        uint   `proto:"4"`
+	SuccessIncomeConnections uint   `proto:"5"`
+	// identity of the node listening on the address and its signature of the address. Empty for older nodes
+	Identity  []byte `proto:"6"`
+	Announced int64  `proto:"7"`
+	Signature []byte `proto:"8"`
+	// unix time when the node answered or connected last time. For addresses from other nodes it is their time
+	LastSeen int64  `proto:"9"`
+	Services uint64 `proto:"10"`
+	// pings in a row the node didn't answer. A stale node is used only when there are no other nodes
+	missedPings int
+	stale       bool
 }
 
 type NodeAddrShort struct {
@@ -40,14 +58,30 @@ func (n NodeAddr) NodeAddrToString() string {
 	return n.String()
 }
 
-// Convert to string in format host:port
+// Convert to string in format host:port, unix:/path for a local socket or an URL of a WebSocket. IPv6 is in brackets
 func (n NodeAddr) String() string {
-	return n.Host + ":" + strconv.Itoa(n.Port)
+	if n.IsLocal() || n.IsWebSocket() {
+		return n.Host
+	}
+	return net.JoinHostPort(n.hostName(), strconv.Itoa(n.Port))
 }
 
 // Notify this address got success attempt to connect
 func (n *NodeAddr) ReportSuccessConn() {
 	n.SuccessConnections = n.SuccessConnections + 1
+	n.LastSeen = time.Now().Unix()
+	n.missedPings = 0
+	n.stale = false
+}
+
+// Check if the node announced the service
+func (n NodeAddr) HasService(service uint64) bool {
+	return n.Services&service == service
+}
+
+// Returns true if the node didn't answer pings
+func (n NodeAddr) IsStale() bool {
+	return n.stale
 }
 
 // Get short format of the node
@@ -81,23 +115,44 @@ func (n NodeAddr) CompareToAddress(addr NodeAddr) bool {
 		h2 = "127.0.0.1"
 	}
 
-	return (h1 == h2 && addr.Port == n.Port)
+	if ip1, ip2 := net.ParseIP(h1), net.ParseIP(h2); ip1 != nil && ip2 != nil {
+		// same IPv6 can be written differently
+		return ip1.Equal(ip2) && addr.Port == n.Port
+	}
+
+	return (strings.EqualFold(h1, h2) && addr.Port == n.Port)
 }
 
 // Parse from string
 func (n *NodeAddr) LoadFromString(addr string) error {
-	parts := strings.SplitN(addr, ":", 2)
+	if strings.HasPrefix(addr, LocalSocketPrefix) {
+		*n = NewLocalAddr(strings.TrimPrefix(addr, LocalSocketPrefix))
+		return nil
+	}
+
+	if ws := (NodeAddr{Host: strings.TrimSpace(addr)}); ws.IsWebSocket() {
+		err := ValidateWebSocketAddress(ws.Host)
 
-	if len(parts) < 2 {
-		return errors.New("Wrong address")
+		if err != nil {
+			return err
+		}
+		n.Host = ws.Host
+		n.Port = 0
+		return nil
 	}
-	n.Host = parts[0]
 
-	port, err := strconv.Atoi(parts[1])
+	host, port, err := splitHostPort(strings.TrimSpace(addr))
+
+	if err != nil {
+		return errors.New(fmt.Sprintf("Wrong address %s: %s", addr, err.Error()))
+	}
+
+	err = ValidateHost(host)
 
 	if err != nil {
 		return err
 	}
+	n.Host = host
 	n.Port = port
 	return nil
 }
@@ -143,3 +198,8 @@ func GobEncode(data interface{}) ([]byte, error) {
 
 	return buff.Bytes(), nil
 }
+
+// Decode bytes to structure
+func GobDecode(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
@@ -0,0 +1,71 @@
+package net
+
+/*
+* Time of other nodes. A node sends own time in the version command, an offset of every peer is remembered.
+* The offset of the network is a median of offsets, so few nodes with wrong clocks don't move it
+ */
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Offsets of not more peers are kept, oldest are removed
+const NetworkTimeMaxPeers = 200
+
+type NetworkTime struct {
+	lock    *sync.Mutex
+	offsets map[string]int64
+	order   []string
+}
+
+func NewNetworkTime() *NetworkTime {
+	t := &NetworkTime{}
+	t.lock = &sync.Mutex{}
+	t.offsets = map[string]int64{}
+	t.order = []string{}
+
+	return t
+}
+
+// Remembers an offset of a peer clock. The peer is an identity or an address of a node
+func (t *NetworkTime) AddSample(peer string, peerTime int64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, ok := t.offsets[peer]; !ok {
+		t.order = append(t.order, peer)
+
+		if len(t.order) > NetworkTimeMaxPeers {
+			delete(t.offsets, t.order[0])
+			t.order = t.order[1:]
+		}
+	}
+	t.offsets[peer] = peerTime - time.Now().Unix()
+}
+
+// Returns median offset of peers in seconds and number of peers. Positive offset means this clock is behind
+func (t *NetworkTime) GetOffset() (int64, int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if len(t.offsets) == 0 {
+		return 0, 0
+	}
+
+	list := []int64{}
+
+	for _, offset := range t.offsets {
+		list = append(list, offset)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+
+	middle := len(list) / 2
+
+	if len(list)%2 == 0 {
+		return (list[middle-1] + list[middle]) / 2, len(list)
+	}
+	return list[middle], len(list)
+}
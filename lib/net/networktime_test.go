@@ -0,0 +1,47 @@
+package net
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNetworkTime(t *testing.T) {
+	nt := NewNetworkTime()
+
+	if offset, peers := nt.GetOffset(); offset != 0 || peers != 0 {
+		t.Fatalf("Got offset %d of %d peers", offset, peers)
+	}
+
+	now := time.Now().Unix()
+
+	nt.AddSample("a", now+100)
+	nt.AddSample("b", now+101)
+	nt.AddSample("c", now-5000)
+
+	// one wrong clock doesn't move the median
+	offset, peers := nt.GetOffset()
+
+	if peers != 3 || offset < 99 || offset > 101 {
+		t.Fatalf("Got offset %d of %d peers", offset, peers)
+	}
+
+	// same peer is counted once
+	nt.AddSample("c", now+100)
+
+	offset, peers = nt.GetOffset()
+
+	if peers != 3 || offset < 99 || offset > 101 {
+		t.Fatalf("Got offset %d of %d peers", offset, peers)
+	}
+
+	for i := 0; i < NetworkTimeMaxPeers+10; i++ {
+		nt.AddSample(strconv.Itoa(i), now)
+	}
+
+	offset, peers = nt.GetOffset()
+
+	if peers != NetworkTimeMaxPeers || offset > 1 {
+		t.Fatalf("Got offset %d of %d peers", offset, peers)
+	}
+}
@@ -0,0 +1,126 @@
+package net
+
+/*
+* Score of known nodes and aging of the list. A node which answers is better, a node not seen long time is worse.
+* Better nodes are used for sync more often. A stale node which was not seen for long time is removed
+ */
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// score of a node is halved when it was not seen for this time
+	nodeScoreHalfLife = 24 * 3600
+	// last seen time of an address from other node is older by this, other node can be wrong
+	relayedAddrPenalty = 2 * 3600
+)
+
+// Score of a node from 0 to 1
+func (n NodeAddr) Score(now int64) float64 {
+	success := float64(n.SuccessConnections + n.SuccessIncomeConnections)
+	// a node without history has 0.5
+	score := (success + 1) / (success + float64(n.FailedConnections) + 2)
+
+	if n.LastSeen == 0 {
+		score = score / 2
+	} else if now > n.LastSeen {
+		score = score / (1 + float64(now-n.LastSeen)/nodeScoreHalfLife)
+	}
+
+	if n.stale {
+		score = score / 10
+	}
+	return score
+}
+
+// Returns the address as it is added from other node. Counters of other node are not used
+func (n NodeAddr) relayed(now int64) NodeAddr {
+	n.SuccessConnections = 0
+	n.FailedConnections = 0
+	n.SuccessIncomeConnections = 0
+	n.missedPings = 0
+	n.stale = false
+
+	if n.LastSeen > now {
+		n.LastSeen = now
+	}
+
+	if n.LastSeen > relayedAddrPenalty {
+		n.LastSeen = n.LastSeen - relayedAddrPenalty
+	} else {
+		n.LastSeen = 0
+	}
+	return n
+}
+
+// Removes stale nodes which were not seen maxAge seconds. At least keep nodes stay in the list,
+// nodes with lower score are removed first. Returns removed nodes
+func (n *NodeNetwork) AgeOutNodes(maxAge int64, keep int) []NodeAddr {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	now := time.Now().Unix()
+
+	expired := []int{}
+
+	for i, node := range n.Nodes {
+		if node.stale && now-node.LastSeen > maxAge && !n.Manual.IsManual(node) {
+			expired = append(expired, i)
+		}
+	}
+
+	count := len(expired)
+
+	if len(n.Nodes)-count < keep {
+		count = len(n.Nodes) - keep
+	}
+
+	if count <= 0 {
+		return nil
+	}
+
+	sort.SliceStable(expired, func(a, b int) bool {
+		return n.Nodes[expired[a]].Score(now) < n.Nodes[expired[b]].Score(now)
+	})
+
+	remove := map[int]bool{}
+
+	for _, i := range expired[:count] {
+		remove[i] = true
+	}
+
+	removed := []NodeAddr{}
+	updatedlist := []NodeAddr{}
+
+	for i, node := range n.Nodes {
+		if remove[i] {
+			removed = append(removed, node)
+
+			if n.Storage != nil {
+				n.Storage.RemoveNodeFromKnown(node)
+			}
+			continue
+		}
+		updatedlist = append(updatedlist, node)
+	}
+
+	n.Nodes = updatedlist
+
+	return removed
+}
+
+// Saves counters and last seen time of all nodes to the storage, to use them after restart
+func (n *NodeNetwork) SaveNodes() {
+	if n.Storage == nil {
+		return
+	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for _, node := range n.Nodes {
+		n.Storage.AddNodeToKnown(node)
+	}
+}
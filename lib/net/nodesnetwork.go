@@ -1,7 +1,13 @@
 package net
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/gelembjuk/oursql/lib/utils"
 )
@@ -23,7 +29,11 @@ type NodeNetwork struct {
 	hadInputConnects       bool
 	hadRecentInputConnects bool
 	Storage                NodeNetworkStorage
-	lock                   *sync.Mutex
+	// nodes added by an operator. They are not aged out
+	Manual *ManualNodes
+	// identity key of this node. Addresses announced with it are not added
+	Identity []byte
+	lock     *sync.Mutex
 }
 
 type NodesListJSON struct {
@@ -57,6 +67,9 @@ func (n *NodeNetwork) LoadNodes() error {
 	}
 
 	for _, node := range nodes {
+		if node.IsLocal() {
+			continue
+		}
 		n.Nodes = append(n.Nodes, node)
 	}
 
@@ -68,6 +81,8 @@ func (n *NodeNetwork) SetNodes(nodes []NodeAddr, replace bool) {
 	n.lock.Lock()
 	defer n.lock.Unlock()
 
+	nodes = filterLocalAddrs(nodes)
+
 	if replace {
 		n.Nodes = nodes
 	} else {
@@ -110,9 +125,17 @@ func (n *NodeNetwork) CheckIsKnown(addr NodeAddr) bool {
 // Action on input connection from a node. We need to remember this node
 // It is needed to know there are input connects from other nodes
 func (n *NodeNetwork) InputConnectFromNode(addr NodeAddr) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
 	for i, node := range n.Nodes {
 		if node.CompareToAddress(addr) {
 			n.Nodes[i].SuccessIncomeConnections = n.Nodes[i].SuccessIncomeConnections + 1
+			n.Nodes[i].LastSeen = time.Now().Unix()
+
+			if addr.Services != 0 {
+				n.Nodes[i].Services = addr.Services
+			}
 			break
 		}
 	}
@@ -130,11 +153,14 @@ func (n *NodeNetwork) CheckHadInputConnects() bool {
 	return n.hadRecentInputConnects
 }
 
-// Get list of nodes in short format
+// Get list of nodes in short format. Stale nodes are not exported
 func (n *NodeNetwork) GetNodesToExport() (list []NodeAddrShort) {
 	list = []NodeAddrShort{}
 
 	for _, node := range n.Nodes {
+		if node.stale {
+			continue
+		}
 		list = append(list, node.GetShortFormat())
 	}
 	return
@@ -145,17 +171,61 @@ func (n *NodeNetwork) GetNodesToExport() (list []NodeAddrShort) {
 * Returns true if was added
  */
 func (n *NodeNetwork) AddNodeToKnown(addr NodeAddr) bool {
+	if addr.IsLocal() {
+		return false
+	}
+
+	if addr.IsSigned() && addr.VerifyAnnouncement() != nil {
+		// it is not relayed
+		addr = addr.WithoutAnnouncement()
+	}
+
+	if n.IsThisNode(addr) {
+		// other nodes know this node by other address
+		return false
+	}
+
+	addr = addr.relayed(time.Now().Unix())
+	announced := addr
+
 	n.lock.Lock()
 	defer n.lock.Unlock()
 
 	exists := false
 
-	for _, node := range n.Nodes {
+	for i, node := range n.Nodes {
 		if node.CompareToAddress(addr) {
 			exists = true
+
+			if len(node.Identity) == 0 && addr.IsSigned() {
+				n.Nodes[i].Identity = addr.Identity
+				n.Nodes[i].Announced = addr.Announced
+				n.Nodes[i].Signature = addr.Signature
+			}
+			if addr.LastSeen > node.LastSeen {
+				n.Nodes[i].LastSeen = addr.LastSeen
+			}
+			if addr.Services != 0 {
+				n.Nodes[i].Services = addr.Services
+			}
+			addr = n.Nodes[i]
 			break
 		}
 	}
+
+	if announced.IsSigned() {
+		moved, ok := n.moveIdentity(announced, exists)
+
+		if !ok {
+			// it is an old address of a node which announced other address later
+			return false
+		}
+
+		if moved {
+			return !exists
+		}
+	}
+
 	if !exists {
 		n.Nodes = append(n.Nodes, addr)
 	}
@@ -167,6 +237,151 @@ func (n *NodeNetwork) AddNodeToKnown(addr NodeAddr) bool {
 	return !exists
 }
 
+/*
+* A node with a dynamic IP announces new address with same identity. The known node is moved to the new address
+* with its counters, so its score is not lost. If the new address is known already, two records of same node
+* are merged. Returns false when the address is announced before the known address of the identity, it is not added.
+* Must be called with the lock
+ */
+func (n *NodeNetwork) moveIdentity(addr NodeAddr, exists bool) (moved bool, ok bool) {
+	target := -1
+
+	for j, node := range n.Nodes {
+		if node.CompareToAddress(addr) {
+			if !bytes.Equal(node.Identity, addr.Identity) {
+				// the address is known with other identity. It is not merged
+				return false, true
+			}
+			target = j
+		}
+	}
+
+	for i, node := range n.Nodes {
+		if node.CompareToAddress(addr) || !bytes.Equal(node.Identity, addr.Identity) {
+			continue
+		}
+
+		if node.Announced >= addr.Announced {
+			// the known address is fresher. If both addresses are known, older record stays till it is moved
+			return false, exists
+		}
+
+		if n.Storage != nil {
+			n.Storage.RemoveNodeFromKnown(node)
+		}
+
+		if target >= 0 {
+			// counters of the old record are added to the record of the new address
+			t := &n.Nodes[target]
+			t.SuccessConnections += node.SuccessConnections
+			t.FailedConnections += node.FailedConnections
+			t.SuccessIncomeConnections += node.SuccessIncomeConnections
+
+			if node.LastSeen > t.LastSeen {
+				t.LastSeen = node.LastSeen
+			}
+			t.Announced = addr.Announced
+			t.Signature = addr.Signature
+
+			merged := *t
+
+			n.Nodes = append(n.Nodes[:i], n.Nodes[i+1:]...)
+			n.saveMoved(node, merged)
+
+			return true, true
+		}
+
+		n.Nodes[i].Host = addr.Host
+		n.Nodes[i].Port = addr.Port
+		n.Nodes[i].Announced = addr.Announced
+		n.Nodes[i].Signature = addr.Signature
+
+		if addr.Services != 0 {
+			n.Nodes[i].Services = addr.Services
+		}
+		n.saveMoved(node, n.Nodes[i])
+
+		return true, true
+	}
+	return false, true
+}
+
+func (n *NodeNetwork) saveMoved(from NodeAddr, to NodeAddr) {
+	if n.Storage != nil {
+		n.Storage.AddNodeToKnown(to)
+	}
+
+	if n.Logger != nil {
+		n.Logger.Trace.Printf("Node %s is moved to %s", from.NodeAddrToString(), to.NodeAddrToString())
+	}
+}
+
+// Check if the address is announced with the identity of this node. It can be other address of this node
+func (n *NodeNetwork) IsThisNode(addr NodeAddr) bool {
+	return len(n.Identity) > 0 && addr.IsSigned() && bytes.Equal(addr.Identity, n.Identity) &&
+		addr.VerifyAnnouncement() == nil
+}
+
+// Checks the identity of the node which sent a message from the address. The announcement must be signed correctly
+// and must have same identity as the address is known with. When the address is known without an identity,
+// it is remembered. Address known with an identity can not be used without it. A message with the identity
+// of this node is rejected, this node is connected by other address
+func (n *NodeNetwork) CheckIdentity(addr NodeAddr) error {
+	if addr.IsSigned() {
+		err := addr.VerifyAnnouncement()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if n.IsThisNode(addr) {
+		return errors.New(fmt.Sprintf("Address %s is an address of this node", addr.String()))
+	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for i, node := range n.Nodes {
+		if !node.CompareToAddress(addr) {
+			continue
+		}
+
+		if len(node.Identity) == 0 {
+			if addr.IsSigned() {
+				n.Nodes[i].Identity = addr.Identity
+				n.Nodes[i].Announced = addr.Announced
+				n.Nodes[i].Signature = addr.Signature
+
+				if n.Storage != nil {
+					n.Storage.AddNodeToKnown(n.Nodes[i])
+				}
+				// same node can be known by its old address too
+				n.moveIdentity(addr, true)
+			}
+			return nil
+		}
+
+		if !bytes.Equal(node.Identity, addr.Identity) {
+			return errors.New(fmt.Sprintf("Address %s is known with identity %s, not %s. It can be spoofed",
+				addr.String(), IdentityID(node.Identity), IdentityID(addr.Identity)))
+		}
+
+		if addr.Announced > node.Announced || len(node.Signature) == 0 {
+			// newest announcement is relayed
+			n.Nodes[i].Announced = addr.Announced
+			n.Nodes[i].Signature = addr.Signature
+		}
+		return nil
+	}
+
+	if addr.IsSigned() {
+		// maybe the node is known by old address
+		n.moveIdentity(addr, false)
+	}
+	return nil
+}
+
 // Removes a node from known
 func (n *NodeNetwork) RemoveNodeFromKnown(addr NodeAddr) {
 	n.lock.Lock()
@@ -187,8 +402,8 @@ func (n *NodeNetwork) RemoveNodeFromKnown(addr NodeAddr) {
 	}
 }
 
-// Checks nodes rendomly and returns first found node that is accesible
-// It check if a node was ever connected from this place
+// Returns a node to request. Nodes which were connected from this place are preferred, a node is chosen
+// randomly by score, so better nodes are used more often. Stale nodes are returned only if there are no other
 func (n NodeNetwork) GetConnecttionVerifiedNodeAddr() *NodeAddr {
 	//n.Logger.Trace.Printf("Currently there are %d nodes", len(n.Nodes))
 
@@ -196,21 +411,58 @@ func (n NodeNetwork) GetConnecttionVerifiedNodeAddr() *NodeAddr {
 		return nil
 	}
 
-	rng := utils.MakeRandomRange(0, len(n.Nodes)-1)
+	verified := []int{}
+	fresh := []int{}
 
-	var i int
-
-	for _, i = range rng {
-		node := n.Nodes[i]
+	for i, node := range n.Nodes {
+		if node.stale {
+			continue
+		}
 
 		if node.SuccessConnections > 0 {
-			return &node
+			verified = append(verified, i)
+		} else {
+			fresh = append(fresh, i)
 		}
 	}
-	return &n.Nodes[i]
+
+	if len(verified) == 0 {
+		verified = fresh
+	}
+
+	if len(verified) == 0 {
+		node := n.Nodes[rand.Intn(len(n.Nodes))]
+		return &node
+	}
+
+	node := n.Nodes[n.chooseByScore(verified)]
+
+	return &node
 }
 
-// Same as GetConnecttionVerifiedNodeAddr but returns all verified nodes  or limited list if requested
+// Returns index of a node from the list, with probability by the score
+func (n NodeNetwork) chooseByScore(list []int) int {
+	now := time.Now().Unix()
+	total := 0.0
+
+	for _, i := range list {
+		total += n.Nodes[i].Score(now)
+	}
+
+	r := rand.Float64() * total
+
+	for _, i := range list {
+		r -= n.Nodes[i].Score(now)
+
+		if r <= 0 {
+			return i
+		}
+	}
+	return list[len(list)-1]
+}
+
+// Same as GetConnecttionVerifiedNodeAddr but returns all verified nodes or limited list if requested,
+// nodes with better score go first. Stale nodes go after others
 func (n NodeNetwork) GetConnecttionVerifiedNodeAddresses(limit int) []*NodeAddr {
 	nodes := []*NodeAddr{}
 
@@ -218,29 +470,101 @@ func (n NodeNetwork) GetConnecttionVerifiedNodeAddresses(limit int) []*NodeAddr
 		return nodes
 	}
 
+	now := time.Now().Unix()
+
+	// same score are in random order
 	rng := utils.MakeRandomRange(0, len(n.Nodes)-1)
 
-	var i int
+	sort.SliceStable(rng, func(a, b int) bool {
+		return n.Nodes[rng[a]].Score(now) > n.Nodes[rng[b]].Score(now)
+	})
+
+	stale := []*NodeAddr{}
 
-	for _, i = range rng {
+	for _, i := range rng {
 		node := n.Nodes[i]
 
-		if node.SuccessConnections > 0 {
-			nodes = append(nodes, &node)
+		if node.SuccessConnections == 0 {
+			continue
+		}
 
-			if limit > 0 && len(nodes) >= limit {
-				return nodes
-			}
+		if node.stale {
+			stale = append(stale, &node)
+			continue
+		}
+
+		nodes = append(nodes, &node)
+
+		if limit > 0 && len(nodes) >= limit {
+			return nodes
 		}
 	}
+
+	for _, node := range stale {
+		if limit > 0 && len(nodes) >= limit {
+			break
+		}
+		nodes = append(nodes, node)
+	}
+
 	if len(nodes) == 0 {
-		for _, n := range n.Nodes {
-			nodes = append(nodes, &n)
+		for _, i := range rng {
+			node := n.Nodes[i]
+			nodes = append(nodes, &node)
 		}
 	}
 	return nodes
 }
 
+// Call this when a node didn't answer a ping. After limit pings in a row the node is stale.
+// Returns true when the node becomes stale
+func (n *NodeNetwork) ReportMissedPing(addr NodeAddr, limit int) bool {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for i, node := range n.Nodes {
+		if !node.CompareToAddress(addr) {
+			continue
+		}
+
+		n.Nodes[i].missedPings++
+		n.Nodes[i].ReportFailedConn()
+
+		if !node.stale && n.Nodes[i].missedPings >= limit {
+			n.Nodes[i].stale = true
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+// Call this when a node answered a ping. Returns true if the node was stale
+func (n *NodeNetwork) ReportAnsweredPing(addr NodeAddr) bool {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for i, node := range n.Nodes {
+		if node.CompareToAddress(addr) {
+			n.Nodes[i].ReportSuccessConn()
+			return node.stale
+		}
+	}
+	return false
+}
+
+// Returns number of stale nodes
+func (n *NodeNetwork) GetCountOfStaleNodes() int {
+	c := 0
+
+	for _, node := range n.Nodes {
+		if node.stale {
+			c++
+		}
+	}
+	return c
+}
+
 // Call this when network operation with some node failed.
 // It will analise error and do some actios to remember state of this node
 func (n *NodeNetwork) HookNeworkOperationResult(err error, nodeindex int) {
@@ -0,0 +1,111 @@
+package net
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStaleNodes(t *testing.T) {
+	n := NodeNetwork{}
+	n.Init()
+
+	alive := NodeAddr{Host: "10.0.0.1", Port: 8765, SuccessConnections: 1}
+	dead := NodeAddr{Host: "10.0.0.2", Port: 8765, SuccessConnections: 1}
+
+	n.SetNodes([]NodeAddr{alive, dead}, true)
+
+	if n.ReportMissedPing(dead, 2) {
+		t.Fatalf("Node is stale after one missed ping")
+	}
+
+	if !n.ReportMissedPing(dead, 2) {
+		t.Fatalf("Node is not stale after 2 missed pings")
+	}
+
+	if n.GetCountOfStaleNodes() != 1 {
+		t.Fatalf("Stale nodes %d", n.GetCountOfStaleNodes())
+	}
+
+	for i := 0; i < 10; i++ {
+		if !n.GetConnecttionVerifiedNodeAddr().CompareToAddress(alive) {
+			t.Fatalf("Stale node is returned")
+		}
+
+		nodes := n.GetConnecttionVerifiedNodeAddresses(0)
+
+		if len(nodes) != 2 || !nodes[1].CompareToAddress(dead) {
+			t.Fatalf("Stale node is not last")
+		}
+	}
+
+	if n.GetConnecttionVerifiedNodeAddresses(1)[0].CompareToAddress(dead) {
+		t.Fatalf("Stale node is returned with a limit")
+	}
+
+	if !n.ReportAnsweredPing(dead) || n.GetCountOfStaleNodes() != 0 {
+		t.Fatalf("Node is stale after it answered")
+	}
+}
+
+func TestNodesScore(t *testing.T) {
+	n := NodeNetwork{}
+	n.Init()
+
+	now := time.Now().Unix()
+
+	good := NodeAddr{Host: "10.0.0.1", Port: 8765, SuccessConnections: 10, LastSeen: now}
+	old := NodeAddr{Host: "10.0.0.2", Port: 8765, SuccessConnections: 10, LastSeen: now - 10*24*3600}
+	failing := NodeAddr{Host: "10.0.0.3", Port: 8765, SuccessConnections: 1, FailedConnections: 10, LastSeen: now}
+
+	if !(good.Score(now) > old.Score(now) && good.Score(now) > failing.Score(now)) {
+		t.Fatalf("Scores %f %f %f", good.Score(now), old.Score(now), failing.Score(now))
+	}
+
+	n.SetNodes([]NodeAddr{failing, old, good}, true)
+
+	nodes := n.GetConnecttionVerifiedNodeAddresses(0)
+
+	if len(nodes) != 3 || !nodes[0].CompareToAddress(good) {
+		t.Fatalf("Node with best score is not first")
+	}
+
+	// an address from other node doesn't bring its counters and it is not newer than now
+	n.AddNodeToKnown(NodeAddr{Host: "10.0.0.4", Port: 8765, SuccessConnections: 100, LastSeen: now + 3600, Services: ServiceNetwork})
+
+	added := n.GetNodes()[3]
+
+	if added.SuccessConnections != 0 || added.LastSeen > now || !added.HasService(ServiceNetwork) {
+		t.Fatalf("Added node %+v", added)
+	}
+}
+
+func TestAgeOutNodes(t *testing.T) {
+	n := NodeNetwork{}
+	n.Init()
+
+	now := time.Now().Unix()
+
+	nodes := []NodeAddr{
+		NodeAddr{Host: "10.0.0.1", Port: 8765, LastSeen: now},
+		NodeAddr{Host: "10.0.0.2", Port: 8765, LastSeen: now - 3*3600},
+		NodeAddr{Host: "10.0.0.3", Port: 8765, LastSeen: now - 2*3600},
+		NodeAddr{Host: "10.0.0.4", Port: 8765}}
+
+	n.SetNodes(nodes, true)
+
+	for _, node := range nodes {
+		n.ReportMissedPing(node, 1)
+	}
+	// it is not stale now
+	n.ReportAnsweredPing(nodes[0])
+
+	removed := n.AgeOutNodes(3600, 2)
+
+	if len(removed) != 2 || !removed[0].CompareToAddress(nodes[1]) || !removed[1].CompareToAddress(nodes[3]) {
+		t.Fatalf("Removed %v", removed)
+	}
+
+	if len(n.AgeOutNodes(3600, 2)) != 0 || n.GetCountOfKnownNodes() != 2 {
+		t.Fatalf("Less than 2 nodes are kept")
+	}
+}
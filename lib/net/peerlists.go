@@ -0,0 +1,105 @@
+package net
+
+/*
+* Whitelist and blacklist of peers by IP or subnet. Whitelisted peers are never banned and are not limited by
+* inbound slots and rate of requests. Connections of blacklisted peers are closed at once when accepted.
+* When a peer is in both lists, the whitelist wins
+ */
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// IPs or subnets in CIDR format, like "10.0.0.5" or "10.0.0.0/8"
+type PeerListsConfig struct {
+	Whitelist []string
+	Blacklist []string
+}
+
+type PeerLists struct {
+	whitelist []*net.IPNet
+	blacklist []*net.IPNet
+}
+
+func NewPeerLists(config PeerListsConfig) (*PeerLists, error) {
+	l := &PeerLists{}
+
+	var err error
+
+	l.whitelist, err = parseSubnets(config.Whitelist)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Whitelist error: %s", err.Error()))
+	}
+
+	l.blacklist, err = parseSubnets(config.Blacklist)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Blacklist error: %s", err.Error()))
+	}
+	return l, nil
+}
+
+// A single IP is a subnet with a full mask
+func parseSubnets(list []string) ([]*net.IPNet, error) {
+	subnets := []*net.IPNet{}
+
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+
+		if strings.Contains(s, "/") {
+			_, subnet, err := net.ParseCIDR(s)
+
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("Wrong subnet %s", s))
+			}
+			subnets = append(subnets, subnet)
+			continue
+		}
+
+		ip := net.ParseIP(s)
+
+		if ip == nil {
+			return nil, errors.New(fmt.Sprintf("Wrong IP %s", s))
+		}
+
+		if ip4 := ip.To4(); ip4 != nil {
+			subnets = append(subnets, &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)})
+		} else {
+			subnets = append(subnets, &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)})
+		}
+	}
+	return subnets, nil
+}
+
+func inSubnets(subnets []*net.IPNet, host string) bool {
+	ip := net.ParseIP(host)
+
+	if ip == nil {
+		return false
+	}
+
+	for _, subnet := range subnets {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *PeerLists) IsWhitelisted(host string) bool {
+	if l == nil {
+		return false
+	}
+	return inSubnets(l.whitelist, host)
+}
+
+func (l *PeerLists) IsBlacklisted(host string) bool {
+	if l == nil || l.IsWhitelisted(host) {
+		return false
+	}
+	return inSubnets(l.blacklist, host)
+}
@@ -0,0 +1,54 @@
+package net
+
+import (
+	"testing"
+)
+
+func TestPeerLists(t *testing.T) {
+	lists, err := NewPeerLists(PeerListsConfig{
+		Whitelist: []string{"10.0.0.5", "fd00::1"},
+		Blacklist: []string{"10.0.0.0/8", "192.168.1.7", "fd00::/16"}})
+
+	if err != nil {
+		t.Fatalf("Create lists error: %s", err.Error())
+	}
+
+	tests := []struct {
+		host        string
+		whitelisted bool
+		blacklisted bool
+	}{
+		{"10.0.0.5", true, false},
+		{"10.1.2.3", false, true},
+		{"192.168.1.7", false, true},
+		{"192.168.1.8", false, false},
+		{"::ffff:10.1.2.3", false, true},
+		{"fd00::1", true, false},
+		{"fd00::2", false, true},
+		{"", false, false},
+	}
+
+	for _, test := range tests {
+		if lists.IsWhitelisted(test.host) != test.whitelisted {
+			t.Fatalf("Wrong whitelist state of %s", test.host)
+		}
+
+		if lists.IsBlacklisted(test.host) != test.blacklisted {
+			t.Fatalf("Wrong blacklist state of %s", test.host)
+		}
+	}
+
+	var empty *PeerLists
+
+	if empty.IsWhitelisted("10.0.0.5") || empty.IsBlacklisted("10.0.0.5") {
+		t.Fatalf("Nil lists must not contain peers")
+	}
+
+	if _, err = NewPeerLists(PeerListsConfig{Blacklist: []string{"10.0.0.300"}}); err == nil {
+		t.Fatalf("Wrong IP is accepted")
+	}
+
+	if _, err = NewPeerLists(PeerListsConfig{Whitelist: []string{"10.0.0.0/40"}}); err == nil {
+		t.Fatalf("Wrong subnet is accepted")
+	}
+}
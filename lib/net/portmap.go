@@ -0,0 +1,520 @@
+package net
+
+/*
+* Mapping of the port of a node on a router of a home network with UPnP IGD or NAT-PMP. A node behind NAT
+* doesn't get connections from other nodes, so it misses blocks pushed by them. When the port is mapped the node
+* announces the external address of the router. A mapping has a lifetime, it must be renewed
+ */
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Methods of port mapping
+const (
+	PortMapUPnP   = "upnp"
+	PortMapNATPMP = "natpmp"
+)
+
+// Default seconds of a mapping
+const defaultPortMapLifetime = 3600
+
+const portMapTimeout = 3 * time.Second
+
+// Port of NAT-PMP on a router and address of SSDP. Tests change them
+var natPMPPort = 5351
+var ssdpAddress = "239.255.255.250:1900"
+
+type PortMapConfig struct {
+	Enabled bool
+	// upnp or natpmp. Empty means UPnP, then NAT-PMP if UPnP fails
+	Method string
+	// seconds of a mapping, it is renewed after half of this time. Default 3600
+	Lifetime int
+	// IP of a router for NAT-PMP. Default is the gateway of the default route
+	Gateway string
+	// port on the router. Default is same as the port of the node
+	ExternalPort int
+}
+
+type PortMapping struct {
+	Method       string
+	ExternalIP   string
+	ExternalPort int
+	InternalPort int
+	Lifetime     time.Duration
+
+	// NAT-PMP
+	gateway string
+	// UPnP
+	controlURL  string
+	serviceType string
+	internalIP  string
+	leaseTime   int
+}
+
+// Maps a local port on a router. Returns an error if there is no router which supports the method
+func MapPort(config PortMapConfig, port int) (*PortMapping, error) {
+	m := &PortMapping{InternalPort: port, ExternalPort: config.ExternalPort}
+
+	if m.ExternalPort == 0 {
+		m.ExternalPort = port
+	}
+
+	if config.Lifetime <= 0 {
+		config.Lifetime = defaultPortMapLifetime
+	}
+	m.Lifetime = time.Duration(config.Lifetime) * time.Second
+
+	switch config.Method {
+	case PortMapUPnP:
+		return m, m.mapUPnP()
+	case PortMapNATPMP:
+		return m, m.mapNATPMP(config.Gateway)
+	case "":
+		errUPnP := m.mapUPnP()
+
+		if errUPnP == nil {
+			return m, nil
+		}
+
+		errNATPMP := m.mapNATPMP(config.Gateway)
+
+		if errNATPMP != nil {
+			return m, errors.New(fmt.Sprintf("UPnP: %s, NAT-PMP: %s", errUPnP.Error(), errNATPMP.Error()))
+		}
+		return m, nil
+	}
+	return m, errors.New(fmt.Sprintf("Unknown port mapping method %s", config.Method))
+}
+
+// External address of this node
+func (m *PortMapping) Address() NodeAddr {
+	return NodeAddr{Host: m.ExternalIP, Port: m.ExternalPort}
+}
+
+// Renews the mapping. The external IP can be changed after it
+func (m *PortMapping) Renew() error {
+	if m.Method == PortMapNATPMP {
+		return m.natPMPMap(m.Lifetime)
+	}
+	return m.upnpMap()
+}
+
+// Deletes the mapping on the router
+func (m *PortMapping) Remove() error {
+	if m.Method == PortMapNATPMP {
+		return m.natPMPMap(0)
+	}
+
+	_, err := upnpCall(m.controlURL, m.serviceType, "DeletePortMapping", [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(m.ExternalPort)},
+		{"NewProtocol", "TCP"}})
+
+	return err
+}
+
+// NAT-PMP, RFC 6886
+
+func (m *PortMapping) mapNATPMP(gateway string) error {
+	var err error
+
+	if gateway == "" {
+		gateway, err = defaultGateway()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	m.Method = PortMapNATPMP
+	m.gateway = gateway
+
+	return m.natPMPMap(m.Lifetime)
+}
+
+// Maps the port for the lifetime, 0 deletes the mapping
+func (m *PortMapping) natPMPMap(lifetime time.Duration) error {
+	request := make([]byte, 12)
+	request[1] = 2 // TCP
+	binary.BigEndian.PutUint16(request[4:], uint16(m.InternalPort))
+
+	if lifetime > 0 {
+		binary.BigEndian.PutUint16(request[6:], uint16(m.ExternalPort))
+	}
+	binary.BigEndian.PutUint32(request[8:], uint32(lifetime/time.Second))
+
+	response, err := natPMPRequest(m.gateway, request, 16)
+
+	if err != nil {
+		return err
+	}
+
+	if lifetime == 0 {
+		return nil
+	}
+
+	m.ExternalPort = int(binary.BigEndian.Uint16(response[10:]))
+	m.Lifetime = time.Duration(binary.BigEndian.Uint32(response[12:])) * time.Second
+
+	response, err = natPMPRequest(m.gateway, []byte{0, 0}, 12)
+
+	if err != nil {
+		return err
+	}
+
+	m.ExternalIP = net.IP(response[8:12]).String()
+
+	return nil
+}
+
+// Sends a request to a router and waits a response. The request is repeated with doubled timeout
+func natPMPRequest(gateway string, request []byte, size int) ([]byte, error) {
+	conn, err := net.Dial("udp", net.JoinHostPort(gateway, strconv.Itoa(natPMPPort)))
+
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	timeout := 250 * time.Millisecond
+	response := make([]byte, 16)
+
+	for i := 0; i < 4; i++ {
+		_, err = conn.Write(request)
+
+		if err != nil {
+			return nil, err
+		}
+
+		conn.SetReadDeadline(time.Now().Add(timeout))
+
+		n, err := conn.Read(response)
+
+		if err != nil {
+			if e, ok := err.(net.Error); ok && e.Timeout() {
+				timeout *= 2
+				continue
+			}
+			return nil, err
+		}
+
+		if n < size || response[0] != 0 || response[1] != request[1]+128 {
+			return nil, errors.New(fmt.Sprintf("Wrong NAT-PMP response from %s", gateway))
+		}
+
+		if code := binary.BigEndian.Uint16(response[2:]); code != 0 {
+			return nil, errors.New(fmt.Sprintf("NAT-PMP error %d from %s", code, gateway))
+		}
+		return response[:n], nil
+	}
+	return nil, errors.New(fmt.Sprintf("No NAT-PMP response from %s", gateway))
+}
+
+// Gateway of the default route. Only on Linux
+func defaultGateway() (string, error) {
+	data, err := ioutil.ReadFile("/proc/net/route")
+
+	if err != nil {
+		return "", errors.New("Can not find a gateway, set it in config")
+	}
+
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		fields := strings.Fields(line)
+
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+
+		gw, err := strconv.ParseUint(fields[2], 16, 32)
+
+		if err != nil || gw == 0 {
+			continue
+		}
+
+		ip := make(net.IP, 4)
+		binary.LittleEndian.PutUint32(ip, uint32(gw))
+
+		return ip.String(), nil
+	}
+	return "", errors.New("Default gateway is not found, set it in config")
+}
+
+// UPnP IGD
+
+type upnpService struct {
+	ServiceType string `xml:"serviceType"`
+	ControlURL  string `xml:"controlURL"`
+}
+
+type upnpDevice struct {
+	Services []upnpService `xml:"serviceList>service"`
+	Devices  []upnpDevice  `xml:"deviceList>device"`
+}
+
+type upnpDescription struct {
+	URLBase string     `xml:"URLBase"`
+	Device  upnpDevice `xml:"device"`
+}
+
+var upnpServiceTypes = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:2",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+func (d upnpDevice) findService() (upnpService, bool) {
+	for _, service := range d.Services {
+		for _, t := range upnpServiceTypes {
+			if service.ServiceType == t {
+				return service, true
+			}
+		}
+	}
+
+	for _, device := range d.Devices {
+		if service, ok := device.findService(); ok {
+			return service, true
+		}
+	}
+	return upnpService{}, false
+}
+
+func (m *PortMapping) mapUPnP() error {
+	location, err := discoverUPnP()
+
+	if err != nil {
+		return err
+	}
+	return m.mapUPnPLocation(location)
+}
+
+// Finds a location of a description of a router with SSDP
+func discoverUPnP() (string, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	addr, err := net.ResolveUDPAddr("udp4", ssdpAddress)
+
+	if err != nil {
+		return "", err
+	}
+
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"ST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n\r\n"
+
+	// UDP can be lost
+	for i := 0; i < 2; i++ {
+		if _, err = conn.WriteTo([]byte(search), addr); err != nil {
+			return "", err
+		}
+	}
+
+	conn.SetReadDeadline(time.Now().Add(portMapTimeout))
+
+	buf := make([]byte, 2048)
+
+	for {
+		n, _, err := conn.ReadFrom(buf)
+
+		if err != nil {
+			return "", errors.New("UPnP router is not found")
+		}
+
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+
+		if location := resp.Header.Get("Location"); location != "" {
+			return location, nil
+		}
+	}
+}
+
+// Finds a service of a router by its description and maps the port
+func (m *PortMapping) mapUPnPLocation(location string) error {
+	client := http.Client{Timeout: portMapTimeout}
+
+	resp, err := client.Get(location)
+
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	description := upnpDescription{}
+
+	err = xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&description)
+
+	if err != nil {
+		return errors.New(fmt.Sprintf("Wrong UPnP description %s: %s", location, err.Error()))
+	}
+
+	service, ok := description.Device.findService()
+
+	if !ok {
+		return errors.New(fmt.Sprintf("UPnP router %s has no WAN connection service", location))
+	}
+
+	base := description.URLBase
+
+	if base == "" {
+		base = location
+	}
+
+	baseURL, err := url.Parse(base)
+
+	if err != nil {
+		return err
+	}
+
+	controlURL, err := baseURL.Parse(service.ControlURL)
+
+	if err != nil {
+		return err
+	}
+
+	// local address of this node in the network of the router
+	conn, err := net.Dial("udp", controlURL.Host)
+
+	if err != nil {
+		return err
+	}
+	m.internalIP = conn.LocalAddr().(*net.UDPAddr).IP.String()
+	conn.Close()
+
+	m.Method = PortMapUPnP
+	m.controlURL = controlURL.String()
+	m.serviceType = service.ServiceType
+	m.leaseTime = int(m.Lifetime / time.Second)
+
+	return m.upnpMap()
+}
+
+func (m *PortMapping) upnpMap() error {
+	add := func() error {
+		_, err := upnpCall(m.controlURL, m.serviceType, "AddPortMapping", [][2]string{
+			{"NewRemoteHost", ""},
+			{"NewExternalPort", strconv.Itoa(m.ExternalPort)},
+			{"NewProtocol", "TCP"},
+			{"NewInternalPort", strconv.Itoa(m.InternalPort)},
+			{"NewInternalClient", m.internalIP},
+			{"NewEnabled", "1"},
+			{"NewPortMappingDescription", "oursql"},
+			{"NewLeaseDuration", strconv.Itoa(m.leaseTime)}})
+		return err
+	}
+
+	err := add()
+
+	if err != nil && m.leaseTime > 0 && strings.Contains(err.Error(), "725") {
+		// OnlyPermanentLeasesSupported. It is still renewed, so a mapping is back after a restart of the router
+		m.leaseTime = 0
+		err = add()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	response, err := upnpCall(m.controlURL, m.serviceType, "GetExternalIPAddress", nil)
+
+	if err != nil {
+		return err
+	}
+
+	m.ExternalIP = xmlValue(response, "NewExternalIPAddress")
+
+	if net.ParseIP(m.ExternalIP) == nil {
+		return errors.New(fmt.Sprintf("UPnP router returned wrong external IP %s", m.ExternalIP))
+	}
+	return nil
+}
+
+// Calls a SOAP action of a router. Returns a body of a response
+func upnpCall(controlURL, serviceType, action string, args [][2]string) ([]byte, error) {
+	body := bytes.NewBufferString(`<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:` + action + ` xmlns:u="` + serviceType + `">`)
+
+	for _, arg := range args {
+		body.WriteString("<" + arg[0] + ">")
+		xml.EscapeText(body, []byte(arg[1]))
+		body.WriteString("</" + arg[0] + ">")
+	}
+	body.WriteString(`</u:` + action + `></s:Body></s:Envelope>`)
+
+	req, err := http.NewRequest("POST", controlURL, body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+serviceType+"#"+action+`"`)
+
+	client := http.Client{Timeout: portMapTimeout}
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("UPnP %s failed: %s %s", action,
+			xmlValue(data, "errorCode"), xmlValue(data, "errorDescription")))
+	}
+	return data, nil
+}
+
+// Returns a text of first element with the name
+func xmlValue(data []byte, name string) string {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	for {
+		token, err := decoder.Token()
+
+		if err != nil {
+			return ""
+		}
+
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == name {
+			value := ""
+			decoder.DecodeElement(&value, &start)
+
+			return strings.TrimSpace(value)
+		}
+	}
+}
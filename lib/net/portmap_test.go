@@ -0,0 +1,144 @@
+package net
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNATPMP(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatalf("Listen error: %s", err.Error())
+	}
+	defer conn.Close()
+
+	defer func(port int) { natPMPPort = port }(natPMPPort)
+	natPMPPort = conn.LocalAddr().(*net.UDPAddr).Port
+
+	mapped := map[uint16]uint32{}
+	var lock sync.Mutex
+
+	go func() {
+		buf := make([]byte, 16)
+
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+
+			if err != nil {
+				return
+			}
+
+			response := make([]byte, 16)
+			response[1] = buf[1] + 128
+
+			if buf[1] == 0 && n == 2 {
+				copy(response[8:], net.ParseIP("203.0.113.5").To4())
+				conn.WriteTo(response[:12], addr)
+				continue
+			}
+
+			internal := binary.BigEndian.Uint16(buf[4:])
+			lifetime := binary.BigEndian.Uint32(buf[8:])
+
+			lock.Lock()
+			mapped[internal] = lifetime
+			lock.Unlock()
+
+			binary.BigEndian.PutUint16(response[8:], internal)
+			// the router gives other port
+			binary.BigEndian.PutUint16(response[10:], internal+1)
+			binary.BigEndian.PutUint32(response[12:], lifetime)
+			conn.WriteTo(response, addr)
+		}
+	}()
+
+	m, err := MapPort(PortMapConfig{Enabled: true, Method: PortMapNATPMP, Gateway: "127.0.0.1", Lifetime: 600}, 8765)
+
+	if err != nil {
+		t.Fatalf("Map error: %s", err.Error())
+	}
+
+	if m.Address().NodeAddrToString() != "203.0.113.5:8766" || m.Lifetime != 600*time.Second {
+		t.Fatalf("Mapped %s for %s", m.Address().NodeAddrToString(), m.Lifetime)
+	}
+
+	if err = m.Remove(); err != nil {
+		t.Fatalf("Remove error: %s", err.Error())
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if mapped[8765] != 0 {
+		t.Fatalf("Mapping is not removed")
+	}
+}
+
+func TestUPnP(t *testing.T) {
+	mappings := map[string]string{}
+
+	var server *httptest.Server
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/desc.xml" {
+			w.Write([]byte(`<?xml version="1.0"?><root><device><deviceList><device><deviceList><device><serviceList>` +
+				`<service><serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>` +
+				`<controlURL>/ctl/IPConn</controlURL></service></serviceList></device></deviceList></device></deviceList></device></root>`))
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		action := r.Header.Get("SOAPAction")
+
+		switch {
+		case r.URL.Path != "/ctl/IPConn":
+			w.WriteHeader(http.StatusNotFound)
+		case strings.HasSuffix(action, `#AddPortMapping"`):
+			if xmlValue(body, "NewLeaseDuration") != "0" {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(`<s:Envelope><s:Body><s:Fault><detail><UPnPError><errorCode>725</errorCode>` +
+					`<errorDescription>OnlyPermanentLeasesSupported</errorDescription></UPnPError></detail></s:Fault></s:Body></s:Envelope>`))
+				return
+			}
+			mappings[xmlValue(body, "NewExternalPort")] = xmlValue(body, "NewInternalClient") + ":" + xmlValue(body, "NewInternalPort")
+		case strings.HasSuffix(action, `#GetExternalIPAddress"`):
+			w.Write([]byte(`<s:Envelope><s:Body><u:GetExternalIPAddressResponse>` +
+				`<NewExternalIPAddress>198.51.100.7</NewExternalIPAddress></u:GetExternalIPAddressResponse></s:Body></s:Envelope>`))
+		case strings.HasSuffix(action, `#DeletePortMapping"`):
+			delete(mappings, xmlValue(body, "NewExternalPort"))
+		}
+	}))
+	defer server.Close()
+
+	m := &PortMapping{InternalPort: 8765, ExternalPort: 18765, Lifetime: time.Hour}
+
+	err := m.mapUPnPLocation(server.URL + "/desc.xml")
+
+	if err != nil {
+		t.Fatalf("Map error: %s", err.Error())
+	}
+
+	if m.Address().NodeAddrToString() != "198.51.100.7:18765" {
+		t.Fatalf("Mapped %s", m.Address().NodeAddrToString())
+	}
+
+	if mappings["18765"] != "127.0.0.1:8765" {
+		t.Fatalf("Mappings on the router %v", mappings)
+	}
+
+	if err = m.Renew(); err != nil {
+		t.Fatalf("Renew error: %s", err.Error())
+	}
+
+	if err = m.Remove(); err != nil || len(mappings) > 0 {
+		t.Fatalf("Remove error %v, mappings %v", err, mappings)
+	}
+}
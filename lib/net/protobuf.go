@@ -0,0 +1,554 @@
+package net
+
+/*
+* Protobuf format of payloads of commands. It is an option to gob, clients in other languages can use it and
+* it doesn't break when fields are added. Messages are encoded from same Com* structures, a number of a field
+* is its position in a structure starting from 1, or it is set with a tag `proto:"3"`. New fields must be added
+* only to the end of a structure, `proto:"-"` skips a field. A value that is not a structure (a list of nodes,
+* an ID) is encoded as field 1 of a message.
+* Payload starts with a byte of the version of the format, then a protobuf message follows.
+* A client marks a request with RequestFlagProtobuf, a node responds in same format. Older nodes don't know the flag,
+* so a client must use protobuf only with nodes which have it in WireFormats of the version command.
+* A node keeps formats of peers in PeerWireFormats and sends gob to peers which didn't tell formats.
+* Structures sent between nodes have tags on all fields, so a moved field keeps its number
+ */
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	WireFormatGob      = "gob"
+	WireFormatProtobuf = "protobuf"
+)
+
+// Version of protobuf messages. It is increased when fields are changed not compatible
+const ProtobufVersion byte = 1
+
+// Formats of payloads this node accepts. It is sent in the version command
+var WireFormats = []string{WireFormatGob, WireFormatProtobuf}
+
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+	protoWireFixed32 = 5
+)
+
+// Checks a format from config. Empty is gob
+func CheckWireFormat(format string) error {
+	if format == "" || format == WireFormatGob || format == WireFormatProtobuf {
+		return nil
+	}
+	return errors.New(fmt.Sprintf("Unknown wire format %s. Possible are %s and %s", format, WireFormatGob, WireFormatProtobuf))
+}
+
+// Formats of payloads of peers from their version commands. A peer not sent a version yet is an older node
+// for a client, it gets gob
+type PeerWireFormats struct {
+	lock  sync.RWMutex
+	peers map[string][]string
+}
+
+func NewPeerWireFormats() *PeerWireFormats {
+	return &PeerWireFormats{peers: map[string][]string{}}
+}
+
+// Remembers formats a peer accepts
+func (p *PeerWireFormats) Set(addr NodeAddr, formats []string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.peers[addr.NodeAddrToString()] = formats
+}
+
+// Returns the format to send to a peer. It is the preferred format if the peer accepts it, otherwise gob
+func (p *PeerWireFormats) Get(addr NodeAddr, preferred string) string {
+	if preferred != WireFormatProtobuf {
+		return WireFormatGob
+	}
+
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	for _, format := range p.peers[addr.NodeAddrToString()] {
+		if format == preferred {
+			return preferred
+		}
+	}
+	return WireFormatGob
+}
+
+// Encodes a payload of a command or response in a format
+func EncodePayload(format string, data interface{}) ([]byte, error) {
+	if format == WireFormatProtobuf {
+		return ProtobufEncode(data)
+	}
+	return GobEncode(data)
+}
+
+// Decodes a payload of a command or response in a format
+func DecodePayload(format string, data []byte, v interface{}) error {
+	if format == WireFormatProtobuf {
+		return ProtobufDecode(data, v)
+	}
+	return GobDecode(data, v)
+}
+
+// Encode structure to protobuf message with a version byte
+func ProtobufEncode(data interface{}) ([]byte, error) {
+	v := reflect.ValueOf(data)
+
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, errors.New("Can not encode nil value")
+		}
+		v = v.Elem()
+	}
+
+	result := []byte{ProtobufVersion}
+
+	var err error
+
+	if v.Kind() == reflect.Struct {
+		result, err = protoAppendMessage(result, v)
+	} else {
+		result, err = protoAppendField(result, 1, v, false)
+	}
+	return result, err
+}
+
+// Decode protobuf message with a version byte to a structure. Unknown fields are skipped
+func ProtobufDecode(data []byte, v interface{}) error {
+	if len(data) == 0 {
+		return errors.New("Empty protobuf payload")
+	}
+
+	if data[0] != ProtobufVersion {
+		return errors.New(fmt.Sprintf("Protobuf version %d is not supported, expected %d", data[0], ProtobufVersion))
+	}
+
+	rv := reflect.ValueOf(v)
+
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("Protobuf decode needs a pointer")
+	}
+	rv = rv.Elem()
+
+	if rv.Kind() == reflect.Struct {
+		return protoDecodeMessage(data[1:], rv)
+	}
+	return protoDecodeFields(data[1:], func(num int, wire int, value []byte, x uint64) error {
+		if num != 1 {
+			return nil
+		}
+		return protoDecodeValue(rv, wire, value, x)
+	})
+}
+
+// Returns number of a field in a message. 0 means the field is skipped
+func protoFieldNumber(f reflect.StructField, index int) (int, error) {
+	if f.PkgPath != "" {
+		// not exported
+		return 0, nil
+	}
+	tag := f.Tag.Get("proto")
+
+	if tag == "-" {
+		return 0, nil
+	}
+
+	if tag == "" {
+		return index + 1, nil
+	}
+	num, err := strconv.Atoi(strings.Split(tag, ",")[0])
+
+	if err != nil || num < 1 {
+		return 0, errors.New(fmt.Sprintf("Wrong proto tag of field %s", f.Name))
+	}
+	return num, nil
+}
+
+func protoAppendMessage(buf []byte, v reflect.Value) ([]byte, error) {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		num, err := protoFieldNumber(t.Field(i), i)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if num == 0 {
+			continue
+		}
+		buf, err = protoAppendField(buf, num, v.Field(i), true)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+func protoAppendKey(buf []byte, num int, wire int) []byte {
+	return protoAppendVarint(buf, uint64(num)<<3|uint64(wire))
+}
+
+func protoAppendVarint(buf []byte, x uint64) []byte {
+	bs := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(bs, x)
+
+	return append(buf, bs[:n]...)
+}
+
+func protoAppendBytes(buf []byte, num int, data []byte) []byte {
+	buf = protoAppendKey(buf, num, protoWireBytes)
+	buf = protoAppendVarint(buf, uint64(len(data)))
+
+	return append(buf, data...)
+}
+
+// Appends a field. Zero values are skipped as in proto3, but not elements of lists
+func protoAppendField(buf []byte, num int, v reflect.Value, skipZero bool) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return buf, nil
+		}
+		return protoAppendField(buf, num, v.Elem(), skipZero)
+
+	case reflect.Bool:
+		if v.Bool() || !skipZero {
+			x := uint64(0)
+
+			if v.Bool() {
+				x = 1
+			}
+			buf = protoAppendVarint(protoAppendKey(buf, num, protoWireVarint), x)
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Int() != 0 || !skipZero {
+			buf = protoAppendVarint(protoAppendKey(buf, num, protoWireVarint), uint64(v.Int()))
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() != 0 || !skipZero {
+			buf = protoAppendVarint(protoAppendKey(buf, num, protoWireVarint), v.Uint())
+		}
+
+	case reflect.Float64:
+		if v.Float() != 0 || !skipZero {
+			bs := make([]byte, 8)
+			binary.LittleEndian.PutUint64(bs, math.Float64bits(v.Float()))
+
+			buf = append(protoAppendKey(buf, num, protoWireFixed64), bs...)
+		}
+
+	case reflect.Float32:
+		if v.Float() != 0 || !skipZero {
+			bs := make([]byte, 4)
+			binary.LittleEndian.PutUint32(bs, math.Float32bits(float32(v.Float())))
+
+			buf = append(protoAppendKey(buf, num, protoWireFixed32), bs...)
+		}
+
+	case reflect.String:
+		if v.Len() > 0 || !skipZero {
+			buf = protoAppendBytes(buf, num, []byte(v.String()))
+		}
+
+	case reflect.Struct:
+		message, err := protoAppendMessage([]byte{}, v)
+
+		if err != nil {
+			return nil, err
+		}
+		buf = protoAppendBytes(buf, num, message)
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if v.Len() > 0 || !skipZero {
+				buf = protoAppendBytes(buf, num, v.Bytes())
+			}
+			break
+		}
+		// repeated field. every element has a key
+		var err error
+
+		for i := 0; i < v.Len(); i++ {
+			buf, err = protoAppendField(buf, num, v.Index(i), false)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+	case reflect.Map:
+		// map is repeated message with a key in field 1 and a value in field 2
+		for _, key := range v.MapKeys() {
+			entry, err := protoAppendField([]byte{}, 1, key, false)
+
+			if err != nil {
+				return nil, err
+			}
+			entry, err = protoAppendField(entry, 2, v.MapIndex(key), false)
+
+			if err != nil {
+				return nil, err
+			}
+			buf = protoAppendBytes(buf, num, entry)
+		}
+
+	default:
+		return nil, errors.New(fmt.Sprintf("Type %s can not be encoded to protobuf", v.Type().String()))
+	}
+	return buf, nil
+}
+
+// Calls a function for every field of a message. Value is set for length delimited and fixed fields, x for varint
+func protoDecodeFields(data []byte, f func(num int, wire int, value []byte, x uint64) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+
+		if n <= 0 {
+			return errors.New("Wrong protobuf field key")
+		}
+		data = data[n:]
+
+		num := int(key >> 3)
+		wire := int(key & 7)
+
+		var value []byte
+		var x uint64
+
+		switch wire {
+		case protoWireVarint:
+			x, n = binary.Uvarint(data)
+
+			if n <= 0 {
+				return errors.New("Wrong protobuf varint")
+			}
+			data = data[n:]
+
+		case protoWireFixed64, protoWireFixed32:
+			size := 8
+
+			if wire == protoWireFixed32 {
+				size = 4
+			}
+
+			if len(data) < size {
+				return errors.New("Protobuf message is cut")
+			}
+			value = data[:size]
+			data = data[size:]
+
+		case protoWireBytes:
+			length, n := binary.Uvarint(data)
+
+			if n <= 0 || uint64(len(data)-n) < length {
+				return errors.New("Protobuf message is cut")
+			}
+			value = data[n : n+int(length)]
+			data = data[n+int(length):]
+
+		default:
+			return errors.New(fmt.Sprintf("Protobuf wire type %d is not supported", wire))
+		}
+
+		err := f(num, wire, value, x)
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func protoDecodeMessage(data []byte, v reflect.Value) error {
+	t := v.Type()
+	fields := map[int]int{}
+
+	for i := 0; i < t.NumField(); i++ {
+		num, err := protoFieldNumber(t.Field(i), i)
+
+		if err != nil {
+			return err
+		}
+
+		if num > 0 {
+			fields[num] = i
+		}
+	}
+
+	return protoDecodeFields(data, func(num int, wire int, value []byte, x uint64) error {
+		i, ok := fields[num]
+
+		if !ok {
+			// field of newer version
+			return nil
+		}
+		err := protoDecodeValue(v.Field(i), wire, value, x)
+
+		if err != nil {
+			return errors.New(fmt.Sprintf("Field %s: %s", t.Field(i).Name, err.Error()))
+		}
+		return nil
+	})
+}
+
+func protoWrongWire(v reflect.Value, wire int) error {
+	return errors.New(fmt.Sprintf("Wire type %d can not be decoded to %s", wire, v.Type().String()))
+}
+
+// Decodes one value of a field. For a list it appends an element
+func protoDecodeValue(v reflect.Value, wire int, value []byte, x uint64) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return protoDecodeValue(v.Elem(), wire, value, x)
+
+	case reflect.Bool:
+		if wire != protoWireVarint {
+			return protoWrongWire(v, wire)
+		}
+		v.SetBool(x != 0)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if wire != protoWireVarint {
+			return protoWrongWire(v, wire)
+		}
+		v.SetInt(int64(x))
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if wire != protoWireVarint {
+			return protoWrongWire(v, wire)
+		}
+		v.SetUint(x)
+
+	case reflect.Float64, reflect.Float32:
+		if wire == protoWireFixed64 {
+			v.SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(value)))
+		} else if wire == protoWireFixed32 {
+			v.SetFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(value))))
+		} else {
+			return protoWrongWire(v, wire)
+		}
+
+	case reflect.String:
+		if wire != protoWireBytes {
+			return protoWrongWire(v, wire)
+		}
+		v.SetString(string(value))
+
+	case reflect.Struct:
+		if wire != protoWireBytes {
+			return protoWrongWire(v, wire)
+		}
+		return protoDecodeMessage(value, v)
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if wire != protoWireBytes {
+				return protoWrongWire(v, wire)
+			}
+			v.SetBytes(append([]byte{}, value...))
+			break
+		}
+		elemKind := v.Type().Elem().Kind()
+
+		if wire == protoWireBytes && elemKind != reflect.String && elemKind != reflect.Struct &&
+			elemKind != reflect.Slice && elemKind != reflect.Ptr && elemKind != reflect.Map {
+			// packed list of numbers, other languages send lists of numbers so
+			return protoDecodePacked(v, value)
+		}
+		elem := reflect.New(v.Type().Elem()).Elem()
+
+		err := protoDecodeValue(elem, wire, value, x)
+
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.Append(v, elem))
+
+	case reflect.Map:
+		if wire != protoWireBytes {
+			return protoWrongWire(v, wire)
+		}
+
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		key := reflect.New(v.Type().Key()).Elem()
+		elem := reflect.New(v.Type().Elem()).Elem()
+
+		err := protoDecodeFields(value, func(num int, wire int, value []byte, x uint64) error {
+			switch num {
+			case 1:
+				return protoDecodeValue(key, wire, value, x)
+			case 2:
+				return protoDecodeValue(elem, wire, value, x)
+			}
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+		v.SetMapIndex(key, elem)
+
+	default:
+		return errors.New(fmt.Sprintf("Type %s can not be decoded from protobuf", v.Type().String()))
+	}
+	return nil
+}
+
+func protoDecodePacked(v reflect.Value, data []byte) error {
+	for len(data) > 0 {
+		elem := reflect.New(v.Type().Elem()).Elem()
+
+		var err error
+
+		switch elem.Kind() {
+		case reflect.Float64:
+			if len(data) < 8 {
+				return errors.New("Protobuf packed list is cut")
+			}
+			err = protoDecodeValue(elem, protoWireFixed64, data[:8], 0)
+			data = data[8:]
+
+		case reflect.Float32:
+			if len(data) < 4 {
+				return errors.New("Protobuf packed list is cut")
+			}
+			err = protoDecodeValue(elem, protoWireFixed32, data[:4], 0)
+			data = data[4:]
+
+		default:
+			x, n := binary.Uvarint(data)
+
+			if n <= 0 {
+				return errors.New("Wrong protobuf varint")
+			}
+			err = protoDecodeValue(elem, protoWireVarint, nil, x)
+			data = data[n:]
+		}
+
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.Append(v, elem))
+	}
+	return nil
+}
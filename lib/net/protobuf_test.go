@@ -0,0 +1,158 @@
+package net
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type protoTestItem struct {
+	Name  string
+	Value float64
+}
+
+type protoTestMessage struct {
+	ID      int
+	Name    string
+	Data    []byte
+	List    [][]byte
+	Flags   []bool
+	Item    protoTestItem
+	Items   []protoTestItem
+	Values  map[string][]byte
+	Node    *NodeAddr
+	Skipped string `proto:"-"`
+	Height  int64  `proto:"20"`
+}
+
+// older version of the message
+type protoTestMessageOld struct {
+	ID   int
+	Name string
+}
+
+func TestProtobufWire(t *testing.T) {
+	// message from protobuf docs, field 1 is 150 and field 2 is "testing"
+	data, err := ProtobufEncode(protoTestMessageOld{ID: 150, Name: "testing"})
+
+	if err != nil {
+		t.Fatalf("Encode error: %s", err.Error())
+	}
+
+	expected := []byte{ProtobufVersion, 0x08, 0x96, 0x01, 0x12, 0x07, 't', 'e', 's', 't', 'i', 'n', 'g'}
+
+	if !bytes.Equal(data, expected) {
+		t.Fatalf("Got % x", data)
+	}
+
+	// version of the format is checked
+	data[0] = ProtobufVersion + 1
+
+	if ProtobufDecode(data, &protoTestMessageOld{}) == nil {
+		t.Fatalf("Unknown version is decoded")
+	}
+}
+
+func TestProtobufEncodeDecode(t *testing.T) {
+	message := protoTestMessage{
+		ID:      -5,
+		Name:    "node",
+		Data:    []byte{1, 2, 3},
+		List:    [][]byte{[]byte{1}, []byte{}, []byte{2}},
+		Flags:   []bool{true, false, true},
+		Item:    protoTestItem{"a", 1.5},
+		Items:   []protoTestItem{{"b", 2}, {"c", -3.25}},
+		Values:  map[string][]byte{"x": []byte{9}},
+		Node:    &NodeAddr{Host: "localhost", Port: 8765},
+		Skipped: "not sent",
+		Height:  1 << 40,
+	}
+
+	data, err := ProtobufEncode(&message)
+
+	if err != nil {
+		t.Fatalf("Encode error: %s", err.Error())
+	}
+
+	decoded := protoTestMessage{}
+
+	err = ProtobufDecode(data, &decoded)
+
+	if err != nil {
+		t.Fatalf("Decode error: %s", err.Error())
+	}
+
+	message.Skipped = ""
+
+	if !reflect.DeepEqual(message, decoded) {
+		t.Fatalf("Got %v, expected %v", decoded, message)
+	}
+
+	// older version skips new fields
+	old := protoTestMessageOld{}
+
+	err = ProtobufDecode(data, &old)
+
+	if err != nil || old.ID != -5 || old.Name != "node" {
+		t.Fatalf("Got %v, error %v", old, err)
+	}
+
+	// not a structure is field 1 of a message
+	nodes := []NodeAddr{{Host: "a", Port: 1}, {Host: "b", Port: 2}}
+
+	data, err = EncodePayload(WireFormatProtobuf, &nodes)
+
+	if err != nil {
+		t.Fatalf("Encode error: %s", err.Error())
+	}
+
+	decodedNodes := []NodeAddr{}
+
+	err = DecodePayload(WireFormatProtobuf, data, &decodedNodes)
+
+	if err != nil || !reflect.DeepEqual(nodes, decodedNodes) {
+		t.Fatalf("Got %v, error %v", decodedNodes, err)
+	}
+}
+
+func TestProtobufErrorResponse(t *testing.T) {
+	data, err := EncodeErrorResponseAs(WireFormatProtobuf, NewRemoteError(ErrorCodeNotFound, "Table is not found"))
+
+	if err != nil {
+		t.Fatalf("Encode error: %s", err.Error())
+	}
+
+	remote, ok := DecodeErrorResponseAs(WireFormatProtobuf, data).(*RemoteError)
+
+	if !ok || remote.Code != ErrorCodeNotFound || remote.Message != "Table is not found" {
+		t.Fatalf("Got wrong error %v", remote)
+	}
+}
+
+func TestPeerWireFormats(t *testing.T) {
+	formats := NewPeerWireFormats()
+
+	newNode := NodeAddr{Host: "a", Port: 1}
+	oldNode := NodeAddr{Host: "b", Port: 2}
+
+	formats.Set(newNode, WireFormats)
+	formats.Set(oldNode, nil)
+
+	tests := []struct {
+		addr      NodeAddr
+		preferred string
+		expected  string
+	}{
+		{newNode, WireFormatProtobuf, WireFormatProtobuf},
+		{newNode, "", WireFormatGob},
+		{oldNode, WireFormatProtobuf, WireFormatGob},
+		// version is not received yet
+		{NodeAddr{Host: "c", Port: 3}, WireFormatProtobuf, WireFormatGob},
+	}
+
+	for _, test := range tests {
+		if format := formats.Get(test.addr, test.preferred); format != test.expected {
+			t.Fatalf("Format for %s preferring %s is %s, expected %s", test.addr.NodeAddrToString(), test.preferred, format, test.expected)
+		}
+	}
+}
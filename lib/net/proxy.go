@@ -0,0 +1,233 @@
+package net
+
+/*
+* SOCKS5 proxy for connections to other nodes, for example Tor. When it is set, all connections to nodes go
+* through the proxy, names of hosts are resolved by the proxy, so .onion addresses work.
+* Connections to this machine and local sockets are direct. A node can be a hidden service, then it listens
+* only on loopback and Tor forwards connections to it
+ */
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gelembjuk/oursql/lib/utils"
+)
+
+type ProxyConfig struct {
+	// address of a SOCKS5 proxy, like 127.0.0.1:9050 for Tor. Empty means direct connections
+	Address string
+	// for a proxy with authentication
+	Username string
+	Password string
+	// the node is a hidden service. It listens only on loopback, its Host is a .onion address
+	HiddenService bool
+}
+
+var proxyConfig *ProxyConfig
+
+const (
+	socksVersion      byte = 5
+	socksNoAuth       byte = 0
+	socksPasswordAuth byte = 2
+	socksConnect      byte = 1
+	socksIPv4         byte = 1
+	socksDomain       byte = 3
+	socksIPv6         byte = 4
+)
+
+var socksReplies = map[byte]string{
+	1: "general failure",
+	2: "connection not allowed",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// Sets a proxy for all connections of this process. Has no effect when the address is empty and it is not a hidden service
+func InitProxy(config ProxyConfig, logger *utils.LoggerMan) error {
+	proxyConfig = nil
+
+	if config.Address == "" && !config.HiddenService {
+		return nil
+	}
+
+	if config.Address != "" {
+		if _, _, err := net.SplitHostPort(config.Address); err != nil {
+			return errors.New(fmt.Sprintf("Wrong address of a proxy %s: %s", config.Address, err.Error()))
+		}
+	}
+
+	if len(config.Username) > 255 || len(config.Password) > 255 {
+		return errors.New("Username and password of a proxy must be shorter than 256 bytes")
+	}
+
+	proxyConfig = &config
+
+	if logger != nil && config.Address != "" {
+		logger.Trace.Printf("Connections of nodes go through a proxy %s", config.Address)
+	}
+	return nil
+}
+
+// Address to listen. A hidden service accepts connections only from this machine
+func listenAddress(port int) string {
+	if proxyConfig != nil && proxyConfig.HiddenService {
+		return "127.0.0.1:" + strconv.Itoa(port)
+	}
+	return ":" + strconv.Itoa(port)
+}
+
+// Connects to a host directly or through a proxy
+func dialTCP(ctx context.Context, dialer *net.Dialer, addr NodeAddr) (net.Conn, error) {
+	if proxyConfig == nil || proxyConfig.Address == "" || isLoopbackHost(addr.hostName()) {
+		if strings.HasSuffix(addr.Host, ".onion") {
+			return nil, errors.New(fmt.Sprintf("Address %s can be reached only with a proxy", addr.NodeAddrToString()))
+		}
+		return dialHost(ctx, dialer, addr)
+	}
+
+	conn, err := dialer.DialContext(ctx, Protocol, proxyConfig.Address)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Can not connect to proxy %s: %s", proxyConfig.Address, err.Error()))
+	}
+
+	if d, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(d)
+	} else if dialer.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(dialer.Timeout))
+	}
+
+	err = socksHandshake(conn, proxyConfig, addr)
+
+	if err != nil {
+		conn.Close()
+		return nil, errors.New(fmt.Sprintf("Proxy can not connect to %s: %s", addr.NodeAddrToString(), err.Error()))
+	}
+	conn.SetDeadline(time.Time{})
+
+	return conn, nil
+}
+
+// Asks a proxy to connect to a node. RFC 1928, authentication of RFC 1929
+func socksHandshake(conn io.ReadWriter, config *ProxyConfig, addr NodeAddr) error {
+	methods := []byte{socksNoAuth}
+
+	if config.Username != "" {
+		methods = append(methods, socksPasswordAuth)
+	}
+
+	_, err := conn.Write(append([]byte{socksVersion, byte(len(methods))}, methods...))
+
+	if err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+
+	if _, err = io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+
+	if reply[0] != socksVersion {
+		return errors.New(fmt.Sprintf("Proxy is not SOCKS5, version %d", reply[0]))
+	}
+
+	switch reply[1] {
+	case socksNoAuth:
+	case socksPasswordAuth:
+		if config.Username == "" {
+			return errors.New("Proxy requires a username and a password")
+		}
+		auth := []byte{1, byte(len(config.Username))}
+		auth = append(auth, config.Username...)
+		auth = append(auth, byte(len(config.Password)))
+		auth = append(auth, config.Password...)
+
+		if _, err = conn.Write(auth); err != nil {
+			return err
+		}
+
+		if _, err = io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+
+		if reply[1] != 0 {
+			return errors.New("Proxy didn't accept the username and the password")
+		}
+	default:
+		return errors.New("Proxy doesn't accept authentication methods of the node")
+	}
+
+	request := []byte{socksVersion, socksConnect, 0}
+
+	host := addr.hostName()
+
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		request = append(request, socksIPv4)
+		request = append(request, ip.To4()...)
+	} else if ip != nil {
+		request = append(request, socksIPv6)
+		request = append(request, ip.To16()...)
+	} else {
+		if len(host) > 255 {
+			return errors.New("Host name is too long")
+		}
+		request = append(request, socksDomain, byte(len(host)))
+		request = append(request, host...)
+	}
+
+	port := make([]byte, 2)
+	binary.BigEndian.PutUint16(port, uint16(addr.Port))
+
+	if _, err = conn.Write(append(request, port...)); err != nil {
+		return err
+	}
+
+	header := make([]byte, 4)
+
+	if _, err = io.ReadFull(conn, header); err != nil {
+		return err
+	}
+
+	if header[1] != 0 {
+		message, ok := socksReplies[header[1]]
+
+		if !ok {
+			message = fmt.Sprintf("error %d", header[1])
+		}
+		return errors.New(message)
+	}
+
+	// bound address of the proxy is not used
+	length := 0
+
+	switch header[3] {
+	case socksIPv4:
+		length = 4
+	case socksIPv6:
+		length = 16
+	case socksDomain:
+		if _, err = io.ReadFull(conn, reply[:1]); err != nil {
+			return err
+		}
+		length = int(reply[0])
+	default:
+		return errors.New(fmt.Sprintf("Unknown address type %d in a reply of proxy", header[3]))
+	}
+
+	_, err = io.ReadFull(conn, make([]byte, length+2))
+
+	return err
+}
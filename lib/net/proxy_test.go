@@ -0,0 +1,138 @@
+package net
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// Accepts one SOCKS5 connection with a password and connects it to the target. Requested host is sent to the channel
+func runTestProxy(ln net.Listener, target string, hosts chan string) {
+	conn, err := ln.Accept()
+
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 512)
+
+	io.ReadFull(conn, buf[:2])
+	io.ReadFull(conn, buf[:buf[1]])
+	conn.Write([]byte{5, 2})
+
+	// username and password
+	io.ReadFull(conn, buf[:2])
+	user := make([]byte, buf[1])
+	io.ReadFull(conn, user)
+	io.ReadFull(conn, buf[:1])
+	password := make([]byte, buf[0])
+	io.ReadFull(conn, password)
+
+	if string(user) != "user" || string(password) != "secret" {
+		conn.Write([]byte{1, 1})
+		return
+	}
+	conn.Write([]byte{1, 0})
+
+	io.ReadFull(conn, buf[:5])
+	host := make([]byte, buf[4])
+	io.ReadFull(conn, host)
+	io.ReadFull(conn, buf[:2])
+
+	hosts <- string(host)
+
+	dest, err := net.Dial("tcp", target)
+
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer dest.Close()
+
+	conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+
+	go io.Copy(dest, conn)
+	io.Copy(conn, dest)
+}
+
+func TestProxy(t *testing.T) {
+	defer InitProxy(ProxyConfig{}, nil)
+
+	target, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer target.Close()
+
+	go func() {
+		conn, err := target.Accept()
+
+		if err == nil {
+			conn.Write([]byte("hello"))
+			conn.Close()
+		}
+	}()
+
+	proxy, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer proxy.Close()
+
+	hosts := make(chan string, 1)
+
+	go runTestProxy(proxy, target.Addr().String(), hosts)
+
+	addr := NodeAddr{Host: "abcdefghijklmnop.onion", Port: 8765}
+
+	_, err := Dial(addr, time.Second)
+
+	if err == nil {
+		t.Fatalf("Onion address is connected without a proxy")
+	}
+
+	err = InitProxy(ProxyConfig{Address: proxy.Addr().String(), Username: "user", Password: "secret"}, nil)
+
+	if err != nil {
+		t.Fatalf("Init error: %s", err.Error())
+	}
+
+	conn, err := Dial(addr, time.Second)
+
+	if err != nil {
+		t.Fatalf("Dial error: %s", err.Error())
+	}
+	defer conn.Close()
+
+	if host := <-hosts; host != addr.Host {
+		t.Fatalf("Proxy got host %s", host)
+	}
+
+	data, _ := io.ReadAll(conn)
+
+	if string(data) != "hello" {
+		t.Fatalf("Got %s", data)
+	}
+
+	// wrong password
+	go runTestProxy(proxy, target.Addr().String(), hosts)
+
+	InitProxy(ProxyConfig{Address: proxy.Addr().String(), Username: "user", Password: "wrong"}, nil)
+
+	if _, err = Dial(addr, time.Second); err == nil {
+		t.Fatalf("Connected with a wrong password")
+	}
+}
+
+func TestProxyHiddenService(t *testing.T) {
+	defer InitProxy(ProxyConfig{}, nil)
+
+	InitProxy(ProxyConfig{HiddenService: true}, nil)
+
+	ln, err := Listen(0)
+
+	if err != nil {
+		t.Fatalf("Listen error: %s", err.Error())
+	}
+	defer ln.Close()
+
+	if ip := ln.Addr().(*net.TCPAddr).IP; !ip.IsLoopback() {
+		t.Fatalf("Hidden service listens on %s", ip)
+	}
+}
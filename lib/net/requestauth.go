@@ -0,0 +1,97 @@
+package net
+
+/*
+* Signed management requests. The auth string of a node is not sent, a client sends HMAC-SHA256 of a command,
+* a payload, a time and a random nonce, the auth string is the key. A node accepts a signature only once and only
+* if its time is close to the time of the node, so a request can not be replayed.
+* The signature goes in extra data of a request after flags, with RequestFlagSigned
+ */
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Time, nonce and HMAC
+const RequestSignatureLength = 8 + 16 + sha256.Size
+
+// How far a time of a request can be from the time of a node
+var RequestSignatureWindow = 5 * time.Minute
+
+// Remembers nonces of accepted requests while their time is in the window
+type RequestVerifier struct {
+	lock   sync.Mutex
+	nonces map[string]time.Time
+}
+
+func requestMAC(secret string, command string, payload []byte, stamp []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(CommandToBytes(command))
+	mac.Write(payload)
+	mac.Write(stamp)
+
+	return mac.Sum(nil)
+}
+
+// Signs a request with a secret. Every call makes new signature
+func SignRequest(secret string, command string, payload []byte) []byte {
+	stamp := make([]byte, 24)
+	binary.LittleEndian.PutUint64(stamp, uint64(time.Now().Unix()))
+	rand.Read(stamp[8:])
+
+	return append(stamp, requestMAC(secret, command, payload, stamp)...)
+}
+
+func NewRequestVerifier() *RequestVerifier {
+	return &RequestVerifier{nonces: map[string]time.Time{}}
+}
+
+// Checks a signature of a request. A signature which was already accepted is an error
+func (v *RequestVerifier) Verify(secret string, command string, payload []byte, signature []byte) error {
+	if secret == "" {
+		return errors.New("Node has no auth string")
+	}
+
+	if len(signature) != RequestSignatureLength {
+		return errors.New("Request is not signed")
+	}
+
+	stamp := signature[:24]
+
+	signed := time.Unix(int64(binary.LittleEndian.Uint64(stamp)), 0)
+
+	if d := time.Since(signed); d > RequestSignatureWindow || d < -RequestSignatureWindow {
+		return errors.New(fmt.Sprintf("Time of a request %s is too far", signed.Format(time.RFC3339)))
+	}
+
+	if !hmac.Equal(signature[24:], requestMAC(secret, command, payload, stamp)) {
+		return errors.New("Wrong signature of a request")
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	nonce := string(stamp[8:])
+
+	if _, ok := v.nonces[nonce]; ok {
+		return errors.New("Request was already received")
+	}
+
+	now := time.Now()
+
+	for n, expires := range v.nonces {
+		if expires.Before(now) {
+			delete(v.nonces, n)
+		}
+	}
+	// a nonce is kept till its request is too old to be accepted
+	v.nonces[nonce] = signed.Add(RequestSignatureWindow)
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package net
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestRequestSignature(t *testing.T) {
+	verifier := NewRequestVerifier()
+
+	payload := []byte("payload")
+
+	signature := SignRequest("secret", "getstate", payload)
+
+	err := verifier.Verify("secret", "getstate", payload, signature)
+
+	if err != nil {
+		t.Fatalf("Signature is not accepted: %s", err.Error())
+	}
+
+	if verifier.Verify("secret", "getstate", payload, signature) == nil {
+		t.Fatalf("Replayed request is accepted")
+	}
+
+	signature = SignRequest("secret", "getstate", payload)
+
+	if verifier.Verify("other", "getstate", payload, signature) == nil {
+		t.Fatalf("Signature with other secret is accepted")
+	}
+
+	if verifier.Verify("secret", "addnode", payload, signature) == nil {
+		t.Fatalf("Signature of other command is accepted")
+	}
+
+	if verifier.Verify("secret", "getstate", []byte("changed"), signature) == nil {
+		t.Fatalf("Signature of other payload is accepted")
+	}
+
+	// old request with correct HMAC
+	stamp := make([]byte, 24)
+	binary.LittleEndian.PutUint64(stamp, uint64(time.Now().Add(-2*RequestSignatureWindow).Unix()))
+
+	signature = append(stamp, requestMAC("secret", "getstate", payload, stamp)...)
+
+	if verifier.Verify("secret", "getstate", payload, signature) == nil {
+		t.Fatalf("Old request is accepted")
+	}
+}
@@ -0,0 +1,63 @@
+package net
+
+/*
+* Limit of expensive requests of peers, like checksums of all rows of a table or a snapshot of the DB.
+* A host can do Count requests of a kind in Period seconds, other requests are refused. Peers are known by IP
+ */
+
+import (
+	"sync"
+	"time"
+)
+
+type RequestLimiter struct {
+	count  int
+	period int64
+	lock   sync.Mutex
+	// times of last requests of each host
+	hosts map[string][]int64
+}
+
+func NewRequestLimiter(count int, period int) *RequestLimiter {
+	return &RequestLimiter{count: count, period: int64(period), hosts: map[string][]int64{}}
+}
+
+// Counts a request of a host. Returns false if the host did too many requests. Local requests have no host,
+// they are not limited
+func (l *RequestLimiter) Allow(host string) bool {
+	if host == "" {
+		return true
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now().Unix()
+
+	if len(l.hosts) > 10000 {
+		l.forget(now)
+	}
+
+	times := l.hosts[host]
+
+	for len(times) > 0 && times[0] <= now-l.period {
+		times = times[1:]
+	}
+
+	if len(times) >= l.count {
+		l.hosts[host] = times
+		return false
+	}
+	l.hosts[host] = append(times, now)
+
+	return true
+}
+
+// Removes hosts without requests in the period, the map can not grow forever
+func (l *RequestLimiter) forget(now int64) {
+	for host, times := range l.hosts {
+		if len(times) == 0 || times[len(times)-1] <= now-l.period {
+			delete(l.hosts, host)
+		}
+	}
+}
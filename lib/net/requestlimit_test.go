@@ -0,0 +1,41 @@
+package net
+
+import (
+	"testing"
+)
+
+func TestRequestLimiter(t *testing.T) {
+	limiter := NewRequestLimiter(2, 60)
+
+	for i := 0; i < 2; i++ {
+		if !limiter.Allow("10.0.0.1") {
+			t.Fatalf("Request %d is refused", i+1)
+		}
+	}
+
+	if limiter.Allow("10.0.0.1") {
+		t.Fatalf("Request over the limit is allowed")
+	}
+
+	// other hosts have own limits, local requests are not limited
+	if !limiter.Allow("10.0.0.2") {
+		t.Fatalf("Request of other host is refused")
+	}
+
+	for i := 0; i < 5; i++ {
+		if !limiter.Allow("") {
+			t.Fatalf("Local request is refused")
+		}
+	}
+
+	// requests older than the period are not counted
+	limiter.hosts["10.0.0.1"] = []int64{1, 2}
+
+	if !limiter.Allow("10.0.0.1") {
+		t.Fatalf("Request after the period is refused")
+	}
+
+	if len(limiter.hosts["10.0.0.1"]) != 1 {
+		t.Fatalf("Old requests are kept: %v", limiter.hosts["10.0.0.1"])
+	}
+}
@@ -0,0 +1,194 @@
+package net
+
+/*
+* Streamed responses. A node sends a response in chunks while it is prepared, so big responses like a list of
+* blocks are not kept in memory on both sides. After the status byte every chunk has a kind byte and 4 bytes of
+* a length. The stream is complete with an end chunk, an error chunk means the node failed while streaming.
+* A client asks for it with RequestFlagStreamResponse, the flag is used only with commands which stream.
+* With RequestFlagChecksum the status is ResponseStreamChecked and every chunk has a checksum after the length
+ */
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	ResponseStream        byte = 4
+	ResponseStreamChecked byte = 7
+)
+
+const (
+	streamChunkEnd   byte = 0
+	streamChunkData  byte = 1
+	streamChunkError byte = 2
+)
+
+// Longest chunk a client accepts
+const MaxStreamChunkSize = 64 << 20
+
+type StreamWriter struct {
+	w        io.Writer
+	started  bool
+	checksum bool
+}
+
+type StreamReader struct {
+	r   io.Reader
+	buf []byte
+	// longest chunk. 0 means MaxStreamChunkSize
+	max      int64
+	checksum bool
+}
+
+// A node failed while streaming. Payload is an error response
+type StreamFailedError struct {
+	Payload []byte
+}
+
+func (e *StreamFailedError) Error() string {
+	return "Node failed while streaming a response"
+}
+
+func NewStreamWriter(w io.Writer) *StreamWriter {
+	return &StreamWriter{w: w}
+}
+
+// Same as NewStreamWriter, every chunk has a checksum
+func NewCheckedStreamWriter(w io.Writer) *StreamWriter {
+	return &StreamWriter{w: w, checksum: true}
+}
+
+// Returns true if the status is sent. An error can not be sent as a usual response then
+func (s *StreamWriter) Started() bool {
+	return s.started
+}
+
+func (s *StreamWriter) writeChunk(kind byte, data []byte) error {
+	header := []byte{}
+
+	if !s.started {
+		if s.checksum {
+			header = append(header, ResponseStreamChecked)
+		} else {
+			header = append(header, ResponseStream)
+		}
+		s.started = true
+	}
+
+	bs := make([]byte, 4)
+	binary.LittleEndian.PutUint32(bs, uint32(len(data)))
+
+	header = append(header, kind)
+	header = append(header, bs...)
+
+	if s.checksum {
+		binary.LittleEndian.PutUint32(bs, crc32.Checksum(data, checksumTable))
+		header = append(header, bs...)
+	}
+
+	_, err := s.w.Write(header)
+
+	if err != nil || len(data) == 0 {
+		return err
+	}
+
+	_, err = s.w.Write(data)
+
+	return err
+}
+
+// Sends a chunk of data
+func (s *StreamWriter) WriteChunk(data []byte) error {
+	return s.writeChunk(streamChunkData, data)
+}
+
+// Completes the stream
+func (s *StreamWriter) End() error {
+	return s.writeChunk(streamChunkEnd, nil)
+}
+
+// Completes the stream with an error. Payload is an error response
+func (s *StreamWriter) Fail(payload []byte) error {
+	return s.writeChunk(streamChunkError, payload)
+}
+
+// Reads next chunk. io.EOF means the stream is complete.
+// isError means the node failed while streaming, data is an error response then
+func (s *StreamReader) Next() (data []byte, isError bool, err error) {
+	header := make([]byte, 5)
+
+	if s.checksum {
+		header = make([]byte, 9)
+	}
+
+	_, err = io.ReadFull(s.r, header)
+
+	if err != nil {
+		if err == io.EOF {
+			// the connection is closed before the end chunk
+			err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+
+	length := binary.LittleEndian.Uint32(header[1:])
+
+	max := s.max
+
+	if max <= 0 || max > MaxStreamChunkSize {
+		max = MaxStreamChunkSize
+	}
+
+	if int64(length) > max {
+		err = NewResponseTooLargeError(fmt.Sprintf("Chunk of %d bytes, limit is %d", length, max))
+		return
+	}
+
+	if s.checksum {
+		data, err = readChecked(s.r, int64(length), binary.LittleEndian.Uint32(header[5:]))
+	} else {
+		data = make([]byte, length)
+
+		_, err = io.ReadFull(s.r, data)
+	}
+
+	if err != nil {
+		return
+	}
+
+	switch header[0] {
+	case streamChunkEnd:
+		err = io.EOF
+	case streamChunkData:
+	case streamChunkError:
+		isError = true
+	default:
+		err = errors.New(fmt.Sprintf("Unknown kind of a chunk %d", header[0]))
+	}
+	return
+}
+
+// Reads data of all chunks as one stream. It is not mixed with Next
+func (s *StreamReader) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		data, isError, err := s.Next()
+
+		if err != nil {
+			return 0, err
+		}
+
+		if isError {
+			return 0, &StreamFailedError{data}
+		}
+		s.buf = data
+	}
+
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+
+	return n, nil
+}
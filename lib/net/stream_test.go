@@ -0,0 +1,69 @@
+package net
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestStreamResponse(t *testing.T) {
+	buff := new(bytes.Buffer)
+
+	stream := NewStreamWriter(buff)
+
+	if stream.Started() {
+		t.Fatalf("Stream is started before a chunk")
+	}
+
+	stream.WriteChunk([]byte("block1"))
+	stream.WriteChunk([]byte("block2"))
+	stream.End()
+
+	success, payload, err := ReadResponse(buff)
+
+	reader, ok := payload.(*StreamReader)
+
+	if err != nil || !success || !ok {
+		t.Fatalf("Read error %v, success %v, stream %v", err, success, ok)
+	}
+
+	for _, expected := range []string{"block1", "block2"} {
+		data, isError, err := reader.Next()
+
+		if err != nil || isError || string(data) != expected {
+			t.Fatalf("Got %s, error %v", data, err)
+		}
+	}
+
+	if _, _, err = reader.Next(); err != io.EOF {
+		t.Fatalf("Stream is not complete, error %v", err)
+	}
+
+	// node fails after a chunk
+	buff = new(bytes.Buffer)
+
+	stream = NewStreamWriter(buff)
+	stream.WriteChunk([]byte("block1"))
+	stream.Fail([]byte("error"))
+
+	_, payload, _ = ReadResponse(buff)
+
+	data, err := ioutil.ReadAll(payload)
+
+	if _, ok := err.(*StreamFailedError); !ok || string(data) != "block1" {
+		t.Fatalf("Got %s, error %v", data, err)
+	}
+
+	// connection is closed before the end
+	buff = new(bytes.Buffer)
+
+	stream = NewStreamWriter(buff)
+	stream.WriteChunk([]byte("block1"))
+
+	_, payload, _ = ReadResponse(buff)
+
+	if _, err = ioutil.ReadAll(payload); err != io.ErrUnexpectedEOF {
+		t.Fatalf("Got error %v", err)
+	}
+}
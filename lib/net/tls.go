@@ -0,0 +1,247 @@
+package net
+
+/*
+* TLS for connections of nodes. When it is enabled, a node accepts only TLS connections and connects to other
+* nodes with TLS, so blocks, transactions and the auth string are not sent in cleartext.
+* All nodes of a network must have it enabled. Certificates of other nodes are verified with a CA from config
+* or system CAs. For connections to this machine (localhost) only the CA is checked, not a name, because
+* a certificate is for an external name.
+* Management commands can require a client certificate of an operator, signed by a separate CA. Then the auth
+* string is not accepted for them
+ */
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"github.com/gelembjuk/oursql/lib/utils"
+)
+
+type TLSConfig struct {
+	Enabled bool
+	// certificate and key of this node. They are needed to accept connections, a wallet can connect without them
+	CertFile string
+	KeyFile  string
+	// CA to verify certificates of other nodes. Empty means system CAs
+	CAFile string
+	// don't verify certificates of other nodes. Only for tests with self-signed certificates
+	SkipVerify bool
+	// CA of operators. If it is set, management commands are accepted only with a client certificate signed by it
+	ManageCAFile string
+	// certificate and key of an operator, they are sent only with management commands
+	ManageCertFile string
+	ManageKeyFile  string
+}
+
+var serverTLS *tls.Config
+var clientTLS *tls.Config
+
+// config of connections with management commands, it has a certificate of an operator
+var manageTLS *tls.Config
+var manageCertRequired bool
+
+type manageContextKey struct{}
+
+// Enables TLS for all connections of this process. Has no effect when it is not enabled in the config
+func InitTLS(config TLSConfig, logger *utils.LoggerMan) error {
+	serverTLS = nil
+	clientTLS = nil
+	manageTLS = nil
+	manageCertRequired = false
+
+	if !config.Enabled {
+		return nil
+	}
+
+	client := &tls.Config{MinVersion: tls.VersionTLS12}
+	client.InsecureSkipVerify = config.SkipVerify
+
+	if config.CAFile != "" {
+		pem, err := ioutil.ReadFile(config.CAFile)
+
+		if err != nil {
+			return err
+		}
+
+		rootCertPool := x509.NewCertPool()
+
+		if !rootCertPool.AppendCertsFromPEM(pem) {
+			return errors.New(fmt.Sprintf("Can not add CA certificate from %s", config.CAFile))
+		}
+		client.RootCAs = rootCertPool
+	}
+
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+
+		if err != nil {
+			return err
+		}
+		serverTLS = &tls.Config{MinVersion: tls.VersionTLS12}
+		serverTLS.Certificates = []tls.Certificate{cert}
+	}
+
+	if config.ManageCAFile != "" {
+		if serverTLS == nil {
+			return errors.New("CA of operators is set but certificate and key of the node are not set")
+		}
+
+		pem, err := ioutil.ReadFile(config.ManageCAFile)
+
+		if err != nil {
+			return err
+		}
+
+		manageCertPool := x509.NewCertPool()
+
+		if !manageCertPool.AppendCertsFromPEM(pem) {
+			return errors.New(fmt.Sprintf("Can not add CA certificate from %s", config.ManageCAFile))
+		}
+		// other nodes and wallets connect without a certificate
+		serverTLS.ClientCAs = manageCertPool
+		serverTLS.ClientAuth = tls.VerifyClientCertIfGiven
+
+		manageCertRequired = true
+	}
+
+	if config.ManageCertFile != "" || config.ManageKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.ManageCertFile, config.ManageKeyFile)
+
+		if err != nil {
+			return err
+		}
+		manageTLS = client.Clone()
+		manageTLS.Certificates = []tls.Certificate{cert}
+	}
+
+	clientTLS = client
+
+	if logger != nil {
+		logger.Trace.Printf("TLS is enabled for connections of nodes")
+	}
+	return nil
+}
+
+// Wraps a listener in TLS if it is enabled and this node has a certificate
+func listenTLS(ln net.Listener) (net.Listener, error) {
+	if clientTLS == nil {
+		return ln, nil
+	}
+
+	if serverTLS == nil {
+		ln.Close()
+		return nil, errors.New("TLS is enabled but certificate and key of the node are not set")
+	}
+	return tls.NewListener(ln, serverTLS), nil
+}
+
+// Returns a context of a connection for management commands. A certificate of an operator is sent on it if it is set
+func WithManageCertificate(ctx context.Context) context.Context {
+	return context.WithValue(ctx, manageContextKey{}, true)
+}
+
+// Returns true if management commands are accepted only with a certificate of an operator
+func ManageCertificateRequired() bool {
+	return manageCertRequired
+}
+
+// Returns true if a client of the connection has a certificate of an operator
+func HasManageCertificate(conn net.Conn) bool {
+	for conn != nil {
+		if tlsConn, ok := conn.(*tls.Conn); ok {
+			// only a certificate signed by the CA of operators is verified
+			return len(tlsConn.ConnectionState().VerifiedChains) > 0
+		}
+
+		wrapper, ok := conn.(interface{ NetConn() net.Conn })
+
+		if !ok {
+			break
+		}
+		conn = wrapper.NetConn()
+	}
+	return false
+}
+
+// Does TLS handshake on a connection to a node. The connection is closed if it fails
+func dialTLS(ctx context.Context, conn net.Conn, timeout time.Duration, addr NodeAddr) (net.Conn, error) {
+	config := clientTLS.Clone()
+
+	if manageTLS != nil && ctx.Value(manageContextKey{}) != nil {
+		config = manageTLS.Clone()
+	}
+
+	if config.ServerName == "" {
+		config.ServerName = addr.hostName()
+	}
+
+	if isLoopbackHost(addr.hostName()) && !config.InsecureSkipVerify {
+		// it is this machine, usually a command to own server
+		roots := config.RootCAs
+
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyCertificateChain(rawCerts, roots)
+		}
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	tlsConn := tls.Client(conn, config)
+
+	err := tlsConn.HandshakeContext(ctx)
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// Verifies certificates of a server are signed by a CA, a name is not checked
+func verifyCertificateChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return errors.New("Server didn't send a certificate")
+	}
+
+	certs := []*x509.Certificate{}
+
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+
+		if err != nil {
+			return err
+		}
+		certs = append(certs, cert)
+	}
+
+	intermediates := x509.NewCertPool()
+
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+
+	return err
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
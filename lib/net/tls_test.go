@@ -0,0 +1,207 @@
+package net
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Writes a self signed certificate and a key to files
+func writeTestCertificate(t *testing.T, dir string, name string) (string, string) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatalf("Certificate error: %s", err.Error())
+	}
+
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+
+	return certFile, keyFile
+}
+
+func TestTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oursqltls")
+
+	if err != nil {
+		t.Fatalf("Temp dir error: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	defer InitTLS(TLSConfig{}, nil)
+
+	certFile, keyFile := writeTestCertificate(t, dir, "node1.example")
+	otherCert, _ := writeTestCertificate(t, dir, "other.example")
+
+	err = InitTLS(TLSConfig{Enabled: true, CertFile: certFile, KeyFile: keyFile, CAFile: certFile}, nil)
+
+	if err != nil {
+		t.Fatalf("Init error: %s", err.Error())
+	}
+
+	ln, err := Listen(0)
+
+	if err != nil {
+		t.Fatalf("Listen error: %s", err.Error())
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("ok"))
+			conn.Close()
+		}
+	}()
+
+	port := ln.Addr().String()[strings.LastIndex(ln.Addr().String(), ":")+1:]
+
+	addr := NodeAddr{}
+	addr.LoadFromString("127.0.0.1:" + port)
+
+	conn, err := Dial(addr, time.Second)
+
+	if err != nil {
+		t.Fatalf("Dial error: %s", err.Error())
+	}
+
+	data, _ := ioutil.ReadAll(conn)
+	conn.Close()
+
+	if string(data) != "ok" {
+		t.Fatalf("Got %s", data)
+	}
+
+	// certificate of the server is not signed by this CA
+	InitTLS(TLSConfig{Enabled: true, CAFile: otherCert}, nil)
+
+	if conn, err = Dial(addr, time.Second); err == nil {
+		conn.Close()
+		t.Fatalf("Connected to a server with not trusted certificate")
+	}
+}
+
+func TestManageCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oursqltls")
+
+	if err != nil {
+		t.Fatalf("Temp dir error: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	defer InitTLS(TLSConfig{}, nil)
+
+	certFile, keyFile := writeTestCertificate(t, dir, "node1.example")
+	operatorCert, operatorKey := writeTestCertificate(t, dir, "operator")
+	otherCert, otherKey := writeTestCertificate(t, dir, "other")
+
+	config := TLSConfig{Enabled: true, CertFile: certFile, KeyFile: keyFile, CAFile: certFile,
+		ManageCAFile: operatorCert, ManageCertFile: operatorCert, ManageKeyFile: operatorKey}
+
+	err = InitTLS(config, nil)
+
+	if err != nil {
+		t.Fatalf("Init error: %s", err.Error())
+	}
+
+	if !ManageCertificateRequired() {
+		t.Fatalf("Certificate of operator is not required")
+	}
+
+	ln, err := Listen(0)
+
+	if err != nil {
+		t.Fatalf("Listen error: %s", err.Error())
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+
+			if err != nil {
+				return
+			}
+			// wrappers of a connection are skipped
+			conn = WithDeadlines(WrapConn(conn), ConnTimeouts{})
+
+			if _, err = conn.Read(make([]byte, 1)); err == nil {
+				if HasManageCertificate(conn) {
+					conn.Write([]byte("manage"))
+				} else {
+					conn.Write([]byte("node"))
+				}
+			}
+			conn.Close()
+		}
+	}()
+
+	port := ln.Addr().String()[strings.LastIndex(ln.Addr().String(), ":")+1:]
+
+	addr := NodeAddr{}
+	addr.LoadFromString("127.0.0.1:" + port)
+
+	request := func(ctx context.Context) string {
+		conn, err := DialContext(ctx, addr, time.Second)
+
+		if err != nil {
+			return err.Error()
+		}
+		defer conn.Close()
+
+		conn.Write([]byte{1})
+
+		data, _ := ioutil.ReadAll(conn)
+
+		return string(data)
+	}
+
+	if res := request(context.Background()); res != "node" {
+		t.Fatalf("Connection without certificate got %s", res)
+	}
+
+	if res := request(WithManageCertificate(context.Background())); res != "manage" {
+		t.Fatalf("Connection with certificate of operator got %s", res)
+	}
+
+	// the listener keeps a config with the CA of operators
+	config.ManageCertFile = otherCert
+	config.ManageKeyFile = otherKey
+	InitTLS(config, nil)
+
+	if res := request(WithManageCertificate(context.Background())); res == "manage" {
+		t.Fatalf("Certificate not signed by the CA of operators is accepted")
+	}
+}
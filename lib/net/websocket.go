@@ -0,0 +1,499 @@
+package net
+
+/*
+* WebSocket transport, for hosting where only HTTP(S) is allowed. Same commands go in binary frames of a WebSocket,
+* so a node can be behind a usual web server or a load balancer. An address of such node is an URL,
+* like ws://node.example.com:8080/oursql or wss://node.example.com/oursql, it goes in Host, Port is 0.
+* A node accepts WebSocket connections on a separate HTTP port, on any path. RFC 6455, only what the protocol needs
+ */
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	WebSocketPrefix       = "ws://"
+	SecureWebSocketPrefix = "wss://"
+)
+
+// Key of a handshake is hashed with this, RFC 6455 1.3
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	wsOpContinuation byte = 0
+	wsOpText         byte = 1
+	wsOpBinary       byte = 2
+	wsOpClose        byte = 8
+	wsOpPing         byte = 9
+	wsOpPong         byte = 10
+)
+
+// Connection over a WebSocket. Every Write is one binary frame, Read gives data of frames as one stream
+type wsConn struct {
+	net.Conn
+	r         *bufio.Reader
+	client    bool
+	remaining uint64
+	mask      []byte
+	maskPos   int
+	wlock     sync.Mutex
+	closed    bool
+	text      bool
+}
+
+type wsListener struct {
+	ln     net.Listener
+	server *http.Server
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+// Check if it is an address of a node behind a WebSocket
+func (n NodeAddr) IsWebSocket() bool {
+	return strings.HasPrefix(n.Host, WebSocketPrefix) || strings.HasPrefix(n.Host, SecureWebSocketPrefix)
+}
+
+// Checks an URL of a WebSocket of a node
+func ValidateWebSocketAddress(address string) error {
+	_, _, _, err := parseWebSocketURL(address)
+
+	return err
+}
+
+// Returns TCP address to connect, an URL without a scheme and a host, and true for wss
+func parseWebSocketURL(address string) (NodeAddr, string, bool, error) {
+	u, err := url.Parse(address)
+
+	if err != nil {
+		return NodeAddr{}, "", false, errors.New(fmt.Sprintf("Wrong WebSocket address %s: %s", address, err.Error()))
+	}
+
+	if u.Scheme != "ws" && u.Scheme != "wss" {
+		return NodeAddr{}, "", false, errors.New(fmt.Sprintf("Wrong scheme of WebSocket address %s", address))
+	}
+
+	endpoint := NodeAddr{Host: u.Hostname(), Port: 80}
+
+	if u.Scheme == "wss" {
+		endpoint.Port = 443
+	}
+
+	if err = ValidateHost(endpoint.Host); err != nil {
+		return NodeAddr{}, "", false, err
+	}
+
+	if u.Port() != "" {
+		endpoint.Port, err = strconv.Atoi(u.Port())
+
+		if err != nil || endpoint.Port < 1 || endpoint.Port > 65535 {
+			return NodeAddr{}, "", false, errors.New(fmt.Sprintf("Wrong port of WebSocket address %s", address))
+		}
+	}
+
+	return endpoint, u.RequestURI(), u.Scheme == "wss", nil
+}
+
+// Connects to a node by WebSocket. TCP connection goes through a proxy if it is set.
+// wss uses TLS config of nodes if it is set, in other case certificates are checked with system roots
+func dialWebSocket(ctx context.Context, dialer *net.Dialer, addr NodeAddr) (net.Conn, error) {
+	endpoint, path, secure, err := parseWebSocketURL(addr.Host)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dialTCP(ctx, dialer, endpoint)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if d, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(d)
+	} else if dialer.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(dialer.Timeout))
+	}
+
+	if secure && clientTLS != nil {
+		conn, err = dialTLS(ctx, conn, dialer.Timeout, endpoint)
+	} else if secure {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: endpoint.hostName()})
+
+		err = tlsConn.HandshakeContext(ctx)
+		conn = tlsConn
+	}
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	r, err := webSocketHandshake(conn, endpoint, path)
+
+	if err != nil {
+		conn.Close()
+		return nil, errors.New(fmt.Sprintf("WebSocket handshake with %s failed: %s", addr.Host, err.Error()))
+	}
+	conn.SetDeadline(time.Time{})
+
+	return &wsConn{Conn: conn, r: r, client: true}, nil
+}
+
+func webSocketAccept(key string) string {
+	h := sha1.Sum([]byte(key + webSocketGUID))
+
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// Sends an upgrade request and checks a response. Returns a reader of the connection, it can have buffered data
+func webSocketHandshake(conn net.Conn, endpoint NodeAddr, path string) (*bufio.Reader, error) {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	request := "GET " + path + " HTTP/1.1\r\n" +
+		"Host: " + endpoint.String() + "\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + key + "\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"
+
+	_, err := io.WriteString(conn, request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+
+	response, err := http.ReadResponse(r, &http.Request{Method: "GET"})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		return nil, errors.New(fmt.Sprintf("Got HTTP status %s", response.Status))
+	}
+
+	if response.Header.Get("Sec-WebSocket-Accept") != webSocketAccept(key) {
+		return nil, errors.New("Wrong accept key")
+	}
+	return r, nil
+}
+
+// Starts listening of WebSocket connections of nodes on host:port. TLS config of nodes is used if it is set
+func ListenWebSocket(address string) (net.Listener, error) {
+	ln, err := net.Listen(Protocol, address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ln, err = listenTLS(ln)
+
+	if err != nil {
+		return nil, err
+	}
+
+	l := &wsListener{ln: ln, conns: make(chan net.Conn), closed: make(chan struct{})}
+
+	l.server = &http.Server{Handler: http.HandlerFunc(l.upgrade), ReadHeaderTimeout: 10 * time.Second}
+
+	go l.server.Serve(ln)
+
+	return l, nil
+}
+
+// Accepts an upgrade request of a client
+func (l *wsListener) upgrade(w http.ResponseWriter, r *http.Request) {
+	conn, err := AcceptWebSocket(w, r, false)
+
+	if err != nil {
+		return
+	}
+
+	select {
+	case l.conns <- conn:
+	case <-l.closed:
+		conn.Close()
+	}
+}
+
+// Upgrades HTTP request to a WebSocket, for other HTTP servers of a node. An error response is sent if it fails.
+// With text every Write is one text frame, it is better for JSON messages to browsers
+func AcceptWebSocket(w http.ResponseWriter, r *http.Request, text bool) (net.Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+
+	if r.Method != "GET" || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+		!headerHasToken(r.Header.Get("Connection"), "upgrade") || key == "" {
+		http.Error(w, "WebSocket only", http.StatusBadRequest)
+		return nil, errors.New("Not a WebSocket request")
+	}
+
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("Unsupported WebSocket version")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+
+	if !ok {
+		http.Error(w, "Connection can not be upgraded", http.StatusInternalServerError)
+		return nil, errors.New("Connection can not be upgraded")
+	}
+
+	conn, brw, err := hijacker.Hijack()
+
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	_, err = io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: "+webSocketAccept(key)+"\r\n\r\n")
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &wsConn{Conn: conn, r: brw.Reader, text: text}, nil
+}
+
+// Checks if a comma separated header has a token
+func headerHasToken(header string, token string) bool {
+	for _, t := range strings.Split(header, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), token) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *wsListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, errors.New("Listener is closed")
+	}
+}
+
+func (l *wsListener) Close() error {
+	l.once.Do(func() {
+		close(l.closed)
+		l.server.Close()
+	})
+	return nil
+}
+
+func (l *wsListener) Addr() net.Addr {
+	return l.ln.Addr()
+}
+
+// Reads a header of next frame. Control frames are processed here
+func (c *wsConn) nextFrame() error {
+	header := make([]byte, 2)
+
+	_, err := io.ReadFull(c.r, header)
+
+	if err != nil {
+		return err
+	}
+
+	opcode := header[0] & 0x0f
+	masked := header[1]&0x80 > 0
+	length := uint64(header[1] & 0x7f)
+
+	switch length {
+	case 126:
+		bs := make([]byte, 2)
+
+		if _, err = io.ReadFull(c.r, bs); err != nil {
+			return err
+		}
+		length = uint64(binary.BigEndian.Uint16(bs))
+	case 127:
+		bs := make([]byte, 8)
+
+		if _, err = io.ReadFull(c.r, bs); err != nil {
+			return err
+		}
+		length = binary.BigEndian.Uint64(bs)
+	}
+
+	if !c.client && !masked {
+		return errors.New("WebSocket frame of a client is not masked")
+	}
+
+	c.mask = nil
+	c.maskPos = 0
+
+	if masked {
+		c.mask = make([]byte, 4)
+
+		if _, err = io.ReadFull(c.r, c.mask); err != nil {
+			return err
+		}
+	}
+
+	switch opcode {
+	case wsOpContinuation, wsOpText, wsOpBinary:
+		c.remaining = length
+		return nil
+	case wsOpClose, wsOpPing, wsOpPong:
+	default:
+		return errors.New(fmt.Sprintf("Unknown WebSocket frame %d", opcode))
+	}
+
+	if length > 125 {
+		return errors.New("WebSocket control frame is too long")
+	}
+
+	payload := make([]byte, length)
+
+	if _, err = io.ReadFull(c.r, payload); err != nil {
+		return err
+	}
+	c.unmask(payload)
+
+	switch opcode {
+	case wsOpClose:
+		c.Close()
+		return io.EOF
+	case wsOpPing:
+		return c.writeFrame(wsOpPong, payload)
+	}
+	return nil
+}
+
+func (c *wsConn) unmask(data []byte) {
+	if c.mask == nil {
+		return
+	}
+	for i := range data {
+		data[i] ^= c.mask[c.maskPos%4]
+		c.maskPos++
+	}
+}
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	for c.remaining == 0 {
+		if err := c.nextFrame(); err != nil {
+			return 0, err
+		}
+	}
+
+	if uint64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+
+	n, err := c.r.Read(p)
+
+	c.unmask(p[:n])
+	c.remaining -= uint64(n)
+
+	return n, err
+}
+
+// Sends a frame. Frames of a client are masked
+func (c *wsConn) writeFrame(opcode byte, data []byte) error {
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+
+	header := []byte{0x80 | opcode, 0}
+
+	switch {
+	case len(data) < 126:
+		header[1] = byte(len(data))
+	case len(data) <= 0xffff:
+		header[1] = 126
+		header = append(header, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(len(data)))
+	default:
+		header[1] = 127
+		header = append(header, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(header[2:], uint64(len(data)))
+	}
+
+	if c.client {
+		mask := make([]byte, 4)
+		rand.Read(mask)
+
+		header[1] |= 0x80
+		header = append(header, mask...)
+
+		masked := make([]byte, len(data))
+
+		for i := range data {
+			masked[i] = data[i] ^ mask[i%4]
+		}
+		data = masked
+	}
+
+	_, err := c.Conn.Write(header)
+
+	if err != nil || len(data) == 0 {
+		return err
+	}
+
+	_, err = c.Conn.Write(data)
+
+	return err
+}
+
+func (c *wsConn) Write(p []byte) (int, error) {
+	opcode := wsOpBinary
+
+	if c.text {
+		opcode = wsOpText
+	}
+
+	err := c.writeFrame(opcode, p)
+
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Sends a close frame and closes the connection
+func (c *wsConn) Close() error {
+	c.wlock.Lock()
+	closed := c.closed
+	c.closed = true
+	c.wlock.Unlock()
+
+	if !closed {
+		c.Conn.SetWriteDeadline(time.Now().Add(time.Second))
+		// normal closure
+		c.writeFrame(wsOpClose, []byte{3, 232})
+	}
+	return c.Conn.Close()
+}
+
+func (c *wsConn) NetConn() net.Conn {
+	return c.Conn
+}
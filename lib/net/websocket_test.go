@@ -0,0 +1,124 @@
+package net
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebSocketAddress(t *testing.T) {
+	for _, str := range []string{"ws://node.example.com:8080/oursql", "wss://node.example.com/oursql", "ws://[::1]:8080"} {
+		addr := NodeAddr{}
+
+		if err := addr.LoadFromString(str); err != nil {
+			t.Fatalf("Parse %s error: %s", str, err.Error())
+		}
+
+		if !addr.IsWebSocket() || addr.String() != str {
+			t.Fatalf("Address %s is converted to %s", str, addr.String())
+		}
+	}
+
+	for _, str := range []string{"ws://bad host/", "ws://node.com:port/", "wss://:8080/"} {
+		addr := NodeAddr{}
+
+		if addr.LoadFromString(str) == nil {
+			t.Fatalf("Wrong address %s is parsed", str)
+		}
+	}
+}
+
+func TestWebSocketConnection(t *testing.T) {
+	ln, err := ListenWebSocket("127.0.0.1:0")
+
+	if err != nil {
+		t.Fatalf("Listen error: %s", err.Error())
+	}
+	defer ln.Close()
+
+	// longer than 64 KB, it has 8 bytes length
+	data := bytes.Repeat([]byte("block"), 20000)
+
+	go func() {
+		conn, err := ln.Accept()
+
+		if err != nil {
+			return
+		}
+		request := make([]byte, len(data))
+
+		io.ReadFull(conn, request)
+		conn.Write(request)
+		conn.Close()
+	}()
+
+	addr := NodeAddr{}
+	addr.LoadFromString("ws://" + ln.Addr().String() + "/oursql")
+
+	conn, err := Dial(addr, time.Second)
+
+	if err != nil {
+		t.Fatalf("Dial error: %s", err.Error())
+	}
+	defer conn.Close()
+
+	conn.Write(data[:10])
+	conn.Write(data[10:])
+
+	response, err := io.ReadAll(conn)
+
+	if err != nil || !bytes.Equal(response, data) {
+		t.Fatalf("Got %d bytes, error %v", len(response), err)
+	}
+}
+
+func TestAcceptWebSocketText(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := AcceptWebSocket(w, r, true)
+
+		if err != nil {
+			return
+		}
+		conn.Write([]byte(`{"topic":"block"}`))
+		conn.Close()
+	}))
+	defer server.Close()
+
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	conn, err := net.Dial("tcp", address)
+
+	if err != nil {
+		t.Fatalf("Dial error: %s", err.Error())
+	}
+	defer conn.Close()
+
+	endpoint := NodeAddr{}
+	endpoint.LoadFromString(address)
+
+	r, err := webSocketHandshake(conn, endpoint, "/")
+
+	if err != nil {
+		t.Fatalf("Handshake error: %s", err.Error())
+	}
+
+	frame := make([]byte, 19)
+
+	if _, err = io.ReadFull(r, frame); err != nil {
+		t.Fatalf("Read error: %s", err.Error())
+	}
+
+	// final text frame, 17 bytes not masked
+	if frame[0] != 0x81 || frame[1] != 17 || string(frame[2:]) != `{"topic":"block"}` {
+		t.Fatalf("Got frame %x", frame)
+	}
+
+	if resp, _ := http.Get(server.URL); resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Not WebSocket request is accepted")
+	}
+}
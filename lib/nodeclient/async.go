@@ -0,0 +1,58 @@
+package nodeclient
+
+/*
+* Requests which wait for a response in background. A caller sends many requests to different nodes
+* and reads responses when it needs them, instead of waiting for every request one by one.
+* A trace can not be used from 2 goroutines, so background requests are not traced
+ */
+
+import (
+	netlib "github.com/gelembjuk/oursql/lib/net"
+)
+
+// Result of a request sent in background. Payload is the structure given to the request, the response is decoded to it
+type AsyncResponse struct {
+	Addr    netlib.NodeAddr
+	Payload interface{}
+	Err     error
+}
+
+// Sends a request in background. The result is sent to the channel when the request is complete, the channel is buffered,
+// so the result can be not read
+func (c *NodeClient) SendDataWaitResponseAsync(addr netlib.NodeAddr, data []byte, datapayload interface{}) <-chan AsyncResponse {
+	result := make(chan AsyncResponse, 1)
+
+	c.SendDataWaitResponseCallback(addr, data, datapayload, func(response AsyncResponse) {
+		result <- response
+	})
+
+	return result
+}
+
+// Sends a request in background. The function is called from other goroutine when the request is complete
+func (c *NodeClient) SendDataWaitResponseCallback(addr netlib.NodeAddr, data []byte, datapayload interface{}, f func(response AsyncResponse)) {
+	client := *c
+	client.Trace = nil
+
+	go func() {
+		err := client.SendDataWaitResponse(addr, data, datapayload)
+
+		f(AsyncResponse{addr, datapayload, err})
+	}()
+}
+
+// Requests a block in background. Payload of the result is *ResponseGetBlock
+func (c *NodeClient) SendGetBlockAsync(addr netlib.NodeAddr, blockHash []byte) <-chan AsyncResponse {
+	data := ComGetBlock{blockHash, c.NodeAddress}
+
+	request, err := c.BuildCommandData(addr, CommandGetBlock, &data)
+
+	if err != nil {
+		result := make(chan AsyncResponse, 1)
+		result <- AsyncResponse{addr, nil, err}
+
+		return result
+	}
+
+	return c.SendDataWaitResponseAsync(addr, request, &ResponseGetBlock{})
+}
@@ -0,0 +1,108 @@
+package nodeclient
+
+/*
+* Batched requests. Several commands are packed in one request and a node returns all responses together,
+* so a sync doesn't do a round trip for every small request. Every command has own response or error,
+* a failed command doesn't stop other commands of the batch. A batch is not retried, it can have changes
+ */
+
+import (
+	"fmt"
+
+	netlib "github.com/gelembjuk/oursql/lib/net"
+)
+
+// Longest batch a node accepts
+const MaxBatchRequests = 100
+
+// Command in a batch. Data is the payload of the command
+type ComBatchRequest struct {
+	Command string `proto:"1"`
+	Data    []byte `proto:"2"`
+}
+
+type ComBatch struct {
+	Requests []ComBatchRequest `proto:"1"`
+}
+
+// Response of a command in a batch. Data is an error response if it is not success
+type ComBatchResponse struct {
+	Success bool   `proto:"1"`
+	Data    []byte `proto:"2"`
+}
+
+// Responses in same order as commands
+type ResponseBatch struct {
+	Responses []ComBatchResponse `proto:"1"`
+}
+
+// Request to send in a batch. Response is a pointer to a structure of a response, nil if a command has no response.
+// Err is set when the batch is complete
+type BatchRequest struct {
+	Command  string
+	Data     interface{}
+	Response interface{}
+	Err      error
+}
+
+// Sends commands in one request. Returned error means the batch failed, errors of commands are in requests
+func (c *NodeClient) SendBatch(addr netlib.NodeAddr, requests []*BatchRequest) error {
+	if len(requests) > MaxBatchRequests {
+		return netlib.NewRemoteError(netlib.ErrorCodeBadRequest, fmt.Sprintf("Batch of %d requests is too long", len(requests)))
+	}
+
+	data := ComBatch{}
+	format := c.wireFormatFor(addr)
+
+	for _, r := range requests {
+		request := ComBatchRequest{Command: r.Command}
+
+		if r.Data != nil {
+			var err error
+
+			request.Data, err = netlib.EncodePayload(format, r.Data)
+
+			if err != nil {
+				return err
+			}
+		}
+		data.Requests = append(data.Requests, request)
+	}
+
+	request, err := c.BuildCommandData(addr, CommandBatch, &data)
+
+	if err != nil {
+		return err
+	}
+
+	datapayload := ResponseBatch{}
+
+	err = c.SendDataWaitResponse(addr, request, &datapayload)
+
+	if err != nil {
+		return err
+	}
+
+	if len(datapayload.Responses) != len(requests) {
+		return netlib.NewCanNotParseResponseError(fmt.Sprintf("Got %d responses for %d requests", len(datapayload.Responses), len(requests)))
+	}
+
+	for i, response := range datapayload.Responses {
+		r := requests[i]
+
+		if !response.Success {
+			r.Err = netlib.DecodeErrorResponseAs(format, response.Data)
+			continue
+		}
+
+		if r.Response != nil {
+			err = netlib.DecodePayload(format, response.Data, r.Response)
+
+			if err != nil {
+				r.Err = netlib.NewCanNotParseResponseError(err.Error())
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package nodeclient
+
+/*
+* Sending of same data to many nodes at same time. Requests go from a pool of workers, so a slow node doesn't
+* delay others and too many connections are not opened at once. A result of every node is returned
+ */
+
+import (
+	"sync"
+
+	netlib "github.com/gelembjuk/oursql/lib/net"
+)
+
+// Default number of nodes which get requests at same time
+const defaultBroadcastWorkers = 8
+
+type BroadcastResult struct {
+	Addr netlib.NodeAddr
+	Err  error
+}
+
+type BroadcastSummary struct {
+	// in same order as nodes
+	Results []BroadcastResult
+	Sent    int
+	Failed  int
+}
+
+// Sends to all nodes with the function, BroadcastWorkers nodes at same time. The address of this node is skipped.
+// A trace can not be used from many goroutines, so requests are not traced
+func (c *NodeClient) Broadcast(nodes []netlib.NodeAddr, send func(client *NodeClient, addr netlib.NodeAddr) error) BroadcastSummary {
+	workers := c.BroadcastWorkers
+
+	if workers < 1 {
+		workers = defaultBroadcastWorkers
+	}
+
+	targets := []netlib.NodeAddr{}
+
+	for _, node := range nodes {
+		if !node.CompareToAddress(c.NodeAddress) {
+			targets = append(targets, node)
+		}
+	}
+
+	summary := BroadcastSummary{Results: make([]BroadcastResult, len(targets))}
+
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers && w < len(targets); w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			client := *c
+			client.Trace = nil
+
+			for i := range jobs {
+				summary.Results[i] = BroadcastResult{targets[i], send(&client, targets[i])}
+			}
+		}()
+	}
+
+	for i := range targets {
+		jobs <- i
+	}
+	close(jobs)
+
+	wg.Wait()
+
+	for _, r := range summary.Results {
+		if r.Err != nil {
+			summary.Failed++
+		} else {
+			summary.Sent++
+		}
+	}
+	return summary
+}
+
+// Sends an inventory to all nodes
+func (c *NodeClient) BroadcastInv(nodes []netlib.NodeAddr, kind string, items [][]byte) BroadcastSummary {
+	return c.Broadcast(nodes, func(client *NodeClient, addr netlib.NodeAddr) error {
+		return client.SendInv(addr, kind, items)
+	})
+}
+
+// Sends a serialized transaction to all nodes
+func (c *NodeClient) BroadcastTx(nodes []netlib.NodeAddr, txSerialised []byte) BroadcastSummary {
+	return c.Broadcast(nodes, func(client *NodeClient, addr netlib.NodeAddr) error {
+		return client.SendTx(addr, txSerialised)
+	})
+}
+
+// Checks if every node has a block and sends a full block to nodes which don't have it.
+// blockShort is serialized short copy of the block
+func (c *NodeClient) BroadcastBlock(nodes []netlib.NodeAddr, blockShort []byte, blockSerialised []byte) BroadcastSummary {
+	return c.Broadcast(nodes, func(client *NodeClient, addr netlib.NodeAddr) error {
+		result, err := client.SendCheckBlock(addr, blockShort)
+
+		if err != nil || result.Exists {
+			return err
+		}
+		return client.SendBlock(addr, blockSerialised)
+	})
+}
+
+// Checks if every node has a block and sends a compact block to nodes which accept it, a full block to others
+func (c *NodeClient) BroadcastCompactBlock(nodes []netlib.NodeAddr, blockCompact []byte, blockShort []byte, blockSerialised []byte) BroadcastSummary {
+	return c.Broadcast(nodes, func(client *NodeClient, addr netlib.NodeAddr) error {
+		result, err := client.SendCheckBlock(addr, blockShort)
+
+		if err != nil || result.Exists {
+			return err
+		}
+
+		if result.CompactBlocks {
+			return client.SendCompactBlock(addr, blockCompact)
+		}
+		return client.SendBlock(addr, blockSerialised)
+	})
+}
@@ -0,0 +1,76 @@
+package nodeclient
+
+/*
+* Context of requests. When the context of a client is canceled, connecting, sending and waiting for a response
+* are stopped, pauses between retries too. A deadline of the context limits every request of the client
+ */
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// Returns a copy of the client which sends requests with the context
+func (c *NodeClient) WithContext(ctx context.Context) *NodeClient {
+	client := *c
+	client.ctx = ctx
+
+	return &client
+}
+
+// Sets a context of requests of the client
+func (c *NodeClient) SetContext(ctx context.Context) {
+	c.ctx = ctx
+}
+
+// Returns a context of requests. It is background if not set
+func (c *NodeClient) Context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// Returns a deadline of all the request, from the overall timeout or the context. Zero time means no deadline
+func (c *NodeClient) requestDeadline(timeouts Timeouts) time.Time {
+	overall := time.Time{}
+
+	if timeouts.Overall > 0 {
+		overall = time.Now().Add(timeouts.duration(timeouts.Overall))
+	}
+
+	if d, ok := c.Context().Deadline(); ok && (overall.IsZero() || d.Before(overall)) {
+		overall = d
+	}
+	return overall
+}
+
+// Unblocks reads and writes of a connection when the context is done. Returned function stops watching
+func watchContext(ctx context.Context, conn net.Conn) func() {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
+
+// If the context is done, its error is returned, so a caller knows the request was canceled
+func contextError(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
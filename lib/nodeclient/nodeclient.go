@@ -5,6 +5,7 @@ package nodeclient
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"time"
 
@@ -13,9 +14,10 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net"
+	"strconv"
 
 	netlib "github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/tracing"
 	"github.com/gelembjuk/oursql/lib/utils"
 )
 
@@ -28,8 +30,25 @@ const (
 	CommandGetUpdates       = "getupdates"
 	CommandGetTransaction   = "gettransact"
 	CommandCheckBlock       = "checkblock"
-	CommandGetBlock         = "getblock" // requests a block by hash
-	CommandBlock            = "block"    // send block body
+	CommandGetBlock         = "getblock"     // requests a block by hash
+	CommandBlock            = "block"        // send block body
+	CommandGetBlockHeaders  = "getheaders"   // requests headers of blocks going down
+	CommandGetTXProof       = "gettxproof"   // requests Merkle proof for a transaction
+	CommandGetName          = "getname"      // requests a record of the names registry
+	CommandGetChecksums     = "getchecksums" // requests checksums of rows of a table
+	CommandGetBlob          = "getblob"      // requests a large value of a column by hash
+	CommandSetLogs          = "setlogs"      // changes enabled logs of a running node
+	CommandProfile          = "profile"      // requests a runtime profile of a node
+	CommandGetBlocksStream  = "getblstream"  // requests full blocks going up, they are streamed
+	CommandBatch            = "batch"        // several commands in one request
+	CommandPing             = "ping"         // checks if a node is alive
+	CommandGetBans          = "getbans"      // requests banned peers of a node
+	CommandClearBans        = "clearbans"    // removes bans of peers
+	CommandGetSettings      = "getsettings"  // requests settings which can be changed at runtime
+	CommandSetSettings      = "setsettings"  // changes settings without restart
+	CommandGetSnapshot      = "getsnapshot"  // requests a signed snapshot of the DB, it is streamed
+	CommandCompactBlock     = "cmpctblock"   // send block header with short IDs of transactions
+	CommandGetBlockTxs      = "getblocktxs"  // requests transactions of a block by indexes
 
 )
 
@@ -40,210 +59,510 @@ type NodeClient struct {
 	Logger      *utils.LoggerMan
 	NodeNet     *netlib.NodeNetwork
 	NodeAuthStr string
+	// identity of the node to sign own address and messages. Nil for wallets and tools
+	Identity *netlib.NodeIdentity
+	// spans of requests are added to this trace. Can be nil
+	Trace *tracing.Trace
+	// format of payloads of requests, gob or protobuf. Empty is gob
+	WireFormat string
+	// formats of peers from their versions. If it is set, protobuf is sent only to peers which accept it.
+	// Nil for wallets and tools, they use WireFormat with any node
+	PeerFormats *netlib.PeerWireFormats
+	// timeouts of requests per class of commands. Empty means defaults
+	Timeouts TimeoutsConfig
+	// retries of requests which only read data
+	Retry RetryPolicy
+	// longest response in bytes. 0 means netlib.DefaultMaxResponseSize
+	MaxResponseSize int64
+	// limits of rate of requests per node. Nil means no limits
+	RateLimiter *RateLimiter
+	// limits of traffic per node and for all nodes. The server of a node uses same limits. Nil means no limits
+	Bandwidth *netlib.Bandwidth
+	// limit of connections to nodes at same time. Nil means no limit
+	Outbound *netlib.OutboundSlots
+	// connects to nodes. Nil is TCPTransport
+	Transport Transport
+	// metrics of requests per node. Nil means they are not collected
+	Metrics *ClientMetrics
+	// nodes which get a broadcast at same time. 0 means defaultBroadcastWorkers
+	BroadcastWorkers int
+	// requests are canceled when it is done. Nil is background
+	ctx context.Context
 }
 
 // Command to send list of known addresses to other node
 type ComAddresses struct {
-	AddrFrom  netlib.NodeAddr
-	Addresses []netlib.NodeAddr
+	AddrFrom  netlib.NodeAddr   `proto:"1"`
+	Addresses []netlib.NodeAddr `proto:"2"`
 }
 
 type ComBlock struct {
-	AddrFrom netlib.NodeAddr
-	Block    []byte
+	AddrFrom netlib.NodeAddr `proto:"1"`
+	Block    []byte          `proto:"2"`
+	// signed by identity of AddrFrom. Empty from older nodes
+	Signature []byte `proto:"3"`
+}
+
+func (d ComBlock) SignedData() [][]byte {
+	return [][]byte{[]byte(CommandBlock), d.Block}
+}
+
+// Compact block. Block is serialised BlockCompact structure
+type ComCompactBlock struct {
+	AddrFrom netlib.NodeAddr `proto:"1"`
+	Block    []byte          `proto:"2"`
+	// signed by identity of AddrFrom. Empty from older nodes
+	Signature []byte `proto:"3"`
+}
+
+func (d ComCompactBlock) SignedData() [][]byte {
+	return [][]byte{[]byte(CommandCompactBlock), d.Block}
 }
 
 // this struct can be used for 2 commands. to get blocks starting from some block to down or to up
 type ComGetBlocks struct {
-	AddrFrom  netlib.NodeAddr
-	StartFrom []byte // has of block from which to start and go down or go up in case of Up command
+	AddrFrom  netlib.NodeAddr `proto:"1"`
+	StartFrom []byte          `proto:"2"` // has of block from which to start and go down or go up in case of Up command
 }
 
 // Response of GetBlock request
 type ComGetFirstBlocksData struct {
-	Blocks [][]byte // lowest block first
+	Blocks [][]byte `proto:"1"` // lowest block first
 	// it is serialised BlockShort structure
-	Height int
+	Height int `proto:"2"`
 }
 
 // Response of GetConsensusData request
 type ComGetConsensusData struct {
-	ConfigFile []byte
-	Module     []byte // this can be long string
+	ConfigFile []byte `proto:"1"`
+	Module     []byte `proto:"2"` // not sent by new nodes. The config references a module by hash
 }
 
 type ComGetData struct {
-	AddrFrom netlib.NodeAddr
-	Type     string
-	ID       []byte
+	AddrFrom netlib.NodeAddr `proto:"1"`
+	Type     string          `proto:"2"`
+	ID       []byte          `proto:"3"`
 }
 
 // Wallet Balance response
 type ComWalletBalance struct {
-	Total    float64
-	Approved float64
-	Pending  float64
+	Total    float64 `proto:"1"`
+	Approved float64 `proto:"2"`
+	Pending  float64 `proto:"3"`
 }
 
 // Request for a wallet balance
 type ComGetWalletBalance struct {
-	Address string
+	Address string `proto:"1"`
 }
 
 // New Transaction command. Is used by lite wallets
 type ComNewTransaction struct {
-	Address string
-	TX      []byte
+	Address string `proto:"1"`
+	TX      []byte `proto:"2"`
 }
 
 // New Transaction Data command. It includes prepared TX and signatures for imputs
 type ComNewTransactionData struct {
-	Address   string
-	TX        []byte
-	Signature []byte
+	Address   string `proto:"1"`
+	TX        []byte `proto:"2"`
+	Signature []byte `proto:"3"`
 }
 
 // To Request new transaction by wallet.
 // Wallet sends address where to send and amount to send
 // and own pubkey. Server returns transaction but wihout signatures
 type ComRequestTransaction struct {
-	PubKey []byte
-	To     string
-	Amount float64
+	PubKey []byte  `proto:"1"`
+	To     string  `proto:"2"`
+	Amount float64 `proto:"3"`
+	// Address to send a change to. Empty means the change goes back to the sender
+	ChangeAddress string `proto:"4"`
 }
 
 // To Request new SQL transaction by wallet.
 // Wallet sends SQL command and own pubkey. Server returns transaction but wihout signatures
 type ComRequestSQLTransaction struct {
-	PubKey []byte
-	SQL    string
+	PubKey []byte `proto:"1"`
+	SQL    string `proto:"2"`
 }
 
 // Response on prepare transaction request. Returns transaction without signs
 // and data to sign
 type ComRequestTransactionData struct {
-	Finished   bool
-	TX         []byte
-	DataToSign []byte
+	Finished   bool   `proto:"1"`
+	TX         []byte `proto:"2"`
+	DataToSign []byte `proto:"3"`
 }
 
 // For request to get list of unspent transactions by wallet
 type ComGetUnspentTransactions struct {
-	Address   string
-	LastBlock []byte
+	Address   string `proto:"1"`
+	LastBlock []byte `proto:"2"`
 }
 
 // Unspent Transaction record
 type ComUnspentTransaction struct {
-	TXID   []byte
-	Vout   int
-	Amount float64
-	IsBase bool
-	From   string
+	TXID   []byte  `proto:"1"`
+	Vout   int     `proto:"2"`
+	Amount float64 `proto:"3"`
+	IsBase bool    `proto:"4"`
+	From   string  `proto:"5"`
 }
 
 // Lit of unspent transactions returned on request
 type ComUnspentTransactions struct {
-	Transactions []ComUnspentTransaction
-	LastBlock    []byte
+	Transactions []ComUnspentTransaction `proto:"1"`
+	LastBlock    []byte                  `proto:"2"`
 }
 
 // Request for history of transactions
+// Offset and Limit are used for pagination. Limit 0 means return all records
 type ComGetHistoryTransactions struct {
-	Address string
+	Address string `proto:"1"`
+	// older clients skip records. A page after a record is stable when new blocks are added
+	Offset int `proto:"2"`
+	Limit  int `proto:"3"`
+	// last record of previous page
+	AfterBlock  []byte `proto:"4"`
+	AfterTX     []byte `proto:"5"`
+	AfterIOType bool   `proto:"6"`
 }
 
 // Record of transaction in list of history transactions
 type ComHistoryTransaction struct {
-	IOType bool // In (false) or Out (true)
-	TXID   []byte
-	Amount float64
-	From   string
-	To     string
+	IOType bool    `proto:"1"` // In (false) or Out (true)
+	TXID   []byte  `proto:"2"`
+	Amount float64 `proto:"3"`
+	From   string  `proto:"4"`
+	To     string  `proto:"5"`
+	// info about a block where TX is included
+	Time          int64  `proto:"6"`
+	BlockHash     []byte `proto:"7"`
+	BlockHeight   int    `proto:"8"`
+	Confirmations int    `proto:"9"`
 }
 
 // Request for inventory. It can be used to get blocks and transactions from other node
 type ComInv struct {
-	AddrFrom netlib.NodeAddr
-	Type     string
-	Items    [][]byte
+	AddrFrom netlib.NodeAddr `proto:"1"`
+	Type     string          `proto:"2"`
+	Items    [][]byte        `proto:"3"`
+	// signed by identity of AddrFrom. Empty from older nodes
+	Signature []byte `proto:"4"`
+}
+
+// Parts of the inventory signed by a sender
+func (d ComInv) SignedData() [][]byte {
+	return append([][]byte{[]byte("inv"), []byte(d.Type)}, d.Items...)
 }
 
 // Transaction to send to other node
 type ComTx struct {
-	AddFrom     netlib.NodeAddr
-	Transaction []byte // Transaction serialised
+	AddFrom     netlib.NodeAddr `proto:"1"`
+	Transaction []byte          `proto:"2"` // Transaction serialised
 }
 
 // Version mesage to other nodes
 type ComVersion struct {
-	Version    int
-	BestHeight int
-	AddrFrom   netlib.NodeAddr
+	Version    int             `proto:"1"`
+	BestHeight int             `proto:"2"`
+	AddrFrom   netlib.NodeAddr `proto:"3"`
+	Time       int64           `proto:"4"` // unix time of the sender. 0 from older nodes
+	// formats of payloads the sender accepts. Empty from older nodes, they accept only gob
+	WireFormats []string `proto:"5"`
 }
 
 // To send nodes manage command.
 type ComManageNode struct {
-	Node netlib.NodeAddr
+	Node netlib.NodeAddr `proto:"1"`
 }
 
 // To get node state
 type ComGetNodeState struct {
-	Host                  string
-	BlocksNumber          int
-	ExpectingBlocksHeight int
-	TransactionsCached    int
-	UnspentOutputs        int
+	Host                  string `proto:"1"`
+	BlocksNumber          int    `proto:"2"`
+	ExpectingBlocksHeight int    `proto:"3"`
+	TransactionsCached    int    `proto:"4"`
+	UnspentOutputs        int    `proto:"5"`
+	// DB server, like MySQL 8.0.36. Empty for SQLite
+	DBServerVersion string `proto:"6"`
+	// Session settings used to apply SQL of blocks. Empty for SQLite
+	DBApplySettings string `proto:"7"`
+	// queries of blocks stopped by timeout and the last TX with such query
+	ApplyTimeouts      int64  `proto:"8"`
+	ApplyTimeoutLastTX string `proto:"9"`
+	// health of the DB server. Since is time of the last change of availability
+	DBAvailable      bool   `proto:"10"`
+	DBHealthSince    int64  `proto:"11"`
+	DBHealthFailures int64  `proto:"12"`
+	DBReconnects     int64  `proto:"13"`
+	DBLastError      string `proto:"14"`
+	// DB connections pool
+	DBPoolOpen      int   `proto:"15"`
+	DBPoolInUse     int   `proto:"16"`
+	DBPoolIdle      int   `proto:"17"`
+	DBPoolMaxOpen   int   `proto:"18"`
+	DBPoolWaitCount int64 `proto:"19"`
+	DBPoolWaitTime  int64 `proto:"20"` // milliseconds
+	// SELECT results cache of the proxy
+	QueryCacheEntries int   `proto:"21"`
+	QueryCacheHits    int64 `proto:"22"`
+	QueryCacheMisses  int64 `proto:"23"`
+	// updates of the DB done not by the node. Found by the binary log monitor
+	BinlogMonitor    bool  `proto:"24"`
+	OutOfBandChanges int64 `proto:"25"`
+	// rows different from other nodes
+	RowsCheck     bool  `proto:"26"`
+	DifferentRows int64 `proto:"27"`
+	// local maintenance of tables
+	Maintenance       bool   `proto:"28"`
+	MaintenanceWindow string `proto:"29"`
+	MaintenanceRuns   int64  `proto:"30"`
+	MaintenanceLast   string `proto:"31"`
+	// anchors of blocks in an external blockchain
+	Anchoring    bool   `proto:"32"`
+	AnchoringVia string `proto:"33"`
+	AnchorsMade  int64  `proto:"34"`
+	AnchorsLast  string `proto:"35"`
+	// ID of the identity key of the node
+	Identity string `proto:"36"`
+	// median offset of clocks of other nodes in seconds
+	ClockOffset int64 `proto:"37"`
+	ClockPeers  int   `proto:"38"`
+	ClockDrift  bool  `proto:"39"`
 }
 
 // To get node last updates
 type ComGetUpdates struct {
-	LastCheckTime      int64
-	CurrentBlockHeight int
-	TopBlocks          [][]byte
-	AddrFrom           netlib.NodeAddr
+	LastCheckTime      int64           `proto:"1"`
+	CurrentBlockHeight int             `proto:"2"`
+	TopBlocks          [][]byte        `proto:"3"`
+	AddrFrom           netlib.NodeAddr `proto:"4"`
 }
 
 // Response with updates on a node
 type ResponseGetUpdates struct {
-	CurrentBlockHeight      int
-	CountTransactionsInPool int
-	Blocks                  [][]byte
-	TransactionsInPool      [][]byte
-	Nodes                   []netlib.NodeAddrShort
+	CurrentBlockHeight      int                    `proto:"1"`
+	CountTransactionsInPool int                    `proto:"2"`
+	Blocks                  [][]byte               `proto:"3"`
+	TransactionsInPool      [][]byte               `proto:"4"`
+	Nodes                   []netlib.NodeAddrShort `proto:"5"`
 }
 
 // To get transaction from other node
 type ComGetTransaction struct {
-	TransactionID []byte
-	AddrFrom      netlib.NodeAddr
+	TransactionID []byte          `proto:"1"`
+	AddrFrom      netlib.NodeAddr `proto:"2"`
 }
 
 // Response for transaction request
 type ResponseGetTransaction struct {
-	Transaction []byte // Transaction serialised
+	Transaction []byte `proto:"1"` // Transaction serialised
 }
 
 // Request to check if block exists. Executed before to send new block to node
 type ComCheckBlock struct {
-	BlockHash []byte
-	AddrFrom  netlib.NodeAddr
+	BlockHash []byte          `proto:"1"`
+	AddrFrom  netlib.NodeAddr `proto:"2"`
 }
 
 // Response for check block request
 type ResponseCheckBlock struct {
-	Exists bool // True if a node doesn't want to get a body of this TX
+	Exists bool `proto:"1"` // True if a node doesn't want to get a body of this TX
+	// node accepts compact blocks. False from older nodes
+	CompactBlocks bool `proto:"2"`
 }
 
 // To get transaction from other node
 type ComGetBlock struct {
-	BlockHash []byte
-	AddrFrom  netlib.NodeAddr
+	BlockHash []byte          `proto:"1"`
+	AddrFrom  netlib.NodeAddr `proto:"2"`
 }
 
 // Response for transaction request
 type ResponseGetBlock struct {
-	Block []byte // Transaction serialised
+	Block []byte `proto:"1"` // Transaction serialised
+}
+
+// Request for transactions of a block which are missed to make a block from compact block
+type ComGetBlockTxs struct {
+	BlockHash []byte `proto:"1"`
+	Indexes   []int  `proto:"2"`
+}
+
+type ResponseGetBlockTxs struct {
+	Transactions [][]byte `proto:"1"` // serialised, in order of indexes
+}
+
+// Request for full blocks after a block going up. A response is streamed, a chunk is ResponseGetBlock
+type ComGetBlocksStream struct {
+	StartFrom []byte          `proto:"1"` // empty means from the first block
+	MaxCount  int             `proto:"2"` // 0 means till the top
+	AddrFrom  netlib.NodeAddr `proto:"3"`
+}
+
+// Called for every chunk of a streamed response
+type streamHandler func(chunk []byte) error
+
+// Snapshot of the DB of a node on a block. It is signed by the identity of the node
+type SnapshotInfo struct {
+	Height      int    `proto:"1"`
+	TopHash     []byte `proto:"2"`
+	UnspentHash []byte `proto:"3"` // hash of all unspent outputs
+	DumpHash    []byte `proto:"4"` // sha256 of the DB dump
+	DumpSize    int64  `proto:"5"`
+	Identity    []byte `proto:"6"`
+	Signature   []byte `proto:"7"`
+}
+
+// Chunk of a streamed snapshot. First chunk has the info, next chunks have parts of the dump
+type ResponseGetSnapshot struct {
+	Info *SnapshotInfo `proto:"1"`
+	Data []byte        `proto:"2"`
+}
+
+// Block header. It is enough to check a chain of blocks and Merkle proofs
+// without loading of full blocks
+type ComBlockHeader struct {
+	Timestamp     int64  `proto:"1"`
+	PrevBlockHash []byte `proto:"2"`
+	Hash          []byte `proto:"3"`
+	Nonce         int    `proto:"4"`
+	Height        int    `proto:"5"`
+	MerkleRoot    []byte `proto:"6"`
+	// complexity of the consensus which is hashed with a block. A client checks a hash of a header with it
+	Complexity int `proto:"7"`
+}
+
+// Request for blocks headers. Headers are returned starting from a block and going down
+// If StartFrom is empty then it starts from top block
+type ComGetBlockHeaders struct {
+	StartFrom []byte `proto:"1"`
+	MaxCount  int    `proto:"2"`
+}
+
+// Response for block headers request. Top block first
+type ResponseGetBlockHeaders struct {
+	Headers []ComBlockHeader `proto:"1"`
+}
+
+// Request for a proof that transaction is included in a block
+type ComGetTransactionProof struct {
+	TransactionID []byte `proto:"1"`
+}
+
+// Response with Merkle proof for transaction. Proof is a list of hashes from
+// a transaction up to the Merkle root of a block
+type ResponseGetTransactionProof struct {
+	Header      ComBlockHeader `proto:"1"`
+	Transaction []byte         `proto:"2"` // Transaction serialised
+	Proof       [][]byte       `proto:"3"`
+	ProofLeft   []bool         `proto:"4"`
+}
+
+// Request for a record of the names registry. Record is searched by a name or by an address
+type ComGetName struct {
+	Name    string `proto:"1"`
+	Address string `proto:"2"`
+}
+
+// Response with a record of the names registry
+type ResponseGetName struct {
+	Found   bool   `proto:"1"`
+	Name    string `proto:"2"`
+	PubKey  []byte `proto:"3"`
+	Address string `proto:"4"`
+}
+
+// Request for checksums of a table rows. If Group is -1, checksums of all groups are returned,
+// else checksums of rows of the group. Rows with keys from Exclude are not used
+type ComGetChecksums struct {
+	Table   string   `proto:"1"`
+	Group   int      `proto:"2"`
+	Exclude []string `proto:"3"`
+}
+
+// Response with checksums of a table. Exclude is keys of rows changed by transactions in the pool of a node,
+// checksums are built without them and without keys from a request
+type ResponseGetChecksums struct {
+	TopHash []byte            `proto:"1"`
+	Exclude []string          `proto:"2"`
+	Groups  [][]byte          `proto:"3"`
+	Rows    map[string][]byte `proto:"4"`
+}
+
+// Request for a large value of a column which is stored out of transactions
+type ComGetBlob struct {
+	Hash []byte `proto:"1"`
+}
+
+type ResponseGetBlob struct {
+	Data []byte `proto:"1"`
+}
+
+// Ping of a node. A node answers with its time
+type ComPing struct {
+	AddrFrom netlib.NodeAddr `proto:"1"`
+}
+
+type ResponsePing struct {
+	Time int64 `proto:"1"`
+}
+
+// Request to change logs of a running node. Logs is comma separated list, like trace,error
+type ComSetLogs struct {
+	Logs string `proto:"1"`
+}
+
+type ResponseSetLogs struct {
+	State string `proto:"1"`
+}
+
+type ResponseGetBans struct {
+	Bans []netlib.Ban `proto:"1"`
+}
+
+// Request to remove a ban of a peer by IP. Empty Host means all bans
+type ComClearBans struct {
+	Host string `proto:"1"`
+}
+
+type ResponseClearBans struct {
+	Count int `proto:"1"`
+}
+
+// Settings of a node which can be changed while it works. In a request 0 and empty values are not changed.
+// -1 means no limit
+type NodeSettings struct {
+	Logs                 string `proto:"1"`
+	MaxInbound           int    `proto:"2"`
+	MaxOutbound          int    `proto:"3"`
+	Eviction             string `proto:"4"`
+	MaxPoolSize          int    `proto:"5"`
+	SyncInterval         int    `proto:"6"` // seconds
+	SyncIntervalNoIncome int    `proto:"7"`
+}
+
+// Request to change settings. With Save they are written to the config file too
+type ComSetSettings struct {
+	Settings NodeSettings `proto:"1"`
+	Save     bool         `proto:"2"`
+}
+
+type ResponseSettings struct {
+	Settings NodeSettings `proto:"1"`
+}
+
+// Request for a profile of a node. Type is cpu, heap, goroutine or trace.
+// cpu and trace are collected for Seconds
+type ComProfile struct {
+	Type    string `proto:"1"`
+	Seconds int    `proto:"2"`
+}
+
+type ResponseProfile struct {
+	Data []byte `proto:"1"`
 }
 
 // Check if node address looks fine
@@ -253,23 +572,54 @@ func (c *NodeClient) SetAuthStr(auth string) {
 
 // Check if node address looks fine
 func (c *NodeClient) CheckNodeAddress(address netlib.NodeAddr) error {
+	if address.IsLocal() {
+		if address.LocalPath() == "" {
+			return errors.New("Node Address Socket path is empty")
+		}
+		return nil
+	}
+	if address.IsWebSocket() {
+		return netlib.ValidateWebSocketAddress(address.Host)
+	}
 	if address.Port < 1024 {
 		return errors.New("Node Address Port has wrong value")
 	}
-	if address.Port > 65536 {
+	if address.Port > 65535 {
 		return errors.New("Node Address Port has wrong value")
 	}
-	if address.Host == "" {
-		return errors.New("Node Address Host has wrong value")
+	if err := netlib.ValidateHost(address.Host); err != nil {
+		return errors.New("Node Address Host has wrong value: " + err.Error())
 	}
 	return nil
 }
 
 // Set currrent node address , to include itin requests to other nodes
+// The address is signed with the identity if it is set
 func (c *NodeClient) SetNodeAddress(address netlib.NodeAddr) {
+	if c.Identity != nil && !bytes.Equal(address.Identity, c.Identity.PublicKey()) {
+		address.SignAnnouncement(c.Identity)
+	}
 	c.NodeAddress = address
 }
 
+// Set identity of the node. Current node address is signed again
+func (c *NodeClient) SetIdentity(identity *netlib.NodeIdentity) {
+	c.Identity = identity
+
+	if identity != nil && c.NodeAddress.Host != "" {
+		c.NodeAddress = c.NodeAddress.WithoutAnnouncement()
+		c.SetNodeAddress(c.NodeAddress)
+	}
+}
+
+// Signs a message by the identity. Nil if the identity is not set
+func (c *NodeClient) signMessage(parts ...[]byte) []byte {
+	if c.Identity == nil {
+		return nil
+	}
+	return c.Identity.SignMessage(parts...)
+}
+
 // Send void commant to other node
 // It is used by a node to send to itself only when we want to stop a node
 // And unblock port listetining
@@ -285,7 +635,7 @@ func (c *NodeClient) SendAddrList(address netlib.NodeAddr, addresses []netlib.No
 	data.Addresses = addresses
 	data.AddrFrom = c.NodeAddress
 
-	request, err := c.BuildCommandData(CommandAddresses, &data)
+	request, err := c.BuildCommandData(address, CommandAddresses, &data)
 
 	if err != nil {
 		return err
@@ -298,7 +648,7 @@ func (c *NodeClient) SendAddrList(address netlib.NodeAddr, addresses []netlib.No
 func (c *NodeClient) SendGetBlock(addr netlib.NodeAddr, blockHash []byte) (*ResponseGetBlock, error) {
 	data := ComGetBlock{blockHash, c.NodeAddress}
 
-	request, err := c.BuildCommandData(CommandGetBlock, &data)
+	request, err := c.BuildCommandData(addr, CommandGetBlock, &data)
 
 	if err != nil {
 		return nil, err
@@ -316,8 +666,10 @@ func (c *NodeClient) SendGetBlock(addr netlib.NodeAddr, blockHash []byte) (*Resp
 
 // Send block to other node
 func (c *NodeClient) SendBlock(addr netlib.NodeAddr, BlockSerialised []byte) error {
-	data := ComBlock{c.NodeAddress, BlockSerialised}
-	request, err := c.BuildCommandData(CommandBlock, &data)
+	data := ComBlock{AddrFrom: c.NodeAddress, Block: BlockSerialised}
+	data.Signature = c.signMessage(data.SignedData()...)
+
+	request, err := c.BuildCommandData(addr, CommandBlock, &data)
 
 	if err != nil {
 		return err
@@ -328,9 +680,10 @@ func (c *NodeClient) SendBlock(addr netlib.NodeAddr, BlockSerialised []byte) err
 
 // Send inventory. Blocks hashes or transactions IDs
 func (c *NodeClient) SendInv(address netlib.NodeAddr, kind string, items [][]byte) error {
-	data := ComInv{c.NodeAddress, kind, items}
+	data := ComInv{AddrFrom: c.NodeAddress, Type: kind, Items: items}
+	data.Signature = c.signMessage(data.SignedData()...)
 
-	request, err := c.BuildCommandData("inv", &data)
+	request, err := c.BuildCommandData(address, "inv", &data)
 
 	if err != nil {
 		return err
@@ -343,7 +696,7 @@ func (c *NodeClient) SendInv(address netlib.NodeAddr, kind string, items [][]byt
 func (c *NodeClient) SendGetBlocks(address netlib.NodeAddr, startfrom []byte) error {
 	data := ComGetBlocks{c.NodeAddress, startfrom}
 
-	request, err := c.BuildCommandData("getblocks", &data)
+	request, err := c.BuildCommandData(address, "getblocks", &data)
 
 	if err != nil {
 		return err
@@ -356,7 +709,7 @@ func (c *NodeClient) SendGetBlocks(address netlib.NodeAddr, startfrom []byte) er
 func (c *NodeClient) SendGetBlocksUpper(address netlib.NodeAddr, startfrom []byte) error {
 	data := ComGetBlocks{c.NodeAddress, startfrom}
 
-	request, err := c.BuildCommandData("getblocksup", &data)
+	request, err := c.BuildCommandData(address, "getblocksup", &data)
 
 	if err != nil {
 		return err
@@ -369,7 +722,7 @@ func (c *NodeClient) SendGetBlocksUpper(address netlib.NodeAddr, startfrom []byt
 // This is used by new nodes
 // TODO we can use SendGetBlocksUpper and empty hash. This will e same
 func (c *NodeClient) SendGetFirstBlocks(address netlib.NodeAddr) (*ComGetFirstBlocksData, error) {
-	request, err := c.BuildCommandData(CommandGetFirstBlocks, nil)
+	request, err := c.BuildCommandData(address, CommandGetFirstBlocks, nil)
 
 	if err != nil {
 		return nil, err
@@ -387,7 +740,7 @@ func (c *NodeClient) SendGetFirstBlocks(address netlib.NodeAddr) (*ComGetFirstBl
 
 // Request for consensus information from a node
 func (c *NodeClient) SendGetConsensusData(address netlib.NodeAddr) (*ComGetConsensusData, error) {
-	request, err := c.BuildCommandData(CommandGetConsensusData, nil)
+	request, err := c.BuildCommandData(address, CommandGetConsensusData, nil)
 
 	if err != nil {
 		return nil, err
@@ -408,7 +761,7 @@ func (c *NodeClient) SendGetData(address netlib.NodeAddr, kind string, id []byte
 
 	data := ComGetData{c.NodeAddress, kind, id}
 
-	request, err := c.BuildCommandData("getdata", &data)
+	request, err := c.BuildCommandData(address, "getdata", &data)
 
 	if err != nil {
 		return err
@@ -417,13 +770,253 @@ func (c *NodeClient) SendGetData(address netlib.NodeAddr, kind string, id []byte
 	return c.SendData(address, request)
 }
 
+// Send compact block to other node. A node which doesn't have some transactions requests them back
+func (c *NodeClient) SendCompactBlock(addr netlib.NodeAddr, blockCompact []byte) error {
+	data := ComCompactBlock{AddrFrom: c.NodeAddress, Block: blockCompact}
+	data.Signature = c.signMessage(data.SignedData()...)
+
+	request, err := c.BuildCommandData(addr, CommandCompactBlock, &data)
+
+	if err != nil {
+		return err
+	}
+
+	return c.SendData(addr, request)
+}
+
+// Requests transactions of a block by indexes in the block
+func (c *NodeClient) SendGetBlockTxs(addr netlib.NodeAddr, blockHash []byte, indexes []int) ([][]byte, error) {
+	data := ComGetBlockTxs{blockHash, indexes}
+
+	request, err := c.BuildCommandData(addr, CommandGetBlockTxs, &data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	datapayload := ResponseGetBlockTxs{}
+
+	err = c.SendDataWaitResponse(addr, request, &datapayload)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(datapayload.Transactions) != len(indexes) {
+		return nil, errors.New("Node returned wrong number of transactions")
+	}
+
+	return datapayload.Transactions, nil
+}
+
+// Request for block headers. Headers are returned from startfrom block and going down
+func (c *NodeClient) SendGetBlockHeaders(addr netlib.NodeAddr, startfrom []byte, maxcount int) ([]ComBlockHeader, error) {
+	data := ComGetBlockHeaders{startfrom, maxcount}
+
+	request, err := c.BuildCommandData(addr, CommandGetBlockHeaders, &data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	datapayload := ResponseGetBlockHeaders{}
+
+	err = c.SendDataWaitResponse(addr, request, &datapayload)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return datapayload.Headers, nil
+}
+
+// Requests full blocks after a block going up. A function is called for every block while they are received,
+// blocks are not kept in memory. Empty startfrom means from the first block, 0 maxcount means till the top
+func (c *NodeClient) SendGetBlocksStream(addr netlib.NodeAddr, startfrom []byte, maxcount int, f func(block []byte) error) error {
+	data := ComGetBlocksStream{startfrom, maxcount, c.NodeAddress}
+
+	request, err := c.BuildCommandData(addr, CommandGetBlocksStream, &data)
+
+	if err != nil {
+		return err
+	}
+
+	format := requestWireFormat(request)
+
+	return c.SendDataWaitResponse(addr, request, streamHandler(func(chunk []byte) error {
+		response := ResponseGetBlock{}
+
+		err := netlib.DecodePayload(format, chunk, &response)
+
+		if err != nil {
+			return netlib.NewCanNotParseResponseError(err.Error())
+		}
+		return f(response.Block)
+	}))
+}
+
+// Requests a snapshot of the DB. The function is called for every chunk while they are received
+func (c *NodeClient) SendGetSnapshot(addr netlib.NodeAddr, f func(chunk *ResponseGetSnapshot) error) error {
+	// a node gives a snapshot to whitelisted peers or with its auth string
+	build := c.BuildCommandData
+
+	if c.NodeAuthStr != "" {
+		build = c.BuildCommandDataWithAuth
+	}
+
+	request, err := build(addr, CommandGetSnapshot, nil)
+
+	if err != nil {
+		return err
+	}
+
+	format := requestWireFormat(request)
+
+	return c.SendDataWaitResponse(addr, request, streamHandler(func(chunk []byte) error {
+		response := ResponseGetSnapshot{}
+
+		err := netlib.DecodePayload(format, chunk, &response)
+
+		if err != nil {
+			return netlib.NewCanNotParseResponseError(err.Error())
+		}
+		return f(&response)
+	}))
+}
+
+// Data of a snapshot signed by a node
+func (i SnapshotInfo) SignedParts() [][]byte {
+	return [][]byte{[]byte(strconv.Itoa(i.Height)), i.TopHash, i.UnspentHash, i.DumpHash, []byte(strconv.FormatInt(i.DumpSize, 10))}
+}
+
+// Request for Merkle proof of a transaction. Returns also header of a block where TX is
+func (c *NodeClient) SendGetTransactionProof(addr netlib.NodeAddr, txID []byte) (*ResponseGetTransactionProof, error) {
+	data := ComGetTransactionProof{txID}
+
+	request, err := c.BuildCommandData(addr, CommandGetTXProof, &data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	datapayload := ResponseGetTransactionProof{}
+
+	err = c.SendDataWaitResponse(addr, request, &datapayload)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &datapayload, nil
+}
+
+// Request public key and address registered for a name
+func (c *NodeClient) SendGetName(addr netlib.NodeAddr, name string) (*ResponseGetName, error) {
+	return c.sendGetName(addr, ComGetName{Name: name})
+}
+
+// Request a name registered for an address
+func (c *NodeClient) SendGetNameByAddress(addr netlib.NodeAddr, address string) (*ResponseGetName, error) {
+	return c.sendGetName(addr, ComGetName{Address: address})
+}
+
+func (c *NodeClient) sendGetName(addr netlib.NodeAddr, data ComGetName) (*ResponseGetName, error) {
+	request, err := c.BuildCommandData(addr, CommandGetName, &data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	datapayload := ResponseGetName{}
+
+	err = c.SendDataWaitResponse(addr, request, &datapayload)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &datapayload, nil
+}
+
+// Request checksums of table rows from other node
+func (c *NodeClient) SendGetChecksums(addr netlib.NodeAddr, table string, group int, exclude []string) (*ResponseGetChecksums, error) {
+	data := ComGetChecksums{table, group, exclude}
+
+	request, err := c.BuildCommandData(addr, CommandGetChecksums, &data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	datapayload := ResponseGetChecksums{}
+
+	err = c.SendDataWaitResponse(addr, request, &datapayload)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &datapayload, nil
+}
+
+// Request a large value by its hash from other node
+func (c *NodeClient) SendGetBlob(addr netlib.NodeAddr, hash []byte) (*ResponseGetBlob, error) {
+	data := ComGetBlob{hash}
+
+	request, err := c.BuildCommandData(addr, CommandGetBlob, &data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	datapayload := ResponseGetBlob{}
+
+	err = c.SendDataWaitResponse(addr, request, &datapayload)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &datapayload, nil
+}
+
+// Checks if a node is alive. Returns the round trip time. A ping is not retried, overall timeout is
+// defaultPingTimeout if it is not set
+func (c *NodeClient) SendPing(addr netlib.NodeAddr) (time.Duration, error) {
+	data := ComPing{c.NodeAddress}
+
+	request, err := c.BuildCommandData(addr, CommandPing, &data)
+
+	if err != nil {
+		return 0, err
+	}
+
+	timeouts := c.GetTimeouts(CommandPing)
+
+	if timeouts.Overall == 0 {
+		timeouts.Overall = defaultPingTimeout
+	}
+
+	datapayload := ResponsePing{}
+
+	start := time.Now()
+
+	err = c.SendDataWaitResponseTimeouts(addr, request, &datapayload, timeouts)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Since(start), nil
+}
+
 // Get tranaction with sycn request. Wait response
 func (c *NodeClient) SendGetTransaction(addr netlib.NodeAddr, txID []byte) (*ResponseGetTransaction, error) {
 	data := ComGetTransaction{}
 	data.TransactionID = txID
 	data.AddrFrom = c.NodeAddress
 
-	request, err := c.BuildCommandData(CommandGetTransaction, &data)
+	request, err := c.BuildCommandData(addr, CommandGetTransaction, &data)
 
 	if err != nil {
 		return nil, err
@@ -446,7 +1039,7 @@ func (c *NodeClient) SendCheckBlock(addr netlib.NodeAddr, hash []byte) (*Respons
 	data.BlockHash = hash
 	data.AddrFrom = c.NodeAddress
 
-	request, err := c.BuildCommandData(CommandCheckBlock, &data)
+	request, err := c.BuildCommandData(addr, CommandCheckBlock, &data)
 
 	if err != nil {
 		return nil, err
@@ -466,7 +1059,7 @@ func (c *NodeClient) SendCheckBlock(addr netlib.NodeAddr, hash []byte) (*Respons
 // Send Transaction to other node
 func (c *NodeClient) SendTx(addr netlib.NodeAddr, tnxserialised []byte) error {
 	data := ComTx{c.NodeAddress, tnxserialised}
-	request, err := c.BuildCommandData("tx", &data)
+	request, err := c.BuildCommandData(addr, "tx", &data)
 
 	if err != nil {
 		return err
@@ -477,9 +1070,9 @@ func (c *NodeClient) SendTx(addr netlib.NodeAddr, tnxserialised []byte) error {
 
 // Send own version and blockchain state to other node
 func (c *NodeClient) SendVersion(addr netlib.NodeAddr, bestHeight int) error {
-	data := ComVersion{netlib.NodeVersion, bestHeight, c.NodeAddress}
+	data := ComVersion{netlib.NodeVersion, bestHeight, c.NodeAddress, time.Now().Unix(), netlib.WireFormats}
 
-	request, err := c.BuildCommandData("version", &data)
+	request, err := c.BuildCommandData(addr, "version", &data)
 
 	if err != nil {
 		return err
@@ -490,9 +1083,21 @@ func (c *NodeClient) SendVersion(addr netlib.NodeAddr, bestHeight int) error {
 
 // Request for history of transaction from a wallet
 func (c *NodeClient) SendGetHistory(addr netlib.NodeAddr, address string) ([]ComHistoryTransaction, error) {
-	data := ComGetHistoryTransactions{address}
+	return c.SendGetHistoryPage(addr, address, nil, 0)
+}
 
-	request, err := c.BuildCommandData("gethistory", &data)
+// Request for a page of history of transaction from a wallet. Newest records first. A page starts after
+// the last record of previous page, nil for the first page
+func (c *NodeClient) SendGetHistoryPage(addr netlib.NodeAddr, address string, after *ComHistoryTransaction, limit int) ([]ComHistoryTransaction, error) {
+	data := ComGetHistoryTransactions{Address: address, Limit: limit}
+
+	if after != nil {
+		data.AfterBlock = after.BlockHash
+		data.AfterTX = after.TXID
+		data.AfterIOType = after.IOType
+	}
+
+	request, err := c.BuildCommandData(addr, "gethistory", &data)
 
 	if err != nil {
 		return nil, err
@@ -516,7 +1121,7 @@ func (c *NodeClient) SendNewTransactionData(addr netlib.NodeAddr, from string, t
 	data.TX = txBytes
 	data.Signature = signature
 
-	request, err := c.BuildCommandData("txdata", &data)
+	request, err := c.BuildCommandData(addr, "txdata", &data)
 
 	NewTXID := []byte{}
 
@@ -539,12 +1144,20 @@ func (c *NodeClient) SendNewTransactionData(addr netlib.NodeAddr, from string, t
 func (c *NodeClient) SendRequestNewCurrencyTransaction(addr netlib.NodeAddr,
 	PubKey []byte, to string, amount float64) ([]byte, []byte, error) {
 
+	return c.SendRequestNewCurrencyTransactionWithChange(addr, PubKey, to, amount, "")
+}
+
+// Request to prepare new transaction by wallet where a change is sent to other address
+func (c *NodeClient) SendRequestNewCurrencyTransactionWithChange(addr netlib.NodeAddr,
+	PubKey []byte, to string, amount float64, change string) ([]byte, []byte, error) {
+
 	data := ComRequestTransaction{}
 	data.PubKey = PubKey
 	data.To = to
 	data.Amount = amount
+	data.ChangeAddress = change
 
-	request, err := c.BuildCommandData("txcurrequest", &data)
+	request, err := c.BuildCommandData(addr, "txcurrequest", &data)
 
 	if err != nil {
 		return nil, nil, err
@@ -571,7 +1184,7 @@ func (c *NodeClient) SendRequestNewSQLTransaction(addr netlib.NodeAddr,
 	data.PubKey = PubKey
 	data.SQL = sqlcommand
 
-	request, err := c.BuildCommandData("txsqlrequest", &data)
+	request, err := c.BuildCommandData(addr, "txsqlrequest", &data)
 
 	if err != nil {
 		return false, nil, nil, err
@@ -593,7 +1206,7 @@ func (c *NodeClient) SendRequestNewSQLTransaction(addr netlib.NodeAddr,
 func (c *NodeClient) SendGetUnspent(addr netlib.NodeAddr, address string, chaintip []byte) (ComUnspentTransactions, error) {
 	data := ComGetUnspentTransactions{address, chaintip}
 
-	request, err := c.BuildCommandData("getunspent", &data)
+	request, err := c.BuildCommandData(addr, "getunspent", &data)
 
 	datapayload := ComUnspentTransactions{}
 
@@ -611,7 +1224,7 @@ func (c *NodeClient) SendGetUnspent(addr netlib.NodeAddr, address string, chaint
 func (c *NodeClient) SendGetBalance(addr netlib.NodeAddr, address string) (ComWalletBalance, error) {
 	data := ComGetWalletBalance{address}
 
-	request, err := c.BuildCommandData(CommandGetBalance, &data)
+	request, err := c.BuildCommandData(addr, CommandGetBalance, &data)
 
 	datapayload := ComWalletBalance{}
 
@@ -626,7 +1239,7 @@ func (c *NodeClient) SendGetBalance(addr netlib.NodeAddr, address string) (ComWa
 
 // Request for list of nodes in contacts
 func (c *NodeClient) SendGetNodes() ([]netlib.NodeAddr, error) {
-	request, err := c.BuildCommandData("getnodes", nil)
+	request, err := c.BuildCommandData(c.NodeAddress, "getnodes", nil)
 
 	datapayload := []netlib.NodeAddr{}
 
@@ -642,7 +1255,7 @@ func (c *NodeClient) SendGetNodes() ([]netlib.NodeAddr, error) {
 // Request to add new node to contacts
 func (c *NodeClient) SendAddNode(node netlib.NodeAddr) error {
 	data := ComManageNode{node}
-	request, err := c.BuildCommandDataWithAuth("addnode", &data)
+	request, err := c.BuildCommandDataWithAuth(c.NodeAddress, "addnode", &data)
 
 	err = c.SendDataWaitResponse(c.NodeAddress, request, nil)
 
@@ -656,7 +1269,7 @@ func (c *NodeClient) SendAddNode(node netlib.NodeAddr) error {
 // Request to remove a node from contacts
 func (c *NodeClient) SendRemoveNode(node netlib.NodeAddr) error {
 	data := ComManageNode{node}
-	request, err := c.BuildCommandDataWithAuth("removenode", &data)
+	request, err := c.BuildCommandDataWithAuth(c.NodeAddress, "removenode", &data)
 
 	err = c.SendDataWaitResponse(c.NodeAddress, request, nil)
 
@@ -667,9 +1280,131 @@ func (c *NodeClient) SendRemoveNode(node netlib.NodeAddr) error {
 	return nil
 }
 
+// Request to change enabled logs of a node
+func (c *NodeClient) SendSetLogs(logs string) (string, error) {
+	request, err := c.BuildCommandDataWithAuth(c.NodeAddress, CommandSetLogs, &ComSetLogs{logs})
+
+	if err != nil {
+		return "", err
+	}
+
+	data := ResponseSetLogs{}
+
+	err = c.SendDataWaitResponse(c.NodeAddress, request, &data)
+
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Set logs error: %s", err.Error()))
+	}
+
+	return data.State, nil
+}
+
+// Request for banned peers of a node
+func (c *NodeClient) SendGetBans() ([]netlib.Ban, error) {
+	request, err := c.BuildCommandDataWithAuth(c.NodeAddress, CommandGetBans, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data := ResponseGetBans{}
+
+	err = c.SendDataWaitResponse(c.NodeAddress, request, &data)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Get bans error: %s", err.Error()))
+	}
+
+	return data.Bans, nil
+}
+
+// Request to remove a ban of a peer, or all bans if host is empty. Returns number of removed bans
+func (c *NodeClient) SendClearBans(host string) (int, error) {
+	request, err := c.BuildCommandDataWithAuth(c.NodeAddress, CommandClearBans, &ComClearBans{host})
+
+	if err != nil {
+		return 0, err
+	}
+
+	data := ResponseClearBans{}
+
+	err = c.SendDataWaitResponse(c.NodeAddress, request, &data)
+
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("Clear bans error: %s", err.Error()))
+	}
+
+	return data.Count, nil
+}
+
+// Request for current settings of a node
+func (c *NodeClient) SendGetSettings() (NodeSettings, error) {
+	request, err := c.BuildCommandDataWithAuth(c.NodeAddress, CommandGetSettings, nil)
+
+	if err != nil {
+		return NodeSettings{}, err
+	}
+
+	data := ResponseSettings{}
+
+	err = c.SendDataWaitResponse(c.NodeAddress, request, &data)
+
+	if err != nil {
+		return NodeSettings{}, errors.New(fmt.Sprintf("Get settings error: %s", err.Error()))
+	}
+
+	return data.Settings, nil
+}
+
+// Changes settings of a node. Returns settings after the change
+func (c *NodeClient) SendSetSettings(settings NodeSettings, save bool) (NodeSettings, error) {
+	request, err := c.BuildCommandDataWithAuth(c.NodeAddress, CommandSetSettings, &ComSetSettings{settings, save})
+
+	if err != nil {
+		return NodeSettings{}, err
+	}
+
+	data := ResponseSettings{}
+
+	err = c.SendDataWaitResponse(c.NodeAddress, request, &data)
+
+	if err != nil {
+		return NodeSettings{}, errors.New(fmt.Sprintf("Set settings error: %s", err.Error()))
+	}
+
+	return data.Settings, nil
+}
+
+// Get a profile of a node. Waits while the profile is collected
+func (c *NodeClient) SendProfile(profileType string, seconds int) ([]byte, error) {
+	request, err := c.BuildCommandDataWithAuth(c.NodeAddress, CommandProfile, &ComProfile{profileType, seconds})
+
+	if err != nil {
+		return nil, err
+	}
+
+	data := ResponseProfile{}
+
+	// a node responds when the profile is collected
+	timeouts := c.GetTimeouts(CommandProfile)
+	timeouts.Read += seconds * 1000
+
+	if timeouts.Overall > 0 {
+		timeouts.Overall += seconds * 1000
+	}
+
+	err = c.SendDataWaitResponseTimeouts(c.NodeAddress, request, &data, timeouts)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Profile error: %s", err.Error()))
+	}
+
+	return data.Data, nil
+}
+
 // Get node blockchain height
 func (c *NodeClient) SendGetState() (ComGetNodeState, error) {
-	request, err := c.BuildCommandDataWithAuth(CommandGetState, nil)
+	request, err := c.BuildCommandDataWithAuth(c.NodeAddress, CommandGetState, nil)
 
 	data := ComGetNodeState{}
 
@@ -690,7 +1425,7 @@ func (c *NodeClient) SendGetUpdates(addr netlib.NodeAddr, lastCheckTime int64, b
 	data.CurrentBlockHeight = blockHeight
 	data.TopBlocks = topBlocks
 
-	request, err := c.BuildCommandData(CommandGetUpdates, &data)
+	request, err := c.BuildCommandData(addr, CommandGetUpdates, &data)
 
 	if err != nil {
 		return nil, err
@@ -708,23 +1443,36 @@ func (c *NodeClient) SendGetUpdates(addr netlib.NodeAddr, lastCheckTime int64, b
 }
 
 // Builds a command data. It prepares a slice of bytes from given data
-func (c *NodeClient) BuildCommandDataWithAuth(command string, data interface{}) ([]byte, error) {
-	authbytes := netlib.CommandToBytes(c.NodeAuthStr)
-	return c.doBuildCommandData(command, data, authbytes)
+// The auth string is not sent, a request gets a signature made with it when it is sent
+func (c *NodeClient) BuildCommandDataWithAuth(addr netlib.NodeAddr, command string, data interface{}) ([]byte, error) {
+	request, err := c.doBuildCommandData(c.wireFormatFor(addr), command, data, []byte{})
+
+	if err != nil {
+		return nil, err
+	}
+	return setExtraData(request, nil, netlib.RequestFlagSigned), nil
 }
 
-// Builds a command data. It prepares a slice of bytes from given data
-func (c *NodeClient) BuildCommandData(command string, data interface{}) ([]byte, error) {
-	return c.doBuildCommandData(command, data, []byte{})
+// Builds a command data for a node. It prepares a slice of bytes from given data
+func (c *NodeClient) BuildCommandData(addr netlib.NodeAddr, command string, data interface{}) ([]byte, error) {
+	return c.doBuildCommandData(c.wireFormatFor(addr), command, data, []byte{})
+}
+
+// Format of payloads of requests to a node. It is gob for a peer which didn't tell it accepts protobuf
+func (c *NodeClient) wireFormatFor(addr netlib.NodeAddr) string {
+	if c.PeerFormats == nil || addr.CompareToAddress(c.NodeAddress) {
+		return c.WireFormat
+	}
+	return c.PeerFormats.Get(addr, c.WireFormat)
 }
 
 // Builds a command data. It prepares a slice of bytes from given data
-func (c *NodeClient) doBuildCommandData(command string, data interface{}, extra []byte) ([]byte, error) {
+func (c *NodeClient) doBuildCommandData(format string, command string, data interface{}, extra []byte) ([]byte, error) {
 	var payload []byte
 	var err error
 
 	if data != nil {
-		payload, err = netlib.GobEncode(data)
+		payload, err = netlib.EncodePayload(format, data)
 
 		if err != nil {
 			return nil, err
@@ -752,19 +1500,54 @@ func (c *NodeClient) doBuildCommandData(command string, data interface{}, extra
 		request = append(request, extra...)
 	}
 
+	if format == netlib.WireFormatProtobuf {
+		request = setExtraData(request, nil, netlib.RequestFlagProtobuf)
+	}
+
 	return request, nil
 }
 
 // Sends prepared command to a node. This doesn't wait any response
 func (c *NodeClient) SendData(addr netlib.NodeAddr, data []byte) error {
+	span := c.startRequestSpan(addr, data)
+
+	start := time.Now()
+
+	err := c.sendData(addr, c.addTraceContext(data, span))
+
+	c.Metrics.recordRequest(addr, requestCommand(data), time.Since(start), err)
+
+	err = contextError(c.Context(), err)
+
+	span.End(err)
+
+	return err
+}
+
+func (c *NodeClient) sendData(addr netlib.NodeAddr, data []byte) error {
 	err := c.CheckNodeAddress(addr)
 
 	if err != nil {
 		return err
 	}
 
+	timeouts := c.GetTimeouts(requestCommand(data))
+
+	err = c.RateLimiter.Wait(c.Context(), addr)
+
+	if err != nil {
+		return err
+	}
+
+	release, err := c.Outbound.Acquire(c.Context(), timeouts.duration(timeouts.Write))
+
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	//c.Logger.Trace.Printf("Sending %d bytes to %s", len(data), addr.NodeAddrToString())
-	conn, err := net.DialTimeout(netlib.Protocol, addr.NodeAddrToString(), 1*time.Second)
+	conn, err := c.getTransport().Dial(dialContext(c.Context(), data), addr, timeouts.duration(timeouts.Dial))
 
 	if err != nil {
 		c.Logger.Error.Println(err.Error())
@@ -777,9 +1560,14 @@ func (c *NodeClient) SendData(addr netlib.NodeAddr, data []byte) error {
 		//c.NodeNet.RemoveNodeFromKnown(addr)
 		return netlib.NewCanNotConnectError(fmt.Sprintf("%s is not available", addr.NodeAddrToString()))
 	}
+	conn = c.Bandwidth.Wrap(c.Metrics.countConn(addr, netlib.WrapConn(conn)), addr.Host)
 	defer conn.Close()
+	defer watchContext(c.Context(), conn)()
 
-	_, err = io.Copy(conn, bytes.NewReader(data))
+	overall := c.requestDeadline(timeouts)
+	conn.SetWriteDeadline(timeouts.deadline(timeouts.Write, overall))
+
+	_, err = io.Copy(conn, bytes.NewReader(c.signRequest(data)))
 
 	if err != nil {
 		c.Logger.Error.Println(err.Error())
@@ -792,6 +1580,191 @@ func (c *NodeClient) SendData(addr netlib.NodeAddr, data []byte) error {
 
 // Send data to a node and wait for response
 func (c *NodeClient) SendDataWaitResponse(addr netlib.NodeAddr, data []byte, datapayload interface{}) error {
+	return c.SendDataWaitResponseTimeouts(addr, data, datapayload, c.GetTimeouts(requestCommand(data)))
+}
+
+// Same as SendDataWaitResponse with given timeouts
+func (c *NodeClient) SendDataWaitResponseTimeouts(addr netlib.NodeAddr, data []byte, datapayload interface{}, timeouts Timeouts) error {
+	span := c.startRequestSpan(addr, data)
+
+	data = c.addTraceContext(data, span)
+
+	err := c.withRetries(requestCommand(data), func() error {
+		start := time.Now()
+
+		err := c.sendDataWaitResponse(addr, data, datapayload, timeouts)
+
+		c.Metrics.recordRequest(addr, requestCommand(data), time.Since(start), err)
+
+		return err
+	})
+
+	err = contextError(c.Context(), err)
+
+	span.End(err)
+
+	return err
+}
+
+// Returns a command of a prepared request
+func requestCommand(data []byte) string {
+	if len(data) < netlib.CommandLength {
+		return ""
+	}
+	return netlib.BytesToCommand(data[:netlib.CommandLength])
+}
+
+func (c *NodeClient) startRequestSpan(addr netlib.NodeAddr, data []byte) *tracing.Span {
+	if c.Trace == nil || len(data) < netlib.CommandLength {
+		return nil
+	}
+	span := c.Trace.Start("request "+netlib.BytesToCommand(data[:netlib.CommandLength]), tracing.KindClient)
+
+	span.SetAttribute("net.peer.name", addr.NodeAddrToString())
+
+	return span
+}
+
+// Context of a span is added to extra data of a request, after the auth string.
+// A server reads the auth string from first CommandLength bytes of extra data
+func (c *NodeClient) addTraceContext(data []byte, span *tracing.Span) []byte {
+	if span == nil {
+		return data
+	}
+	return setExtraData(data, []byte(span.Context().TraceParent()), 0)
+}
+
+// Splits extra data of a prepared request. Extra data starts with auth string, it is padded to full length
+// if there is more data. Then a trace context and a byte of flags go, both are optional.
+// A signed request has the trace context (zeros if it is not set), the flags and the signature
+func splitExtraData(data []byte) (auth []byte, traceparent []byte, flags byte, signature []byte, ok bool) {
+	if len(data) < netlib.CommandLength+8 {
+		return
+	}
+	payloadlength := binary.LittleEndian.Uint32(data[netlib.CommandLength:])
+	extralength := binary.LittleEndian.Uint32(data[netlib.CommandLength+4:])
+
+	start := netlib.CommandLength + 8 + int(payloadlength)
+
+	if len(data) != start+int(extralength) {
+		return
+	}
+	ok = true
+	auth = data[start:]
+
+	if len(auth) <= netlib.CommandLength {
+		return
+	}
+	rest := auth[netlib.CommandLength:]
+	auth = auth[:netlib.CommandLength]
+
+	if len(rest) >= tracing.TraceParentLength {
+		traceparent = rest[:tracing.TraceParentLength]
+		rest = rest[tracing.TraceParentLength:]
+	}
+
+	if len(rest) > 0 {
+		flags = rest[0]
+		signature = rest[1:]
+	}
+	return
+}
+
+// Sets a trace context in extra data of a prepared request and adds flags to flags of the request.
+// Empty trace context keeps the context which is in the request
+func setExtraData(data []byte, traceparent []byte, flags byte) []byte {
+	auth, oldtraceparent, oldflags, signature, ok := splitExtraData(data)
+
+	if !ok {
+		return data
+	}
+
+	if len(traceparent) == 0 {
+		traceparent = oldtraceparent
+	}
+	flags |= oldflags
+
+	return buildExtraData(data, auth, traceparent, flags, signature)
+}
+
+// Replaces extra data of a prepared request
+func buildExtraData(data []byte, auth []byte, traceparent []byte, flags byte, signature []byte) []byte {
+	extra := append([]byte{}, auth...)
+
+	if flags&netlib.RequestFlagSigned > 0 {
+		if len(signature) != netlib.RequestSignatureLength {
+			signature = make([]byte, netlib.RequestSignatureLength)
+		}
+		if len(traceparent) == 0 {
+			// the signature must not be read as a trace context
+			traceparent = make([]byte, tracing.TraceParentLength)
+		}
+	} else {
+		signature = nil
+	}
+
+	if len(traceparent) > 0 || flags > 0 {
+		if len(extra) < netlib.CommandLength {
+			extra = append(extra, make([]byte, netlib.CommandLength-len(extra))...)
+		}
+		extra = append(extra, traceparent...)
+	}
+
+	if flags > 0 {
+		extra = append(extra, flags)
+		extra = append(extra, signature...)
+	}
+
+	payloadlength := binary.LittleEndian.Uint32(data[netlib.CommandLength:])
+
+	request := append([]byte{}, data[:netlib.CommandLength+4]...)
+
+	bs := make([]byte, 4)
+	binary.LittleEndian.PutUint32(bs, uint32(len(extra)))
+
+	request = append(request, bs...)
+	request = append(request, data[netlib.CommandLength+8:netlib.CommandLength+8+int(payloadlength)]...)
+
+	return append(request, extra...)
+}
+
+// Signs a request which needs auth. Every attempt gets new signature, so a node doesn't see a retry as a replay
+func (c *NodeClient) signRequest(data []byte) []byte {
+	auth, traceparent, flags, _, ok := splitExtraData(data)
+
+	if !ok || flags&netlib.RequestFlagSigned == 0 {
+		return data
+	}
+
+	payloadlength := binary.LittleEndian.Uint32(data[netlib.CommandLength:])
+	payload := data[netlib.CommandLength+8 : netlib.CommandLength+8+int(payloadlength)]
+
+	signature := netlib.SignRequest(c.NodeAuthStr, requestCommand(data), payload)
+
+	return buildExtraData(data, auth, traceparent, flags, signature)
+}
+
+// Management requests go on a connection with a certificate of an operator if it is set
+func dialContext(ctx context.Context, data []byte) context.Context {
+	_, _, flags, _, _ := splitExtraData(data)
+
+	if flags&netlib.RequestFlagSigned > 0 {
+		return netlib.WithManageCertificate(ctx)
+	}
+	return ctx
+}
+
+// Returns format of a payload of a prepared request
+func requestWireFormat(data []byte) string {
+	_, _, flags, _, _ := splitExtraData(data)
+
+	if flags&netlib.RequestFlagProtobuf > 0 {
+		return netlib.WireFormatProtobuf
+	}
+	return netlib.WireFormatGob
+}
+
+func (c *NodeClient) sendDataWaitResponse(addr netlib.NodeAddr, data []byte, datapayload interface{}, timeouts Timeouts) error {
 
 	err := c.CheckNodeAddress(addr)
 
@@ -802,9 +1775,21 @@ func (c *NodeClient) SendDataWaitResponse(addr netlib.NodeAddr, data []byte, dat
 
 	c.Logger.TraceExt.Println("Sending data to " + addr.NodeAddrToString() + " and waiting response")
 
+	err = c.RateLimiter.Wait(c.Context(), addr)
+
+	if err != nil {
+		return err
+	}
+
+	release, err := c.Outbound.Acquire(c.Context(), timeouts.duration(timeouts.Write))
+
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	// connect
-	dialer := net.Dialer{Timeout: time.Second * 2}
-	conn, err := dialer.Dial(netlib.Protocol, addr.NodeAddrToString())
+	conn, err := c.getTransport().Dial(dialContext(c.Context(), data), addr, timeouts.duration(timeouts.Dial))
 
 	if err != nil {
 		c.Logger.Error.Println(err.Error())
@@ -817,7 +1802,24 @@ func (c *NodeClient) SendDataWaitResponse(addr netlib.NodeAddr, data []byte, dat
 		//c.NodeNet.RemoveNodeFromKnown(addr)
 		return netlib.NewCanNotConnectError(fmt.Sprintf("%s is not available", addr.NodeAddrToString()))
 	}
+	conn = c.Bandwidth.Wrap(c.Metrics.countConn(addr, netlib.WrapConn(conn)), addr.Host)
 	defer conn.Close()
+	defer watchContext(c.Context(), conn)()
+
+	// ask for a response with length and checksum. Older nodes don't know the checksum flag and respond with length only
+	flags := netlib.RequestFlagFramedResponse | netlib.RequestFlagChecksum
+
+	handler, streamed := datapayload.(streamHandler)
+
+	if streamed {
+		flags |= netlib.RequestFlagStreamResponse
+	}
+	data = c.signRequest(setExtraData(data, nil, flags))
+
+	format := requestWireFormat(data)
+
+	overall := c.requestDeadline(timeouts)
+	conn.SetWriteDeadline(timeouts.deadline(timeouts.Write, overall))
 
 	//c.Logger.Trace.Printf("Sending %d bytes ", len(data))
 	// send command bytes
@@ -826,55 +1828,122 @@ func (c *NodeClient) SendDataWaitResponse(addr netlib.NodeAddr, data []byte, dat
 	if err != nil {
 		c.Logger.Error.Println(err.Error())
 		c.Logger.Trace.Println("Error: ", err.Error())
+
+		if isTimeoutError(err) {
+			return netlib.NewCanNotSendError(err.Error())
+		}
 		return err
 	}
-	// read response
-	// read everything
-	//c.Logger.Trace.Println("Start readin response")
-
-	response, err := ioutil.ReadAll(conn)
+	// read response. payload is decoded directly from the connection
+	success, payload, err := netlib.ReadResponseMax(&deadlineReader{conn, timeouts, overall}, c.maxResponseSize())
 
-	if err != nil {
+	if err == io.EOF {
+		err := netlib.NewNoResponseError("Received 0 bytes as a response. Expected at least 1 byte")
 		c.Logger.Error.Println(err.Error())
 		c.Logger.Trace.Println("Response Read Error: ", err.Error())
-		return netlib.NewCanNotSendError(err.Error())
+		return err
 	}
 
-	if len(response) == 0 {
-		err := netlib.NewNoResponseError("Received 0 bytes as a response. Expected at least 1 byte")
+	if isTimeoutError(err) {
+		err := netlib.NewNoResponseError(fmt.Sprintf("No response from %s before timeout", addr.NodeAddrToString()))
 		c.Logger.Error.Println(err.Error())
-		c.Logger.Trace.Println("Response Read Error: ", err.Error())
 		return err
 	}
 
-	c.Logger.TraceExt.Printf("Received %d bytes as a response\n", len(response))
+	if err != nil {
+		c.Logger.Error.Println(err.Error())
+		c.Logger.Trace.Println("Response Read Error: ", err.Error())
+		return responseReadError(err, netlib.NewCanNotSendError)
+	}
+
+	if !success {
+		// fail. error of a node has a code
+		response, err := ioutil.ReadAll(payload)
+
+		if err != nil {
+			return responseReadError(err, netlib.NewCanNotSendError)
+		}
+		return netlib.DecodeErrorResponseAs(format, response)
+	}
+
+	if streamed {
+		return c.readStream(addr, payload, format, handler)
+	}
 
 	// convert response for provided structure
-	var buff bytes.Buffer
-	buff.Write(response[1:])
-	dec := gob.NewDecoder(&buff)
+	if datapayload != nil && format == netlib.WireFormatProtobuf {
+		response, err := ioutil.ReadAll(payload)
 
-	if response[0] != 1 {
-		// fail
+		if err == nil {
+			err = netlib.ProtobufDecode(response, datapayload)
+		}
 
-		var payload string
+		if err != nil {
+			return responseReadError(err, netlib.NewCanNotParseResponseError)
+		}
+	} else if datapayload != nil {
+		err = gob.NewDecoder(payload).Decode(datapayload)
 
-		err := dec.Decode(&payload)
+		// a corrupted payload can fail to decode, its checksum error is returned then
+		if finishErr := netlib.FinishPayload(payload); finishErr != nil {
+			err = finishErr
+		}
 
 		if err != nil {
-			return netlib.NewCanNotParseResponseError(err.Error())
+			return responseReadError(err, netlib.NewCanNotParseResponseError)
 		}
+	}
+
+	return nil
+}
+
+func (c *NodeClient) maxResponseSize() int64 {
+	if c.MaxResponseSize > 0 {
+		return c.MaxResponseSize
+	}
+	return netlib.DefaultMaxResponseSize
+}
+
+// A response longer than the limit or with wrong checksum keeps its error, other errors of reading are wrapped
+func responseReadError(err error, wrap func(string) error) error {
+	if code := netlib.GetErrorCode(err); code == netlib.ErrorCodeResponseTooLarge || code == netlib.ErrorCodeChecksumMismatch {
+		return err
+	}
+	return wrap(err.Error())
+}
+
+// Reads chunks of a streamed response and calls the handler for every chunk
+func (c *NodeClient) readStream(addr netlib.NodeAddr, payload io.Reader, format string, handler streamHandler) error {
+	stream, ok := payload.(*netlib.StreamReader)
 
-		return errors.New(payload)
+	if !ok {
+		return netlib.NewCanNotParseResponseError("Response is not streamed")
 	}
 
-	if datapayload != nil {
-		err = dec.Decode(datapayload)
+	for {
+		chunk, isError, err := stream.Next()
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if isTimeoutError(err) {
+			return netlib.NewNoResponseError(fmt.Sprintf("No data from %s before timeout", addr.NodeAddrToString()))
+		}
 
 		if err != nil {
-			return netlib.NewCanNotParseResponseError(err.Error())
+			c.Logger.Trace.Println("Stream Read Error: ", err.Error())
+			return responseReadError(err, netlib.NewCanNotSendError)
 		}
-	}
 
-	return nil
+		if isError {
+			return netlib.DecodeErrorResponseAs(format, chunk)
+		}
+
+		err = handler(chunk)
+
+		if err != nil {
+			return err
+		}
+	}
 }
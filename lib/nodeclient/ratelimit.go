@@ -0,0 +1,147 @@
+package nodeclient
+
+/*
+* Limit of rate of requests to every node. A node which syncs sends many requests and other node can take it
+* as a flood and ban it. Every destination has a token bucket, a request takes a token, tokens are added with
+* the rate till the burst. When there are no tokens a request waits
+ */
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	netlib "github.com/gelembjuk/oursql/lib/net"
+)
+
+// Rate of requests to a node. Rate 0 means no limit
+type RateLimit struct {
+	Rate  float64 // requests per second
+	Burst int     // requests which can be sent at once, default 1
+}
+
+type RateLimitConfig struct {
+	// for all nodes
+	Default RateLimit
+	// per address of a node, like "10.0.0.1:8765". It replaces the default
+	Peers map[string]RateLimit
+}
+
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Buckets of all nodes. Copies of a client share it
+type RateLimiter struct {
+	config  RateLimitConfig
+	lock    sync.Mutex
+	buckets map[string]*rateBucket
+}
+
+// Returns nil if no limits are set
+func NewRateLimiter(config RateLimitConfig) *RateLimiter {
+	if config.Default.Rate <= 0 && len(config.Peers) == 0 {
+		return nil
+	}
+
+	peers := map[string]RateLimit{}
+
+	for addr, limit := range config.Peers {
+		// same address can be written in other way
+		naddr := netlib.NodeAddr{}
+
+		if naddr.LoadFromString(addr) == nil {
+			addr = naddr.NodeAddrToString()
+		}
+		peers[addr] = limit
+	}
+	config.Peers = peers
+
+	return &RateLimiter{config: config, buckets: map[string]*rateBucket{}}
+}
+
+func (l *RateLimiter) getLimit(addr string) RateLimit {
+	if limit, ok := l.config.Peers[addr]; ok {
+		return limit
+	}
+	return l.config.Default
+}
+
+// Takes a token and returns how long to wait till it is available
+func (l *RateLimiter) reserve(addr string) time.Duration {
+	limit := l.getLimit(addr)
+
+	if limit.Rate <= 0 {
+		return 0
+	}
+
+	burst := float64(limit.Burst)
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+
+	b, ok := l.buckets[addr]
+
+	if !ok {
+		b = &rateBucket{tokens: burst, last: now}
+		l.buckets[addr] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * limit.Rate
+	b.last = now
+
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+
+	// tokens can be less than 0, next requests wait longer
+	b.tokens--
+
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / limit.Rate * float64(time.Second))
+}
+
+// Returns a token which was not used
+func (l *RateLimiter) release(addr string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if b, ok := l.buckets[addr]; ok {
+		b.tokens++
+	}
+}
+
+// Waits till a request can be sent to a node. Returns an error if the context is done before
+func (l *RateLimiter) Wait(ctx context.Context, addr netlib.NodeAddr) error {
+	if l == nil {
+		return nil
+	}
+
+	key := addr.NodeAddrToString()
+
+	pause := l.reserve(key)
+
+	if pause == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(pause)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.release(key)
+		return ctx.Err()
+	}
+}
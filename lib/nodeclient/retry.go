@@ -0,0 +1,118 @@
+package nodeclient
+
+/*
+* Retries of requests which don't change anything on a node, so same request can be sent again safely.
+* A request is retried only when a node was not available, didn't respond or its response was corrupted,
+* other errors are returned at once.
+* A pause before next attempt is doubled every time
+ */
+
+import (
+	"math/rand"
+	"time"
+
+	netlib "github.com/gelembjuk/oursql/lib/net"
+)
+
+// Retry policy of requests. 0 means a default value
+type RetryPolicy struct {
+	MaxAttempts int // all attempts, 1 means no retries
+	Backoff     int // milliseconds before second attempt
+	MaxBackoff  int // milliseconds, longest pause
+}
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryBackoff     = 200
+	defaultRetryMaxBackoff  = 5000
+)
+
+// Commands which only read data of a node
+var idempotentCommands = map[string]bool{
+	CommandGetBlock:         true,
+	CommandGetTransaction:   true,
+	CommandGetBalance:       true,
+	CommandGetFirstBlocks:   true,
+	CommandGetConsensusData: true,
+	CommandGetBlockHeaders:  true,
+	CommandGetBlockTxs:      true,
+	CommandGetTXProof:       true,
+	CommandGetName:          true,
+	CommandGetChecksums:     true,
+	CommandGetBlob:          true,
+	CommandCheckBlock:       true,
+	CommandGetState:         true,
+	CommandGetUpdates:       true,
+	"getunspent":            true,
+	"gethistory":            true,
+	"getnodes":              true,
+}
+
+func IsIdempotentCommand(command string) bool {
+	return idempotentCommands[command]
+}
+
+// Only a node which was not available, didn't respond or sent a corrupted response can respond to next attempt
+func isRetryableNetworkError(err error) bool {
+	code := netlib.GetErrorCode(err)
+
+	return code == netlib.ErrorCodeCanNotConnect || code == netlib.ErrorCodeNoResponse || code == netlib.ErrorCodeChecksumMismatch
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts < 1 {
+		p.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if p.Backoff <= 0 {
+		p.Backoff = defaultRetryBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = defaultRetryMaxBackoff
+	}
+	return p
+}
+
+// Pause before an attempt, starting from 1 for second attempt. Random part is added, so clients don't retry together
+func (p RetryPolicy) pause(attempt int) time.Duration {
+	backoff := p.Backoff
+
+	for i := 1; i < attempt && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	backoff = backoff/2 + rand.Intn(backoff/2+1)
+
+	return time.Duration(backoff) * time.Millisecond
+}
+
+// Calls a request till it succeeds or attempts are over. Not idempotent commands are called once
+func (c *NodeClient) withRetries(command string, send func() error) error {
+	if !IsIdempotentCommand(command) {
+		return send()
+	}
+
+	policy := c.Retry.withDefaults()
+
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		err = send()
+
+		if err == nil || attempt >= policy.MaxAttempts || !isRetryableNetworkError(err) {
+			return err
+		}
+
+		pause := policy.pause(attempt)
+
+		c.Logger.Trace.Printf("Retry %s in %d ms, attempt %d of %d: %s", command, pause/time.Millisecond, attempt+1, policy.MaxAttempts, err.Error())
+
+		select {
+		case <-time.After(pause):
+		case <-c.Context().Done():
+			return err
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package nodeclient
+
+/*
+* Metrics of requests to every node: bytes sent and received, requests and errors per command and a histogram
+* of latency. An operator sees which nodes are slow or fail. Every attempt of a retried request is counted.
+* Copies of a client share metrics
+ */
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	netlib "github.com/gelembjuk/oursql/lib/net"
+)
+
+// Upper bounds of latency buckets in milliseconds. Longer requests go to one more bucket
+var LatencyBuckets = []int64{10, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+type CommandStats struct {
+	Requests int64
+	Errors   int64
+	// errors by code
+	ErrorCodes map[int]int64
+	// requests per bucket of LatencyBuckets, last one is for longer requests
+	Latency []int64
+	// microseconds of all requests
+	LatencyTotal int64
+}
+
+type PeerStats struct {
+	BytesSent     int64
+	BytesReceived int64
+	Requests      int64
+	Errors        int64
+	LastError     string
+	LastErrorTime int64
+	Commands      map[string]CommandStats
+}
+
+type ClientMetrics struct {
+	lock  sync.Mutex
+	peers map[string]*PeerStats
+}
+
+// Counts bytes of a connection
+type countedConn struct {
+	net.Conn
+	metrics *ClientMetrics
+	peer    string
+}
+
+func NewClientMetrics() *ClientMetrics {
+	return &ClientMetrics{peers: map[string]*PeerStats{}}
+}
+
+// Average latency of requests
+func (s CommandStats) AverageLatency() time.Duration {
+	if s.Requests == 0 {
+		return 0
+	}
+	return time.Duration(s.LatencyTotal/s.Requests) * time.Microsecond
+}
+
+func (m *ClientMetrics) getPeer(addr string) *PeerStats {
+	peer, ok := m.peers[addr]
+
+	if !ok {
+		peer = &PeerStats{Commands: map[string]CommandStats{}}
+		m.peers[addr] = peer
+	}
+	return peer
+}
+
+// Remembers a result of a request
+func (m *ClientMetrics) recordRequest(addr netlib.NodeAddr, command string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	peer := m.getPeer(addr.NodeAddrToString())
+
+	stats := peer.Commands[command]
+
+	if stats.Latency == nil {
+		stats.Latency = make([]int64, len(LatencyBuckets)+1)
+		stats.ErrorCodes = map[int]int64{}
+	}
+
+	ms := int64(duration / time.Millisecond)
+
+	bucket := len(LatencyBuckets)
+
+	for i, bound := range LatencyBuckets {
+		if ms <= bound {
+			bucket = i
+			break
+		}
+	}
+
+	stats.Requests++
+	stats.Latency[bucket]++
+	stats.LatencyTotal += int64(duration / time.Microsecond)
+	peer.Requests++
+
+	if err != nil {
+		stats.Errors++
+		stats.ErrorCodes[netlib.GetErrorCode(err)]++
+		peer.Errors++
+		peer.LastError = err.Error()
+		peer.LastErrorTime = time.Now().Unix()
+	}
+	peer.Commands[command] = stats
+}
+
+func (m *ClientMetrics) addBytes(addr string, sent int, received int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	peer := m.getPeer(addr)
+	peer.BytesSent += int64(sent)
+	peer.BytesReceived += int64(received)
+}
+
+// Returns a connection which counts bytes of a node
+func (m *ClientMetrics) countConn(addr netlib.NodeAddr, conn net.Conn) net.Conn {
+	if m == nil {
+		return conn
+	}
+	return &countedConn{conn, m, addr.NodeAddrToString()}
+}
+
+func (c *countedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+
+	if n > 0 {
+		c.metrics.addBytes(c.peer, 0, n)
+	}
+	return n, err
+}
+
+func (c *countedConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+
+	if n > 0 {
+		c.metrics.addBytes(c.peer, n, 0)
+	}
+	return n, err
+}
+
+// Returns a copy of metrics of all nodes by address
+func (m *ClientMetrics) Stats() map[string]PeerStats {
+	result := map[string]PeerStats{}
+
+	if m == nil {
+		return result
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for addr, peer := range m.peers {
+		s := *peer
+		s.Commands = map[string]CommandStats{}
+
+		for command, stats := range peer.Commands {
+			stats.Latency = append([]int64{}, stats.Latency...)
+
+			codes := map[int]int64{}
+
+			for code, count := range stats.ErrorCodes {
+				codes[code] = count
+			}
+			stats.ErrorCodes = codes
+
+			s.Commands[command] = stats
+		}
+		result[addr] = s
+	}
+	return result
+}
+
+// Metrics of requests to nodes by address. Empty if the client has no metrics
+func (c *NodeClient) Stats() map[string]PeerStats {
+	return c.Metrics.Stats()
+}
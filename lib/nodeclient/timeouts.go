@@ -0,0 +1,154 @@
+package nodeclient
+
+/*
+* Timeouts of requests to nodes. They are set per class of commands or per command, so sending of large blocks
+* to slow nodes doesn't fail and a node which doesn't respond doesn't block a client forever.
+* Read timeout is the longest pause between reads of a response, overall timeout is for all the request
+ */
+
+import (
+	"net"
+	"time"
+)
+
+// Classes of commands
+const (
+	CommandClassNotify = "notify" // one way commands, inventories, addresses, versions, transactions
+	CommandClassBlocks = "blocks" // blocks and data to sync a blockchain
+	CommandClassData   = "data"   // requests of wallets and other data
+	CommandClassManage = "manage" // management of a node
+)
+
+// Timeouts of a request in milliseconds. 0 means a default value. Overall is not limited by default
+type Timeouts struct {
+	Dial    int
+	Write   int
+	Read    int
+	Overall int
+}
+
+type TimeoutsConfig struct {
+	// for all commands
+	Default Timeouts
+	// per class of commands or per name of a command, like "blocks" or "getblock". A command overrides its class
+	Commands map[string]Timeouts
+}
+
+var defaultTimeouts = Timeouts{Dial: 2000, Write: 30000, Read: 60000}
+
+// A node which doesn't answer a ping in this time is not alive
+const defaultPingTimeout = 3000
+
+var defaultClassTimeouts = map[string]Timeouts{
+	CommandClassNotify: Timeouts{Dial: 1000},
+	CommandClassBlocks: Timeouts{Write: 120000, Read: 120000},
+}
+
+var commandClasses = map[string]string{
+	"inv":                   CommandClassNotify,
+	CommandAddresses:        CommandClassNotify,
+	"version":               CommandClassNotify,
+	"tx":                    CommandClassNotify,
+	CommandPing:             CommandClassNotify,
+	CommandBlock:            CommandClassBlocks,
+	CommandGetBlock:         CommandClassBlocks,
+	"getblocks":             CommandClassBlocks,
+	"getblocksup":           CommandClassBlocks,
+	"getdata":               CommandClassBlocks,
+	CommandGetFirstBlocks:   CommandClassBlocks,
+	CommandGetConsensusData: CommandClassBlocks,
+	CommandGetBlockHeaders:  CommandClassBlocks,
+	CommandGetUpdates:       CommandClassBlocks,
+	CommandCheckBlock:       CommandClassBlocks,
+	CommandGetChecksums:     CommandClassBlocks,
+	CommandGetBlob:          CommandClassBlocks,
+	CommandGetBlocksStream:  CommandClassBlocks,
+	CommandGetSnapshot:      CommandClassBlocks,
+	CommandCompactBlock:     CommandClassBlocks,
+	CommandGetBlockTxs:      CommandClassBlocks,
+	CommandBatch:            CommandClassBlocks,
+	"getnodes":              CommandClassManage,
+	"addnode":               CommandClassManage,
+	"removenode":            CommandClassManage,
+	CommandGetState:         CommandClassManage,
+	CommandSetLogs:          CommandClassManage,
+	CommandProfile:          CommandClassManage,
+	CommandGetBans:          CommandClassManage,
+	CommandClearBans:        CommandClassManage,
+	CommandGetSettings:      CommandClassManage,
+	CommandSetSettings:      CommandClassManage,
+}
+
+// Returns a class of a command. Commands not in the list are data requests
+func GetCommandClass(command string) string {
+	if class, ok := commandClasses[command]; ok {
+		return class
+	}
+	return CommandClassData
+}
+
+// Values which are set replace values of t
+func (t Timeouts) merge(o Timeouts) Timeouts {
+	if o.Dial > 0 {
+		t.Dial = o.Dial
+	}
+	if o.Write > 0 {
+		t.Write = o.Write
+	}
+	if o.Read > 0 {
+		t.Read = o.Read
+	}
+	if o.Overall > 0 {
+		t.Overall = o.Overall
+	}
+	return t
+}
+
+// Returns timeouts of a command. Defaults, then a class and a command from the config
+func (c *NodeClient) GetTimeouts(command string) Timeouts {
+	class := GetCommandClass(command)
+
+	t := defaultTimeouts.merge(defaultClassTimeouts[class])
+	t = t.merge(c.Timeouts.Default)
+
+	if c.Timeouts.Commands != nil {
+		t = t.merge(c.Timeouts.Commands[class])
+		t = t.merge(c.Timeouts.Commands[command])
+	}
+	return t
+}
+
+func (t Timeouts) duration(ms int) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
+
+// Returns a deadline of an operation. It is not later than the overall deadline
+func (t Timeouts) deadline(ms int, overall time.Time) time.Time {
+	d := time.Now().Add(t.duration(ms))
+
+	if !overall.IsZero() && overall.Before(d) {
+		return overall
+	}
+	return d
+}
+
+// Sets the read deadline before every read, so a long response is not cut while data comes
+type deadlineReader struct {
+	conn     net.Conn
+	timeouts Timeouts
+	overall  time.Time
+}
+
+func (r *deadlineReader) Read(p []byte) (int, error) {
+	r.conn.SetReadDeadline(r.timeouts.deadline(r.timeouts.Read, r.overall))
+
+	return r.conn.Read(p)
+}
+
+// Checks if an error is a timeout of a connection
+func isTimeoutError(err error) bool {
+	if e, ok := err.(net.Error); ok {
+		return e.Timeout()
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package nodeclient
+
+/*
+* Transport of requests. A client gets a connection from a transport for every request, writes the request
+* and reads a response from it. Default transport uses netlib, it connects by TCP, a local socket or a WebSocket
+* depending on an address, with TLS and a proxy if they are set for the process.
+* Other transports, like QUIC or connections in memory for tests, can be set to a client
+ */
+
+import (
+	"context"
+	"net"
+	"time"
+
+	netlib "github.com/gelembjuk/oursql/lib/net"
+)
+
+// Connects to a node. A connection is used for one request and is closed after a response
+type Transport interface {
+	Dial(ctx context.Context, addr netlib.NodeAddr, timeout time.Duration) (net.Conn, error)
+}
+
+// Default transport
+type TCPTransport struct{}
+
+func (t TCPTransport) Dial(ctx context.Context, addr netlib.NodeAddr, timeout time.Duration) (net.Conn, error) {
+	return netlib.DialContext(ctx, addr, timeout)
+}
+
+// Function as a transport
+type TransportFunc func(ctx context.Context, addr netlib.NodeAddr, timeout time.Duration) (net.Conn, error)
+
+func (f TransportFunc) Dial(ctx context.Context, addr netlib.NodeAddr, timeout time.Duration) (net.Conn, error) {
+	return f(ctx, addr, timeout)
+}
+
+// Returns the transport of the client. Nil is TCPTransport
+func (c *NodeClient) getTransport() Transport {
+	if c.Transport == nil {
+		return TCPTransport{}
+	}
+	return c.Transport
+}
@@ -1,14 +1,19 @@
 package remoteclient
 
 import (
+	"bytes"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/gelembjuk/oursql/lib/net"
 	"github.com/gelembjuk/oursql/lib/nodeclient"
+	"github.com/gelembjuk/oursql/lib/tracing"
 	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/structures"
 )
 
 const walletFile = "wallet.dat"
@@ -25,6 +30,50 @@ type AppInput struct {
 	LogDest   string
 	SQL       string
 	Filepath  string
+	Format    string
+	// Signature scheme of new wallet. ecdsa (default) or ed25519
+	Scheme string
+	// Return change to the sender address instead of new derived address
+	ReuseChange bool
+	// RPC server options
+	RPCAddress  string
+	RPCUser     string
+	RPCPassword string
+	// Derived addresses options
+	Purpose string
+	Index   int
+	Seed    string
+	// Watch mode options
+	WatchCommand  string
+	WatchWebhook  string
+	WatchInterval int
+	// Minimum number of nodes that must agree on balance
+	Quorum int
+	// Lowest complexity of proof of work accepted in headers of blocks
+	MinComplexity int
+	// Private key in paper wallet format
+	PaperKey string
+	// Name in the names registry
+	Name string
+	// Rules to confirm transactions before signing and TOTP code if it is needed
+	Policy      SigningPolicy
+	ConfirmCode string
+	// Export of spans of requests to nodes
+	Tracing tracing.Config
+	// TLS for connections to nodes. A wallet needs only a CA
+	NodeTLS net.TLSConfig
+	// format of payloads of requests to a node, gob or protobuf
+	WireFormat string
+	// timeouts of requests to a node in milliseconds
+	NodeTimeouts nodeclient.TimeoutsConfig
+	// retries of requests to a node which only read data
+	NodeRetry nodeclient.RetryPolicy
+	// SOCKS5 proxy for connections to nodes
+	NodeProxy net.ProxyConfig
+	// longest response of a node in bytes
+	NodeMaxResponseSize int64
+	// limit of rate of requests to nodes
+	NodeRateLimit nodeclient.RateLimitConfig
 }
 
 type WalletCLI struct {
@@ -36,6 +85,8 @@ type WalletCLI struct {
 	WalletsObj *Wallets
 	NodeMode   bool
 	Logger     *utils.LoggerMan
+	// No user to ask for confirmations. Transactions needing it are rejected
+	NonInteractive bool
 }
 
 // Init wallet client object. This will manage execution
@@ -50,6 +101,8 @@ func (wc *WalletCLI) Init(logger *utils.LoggerMan, input AppInput) {
 
 	wc.Node.Port = wc.Input.NodePort
 	wc.Node.Host = wc.Input.NodeHost
+
+	wc.Nodes = input.Nodes
 }
 
 // Creates Wallets object and fills it from a file if it exists
@@ -79,6 +132,38 @@ func (wc *WalletCLI) initNodeClient() {
 	nt := net.NodeNetwork{}
 	nt.Init()
 	client.NodeNet = &nt
+	client.WireFormat = wc.Input.WireFormat
+	client.Timeouts = wc.Input.NodeTimeouts
+	client.Retry = wc.Input.NodeRetry
+	client.MaxResponseSize = wc.Input.NodeMaxResponseSize
+	client.RateLimiter = nodeclient.NewRateLimiter(wc.Input.NodeRateLimit)
+	client.Metrics = nodeclient.NewClientMetrics()
+
+	if err := net.CheckWireFormat(client.WireFormat); err != nil {
+		wc.Logger.Error.Println(err.Error())
+		client.WireFormat = ""
+	}
+
+	err := net.InitTLS(wc.Input.NodeTLS, wc.Logger)
+
+	if err != nil {
+		wc.Logger.Error.Printf("Error when init TLS %s", err.Error())
+	}
+
+	err = net.InitProxy(wc.Input.NodeProxy, wc.Logger)
+
+	if err != nil {
+		wc.Logger.Error.Printf("Error when init proxy %s", err.Error())
+	}
+
+	if wc.Input.Tracing.Endpoint != "" {
+		if wc.Input.Tracing.ServiceName == "" {
+			wc.Input.Tracing.ServiceName = "oursql-wallet"
+		}
+		tracing.Init(wc.Input.Tracing, wc.Logger)
+
+		client.Trace = tracing.NewTrace()
+	}
 
 	wc.NodeCLI = &client
 }
@@ -99,8 +184,12 @@ func (wc *WalletCLI) ExecuteCommand() error {
 	wc.initNodeClient()
 
 	if wc.Input.Command != "createwallet" &&
+		wc.Input.Command != "deriveaddress" &&
+		wc.Input.Command != "exportseed" &&
+		wc.Input.Command != "importseed" &&
 		wc.Input.Command != "importwallet" &&
 		wc.Input.Command != "exportwallet" &&
+		wc.Input.Command != "exportpaper" &&
 		wc.Input.Command != "listaddresses" {
 
 		err := wc.checkNodeAddress()
@@ -112,6 +201,18 @@ func (wc *WalletCLI) ExecuteCommand() error {
 	if wc.Input.Command == "createwallet" {
 		return wc.commandCreatewallet()
 
+	}
+	if wc.Input.Command == "deriveaddress" {
+		return wc.commandDeriveAddress()
+
+	}
+	if wc.Input.Command == "exportseed" {
+		return wc.commandExportSeed()
+
+	}
+	if wc.Input.Command == "importseed" {
+		return wc.commandImportSeed()
+
 	}
 	if wc.Input.Command == "importwallet" {
 		return wc.commandImportWallet()
@@ -120,6 +221,14 @@ func (wc *WalletCLI) ExecuteCommand() error {
 	if wc.Input.Command == "exportwallet" {
 		return wc.commandExportWallet()
 
+	}
+	if wc.Input.Command == "exportpaper" {
+		return wc.commandExportPaper()
+
+	}
+	if wc.Input.Command == "sweeppaper" {
+		return wc.commandSweepPaper()
+
 	}
 	if wc.Input.Command == "listaddresses" {
 		return wc.commandListAddresses()
@@ -129,6 +238,10 @@ func (wc *WalletCLI) ExecuteCommand() error {
 		wc.Input.Command == "listbalances" {
 		return wc.commandListAddressesExt()
 
+	}
+	if wc.Input.Command == "quorumbalance" {
+		return wc.commandQuorumBalance()
+
 	}
 	if wc.Input.Command == "getbalance" {
 		return wc.commandGetBalance()
@@ -141,6 +254,10 @@ func (wc *WalletCLI) ExecuteCommand() error {
 	if wc.Input.Command == "sql" {
 		return wc.commandSQL()
 
+	}
+	if wc.Input.Command == "signsql" {
+		return wc.commandSignSQL()
+
 	}
 	if wc.Input.Command == "showunspent" {
 		return wc.commandUnspentTransactions()
@@ -149,6 +266,24 @@ func (wc *WalletCLI) ExecuteCommand() error {
 	if wc.Input.Command == "showhistory" {
 		return wc.commandShowHistory()
 	}
+	if wc.Input.Command == "verifyunspent" {
+		return wc.commandVerifyUnspent()
+	}
+	if wc.Input.Command == "watch" {
+		return wc.commandWatch()
+	}
+	if wc.Input.Command == "exporthistory" {
+		return wc.commandExportHistory()
+	}
+	if wc.Input.Command == "rpcserver" {
+		return wc.commandRPCServer()
+	}
+	if wc.Input.Command == "registername" {
+		return wc.commandRegisterName()
+	}
+	if wc.Input.Command == "resolvename" {
+		return wc.commandResolveName()
+	}
 
 	return errors.New("Unknown wallets command")
 }
@@ -156,7 +291,17 @@ func (wc *WalletCLI) ExecuteCommand() error {
 // Creates new wallet and saves it in a wallets file
 // Wallet is a pare of keys
 func (wc *WalletCLI) commandCreatewallet() error {
-	address, err := wc.WalletsObj.CreateWallet()
+	var address string
+	var err error
+
+	switch wc.Input.Scheme {
+	case "", "ecdsa":
+		address, err = wc.WalletsObj.CreateWallet()
+	case "ed25519":
+		address, err = wc.WalletsObj.CreateEd25519Wallet()
+	default:
+		err = errors.New("Unknown signature scheme. Expected ecdsa or ed25519")
+	}
 
 	if err != nil {
 		return err
@@ -167,6 +312,52 @@ func (wc *WalletCLI) commandCreatewallet() error {
 	return nil
 }
 
+// Creates new address derived from the wallets seed for a purpose
+// If index is set, then the address with this index is restored
+func (wc *WalletCLI) commandDeriveAddress() error {
+	address, err := wc.WalletsObj.CreateDerivedWallet(wc.Input.Purpose, wc.Input.Index)
+
+	if err != nil {
+		return err
+	}
+
+	w, _ := wc.WalletsObj.GetWallet(address)
+
+	fmt.Printf("Your new address for %s #%d: %s\n", w.Purpose, w.Index, address)
+
+	return nil
+}
+
+// Prints the seed of derived addresses. It must be kept to recover derived addresses
+func (wc *WalletCLI) commandExportSeed() error {
+	if len(wc.WalletsObj.Seed) == 0 {
+		return errors.New("There is no seed yet. It is created with first derived address")
+	}
+
+	fmt.Printf("Seed: %x\n", wc.WalletsObj.Seed)
+
+	return nil
+}
+
+// Sets the seed of derived addresses. After this derived addresses can be restored
+func (wc *WalletCLI) commandImportSeed() error {
+	seed, err := hex.DecodeString(wc.Input.Seed)
+
+	if err != nil {
+		return err
+	}
+
+	err = wc.WalletsObj.SetSeed(seed)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Seed imported. Use deriveaddress with -purpose and -index to restore addresses")
+
+	return nil
+}
+
 // Imports wallets from given wallets file
 func (wc *WalletCLI) commandImportWallet() error {
 	addresses, err := wc.WalletsObj.ImportWallet(wc.Input.Filepath)
@@ -197,6 +388,100 @@ func (wc *WalletCLI) commandExportWallet() error {
 	return nil
 }
 
+// Prints a key as paper wallet. Optionally saves QR code of the private key to PNG file
+func (wc *WalletCLI) commandExportPaper() error {
+	walletobj, err := wc.WalletsObj.GetWallet(wc.Input.Address)
+
+	if err != nil {
+		return err
+	}
+
+	paper, err := makePaperWallet(walletobj)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(paper)
+
+	if wc.Input.Filepath != "" {
+		err = writePaperWalletQR(walletobj, wc.Input.Filepath)
+
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Private key QR code saved to %s\n", wc.Input.Filepath)
+	}
+
+	return nil
+}
+
+// Moves all funds of a paper wallet key to an address of this wallet in one transaction
+// If destination address is not given then new address is created
+func (wc *WalletCLI) commandSweepPaper() error {
+	paperwallet, err := MakeWalletFromWIF(wc.Input.PaperKey)
+
+	if err != nil {
+		return err
+	}
+
+	fromAddress := string(paperwallet.GetAddress())
+
+	toAddress := wc.Input.ToAddress
+
+	if toAddress == "" {
+		toAddress, err = wc.WalletsObj.CreateWallet()
+
+		if err != nil {
+			return err
+		}
+	} else if _, err := wc.WalletsObj.GetWallet(toAddress); err != nil {
+		return errors.New("To Address is not in this wallet")
+	}
+
+	balance, err := wc.NodeCLI.SendGetBalance(wc.Node, fromAddress)
+
+	if err != nil {
+		return err
+	}
+
+	if balance.Total <= 0 {
+		return errors.New(fmt.Sprintf("No funds on the address %s", fromAddress))
+	}
+
+	wc.Logger.Trace.Printf("Sweep %.8f from %s to %s", balance.Total, fromAddress, toAddress)
+
+	TXBytes, DataToSign, err := wc.NodeCLI.SendRequestNewCurrencyTransaction(wc.Node,
+		paperwallet.GetPublicKey(), toAddress, balance.Total)
+
+	if err != nil {
+		return err
+	}
+
+	err = wc.checkSigningPolicy(TXBytes, DataToSign, paperwallet.GetPublicKey())
+
+	if err != nil {
+		return err
+	}
+
+	signature, err := utils.SignDataBySigner(paperwallet.GetSigner(), DataToSign)
+
+	if err != nil {
+		return err
+	}
+
+	NewTXID, err := wc.NodeCLI.SendNewTransactionData(wc.Node, fromAddress, TXBytes, signature)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Success. Moved %.8f from %s to %s\n", balance.Total, fromAddress, toAddress)
+	fmt.Printf("New transaction: %x\n", NewTXID)
+
+	return nil
+}
+
 // List addresses (wallets) stored in the wallets file
 func (wc *WalletCLI) commandListAddresses() error {
 	fmt.Println("Wallets (addresses):")
@@ -204,7 +489,13 @@ func (wc *WalletCLI) commandListAddresses() error {
 	addresses := wc.WalletsObj.GetAddresses()
 
 	for _, address := range addresses {
-		fmt.Println(address)
+		w, _ := wc.WalletsObj.GetWallet(address)
+
+		if w.Purpose != "" {
+			fmt.Printf("%s\t%s #%d\n", address, w.Purpose, w.Index)
+		} else {
+			fmt.Println(address)
+		}
 	}
 
 	return nil
@@ -225,6 +516,8 @@ func (wc *WalletCLI) commandListAddressesExt() error {
 		}
 
 		fmt.Printf("%s: %.8f (Approved - %.8f, Pending - %.8f)\n", address, balance.Total, balance.Approved, balance.Pending)
+
+		wc.warnAddressReuse(address)
 	}
 
 	return nil
@@ -256,6 +549,57 @@ func (wc *WalletCLI) commandShowHistory() error {
 
 	}
 
+	wc.printAddressReuseWarning(wc.Input.Address, list)
+
+	return nil
+}
+
+// Exports history of transactions to a file in CSV or JSON format
+// If no address is given then history of all addresses from the wallets file is exported
+func (wc *WalletCLI) commandExportHistory() error {
+	if wc.Input.Filepath == "" {
+		return errors.New("Destination file path is missed")
+	}
+
+	addresses := []string{wc.Input.Address}
+
+	if wc.Input.Address == "" {
+		addresses = wc.WalletsObj.GetAddresses()
+	}
+
+	w := Wallet{}
+
+	records := []HistoryExportRecord{}
+
+	for _, address := range addresses {
+		if !w.ValidateAddress(address) {
+			return errors.New(fmt.Sprintf("Address %s is not valid", address))
+		}
+
+		list, err := loadAddressHistory(wc.NodeCLI, wc.Node, address)
+
+		if err != nil {
+			return err
+		}
+
+		records = append(records, makeHistoryExportRecords(address, list)...)
+	}
+
+	file, err := os.OpenFile(wc.Input.Filepath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = writeHistoryExport(file, wc.Input.Format, records)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Exported %d records\n", len(records))
+
 	return nil
 }
 
@@ -287,6 +631,120 @@ func (wc *WalletCLI) commandUnspentTransactions() error {
 	return nil
 }
 
+// Loads unspent outputs and checks each of them is committed in the blockchain
+// Balance is calculated only from outputs that are verified
+func (wc *WalletCLI) commandVerifyUnspent() error {
+	w := Wallet{}
+	// check input
+	if !w.ValidateAddress(wc.Input.Address) {
+		return errors.New("Address is not valid")
+	}
+
+	list, err := wc.NodeCLI.SendGetUnspent(wc.Node, wc.Input.Address, []byte{})
+
+	if err != nil {
+		return err
+	}
+
+	verifier := unspentVerifier{}
+	verifier.NodeCLI = wc.NodeCLI
+	verifier.Node = wc.Node
+	verifier.Logger = wc.Logger
+	verifier.MinComplexity = wc.Input.MinComplexity
+
+	result, err := verifier.VerifyUnspent(wc.Input.Address, list)
+
+	if err != nil {
+		return err
+	}
+
+	balance := float64(0)
+	failed := 0
+
+	for _, r := range result {
+		if r.Valid {
+			fmt.Printf("%f\t in transaction %x output #%d . Verified in block %d %x\n",
+				r.Output.Amount, r.Output.TXID, r.Output.Vout, r.BlockHeight, r.BlockHash)
+			balance += r.Output.Amount
+		} else {
+			fmt.Printf("%f\t in transaction %x output #%d . NOT verified: %s\n",
+				r.Output.Amount, r.Output.TXID, r.Output.Vout, r.Error)
+			failed++
+		}
+	}
+
+	fmt.Printf("\nVerified balance - %f\n", balance)
+
+	if failed > 0 {
+		return errors.New(fmt.Sprintf("%d outputs are not verified", failed))
+	}
+
+	return nil
+}
+
+// Watches new blocks and notifies when an address receives funds
+// or a row created by the address key is modified.
+// If no address is given then all addresses from the wallets file are watched
+func (wc *WalletCLI) commandWatch() error {
+	watcher := newAddressWatcher(wc.NodeCLI, wc.Node, wc.Logger)
+
+	if wc.Input.WatchInterval > 0 {
+		watcher.Interval = time.Duration(wc.Input.WatchInterval) * time.Second
+	}
+
+	addresses := []string{wc.Input.Address}
+
+	if wc.Input.Address == "" {
+		addresses = wc.WalletsObj.GetAddresses()
+	}
+
+	if len(addresses) == 0 {
+		return errors.New("No addresses to watch")
+	}
+
+	w := Wallet{}
+
+	for _, address := range addresses {
+		if !w.ValidateAddress(address) {
+			return errors.New(fmt.Sprintf("Address %s is not valid", address))
+		}
+		err := watcher.AddAddress(address)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	callbacks := []WatchCallback{}
+
+	if wc.Input.WatchCommand != "" {
+		callbacks = append(callbacks, newWatchCommandCallback(wc.Input.WatchCommand))
+	}
+	if wc.Input.WatchWebhook != "" {
+		callbacks = append(callbacks, newWatchWebhookCallback(wc.Input.WatchWebhook))
+	}
+
+	watcher.Callback = func(event WatchEvent) error {
+		if event.Kind == WatchEventReceived {
+			fmt.Printf("%s received %.8f in transaction %s (block %d)\n", event.Address, event.Amount, event.TXID, event.BlockHeight)
+		} else {
+			fmt.Printf("Row of %s modified in transaction %s (block %d): %s\n", event.Address, event.TXID, event.BlockHeight, event.Query)
+		}
+		for _, c := range callbacks {
+			err := c(event)
+
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	fmt.Printf("Watching %d addresses. Press Ctrl+C to exit\n", len(addresses))
+
+	return watcher.Run()
+}
+
 // Requests a node for balance and displays it. for given address
 func (wc *WalletCLI) commandGetBalance() error {
 	w := Wallet{}
@@ -305,57 +763,220 @@ func (wc *WalletCLI) commandGetBalance() error {
 	fmt.Printf("Approved - %.8f\n", balance.Approved)
 	fmt.Printf("Pending - %.8f\n", balance.Pending)
 
+	wc.warnAddressReuse(wc.Input.Address)
+
+	return nil
+}
+
+// Requests balance from several nodes and checks that enough of them agree
+// Default quorum is majority of nodes
+func (wc *WalletCLI) commandQuorumBalance() error {
+	w := Wallet{}
+	// check input
+	if !w.ValidateAddress(wc.Input.Address) {
+		return errors.New("Address is not valid")
+	}
+
+	nodes := []net.NodeAddr{}
+
+	if wc.Node.Host != "" {
+		nodes = append(nodes, wc.Node)
+	}
+
+	for _, n := range wc.Nodes {
+		if wc.Node.Host != "" && n.CompareToAddress(wc.Node) {
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+
+	if len(nodes) < 2 {
+		return errors.New("At least 2 nodes are needed for quorum check. Use -nodes argument")
+	}
+
+	quorum := wc.Input.Quorum
+
+	if quorum < 1 {
+		quorum = len(nodes)/2 + 1
+	}
+
+	reports, agreed := checkBalanceQuorum(wc.NodeCLI, nodes, wc.Input.Address)
+
+	groupNames := map[string]int{}
+
+	for _, r := range reports {
+		if r.Error != nil {
+			fmt.Printf("%s: error %s\n", r.Node.NodeAddrToString(), r.Error.Error())
+			continue
+		}
+		if _, ok := groupNames[r.stateKey]; !ok {
+			groupNames[r.stateKey] = len(groupNames) + 1
+		}
+		fmt.Printf("%s: %.8f (Approved - %.8f, Pending - %.8f), %d unspent outputs, state #%d\n",
+			r.Node.NodeAddrToString(), r.Balance.Total, r.Balance.Approved, r.Balance.Pending,
+			r.Unspent, groupNames[r.stateKey])
+	}
+
+	if len(groupNames) > 1 {
+		fmt.Printf("\nNodes report %d different states\n", len(groupNames))
+	}
+
+	if agreed < quorum {
+		return errors.New(fmt.Sprintf("No quorum. %d nodes agree, %d required", agreed, quorum))
+	}
+
+	fmt.Printf("\nQuorum reached. %d of %d nodes agree\n", agreed, len(nodes))
+
 	return nil
 }
 
 // Send money command. Connects to a node to do this operation
 func (wc *WalletCLI) commandSend() error {
+	NewTXID, err := wc.sendCurrency(wc.Input.Address, wc.Input.ToAddress, wc.Input.Amount)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Success. New transaction: %x\n", NewTXID)
+
+	return nil
+}
+
+// Prepares currency transaction on a node, signs it and sends back. Returns new transaction ID
+func (wc *WalletCLI) sendCurrency(from string, to string, amount float64) ([]byte, error) {
 	w := Wallet{}
 	// check input
-	if !w.ValidateAddress(wc.Input.Address) {
-		return errors.New("From Address is not valid")
+	if !w.ValidateAddress(from) {
+		return nil, errors.New("From Address is not valid")
 	}
-	if !w.ValidateAddress(wc.Input.ToAddress) {
-		return errors.New("To Address is not valid")
+
+	// TO can be a name from the names registry
+	to, err := wc.resolveAddress(to)
+
+	if err != nil {
+		return nil, err
 	}
 
-	if wc.Input.Amount <= 0 {
-		return errors.New("The amount of transaction must be more 0")
+	if amount <= 0 {
+		return nil, errors.New("The amount of transaction must be more 0")
 	}
 
-	wc.Logger.Trace.Printf("Prepare wallet %s to send data to node %s", wc.Input.Address, wc.Node.NodeAddrToString())
+	wc.Logger.Trace.Printf("Prepare wallet %s to send data to node %s", from, wc.Node.NodeAddrToString())
 
 	// load wallet object for this address
-	walletobj, err := wc.WalletsObj.GetWallet(wc.Input.Address)
+	walletobj, err := wc.WalletsObj.GetWallet(from)
 
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// fresh address for a change. It is not possible to link it to the sender address
+	changeAddress := ""
+
+	if !wc.Input.ReuseChange {
+		changeAddress, err = wc.WalletsObj.CreateDerivedWallet(changeAddressPurpose, -1)
+
+		if err != nil {
+			return nil, err
+		}
+		wc.Logger.Trace.Printf("Change address %s", changeAddress)
 	}
 
 	// Prepares new transaction without signatures
 	// This is just request to a node and it returns prepared transaction
-	TXBytes, DataToSign, err := wc.NodeCLI.SendRequestNewCurrencyTransaction(wc.Node,
-		walletobj.GetPublicKey(), wc.Input.ToAddress, wc.Input.Amount)
+	TXBytes, DataToSign, err := wc.NodeCLI.SendRequestNewCurrencyTransactionWithChange(wc.Node,
+		walletobj.GetPublicKey(), to, amount, changeAddress)
 
 	if err != nil {
-		return err
+		return nil, err
+	}
+	err = wc.checkSigningPolicy(TXBytes, DataToSign, walletobj.GetPublicKey())
+
+	if err != nil {
+		return nil, err
 	}
 	// Sign transaction data
-	signature, err := utils.SignDataByPubKey(walletobj.GetPublicKey(), walletobj.GetPrivateKey(), DataToSign)
+	signature, err := utils.SignDataBySigner(walletobj.GetSigner(), DataToSign)
 
-	NewTXID, err := wc.NodeCLI.SendNewTransactionData(wc.Node, wc.Input.Address, TXBytes, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	return wc.NodeCLI.SendNewTransactionData(wc.Node, from, TXBytes, signature)
+}
+
+// Execute SQL command. Connects to a node to do this operation
+func (wc *WalletCLI) commandSQL() error {
+	NewTXID, err := wc.SendSQL(wc.Input.Address, wc.Input.SQL)
 
 	if err != nil {
 		return err
 	}
 
+	if NewTXID == nil {
+		fmt.Printf("Success. No transaction needed\n")
+		return nil
+	}
+
 	fmt.Printf("Success. New transaction: %x\n", NewTXID)
 
 	return nil
 }
 
-// Send money command. Connects to a node to do this operation
-func (wc *WalletCLI) commandSQL() error {
+// Prepares SQL transaction on a node, signs it and sends back. Returns new transaction ID
+// or nil if the query was executed without a transaction
+func (wc *WalletCLI) SendSQL(from string, sql string) ([]byte, error) {
+	w := Wallet{}
+	// check input
+	if !w.ValidateAddress(from) {
+		return nil, errors.New("From Address is not valid")
+	}
+
+	if sql == "" {
+		return nil, errors.New("SQL command missing")
+	}
+
+	wc.Logger.Trace.Printf("Prepare wallet %s to send data to node %s", from, wc.Node.NodeAddrToString())
+
+	// load wallet object for this address
+	walletobj, err := wc.WalletsObj.GetWallet(from)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Prepares new transaction without signatures
+	// This is just request to a node and it returns prepared transaction
+	finished, TXBytes, DataToSign, err := wc.NodeCLI.SendRequestNewSQLTransaction(wc.Node,
+		walletobj.GetPublicKey(), sql)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if finished {
+		return nil, nil
+	}
+
+	err = wc.checkSigningPolicy(TXBytes, DataToSign, walletobj.GetPublicKey())
+
+	if err != nil {
+		return nil, err
+	}
+	// Sign transaction data
+	signature, err := utils.SignDataBySigner(walletobj.GetSigner(), DataToSign)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return wc.NodeCLI.SendNewTransactionData(wc.Node, from, TXBytes, signature)
+}
+
+// Prepares SQL transaction on a node, signs it and prints SQL query with a signature in a comment
+// This query can be executed later with any MySQL client connected to a node DB proxy
+func (wc *WalletCLI) commandSignSQL() error {
 	w := Wallet{}
 	// check input
 	if !w.ValidateAddress(wc.Input.Address) {
@@ -366,17 +987,12 @@ func (wc *WalletCLI) commandSQL() error {
 		return errors.New("SQL command missing")
 	}
 
-	wc.Logger.Trace.Printf("Prepare wallet %s to send data to node %s", wc.Input.Address, wc.Node.NodeAddrToString())
-
-	// load wallet object for this address
 	walletobj, err := wc.WalletsObj.GetWallet(wc.Input.Address)
 
 	if err != nil {
 		return err
 	}
 
-	// Prepares new transaction without signatures
-	// This is just request to a node and it returns prepared transaction
 	finished, TXBytes, DataToSign, err := wc.NodeCLI.SendRequestNewSQLTransaction(wc.Node,
 		walletobj.GetPublicKey(), wc.Input.SQL)
 
@@ -385,19 +1001,78 @@ func (wc *WalletCLI) commandSQL() error {
 	}
 
 	if finished {
-		fmt.Printf("Success. No transaction needed\n")
+		// no transaction is needed for this query. it can be executed as is
+		fmt.Println(wc.Input.SQL)
 		return nil
 	}
-	// Sign transaction data
-	signature, err := utils.SignDataByPubKey(walletobj.GetPublicKey(), walletobj.GetPrivateKey(), DataToSign)
 
-	NewTXID, err := wc.NodeCLI.SendNewTransactionData(wc.Node, wc.Input.Address, TXBytes, signature)
+	err = wc.checkSigningPolicy(TXBytes, DataToSign, walletobj.GetPublicKey())
 
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Success. New transaction: %x\n", NewTXID)
+	signature, err := utils.SignDataBySigner(walletobj.GetSigner(), DataToSign)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(MakeSignedSQL(wc.Input.SQL, TXBytes, signature))
 
 	return nil
 }
+
+// Checks prepared transaction against signing policy. Asks for confirmation if policy requires it.
+// Data to sign are made from the transaction again, a node can not get a signature of other data than
+// the policy checked
+func (wc *WalletCLI) checkSigningPolicy(txBytes []byte, dataToSign []byte, pubKey []byte) error {
+	tx, err := structures.DeserializeTransaction(txBytes)
+
+	if err != nil {
+		return err
+	}
+
+	if bytes.Compare(tx.ByPubKey, pubKey) != 0 {
+		return errors.New("Node prepared a transaction of other key")
+	}
+
+	signData, err := tx.GetSignData()
+
+	if err != nil {
+		return err
+	}
+
+	if bytes.Compare(signData, dataToSign) != 0 {
+		return errors.New("Data to sign are not same as the prepared transaction")
+	}
+
+	if wc.Input.Policy.IsEmpty() {
+		return nil
+	}
+
+	reason, err := wc.Input.Policy.getConfirmationReason(tx)
+
+	if err != nil {
+		return err
+	}
+
+	if reason == "" {
+		return nil
+	}
+
+	wc.Logger.Trace.Printf("Transaction %x needs confirmation: %s", tx.GetID(), reason)
+
+	if wc.NonInteractive {
+		return errors.New(fmt.Sprintf("Transaction needs confirmation. %s", reason))
+	}
+
+	return wc.Input.Policy.confirm(reason, wc.Input.ConfirmCode, os.Stdin, os.Stdout)
+}
+
+// Adds the comment with transaction data and signature to SQL query
+// This is the format expected by a node DB proxy
+func MakeSignedSQL(sql string, txBytes []byte, signature []byte) string {
+	return fmt.Sprintf("%s /* DATA:%s; SIGN:%s;*/", strings.TrimRight(sql, " ;\n\t"),
+		hex.EncodeToString(txBytes), hex.EncodeToString(signature))
+}
@@ -0,0 +1,120 @@
+package remoteclient
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/nodeclient"
+)
+
+// Number of history records to request in one call
+const historyPageSize = 100
+
+// Record of history to export. Format is easy to use in accounting tools
+type HistoryExportRecord struct {
+	Time          string
+	Address       string
+	Direction     string
+	Amount        float64
+	Counterparty  string
+	TXID          string
+	BlockHeight   int
+	Confirmations int
+	Status        string
+}
+
+// Loads full history of an address from a node page by page
+func loadAddressHistory(client *nodeclient.NodeClient, node net.NodeAddr, address string) ([]nodeclient.ComHistoryTransaction, error) {
+	result := []nodeclient.ComHistoryTransaction{}
+
+	var after *nodeclient.ComHistoryTransaction
+
+	for {
+		list, err := client.SendGetHistoryPage(node, address, after, historyPageSize)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, list...)
+
+		if len(list) < historyPageSize {
+			break
+		}
+		after = &result[len(result)-1]
+	}
+
+	return result, nil
+}
+
+// Converts history from a node to export records
+func makeHistoryExportRecords(address string, list []nodeclient.ComHistoryTransaction) []HistoryExportRecord {
+	records := []HistoryExportRecord{}
+
+	for _, rec := range list {
+		r := HistoryExportRecord{}
+		r.Time = time.Unix(rec.Time, 0).UTC().Format(time.RFC3339)
+		r.Address = address
+		r.Amount = rec.Amount
+		r.TXID = hex.EncodeToString(rec.TXID)
+		r.BlockHeight = rec.BlockHeight
+		r.Confirmations = rec.Confirmations
+
+		if rec.IOType {
+			r.Direction = "in"
+			r.Counterparty = rec.From
+		} else {
+			r.Direction = "out"
+			r.Counterparty = rec.To
+		}
+
+		if rec.Confirmations > 0 {
+			r.Status = "confirmed"
+		} else {
+			r.Status = "pending"
+		}
+		records = append(records, r)
+	}
+
+	return records
+}
+
+// Writes history records in given format. csv or json
+func writeHistoryExport(w io.Writer, format string, records []HistoryExportRecord) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(records)
+
+	case "csv", "":
+		cw := csv.NewWriter(w)
+
+		err := cw.Write([]string{"time", "address", "direction", "amount", "counterparty",
+			"txid", "blockheight", "confirmations", "status"})
+
+		if err != nil {
+			return err
+		}
+
+		for _, r := range records {
+			err = cw.Write([]string{r.Time, r.Address, r.Direction, fmt.Sprintf("%.8f", r.Amount), r.Counterparty,
+				r.TXID, fmt.Sprintf("%d", r.BlockHeight), fmt.Sprintf("%d", r.Confirmations), r.Status})
+
+			if err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+
+		return cw.Error()
+	}
+	return errors.New("Unknown export format. Expected csv or json")
+}
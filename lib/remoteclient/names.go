@@ -0,0 +1,135 @@
+package remoteclient
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gelembjuk/oursql/lib/nodeclient"
+	"github.com/gelembjuk/oursql/lib/utils"
+)
+
+// Builds SQL query to register a name for a public key
+func makeRegisterNameSQL(name string, pubKey []byte) (string, error) {
+	return utils.MakeRegisterNameSQL(name, pubKey)
+}
+
+// Checks a record returned by a node. Address must be made from the public key
+func checkNameRecord(record *nodeclient.ResponseGetName) error {
+	address, err := utils.PubKeyToAddres(record.PubKey)
+
+	if err != nil {
+		return err
+	}
+
+	if address != record.Address {
+		return errors.New(fmt.Sprintf("Node returned wrong record for the name %s", record.Name))
+	}
+	return nil
+}
+
+// Returns address for a name from the names registry. If TO is an address it is returned as is
+func (wc *WalletCLI) resolveAddress(to string) (string, error) {
+	w := Wallet{}
+
+	if w.ValidateAddress(to) {
+		return to, nil
+	}
+
+	if !utils.IsValidName(to) {
+		return "", errors.New("To Address is not valid")
+	}
+
+	record, err := wc.NodeCLI.SendGetName(wc.Node, to)
+
+	if err != nil {
+		return "", err
+	}
+
+	if !record.Found {
+		return "", errors.New(fmt.Sprintf("Name %s is not registered", to))
+	}
+
+	err = checkNameRecord(record)
+
+	if err != nil {
+		return "", err
+	}
+
+	wc.Logger.Trace.Printf("Name %s resolved to %s", to, record.Address)
+
+	return record.Address, nil
+}
+
+// Registers a name for an address of this wallet
+func (wc *WalletCLI) commandRegisterName() error {
+	w := Wallet{}
+
+	if !w.ValidateAddress(wc.Input.Address) {
+		return errors.New("Address is not valid")
+	}
+
+	walletobj, err := wc.WalletsObj.GetWallet(wc.Input.Address)
+
+	if err != nil {
+		return err
+	}
+
+	sql, err := makeRegisterNameSQL(wc.Input.Name, walletobj.GetPublicKey())
+
+	if err != nil {
+		return err
+	}
+
+	record, err := wc.NodeCLI.SendGetName(wc.Node, wc.Input.Name)
+
+	if err != nil {
+		return err
+	}
+
+	if record.Found {
+		return errors.New(fmt.Sprintf("Name %s is already registered for %s", record.Name, record.Address))
+	}
+
+	NewTXID, err := wc.SendSQL(wc.Input.Address, sql)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Success. Name %s is registered for %s. New transaction: %x\n", wc.Input.Name, wc.Input.Address, NewTXID)
+
+	return nil
+}
+
+// Displays address and public key for a name or a name for an address
+func (wc *WalletCLI) commandResolveName() error {
+	var record *nodeclient.ResponseGetName
+	var err error
+
+	if wc.Input.Name != "" {
+		record, err = wc.NodeCLI.SendGetName(wc.Node, wc.Input.Name)
+	} else if wc.Input.Address != "" {
+		record, err = wc.NodeCLI.SendGetNameByAddress(wc.Node, wc.Input.Address)
+	} else {
+		return errors.New("Name or address is required")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !record.Found {
+		fmt.Println("Not registered")
+		return nil
+	}
+
+	err = checkNameRecord(record)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Name: %s\nAddress: %s\nPublic key: %x\n", record.Name, record.Address, record.PubKey)
+
+	return nil
+}
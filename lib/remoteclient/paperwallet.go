@@ -0,0 +1,41 @@
+package remoteclient
+
+import (
+	"fmt"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// Builds text of a paper wallet. It contains address and private key
+// each with QR code that can be printed in a terminal
+func makePaperWallet(w Wallet) (string, error) {
+	address := string(w.GetAddress())
+	key := w.GetPrivateKeyWIF()
+
+	addressQR, err := qrcode.New(address, qrcode.Medium)
+
+	if err != nil {
+		return "", err
+	}
+
+	keyQR, err := qrcode.New(key, qrcode.Medium)
+
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Address (share to receive funds):\n%s\n\n", address)
+	b.WriteString(addressQR.ToSmallString(false))
+	fmt.Fprintf(&b, "\nPrivate key (keep it secret):\n%s\n\n", key)
+	b.WriteString(keyQR.ToSmallString(false))
+
+	return b.String(), nil
+}
+
+// Saves QR code of a private key to PNG file
+func writePaperWalletQR(w Wallet, filepath string) error {
+	return qrcode.WriteFile(w.GetPrivateKeyWIF(), qrcode.Medium, 256, filepath)
+}
@@ -0,0 +1,147 @@
+package remoteclient
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gelembjuk/oursql/node/dbquery/sqlparser"
+	"github.com/gelembjuk/oursql/node/structures"
+)
+
+const (
+	PolicyConfirmInteractive = "interactive" // ask to type yes
+	PolicyConfirmTOTP        = "totp"        // ask for one time code from authenticator app
+)
+
+// Time step of TOTP codes in seconds
+const totpPeriod = 30
+
+// Rules when a transaction needs extra confirmation before it is signed
+// Set in the wallet config file
+type SigningPolicy struct {
+	// Transactions sending more than this amount need confirmation. 0 means no limit
+	AmountThreshold float64
+	// SQL transactions on these tables need confirmation
+	Tables []string
+	// How to confirm. interactive or totp
+	Confirmation string
+	// Base32 secret of TOTP second factor
+	TOTPSecret string
+}
+
+// Checks if the policy has any rule
+func (p SigningPolicy) IsEmpty() bool {
+	return p.AmountThreshold <= 0 && len(p.Tables) == 0
+}
+
+// Returns the reason why a transaction needs confirmation. Empty string if it is not needed
+func (p SigningPolicy) getConfirmationReason(tx *structures.Transaction) (string, error) {
+	amount := float64(0)
+
+	for _, out := range tx.Vout {
+		if !tx.CreatedByPubKeyHash(out.PubKeyHash) {
+			amount += out.Value
+		}
+	}
+
+	if p.AmountThreshold > 0 && amount > p.AmountThreshold {
+		return fmt.Sprintf("Amount %.8f is above the limit %.8f", amount, p.AmountThreshold), nil
+	}
+
+	if !tx.IsSQLCommand() || len(p.Tables) == 0 {
+		return "", nil
+	}
+
+	parser := sqlparser.NewSqlParser()
+
+	err := parser.Parse(tx.GetSQLQuery())
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, table := range p.Tables {
+		if strings.EqualFold(table, parser.GetTable()) {
+			return fmt.Sprintf("SQL query modifies protected table %s", table), nil
+		}
+	}
+
+	return "", nil
+}
+
+// Asks a user to confirm transaction. code is used for TOTP if not empty, in other case it is read from input
+func (p SigningPolicy) confirm(reason string, code string, in io.Reader, out io.Writer) error {
+	fmt.Fprintf(out, "Transaction needs confirmation. %s\n", reason)
+
+	reader := bufio.NewReader(in)
+
+	if p.Confirmation == PolicyConfirmTOTP {
+		if code == "" {
+			fmt.Fprint(out, "Enter one time code: ")
+			code, _ = reader.ReadString('\n')
+		}
+
+		valid, err := verifyTOTP(p.TOTPSecret, strings.TrimSpace(code), time.Now())
+
+		if err != nil {
+			return err
+		}
+
+		if !valid {
+			return errors.New("One time code is wrong")
+		}
+		return nil
+	}
+
+	fmt.Fprint(out, "Type yes to sign it: ")
+
+	answer, _ := reader.ReadString('\n')
+
+	if strings.ToLower(strings.TrimSpace(answer)) != "yes" {
+		return errors.New("Transaction was not confirmed")
+	}
+	return nil
+}
+
+// Makes TOTP code (RFC 6238, HMAC-SHA1, 6 digits) for given time step
+func makeTOTP(secret []byte, counter uint64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+// Checks TOTP code. Codes of previous and next time steps are accepted too
+func verifyTOTP(secret string, code string, now time.Time) (bool, error) {
+	secret = strings.ToUpper(strings.Replace(secret, " ", "", -1))
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+
+	if err != nil {
+		return false, errors.New("TOTP secret has wrong format")
+	}
+
+	counter := uint64(now.Unix() / totpPeriod)
+
+	for _, c := range []uint64{counter - 1, counter, counter + 1} {
+		if hmac.Equal([]byte(makeTOTP(key, c)), []byte(code)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,76 @@
+package remoteclient
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/structures"
+)
+
+func TestTOTP(t *testing.T) {
+	// test vector from RFC 6238, last 6 digits
+	secret := []byte("12345678901234567890")
+
+	if code := makeTOTP(secret, 59/totpPeriod); code != "287082" {
+		t.Fatalf("Wrong TOTP code %s", code)
+	}
+
+	encoded := base32.StdEncoding.EncodeToString(secret)
+
+	valid, err := verifyTOTP(encoded, "287082", time.Unix(59, 0))
+
+	if err != nil {
+		t.Fatalf("Verify failed %s", err.Error())
+	}
+
+	if !valid {
+		t.Fatalf("Code must be valid")
+	}
+
+	valid, _ = verifyTOTP(encoded, "287082", time.Unix(1111111109, 0))
+
+	if valid {
+		t.Fatalf("Code must be not valid for other time")
+	}
+}
+
+func TestSigningDataCheck(t *testing.T) {
+	wallet := Wallet{}
+	wallet.MakeWallet()
+
+	tx, _ := structures.NewTransaction([]structures.TXCurrencyInput{},
+		[]structures.TXCurrrencyOutput{structures.TXCurrrencyOutput{Value: 1, PubKeyHash: []byte{1, 2, 3}}})
+
+	dataToSign, err := tx.PrepareSignData(wallet.GetPublicKey(), map[int]*structures.Transaction{})
+
+	if err != nil {
+		t.Fatalf("Prepare error: %s", err.Error())
+	}
+
+	txBytes, _ := structures.SerializeTransaction(tx)
+
+	wc := WalletCLI{Logger: utils.CreateLogger()}
+
+	if err = wc.checkSigningPolicy(txBytes, dataToSign, wallet.GetPublicKey()); err != nil {
+		t.Fatalf("Prepared transaction is not accepted: %s", err.Error())
+	}
+
+	// node sends harmless transaction and other data to sign
+	other := *tx
+	other.Vout = []structures.TXCurrrencyOutput{structures.TXCurrrencyOutput{Value: 100, PubKeyHash: []byte{4}}}
+
+	otherData, _ := other.GetSignData()
+
+	if wc.checkSigningPolicy(txBytes, otherData, wallet.GetPublicKey()) == nil {
+		t.Fatalf("Other data to sign are accepted")
+	}
+
+	otherWallet := Wallet{}
+	otherWallet.MakeWallet()
+
+	if wc.checkSigningPolicy(txBytes, dataToSign, otherWallet.GetPublicKey()) == nil {
+		t.Fatalf("Transaction of other key is accepted")
+	}
+}
@@ -0,0 +1,53 @@
+package remoteclient
+
+import (
+	"fmt"
+
+	"github.com/gelembjuk/oursql/lib/nodeclient"
+)
+
+// Purpose of derived addresses used for a change of currency transactions
+const changeAddressPurpose = "change"
+
+// Show warning if an address received funds more times than this
+const addressReuseWarningLimit = 5
+
+// Counts how many times an address received funds from other addresses
+// Change returned from own addresses is not counted
+func (wc *WalletCLI) countAddressReceives(address string, list []nodeclient.ComHistoryTransaction) int {
+	count := 0
+
+	for _, rec := range list {
+		if !rec.IOType || rec.From == address {
+			continue
+		}
+
+		if _, err := wc.WalletsObj.GetWallet(rec.From); err == nil {
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+// Prints warning if an address is reused too many times for receiving
+func (wc *WalletCLI) printAddressReuseWarning(address string, list []nodeclient.ComHistoryTransaction) {
+	count := wc.countAddressReceives(address, list)
+
+	if count > addressReuseWarningLimit {
+		fmt.Printf("Warning! Address %s received funds %d times. Use new address for every payment to keep privacy\n",
+			address, count)
+	}
+}
+
+// Loads history of an address and prints warning if it is reused too many times
+func (wc *WalletCLI) warnAddressReuse(address string) {
+	list, err := loadAddressHistory(wc.NodeCLI, wc.Node, address)
+
+	if err != nil {
+		wc.Logger.Trace.Printf("Can not load history of %s: %s", address, err.Error())
+		return
+	}
+
+	wc.printAddressReuseWarning(address, list)
+}
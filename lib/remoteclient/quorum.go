@@ -0,0 +1,76 @@
+package remoteclient
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+
+	"github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/nodeclient"
+)
+
+// Balance and unspent outputs reported by one node
+type NodeBalanceReport struct {
+	Node    net.NodeAddr
+	Balance nodeclient.ComWalletBalance
+	Unspent int
+	Error   error
+	// reports with same state key are same
+	stateKey string
+}
+
+// Requests balance and unspent outputs of an address from all nodes
+// Returns reports of all nodes and number of nodes in the biggest group of nodes that agree
+func checkBalanceQuorum(client *nodeclient.NodeClient, nodes []net.NodeAddr, address string) ([]NodeBalanceReport, int) {
+	reports := []NodeBalanceReport{}
+	groups := map[string]int{}
+	agreed := 0
+
+	for _, node := range nodes {
+		r := NodeBalanceReport{}
+		r.Node = node
+
+		r.Balance, r.Error = client.SendGetBalance(node, address)
+
+		if r.Error == nil {
+			var list nodeclient.ComUnspentTransactions
+
+			list, r.Error = client.SendGetUnspent(node, address, []byte{})
+
+			if r.Error == nil {
+				r.Unspent = len(list.Transactions)
+				r.stateKey = makeBalanceStateKey(r.Balance, list)
+
+				groups[r.stateKey]++
+
+				if groups[r.stateKey] > agreed {
+					agreed = groups[r.stateKey]
+				}
+			}
+		}
+		reports = append(reports, r)
+	}
+
+	return reports, agreed
+}
+
+// Builds a key from approved balance and list of unspent outputs
+// Pending balance is not used as pools on nodes can be different for some time
+func makeBalanceStateKey(balance nodeclient.ComWalletBalance, list nodeclient.ComUnspentTransactions) string {
+	outputs := []string{}
+
+	for _, tx := range list.Transactions {
+		outputs = append(outputs, fmt.Sprintf("%x:%d:%.8f", tx.TXID, tx.Vout, tx.Amount))
+	}
+	sort.Strings(outputs)
+
+	h := sha256.New()
+
+	fmt.Fprintf(h, "%.8f", balance.Approved)
+
+	for _, o := range outputs {
+		h.Write([]byte(o))
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
@@ -0,0 +1,337 @@
+package remoteclient
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Default listening address of wallet RPC server. Same port as bitcoind uses
+const rpcDefaultAddress = "127.0.0.1:8332"
+
+// Error codes compatible with bitcoind
+const (
+	rpcErrorMisc              = -1
+	rpcErrorInvalidAddress    = -5
+	rpcErrorInsufficientFunds = -6
+	rpcErrorInvalidRequest    = -32600
+	rpcErrorMethodNotFound    = -32601
+	rpcErrorInvalidParams     = -32602
+	rpcErrorParse             = -32700
+)
+
+type rpcRequest struct {
+	ID     interface{}       `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+type rpcResponse struct {
+	Result interface{} `json:"result"`
+	Error  *rpcError   `json:"error"`
+	ID     interface{} `json:"id"`
+}
+
+// Transaction record in the format of bitcoind listtransactions
+type RPCTransaction struct {
+	Address       string  `json:"address"`
+	Category      string  `json:"category"`
+	Amount        float64 `json:"amount"`
+	Label         string  `json:"label"`
+	Confirmations int     `json:"confirmations"`
+	BlockHash     string  `json:"blockhash,omitempty"`
+	BlockHeight   int     `json:"blockheight,omitempty"`
+	TXID          string  `json:"txid"`
+	Time          int64   `json:"time"`
+	TimeReceived  int64   `json:"timereceived"`
+}
+
+// JSON-RPC server with a subset of bitcoind wallet calls
+// It allows to use existent exchange and accounting tools with the wallet
+type walletRPCServer struct {
+	wc *WalletCLI
+	// wallets file and node client are not safe for concurrent use
+	lock *sync.Mutex
+}
+
+type rpcMethod func(params []json.RawMessage) (interface{}, error)
+
+func (wc *WalletCLI) commandRPCServer() error {
+	if wc.Input.RPCUser == "" || wc.Input.RPCPassword == "" {
+		return errors.New("RPC user and password must be set")
+	}
+
+	address := wc.Input.RPCAddress
+
+	if address == "" {
+		address = rpcDefaultAddress
+	}
+
+	wc.NonInteractive = true
+
+	s := &walletRPCServer{wc, &sync.Mutex{}}
+
+	wc.Logger.Trace.Printf("Start wallet RPC server on %s", address)
+
+	return http.ListenAndServe(address, s)
+}
+
+func (s *walletRPCServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, password, ok := r.BasicAuth()
+
+	if !ok ||
+		subtle.ConstantTimeCompare([]byte(user), []byte(s.wc.Input.RPCUser)) != 1 ||
+		subtle.ConstantTimeCompare([]byte(password), []byte(s.wc.Input.RPCPassword)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="jsonrpc"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "JSON-RPC server handles only POST requests", http.StatusMethodNotAllowed)
+		return
+	}
+
+	request := rpcRequest{}
+	response := rpcResponse{}
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+
+	if err != nil {
+		response.Error = &rpcError{rpcErrorParse, "Parse error"}
+	} else {
+		response.ID = request.ID
+		response.Result, err = s.execute(request)
+
+		if err != nil {
+			if rerr, ok := err.(*rpcError); ok {
+				response.Error = rerr
+			} else {
+				response.Error = &rpcError{rpcErrorMisc, err.Error()}
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if response.Error != nil {
+		// bitcoind returns errors with these statuses
+		if response.Error.Code == rpcErrorMethodNotFound {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *walletRPCServer) execute(request rpcRequest) (interface{}, error) {
+	methods := map[string]rpcMethod{
+		"getbalance":       s.getBalance,
+		"listtransactions": s.listTransactions,
+		"sendtoaddress":    s.sendToAddress,
+		"getnewaddress":    s.getNewAddress,
+	}
+
+	method, ok := methods[request.Method]
+
+	if !ok {
+		return nil, &rpcError{rpcErrorMethodNotFound, "Method not found"}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.wc.Logger.Trace.Printf("RPC call %s", request.Method)
+
+	return method(request.Params)
+}
+
+// Reads optional positional argument. Missed or null argument keeps default value
+func (s *walletRPCServer) getParam(params []json.RawMessage, index int, value interface{}) error {
+	if index >= len(params) || string(params[index]) == "null" {
+		return nil
+	}
+
+	err := json.Unmarshal(params[index], value)
+
+	if err != nil {
+		return &rpcError{rpcErrorInvalidParams, "Invalid parameter"}
+	}
+	return nil
+}
+
+// getbalance ( "dummy" minconf )
+// Returns total balance of all addresses. Only approved funds are counted if minconf > 0
+func (s *walletRPCServer) getBalance(params []json.RawMessage) (interface{}, error) {
+	minconf := 1
+
+	err := s.getParam(params, 1, &minconf)
+
+	if err != nil {
+		return nil, err
+	}
+
+	total := float64(0)
+
+	for _, address := range s.wc.WalletsObj.GetAddresses() {
+		balance, err := s.wc.NodeCLI.SendGetBalance(s.wc.Node, address)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if minconf > 0 {
+			total += balance.Approved
+		} else {
+			total += balance.Total
+		}
+	}
+
+	return total, nil
+}
+
+// listtransactions ( "label" count skip )
+// Returns most recent transactions of all addresses. Oldest first like bitcoind does
+func (s *walletRPCServer) listTransactions(params []json.RawMessage) (interface{}, error) {
+	count := 10
+	skip := 0
+
+	err := s.getParam(params, 1, &count)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.getParam(params, 2, &skip)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if count < 0 || skip < 0 {
+		return nil, &rpcError{rpcErrorInvalidParams, "Negative count or skip"}
+	}
+
+	list := []RPCTransaction{}
+
+	for _, address := range s.wc.WalletsObj.GetAddresses() {
+		history, err := loadAddressHistory(s.wc.NodeCLI, s.wc.Node, address)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rec := range history {
+			tx := RPCTransaction{}
+			tx.Address = address
+			tx.Amount = rec.Amount
+			tx.Category = "receive"
+
+			if !rec.IOType {
+				tx.Address = rec.To
+				tx.Amount = -rec.Amount
+				tx.Category = "send"
+			}
+			tx.Confirmations = rec.Confirmations
+			tx.BlockHash = hex.EncodeToString(rec.BlockHash)
+			tx.BlockHeight = rec.BlockHeight
+			tx.TXID = hex.EncodeToString(rec.TXID)
+			tx.Time = rec.Time
+			tx.TimeReceived = rec.Time
+
+			list = append(list, tx)
+		}
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Time < list[j].Time
+	})
+
+	end := len(list) - skip
+
+	if end < 0 {
+		end = 0
+	}
+
+	start := end - count
+
+	if start < 0 {
+		start = 0
+	}
+
+	return list[start:end], nil
+}
+
+// sendtoaddress "address" amount
+// Sends from first address that has enough approved funds. Returns transaction ID
+func (s *walletRPCServer) sendToAddress(params []json.RawMessage) (interface{}, error) {
+	to := ""
+	amount := float64(0)
+
+	err := s.getParam(params, 0, &to)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.getParam(params, 1, &amount)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// an address or a name from the names registry
+	to, err = s.wc.resolveAddress(to)
+
+	if err != nil {
+		return nil, &rpcError{rpcErrorInvalidAddress, err.Error()}
+	}
+
+	if amount <= 0 {
+		return nil, &rpcError{rpcErrorInvalidParams, "Amount must be positive"}
+	}
+
+	for _, address := range s.wc.WalletsObj.GetAddresses() {
+		balance, err := s.wc.NodeCLI.SendGetBalance(s.wc.Node, address)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// pending funds are counted too. a node can build a transaction on outputs of
+		// not yet confirmed transactions, for example on a change of previous payment
+		if balance.Total < amount {
+			continue
+		}
+
+		txID, err := s.wc.sendCurrency(address, to, amount)
+
+		if err != nil {
+			return nil, err
+		}
+		return hex.EncodeToString(txID), nil
+	}
+
+	return nil, &rpcError{rpcErrorInsufficientFunds, "Insufficient funds"}
+}
+
+// getnewaddress
+// Creates new address in the wallets file
+func (s *walletRPCServer) getNewAddress(params []json.RawMessage) (interface{}, error) {
+	return s.wc.WalletsObj.CreateWallet()
+}
@@ -0,0 +1,246 @@
+package remoteclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/nodeclient"
+	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/structures"
+)
+
+// Max number of headers to request in one call
+const verifyHeadersPageSize = 1000
+
+// Default lowest complexity of blocks. Same as the default of the consensus
+const verifyDefaultMinComplexity = 16
+
+// Result of verification of single unspent output
+type VerifiedUnspentOutput struct {
+	Output      nodeclient.ComUnspentTransaction
+	BlockHash   []byte
+	BlockHeight int
+	Valid       bool
+	Error       string
+}
+
+// Checks unspent outputs reported by a node. Each output must be in a transaction
+// that is committed to a block with Merkle proof and the block must be in a chain
+// ending with the top block reported by the node
+// Hash of every header is calculated again and checked against the proof of work target of the complexity
+// in the header. Wallet doesn't know consensus rules, so the complexity must be same in all headers
+// and not lower than MinComplexity
+type unspentVerifier struct {
+	NodeCLI       *nodeclient.NodeClient
+	Node          net.NodeAddr
+	Logger        *utils.LoggerMan
+	MinComplexity int
+	// headers of blocks in the chain. Key is a hash of block
+	headers      map[string]nodeclient.ComBlockHeader
+	lowestHeader *nodeclient.ComBlockHeader
+}
+
+// Verifies list of unspent outputs for address. Returns result for each output
+func (v *unspentVerifier) VerifyUnspent(address string, list nodeclient.ComUnspentTransactions) ([]VerifiedUnspentOutput, error) {
+	pubKeyHash, err := utils.AddresToPubKeyHash(address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	v.headers = make(map[string]nodeclient.ComBlockHeader)
+	v.lowestHeader = nil
+
+	result := []VerifiedUnspentOutput{}
+
+	for _, out := range list.Transactions {
+		r := VerifiedUnspentOutput{}
+		r.Output = out
+
+		header, err := v.verifyOutput(out, pubKeyHash, list.LastBlock)
+
+		if err != nil {
+			r.Error = err.Error()
+		} else {
+			r.Valid = true
+			r.BlockHash = header.Hash
+			r.BlockHeight = header.Height
+		}
+
+		result = append(result, r)
+	}
+
+	return result, nil
+}
+
+// Verify single output. Returns header of a block where the transaction is
+func (v *unspentVerifier) verifyOutput(out nodeclient.ComUnspentTransaction, pubKeyHash []byte, topHash []byte) (*nodeclient.ComBlockHeader, error) {
+	proof, err := v.NodeCLI.SendGetTransactionProof(v.Node, out.TXID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := structures.DeserializeTransaction(proof.Transaction)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Compare(tx.GetID(), out.TXID) != 0 {
+		return nil, errors.New("Node returned other transaction")
+	}
+
+	if out.Vout < 0 || out.Vout >= len(tx.Vout) {
+		return nil, errors.New("Output is not found in the transaction")
+	}
+
+	txOut := tx.Vout[out.Vout]
+
+	if bytes.Compare(txOut.PubKeyHash, pubKeyHash) != 0 {
+		return nil, errors.New("Output is not locked to the address")
+	}
+
+	if txOut.Value != out.Amount {
+		return nil, errors.New(fmt.Sprintf("Output amount is %.8f but node reported %.8f", txOut.Value, out.Amount))
+	}
+
+	txBytes, err := tx.ToBytes()
+
+	if err != nil {
+		return nil, err
+	}
+
+	merkleProof := utils.MerkleProof{Hashes: proof.Proof, Left: proof.ProofLeft}
+
+	if !utils.VerifyMerkleProof(txBytes, proof.Header.MerkleRoot, &merkleProof) {
+		return nil, errors.New("Merkle proof is not valid")
+	}
+
+	// check the block is in the chain
+	header, err := v.getHeaderInChain(proof.Header.Hash, proof.Header.Height, topHash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Compare(header.MerkleRoot, proof.Header.MerkleRoot) != 0 {
+		return nil, errors.New("Merkle root of the block doesn't match the chain")
+	}
+
+	return header, nil
+}
+
+// Finds a header in the chain. Loads more headers from a node if needed
+func (v *unspentVerifier) getHeaderInChain(hash []byte, height int, topHash []byte) (*nodeclient.ComBlockHeader, error) {
+	for {
+		if h, ok := v.headers[string(hash)]; ok {
+			return &h, nil
+		}
+
+		if v.lowestHeader != nil && (v.lowestHeader.Height <= height || len(v.lowestHeader.PrevBlockHash) == 0) {
+			return nil, errors.New("Block is not in the chain")
+		}
+
+		startFrom := topHash
+
+		if v.lowestHeader != nil {
+			startFrom = v.lowestHeader.PrevBlockHash
+		}
+
+		err := v.loadHeaders(startFrom)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Load next page of headers and check they are linked correctly
+func (v *unspentVerifier) loadHeaders(startFrom []byte) error {
+	headers, err := v.NodeCLI.SendGetBlockHeaders(v.Node, startFrom, verifyHeadersPageSize)
+
+	if err != nil {
+		return err
+	}
+
+	if len(headers) == 0 {
+		return errors.New("Node returned no block headers")
+	}
+
+	for i := range headers {
+		h := headers[i]
+
+		if v.lowestHeader == nil {
+			if len(startFrom) > 0 && bytes.Compare(h.Hash, startFrom) != 0 {
+				return errors.New("Node returned wrong top block")
+			}
+		} else {
+			if bytes.Compare(v.lowestHeader.PrevBlockHash, h.Hash) != 0 ||
+				v.lowestHeader.Height != h.Height+1 {
+				return errors.New(fmt.Sprintf("Blocks chain is broken at height %d", h.Height))
+			}
+		}
+
+		err = v.checkHeaderHash(h)
+
+		if err != nil {
+			return err
+		}
+
+		v.headers[string(h.Hash)] = h
+		v.lowestHeader = &h
+	}
+
+	return nil
+}
+
+// Calculates a hash of a header same way as proof of work of a node does it. The complexity is a part
+// of hashed data, so a node can not make the target lower without making new hash. Blocks of higher
+// complexity have lower hashes, they are valid for this target too
+func (v *unspentVerifier) checkHeaderHash(h nodeclient.ComBlockHeader) error {
+	min := v.MinComplexity
+
+	if min <= 0 {
+		min = verifyDefaultMinComplexity
+	}
+
+	if h.Complexity < min || h.Complexity > 255 {
+		return errors.New(fmt.Sprintf("Complexity %d of block %d is not accepted", h.Complexity, h.Height))
+	}
+
+	if v.lowestHeader != nil && v.lowestHeader.Complexity != h.Complexity {
+		return errors.New(fmt.Sprintf("Complexity of block %d is different", h.Height))
+	}
+
+	data := bytes.Join(
+		[][]byte{
+			h.PrevBlockHash,
+			h.MerkleRoot,
+			utils.IntToHex(h.Timestamp),
+			utils.IntToHex(int64(h.Complexity)),
+			utils.IntToHex(int64(h.Nonce)),
+		},
+		[]byte{},
+	)
+	hash := sha256.Sum256(data)
+
+	if bytes.Compare(hash[:], h.Hash) != 0 {
+		return errors.New(fmt.Sprintf("Hash of block %d is not valid", h.Height))
+	}
+
+	target := big.NewInt(1)
+	target.Lsh(target, uint(256-h.Complexity))
+
+	var hashInt big.Int
+	hashInt.SetBytes(hash[:])
+
+	if hashInt.Cmp(target) != -1 {
+		return errors.New(fmt.Sprintf("Hash of block %d is above the target", h.Height))
+	}
+	return nil
+}
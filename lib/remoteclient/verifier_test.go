@@ -0,0 +1,51 @@
+package remoteclient
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/gelembjuk/oursql/lib/nodeclient"
+)
+
+func TestCheckHeaderHash(t *testing.T) {
+	// header of a block made by proof of work of a node with complexity 12
+	hash, _ := hex.DecodeString("000aa62161996854c339ae94198ccf539d3d8cf726b396e1f6ff0f0dd525a109")
+	root, _ := hex.DecodeString("1931de41d82f658f897b8118d8a13901ca16f26c399ab217f8bd2ec880aab264")
+
+	header := nodeclient.ComBlockHeader{Timestamp: 1500000000, PrevBlockHash: []byte{1, 2, 3},
+		Hash: hash, Nonce: 1757, Height: 1, MerkleRoot: root, Complexity: 12}
+
+	v := unspentVerifier{MinComplexity: 12}
+
+	if err := v.checkHeaderHash(header); err != nil {
+		t.Fatalf("Header is not valid: %s", err.Error())
+	}
+
+	// a node can not send a header of other data or lower complexity
+	changed := header
+	changed.Nonce++
+
+	if v.checkHeaderHash(changed) == nil {
+		t.Fatalf("Wrong nonce is accepted")
+	}
+
+	changed = header
+	changed.MerkleRoot = []byte{7}
+
+	if v.checkHeaderHash(changed) == nil {
+		t.Fatalf("Wrong Merkle root is accepted")
+	}
+
+	changed = header
+	changed.Complexity = 13
+
+	if v.checkHeaderHash(changed) == nil {
+		t.Fatalf("Other complexity is accepted")
+	}
+
+	v.MinComplexity = 0
+
+	if v.checkHeaderHash(header) == nil {
+		t.Fatalf("Complexity lower than default is accepted")
+	}
+}
@@ -3,11 +3,17 @@ package remoteclient
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha512"
 	"crypto/x509"
 	"encoding/hex"
 	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
 
 	"github.com/gelembjuk/oursql/lib"
 	"github.com/gelembjuk/oursql/lib/utils"
@@ -15,10 +21,21 @@ import (
 
 const keysTestString = "this is the test string to use for new keys. to know that sign and verify works fine"
 
+// Version bytes for private key in paper wallet format
+const (
+	privateKeyWIFVersion        = byte(0x80)
+	privateKeyWIFVersionEd25519 = byte(0x81)
+)
+
 // Wallet stores private and public keys
 type Wallet struct {
 	PrivateKey ecdsa.PrivateKey
-	PublicKey  []byte
+	// Private key of Ed25519 wallet. PrivateKey is empty in this case
+	EdPrivateKey ed25519.PrivateKey
+	PublicKey    []byte
+	// Derivation info. Empty for random keys
+	Purpose string
+	Index   int
 }
 
 type WalletBalance struct {
@@ -39,6 +56,30 @@ func MakeWalletFromEncoded(pubkeyenc, prikeyenc string) (wallet Wallet, err erro
 
 	p, _ := pem.Decode(prikeybytes)
 
+	if p == nil {
+		err = errors.New("Private key has wrong format")
+		return
+	}
+
+	if p.Type == "PRIVATE KEY" {
+		// Ed25519 key is stored in PKCS8 format
+		var key interface{}
+		key, err = x509.ParsePKCS8PrivateKey(p.Bytes)
+
+		if err != nil {
+			return
+		}
+
+		edkey, ok := key.(ed25519.PrivateKey)
+
+		if !ok {
+			err = errors.New("Private key type is not supported")
+			return
+		}
+		wallet.EdPrivateKey = edkey
+		return
+	}
+
 	prikey, err := x509.ParseECPrivateKey(p.Bytes)
 
 	if err != nil {
@@ -50,6 +91,45 @@ func MakeWalletFromEncoded(pubkeyenc, prikeyenc string) (wallet Wallet, err erro
 	return
 }
 
+// Restores a wallet from private key in paper wallet format (WIF like)
+func MakeWalletFromWIF(wif string) (wallet Wallet, err error) {
+	payload := utils.Base58Decode([]byte(wif))
+
+	if len(payload) <= lib.AddressChecksumLen+1 {
+		err = errors.New("Private key has wrong format")
+		return
+	}
+
+	checksum := payload[len(payload)-lib.AddressChecksumLen:]
+	payload = payload[:len(payload)-lib.AddressChecksumLen]
+
+	if bytes.Compare(checksum, utils.Checksum(payload)) != 0 {
+		err = errors.New("Private key checksum is wrong")
+		return
+	}
+
+	if payload[0] == privateKeyWIFVersionEd25519 && len(payload) == ed25519.SeedSize+1 {
+		wallet.EdPrivateKey = ed25519.NewKeyFromSeed(payload[1:])
+		wallet.PublicKey = utils.MakeEd25519PubKey(wallet.EdPrivateKey.Public().(ed25519.PublicKey))
+		return
+	}
+
+	if payload[0] != privateKeyWIFVersion {
+		err = errors.New("Private key version is not supported")
+		return
+	}
+
+	curve := elliptic.P256()
+
+	wallet.PrivateKey.PublicKey.Curve = curve
+	wallet.PrivateKey.D = new(big.Int).SetBytes(payload[1:])
+	wallet.PrivateKey.PublicKey.X, wallet.PrivateKey.PublicKey.Y = curve.ScalarBaseMult(payload[1:])
+
+	wallet.PublicKey = append(wallet.PrivateKey.PublicKey.X.Bytes(), wallet.PrivateKey.PublicKey.Y.Bytes()...)
+
+	return
+}
+
 // MakeWallet creates Wallet. It generates new keys pair and assign to the object
 func (w *Wallet) MakeWallet() {
 	var private ecdsa.PrivateKey
@@ -93,6 +173,73 @@ func (w *Wallet) MakeWallet() {
 	w.PublicKey = public
 }
 
+// Creates new Ed25519 keys pair. Such wallet has faster verification and smaller signatures
+func (w *Wallet) MakeEd25519Wallet() error {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+
+	if err != nil {
+		return err
+	}
+
+	w.EdPrivateKey = private
+	w.PublicKey = utils.MakeEd25519PubKey(public)
+
+	return nil
+}
+
+// MakeDerivedWallet creates keys from a seed for given purpose and index
+// Same seed, purpose and index always give same keys. So, derived wallets can be recovered from the seed
+func (w *Wallet) MakeDerivedWallet(seed []byte, purpose string, index int) error {
+	if len(seed) == 0 {
+		return errors.New("Seed is empty")
+	}
+	curve := elliptic.P256()
+	n := new(big.Int).Sub(curve.Params().N, big.NewInt(1))
+
+	// public key is stored as X and Y bytes without padding. We skip keys where X or Y is shorter
+	// and keys that don't pass sign test, same as when random keys are generated
+	for attempt := 0; attempt < 1000; attempt++ {
+		mac := hmac.New(sha512.New, seed)
+		mac.Write([]byte(fmt.Sprintf("oursql/%s/%d/%d", purpose, index, attempt)))
+		sum := mac.Sum(nil)
+
+		d := new(big.Int).SetBytes(sum[:32])
+		d.Mod(d, n)
+		d.Add(d, big.NewInt(1))
+
+		private := ecdsa.PrivateKey{}
+		private.PublicKey.Curve = curve
+		private.D = d
+		private.PublicKey.X, private.PublicKey.Y = curve.ScalarBaseMult(d.Bytes())
+
+		public := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
+
+		if len(public) != 64 {
+			continue
+		}
+
+		signature, err := utils.SignData(private, []byte(keysTestString))
+
+		if err != nil {
+			continue
+		}
+
+		vr, err := utils.VerifySignature(signature, []byte(keysTestString), public)
+
+		if err != nil || !vr {
+			continue
+		}
+
+		w.PrivateKey = private
+		w.PublicKey = public
+		w.Purpose = purpose
+		w.Index = index
+
+		return nil
+	}
+	return errors.New("Can not derive keys for this purpose")
+}
+
 // Returns public key of a wallet
 func (w Wallet) GetPublicKey() []byte {
 	return w.PublicKey
@@ -103,6 +250,19 @@ func (w Wallet) GetPrivateKey() ecdsa.PrivateKey {
 	return w.PrivateKey
 }
 
+// Returns signature scheme of the wallet keys
+func (w Wallet) GetScheme() byte {
+	return utils.GetPubKeyScheme(w.PublicKey)
+}
+
+// Returns signer to sign data with wallet keys
+func (w Wallet) GetSigner() utils.Signer {
+	if w.GetScheme() == lib.SignatureSchemeEd25519 {
+		return utils.NewEd25519Signer(w.EdPrivateKey)
+	}
+	return utils.NewLocalSigner(w.PublicKey, w.PrivateKey)
+}
+
 // Encode PubKey to string.
 // We will use this for easy storing in a file
 func (w Wallet) GetPublicKeyEncoded() string {
@@ -111,6 +271,12 @@ func (w Wallet) GetPublicKeyEncoded() string {
 
 // Encode PrivateKey to string.
 func (w Wallet) GetPrivateKeyEncoded() string {
+	if w.GetScheme() == lib.SignatureSchemeEd25519 {
+		marshalled, _ := x509.MarshalPKCS8PrivateKey(w.EdPrivateKey)
+
+		return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: marshalled}))
+	}
+
 	marshalled, _ := x509.MarshalECPrivateKey(&w.PrivateKey)
 	pemdata := pem.EncodeToMemory(
 		&pem.Block{
@@ -122,17 +288,29 @@ func (w Wallet) GetPrivateKeyEncoded() string {
 	return string(pemdata)
 }
 
-// GetAddress returns wallet address
-func (w Wallet) GetAddress() []byte {
-	pubKeyHash, _ := utils.HashPubKey(w.PublicKey)
+// Encode PrivateKey to paper wallet format. It is base58 with version and checksum
+func (w Wallet) GetPrivateKeyWIF() string {
+	if w.GetScheme() == lib.SignatureSchemeEd25519 {
+		payload := append([]byte{privateKeyWIFVersionEd25519}, w.EdPrivateKey.Seed()...)
+		payload = append(payload, utils.Checksum(payload)...)
+
+		return string(utils.Base58Encode(payload))
+	}
 
-	versionedPayload := append([]byte{lib.Version}, pubKeyHash...)
-	checksum := utils.Checksum(versionedPayload)
+	d := make([]byte, 32)
+	w.PrivateKey.D.FillBytes(d)
 
-	fullPayload := append(versionedPayload, checksum...)
-	address := utils.Base58Encode(fullPayload)
+	payload := append([]byte{privateKeyWIFVersion}, d...)
+	payload = append(payload, utils.Checksum(payload)...)
+
+	return string(utils.Base58Encode(payload))
+}
+
+// GetAddress returns wallet address
+func (w Wallet) GetAddress() []byte {
+	address, _ := utils.PubKeyToAddres(w.PublicKey)
 
-	return address
+	return []byte(address)
 }
 
 // ValidateAddress check if address is valid, has valid format
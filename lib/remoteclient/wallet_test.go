@@ -3,6 +3,7 @@ package remoteclient
 import (
 	"testing"
 
+	"github.com/gelembjuk/oursql/lib"
 	"github.com/gelembjuk/oursql/lib/utils"
 )
 
@@ -53,3 +54,128 @@ func TestKeysEncoding(t *testing.T) {
 		t.Fatalf("Verify 2 is FALSE. True expected")
 	}
 }
+
+func TestDerivedWallet(t *testing.T) {
+	seed := []byte("0123456789abcdef0123456789abcdef")
+
+	w1 := Wallet{}
+	err := w1.MakeDerivedWallet(seed, "app:blog", 0)
+
+	if err != nil {
+		t.Fatalf("Derive 1 failed: %s", err.Error())
+	}
+
+	w2 := Wallet{}
+	err = w2.MakeDerivedWallet(seed, "app:blog", 0)
+
+	if err != nil {
+		t.Fatalf("Derive 2 failed: %s", err.Error())
+	}
+
+	if string(w1.GetAddress()) != string(w2.GetAddress()) {
+		t.Fatalf("Same seed and path must give same address")
+	}
+
+	w3 := Wallet{}
+	err = w3.MakeDerivedWallet(seed, "table:users", 0)
+
+	if err != nil {
+		t.Fatalf("Derive 3 failed: %s", err.Error())
+	}
+
+	if string(w1.GetAddress()) == string(w3.GetAddress()) {
+		t.Fatalf("Different purpose must give different address")
+	}
+
+	message := "Message to sign"
+
+	signature, err := utils.SignData(w3.PrivateKey, []byte(message))
+
+	if err != nil {
+		t.Fatalf("Signing failed: %s", err.Error())
+	}
+
+	vr, err := utils.VerifySignature(signature, []byte(message), w3.PublicKey)
+
+	if err != nil || !vr {
+		t.Fatalf("Verify of derived key failed")
+	}
+}
+
+func TestPaperWalletEncoding(t *testing.T) {
+	wallet := Wallet{}
+	wallet.MakeWallet()
+
+	restored, err := MakeWalletFromWIF(wallet.GetPrivateKeyWIF())
+
+	if err != nil {
+		t.Fatalf("Wallet restore failed: %s", err.Error())
+	}
+
+	if string(restored.GetAddress()) != string(wallet.GetAddress()) {
+		t.Fatalf("Restored address is different")
+	}
+
+	_, err = MakeWalletFromWIF("1" + wallet.GetPrivateKeyWIF())
+
+	if err == nil {
+		t.Fatalf("Error expected for wrong key")
+	}
+}
+
+func TestEd25519Wallet(t *testing.T) {
+	wallet := Wallet{}
+
+	err := wallet.MakeEd25519Wallet()
+
+	if err != nil {
+		t.Fatalf("Wallet create failed: %s", err.Error())
+	}
+
+	if wallet.GetScheme() != lib.SignatureSchemeEd25519 {
+		t.Fatalf("Wrong scheme of the wallet")
+	}
+
+	signature, err := utils.SignDataBySigner(wallet.GetSigner(), []byte(keysTestString))
+
+	if err != nil {
+		t.Fatalf("Sign failed: %s", err.Error())
+	}
+
+	restored, err := MakeWalletFromEncoded(wallet.GetPublicKeyEncoded(), wallet.GetPrivateKeyEncoded())
+
+	if err != nil {
+		t.Fatalf("Wallet restore failed: %s", err.Error())
+	}
+
+	v, err := utils.VerifySignature(signature, []byte(keysTestString), restored.GetPublicKey())
+
+	if err != nil || !v {
+		t.Fatalf("Signature is not valid with restored key")
+	}
+
+	paper, err := MakeWalletFromWIF(wallet.GetPrivateKeyWIF())
+
+	if err != nil {
+		t.Fatalf("Paper wallet restore failed: %s", err.Error())
+	}
+
+	if string(paper.GetAddress()) != string(wallet.GetAddress()) {
+		t.Fatalf("Restored address is different")
+	}
+
+	// hash of a key doesn't depend on the version byte of the address
+	pubKeyHash, _ := utils.AddresToPubKeyHash(string(wallet.GetAddress()))
+	expected, _ := utils.HashPubKey(wallet.GetPublicKey())
+
+	if string(pubKeyHash) != string(expected) {
+		t.Fatalf("Wrong pub key hash of the address")
+	}
+
+	// address made from an output locked with the hash is same
+	address, _ := utils.PubKeyHashToAddres(pubKeyHash)
+
+	if address != string(wallet.GetAddress()) {
+		t.Fatalf("Address from the hash %s is not %s", address, wallet.GetAddress())
+	}
+}
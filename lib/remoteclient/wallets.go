@@ -1,6 +1,9 @@
 package remoteclient
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,6 +19,9 @@ type Wallets struct {
 
 	Wallets map[string]*Wallet
 
+	// Seed for derived addresses
+	Seed []byte
+
 	Logger *utils.LoggerMan
 
 	WalletsFile string
@@ -25,9 +31,12 @@ type WalletsFileRec struct {
 	Address    string
 	PubKey     string
 	PrivateKey string
+	Purpose    string
+	Index      int
 }
 type WalletsFile struct {
 	Wallets []WalletsFileRec
+	Seed    string
 }
 
 func NewWallets(confdir string) Wallets {
@@ -57,6 +66,91 @@ func (ws *Wallets) CreateWallet() (string, error) {
 	return address, nil
 }
 
+// Adds new Ed25519 wallet
+func (ws *Wallets) CreateEd25519Wallet() (string, error) {
+	wallet := Wallet{}
+
+	err := wallet.MakeEd25519Wallet()
+
+	if err != nil {
+		return "", err
+	}
+
+	address := string(wallet.GetAddress())
+
+	ws.Wallets[address] = &wallet
+
+	err = ws.SaveToFile()
+
+	if err != nil {
+		return "", err
+	}
+
+	return address, nil
+}
+
+// Creates new derived address for a purpose. Purpose is any label, like application or table name
+// If index is less 0 then next free index for this purpose is used
+// Seed is generated if this is first derived address
+func (ws *Wallets) CreateDerivedWallet(purpose string, index int) (string, error) {
+	if purpose == "" {
+		return "", errors.New("Purpose is empty")
+	}
+
+	if len(ws.Seed) == 0 {
+		ws.Seed = make([]byte, 32)
+
+		_, err := rand.Read(ws.Seed)
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if index < 0 {
+		index = 0
+
+		for _, w := range ws.Wallets {
+			if w.Purpose == purpose && w.Index >= index {
+				index = w.Index + 1
+			}
+		}
+	}
+
+	wallet := Wallet{}
+
+	err := wallet.MakeDerivedWallet(ws.Seed, purpose, index)
+
+	if err != nil {
+		return "", err
+	}
+
+	address := string(wallet.GetAddress())
+
+	ws.Wallets[address] = &wallet
+
+	err = ws.SaveToFile()
+
+	if err != nil {
+		return "", err
+	}
+
+	return address, nil
+}
+
+// Set seed for derived addresses. It can be set only if there is no seed yet
+func (ws *Wallets) SetSeed(seed []byte) error {
+	if len(ws.Seed) > 0 && bytes.Compare(ws.Seed, seed) != 0 {
+		return errors.New("Wallets file already has other seed")
+	}
+	if len(seed) < 16 {
+		return errors.New("Seed is too short")
+	}
+	ws.Seed = seed
+
+	return ws.SaveToFile()
+}
+
 // Import wallets from external file
 func (ws *Wallets) ImportWallet(filepath string) ([]string, error) {
 	if filepath == "" {
@@ -183,9 +277,20 @@ func (ws *Wallets) LoadFromFile() error {
 			return err
 		}
 
+		wallet.Purpose = w.Purpose
+		wallet.Index = w.Index
+
 		ws.Wallets[w.Address] = &wallet
 	}
 
+	if wsc.Seed != "" {
+		ws.Seed, err = hex.DecodeString(wsc.Seed)
+
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -198,10 +303,19 @@ func (ws Wallets) SaveToFile() error {
 	wsc.Wallets = []WalletsFileRec{}
 
 	for _, wallet := range ws.Wallets {
-		w := WalletsFileRec{string(wallet.GetAddress()), wallet.GetPublicKeyEncoded(), wallet.GetPrivateKeyEncoded()}
+		w := WalletsFileRec{}
+		w.Address = string(wallet.GetAddress())
+		w.PubKey = wallet.GetPublicKeyEncoded()
+		w.PrivateKey = wallet.GetPrivateKeyEncoded()
+		w.Purpose = wallet.Purpose
+		w.Index = wallet.Index
 		wsc.Wallets = append(wsc.Wallets, w)
 	}
 
+	if len(ws.Seed) > 0 {
+		wsc.Seed = hex.EncodeToString(ws.Seed)
+	}
+
 	file, errf := os.OpenFile(walletsFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 
 	if errf != nil {
@@ -0,0 +1,367 @@
+package remoteclient
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/nodeclient"
+	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/structures"
+)
+
+const (
+	WatchEventReceived    = "received"    // an address received funds
+	WatchEventRowModified = "rowmodified" // a row created by a wallet key was modified by other transaction
+	WatchEventReorg       = "reorg"       // blocks checked before are replaced by other branch from the height
+)
+
+const (
+	// headers loaded in one request when looking for new blocks
+	watchHeadersPageSize = 100
+	// hashes of checked blocks are remembered to find where other branch starts
+	watchRememberBlocks = 1000
+)
+
+// Event found by a watcher
+type WatchEvent struct {
+	Kind        string
+	Address     string
+	TXID        string
+	Amount      float64
+	BlockHash   string
+	BlockHeight int
+	Query       string
+	PrevTXID    string
+}
+
+type WatchCallback func(event WatchEvent) error
+
+// Watches new blocks on a node and notifies about events related to addresses
+// It polls a node for headers of top blocks and loads new blocks
+type addressWatcher struct {
+	NodeCLI  *nodeclient.NodeClient
+	Node     net.NodeAddr
+	Logger   *utils.LoggerMan
+	Interval time.Duration
+	Callback WatchCallback
+
+	// key is pub key hash, value is address
+	addresses map[string]string
+	// authors of transactions we already checked. key is TX ID
+	txAuthors map[string][]byte
+	// hashes of checked blocks. Key is a height
+	checked    map[int][]byte
+	lastTop    []byte
+	lastHeight int
+	stopChan   chan bool
+}
+
+func newAddressWatcher(client *nodeclient.NodeClient, node net.NodeAddr, logger *utils.LoggerMan) *addressWatcher {
+	w := &addressWatcher{}
+	w.NodeCLI = client
+	w.Node = node
+	w.Logger = logger
+	w.Interval = 10 * time.Second
+	w.addresses = make(map[string]string)
+	w.txAuthors = make(map[string][]byte)
+	w.checked = make(map[int][]byte)
+	w.stopChan = make(chan bool)
+	return w
+}
+
+// Add address to the list of watched
+func (w *addressWatcher) AddAddress(address string) error {
+	pubKeyHash, err := utils.AddresToPubKeyHash(address)
+
+	if err != nil {
+		return err
+	}
+	w.addresses[string(pubKeyHash)] = address
+	return nil
+}
+
+// Runs the loop of checks. Returns only when Stop is called or on error when getting first state
+func (w *addressWatcher) Run() error {
+	// remember current top. Only blocks created after this moment are checked
+	headers, err := w.NodeCLI.SendGetBlockHeaders(w.Node, []byte{}, 1)
+
+	if err != nil {
+		return err
+	}
+
+	if len(headers) > 0 {
+		w.remember(headers[0])
+	}
+
+	for {
+		select {
+		case <-w.stopChan:
+			return nil
+		case <-time.After(w.Interval):
+		}
+
+		err := w.check()
+
+		if err != nil {
+			// node can be not available for some time. just wait next check
+			w.Logger.Trace.Printf("Watch check error: %s", err.Error())
+		}
+	}
+}
+
+// Stop the loop
+func (w *addressWatcher) Stop() {
+	close(w.stopChan)
+}
+
+// Check for new blocks since last check. Headers are loaded page by page till a block which was checked before.
+// If checked blocks are not in the chain now, other branch replaced them. It is reported with the reorg event
+// and blocks of new branch are checked
+func (w *addressWatcher) check() error {
+	newBlocks := []nodeclient.ComBlockHeader{}
+	lowest := w.lowestChecked()
+	startFrom := []byte{}
+
+pages:
+	for {
+		headers, err := w.NodeCLI.SendGetBlockHeaders(w.Node, startFrom, watchHeadersPageSize)
+
+		if err != nil {
+			return err
+		}
+
+		for _, h := range headers {
+			if hash, ok := w.checked[h.Height]; ok && bytes.Compare(hash, h.Hash) == 0 {
+				break pages
+			}
+
+			if h.Height < lowest {
+				// other branch is longer than remembered blocks
+				break pages
+			}
+			newBlocks = append(newBlocks, h)
+		}
+
+		if len(headers) == 0 || len(headers[len(headers)-1].PrevBlockHash) == 0 {
+			break
+		}
+		startFrom = headers[len(headers)-1].PrevBlockHash
+	}
+
+	if len(newBlocks) == 0 {
+		return nil
+	}
+
+	first := newBlocks[len(newBlocks)-1]
+
+	if len(w.checked) > 0 && first.Height <= w.lastHeight {
+		event := WatchEvent{}
+		event.Kind = WatchEventReorg
+		event.BlockHash = hex.EncodeToString(w.lastTop)
+		event.BlockHeight = first.Height
+
+		w.fire(event)
+
+		for height := range w.checked {
+			if height >= first.Height {
+				delete(w.checked, height)
+			}
+		}
+	}
+
+	// go from lower block to top
+	for i := len(newBlocks) - 1; i >= 0; i-- {
+		err := w.checkBlock(newBlocks[i].Hash)
+
+		if err != nil {
+			return err
+		}
+		w.remember(newBlocks[i])
+	}
+
+	return nil
+}
+
+// Remembers a checked block. Blocks lower than watchRememberBlocks from it are forgotten
+func (w *addressWatcher) remember(h nodeclient.ComBlockHeader) {
+	w.checked[h.Height] = h.Hash
+	delete(w.checked, h.Height-watchRememberBlocks)
+
+	w.lastTop = h.Hash
+	w.lastHeight = h.Height
+}
+
+// Height of the lowest remembered block. -1 if no blocks were checked, all chain is new
+func (w *addressWatcher) lowestChecked() int {
+	lowest := -1
+
+	for height := range w.checked {
+		if lowest < 0 || height < lowest {
+			lowest = height
+		}
+	}
+	return lowest
+}
+
+// Load a block and check all transactions in it
+func (w *addressWatcher) checkBlock(hash []byte) error {
+	response, err := w.NodeCLI.SendGetBlock(w.Node, hash)
+
+	if err != nil {
+		return err
+	}
+
+	block := structures.Block{}
+
+	err = block.DeserializeBlock(response.Block)
+
+	if err != nil {
+		return err
+	}
+
+	for _, tx := range block.Transactions {
+		event := WatchEvent{}
+		event.TXID = hex.EncodeToString(tx.GetID())
+		event.BlockHash = hex.EncodeToString(block.Hash)
+		event.BlockHeight = block.Height
+
+		// funds received
+		for _, out := range tx.Vout {
+			address, ok := w.addresses[string(out.PubKeyHash)]
+
+			if !ok || tx.CreatedByPubKeyHash(out.PubKeyHash) {
+				// skip change returned to same address
+				continue
+			}
+			e := event
+			e.Kind = WatchEventReceived
+			e.Address = address
+			e.Amount = out.Value
+
+			w.fire(e)
+		}
+
+		if !tx.IsSQLCommand() || len(tx.GetSQLBaseTX()) == 0 {
+			continue
+		}
+
+		// row modified. previous transaction for the row was created by one of watched keys
+		prevAuthor, err := w.getTransactionAuthor(tx.GetSQLBaseTX())
+
+		if err != nil {
+			w.Logger.Trace.Printf("Watch. Can not get previous TX %x: %s", tx.GetSQLBaseTX(), err.Error())
+			continue
+		}
+
+		address, ok := w.addresses[string(prevAuthor)]
+
+		if !ok || tx.CreatedByPubKeyHash(prevAuthor) {
+			continue
+		}
+		event.Kind = WatchEventRowModified
+		event.Address = address
+		event.Query = tx.GetSQLQuery()
+		event.PrevTXID = hex.EncodeToString(tx.GetSQLBaseTX())
+
+		w.fire(event)
+	}
+
+	return nil
+}
+
+// Returns pub key hash of a transaction author
+func (w *addressWatcher) getTransactionAuthor(txID []byte) ([]byte, error) {
+	if author, ok := w.txAuthors[string(txID)]; ok {
+		return author, nil
+	}
+
+	response, err := w.NodeCLI.SendGetTransaction(w.Node, txID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := structures.DeserializeTransaction(response.Transaction)
+
+	if err != nil {
+		return nil, err
+	}
+
+	author, err := utils.HashPubKey(tx.ByPubKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	w.txAuthors[string(txID)] = author
+
+	return author, nil
+}
+
+func (w *addressWatcher) fire(event WatchEvent) {
+	w.Logger.Trace.Printf("Watch event %s for %s in TX %s", event.Kind, event.Address, event.TXID)
+
+	if w.Callback == nil {
+		return
+	}
+
+	err := w.Callback(event)
+
+	if err != nil {
+		w.Logger.Error.Printf("Watch event callback error: %s", err.Error())
+	}
+}
+
+// Returns callback that executes a shell command. Event info is passed with environment variables
+func newWatchCommandCallback(command string) WatchCallback {
+	return func(event WatchEvent) error {
+		cmd := exec.Command("sh", "-c", command)
+
+		cmd.Env = append(os.Environ(),
+			"OURSQL_EVENT="+event.Kind,
+			"OURSQL_ADDRESS="+event.Address,
+			"OURSQL_TXID="+event.TXID,
+			fmt.Sprintf("OURSQL_AMOUNT=%.8f", event.Amount),
+			"OURSQL_BLOCK="+event.BlockHash,
+			fmt.Sprintf("OURSQL_BLOCKHEIGHT=%d", event.BlockHeight),
+			"OURSQL_QUERY="+event.Query)
+
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		return cmd.Run()
+	}
+}
+
+// Returns callback that posts event as JSON to given URL
+func newWatchWebhookCallback(url string) WatchCallback {
+	client := http.Client{Timeout: 10 * time.Second}
+
+	return func(event WatchEvent) error {
+		data, err := json.Marshal(event)
+
+		if err != nil {
+			return err
+		}
+
+		response, err := client.Post(url, "application/json", bytes.NewReader(data))
+
+		if err != nil {
+			return err
+		}
+		response.Body.Close()
+
+		if response.StatusCode >= 300 {
+			return errors.New(fmt.Sprintf("Webhook returned status %d", response.StatusCode))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,97 @@
+package signers
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/gelembjuk/oursql/lib/utils"
+)
+
+// Signer that uses AWS KMS asymmetric key. The key spec must be ECC_NIST_P256
+// Credentials are taken from default AWS chain (environment, shared config, instance role)
+type awsKMSSigner struct {
+	config SignerConfig
+	client *kms.KMS
+	pubKey []byte
+}
+
+func newAWSKMSSigner(config SignerConfig) (*awsKMSSigner, error) {
+	awsConfig := aws.NewConfig()
+
+	if config.Region != "" {
+		awsConfig = awsConfig.WithRegion(config.Region)
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *awsConfig,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := &awsKMSSigner{}
+	s.config = config
+	s.client = kms.New(sess)
+
+	err = s.loadPublicKey()
+
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *awsKMSSigner) GetPublicKey() []byte {
+	return s.pubKey
+}
+
+func (s *awsKMSSigner) Sign(dataToSign []byte) ([]byte, error) {
+	result, err := s.client.Sign(&kms.SignInput{
+		KeyId:            aws.String(s.config.KeyID),
+		Message:          utils.MakeSignDigest(dataToSign),
+		MessageType:      aws.String(kms.MessageTypeDigest),
+		SigningAlgorithm: aws.String(kms.SigningAlgorithmSpecEcdsaSha256),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return utils.SignatureFromASN1(result.Signature)
+}
+
+func (s *awsKMSSigner) loadPublicKey() error {
+	result, err := s.client.GetPublicKey(&kms.GetPublicKeyInput{
+		KeyId: aws.String(s.config.KeyID),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if aws.StringValue(result.KeySpec) != kms.KeySpecEccNistP256 {
+		return errors.New("KMS key spec is not supported. Expected ECC_NIST_P256")
+	}
+
+	pubKey, err := x509.ParsePKIXPublicKey(result.PublicKey)
+
+	if err != nil {
+		return err
+	}
+
+	ecdsaKey, ok := pubKey.(*ecdsa.PublicKey)
+
+	if !ok {
+		return errors.New("Public key from KMS is not ECDSA key")
+	}
+
+	s.pubKey, err = utils.PublicKeyToBytes(ecdsaKey)
+
+	return err
+}
@@ -0,0 +1,43 @@
+package signers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gelembjuk/oursql/lib/utils"
+)
+
+const (
+	SignerTypeVault  = "vault"
+	SignerTypeAWSKMS = "awskms"
+)
+
+// Options of external signer. Private key is stored in the service and never leaves it
+type SignerConfig struct {
+	Type string
+	// Name of a key in Vault transit engine or KMS key ID/ARN
+	KeyID string
+	// Vault server address. VAULT_ADDR is used if empty
+	Address string
+	// Vault token. VAULT_TOKEN is used if empty
+	Token string
+	// Mount path of Vault transit engine. Default is transit
+	MountPath string
+	// AWS region. Default credentials chain and region are used if empty
+	Region string
+}
+
+// Creates signer by config options
+func NewSigner(config SignerConfig) (utils.Signer, error) {
+	if config.KeyID == "" {
+		return nil, errors.New("Key ID for external signer is not set")
+	}
+
+	switch config.Type {
+	case SignerTypeVault:
+		return newVaultSigner(config)
+	case SignerTypeAWSKMS:
+		return newAWSKMSSigner(config)
+	}
+	return nil, errors.New(fmt.Sprintf("Unknown signer type %s", config.Type))
+}
@@ -0,0 +1,175 @@
+package signers
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gelembjuk/oursql/lib/utils"
+)
+
+// Signer that uses HashiCorp Vault transit secrets engine
+// The key must be of type ecdsa-p256
+type vaultSigner struct {
+	config SignerConfig
+	client *http.Client
+	pubKey []byte
+}
+
+func newVaultSigner(config SignerConfig) (*vaultSigner, error) {
+	if config.Address == "" {
+		config.Address = os.Getenv("VAULT_ADDR")
+	}
+	if config.Token == "" {
+		config.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if config.MountPath == "" {
+		config.MountPath = "transit"
+	}
+	if config.Address == "" {
+		return nil, errors.New("Vault address is not set")
+	}
+
+	s := &vaultSigner{}
+	s.config = config
+	s.client = &http.Client{Timeout: 10 * time.Second}
+
+	err := s.loadPublicKey()
+
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *vaultSigner) GetPublicKey() []byte {
+	return s.pubKey
+}
+
+func (s *vaultSigner) Sign(dataToSign []byte) ([]byte, error) {
+	request := map[string]interface{}{
+		"input":                base64.StdEncoding.EncodeToString(utils.MakeSignDigest(dataToSign)),
+		"prehashed":            true,
+		"hash_algorithm":       "sha2-256",
+		"marshaling_algorithm": "asn1",
+	}
+
+	response := struct {
+		Data struct {
+			Signature string `json:"signature"`
+		} `json:"data"`
+	}{}
+
+	err := s.call("POST", "sign/"+s.config.KeyID, request, &response)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// signature format is vault:v1:base64
+	parts := strings.Split(response.Data.Signature, ":")
+
+	signature, err := base64.StdEncoding.DecodeString(parts[len(parts)-1])
+
+	if err != nil {
+		return nil, err
+	}
+
+	return utils.SignatureFromASN1(signature)
+}
+
+// Loads public key of latest version of the key
+func (s *vaultSigner) loadPublicKey() error {
+	response := struct {
+		Data struct {
+			Type          string `json:"type"`
+			LatestVersion int    `json:"latest_version"`
+			Keys          map[string]struct {
+				PublicKey string `json:"public_key"`
+			} `json:"keys"`
+		} `json:"data"`
+	}{}
+
+	err := s.call("GET", "keys/"+s.config.KeyID, nil, &response)
+
+	if err != nil {
+		return err
+	}
+
+	if response.Data.Type != "ecdsa-p256" {
+		return errors.New(fmt.Sprintf("Vault key type %s is not supported. Expected ecdsa-p256", response.Data.Type))
+	}
+
+	key, ok := response.Data.Keys[fmt.Sprintf("%d", response.Data.LatestVersion)]
+
+	if !ok {
+		return errors.New("Vault returned no public key")
+	}
+
+	block, _ := pem.Decode([]byte(key.PublicKey))
+
+	if block == nil {
+		return errors.New("Public key from Vault has wrong format")
+	}
+
+	pubKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+
+	if err != nil {
+		return err
+	}
+
+	ecdsaKey, ok := pubKey.(*ecdsa.PublicKey)
+
+	if !ok {
+		return errors.New("Public key from Vault is not ECDSA key")
+	}
+
+	s.pubKey, err = utils.PublicKeyToBytes(ecdsaKey)
+
+	return err
+}
+
+// Executes Vault API call
+func (s *vaultSigner) call(method string, path string, request interface{}, response interface{}) error {
+	var body bytes.Buffer
+
+	if request != nil {
+		err := json.NewEncoder(&body).Encode(request)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	url := strings.TrimRight(s.config.Address, "/") + "/v1/" + s.config.MountPath + "/" + path
+
+	req, err := http.NewRequest(method, url, &body)
+
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", s.config.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(fmt.Sprintf("Vault returned status %d", resp.StatusCode))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(response)
+}
@@ -0,0 +1,270 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gelembjuk/oursql/lib/utils"
+)
+
+const (
+	exportBatchSize = 100
+	exportInterval  = 5 * time.Second
+	exportQueueSize = 2000
+	exportTimeout   = 5 * time.Second
+)
+
+type spanRecord struct {
+	context    SpanContext
+	parentID   [8]byte
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes map[string]string
+	err        string
+}
+
+type exporter struct {
+	url         string
+	serviceName string
+	logger      *utils.LoggerMan
+	queue       chan spanRecord
+	stop        chan bool
+	done        chan bool
+	client      *http.Client
+}
+
+var (
+	exporterObj  *exporter
+	exporterLock sync.Mutex
+)
+
+func Enabled() bool {
+	exporterLock.Lock()
+	defer exporterLock.Unlock()
+
+	return exporterObj != nil
+}
+
+// Starts exporting of spans. It is called once when a process starts
+func Init(config Config, logger *utils.LoggerMan) {
+	exporterLock.Lock()
+	defer exporterLock.Unlock()
+
+	if exporterObj != nil || config.Endpoint == "" {
+		return
+	}
+
+	e := &exporter{}
+	e.url = strings.TrimRight(config.Endpoint, "/")
+
+	if !strings.HasSuffix(e.url, "/v1/traces") {
+		e.url += "/v1/traces"
+	}
+
+	e.serviceName = config.ServiceName
+	e.logger = logger
+	e.queue = make(chan spanRecord, exportQueueSize)
+	e.stop = make(chan bool)
+	e.done = make(chan bool)
+	e.client = &http.Client{Timeout: exportTimeout}
+
+	exporterObj = e
+
+	go e.run()
+}
+
+// Sends spans which are not yet sent and stops the exporter
+func Stop() {
+	exporterLock.Lock()
+	e := exporterObj
+	exporterObj = nil
+	exporterLock.Unlock()
+
+	if e == nil {
+		return
+	}
+	close(e.stop)
+	<-e.done
+}
+
+func export(record spanRecord) {
+	exporterLock.Lock()
+	e := exporterObj
+	exporterLock.Unlock()
+
+	if e == nil {
+		return
+	}
+
+	select {
+	case e.queue <- record:
+	default:
+		// collector is slow or not available. tracing must not slow down a node
+	}
+}
+
+func (e *exporter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	batch := []spanRecord{}
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		err := e.send(batch)
+
+		if err != nil {
+			e.logger.Error.Printf("Can not export %d spans: %s", len(batch), err.Error())
+		}
+		batch = []spanRecord{}
+	}
+
+	for {
+		select {
+		case r := <-e.queue:
+			batch = append(batch, r)
+
+			if len(batch) >= exportBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.stop:
+			for {
+				select {
+				case r := <-e.queue:
+					batch = append(batch, r)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// OTLP JSON structures. IDs are hex strings, times are nanoseconds as strings
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func makeAttributes(attributes map[string]string) []otlpAttribute {
+	keys := []string{}
+
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	list := []otlpAttribute{}
+
+	for _, k := range keys {
+		list = append(list, otlpAttribute{k, otlpValue{attributes[k]}})
+	}
+	return list
+}
+
+func (e *exporter) send(batch []spanRecord) error {
+	scope := otlpScopeSpans{}
+	scope.Scope.Name = "oursql"
+
+	for _, r := range batch {
+		s := otlpSpan{}
+		s.TraceID = hex.EncodeToString(r.context.TraceID[:])
+		s.SpanID = hex.EncodeToString(r.context.SpanID[:])
+
+		if r.parentID != [8]byte{} {
+			s.ParentSpanID = hex.EncodeToString(r.parentID[:])
+		}
+
+		s.Name = r.name
+		s.Kind = r.kind
+		s.StartTimeUnixNano = strconv.FormatInt(r.start.UnixNano(), 10)
+		s.EndTimeUnixNano = strconv.FormatInt(r.end.UnixNano(), 10)
+		s.Attributes = makeAttributes(r.attributes)
+
+		if r.err != "" {
+			// 2 is error status
+			s.Status = otlpStatus{2, r.err}
+		}
+
+		scope.Spans = append(scope.Spans, s)
+	}
+
+	resource := otlpResourceSpans{}
+	resource.Resource.Attributes = makeAttributes(map[string]string{"service.name": e.serviceName})
+	resource.ScopeSpans = []otlpScopeSpans{scope}
+
+	data, err := json.Marshal(otlpRequest{[]otlpResourceSpans{resource}})
+
+	if err != nil {
+		return err
+	}
+
+	response, err := e.client.Post(e.url, "application/json", bytes.NewReader(data))
+
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		return errors.New(fmt.Sprintf("Collector returned status %d", response.StatusCode))
+	}
+	return nil
+}
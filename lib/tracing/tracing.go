@@ -0,0 +1,196 @@
+package tracing
+
+/*
+* Tracing of requests between wallets and nodes. A trace is a tree of spans. Every span has start and end time,
+* a name and attributes. Context of a span (trace ID and span ID) is sent to other node in a command header,
+* so a span of a node handler continues the trace of a client. Spans are exported to an OpenTelemetry
+* collector with OTLP over HTTP.
+*
+* Trace is not safe for goroutines, it is an object of one request. All methods work with nil objects,
+* a nil Trace is returned when tracing is not configured, so a caller doesn't have to check it
+ */
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Kinds of spans, same as in OTLP
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+// Max length of an attribute value. SQL queries can be long
+const maxAttributeLength = 1000
+
+type Config struct {
+	// URL of a collector, like http://localhost:4318. Empty means tracing is off
+	Endpoint    string
+	ServiceName string
+}
+
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+}
+
+// Spans of one request. Current is the span started last and not yet ended, new span is its child
+type Trace struct {
+	current *Span
+}
+
+type Span struct {
+	trace      *Trace
+	parent     *Span
+	context    SpanContext
+	parentID   [8]byte
+	name       string
+	kind       int
+	start      time.Time
+	attributes map[string]string
+}
+
+// Returns new trace or nil if tracing is not configured
+func NewTrace() *Trace {
+	if !Enabled() {
+		return nil
+	}
+	return &Trace{}
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Length of a context in traceparent format, version-traceid-spanid-flags
+const TraceParentLength = 55
+
+// Context in W3C traceparent format
+func (sc SpanContext) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]))
+}
+
+func ParseTraceParent(traceparent string) (SpanContext, error) {
+	sc := SpanContext{}
+
+	parts := strings.Split(traceparent, "-")
+
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return sc, errors.New(fmt.Sprintf("Wrong trace context %s", traceparent))
+	}
+
+	traceID, err := hex.DecodeString(parts[1])
+
+	if err != nil {
+		return sc, err
+	}
+
+	spanID, err := hex.DecodeString(parts[2])
+
+	if err != nil {
+		return sc, err
+	}
+
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+
+	if !sc.IsValid() {
+		return sc, errors.New("Empty trace context")
+	}
+	return sc, nil
+}
+
+// Starts a span as a child of current span. If there is no current span, new trace ID is made
+func (t *Trace) Start(name string, kind int) *Span {
+	if t == nil {
+		return nil
+	}
+	if t.current != nil {
+		return t.start(name, kind, t.current.context.TraceID, t.current.context.SpanID)
+	}
+	return t.StartRemote(name, kind, SpanContext{})
+}
+
+// Starts a span with a parent from other process. If the parent is not valid, it is a root span of new trace
+func (t *Trace) StartRemote(name string, kind int, parent SpanContext) *Span {
+	if t == nil {
+		return nil
+	}
+	if !parent.IsValid() {
+		rand.Read(parent.TraceID[:])
+		parent.SpanID = [8]byte{}
+	}
+	return t.start(name, kind, parent.TraceID, parent.SpanID)
+}
+
+func (t *Trace) start(name string, kind int, traceID [16]byte, parentID [8]byte) *Span {
+	s := &Span{trace: t, parent: t.current, name: name, kind: kind, start: time.Now()}
+
+	s.context.TraceID = traceID
+	rand.Read(s.context.SpanID[:])
+	s.parentID = parentID
+	s.attributes = map[string]string{}
+
+	t.current = s
+
+	return s
+}
+
+// Context of current span. Empty if there is no current span
+func (t *Trace) Current() SpanContext {
+	if t == nil || t.current == nil {
+		return SpanContext{}
+	}
+	return t.current.context
+}
+
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	v := fmt.Sprintf("%v", value)
+
+	if len(v) > maxAttributeLength {
+		v = v[:maxAttributeLength] + "..."
+	}
+	s.attributes[key] = v
+}
+
+// Ends a span and sends it to the exporter. The span has error status if err is not nil.
+// Parent of the span becomes current span of the trace
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	if s.trace.current == s {
+		s.trace.current = s.parent
+	}
+
+	record := spanRecord{
+		context:    s.context,
+		parentID:   s.parentID,
+		name:       s.name,
+		kind:       s.kind,
+		start:      s.start,
+		end:        time.Now(),
+		attributes: s.attributes,
+	}
+
+	if err != nil {
+		record.err = err.Error()
+	}
+	export(record)
+}
@@ -0,0 +1,78 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gelembjuk/oursql/lib/utils"
+)
+
+func TestTraceParent(t *testing.T) {
+	sc := SpanContext{}
+	sc.TraceID[0] = 1
+	sc.SpanID[7] = 2
+
+	parsed, err := ParseTraceParent(sc.TraceParent())
+
+	if err != nil {
+		t.Fatalf("Error parsing %s: %s", sc.TraceParent(), err.Error())
+	}
+
+	if parsed != sc {
+		t.Fatalf("Got %s, expected %s", parsed.TraceParent(), sc.TraceParent())
+	}
+
+	if _, err := ParseTraceParent(""); err == nil {
+		t.Fatalf("Empty context is accepted")
+	}
+}
+
+func TestExportSpans(t *testing.T) {
+	requests := []otlpRequest{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		req := otlpRequest{}
+		json.Unmarshal(body, &req)
+
+		requests = append(requests, req)
+	}))
+	defer server.Close()
+
+	// nil trace must work when tracing is off
+	NewTrace().Start("nothing", KindInternal).End(nil)
+
+	Init(Config{Endpoint: server.URL, ServiceName: "test"}, utils.CreateLogger())
+
+	trace := NewTrace()
+
+	root := trace.StartRemote("handle", KindServer, SpanContext{})
+	child := trace.Start("db exec", KindClient)
+	child.SetAttribute("db.statement", "SELECT 1")
+
+	if trace.Current() != child.Context() {
+		t.Fatalf("Child span is not current")
+	}
+	child.End(nil)
+
+	if trace.Current() != root.Context() {
+		t.Fatalf("Root span is not current after child end")
+	}
+	root.End(nil)
+
+	Stop()
+
+	if len(requests) != 1 || len(requests[0].ResourceSpans[0].ScopeSpans[0].Spans) != 2 {
+		t.Fatalf("Expected one request with 2 spans, got %v", requests)
+	}
+
+	spans := requests[0].ResourceSpans[0].ScopeSpans[0].Spans
+
+	if spans[0].ParentSpanID != spans[1].SpanID || spans[0].TraceID != spans[1].TraceID {
+		t.Fatalf("Child span is not linked to the root span")
+	}
+}
@@ -0,0 +1,88 @@
+package txvalidation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const defaultHTTPTimeout = 5
+
+// External validator. A request is POSTed as JSON, the service responds {"allow":true} or {"allow":false,"reason":"..."}
+type httpValidator struct {
+	url          string
+	client       *http.Client
+	allowOnError bool
+}
+
+type httpResponse struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason"`
+}
+
+func newHTTPValidator(config Config) (*httpValidator, error) {
+	if config.URL == "" {
+		return nil, errors.New("URL of HTTP validator is not set")
+	}
+
+	if config.Timeout < 1 {
+		config.Timeout = defaultHTTPTimeout
+	}
+
+	v := &httpValidator{}
+	v.url = config.URL
+	v.client = &http.Client{Timeout: time.Duration(config.Timeout) * time.Second}
+	v.allowOnError = config.AllowOnError
+
+	return v, nil
+}
+
+func (v *httpValidator) Validate(request Request) error {
+	response, err := v.call(request)
+
+	if err != nil {
+		if v.allowOnError {
+			return nil
+		}
+		return err
+	}
+
+	if !response.Allow {
+		if response.Reason == "" {
+			response.Reason = "not allowed"
+		}
+		return errors.New(response.Reason)
+	}
+	return nil
+}
+
+func (v *httpValidator) call(request Request) (*httpResponse, error) {
+	body, err := json.Marshal(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := v.client.Post(v.url, "application/json", bytes.NewReader(body))
+
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("Validator returned status %d", resp.StatusCode))
+	}
+
+	response := &httpResponse{}
+
+	err = json.NewDecoder(resp.Body).Decode(response)
+
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
@@ -0,0 +1,35 @@
+package txvalidation
+
+import (
+	"errors"
+	"fmt"
+	"plugin"
+)
+
+// Loads a Go plugin built with go build -buildmode=plugin. It must be built with same Go version
+// and same version of this package as the node
+func loadPlugin(path string) (Validator, error) {
+	if path == "" {
+		return nil, errors.New("Path of validator plugin is not set")
+	}
+
+	p, err := plugin.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	symbol, err := p.Lookup("Validate")
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch f := symbol.(type) {
+	case func(Request) error:
+		return ValidatorFunc(f), nil
+	case *func(Request) error:
+		return ValidatorFunc(*f), nil
+	}
+	return nil, errors.New(fmt.Sprintf("Validate in plugin %s must be func(txvalidation.Request) error", path))
+}
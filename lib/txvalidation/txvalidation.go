@@ -0,0 +1,182 @@
+package txvalidation
+
+/*
+* Extension point for deployment specific rules of transactions. Validators are called for every transaction
+* before it is added to the pool and when a block is verified, after all rules of the consensus passed.
+* An error of a validator rejects the transaction. Nodes of one network must have same validators for blocks,
+* otherwise they will not accept blocks of each other
+ */
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const (
+	StagePool  = "pool"
+	StageBlock = "block"
+)
+
+const (
+	TypeCurrency = "currency"
+	TypeSQL      = "sql"
+	TypeCoinbase = "coinbase"
+)
+
+const (
+	ValidatorPlugin = "plugin"
+	ValidatorHTTP   = "http"
+)
+
+// Transaction data given to a validator
+type Request struct {
+	Stage       string // pool or block
+	ID          string // hex
+	Type        string // currency, sql or coinbase
+	Time        int64
+	Signer      string // wallet address
+	PubKey      string // hex
+	Outputs     []Output
+	Query       string
+	QueryKind   string // insert, update, delete, create etc
+	Table       string
+	ReferenceID string
+	// height of a block where the transaction is. Height of the next block for the pool
+	BlockHeight int
+}
+
+type Output struct {
+	Address string
+	Value   float64
+}
+
+type Validator interface {
+	Validate(request Request) error
+}
+
+// Validator made from a function
+type ValidatorFunc func(request Request) error
+
+func (f ValidatorFunc) Validate(request Request) error {
+	return f(request)
+}
+
+// Options of a validator from config
+type Config struct {
+	Type string // plugin or http
+	Name string
+	// file of a Go plugin. It must export "Validate func(txvalidation.Request) error"
+	Path string
+	// URL of HTTP validator and timeout of a request in seconds
+	URL     string
+	Timeout int
+	// stages to call the validator. Empty means all
+	Stages []string
+	// accept transactions if HTTP validator is not available. By default they are rejected
+	AllowOnError bool
+}
+
+type registered struct {
+	name      string
+	validator Validator
+	stages    []string
+}
+
+var (
+	validators     = []registered{}
+	validatorsLock sync.RWMutex
+)
+
+// Adds a validator. It can be called from Go code compiled with the node
+func Register(name string, validator Validator, stages ...string) {
+	validatorsLock.Lock()
+	defer validatorsLock.Unlock()
+
+	validators = append(validators, registered{name, validator, stages})
+}
+
+// Removes all validators
+func Reset() {
+	validatorsLock.Lock()
+	defer validatorsLock.Unlock()
+
+	validators = []registered{}
+}
+
+// Creates validators from config and registers them
+func Load(configs []Config) error {
+	for i, config := range configs {
+		var validator Validator
+		var err error
+
+		switch config.Type {
+		case ValidatorPlugin:
+			validator, err = loadPlugin(config.Path)
+		case ValidatorHTTP:
+			validator, err = newHTTPValidator(config)
+		default:
+			err = errors.New(fmt.Sprintf("Unknown transaction validator type %s", config.Type))
+		}
+
+		if err != nil {
+			return err
+		}
+
+		name := config.Name
+
+		if name == "" {
+			name = fmt.Sprintf("%s%d", config.Type, i+1)
+		}
+
+		for _, stage := range config.Stages {
+			if stage != StagePool && stage != StageBlock {
+				return errors.New(fmt.Sprintf("Unknown stage %s of transaction validator %s", stage, name))
+			}
+		}
+
+		Register(name, validator, config.Stages...)
+	}
+	return nil
+}
+
+// Checks if there are validators. Requests are not prepared if there are no
+func HasValidators() bool {
+	validatorsLock.RLock()
+	defer validatorsLock.RUnlock()
+
+	return len(validators) > 0
+}
+
+// Calls validators in order of registration. Returns error of first validator which rejected the transaction
+func Validate(request Request) error {
+	validatorsLock.RLock()
+	list := validators
+	validatorsLock.RUnlock()
+
+	for _, v := range list {
+		if !v.hasStage(request.Stage) {
+			continue
+		}
+
+		err := v.validator.Validate(request)
+
+		if err != nil {
+			return errors.New(fmt.Sprintf("Transaction is rejected by validator %s: %s", v.name, err.Error()))
+		}
+	}
+	return nil
+}
+
+func (v registered) hasStage(stage string) bool {
+	if len(v.stages) == 0 {
+		return true
+	}
+
+	for _, s := range v.stages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package txvalidation
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	defer Reset()
+
+	Register("limit", ValidatorFunc(func(r Request) error {
+		for _, out := range r.Outputs {
+			if out.Value > 100 {
+				return errors.New("amount is over limit")
+			}
+		}
+		return nil
+	}))
+	Register("blockonly", ValidatorFunc(func(r Request) error {
+		return errors.New("always")
+	}), StageBlock)
+
+	err := Validate(Request{Stage: StagePool, Outputs: []Output{{"a", 50}}})
+
+	if err != nil {
+		t.Fatalf("Pool transaction is rejected: %s", err.Error())
+	}
+
+	err = Validate(Request{Stage: StagePool, Outputs: []Output{{"a", 150}}})
+
+	if err == nil || err.Error() != "Transaction is rejected by validator limit: amount is over limit" {
+		t.Fatalf("Expected limit error, got %v", err)
+	}
+
+	err = Validate(Request{Stage: StageBlock})
+
+	if err == nil {
+		t.Fatalf("Expected error of block validator")
+	}
+}
+
+func TestHTTPValidator(t *testing.T) {
+	defer Reset()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := Request{}
+		json.NewDecoder(r.Body).Decode(&request)
+
+		if request.Table == "audit" && request.QueryKind != "insert" {
+			json.NewEncoder(w).Encode(httpResponse{false, "audit is append only"})
+			return
+		}
+		json.NewEncoder(w).Encode(httpResponse{true, ""})
+	}))
+
+	err := Load([]Config{{Type: ValidatorHTTP, URL: server.URL}})
+
+	if err != nil {
+		t.Fatalf("Load error %s", err.Error())
+	}
+
+	if err = Validate(Request{Table: "audit", QueryKind: "insert"}); err != nil {
+		t.Fatalf("Insert is rejected: %s", err.Error())
+	}
+
+	if err = Validate(Request{Table: "audit", QueryKind: "delete"}); err == nil {
+		t.Fatalf("Delete is not rejected")
+	}
+
+	server.Close()
+
+	if err = Validate(Request{}); err == nil {
+		t.Fatalf("Transaction is accepted when validator is not available")
+	}
+
+	Reset()
+	Load([]Config{{Type: ValidatorHTTP, URL: server.URL, AllowOnError: true}})
+
+	if err = Validate(Request{}); err != nil {
+		t.Fatalf("Transaction is rejected with AllowOnError: %s", err.Error())
+	}
+}
@@ -2,12 +2,15 @@ package utils
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha1"
 	"errors"
 	"io"
 	"math/big"
+
+	"github.com/gelembjuk/oursql/lib"
 )
 
 func SignData(privKey ecdsa.PrivateKey, dataToSign []byte) ([]byte, error) {
@@ -71,7 +74,38 @@ func signatureFromDER(dersig []byte) (r, s []byte, err error) {
 
 	return
 }
+
+// Returns signature scheme of a public key
+func GetPubKeyScheme(PubKey []byte) byte {
+	if len(PubKey) == ed25519.PublicKeySize+1 && PubKey[0] == lib.SignatureSchemeEd25519 {
+		return lib.SignatureSchemeEd25519
+	}
+	return lib.SignatureSchemeECDSA
+}
+
+// Makes public key in transactions format from Ed25519 key
+func MakeEd25519PubKey(pubKey ed25519.PublicKey) []byte {
+	return append([]byte{lib.SignatureSchemeEd25519}, pubKey...)
+}
+
+// Signs data with Ed25519 key. Signature has the scheme byte in front
+func SignDataEd25519(privKey ed25519.PrivateKey, dataToSign []byte) []byte {
+	return append([]byte{lib.SignatureSchemeEd25519}, ed25519.Sign(privKey, dataToSign)...)
+}
+
+func verifySignatureEd25519(signature []byte, message []byte, PubKey []byte) (bool, error) {
+	if len(signature) != ed25519.SignatureSize+1 || signature[0] != lib.SignatureSchemeEd25519 {
+		return false, errors.New("Wrong Ed25519 signature format")
+	}
+
+	return ed25519.Verify(ed25519.PublicKey(PubKey[1:]), message, signature[1:]), nil
+}
+
 func VerifySignature(signature []byte, message []byte, PubKey []byte) (bool, error) {
+	if GetPubKeyScheme(PubKey) == lib.SignatureSchemeEd25519 {
+		return verifySignatureEd25519(signature, message, PubKey)
+	}
+
 	h := sha1.New()
 	str := string(message)
 	io.WriteString(h, str)
@@ -106,6 +140,10 @@ func SignDataByPubKey(PubKey []byte, privKey ecdsa.PrivateKey, dataToSign []byte
 	var signature []byte
 	var err error
 
+	if GetPubKeyScheme(PubKey) != lib.SignatureSchemeECDSA {
+		return nil, errors.New("Only ECDSA keys can sign this way. Use a signer")
+	}
+
 	signature, err = SignData(privKey, dataToSign)
 
 	if err != nil {
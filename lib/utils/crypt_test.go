@@ -89,3 +89,43 @@ func TestVerify(t *testing.T) {
 		}
 	}
 }
+
+func TestSignatureFromASN1(t *testing.T) {
+	curve := elliptic.P256()
+	private, err := ecdsa.GenerateKey(curve, rand.Reader)
+
+	if err != nil {
+		t.Fatalf("Can not make private key %s", err.Error())
+	}
+
+	pubKey, err := PublicKeyToBytes(&private.PublicKey)
+
+	if err != nil {
+		t.Fatalf("Can not encode public key %s", err.Error())
+	}
+
+	dataToSign := []byte("test data to sign")
+
+	// this is what external signer does with the digest
+	asn1sig, err := ecdsa.SignASN1(rand.Reader, private, MakeSignDigest(dataToSign))
+
+	if err != nil {
+		t.Fatalf("Can not make signature %s", err.Error())
+	}
+
+	signature, err := SignatureFromASN1(asn1sig)
+
+	if err != nil {
+		t.Fatalf("Can not convert signature %s", err.Error())
+	}
+
+	v, err := VerifySignature(signature, dataToSign, pubKey)
+
+	if err != nil {
+		t.Fatalf("Verify failed %s", err.Error())
+	}
+
+	if !v {
+		t.Fatalf("Signature is not valid")
+	}
+}
@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"errors"
 )
 
 // MerkleTree represent a Merkle tree
@@ -68,3 +70,84 @@ func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
 
 	return &mNode
 }
+
+// MerkleProof is a path from a leaf to the root of a Merkle tree
+// Hashes are siblings from bottom level to the top. Left[i] is true if
+// the sibling must be put on the left side when hashing a pair
+type MerkleProof struct {
+	Hashes [][]byte
+	Left   []bool
+}
+
+// NewMerkleProof builds a proof for data element with given index
+// The tree is built exactly same way as in NewMerkleTree. So, the proof
+// is valid for a root returned by NewMerkleTree for same data
+func NewMerkleProof(data [][]byte, index int) (*MerkleProof, error) {
+	if index < 0 || index >= len(data) {
+		return nil, errors.New("Data index is out of range")
+	}
+
+	// don't modify the slice of a caller
+	data = append([][]byte{}, data...)
+
+	if len(data)%2 != 0 {
+		data = append(data, data[len(data)-1])
+	}
+
+	level := [][]byte{}
+
+	for _, datum := range data {
+		hash := sha256.Sum256(datum)
+		level = append(level, hash[:])
+	}
+
+	proof := MerkleProof{}
+
+	for i := 0; i < len(data)/2; i++ {
+		sibling := index ^ 1
+
+		proof.Hashes = append(proof.Hashes, level[sibling])
+		proof.Left = append(proof.Left, sibling < index)
+
+		var newLevel [][]byte
+
+		for j := 0; j < len(level); j += 2 {
+			newLevel = append(newLevel, hashMerklePair(level[j], level[j+1]))
+		}
+		if len(newLevel)%2 != 0 {
+			newLevel = append(newLevel, newLevel[len(newLevel)-1])
+		}
+
+		level = newLevel
+		index = index / 2
+	}
+
+	return &proof, nil
+}
+
+// VerifyMerkleProof checks if data is included in a tree with given root
+func VerifyMerkleProof(data []byte, root []byte, proof *MerkleProof) bool {
+	if proof == nil || len(proof.Hashes) != len(proof.Left) {
+		return false
+	}
+
+	hash := sha256.Sum256(data)
+	current := hash[:]
+
+	for i, sibling := range proof.Hashes {
+		if proof.Left[i] {
+			current = hashMerklePair(sibling, current)
+		} else {
+			current = hashMerklePair(current, sibling)
+		}
+	}
+
+	return bytes.Compare(current, root) == 0
+}
+
+// hash of 2 nodes. same as it is done in NewMerkleNode
+func hashMerklePair(left, right []byte) []byte {
+	pair := append(CopyBytes(left), right...)
+	hash := sha256.Sum256(pair)
+	return hash[:]
+}
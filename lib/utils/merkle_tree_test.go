@@ -98,3 +98,27 @@ func TestCases(t *testing.T) {
 	}
 
 }
+
+func TestMerkleProof(t *testing.T) {
+	for count := 1; count <= 9; count++ {
+		data := [][]byte{}
+
+		for i := 0; i < count; i++ {
+			data = append(data, []byte(fmt.Sprintf("node%d", i)))
+		}
+
+		root := NewMerkleTree(data).RootNode.Data
+
+		for i := 0; i < count; i++ {
+			proof, err := NewMerkleProof(data, i)
+
+			assert.NoError(t, err, "Proof is built")
+			assert.True(t, VerifyMerkleProof(data[i], root, proof), fmt.Sprintf("Proof for %d of %d is valid", i, count))
+			assert.False(t, VerifyMerkleProof([]byte("other"), root, proof), "Proof is not valid for other data")
+		}
+	}
+
+	_, err := NewMerkleProof([][]byte{[]byte("node1")}, 1)
+
+	assert.Error(t, err, "Index out of range")
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha1"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"math/big"
+)
+
+// Signer makes signatures of data with a key. The key can be stored locally
+// or in external service (KMS, Vault) and never leave it
+type Signer interface {
+	// Public key in the format used by transactions
+	GetPublicKey() []byte
+	// Returns signature in the format returned by SignData
+	Sign(dataToSign []byte) ([]byte, error)
+}
+
+// Signer that uses private key in memory
+type localSigner struct {
+	pubKey  []byte
+	privKey ecdsa.PrivateKey
+}
+
+func NewLocalSigner(pubKey []byte, privKey ecdsa.PrivateKey) Signer {
+	return &localSigner{pubKey, privKey}
+}
+
+func (s *localSigner) GetPublicKey() []byte {
+	return s.pubKey
+}
+
+func (s *localSigner) Sign(dataToSign []byte) ([]byte, error) {
+	return SignData(s.privKey, dataToSign)
+}
+
+// Signer that uses Ed25519 private key in memory
+type ed25519Signer struct {
+	privKey ed25519.PrivateKey
+}
+
+func NewEd25519Signer(privKey ed25519.PrivateKey) Signer {
+	return &ed25519Signer{privKey}
+}
+
+func (s *ed25519Signer) GetPublicKey() []byte {
+	return MakeEd25519PubKey(s.privKey.Public().(ed25519.PublicKey))
+}
+
+func (s *ed25519Signer) Sign(dataToSign []byte) ([]byte, error) {
+	return SignDataEd25519(s.privKey, dataToSign), nil
+}
+
+// Makes signature with a signer and checks it is correct
+func SignDataBySigner(signer Signer, dataToSign []byte) ([]byte, error) {
+	signature, err := signer.Sign(dataToSign)
+
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := VerifySignature(signature, dataToSign, signer.GetPublicKey())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !v {
+		return nil, errors.New("Just created signature looks wrong!")
+	}
+
+	return signature, nil
+}
+
+// Returns hash of data to sign as 32 bytes. External signers expect SHA256 size digest.
+// sha1 hash is padded with zeros on the left, it is same number for ECDSA
+func MakeSignDigest(dataToSign []byte) []byte {
+	h := sha1.New()
+	io.WriteString(h, string(dataToSign))
+
+	digest := make([]byte, 32)
+	copy(digest[32-sha1.Size:], h.Sum(nil))
+
+	return digest
+}
+
+// Converts standard ASN.1 ECDSA signature to the format used in transactions
+func SignatureFromASN1(signature []byte) ([]byte, error) {
+	var sig struct {
+		R, S *big.Int
+	}
+
+	rest, err := asn1.Unmarshal(signature, &sig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rest) > 0 {
+		return nil, errors.New("Extra data after signature")
+	}
+
+	return signatureToDER(sig.R.Bytes(), sig.S.Bytes()), nil
+}
+
+// Converts ECDSA public key to the format used in transactions
+func PublicKeyToBytes(pubKey *ecdsa.PublicKey) ([]byte, error) {
+	if pubKey.Curve != elliptic.P256() {
+		return nil, errors.New("Only P256 curve keys are supported")
+	}
+
+	key := make([]byte, 64)
+	pubKey.X.FillBytes(key[:32])
+	pubKey.Y.FillBytes(key[32:])
+
+	return key, nil
+}
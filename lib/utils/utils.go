@@ -4,12 +4,14 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"math/rand"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 
@@ -20,6 +22,8 @@ import (
 
 const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 
+var nameRegexp = regexp.MustCompile("^[a-z][a-z0-9_]{2,31}$")
+
 // Structure to manage logs
 type LoggerMan struct {
 	State    map[string]bool
@@ -29,6 +33,10 @@ type LoggerMan struct {
 	Info     *log.Logger
 	Warning  *log.Logger
 	Error    *log.Logger
+	// destination of logs, to change enabled logs later
+	toStdout bool
+	datadir  string
+	files    []string
 }
 
 // Creates logger object. sets all logging to STDOUT
@@ -106,6 +114,10 @@ func (logger *LoggerMan) DisableLogging() {
 
 // Changes logging to files
 func (logger *LoggerMan) LogToFiles(datadir, trace, traceext, info, warning, errorname string) error {
+	logger.toStdout = false
+	logger.datadir = datadir
+	logger.files = []string{trace, traceext, info, warning, errorname}
+
 	if logger.State["trace"] {
 		f1, err1 := os.OpenFile(datadir+trace, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 
@@ -151,6 +163,8 @@ func (logger *LoggerMan) LogToFiles(datadir, trace, traceext, info, warning, err
 
 // Sets ogging to STDOUT
 func (logger *LoggerMan) LogToStdout() error {
+	logger.toStdout = true
+
 	if logger.State["trace"] {
 		logger.Trace.SetOutput(os.Stdout)
 	}
@@ -169,6 +183,31 @@ func (logger *LoggerMan) LogToStdout() error {
 	return nil
 }
 
+// Changes enabled logs of a running process. Logs go to same destination as before. "none" disables all logs
+func (logger *LoggerMan) SetLogs(logs string) error {
+	if logs == "none" {
+		logs = ""
+	}
+	for _, l := range strings.Split(logs, ",") {
+		if _, ok := logger.State[l]; !ok && l != "" {
+			return errors.New(fmt.Sprintf("Unknown log %s", l))
+		}
+	}
+	logger.DisableLogging()
+
+	for l := range logger.State {
+		logger.State[l] = false
+	}
+	if logs != "" {
+		logger.EnableLogs(logs)
+	}
+
+	if logger.toStdout || len(logger.files) < 5 {
+		return logger.LogToStdout()
+	}
+	return logger.LogToFiles(logger.datadir, logger.files[0], logger.files[1], logger.files[2], logger.files[3], logger.files[4])
+}
+
 // IntToHex converts an int64 to a byte array
 func IntToHex(num int64) []byte {
 	buff := new(bytes.Buffer)
@@ -198,17 +237,30 @@ func AddresBToPubKeyHash(address []byte) ([]byte, error) {
 		return nil, errors.New("Wrong address")
 	}
 
+	version := pubKeyHash[0]
 	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
 
+	if version == lib.SignatureSchemeEd25519 {
+		// hash of Ed25519 key has the scheme byte
+		pubKeyHash = append([]byte{version}, pubKeyHash...)
+	}
+
 	return pubKeyHash, nil
 }
 
 // Converts hash of pubkey to address as a string
+// Version is the scheme of a key, it is in a hash of Ed25519 key
 func PubKeyHashToAddres(pubKeyHash []byte) (string, error) {
 	if len(pubKeyHash) == 0 {
 		return lib.NullAddressString, nil
 	}
-	versionedPayload := append([]byte{lib.Version}, pubKeyHash...)
+	version := lib.Version
+
+	if len(pubKeyHash) == ripemd160.Size+1 && pubKeyHash[0] == lib.SignatureSchemeEd25519 {
+		version = pubKeyHash[0]
+		pubKeyHash = pubKeyHash[1:]
+	}
+	versionedPayload := append([]byte{version}, pubKeyHash...)
 
 	checksum := Checksum(versionedPayload)
 
@@ -225,14 +277,29 @@ func PubKeyToAddres(pubKey []byte) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	versionedPayload := append([]byte{lib.Version}, pubKeyHash...)
+	return PubKeyHashToAddres(pubKeyHash)
+}
 
-	checksum := Checksum(versionedPayload)
+// Checks if a string can be registered as a name. Names are lowercase latin letters, digits and _
+// Name must start with a letter and be from 3 to 32 chars long. So it never looks like an address
+func IsValidName(name string) bool {
+	return nameRegexp.MatchString(name)
+}
 
-	fullPayload := append(versionedPayload, checksum...)
-	address := Base58Encode(fullPayload)
+// SQL query to register a name for a public key. Consensus accepts only a query in exactly this form
+func MakeRegisterNameSQL(name string, pubKey []byte) (string, error) {
+	if !IsValidName(name) {
+		return "", errors.New("Name is not valid. Use 3-32 lowercase letters, digits or _ starting with a letter")
+	}
 
-	return fmt.Sprintf("%s", address), nil
+	address, err := PubKeyToAddres(pubKey)
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("INSERT INTO %s (name, pubkey, address) VALUES ('%s', '%s', '%s')",
+		lib.NamesTable, name, hex.EncodeToString(pubKey), address), nil
 }
 
 // Checksum generates a checksum for a public key
@@ -254,6 +321,11 @@ func HashPubKey(pubKey []byte) ([]byte, error) {
 	}
 	publicRIPEMD160 := RIPEMD160Hasher.Sum(nil)
 
+	if GetPubKeyScheme(pubKey) == lib.SignatureSchemeEd25519 {
+		// an address made from the hash has the scheme of the key
+		return append([]byte{lib.SignatureSchemeEd25519}, publicRIPEMD160...), nil
+	}
+
 	return publicRIPEMD160, nil
 }
 
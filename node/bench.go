@@ -0,0 +1,235 @@
+package main
+
+/*
+* Benchmark of main operations of a node. Every test runs for same time on same synthetic data,
+* so results can be compared between hosts and versions of the node
+ */
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/dbquery/sqlparser"
+	"github.com/gelembjuk/oursql/node/structures"
+)
+
+const (
+	benchDuration   = 2 * time.Second
+	benchBlockSize  = 100 // queries in a synthetic block
+	benchSyncBlocks = 100 // blocks loaded from other node
+	benchTable      = "oursql_bench"
+)
+
+var benchQueries = []string{
+	"INSERT INTO members (id, name, email, created) VALUES (1001, 'John Smith', 'john@example.com', '2020-01-01 10:00:00')",
+	"UPDATE members SET name = 'John Doe', email = 'doe@example.com' WHERE id = 1001",
+	"DELETE FROM members WHERE id = 1001",
+	"SELECT id, name FROM members WHERE email = 'john@example.com' ORDER BY id LIMIT 10",
+}
+
+type benchResult struct {
+	name  string
+	value float64
+	unit  string
+}
+
+func (c *NodeCLI) commandBench() error {
+	results := []benchResult{}
+
+	for _, scheme := range []string{"ecdsa", "ed25519"} {
+		rate, err := benchSignatures(scheme)
+
+		if err != nil {
+			return err
+		}
+		results = append(results, benchResult{"TX signature verify, " + scheme, rate, "tx/sec"})
+	}
+
+	rate, err := benchSQLParse()
+
+	if err != nil {
+		return err
+	}
+	results = append(results, benchResult{"SQL parse", rate, "queries/sec"})
+
+	ms, err := c.benchBlockApply()
+
+	if err != nil {
+		return err
+	}
+	results = append(results, benchResult{fmt.Sprintf("Block apply, %d queries", benchBlockSize), ms, "ms/block"})
+
+	if c.Input.Args.NodeHost != "" && c.Input.Args.NodePort > 0 {
+		blocks, mb, err := c.benchSync(net.NewNodeAddr(c.Input.Args.NodeHost, c.Input.Args.NodePort))
+
+		if err != nil {
+			return err
+		}
+		results = append(results, benchResult{"Sync blocks", blocks, "blocks/sec"}, benchResult{"Sync data", mb, "MB/sec"})
+	}
+
+	db := "mysql"
+
+	if c.Input.Database.IsSQLite() {
+		db = "sqlite"
+	}
+	fmt.Printf("CPUs: %d, %s/%s, %s, DB %s\n", runtime.NumCPU(), runtime.GOOS, runtime.GOARCH, runtime.Version(), db)
+
+	for _, r := range results {
+		fmt.Printf("  %-32s %12.1f %s\n", r.name, r.value, r.unit)
+	}
+
+	if c.Input.Args.NodeHost == "" {
+		fmt.Println("  Sync is not tested, set -nodehost and -nodeport of other node")
+	}
+	return nil
+}
+
+// Calls a function during benchmark time. Returns calls per second
+func benchRate(f func() error) (float64, error) {
+	count := 0
+	started := time.Now()
+
+	for time.Since(started) < benchDuration {
+		err := f()
+
+		if err != nil {
+			return 0, err
+		}
+		count++
+	}
+	return float64(count) / time.Since(started).Seconds(), nil
+}
+
+func benchSignatures(scheme string) (float64, error) {
+	var pubKey []byte
+	var sign func(data []byte) ([]byte, error)
+
+	if scheme == "ed25519" {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+
+		if err != nil {
+			return 0, err
+		}
+		pubKey = utils.MakeEd25519PubKey(pub)
+		sign = func(data []byte) ([]byte, error) {
+			return utils.SignDataEd25519(priv, data), nil
+		}
+	} else {
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+		if err != nil {
+			return 0, err
+		}
+		pubKey = append(priv.PublicKey.X.Bytes(), priv.PublicKey.Y.Bytes()...)
+		sign = func(data []byte) ([]byte, error) {
+			return utils.SignData(*priv, data)
+		}
+	}
+
+	tx, err := structures.NewSQLTransaction(structures.NewSQLUpdate(benchQueries[0], "members:1001", benchQueries[2]), nil, nil)
+
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := tx.PrepareSignData(pubKey, map[int]*structures.Transaction{})
+
+	if err != nil {
+		return 0, err
+	}
+
+	signature, err := sign(data)
+
+	if err != nil {
+		return 0, err
+	}
+
+	tx.CompleteTransaction(signature)
+
+	return benchRate(tx.VerifySignature)
+}
+
+func benchSQLParse() (float64, error) {
+	i := 0
+
+	return benchRate(func() error {
+		i++
+		return sqlparser.NewSqlParser().Parse(benchQueries[i%len(benchQueries)])
+	})
+}
+
+// Executes blocks of INSERT and UPDATE queries in a temporary table, same way as queries of a block are applied
+func (c *NodeCLI) benchBlockApply() (float64, error) {
+	qm := c.Node.DBConn.DB().QM()
+
+	qm.ExecuteSQL("DROP TABLE IF EXISTS " + benchTable)
+
+	err := qm.ExecuteSQL("CREATE TABLE " + benchTable + " (id INT NOT NULL PRIMARY KEY, name VARCHAR(100) NOT NULL, amount INT NOT NULL)")
+
+	if err != nil {
+		return 0, err
+	}
+	defer qm.ExecuteSQL("DROP TABLE " + benchTable)
+
+	id := 0
+	blocks := 0
+	started := time.Now()
+
+	for time.Since(started) < benchDuration {
+		for i := 0; i < benchBlockSize/2; i++ {
+			id++
+
+			err = qm.ExecuteSQLApply(fmt.Sprintf("INSERT INTO %s (id, name, amount) VALUES (%d, 'row %d', %d)", benchTable, id, id, id))
+
+			if err != nil {
+				return 0, err
+			}
+
+			err = qm.ExecuteSQLApply(fmt.Sprintf("UPDATE %s SET amount = amount + 1 WHERE id = %d", benchTable, id))
+
+			if err != nil {
+				return 0, err
+			}
+		}
+		blocks++
+	}
+	return float64(time.Since(started).Nanoseconds()) / float64(blocks) / float64(time.Millisecond), nil
+}
+
+// Loads top blocks of other node, as it is done on sync
+func (c *NodeCLI) benchSync(addr net.NodeAddr) (float64, float64, error) {
+	headers, err := c.Node.NodeClient.SendGetBlockHeaders(addr, []byte{}, benchSyncBlocks)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(headers) == 0 {
+		return 0, 0, errors.New("Other node has no blocks")
+	}
+
+	size := 0
+	started := time.Now()
+
+	for _, h := range headers {
+		result, err := c.Node.NodeClient.SendGetBlock(addr, h.Hash)
+
+		if err != nil {
+			return 0, 0, err
+		}
+		size += len(result.Block)
+	}
+
+	seconds := time.Since(started).Seconds()
+
+	return float64(len(headers)) / seconds, float64(size) / 1024 / 1024 / seconds, nil
+}
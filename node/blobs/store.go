@@ -0,0 +1,102 @@
+package blobs
+
+/*
+* Storage of large values of columns out of the blockchain. A transaction has only SHA256 hash and size of a value,
+* bytes are in files of the node config directory. A node gets missed values from other nodes, a value is accepted
+* only if its hash is same as in the transaction
+ */
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+const blobsDir = "blobs/"
+
+type Store struct {
+	dir string
+}
+
+func NewStore(configDir string) *Store {
+	return &Store{configDir + blobsDir}
+}
+
+func Hash(data []byte) []byte {
+	h := sha256.Sum256(data)
+	return h[:]
+}
+
+// Checks that data are the value with this hash and size
+func Verify(hash []byte, size int, data []byte) error {
+	if len(data) != size {
+		return errors.New(fmt.Sprintf("Value %x has size %d, expected %d", hash, len(data), size))
+	}
+	if !bytes.Equal(Hash(data), hash) {
+		return errors.New(fmt.Sprintf("Value %x has wrong hash", hash))
+	}
+	return nil
+}
+
+// Values are in subfolders by first byte of a hash, so a folder doesn't have too many files
+func (s *Store) path(hash []byte) string {
+	h := hex.EncodeToString(hash)
+	return s.dir + h[:2] + "/" + h
+}
+
+// Saves a value and returns its hash
+func (s *Store) Put(data []byte) ([]byte, error) {
+	hash := Hash(data)
+
+	if s.Has(hash) {
+		return hash, nil
+	}
+
+	path := s.path(hash)
+
+	err := os.MkdirAll(path[:len(path)-len(hex.EncodeToString(hash))], 0755)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// write to other file first, a reader never gets a half of a value
+	err = ioutil.WriteFile(path+".tmp", data, 0644)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return hash, os.Rename(path+".tmp", path)
+}
+
+func (s *Store) Has(hash []byte) bool {
+	if len(hash) != sha256.Size {
+		return false
+	}
+	_, err := os.Stat(s.path(hash))
+
+	return err == nil
+}
+
+// Returns a value by hash. Nil if it is not in the storage
+func (s *Store) Get(hash []byte) ([]byte, error) {
+	if !s.Has(hash) {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(s.path(hash))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(Hash(data), hash) {
+		return nil, errors.New(fmt.Sprintf("Value %x is damaged in the storage", hash))
+	}
+	return data, nil
+}
@@ -1,6 +1,9 @@
 package blockchain
 
 import (
+	"bytes"
+	"errors"
+
 	"github.com/gelembjuk/oursql/lib/utils"
 	"github.com/gelembjuk/oursql/node/database"
 	"github.com/gelembjuk/oursql/node/structures"
@@ -66,10 +69,45 @@ func (i *BlockchainIterator) Next() (*structures.Block, error) {
 
 // Returns history of transactions for given address
 func (i *BlockchainIterator) GetAddressHistory(pubKeyHash []byte, address string) ([]structures.TransactionsHistory, error) {
+	return i.GetAddressHistoryPage(pubKeyHash, address, nil, false, 0)
+}
+
+// Returns a page of history from the current block of the iterator. If afterTX is set, records of the first block
+// till the record of this TX with this IO type are skipped, it is the last record of previous page.
+// Limit 0 means all records
+func (i *BlockchainIterator) GetAddressHistoryPage(pubKeyHash []byte, address string, afterTX []byte, afterIOType bool,
+	limit int) ([]structures.TransactionsHistory, error) {
+
 	result := []structures.TransactionsHistory{}
 
+	skip := len(afterTX) > 0
+
 	for {
-		block, _ := i.Next()
+		block, err := i.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		addRecord := func(iotype bool, txID []byte, address string, value float64) {
+			if skip {
+				skip = !(bytes.Compare(txID, afterTX) == 0 && iotype == afterIOType)
+				return
+			}
+
+			if limit > 0 && len(result) >= limit {
+				return
+			}
+			rec := structures.TransactionsHistory{}
+			rec.IOType = iotype
+			rec.TXID = txID
+			rec.Address = address
+			rec.Value = value
+			rec.Time = block.Timestamp
+			rec.BlockHash = block.Hash
+			rec.BlockHeight = block.Height
+			result = append(result, rec)
+		}
 
 		for _, tx := range block.Transactions {
 
@@ -104,11 +142,11 @@ func (i *BlockchainIterator) GetAddressHistory(pubKeyHash []byte, address string
 				}
 
 				if spentvalue > 0 {
-					result = append(result, structures.TransactionsHistory{false, tx.ID, destaddress, spentvalue})
+					addRecord(false, tx.ID, destaddress, spentvalue)
 				} else {
 					// spent to himself. this should not be usual case
-					result = append(result, structures.TransactionsHistory{false, tx.ID, address, totalvalue})
-					result = append(result, structures.TransactionsHistory{true, tx.ID, address, totalvalue})
+					addRecord(false, tx.ID, address, totalvalue)
+					addRecord(true, tx.ID, address, totalvalue)
 				}
 			} else if tx.IsCoinbaseTransfer() {
 
@@ -127,11 +165,15 @@ func (i *BlockchainIterator) GetAddressHistory(pubKeyHash []byte, address string
 			}
 
 			if income > 0 {
-				result = append(result, structures.TransactionsHistory{true, tx.ID, spentaddress, income})
+				addRecord(true, tx.ID, spentaddress, income)
 			}
 		}
 
-		if len(block.PrevBlockHash) == 0 {
+		if skip {
+			return nil, errors.New("Transaction of the history cursor is not found in the block")
+		}
+
+		if len(block.PrevBlockHash) == 0 || limit > 0 && len(result) >= limit {
 			break
 		}
 	}
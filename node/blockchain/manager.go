@@ -3,6 +3,7 @@ package blockchain
 import (
 	"bytes"
 	"errors"
+	"fmt"
 
 	"github.com/gelembjuk/oursql/lib/utils"
 	"github.com/gelembjuk/oursql/node/database"
@@ -592,6 +593,66 @@ func (bc *Blockchain) GetNextBlocks(startfrom []byte, maxcount int) ([]*structur
 	return blocks, nil
 }
 
+// Calls a function for every block after a block going up. Empty hash means from the first block,
+// 0 maxcount means till the top. Blocks are loaded one by one, not all the chain is in memory
+func (bc *Blockchain) ForEachNextBlock(startfrom []byte, maxcount int, f func(block *structures.Block) error) error {
+	bcdb, err := bc.DB.GetBlockchainObject()
+
+	if err != nil {
+		return err
+	}
+
+	hash := startfrom[:]
+
+	if len(hash) == 0 {
+		hash, err = bc.GetGenesisBlockHash()
+
+		if err != nil {
+			return err
+		}
+	} else {
+		exists, _, nextHash, err := bcdb.GetLocationInChain(hash)
+
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			return errors.New(fmt.Sprintf("Block %x is not in the chain", startfrom))
+		}
+		hash = nextHash
+	}
+
+	count := 0
+
+	for len(hash) > 0 {
+		_, _, nextHash, err := bcdb.GetLocationInChain(hash)
+
+		if err != nil {
+			return err
+		}
+
+		block, err := bc.GetBlock(hash)
+
+		if err != nil {
+			return err
+		}
+
+		err = f(&block)
+
+		if err != nil {
+			return err
+		}
+		count++
+
+		if maxcount > 0 && count >= maxcount {
+			break
+		}
+		hash = nextHash[:]
+	}
+	return nil
+}
+
 // Returns first blocks in block chain
 func (bc *Blockchain) GetFirstBlocks(maxcount int) ([]*structures.Block, int, error) {
 	localError := func(err error) ([]*structures.Block, int, error) {
@@ -11,7 +11,13 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/gelembjuk/oursql/lib/anchoring"
+	"github.com/gelembjuk/oursql/lib/jsonrpc"
 	"github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/nodeclient"
+	"github.com/gelembjuk/oursql/lib/signers"
+	"github.com/gelembjuk/oursql/lib/tracing"
+	"github.com/gelembjuk/oursql/lib/txvalidation"
 	"github.com/gelembjuk/oursql/lib/utils"
 	"github.com/gelembjuk/oursql/node/database"
 )
@@ -21,6 +27,7 @@ const (
 	CommandExportWallet      = "exportwallet"
 	CommandDumpBlockchain    = "dumpblockchain"
 	CommandRestoreBlockchain = "restoreblockchain"
+	CommandImportSnapshot    = "importsnapshot"
 )
 
 var commandsDoesNotNeedConfig = []string{
@@ -32,41 +39,76 @@ var commandsDoesNotNeedConfig = []string{
 	"listaddresses",
 	"help",
 	"restoreblockchain",
-	"importandstart"}
+	CommandImportSnapshot,
+	"importandstart",
+	"devnet"}
 
 // Thi is the struct with all possible command line arguments
 type AllPossibleArgs struct {
-	AppName             string
-	Address             string
-	From                string
-	To                  string
-	Port                int
-	Host                string
-	NodePort            int
-	NodeHost            string
-	NodeAddress         string
-	DefaultAddresses    string
-	Genesis             string
-	Amount              float64
-	LogDest             string
-	LogDestDefault      bool // to know if logs destination was specified or not
-	Transaction         string
-	View                string
-	Clean               bool
-	MySQLHost           string
-	MySQLPort           int
-	MySQLSocket         string
-	MySQLUser           string
-	MySQLPassword       string
-	MySQLDBName         string
-	DBTablesPrefix      string
-	DumpFile            string
-	DestinationFile     string
-	SQL                 string
-	ConsensusFileToCopy string
-	FilePath            string
-	AllowNonEmpty       bool
-	Trace               bool
+	AppName              string
+	Address              string
+	From                 string
+	To                   string
+	Port                 int
+	Host                 string
+	NodePort             int
+	NodeHost             string
+	NodeAddress          string
+	DefaultAddresses     string
+	Genesis              string
+	Amount               float64
+	LogDest              string
+	LogDestDefault       bool // to know if logs destination was specified or not
+	Transaction          string
+	View                 string
+	Clean                bool
+	DryRun               bool
+	Wait                 int
+	Table                string
+	Batch                int
+	PoolLimit            int
+	Offset               int
+	MySQLHost            string
+	MySQLPort            int
+	MySQLSocket          string
+	MySQLUser            string
+	MySQLPassword        string
+	MySQLDBName          string
+	MySQLDSN             string
+	MySQLTLS             string
+	MySQLCA              string
+	MySQLCert            string
+	MySQLKey             string
+	DBDriver             string
+	SQLiteFile           string
+	DBTablesPrefix       string
+	DumpFile             string
+	DestinationFile      string
+	SQL                  string
+	ConsensusFileToCopy  string
+	FilePath             string
+	Scheme               string
+	AllowNonEmpty        bool
+	Trace                bool
+	Profile              string
+	Seconds              int
+	Nodes                int
+	Wallets              int
+	Format               string
+	Anchor               int
+	URL                  string
+	CID                  string
+	IP                   string
+	MaxInbound           int
+	MaxOutbound          int
+	Eviction             string
+	MaxPool              int
+	SyncInterval         int
+	SyncIntervalNoIncome int
+	Save                 bool
+	Identity             string
+	AuthStr              string
+	LogsSet              bool // logs are set in the command line, not in the config
 }
 
 // Input summary
@@ -83,6 +125,50 @@ type AppInput struct {
 	Args                       AllPossibleArgs
 	Database                   database.DatabaseConfig
 	DBProxyAddress             string
+	ProxySigner                signers.SignerConfig
+	ProxyUsers                 []ProxyUser
+	BinlogMonitor              BinlogMonitorConfig
+	RowsCheck                  RowsCheckConfig
+	Maintenance                MaintenanceConfig
+	ClockCheck                 ClockCheckConfig
+	Keepalive                  KeepaliveConfig
+	Sync                       SyncConfig
+	MaxPoolSize                int
+	SnapshotTrusted            []string
+	Anchoring                  anchoring.Config
+	IPFSGateway                string
+	TXValidators               []txvalidation.Config
+	Blobs                      BlobsConfig
+	Tracing                    tracing.Config
+	ProfilingAddress           string
+	GraphQLAddress             string
+	MetricsAddress             string
+	RESTAddress                string
+	RESTAllowOrigin            string
+	JSONRPC                    jsonrpc.Config
+	SubscriptionsAddress       string
+	LocalSocket                string
+	LocalSocketMode            string
+	WebSocketAddress           string
+	TXVerifyWorkers            int
+	CompactBlocks              bool
+	NetworkFaults              net.FaultsConfig
+	NodeTLS                    net.TLSConfig
+	WireFormat                 string
+	NodeTimeouts               nodeclient.TimeoutsConfig
+	NodeRetry                  nodeclient.RetryPolicy
+	NodeProxy                  net.ProxyConfig
+	NodeMaxResponseSize        int64
+	NodeRateLimit              nodeclient.RateLimitConfig
+	NodeBandwidth              net.BandwidthConfig
+	NodeConnLimits             net.ConnLimits
+	ServerTimeouts             net.ConnTimeouts
+	ServerMaxRequestSize       int64
+	NodePortMap                net.PortMapConfig
+	Banning                    net.BanConfig
+	PeerLists                  net.PeerListsConfig
+	LANDiscovery               net.LANDiscoveryConfig
+	Schemas                    []SchemaConfig
 	ConseususConfigFile        string
 	ConseususConfigFilePresent bool
 }
@@ -98,27 +184,185 @@ type AppConfig struct {
 	LogsDestination string
 	Database        database.DatabaseConfig
 	DBProxyAddress  string
+	ProxySigner     signers.SignerConfig
+	ProxyUsers      []ProxyUser
+	BinlogMonitor   BinlogMonitorConfig
+	RowsCheck       RowsCheckConfig
+	Maintenance     MaintenanceConfig
+	ClockCheck      ClockCheckConfig
+	Keepalive       KeepaliveConfig
+	Sync            SyncConfig
+	// max number of unapproved transactions, new transactions are refused when the pool is full. 0 means no limit
+	MaxPoolSize int
+	// identities of nodes which snapshots of DB are trusted for fast sync of a new node
+	SnapshotTrusted []string
+	Blobs           BlobsConfig
+	Tracing         tracing.Config
+	// host:port of pprof HTTP endpoints, like 127.0.0.1:6060. Empty means off
+	ProfilingAddress string
+	// host:port of GraphQL API, like 127.0.0.1:8090. Empty means off
+	GraphQLAddress string
+	// host:port of Prometheus metrics, like 127.0.0.1:9100. Empty means off
+	MetricsAddress string
+	// host:port of REST API of wallet operations, like 127.0.0.1:8091. Empty means off
+	RESTAddress string
+	// origin of web apps which can call REST API from a browser, like https://wallet.example.com or *
+	RESTAllowOrigin string
+	// JSON-RPC for node control, with address, users and methods allowed for them
+	JSONRPC jsonrpc.Config
+	// host:port of WebSocket notifications about blocks, transactions and tables, like 127.0.0.1:8093. Empty means off
+	SubscriptionsAddress string
+	// unix socket for wallets and tools on same machine, like /var/run/oursql.sock. Empty means off
+	LocalSocket string
+	// permissions of the socket file in octal, default is 0600
+	LocalSocketMode string
+	// host:port for WebSocket connections of nodes and wallets, like :8080. Empty means off
+	WebSocketAddress string
+	// publishing of block hashes to Bitcoin or Ethereum. Empty Adapter means off
+	Anchoring anchoring.Config
+	// IPFS HTTP gateway to download a consensus module. Default is https://ipfs.io/ipfs/
+	IPFSGateway string
+	// deployment specific checks of transactions, Go plugins or HTTP services
+	TXValidators []txvalidation.Config
+	// goroutines to verify transactions from other nodes. 0 means number of CPUs
+	TXVerifyWorkers int
+	// send new blocks as header and short IDs of transactions to nodes which accept it
+	CompactBlocks bool
+	// artificial network problems, only for testing
+	NetworkFaults net.FaultsConfig
+	// TLS for connections with other nodes
+	NodeTLS net.TLSConfig
+	// format of payloads of commands to other nodes, gob or protobuf. All nodes must be of version with protobuf
+	WireFormat string
+	// timeouts of requests to other nodes in milliseconds, per class of commands
+	NodeTimeouts nodeclient.TimeoutsConfig
+	// retries of requests to other nodes which only read data
+	NodeRetry nodeclient.RetryPolicy
+	// SOCKS5 proxy for connections to other nodes, like Tor
+	NodeProxy net.ProxyConfig
+	// longest response of other node in bytes. 0 means 64 MB
+	NodeMaxResponseSize int64
+	// limit of rate of requests to every other node. Empty means no limits
+	NodeRateLimit nodeclient.RateLimitConfig
+	// bytes per second of traffic with every other node and with all nodes. Empty means no limits
+	NodeBandwidth net.BandwidthConfig
+	// connections with other nodes at same time and which inbound connection is closed when there are too many
+	NodeConnLimits net.ConnLimits
+	// longest pauses in milliseconds of reading a request and writing a response of a client of this node
+	ServerTimeouts net.ConnTimeouts
+	// longest request of a client of this node in bytes. 0 means 64 MB
+	ServerMaxRequestSize int64
+	// mapping of the port on a router with UPnP or NAT-PMP, for a node behind NAT
+	NodePortMap net.PortMapConfig
+	// points of misbehavior of a peer to ban it, seconds of a ban and requests of a peer per minute. Empty means defaults
+	Banning net.BanConfig
+	// peers which are never banned and peers which can not connect, by IP or subnet
+	PeerLists net.PeerListsConfig
+	// finding of nodes in the local network with UDP broadcast. Off by default
+	LANDiscovery net.LANDiscoveryConfig
+	Schemas      []SchemaConfig
+}
+
+// MySQL user of the DB proxy and a key to sign its transactions.
+// It is an address of a wallet on this node or an external signer
+type ProxyUser struct {
+	User    string
+	Address string
+	Signer  signers.SignerConfig
+}
+
+// Monitor of MySQL binary log to find updates done not by the node.
+// Policy is alert, revert or convert. Convert makes transactions signed by a wallet Address or Signer
+type BinlogMonitorConfig struct {
+	Policy   string
+	Interval int
+	Address  string
+	Signer   signers.SignerConfig
+}
+
+// Comparing of tables rows with other nodes. Interval in seconds, 0 means off.
+// If Repair is true, different rows are restored from transactions
+type RowsCheckConfig struct {
+	Interval int
+	Repair   bool
+}
+
+// Local ANALYZE/OPTIMIZE of managed tables. It runs in Window (local time, like 02:00-05:00),
+// for a table not more often than Interval hours. Operation is for all tables, Tables sets it per table
+type MaintenanceConfig struct {
+	Window    string
+	Interval  int
+	Operation string
+	Tables    map[string]string
+}
+
+// Check of the clock against other nodes. It is warned when the median offset of other nodes is more than
+// MaxOffset seconds (default 60, -1 means off) and there are MinPeers nodes (default 3).
+// If RefuseMining is true, blocks are not made while the clock is off
+type ClockCheckConfig struct {
+	MaxOffset    int
+	MinPeers     int
+	RefuseMining bool
+}
+
+// Pings of known nodes every Interval seconds (default 60, -1 means off). A node which didn't answer
+// MissedPings pings in a row (default 3) is stale, it is used for sync only when there are no other nodes.
+// A stale node not seen NodeMaxAge seconds (default 7 days, -1 means forever) is removed, if more than
+// MinNodes (default 8) nodes are known
+type KeepaliveConfig struct {
+	Interval    int
+	MissedPings int
+	NodeMaxAge  int
+	MinNodes    int
+}
+
+// Seconds between pulls of changes from other nodes. Interval (default 180) is used when other nodes connect
+// to this node, IntervalNoIncome (default 5) when they can not and this node can miss pushed blocks.
+// HeadersFirst is a number of blocks behind other nodes when headers are loaded before bodies of
+// blocks (default 100, -1 is off)
+type SyncConfig struct {
+	Interval         int
+	IntervalNoIncome int
+	HeadersFirst     int
+}
+
+// Values of columns of MinSize bytes and more are stored out of transactions, in the blobs/ folder
+// of the config directory. 0 means all values are in transactions
+type BlobsConfig struct {
+	MinSize int
+}
+
+// Other DB schema managed by this node. It has own config directory with config.json, consensus config,
+// wallets and a blockchain in own database. A node of a schema runs in separate process
+type SchemaConfig struct {
+	Name      string
+	ConfigDir string
 }
 
 // Parses input and config file. Command line arguments ovverride config file options
 func GetAppInput() (AppInput, error) {
-	return parseConfig("")
+	return parseConfig("", os.Args[1:], flag.ExitOnError)
 }
 
 func GetAppInputFromDir(dirpath string) (AppInput, error) {
-	return parseConfig(dirpath)
+	return parseConfig(dirpath, os.Args[1:], flag.ExitOnError)
+}
+
+// Parses a command typed in the shell. Wrong arguments return error and don't stop the process
+func GetAppInputFromArgs(args []string, dirpath string) (AppInput, error) {
+	return parseConfig(dirpath, args, flag.ContinueOnError)
 }
 
-// Parses input
-func parseConfig(dirpath string) (AppInput, error) {
+// Parses input. First argument is a command
+func parseConfig(dirpath string, args []string, errorHandling flag.ErrorHandling) (AppInput, error) {
 	input := AppInput{}
 
-	if len(os.Args) < 2 {
+	if len(args) < 1 {
 		input.Command = "help"
 	} else {
-		input.Command = os.Args[1]
+		input.Command = args[0]
 
-		cmd := flag.NewFlagSet(input.Command, flag.ExitOnError)
+		cmd := flag.NewFlagSet(input.Command, errorHandling)
 
 		cmd.StringVar(&input.Args.AppName, "appname", "", "Application Name")
 		cmd.StringVar(&input.Args.Address, "address", "", "Address of operation")
@@ -140,6 +384,15 @@ func parseConfig(dirpath string) (AppInput, error) {
 		cmd.StringVar(&input.Args.LogDest, "logdest", "", "Destination of logs. file or stdout")
 		cmd.StringVar(&input.Args.View, "view", "", "View format")
 		cmd.BoolVar(&input.Args.Clean, "clean", false, "Clean data/cache")
+		cmd.BoolVar(&input.Args.DryRun, "dryrun", false, "Only print what will be done")
+		cmd.IntVar(&input.Args.Wait, "wait", 300, "Seconds to wait for confirmation of transactions")
+		cmd.StringVar(&input.Args.Table, "table", "", "Table name")
+		cmd.IntVar(&input.Args.Batch, "batch", 100, "Number of rows sent at once")
+		cmd.IntVar(&input.Args.PoolLimit, "poollimit", 1000, "Max number of unapproved transactions. Sending waits while the pool is full")
+		cmd.IntVar(&input.Args.Offset, "offset", 0, "Number of rows to skip")
+		cmd.IntVar(&input.Args.Anchor, "anchor", 0, "Anchor ID")
+		cmd.StringVar(&input.Args.URL, "url", "", "URL to download a file")
+		cmd.StringVar(&input.Args.CID, "cid", "", "IPFS content ID")
 		cmd.BoolVar(&input.Args.Trace, "trace", false, "Trace process with printing to console")
 		cmd.BoolVar(&input.Args.AllowNonEmpty, "allownotempty", false, "Allow to init blockchain on non-empty DB")
 
@@ -149,17 +402,42 @@ func parseConfig(dirpath string) (AppInput, error) {
 		cmd.StringVar(&input.Args.MySQLUser, "mysqluser", "", "MySQL user")
 		cmd.StringVar(&input.Args.MySQLPassword, "mysqlpass", "", "MySQL password")
 		cmd.StringVar(&input.Args.MySQLDBName, "mysqldb", "", "MySQL database")
+		cmd.StringVar(&input.Args.MySQLDSN, "mysqldsn", "", "Full MySQL DSN. Other MySQL connection options are not used with it")
+		cmd.StringVar(&input.Args.MySQLTLS, "mysqltls", "", "MySQL TLS mode. true, skip-verify, preferred or custom")
+		cmd.StringVar(&input.Args.MySQLCA, "mysqlca", "", "CA certificate file for MySQL TLS in custom mode")
+		cmd.StringVar(&input.Args.MySQLCert, "mysqlcert", "", "Client certificate file for MySQL TLS in custom mode")
+		cmd.StringVar(&input.Args.MySQLKey, "mysqlkey", "", "Client key file for MySQL TLS in custom mode")
+		cmd.StringVar(&input.Args.DBDriver, "dbdriver", "", "DB engine. mysql (default) or sqlite")
+		cmd.StringVar(&input.Args.SQLiteFile, "sqlitefile", "", "SQLite database file. Used when -dbdriver is sqlite")
 		cmd.StringVar(&input.Args.DBTablesPrefix, "tablesprefix", "", "MySQL blockchain tables prefix")
 		cmd.StringVar(&input.DBProxyAddress, "dbproxyaddr", "", "MySQL DB proxy address host:port")
+		cmd.StringVar(&input.ProxySigner.Type, "proxysigner", "", "External signer of proxy SQL transactions. vault or awskms")
+		cmd.StringVar(&input.ProxySigner.KeyID, "proxysignerkey", "", "Key name in Vault transit or KMS key ID of proxy signer")
 		cmd.StringVar(&input.Args.DumpFile, "dumpfile", "", "File where to dump DB")
 		cmd.StringVar(&input.Args.DestinationFile, "destfile", "", "Destination file for export")
 		cmd.StringVar(&input.Args.SQL, "sql", "", "SQL command to execute")
 
 		cmd.StringVar(&input.Args.ConsensusFileToCopy, "consensusfile", "", "Consensus file source")
 		cmd.StringVar(&input.Args.FilePath, "filepath", "", "File path")
+		cmd.StringVar(&input.Args.Scheme, "scheme", "", "Signature scheme of new wallet. ecdsa or ed25519")
+		cmd.StringVar(&input.Args.Profile, "profile", "cpu", "Profile type. cpu, heap, goroutine or trace")
+		cmd.IntVar(&input.Args.Seconds, "seconds", 30, "Seconds to collect cpu profile or trace")
+		cmd.IntVar(&input.Args.Nodes, "nodes", 3, "Number of nodes in devnet")
+		cmd.IntVar(&input.Args.Wallets, "wallets", 3, "Number of test wallets in devnet")
+		cmd.StringVar(&input.Args.Format, "format", "json", "Export format. json or csv")
+		cmd.StringVar(&input.Args.IP, "ip", "", "IP of a peer")
+		cmd.IntVar(&input.Args.MaxInbound, "maxinbound", 0, "Max number of connections of other nodes. -1 means no limit")
+		cmd.IntVar(&input.Args.MaxOutbound, "maxoutbound", 0, "Max number of connections to other nodes. -1 means no limit")
+		cmd.StringVar(&input.Args.Eviction, "eviction", "", "Which connection is closed when there are too many. score or idle")
+		cmd.IntVar(&input.Args.MaxPool, "maxpool", 0, "Max number of unapproved transactions. -1 means no limit")
+		cmd.IntVar(&input.Args.SyncInterval, "syncinterval", 0, "Seconds between pulls of changes from other nodes")
+		cmd.IntVar(&input.Args.SyncIntervalNoIncome, "syncintervalnoincome", 0, "Seconds between pulls of changes when other nodes can not connect")
+		cmd.BoolVar(&input.Args.Save, "save", false, "Save changes to the config file")
+		cmd.StringVar(&input.Args.Identity, "identity", "", "Identity of a trusted node")
+		cmd.StringVar(&input.Args.AuthStr, "authstr", "", "Auth string of a node to load a snapshot from")
 
 		configdirPtr := cmd.String("configdir", "", "Location of config files")
-		err := cmd.Parse(os.Args[2:])
+		err := cmd.Parse(args[1:])
 
 		if err != nil {
 			return input, err
@@ -199,6 +477,7 @@ func parseConfig(dirpath string) (AppInput, error) {
 	input.Host = input.Args.Host
 
 	input.Args.LogDestDefault = true
+	input.Args.LogsSet = input.Logs != ""
 
 	// read config file . command line arguments are more important than a config
 	config, err := input.GetConfig()
@@ -207,48 +486,7 @@ func parseConfig(dirpath string) (AppInput, error) {
 		return input, err
 	}
 	if config != nil {
-
-		if input.MinterAddress == "" && config.Minter != "" {
-			input.MinterAddress = config.Minter
-		}
-
-		if input.ProxyKey == "" && config.ProxyKey != "" {
-			input.ProxyKey = config.ProxyKey
-		}
-		if input.Port < 1 && config.Port > 0 {
-			input.Port = config.Port
-		}
-		if input.LocalPort < 1 && config.LocalPort > 0 {
-			input.LocalPort = config.LocalPort
-		}
-
-		if input.Host == "" && config.Host != "" {
-			input.Host = config.Host
-		}
-
-		if len(config.Nodes) > 0 {
-			input.Nodes = config.Nodes
-		}
-
-		if input.Logs == "" && len(config.Logs) > 0 {
-			input.Logs = strings.Join(config.Logs, ",")
-		}
-
-		if input.Args.LogDest == "" && config.LogsDestination != "" {
-			input.Args.LogDest = config.LogsDestination
-			input.Args.LogDestDefault = false
-
-		} else if input.Args.LogDest == "" {
-			input.Args.LogDest = "file"
-		} else {
-			input.Args.LogDestDefault = false
-		}
-
-		if input.DBProxyAddress == "" && config.DBProxyAddress != "" {
-			input.DBProxyAddress = config.DBProxyAddress
-		}
-
-		input.Database = config.Database
+		input.setFromConfig(config)
 	}
 
 	if !(input.Args.NodeHost != "" && input.Args.NodePort > 0) &&
@@ -267,13 +505,7 @@ func parseConfig(dirpath string) (AppInput, error) {
 		return input, errors.New("No database config")
 	}
 
-	if input.Host == "" {
-		input.Host = "localhost"
-	}
-
-	if input.LocalPort < 1 && input.Port > 0 {
-		input.LocalPort = input.Port
-	}
+	input.completeNodeAddress()
 
 	// set consensus config file
 	ccpath := input.ConfigDir + "consensusconfig.json"
@@ -281,6 +513,7 @@ func parseConfig(dirpath string) (AppInput, error) {
 	if input.Args.ConsensusFileToCopy != "" &&
 		(input.Command == "interactiveautocreate" ||
 			input.Command == "importblockchain" ||
+			input.Command == CommandImportSnapshot ||
 			input.Command == "initblockchain" ||
 			input.Command == "importandstart") {
 		// if there is no consensus file yet, copy new file
@@ -304,6 +537,161 @@ func parseConfig(dirpath string) (AppInput, error) {
 	return input, nil
 }
 
+// Options from a config file. Options set with command line arguments are not replaced
+func (c *AppInput) setFromConfig(config *AppConfig) {
+	if c.MinterAddress == "" && config.Minter != "" {
+		c.MinterAddress = config.Minter
+	}
+
+	if c.ProxyKey == "" && config.ProxyKey != "" {
+		c.ProxyKey = config.ProxyKey
+	}
+	if c.Port < 1 && config.Port > 0 {
+		c.Port = config.Port
+	}
+	if c.LocalPort < 1 && config.LocalPort > 0 {
+		c.LocalPort = config.LocalPort
+	}
+
+	if c.Host == "" && config.Host != "" {
+		c.Host = config.Host
+	}
+
+	if len(config.Nodes) > 0 {
+		c.Nodes = config.Nodes
+	}
+
+	if c.Logs == "" && len(config.Logs) > 0 {
+		c.Logs = strings.Join(config.Logs, ",")
+	}
+
+	if c.Args.LogDest == "" && config.LogsDestination != "" {
+		c.Args.LogDest = config.LogsDestination
+		c.Args.LogDestDefault = false
+
+	} else if c.Args.LogDest == "" {
+		c.Args.LogDest = "file"
+	} else {
+		c.Args.LogDestDefault = false
+	}
+
+	if c.DBProxyAddress == "" && config.DBProxyAddress != "" {
+		c.DBProxyAddress = config.DBProxyAddress
+	}
+
+	if c.ProxySigner.Type == "" && config.ProxySigner.Type != "" {
+		cmdSigner := c.ProxySigner
+		c.ProxySigner = config.ProxySigner
+
+		if cmdSigner.KeyID != "" {
+			c.ProxySigner.KeyID = cmdSigner.KeyID
+		}
+	}
+
+	if len(config.ProxyUsers) > 0 {
+		c.ProxyUsers = config.ProxyUsers
+	}
+
+	c.BinlogMonitor = config.BinlogMonitor
+	c.RowsCheck = config.RowsCheck
+	c.Maintenance = config.Maintenance
+	c.ClockCheck = config.ClockCheck
+	c.Keepalive = config.Keepalive
+	c.Sync = config.Sync
+	c.MaxPoolSize = config.MaxPoolSize
+	c.SnapshotTrusted = config.SnapshotTrusted
+	c.Anchoring = config.Anchoring
+	c.IPFSGateway = config.IPFSGateway
+	c.TXValidators = config.TXValidators
+	c.Blobs = config.Blobs
+	c.Tracing = config.Tracing
+	c.ProfilingAddress = config.ProfilingAddress
+	c.GraphQLAddress = config.GraphQLAddress
+	c.MetricsAddress = config.MetricsAddress
+	c.RESTAddress = config.RESTAddress
+	c.RESTAllowOrigin = config.RESTAllowOrigin
+	c.JSONRPC = config.JSONRPC
+	c.SubscriptionsAddress = config.SubscriptionsAddress
+	c.LocalSocket = config.LocalSocket
+	c.LocalSocketMode = config.LocalSocketMode
+	c.WebSocketAddress = config.WebSocketAddress
+	c.TXVerifyWorkers = config.TXVerifyWorkers
+	c.CompactBlocks = config.CompactBlocks
+	c.NetworkFaults = config.NetworkFaults
+	c.NodeTLS = config.NodeTLS
+	c.WireFormat = config.WireFormat
+	c.NodeTimeouts = config.NodeTimeouts
+	c.NodeRetry = config.NodeRetry
+	c.NodeProxy = config.NodeProxy
+	c.NodeMaxResponseSize = config.NodeMaxResponseSize
+	c.NodeRateLimit = config.NodeRateLimit
+	c.NodeBandwidth = config.NodeBandwidth
+	c.NodeConnLimits = config.NodeConnLimits
+	c.ServerTimeouts = config.ServerTimeouts
+	c.ServerMaxRequestSize = config.ServerMaxRequestSize
+	c.NodePortMap = config.NodePortMap
+	c.Banning = config.Banning
+	c.PeerLists = config.PeerLists
+	c.LANDiscovery = config.LANDiscovery
+
+	c.Database = config.Database
+
+	if len(config.Schemas) > 0 {
+		c.Schemas = []SchemaConfig{}
+
+		for _, schema := range config.Schemas {
+			// relative path is related to the config directory of the main node
+			if !filepath.IsAbs(schema.ConfigDir) {
+				schema.ConfigDir = c.ConfigDir + schema.ConfigDir
+			}
+			if !strings.HasSuffix(schema.ConfigDir, "/") {
+				schema.ConfigDir += "/"
+			}
+			c.Schemas = append(c.Schemas, schema)
+		}
+	}
+}
+
+// Default host and local port of a node
+func (c *AppInput) completeNodeAddress() {
+	if c.Host == "" {
+		c.Host = "localhost"
+	}
+
+	if c.LocalPort < 1 && c.Port > 0 {
+		c.LocalPort = c.Port
+	}
+}
+
+// Input of a node of other schema. Only its config file is used, command line arguments are for the main node
+func GetSchemaAppInput(command string, schema SchemaConfig) (AppInput, error) {
+	input := AppInput{}
+	input.Command = command
+	input.ConfigDir = schema.ConfigDir
+
+	config, err := input.GetConfig()
+
+	if err != nil {
+		return input, err
+	}
+
+	if config == nil {
+		return input, errors.New(fmt.Sprintf("Config file of schema %s is not found in %s", schema.Name, schema.ConfigDir))
+	}
+
+	input.setFromConfig(config)
+	input.completeDBConfig()
+	input.completeNodeAddress()
+
+	input.ConseususConfigFile = input.ConfigDir + "consensusconfig.json"
+
+	if _, err := os.Stat(input.ConseususConfigFile); err == nil {
+		input.ConseususConfigFilePresent = true
+	}
+
+	return input, nil
+}
+
 func (c *AppInput) completeDBConfig() {
 	if c.Database.DatabaseName == "" && c.Args.MySQLDBName != "" {
 		c.Database.DatabaseName = c.Args.MySQLDBName
@@ -338,6 +726,28 @@ func (c *AppInput) completeDBConfig() {
 	if c.Database.TablesPrefix == "" && c.Args.DBTablesPrefix != "" {
 		c.Database.TablesPrefix = c.Args.DBTablesPrefix
 	}
+
+	if c.Database.DSN == "" && c.Args.MySQLDSN != "" {
+		c.Database.DSN = c.Args.MySQLDSN
+	}
+	if c.Database.TLSMode == "" && c.Args.MySQLTLS != "" {
+		c.Database.TLSMode = c.Args.MySQLTLS
+	}
+	if c.Database.TLSCAFile == "" && c.Args.MySQLCA != "" {
+		c.Database.TLSCAFile = c.Args.MySQLCA
+	}
+	if c.Database.TLSCertFile == "" && c.Args.MySQLCert != "" {
+		c.Database.TLSCertFile = c.Args.MySQLCert
+	}
+	if c.Database.TLSKeyFile == "" && c.Args.MySQLKey != "" {
+		c.Database.TLSKeyFile = c.Args.MySQLKey
+	}
+	if c.Database.Driver == "" && c.Args.DBDriver != "" {
+		c.Database.Driver = c.Args.DBDriver
+	}
+	if c.Database.SQLiteFile == "" && c.Args.SQLiteFile != "" {
+		c.Database.SQLiteFile = c.Args.SQLiteFile
+	}
 }
 
 // check if this commands really needs a config file
@@ -416,6 +826,10 @@ func (c AppInput) UpdateConfig() error {
 		config.DBProxyAddress = c.DBProxyAddress
 	}
 
+	if c.ProxySigner.Type != "" {
+		config.ProxySigner = c.ProxySigner
+	}
+
 	if c.Args.NodeHost != "" && c.Args.NodePort > 0 {
 		node := net.NewNodeAddr(c.Args.NodeHost, c.Args.NodePort)
 
@@ -476,6 +890,27 @@ func (c AppInput) UpdateConfig() error {
 	if c.Args.DBTablesPrefix != "" {
 		config.Database.TablesPrefix = c.Args.DBTablesPrefix
 	}
+	if c.Args.MySQLDSN != "" {
+		config.Database.DSN = c.Args.MySQLDSN
+	}
+	if c.Args.MySQLTLS != "" {
+		config.Database.TLSMode = c.Args.MySQLTLS
+	}
+	if c.Args.MySQLCA != "" {
+		config.Database.TLSCAFile = c.Args.MySQLCA
+	}
+	if c.Args.MySQLCert != "" {
+		config.Database.TLSCertFile = c.Args.MySQLCert
+	}
+	if c.Args.MySQLKey != "" {
+		config.Database.TLSKeyFile = c.Args.MySQLKey
+	}
+	if c.Args.DBDriver != "" {
+		config.Database.Driver = c.Args.DBDriver
+	}
+	if c.Args.SQLiteFile != "" {
+		config.Database.SQLiteFile = c.Args.SQLiteFile
+	}
 
 	// convert back to JSON and save to config file
 	file, errf := os.OpenFile(configfile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
@@ -496,6 +931,32 @@ func (c AppInput) UpdateConfig() error {
 	return nil
 }
 
+// Changes the config file in a config dir. Options which are not changed by the function stay same
+func UpdateConfigFile(configDir string, update func(config *AppConfig)) error {
+	input := AppInput{ConfigDir: configDir}
+
+	config, err := input.GetConfig()
+
+	if err != nil {
+		return err
+	}
+
+	if config == nil {
+		config = &AppConfig{}
+	}
+
+	update(config)
+
+	file, err := os.OpenFile(configDir+"config.json", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return json.NewEncoder(file).Encode(config)
+}
+
 func copyFile(srcpath, dstpath string) error {
 	input, err := ioutil.ReadFile(srcpath)
 
@@ -516,33 +977,43 @@ func (c AppInput) PrintUsage() {
 	fmt.Println("  help - Prints this help")
 	fmt.Println("  == Any of next commands can have optional argument [-configdir /path/to/dir] [-logdest stdout]==")
 	fmt.Println("=[Auth keys operations]")
-	fmt.Println("  createwallet\n\t- Generates a new key-pair and saves it into the wallet file")
+	fmt.Println("  createwallet [-scheme ecdsa|ed25519]\n\t- Generates a new key-pair and saves it into the wallet file")
 	fmt.Println("  ", CommandImportWallet, " -filepath FILEPATH\n\t- Imports wallets from external wallets file.")
 	fmt.Println("  ", CommandExportWallet, " -filepath FILEPATH\n\t- Exports wallets file to given destination. Can be used for backup of wallets")
 	fmt.Println("  listaddresses\n\t- Lists all addresses from the wallet file")
 
 	fmt.Println("=[Blockchain init operations]")
 	//fmt.Println("  interactiveautocreate [-consensusfile FILEPATH] [-mysqlhost HOST] [-mysqlport PORT] [-mysqluser USER] [-mysqlpass PASSWORD] [-mysqldb DBNAME] [-tablesprefix PREFIX]\n\t- Create a blockchain if it doesn't exist yet, creates a wallet if no wallets yet, starts a node in interactive mode.")
-	//fmt.Println("  importandstart [-nodeaddress HOST:PORT] [-consensusfile FILEPATH] [-mysqlhost HOST] [-mysqlport PORT] [-mysqluser USER] [-mysqlpass PASSWORD] [-mysqldb DBNAME] [-tablesprefix PREFIX]\n\t- Loads a blockchain from other node to init the DB. Cretes a wallet of no wallets, starts a node in interactive mode.")
+	//fmt.Println("  importandstart [-nodeaddress HOST:PORT] [-consensusfile FILEPATH] [-mysqlhost HOST] [-mysqlport PORT] [-mysqluser USER] [-mysqlpass PASSWORD] [-mysqldb DBNAME] [-dbdriver mysql|sqlite] [-sqlitefile FILE] [-tablesprefix PREFIX]\n\t- Loads a blockchain from other node to init the DB. Cretes a wallet of no wallets, starts a node in interactive mode.")
 	//fmt.Println("  pullupdates \n\t- Pulls recent updates from other nodes in a network.")
-	fmt.Println("  initblockchain [-minter ADDRESS] [-consensusfile FILEPATH] [-allownotempty] [-trace] [-mysqlhost HOST] [-mysqlport PORT] [-mysqluser USER] [-mysqlpass PASSWORD] [-mysqldb DBNAME] [-tablesprefix PREFIX]\n\t- Create a blockchain and send genesis block reward to ADDRESS")
+	fmt.Println("  initblockchain [-minter ADDRESS] [-consensusfile FILEPATH] [-allownotempty] [-trace] [-mysqlhost HOST] [-mysqlport PORT] [-mysqluser USER] [-mysqlpass PASSWORD] [-mysqldb DBNAME] [-dbdriver mysql|sqlite] [-sqlitefile FILE] [-tablesprefix PREFIX]\n\t- Create a blockchain and send genesis block reward to ADDRESS")
 	fmt.Println("  importblockchain [-consensusfile FILEPATH] [-nodeaddress HOST:PORT] [-mysqlhost HOST] [-mysqlport PORT] [-mysqluser USER] [-mysqlpass PASSWORD] [-mysqldb DBNAME] [-tablesprefix PREFIX]\n\t- Loads a blockchain from other node to init the DB. If consensusfile is set and it contains initial node address, it will be used")
+	fmt.Println("  importsnapshot [-identity ID] [-authstr AUTHSTR] [-consensusfile FILEPATH] [-nodeaddress HOST:PORT] [-mysqlhost HOST] [-mysqlport PORT] [-mysqluser USER] [-mysqlpass PASSWORD] [-mysqldb DBNAME] [-tablesprefix PREFIX]\n\t- Loads a signed snapshot of the DB from a trusted node to init the DB, SQL of blocks is not executed. ID is an identity of the node, other trusted identities are in SnapshotTrusted of config. The node gives a snapshot with its AUTHSTR or to whitelisted peers")
 	fmt.Println("  restoreblockchain -dumpfile FILEPATH [-mysqlhost HOST] [-mysqlport PORT] [-mysqluser USER] [-mysqlpass PASSWORD] [-mysqldb DBNAME] [-tablesprefix PREFIX]\n\t- Loads a blockchain from dump file and restores it to given DB. A DB credentials can be optional if they are present in config file")
 	fmt.Println("  dumpblockchain -dumpfile FILEPATH\n\t- Dump blockchain DB to a file. This fle can be used to restore a BC")
 	fmt.Println("  exportconsensusconfig -destfile FILEPATH [-defaultaddresses own,host:port] [-appname NAME]\n\t- Save consensus config file. Can include this node address as initial address.")
-	fmt.Println("  updateconfig [-minter ADDRESS] [-proxykey ADDRESS] [-host HOST] [-port PORT] [-nodehost HOST] [-nodeport PORT] [-mysqlhost HOST] [-mysqlport PORT] [-mysqluser USER] [-mysqlpass PASSWORD] [-mysqldb DBNAME] [-tablesprefix PREFIX] [-dbproxyaddr ADDR]\n\t- Update config file. Allows to set this node minter address, host and port and remote node host and port")
+	fmt.Println("  setconsensusmodule -filepath FILE [-url URL] [-cid CID]\n\t- Reference a consensus module in the consensus config by its hash. Nodes download it from URL or IPFS and check the hash")
+	fmt.Println("  updateconfig [-minter ADDRESS] [-proxykey ADDRESS] [-host HOST] [-port PORT] [-nodehost HOST] [-nodeport PORT] [-mysqlhost HOST] [-mysqlport PORT] [-mysqluser USER] [-mysqlpass PASSWORD] [-mysqldb DBNAME] [-tablesprefix PREFIX] [-mysqldsn DSN] [-mysqltls MODE] [-mysqlca FILE] [-mysqlcert FILE] [-mysqlkey FILE] [-dbdriver mysql|sqlite] [-sqlitefile FILE] [-dbproxyaddr ADDR] [-proxysigner vault|awskms -proxysignerkey KEY]\n\t- Update config file. Allows to set this node minter address, host and port and remote node host and port")
+	fmt.Println("  shell [-from ADDRESS]\n\t- Interactive shell. Commands are typed without ./node, SQL queries are executed with the wallet ADDRESS")
 
 	fmt.Println("=[Blockchain manage operations]")
 	fmt.Println("  printchain [-view short|long]\n\t- Print all the blocks of the blockchain. Default view is long")
+	fmt.Println("  exportchain -destfile DIR [-format json|csv]\n\t- Export blocks, transactions and unspent outputs to DIR as newline delimited JSON or CSV files for analytics")
 	fmt.Println("  makeblock [-minter ADDRESS]\n\t- Try to mine new block if there are enough transactions")
 	fmt.Println("  dropblock\n\t- Delete last block fro the block chain. All transaction are returned back to unapproved state")
 
 	fmt.Println("=[SQL operations]")
 	fmt.Println("  sql -from FROM -sql SQLCOMMAND\n\t- Execute SQL query signed by FROM address")
+	fmt.Println("  migrate -from FROM -filepath SCHEMAFILE [-clean] [-dryrun] [-wait SECONDS]\n\t- Change tables to the schema from a file with CREATE TABLE statements.\n\t  Queries are signed by FROM address and executed as transactions. Waits until they are in blocks.\n\t  With -clean tables and columns missed in the schema are dropped. -dryrun only prints queries")
+	fmt.Println("  importdata -from FROM -filepath FILE [-table TABLE] [-batch ROWS] [-poollimit NUMBER] [-offset ROWS] [-wait SECONDS]\n\t- Import rows from CSV file (columns in the first line) to TABLE or from SQL dump with INSERT statements.\n\t  Every row is a transaction signed by FROM address. Rows are sent by batches, it waits while the pool has more than -poollimit transactions.\n\t  -offset skips rows, it is used to continue failed import")
 
 	fmt.Println("=[Currency transactions and control operations]")
 	fmt.Println("  reindexcache\n\t- Rebuilds the database of unspent transactions outputs and transaction pointers")
 	fmt.Println("  showunspent -address ADDRESS\n\t- Print the list of all unspent transactions and balance")
+	fmt.Println("  showchanges [-offset CURSOR] [-batch N]\n\t- Print N events of the change log after CURSOR. Events are data changes of SQL transactions in the primary chain")
+	fmt.Println("  makeanchor\n\t- Publish hash of the top block to the external blockchain with the anchoring adapter from config")
+	fmt.Println("  showanchors [-offset N] [-batch N]\n\t- Print N anchors of blocks in the external blockchain, from the last one")
+	fmt.Println("  verifyanchor -anchor ID\n\t- Check that the external blockchain has the block hash of the anchor and the block is in the primary chain")
 	fmt.Println("  getbalance -address ADDRESS\n\t- Get balance of ADDRESS")
 	fmt.Println("  getbalances\n\t- Lists all addresses from the wallet file and show balance for each")
 	fmt.Println("  addrhistory -address ADDRESS\n\t- Shows all transactions for a wallet address")
@@ -554,12 +1025,20 @@ func (c AppInput) PrintUsage() {
 	fmt.Println("  unapprovedtransactions [-clean]\n\t- Print the list of transactions not included in any block yet. If the option -clean provided then cleans the cache")
 
 	fmt.Println("=[Node server operations]")
-	fmt.Println("  startnode [-minter ADDRESS] [-host HOST] [-port PORT] [-proxykey ADDRESS] [-dbproxyaddr ADDR]\n\t- Start a node server. -minter defines minting address, -host - hostname of the node server , -port - listening port, -dbproxyaddr mysql proxy listening address `host:port`")
+	fmt.Println("  startnode [-minter ADDRESS] [-host HOST] [-port PORT] [-proxykey ADDRESS] [-proxysigner vault|awskms -proxysignerkey KEY] [-dbproxyaddr ADDR]\n\t- Start a node server. -minter defines minting address, -host - hostname of the node server , -port - listening port, -dbproxyaddr mysql proxy listening address `host:port`, -proxysigner - sign proxy transactions with a key in Vault or AWS KMS instead of -proxykey.\n\t  Nodes of schemas from the config are started too")
 	fmt.Println("  startintnode [-minter ADDRESS] [-port PORT] [-proxykey ADDRESS] [-dbproxyaddr ADDR]\n\t- Start a node server in interactive mode (no deamon). -minter defines minting address and -port - listening port")
-	fmt.Println("  stopnode\n\t- Stop runnning node")
+	fmt.Println("  stopnode\n\t- Stop runnning node and nodes of schemas")
 	fmt.Println("  nodestate\n\t- Print state of the node process")
 
 	fmt.Println("  shownodes\n\t- Display list of nodes addresses, including inactive")
 	fmt.Println("  addnode -nodehost HOST -nodeport PORT\n\t- Adds new node to list of connections")
 	fmt.Println("  removenode -nodehost HOST -nodeport PORT\n\t- Removes a node from list of connections")
+	fmt.Println("  setlogs -logs LOGS\n\t- Change enabled logs of the running node. LOGS is comma separated list of trace, traceext, info, warning, error or none")
+	fmt.Println("  showbans\n\t- Show peers banned by the running node for misbehavior")
+	fmt.Println("  clearbans [-ip IP]\n\t- Remove a ban of a peer with IP. Without IP all bans are removed")
+	fmt.Println("  showsettings\n\t- Show settings of the running node which can be changed without restart")
+	fmt.Println("  setsettings [-logs LOGS] [-maxinbound N] [-maxoutbound N] [-eviction score|idle] [-maxpool N] [-syncinterval SECONDS] [-syncintervalnoincome SECONDS] [-save]\n\t- Change settings of the running node. With -save they are written to the config file too")
+	fmt.Println("  bench [-nodehost HOST -nodeport PORT]\n\t- Measure speed of signatures verify, SQL parsing and blocks applying on this host. With other node address, also speed of loading blocks from it")
+	fmt.Println("  profile [-profile cpu|heap|goroutine|trace] [-seconds N] -filepath FILE\n\t- Collect a profile of the running node and save it to FILE. cpu and trace are collected for N seconds")
+	fmt.Println("  devnet [-nodes N] [-port PORT] [-wallets N] [-amount AMOUNT] [-clean]\n\t- Start local network of N nodes on ports from PORT with SQLite databases in devnet folder.\n\t  Test wallets get AMOUNT coins each. Works till Ctrl+C. -clean removes data of previous devnet")
 }
@@ -2,6 +2,9 @@ package config
 
 // File names
 const PidFileName = "server.pid"
+const IdentityFileName = "nodeidentity.key"
+const BansFileName = "bans.json"
+const ManualNodesFileName = "manualnodes.json"
 
 // other internal constant
 const Daemonprocesscommandline = "daemonnode"
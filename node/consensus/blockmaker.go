@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/gelembjuk/oursql/lib"
+	"github.com/gelembjuk/oursql/lib/txvalidation"
 	"github.com/gelembjuk/oursql/lib/utils"
 	"github.com/gelembjuk/oursql/node/blockchain"
 	"github.com/gelembjuk/oursql/node/config"
@@ -245,7 +246,8 @@ func (n *NodeBlockMaker) makeNewBlockFromTransactions(transactions []structures.
 		return nil, errc
 	}
 
-	transactions = append(transactions, *cbTx)
+	// SQL of the block is executed in this order on every node
+	transactions = structures.SortBlockTransactions(append(transactions, *cbTx))
 	/*
 		txlist := []*transaction.Transaction{}
 
@@ -265,6 +267,17 @@ func (n *NodeBlockMaker) makeNewBlockFromTransactions(transactions []structures.
 }
 
 // Verify the block. We check if it is correct agains previous block
+// Verify a header of a block received before its body. Only the hash is checked, transactions are
+// verified with the body
+func (n *NodeBlockMaker) VerifyBlockHeader(block *structures.Block, merkleRoot []byte) error {
+	pow := NewProofOfWork(block, n.config.Settings)
+
+	if !pow.ValidateHeader(merkleRoot) {
+		return errors.New(fmt.Sprintf("Hash of block header %x is not valid", block.Hash))
+	}
+	return nil
+}
+
 // Verify a block against blockchain
 // RULES
 // 0. Verification is done agains blockchain branch starting from prevblock, not current top branch
@@ -275,6 +288,8 @@ func (n *NodeBlockMaker) makeNewBlockFromTransactions(transactions []structures.
 // 4. all inputs must be in blockchain (correct unspent inputs)
 // 5. Additionally verify each transaction agains signatures, total amount, balance etc
 // 6. Verify hash is correc agains rules
+// 7. transactions are in the order of execution, same order is made by a block maker from same transactions.
+//   It is checked from the height in RulesActivation.TransactionsOrder
 func (n *NodeBlockMaker) VerifyBlock(block *structures.Block, flags int) error {
 	//6. Verify hash
 	pow := NewProofOfWork(block, n.config.Settings)
@@ -306,6 +321,15 @@ func (n *NodeBlockMaker) VerifyBlock(block *structures.Block, flags int) error {
 		return errors.New("Number of transactions is too high")
 	}
 
+	// 7. blocks made before the order was strict have transactions in any order
+	if n.config.RulesActivation.IsActive(n.config.RulesActivation.TransactionsOrder, block.Height) {
+		err = structures.CheckBlockTransactionsOrder(block.Transactions)
+
+		if err != nil {
+			return err
+		}
+	}
+
 	if flags&lib.TXFlagsSkipSQLBaseCheckIfNotOnTop > 0 {
 		// check if this block will go to top or no
 		lastHash, _, err := n.getBlockchainManager().GetState()
@@ -361,6 +385,13 @@ func (n NodeBlockMaker) VerifyTransaction(tx *structures.Transaction, prevTXs []
 	// check if provided tip is top of chain or no
 	isOnTop := false
 
+	// transactions for the pool come without a tip
+	stage := txvalidation.StageBlock
+
+	if len(prevBlockHash) == 0 {
+		stage = txvalidation.StagePool
+	}
+
 	var curBlockHash []byte
 	var curBlockHeight int
 	var err error
@@ -393,9 +424,11 @@ func (n NodeBlockMaker) VerifyTransaction(tx *structures.Transaction, prevTXs []
 		return errors.New(fmt.Sprintf("Transaction in a block is not valid: %x", tx.GetID()))
 	}
 
+	var qparsed *dbquery.QueryParsed
+
 	if tx.IsSQLCommand() {
 		//n.Logger.Trace.Printf("Go to parse %x , flags %d", tx.GetID(), flags)
-		qparsed, err := n.parseQueryFromTX(tx, flags)
+		qparsed, err = n.parseQueryFromTX(tx, flags)
 
 		if err != nil {
 			n.Logger.Trace.Printf("Error TX parsing %s", err.Error())
@@ -431,6 +464,9 @@ func (n NodeBlockMaker) VerifyTransaction(tx *structures.Transaction, prevTXs []
 		}
 	}
 
+	if txvalidation.HasValidators() {
+		return n.verifyTransactionCustom(tx, qparsed, stage, prevBlockHeight)
+	}
 	return nil
 }
 
@@ -445,13 +481,24 @@ func (n *NodeBlockMaker) AddTransactionToPool(tx *structures.Transaction, flags
 		return nil
 	}
 
-	err := n.VerifyTransaction(tx, nil, []byte{}, -1, flags)
+	err := n.checkPoolRoom()
+
+	if err != nil {
+		return err
+	}
+
+	err = n.VerifyTransaction(tx, nil, []byte{}, -1, flags)
 
 	if err != nil {
 		return err
 	}
 
-	return n.getTransactionsManager().AddNewTransaction(tx, flags)
+	err = n.getTransactionsManager().AddNewTransaction(tx, flags)
+
+	if err == nil {
+		countPoolTransaction()
+	}
+	return err
 }
 
 //Get minimum and maximum number of transaction allowed in block for current chain
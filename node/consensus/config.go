@@ -42,6 +42,13 @@ type ConsensusConfigApplication struct {
 	WebSite string
 	Team    string
 }
+
+// Heights of blocks from which new rules are checked. 0 means a rule is not checked,
+// so chains made before a rule was added stay valid
+type ConsensusConfigActivation struct {
+	NamesRegistry     int
+	TransactionsOrder int
+}
 type consensusConfigState struct {
 	isDefault bool
 	filePath  string
@@ -52,14 +59,17 @@ type ConsensusConfig struct {
 	CoinsForBlockMade      float64
 	Settings               map[string]interface{}
 	ApplyRulesAfterBlock   int
+	RulesActivation        ConsensusConfigActivation
 	AllowTableCreate       bool
 	AllowTableDrop         bool
+	AllowTableAlter        bool
 	AllowRowDelete         bool
 	TransactionCost        ConsensusConfigCost
 	UnmanagedTables        []string
 	TableRules             []ConsensusConfigTable
 	InitNodesAddreses      []string
 	PaidTransactionsWallet string
+	Module                 ConsensusConfigModule
 	state                  consensusConfigState
 }
 
@@ -83,10 +93,14 @@ func NewConfigDefault() (*ConsensusConfig, error) {
 	c.CoinsForBlockMade = 10
 	c.AllowTableCreate = true
 	c.AllowTableDrop = true
+	c.AllowTableAlter = true
 	c.AllowRowDelete = true
 	c.UnmanagedTables = []string{}
 	c.TableRules = []ConsensusConfigTable{}
 	c.InitNodesAddreses = []string{}
+	// new chains check all rules from first block
+	c.RulesActivation.NamesRegistry = 1
+	c.RulesActivation.TransactionsOrder = 1
 
 	// make defauls PoW settings
 	s := ProofOfWorkSettings{}
@@ -151,6 +165,11 @@ func (c *ConsensusConfig) load(jsonStr []byte) error {
 	return nil
 }
 
+// Check if a rule activated from the height is checked in a block with this height
+func (a ConsensusConfigActivation) IsActive(from int, height int) bool {
+	return from > 0 && height >= from
+}
+
 // Save a consensus config to same file from where it was loaded
 func (cc ConsensusConfig) saveBackToFile() error {
 	jsondata, err := json.Marshal(cc)
@@ -1,8 +1,6 @@
 package consensus
 
 import (
-	"crypto/ecdsa"
-
 	"github.com/gelembjuk/oursql/lib/utils"
 	"github.com/gelembjuk/oursql/node/database"
 	"github.com/gelembjuk/oursql/node/structures"
@@ -31,6 +29,7 @@ type QueryFromProxyResult struct {
 	TXData       []byte
 	StringToSign []byte
 	ReplaceQuery string
+	IsSelect     bool
 	ErrorCode    uint16
 	Error        error
 }
@@ -45,18 +44,24 @@ type BlockMakerInterface interface {
 	GetPreparedBlockTransactionsIDs() ([][]byte, error) // returns list of transactions in prepared block
 	CompleteBlock() (*structures.Block, error)
 	VerifyBlock(block *structures.Block, flags int) error
+	VerifyBlockHeader(block *structures.Block, merkleRoot []byte) error // block without transactions
 	AddTransactionToPool(tx *structures.Transaction, flags int) error
 }
 
 type SQLTransactionsInterface interface {
 	NewQuery(sql string, pubKey []byte) (uint, []byte, []byte, *structures.Transaction, error)
 	NewQuerySigned(txEncoded []byte, signature []byte) (*structures.Transaction, error)
-	NewQueryByNode(sql string, pubKey []byte, privKey ecdsa.PrivateKey) (uint, *structures.Transaction, error)
-	NewQueryByNodeInit(sql string, pubKey []byte, privKey ecdsa.PrivateKey) (tx *structures.Transaction, err error)
+	NewQueryByNode(sql string, signer utils.Signer) (uint, *structures.Transaction, error)
+	NewQueryByNodeInit(sql string, signer utils.Signer) (tx *structures.Transaction, err error)
 	NewQueryFromProxy(sql string) QueryFromProxyResult
 	RepeatTransactionsFromCanceledBlocks(txList []structures.Transaction) error
 }
 
+type NamesManagerInterface interface {
+	GetByName(name string) (*NameRecord, error)
+	GetByAddress(address string) (*NameRecord, error)
+}
+
 func NewBlockMakerManager(config *ConsensusConfig, minter string, DB database.DBManager, Logger *utils.LoggerMan) BlockMakerInterface {
 	bm := &NodeBlockMaker{}
 	bm.DB = DB
@@ -66,13 +71,22 @@ func NewBlockMakerManager(config *ConsensusConfig, minter string, DB database.DB
 	return bm
 }
 
-func NewSQLQueryManager(config *ConsensusConfig, DB database.DBManager, Logger *utils.LoggerMan, pubKey []byte, privKey ecdsa.PrivateKey) (SQLTransactionsInterface, error) {
+// Signer is optional. If it is set then transactions by its key are signed internally
+func NewSQLQueryManager(config *ConsensusConfig, DB database.DBManager, Logger *utils.LoggerMan, signer utils.Signer) (SQLTransactionsInterface, error) {
 	qm := &queryManager{}
 	qm.DB = DB
 	qm.Logger = Logger
-	qm.pubKey = pubKey
-	qm.privKey = privKey
+	qm.signer = signer
 	qm.config = config
 
+	if signer != nil {
+		qm.pubKey = signer.GetPublicKey()
+	}
+
 	return qm, nil
 }
+
+// Names registry manager. Used to find public keys by names
+func NewNamesManager(DB database.DBManager, Logger *utils.LoggerMan) NamesManagerInterface {
+	return &namesManager{DB, Logger}
+}
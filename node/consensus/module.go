@@ -0,0 +1,216 @@
+package consensus
+
+/*
+* Consensus module is referenced in the config by its content hash. Nodes don't send it with consensus data,
+* a joining node downloads it from URL or IPFS, checks the hash and keeps in the modules/ folder near the config
+ */
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gelembjuk/oursql/lib/utils"
+)
+
+const (
+	DefaultIPFSGateway = "https://ipfs.io/ipfs/"
+	modulesFolder      = "modules"
+	// max size of a module to download
+	maxModuleSize = 256 * 1024 * 1024
+)
+
+type ConsensusConfigModule struct {
+	Hash string // sha256 of the module, hex
+	URL  string // HTTP(S) URL to download from
+	CID  string // IPFS content ID. It is downloaded from a gateway
+}
+
+var (
+	ipfsGateway     = DefaultIPFSGateway
+	ipfsGatewayLock sync.Mutex
+)
+
+// Sets IPFS HTTP gateway of this node, like http://127.0.0.1:8080/ipfs/ for a local IPFS daemon
+func SetIPFSGateway(gateway string) {
+	ipfsGatewayLock.Lock()
+	defer ipfsGatewayLock.Unlock()
+
+	if gateway == "" {
+		gateway = DefaultIPFSGateway
+	}
+	if !strings.HasSuffix(gateway, "/") {
+		gateway = gateway + "/"
+	}
+	ipfsGateway = gateway
+}
+
+func getIPFSGateway() string {
+	ipfsGatewayLock.Lock()
+	defer ipfsGatewayLock.Unlock()
+
+	return ipfsGateway
+}
+
+// Returns hash of module contents in format of the config
+func GetModuleHash(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// Checks if the config references a module
+func (cc ConsensusConfig) HasModule() bool {
+	return cc.Module.Hash != ""
+}
+
+// Path of the module file in the cache. Name of a file is its hash
+func (cc ConsensusConfig) GetModulePath() string {
+	if !cc.HasModule() {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(cc.state.filePath), modulesFolder, strings.ToLower(cc.Module.Hash))
+}
+
+// Returns contents of the module from the cache. The hash is checked, a module could be changed on a disk
+func (cc ConsensusConfig) LoadModule() ([]byte, error) {
+	if !cc.HasModule() {
+		return nil, errors.New("Consensus config has no module")
+	}
+
+	data, err := ioutil.ReadFile(cc.GetModulePath())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if GetModuleHash(data) != strings.ToLower(cc.Module.Hash) {
+		return nil, errors.New(fmt.Sprintf("Consensus module %s in cache has wrong hash", cc.GetModulePath()))
+	}
+	return data, nil
+}
+
+// Saves module contents to the cache if the hash is correct
+func (cc ConsensusConfig) SaveModule(data []byte) error {
+	if !cc.HasModule() {
+		return errors.New("Consensus config has no module")
+	}
+
+	if GetModuleHash(data) != strings.ToLower(cc.Module.Hash) {
+		return errors.New(fmt.Sprintf("Consensus module hash is %s, expected %s", GetModuleHash(data), cc.Module.Hash))
+	}
+
+	path := cc.GetModulePath()
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+
+	if err != nil {
+		return err
+	}
+
+	// other process can read the module, so it is renamed to the name when written fully
+	tmpPath := path + ".tmp"
+
+	err = ioutil.WriteFile(tmpPath, data, 0644)
+
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// Sets the module of the consensus. It is saved to the cache and the config file is updated.
+// The file must be available on URL or IPFS with same contents for other nodes
+func (cc *ConsensusConfig) SetModule(data []byte, url string, cid string) error {
+	if url == "" && cid == "" {
+		return errors.New("URL or IPFS CID of a module is required")
+	}
+
+	cc.Module = ConsensusConfigModule{GetModuleHash(data), url, cid}
+
+	err := cc.SaveModule(data)
+
+	if err != nil {
+		return err
+	}
+	return cc.saveBackToFile()
+}
+
+// Downloads the module if it is not in the cache yet. URL is tried first, then IPFS
+func (cc ConsensusConfig) FetchModule(logger *utils.LoggerMan) error {
+	if !cc.HasModule() {
+		return nil
+	}
+
+	if _, err := cc.LoadModule(); err == nil {
+		return nil
+	}
+
+	sources := []string{}
+
+	if cc.Module.URL != "" {
+		sources = append(sources, cc.Module.URL)
+	}
+
+	if cc.Module.CID != "" {
+		sources = append(sources, getIPFSGateway()+cc.Module.CID)
+	}
+
+	if len(sources) == 0 {
+		return errors.New("Consensus module is not in the cache and it has no URL or CID to download")
+	}
+
+	var lastErr error
+
+	for _, source := range sources {
+		data, err := downloadModule(source)
+
+		if err == nil {
+			err = cc.SaveModule(data)
+		}
+
+		if err != nil {
+			logger.Error.Printf("Consensus module from %s failed: %s", source, err.Error())
+			lastErr = err
+			continue
+		}
+
+		logger.Trace.Printf("Consensus module %s loaded from %s, %d bytes", cc.Module.Hash, source, len(data))
+		return nil
+	}
+	return lastErr
+}
+
+func downloadModule(url string) ([]byte, error) {
+	client := &http.Client{Timeout: 10 * time.Minute}
+
+	resp, err := client.Get(url)
+
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("Server returned status %d", resp.StatusCode))
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxModuleSize+1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > maxModuleSize {
+		return nil, errors.New("Consensus module is too large")
+	}
+	return data, nil
+}
@@ -0,0 +1,135 @@
+package consensus
+
+/*
+* Names registry. A name is registered with SQL transaction inserting a row to the special table.
+* Consensus rules ensure a row can be inserted only by the key it maps to and is never changed later.
+* The insert must be exactly the query made by utils.MakeRegisterNameSQL
+ */
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gelembjuk/oursql/lib"
+	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/database"
+	"github.com/gelembjuk/oursql/node/dbquery"
+)
+
+// SQL to create the names table. It is created when new blockchain is made
+const NamesTableCreateSQL = "CREATE TABLE " + lib.NamesTable + " (" +
+	"name VARCHAR(32) NOT NULL PRIMARY KEY, " +
+	"pubkey VARCHAR(200) NOT NULL, " +
+	"address VARCHAR(64) NOT NULL)"
+
+// Record of the names registry
+type NameRecord struct {
+	Name    string
+	PubKey  []byte
+	Address string
+}
+
+type namesManager struct {
+	DB     database.DBManager
+	Logger *utils.LoggerMan
+}
+
+// Find a record by name. Returns nil if the name is not registered
+func (m namesManager) GetByName(name string) (*NameRecord, error) {
+	if !utils.IsValidName(name) {
+		return nil, errors.New("Name is not valid")
+	}
+	return m.getRecord("name", name)
+}
+
+// Find a record by address. Returns nil if the address has no name
+func (m namesManager) GetByAddress(address string) (*NameRecord, error) {
+	_, err := utils.AddresToPubKeyHash(address)
+
+	if err != nil {
+		return nil, err
+	}
+	return m.getRecord("address", address)
+}
+
+func (m namesManager) getRecord(column, value string) (*NameRecord, error) {
+	sql := fmt.Sprintf("SELECT name, pubkey, address FROM %s WHERE %s=%s", lib.NamesTable, column, m.DB.QM().GetQuoter().Literal(value))
+
+	row, err := m.DB.QM().ExecuteSQLSelectRow(sql)
+
+	if dberr, ok := err.(*database.DBError); ok && dberr.IsRowNotFound() {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	record := &NameRecord{}
+	record.Name = row["name"]
+	record.Address = row["address"]
+	record.PubKey, err = hex.DecodeString(row["pubkey"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// Check rules for the names table. First value is false if the query is not for this table
+// Table can be created. A row can be only inserted by the key it maps to. Update and delete is not allowed.
+// Insert must be exactly the query of MakeRegisterNameSQL, so ON DUPLICATE KEY UPDATE or IGNORE can not change a row
+func (vm verifyManager) checkExecutePermissionsAsNames(qp *dbquery.QueryParsed, pubKey []byte) (isNames bool, allow bool, err error) {
+	if namesTableName(qp.Structure.GetTable()) != lib.NamesTable {
+		return
+	}
+	// before the rule is active the table is checked as any other table
+	if !vm.config.RulesActivation.IsActive(vm.config.RulesActivation.NamesRegistry, vm.previousBlockHeigh+1) {
+		return
+	}
+	isNames = true
+
+	if qp.Structure.GetKind() == lib.QueryKindCreate {
+		allow = true
+		return
+	}
+
+	if qp.Structure.GetKind() != lib.QueryKindInsert {
+		vm.logger.Trace.Printf("Names registry can not be changed with %s", qp.Structure.GetKind())
+		return
+	}
+
+	name := qp.Structure.GetUpdateColumns()["name"]
+
+	if !utils.IsValidName(name) {
+		vm.logger.Trace.Printf("Name %s is not valid", name)
+		return
+	}
+
+	// the key and the address are in the query only if they are of the key which signed it
+	expected, err := utils.MakeRegisterNameSQL(name, pubKey)
+
+	if err != nil {
+		return
+	}
+
+	allow = qp.Structure.GetCanonicalQuery() == expected
+
+	if !allow {
+		vm.logger.Trace.Printf("Name %s can be registered only by own key with the register query", name)
+	}
+	return
+}
+
+// Name of a table without a DB and quotes. `db`.`_usernames` is same table as _usernames
+func namesTableName(table string) string {
+	table = strings.Replace(table, "`", "", -1)
+
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		table = table[i+1:]
+	}
+	return strings.TrimSpace(table)
+}
@@ -0,0 +1,74 @@
+package consensus
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+
+	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/dbquery"
+	"github.com/gelembjuk/oursql/node/dbquery/sqlparser"
+)
+
+func makeTestNamesQuery(t *testing.T, sql string) *dbquery.QueryParsed {
+	qp := &dbquery.QueryParsed{SQL: sql, Structure: sqlparser.NewSqlParser()}
+
+	if err := qp.Structure.Parse(sql); err != nil {
+		t.Fatalf("Parse %s: %s", sql, err.Error())
+	}
+	return qp
+}
+
+func TestCheckExecutePermissionsAsNames(t *testing.T) {
+	config, err := NewConfigDefault()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm := verifyManager{logger: utils.CreateLoggerStdout(), config: config}
+
+	_, key, _ := ed25519.GenerateKey(nil)
+	pubKey := utils.NewEd25519Signer(key).GetPublicKey()
+
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	otherPubKey := utils.NewEd25519Signer(otherKey).GetPublicKey()
+
+	register, err := utils.MakeRegisterNameSQL("john", pubKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, _ := utils.PubKeyToAddres(pubKey)
+	keyHex := hex.EncodeToString(pubKey)
+
+	tests := []struct {
+		name    string
+		sql     string
+		pubKey  []byte
+		isNames bool
+		allow   bool
+	}{
+		{"register", register, pubKey, true, true},
+		{"register with semicolon", register + ";", pubKey, true, true},
+		{"create", NamesTableCreateSQL, pubKey, true, true},
+		{"other key", register, otherPubKey, true, false},
+		// a registered name must not be taken with upsert or changed with a qualified table name
+		{"upsert", register + " ON DUPLICATE KEY UPDATE pubkey='" + keyHex + "', address='" + address + "'", pubKey, true, false},
+		{"update with db", "UPDATE mydb._usernames SET pubkey='" + keyHex + "', address='" + address + "' WHERE name='john'", pubKey, true, false},
+		{"update with quotes", "UPDATE `mydb`.`_usernames` SET pubkey='" + keyHex + "' WHERE name='john'", pubKey, true, false},
+		{"delete with db", "DELETE FROM mydb._usernames WHERE name='john'", pubKey, true, false},
+		{"other table", "INSERT INTO members (id, name) VALUES (1, 'john')", pubKey, false, false},
+	}
+
+	for _, test := range tests {
+		isNames, allow, err := vm.checkExecutePermissionsAsNames(makeTestNamesQuery(t, test.sql), test.pubKey)
+
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err.Error())
+		}
+
+		if isNames != test.isNames || allow != test.allow {
+			t.Fatalf("%s: names %v allow %v, expected %v %v", test.name, isNames, allow, test.isNames, test.allow)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package consensus
+
+/*
+* Limit of size of the pool of transactions of this process. New transactions are refused when the pool is full,
+* they can be sent again after a block is made. It can be changed while the node works
+ */
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/gelembjuk/oursql/lib/net"
+)
+
+// max number of unapproved transactions. 0 means no limit
+var maxPoolSize int64
+
+func SetMaxPoolSize(size int) {
+	if size < 0 {
+		size = 0
+	}
+	atomic.StoreInt64(&maxPoolSize, int64(size))
+}
+
+func GetMaxPoolSize() int {
+	return int(atomic.LoadInt64(&maxPoolSize))
+}
+
+// Returns an error if there is no room for one more transaction
+func (n *NodeBlockMaker) checkPoolRoom() error {
+	max := GetMaxPoolSize()
+
+	if max == 0 {
+		return nil
+	}
+
+	count, err := n.getTransactionsManager().GetUnapprovedCount()
+
+	if err != nil {
+		return err
+	}
+
+	if count >= max {
+		return net.NewRemoteError(net.ErrorCodePoolFull, fmt.Sprintf("Pool of transactions is full, %d transactions", count))
+	}
+	return nil
+}
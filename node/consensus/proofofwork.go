@@ -71,6 +71,11 @@ func (pow *ProofOfWork) prepareData() ([]byte, error) {
 		return nil, err
 	}
 
+	return pow.prepareDataWithRoot(txshash), nil
+}
+
+// Same data from a hash of transactions. A header of a block has it, so a header can be checked without body
+func (pow *ProofOfWork) prepareDataWithRoot(txshash []byte) []byte {
 	data := bytes.Join(
 		[][]byte{
 			pow.block.PrevBlockHash,
@@ -81,7 +86,12 @@ func (pow *ProofOfWork) prepareData() ([]byte, error) {
 		[]byte{},
 	)
 
-	return data, nil
+	return data
+}
+
+// Complexity of settings which is hashed with every block. It is sent in headers of blocks
+func HeaderComplexity(settings map[string]interface{}) int {
+	return NewProofOfWork(nil, settings).settings.Complexity
 }
 
 func (pow *ProofOfWork) addNonceToPrepared(data []byte, nonce int) []byte {
@@ -141,6 +151,22 @@ func (pow *ProofOfWork) Validate() (bool, error) {
 	return isValid, nil
 }
 
+// Validates PoW of a block header. Transactions of the block are not known, merkleRoot is a hash of them.
+// The hash must be same as the block hash
+func (pow *ProofOfWork) ValidateHeader(merkleRoot []byte) bool {
+	var hashInt big.Int
+
+	data := pow.addNonceToPrepared(pow.prepareDataWithRoot(merkleRoot), pow.block.Nonce)
+	hash := sha256.Sum256(data)
+
+	if bytes.Compare(hash[:], pow.block.Hash) != 0 {
+		return false
+	}
+	hashInt.SetBytes(hash[:])
+
+	return hashInt.Cmp(pow.target) == -1
+}
+
 //
 func (pow *ProofOfWork) GetTransactionLimitsPerBlock(h int) (min int, max int) {
 	min = h
@@ -2,7 +2,6 @@ package consensus
 
 import (
 	"bytes"
-	"crypto/ecdsa"
 	"errors"
 
 	"github.com/gelembjuk/oursql/lib"
@@ -18,11 +17,11 @@ import (
  */
 
 type queryManager struct {
-	DB      database.DBManager
-	Logger  *utils.LoggerMan
-	pubKey  []byte
-	privKey ecdsa.PrivateKey
-	config  *ConsensusConfig
+	DB     database.DBManager
+	Logger *utils.LoggerMan
+	pubKey []byte
+	signer utils.Signer
+	config *ConsensusConfig
 }
 
 type processQueryResponse struct {
@@ -30,6 +29,7 @@ type processQueryResponse struct {
 	txdata       []byte
 	stringtosign []byte
 	tx           *structures.Transaction
+	isSelect     bool
 }
 
 func (q queryManager) getQueryParser() dbquery.QueryProcessorInterface {
@@ -85,7 +85,7 @@ func (q queryManager) NewQuerySigned(txEncoded []byte, signature []byte) (*struc
 
 // execute new query and create transaction if needed . This provided private key to sign transaction if needed
 // return complete TX. it is added to the pool and query executed. if TX is nil, it means query was executed without TX
-func (q queryManager) NewQueryByNode(sql string, pubKey []byte, privKey ecdsa.PrivateKey) (uint, *structures.Transaction, error) {
+func (q queryManager) NewQueryByNode(sql string, signer utils.Signer) (uint, *structures.Transaction, error) {
 	localError := func(err error) (uint, *structures.Transaction, error) {
 		q.Logger.Trace.Printf("Return error: %s", err.Error())
 		return SQLProcessingResultError, nil, err
@@ -93,6 +93,8 @@ func (q queryManager) NewQueryByNode(sql string, pubKey []byte, privKey ecdsa.Pr
 
 	q.Logger.Trace.Printf("Execute new SQL: %s", sql)
 
+	pubKey := signer.GetPublicKey()
+
 	result, err := q.processQuery(sql, pubKey, lib.TXFlagsExecute)
 
 	if err != nil {
@@ -111,7 +113,7 @@ func (q queryManager) NewQueryByNode(sql string, pubKey []byte, privKey ecdsa.Pr
 	}
 	// sign data and continue
 	q.Logger.Trace.Printf("Sign new TX by %x", pubKey)
-	signature, err := utils.SignDataByPubKey(pubKey, privKey, result.stringtosign)
+	signature, err := utils.SignDataBySigner(signer, result.stringtosign)
 
 	if err != nil {
 		return localError(err)
@@ -127,10 +129,12 @@ func (q queryManager) NewQueryByNode(sql string, pubKey []byte, privKey ecdsa.Pr
 }
 
 // Create new transaction and add to pool. Don't execute a query.
-func (q queryManager) NewQueryByNodeInit(sql string, pubKey []byte, privKey ecdsa.PrivateKey) (tx *structures.Transaction, err error) {
+func (q queryManager) NewQueryByNodeInit(sql string, signer utils.Signer) (tx *structures.Transaction, err error) {
 
 	//q.Logger.Trace.Printf("Make new transaction for SQL: %s", sql)
 
+	pubKey := signer.GetPublicKey()
+
 	result, err := q.processQuery(sql, pubKey, 0 /*don't execute*/)
 
 	if err != nil {
@@ -142,7 +146,7 @@ func (q queryManager) NewQueryByNodeInit(sql string, pubKey []byte, privKey ecds
 		// sign data and continue
 		q.Logger.Trace.Printf("Sign new TX by %x", pubKey)
 		var signature []byte
-		signature, err = utils.SignDataByPubKey(pubKey, privKey, result.stringtosign)
+		signature, err = utils.SignDataBySigner(signer, result.stringtosign)
 
 		if err != nil {
 			return
@@ -190,6 +194,7 @@ func (q queryManager) NewQueryFromProxy(sql string) (result QueryFromProxyResult
 
 		if qpresult.status == SQLProcessingResultCanBeExecuted {
 			result.Status = 3 // pass query to server
+			result.IsSelect = qpresult.isSelect
 		} else {
 			result.ReplaceQuery = qpresult.tx.GetSQLQuery()
 		}
@@ -275,7 +280,7 @@ func (q queryManager) processQuery(sql string, pubKey []byte, flags int) (result
 	q.Logger.Trace.Println("processQuery " + sql)
 	qp := q.getQueryParser()
 	// this will get sql type and data from comments. data can be pubkey, txBytes, signature
-	qparsed, err := qp.ParseQuery(sql, 0)
+	qparsed, err := qp.ParseQuery(sql, lib.TXFlagsNewQuery)
 
 	if err != nil {
 		return
@@ -301,6 +306,8 @@ func (q queryManager) processQuery(sql string, pubKey []byte, flags int) (result
 	}
 
 	if !needsTX {
+		result.isSelect = qparsed.IsSelect()
+
 		if flags&lib.TXFlagsExecute == 0 {
 			// no need to execute query. just return
 			result.status = SQLProcessingResultCanBeExecuted
@@ -310,7 +317,7 @@ func (q queryManager) processQuery(sql string, pubKey []byte, flags int) (result
 		// no need to have TX
 		if qparsed.IsUpdate() {
 
-			_, err = qp.ExecuteQuery(qparsed.SQL)
+			_, err = qp.ExecuteQuery(qparsed.SQL, lib.TXFlagsNewQuery)
 			if err != nil {
 				return
 			}
@@ -385,7 +392,7 @@ func (q queryManager) processQuery(sql string, pubKey []byte, flags int) (result
 		q.Logger.Trace.Printf("There is pubkey to sign. Use it %x", pubKey)
 		// transaction was created by internal pubkey. we have private key for it
 		var signature []byte
-		signature, err = utils.SignDataByPubKey(q.pubKey, q.privKey, result.stringtosign)
+		signature, err = utils.SignDataBySigner(q.signer, result.stringtosign)
 		if err != nil {
 			return
 		}
@@ -473,7 +480,7 @@ func (q queryManager) tryToRepeatTransactionResigned(tx *structures.Transaction,
 			return err
 		}
 
-		signature, err := utils.SignDataByPubKey(q.pubKey, q.privKey, stringtosign)
+		signature, err := utils.SignDataBySigner(q.signer, stringtosign)
 
 		if err != nil {
 			return err
@@ -0,0 +1,67 @@
+package consensus
+
+/*
+* Count of transactions added to the pool by this process, for monitoring. A rate is an average of the last minute
+ */
+
+import (
+	"sync"
+	"time"
+)
+
+const txRateWindow = 60
+
+type txRate struct {
+	lock    sync.Mutex
+	total   int64
+	seconds [txRateWindow]int64
+	last    int64
+}
+
+var poolTransactions = &txRate{}
+
+func countPoolTransaction() {
+	poolTransactions.add(time.Now().Unix())
+}
+
+// Returns all transactions added to the pool and transactions per second in the last minute
+func GetPoolTransactionsStats() (int64, float64) {
+	return poolTransactions.get(time.Now().Unix())
+}
+
+// Clears seconds which passed after the last update
+func (r *txRate) advance(now int64) {
+	if now-r.last >= txRateWindow {
+		r.seconds = [txRateWindow]int64{}
+	} else {
+		for s := r.last + 1; s <= now; s++ {
+			r.seconds[s%txRateWindow] = 0
+		}
+	}
+	if now > r.last {
+		r.last = now
+	}
+}
+
+func (r *txRate) add(now int64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.advance(now)
+	r.seconds[now%txRateWindow]++
+	r.total++
+}
+
+func (r *txRate) get(now int64) (int64, float64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.advance(now)
+
+	count := int64(0)
+
+	for _, c := range r.seconds {
+		count += c
+	}
+	return r.total, float64(count) / txRateWindow
+}
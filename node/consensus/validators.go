@@ -0,0 +1,59 @@
+package consensus
+
+import (
+	"encoding/hex"
+
+	"github.com/gelembjuk/oursql/lib/txvalidation"
+	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/dbquery"
+	"github.com/gelembjuk/oursql/node/structures"
+)
+
+// Calls validators registered by operators of the node. It is done last, when all rules of the consensus passed
+func (n NodeBlockMaker) verifyTransactionCustom(tx *structures.Transaction, qparsed *dbquery.QueryParsed, stage string, prevBlockHeight int) error {
+	if prevBlockHeight < 0 {
+		_, height, err := n.getBlockchainManager().GetState()
+
+		if err != nil {
+			return err
+		}
+		prevBlockHeight = height
+	}
+
+	request := txvalidation.Request{}
+	request.Stage = stage
+	request.ID = hex.EncodeToString(tx.GetID())
+	request.Time = tx.GetTime()
+	request.PubKey = hex.EncodeToString(tx.ByPubKey)
+	request.BlockHeight = prevBlockHeight + 1
+
+	switch {
+	case tx.IsCoinbaseTransfer():
+		request.Type = txvalidation.TypeCoinbase
+	case tx.IsSQLCommand():
+		request.Type = txvalidation.TypeSQL
+	default:
+		request.Type = txvalidation.TypeCurrency
+	}
+
+	if len(tx.ByPubKey) > 0 {
+		request.Signer, _ = utils.PubKeyToAddres(tx.ByPubKey)
+	}
+
+	for _, out := range tx.Vout {
+		address, _ := utils.PubKeyHashToAddres(out.PubKeyHash)
+		request.Outputs = append(request.Outputs, txvalidation.Output{Address: address, Value: out.Value})
+	}
+
+	if tx.IsSQLCommand() {
+		request.Query = tx.GetSQLQuery()
+		request.ReferenceID = string(tx.SQLCommand.ReferenceID)
+
+		if qparsed != nil && qparsed.Structure != nil {
+			request.QueryKind = qparsed.Structure.GetKind()
+			request.Table = qparsed.Structure.GetTable()
+		}
+	}
+
+	return txvalidation.Validate(request)
+}
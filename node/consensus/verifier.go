@@ -24,6 +24,16 @@ func (vm verifyManager) CheckExecutePermissions(qp *dbquery.QueryParsed, pubKey
 		return true, nil
 	}
 
+	isNames, allow, err := vm.checkExecutePermissionsAsNames(qp, pubKey)
+
+	if err != nil {
+		return false, err
+	}
+
+	if isNames {
+		return allow, nil
+	}
+
 	hasCustom, allow, err := vm.checkExecutePermissionsAsTable(qp, pubKey)
 
 	if err != nil {
@@ -50,6 +60,12 @@ func (vm verifyManager) CheckExecutePermissions(qp *dbquery.QueryParsed, pubKey
 		}
 	}
 
+	if qp.Structure.GetKind() == lib.QueryKindAlter {
+		if !vm.config.AllowTableAlter {
+			return false, nil
+		}
+	}
+
 	if qp.Structure.GetKind() == lib.QueryKindDelete {
 		if !vm.config.AllowRowDelete {
 			return false, nil
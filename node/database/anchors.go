@@ -0,0 +1,194 @@
+package database
+
+/*
+* Anchors of blocks published to an external blockchain. A record has a block hash and a reference
+* in the external chain (transaction ID). Records are not changed by reindex, they are not made from blocks
+ */
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"strconv"
+	"sync"
+)
+
+const anchorsTable = "anchors"
+
+var (
+	anchorsReady     = map[string]bool{}
+	anchorsReadyLock sync.Mutex
+)
+
+type Anchor struct {
+	ID          int64
+	BlockHash   []byte
+	BlockHeight int
+	Adapter     string // bitcoin, ethereum or command
+	Reference   string // ID of a transaction in the external chain
+	Time        int64
+}
+
+type Anchors struct {
+	DB           *MySQLDB
+	anchorsTable string
+}
+
+func (an *Anchors) getTableName() string {
+	if an.anchorsTable == "" {
+		an.anchorsTable = an.DB.tablesPrefix + anchorsTable
+	}
+	return an.anchorsTable
+}
+
+// Init DB. The table is created also on first use, a node DB can be created before anchoring existed
+func (an *Anchors) InitDB() error {
+	table := an.getTableName()
+
+	id := "id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY"
+
+	if an.DB.sqlite {
+		id = "id INTEGER PRIMARY KEY AUTOINCREMENT"
+	}
+
+	_, err := an.DB.exec("CREATE TABLE IF NOT EXISTS " + table + " (" + id + ", " +
+		"block_hash VARCHAR(64) NOT NULL, " +
+		"block_height INT NOT NULL, " +
+		"adapter VARCHAR(20) NOT NULL, " +
+		"reference VARCHAR(255) NOT NULL, " +
+		"time BIGINT NOT NULL)")
+
+	if err != nil {
+		return err
+	}
+
+	anchorsReadyLock.Lock()
+	anchorsReady[table] = true
+	anchorsReadyLock.Unlock()
+
+	return nil
+}
+
+func (an *Anchors) checkTable() error {
+	anchorsReadyLock.Lock()
+	ready := anchorsReady[an.getTableName()]
+	anchorsReadyLock.Unlock()
+
+	if ready {
+		return nil
+	}
+	return an.InitDB()
+}
+
+// Saves new anchor. Returns its ID
+func (an *Anchors) AddAnchor(anchor Anchor) (int64, error) {
+	err := an.checkTable()
+
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := an.DB.exec("INSERT INTO "+an.getTableName()+
+		" (block_hash, block_height, adapter, reference, time) VALUES (?, ?, ?, ?, ?)",
+		hex.EncodeToString(anchor.BlockHash), anchor.BlockHeight, anchor.Adapter, anchor.Reference, anchor.Time)
+
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// Returns anchors from the last one
+func (an *Anchors) GetAnchors(limit int, offset int) ([]Anchor, error) {
+	err := an.checkTable()
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := takePoolConnection(an.DB.db)
+
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(context.Background(), "SELECT id, block_hash, block_height, adapter, reference, time FROM "+
+		an.getTableName()+" ORDER BY id DESC LIMIT "+strconv.Itoa(limit)+" OFFSET "+strconv.Itoa(offset))
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	anchors := []Anchor{}
+
+	for rows.Next() {
+		a, err := an.scanAnchor(rows)
+
+		if err != nil {
+			return nil, err
+		}
+		anchors = append(anchors, a)
+	}
+	return anchors, rows.Err()
+}
+
+// Returns nil if there is no such anchor
+func (an *Anchors) GetAnchor(id int64) (*Anchor, error) {
+	err := an.checkTable()
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := takePoolConnection(an.DB.db)
+
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(context.Background(), "SELECT id, block_hash, block_height, adapter, reference, time FROM "+
+		an.getTableName()+" WHERE id = ?", id)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	a, err := an.scanAnchor(rows)
+
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (an *Anchors) scanAnchor(rows *sql.Rows) (Anchor, error) {
+	var a Anchor
+	var blockHash string
+
+	err := rows.Scan(&a.ID, &blockHash, &a.BlockHeight, &a.Adapter, &a.Reference, &a.Time)
+
+	if err != nil {
+		return a, err
+	}
+
+	a.BlockHash, _ = hex.DecodeString(blockHash)
+
+	return a, nil
+}
+
+func (an *Anchors) GetCount() (int, error) {
+	err := an.checkTable()
+
+	if err != nil {
+		return 0, err
+	}
+	return an.DB.getCountInTable(an.getTableName())
+}
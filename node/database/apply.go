@@ -0,0 +1,432 @@
+package database
+
+/*
+* Execution of SQL queries of blocks and transactions from other nodes.
+* Such queries are executed with fixed session settings, so local SELECT load (locking reads,
+* long queries holding metadata locks) can not stall block application forever.
+* Deadlocks and lock wait timeouts are retried until a query is done, with growing delays,
+* so a block never fails on one node because of local load
+ */
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Isolation levels allowed in config
+const (
+	IsolationReadUncommitted = "READ-UNCOMMITTED"
+	IsolationReadCommitted   = "READ-COMMITTED"
+	IsolationRepeatableRead  = "REPEATABLE-READ"
+	IsolationSerializable    = "SERIALIZABLE"
+)
+
+// What to do when a query of a block is killed by timeout
+const (
+	ApplyTimeoutFail  = "fail"
+	ApplyTimeoutRetry = "retry"
+)
+
+// Defaults if config has no options
+const (
+	defaultApplyIsolation       = IsolationReadCommitted
+	defaultApplyLockWaitTimeout = 10 // seconds
+	// delay before first retry after a deadlock, it doubles for next retries
+	applyRetryDelay    = 200 * time.Millisecond
+	applyMaxRetryDelay = 10 * time.Second
+	// a query still failing with deadlocks is written to the error log every N retries
+	applyRetryReport = 10
+	// retries of a query killed by timeout with the retry policy
+	applyTimeoutRetries = 3
+	// wait for the DB server if it is not available while a block is applied
+	applyReconnectWait     = 2 * time.Minute
+	applyReconnectAttempts = 3
+)
+
+// MySQL errors when a query can be executed again
+const (
+	mysqlErrLockWaitTimeout = 1205
+	mysqlErrDeadlock        = 1213
+)
+
+// Settings used to apply queries of blocks. It is returned in a node state
+type ApplySettings struct {
+	Isolation        string
+	LockWaitTimeout  int
+	StatementTimeout int
+	TimeoutPolicy    string
+	ShadowApply      bool
+}
+
+func (s ApplySettings) String() string {
+	info := fmt.Sprintf("isolation %s, lock wait timeout %d sec", s.Isolation, s.LockWaitTimeout)
+
+	if s.StatementTimeout > 0 {
+		info = info + fmt.Sprintf(", query timeout %d sec (%s)", s.StatementTimeout, s.TimeoutPolicy)
+	}
+
+	if s.ShadowApply {
+		info = info + ", shadow apply"
+	}
+	return info
+}
+
+// Returns settings from config with defaults for missed options
+func (dbc *DatabaseConfig) GetApplySettings() (ApplySettings, error) {
+	s := ApplySettings{dbc.ApplyIsolation, dbc.ApplyLockWaitTimeout, dbc.ApplyStatementTimeout, dbc.ApplyTimeoutPolicy, dbc.ShadowApply}
+
+	if s.Isolation == "" {
+		s.Isolation = defaultApplyIsolation
+	}
+	// both forms are accepted, READ COMMITTED and READ-COMMITTED
+	s.Isolation = strings.Replace(strings.ToUpper(strings.TrimSpace(s.Isolation)), " ", "-", -1)
+
+	switch s.Isolation {
+	case IsolationReadUncommitted, IsolationReadCommitted, IsolationRepeatableRead, IsolationSerializable:
+	default:
+		return s, errors.New(fmt.Sprintf("Unknown isolation level %s", dbc.ApplyIsolation))
+	}
+
+	if s.LockWaitTimeout == 0 {
+		s.LockWaitTimeout = defaultApplyLockWaitTimeout
+	}
+
+	if s.LockWaitTimeout < 0 {
+		return s, errors.New("Lock wait timeout can not be negative")
+	}
+
+	if s.StatementTimeout < 0 {
+		return s, errors.New("Query timeout can not be negative")
+	}
+
+	if s.TimeoutPolicy == "" {
+		s.TimeoutPolicy = ApplyTimeoutFail
+	}
+
+	if s.TimeoutPolicy != ApplyTimeoutFail && s.TimeoutPolicy != ApplyTimeoutRetry {
+		return s, errors.New(fmt.Sprintf("Unknown timeout policy %s", s.TimeoutPolicy))
+	}
+	return s, nil
+}
+
+func (bdm MySQLDBManager) GetApplySettings() (ApplySettings, error) {
+	return bdm.Config.GetApplySettings()
+}
+
+// Name of session variable of isolation level. It was renamed in MySQL 5.7.20 and MariaDB 11.1
+func isolationVariable(v ServerVersion) string {
+	if v.IsMariaDB() && v.AtLeast(11, 1) {
+		return "transaction_isolation"
+	}
+	if v.IsMySQL() && (v.AtLeast(8, 0) || v.Major == 5 && v.Minor == 7 && v.Patch >= 20) {
+		return "transaction_isolation"
+	}
+	return "tx_isolation"
+}
+
+// Deadlock and lock wait timeout roll back the statement (in autocommit mode), it is safe to execute it again
+func isRetryableError(err error) bool {
+	mysqlErr, ok := err.(*mysql.MySQLError)
+
+	if !ok {
+		return false
+	}
+	return mysqlErr.Number == mysqlErrDeadlock || mysqlErr.Number == mysqlErrLockWaitTimeout
+}
+
+// Executes a query of a block or a TX from other node. If the DB server is not available
+// before the query is sent, it waits while the server is back and executes the query then
+func (bdm MySQLDBManager) ExecuteSQLApply(sql string) error {
+	span := bdm.startSpan("db apply", sql)
+
+	_, err := bdm.executeSQLApply([]string{sql})
+
+	span.End(err)
+
+	return err
+}
+
+// Executes queries of a block in order in one session, so session settings are set once for a block.
+// Returns index of a failed query, -1 if the error is not related to some query. Queries before
+// the failed one stay executed
+func (bdm MySQLDBManager) ExecuteSQLApplyList(queries []string) (int, error) {
+	span := bdm.startSpan("db apply", "")
+	span.SetAttribute("db.queries", len(queries))
+
+	failed, err := bdm.executeSQLApply(queries)
+
+	span.End(err)
+
+	return failed, err
+}
+
+func (bdm MySQLDBManager) executeSQLApply(queries []string) (int, error) {
+	settings, err := bdm.Config.GetApplySettings()
+
+	if err != nil {
+		return -1, err
+	}
+
+	if len(queries) == 0 {
+		return -1, nil
+	}
+
+	if bdm.Config.IsSQLite() {
+		// single connection, there are no concurrent locks. Long query is interrupted by the driver
+		conn, err := bdm.takeConnection()
+
+		if err != nil {
+			return -1, err
+		}
+		defer conn.Close()
+
+		for i, sql := range queries {
+			if _, err = bdm.execWithTimeout(conn, sql, settings.StatementTimeout, 0); err != nil {
+				return i, err
+			}
+		}
+		return -1, nil
+	}
+
+	version, err := bdm.ExecuteSQLServerVersion()
+
+	if err != nil {
+		return -1, err
+	}
+
+	timeouts := 0
+	// queries executed already
+	done := 0
+
+	for attempt := 0; ; attempt++ {
+		session, notSent, err := bdm.openApplySession(settings, version)
+
+		if err == nil {
+			var executed int
+
+			executed, notSent, err = bdm.applyQueries(session, queries[done:], settings)
+
+			session.close()
+
+			done += executed
+
+			if err == nil {
+				return -1, nil
+			}
+
+			if executed > 0 {
+				// the connection was fine before
+				attempt = 0
+			}
+		} else if !notSent {
+			return -1, err
+		}
+
+		if isTimeoutError(err) && settings.TimeoutPolicy == ApplyTimeoutRetry && timeouts < applyTimeoutRetries {
+			timeouts++
+
+			bdm.Logger.Trace.Printf("%s. Retry %d of %d", err.Error(), timeouts, applyTimeoutRetries)
+
+			time.Sleep(time.Duration(timeouts) * applyRetryDelay)
+			continue
+		}
+
+		if !notSent {
+			return done, err
+		}
+
+		if attempt == 0 {
+			// can be old connection of the pool, broken after the server restart. Next time a new one is made
+			continue
+		}
+
+		if attempt > applyReconnectAttempts {
+			return -1, err
+		}
+
+		bdm.Logger.Error.Printf("Can not apply a query, no connection: %s. Wait for the DB server", err.Error())
+
+		err = bdm.waitServerAvailable(applyReconnectWait)
+
+		if err != nil {
+			return -1, err
+		}
+	}
+}
+
+// Connection with session settings to apply queries
+type applySession struct {
+	conn    *sql.Conn
+	connID  int64
+	version ServerVersion
+}
+
+// Takes a connection and sets apply settings. notSent is true if it failed because of a connection error
+func (bdm MySQLDBManager) openApplySession(settings ApplySettings, version ServerVersion) (session *applySession, notSent bool, err error) {
+	db, err := bdm.getConnection()
+
+	if err != nil {
+		return
+	}
+
+	conn, err := takePoolConnection(db)
+
+	if err != nil {
+		// any error here is a connection error, queries are not sent yet.
+		// Timeout means all connections are busy, the server is fine
+		notSent = !isTimeoutError(err)
+		return
+	}
+
+	session = &applySession{conn: conn, version: version}
+
+	if settings.StatementTimeout > 0 {
+		// to kill a query of this connection
+		err = conn.QueryRowContext(context.Background(), "SELECT CONNECTION_ID()").Scan(&session.connID)
+
+		if err != nil {
+			_, isServerError := err.(*mysql.MySQLError)
+			notSent = !isServerError
+		}
+	}
+
+	if err == nil {
+		notSent, err = prepareApplySession(conn, settings, version)
+	}
+
+	if err != nil {
+		conn.Close()
+		session = nil
+	}
+	return
+}
+
+// Sets session variables back before the connection returns to the pool
+func (s *applySession) close() {
+	resetApplySession(s.conn, s.version)
+	s.conn.Close()
+}
+
+// Executes queries on a session. Returns number of executed queries, notSent is true if a query failed
+// because of a connection error. Deadlocks and lock wait timeouts come from local load, not from a query,
+// such query is executed again until it is done, so local load can't make a block fail on one node only
+func (bdm MySQLDBManager) applyQueries(session *applySession, queries []string, settings ApplySettings) (executed int, notSent bool, err error) {
+	for i, sql := range queries {
+		for attempt := 1; ; attempt++ {
+			_, err = bdm.execWithTimeout(session.conn, sql, settings.StatementTimeout, session.connID)
+
+			if isConnectionError(err) {
+				return i, true, err
+			}
+
+			if err == nil || !isRetryableError(err) {
+				break
+			}
+
+			if attempt%applyRetryReport == 0 {
+				bdm.Logger.Error.Printf("Apply query failed %d times: %s. Query: %s", attempt, err.Error(), sql)
+			} else {
+				bdm.Logger.Trace.Printf("Apply query failed: %s. Retry %d", err.Error(), attempt)
+			}
+
+			time.Sleep(applyRetryBackoff(attempt))
+		}
+
+		if err != nil {
+			return i, false, err
+		}
+	}
+	return len(queries), false, nil
+}
+
+// Delay before retry N after a deadlock. It doubles every retry up to applyMaxRetryDelay
+func applyRetryBackoff(attempt int) time.Duration {
+	delay := applyRetryDelay
+
+	for i := 1; i < attempt && delay < applyMaxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > applyMaxRetryDelay {
+		delay = applyMaxRetryDelay
+	}
+	return delay
+}
+
+// Sets session variables of a connection to apply queries
+func prepareApplySession(conn *sql.Conn, settings ApplySettings, version ServerVersion) (notSent bool, err error) {
+	session := []string{
+		fmt.Sprintf("SET SESSION %s = '%s'", isolationVariable(version), settings.Isolation),
+		fmt.Sprintf("SET SESSION innodb_lock_wait_timeout = %d", settings.LockWaitTimeout),
+		// metadata locks. ALTER waits for it while a long SELECT reads the table
+		fmt.Sprintf("SET SESSION lock_wait_timeout = %d", settings.LockWaitTimeout),
+	}
+
+	for _, q := range session {
+		_, err = conn.ExecContext(context.Background(), q)
+
+		if err != nil {
+			_, isServerError := err.(*mysql.MySQLError)
+			notSent = !isServerError
+			err = errors.New(fmt.Sprintf("Can not prepare session to apply a query: %s", err.Error()))
+			return
+		}
+	}
+	return
+}
+
+func resetApplySession(conn *sql.Conn, version ServerVersion) {
+	conn.ExecContext(context.Background(), "SET SESSION "+isolationVariable(version)+" = DEFAULT, innodb_lock_wait_timeout = DEFAULT, lock_wait_timeout = DEFAULT")
+}
+
+// sql.DB, sql.Conn or sql.Tx
+type queryExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Executes a query. If it is not done in timeout seconds, it is stopped and killed on the server
+func (bdm MySQLDBManager) execWithTimeout(executor queryExecutor, query string, timeout int, connID int64) (sql.Result, error) {
+	if timeout == 0 {
+		return executor.ExecContext(context.Background(), query)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	result, err := executor.ExecContext(ctx, query)
+
+	if err == nil || ctx.Err() != context.DeadlineExceeded {
+		return result, err
+	}
+
+	if connID > 0 {
+		// MySQL driver only closes the connection, the query continues to work on the server
+		bdm.killQuery(connID)
+	}
+	return nil, NewTimeoutDBError(fmt.Sprintf("Query is stopped after %d seconds", timeout))
+}
+
+func (bdm MySQLDBManager) killQuery(connID int64) {
+	conn, err := bdm.takeConnection()
+
+	if err == nil {
+		_, err = conn.ExecContext(context.Background(), fmt.Sprintf("KILL QUERY %d", connID))
+		conn.Close()
+	}
+
+	if err != nil {
+		bdm.Logger.Error.Printf("Can not kill query of connection %d: %s", connID, err.Error())
+	}
+}
+
+func isTimeoutError(err error) bool {
+	dberr, ok := err.(*DBError)
+
+	return ok && dberr.IsKind(DBTimeoutError)
+}
@@ -0,0 +1,149 @@
+package database
+
+/*
+* Audit log of SQL applied from the blockchain. It is a usual table with a row per transaction, so a DBA can find
+* who (public key and address of a signer) and when (block and transaction time) changed a row.
+* Records of a block are removed when the block is canceled
+ */
+
+import (
+	"encoding/hex"
+	"sync"
+)
+
+const auditLogTable = "auditlog"
+
+var (
+	auditLogReady     = map[string]bool{}
+	auditLogReadyLock sync.Mutex
+)
+
+type AuditRecord struct {
+	TXID        []byte
+	BlockHash   []byte
+	BlockHeight int
+	BlockTime   int64 // seconds
+	TXTime      int64 // nanoseconds, as in a transaction
+	PubKey      []byte
+	Address     string
+	RefID       string
+	Query       string
+}
+
+type AuditLog struct {
+	DB            *MySQLDB
+	auditLogTable string
+}
+
+func (al *AuditLog) getTableName() string {
+	if al.auditLogTable == "" {
+		al.auditLogTable = al.DB.tablesPrefix + auditLogTable
+	}
+	return al.auditLogTable
+}
+
+// Init DB. The table is created also on first write, a node DB can be created before the log existed
+func (al *AuditLog) InitDB() error {
+	table := al.getTableName()
+
+	keys := ", KEY ref_id (ref_id), KEY block_height (block_height)"
+
+	if al.DB.sqlite {
+		keys = ""
+	}
+
+	_, err := al.DB.exec("CREATE TABLE IF NOT EXISTS " + table + " (" +
+		"txid VARCHAR(64) NOT NULL PRIMARY KEY, " +
+		"block_hash VARCHAR(64) NOT NULL, " +
+		"block_height INT NOT NULL, " +
+		"block_time BIGINT NOT NULL, " +
+		"tx_time BIGINT NOT NULL, " +
+		"pubkey VARCHAR(300) NOT NULL, " +
+		"address VARCHAR(100) NOT NULL, " +
+		"ref_id VARCHAR(255) NOT NULL, " +
+		"sql_query TEXT NOT NULL" + keys + ")")
+
+	if err != nil {
+		return err
+	}
+
+	if al.DB.sqlite {
+		for _, col := range []string{"ref_id", "block_height"} {
+			_, err = al.DB.exec("CREATE INDEX IF NOT EXISTS " + table + "_" + col + " ON " + table + " (" + col + ")")
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	auditLogReadyLock.Lock()
+	auditLogReady[table] = true
+	auditLogReadyLock.Unlock()
+
+	return nil
+}
+
+func (al *AuditLog) checkTable() error {
+	auditLogReadyLock.Lock()
+	ready := auditLogReady[al.getTableName()]
+	auditLogReadyLock.Unlock()
+
+	if ready {
+		return nil
+	}
+	return al.InitDB()
+}
+
+func (al *AuditLog) TruncateDB() error {
+	err := al.checkTable()
+
+	if err != nil {
+		return err
+	}
+	return al.DB.Truncate(al.getTableName())
+}
+
+// Saves records of a block. A record of same transaction is replaced
+func (al *AuditLog) AddRecords(records []AuditRecord) error {
+	err := al.checkTable()
+
+	if err != nil {
+		return err
+	}
+
+	sqlq := "REPLACE INTO " + al.getTableName() +
+		" (txid, block_hash, block_height, block_time, tx_time, pubkey, address, ref_id, sql_query) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+	for _, r := range records {
+		_, err = al.DB.exec(sqlq, hex.EncodeToString(r.TXID), hex.EncodeToString(r.BlockHash), r.BlockHeight,
+			r.BlockTime, r.TXTime, hex.EncodeToString(r.PubKey), r.Address, r.RefID, r.Query)
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Removes records of a canceled block
+func (al *AuditLog) DeleteBlockRecords(blockHash []byte) error {
+	err := al.checkTable()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = al.DB.exec("DELETE FROM "+al.getTableName()+" WHERE block_hash = ?", hex.EncodeToString(blockHash))
+
+	return err
+}
+
+func (al *AuditLog) GetCount() (int, error) {
+	err := al.checkTable()
+
+	if err != nil {
+		return 0, err
+	}
+	return al.DB.getCountInTable(al.getTableName())
+}
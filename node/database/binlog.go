@@ -0,0 +1,98 @@
+package database
+
+/*
+* Reading of MySQL binary log with SQL. It is used to find changes done directly in the DB, not by the node
+ */
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Event of MySQL binary log. Info contains SQL of a statement for Query and Rows_query events
+type BinlogEvent struct {
+	LogName   string
+	Pos       uint64
+	EventType string
+	EndLogPos uint64
+	Info      string
+}
+
+// Current position of the binary log. It is the end of the last file
+func (bdm MySQLDBManager) ExecuteSQLBinlogPosition() (string, uint64, error) {
+	if bdm.Config.IsSQLite() {
+		return "", 0, errors.New("SQLite has no binary log")
+	}
+
+	row, err := bdm.ExecuteSQLSelectRow("SHOW MASTER STATUS")
+
+	if err != nil {
+		// the command was renamed in MySQL 8.4
+		row, err = bdm.ExecuteSQLSelectRow("SHOW BINARY LOG STATUS")
+	}
+
+	if err != nil {
+		return "", 0, errors.New(fmt.Sprintf("Can not get binary log status. Is binary log enabled? %s", err.Error()))
+	}
+
+	pos, err := strconv.ParseUint(row["Position"], 10, 64)
+
+	if err != nil {
+		return "", 0, err
+	}
+	return row["File"], pos, nil
+}
+
+// Events of the binary log starting from a position
+func (bdm MySQLDBManager) ExecuteSQLBinlogEvents(file string, pos uint64, limit int) ([]BinlogEvent, error) {
+	if bdm.Config.IsSQLite() {
+		return nil, errors.New("SQLite has no binary log")
+	}
+
+	rows, err := bdm.ExecuteSQLSelectRows(fmt.Sprintf("SHOW BINLOG EVENTS IN %s FROM %d LIMIT %d", bdm.GetQuoter().Literal(file), pos, limit))
+
+	if err != nil {
+		return nil, err
+	}
+
+	events := []BinlogEvent{}
+
+	for _, row := range rows {
+		e := BinlogEvent{LogName: row["Log_name"], EventType: row["Event_type"], Info: row["Info"]}
+
+		e.Pos, _ = strconv.ParseUint(row["Pos"], 10, 64)
+		e.EndLogPos, _ = strconv.ParseUint(row["End_log_pos"], 10, 64)
+
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// Tables of a node (blocks, transactions etc). They are changed by the node directly, not with transactions
+func (dbc *DatabaseConfig) IsNodeTable(table string) bool {
+	table = strings.ToLower(table)
+
+	for _, t := range []string{blocksTable, blockChainTable, dataReferencesTable, nodesTable,
+		transactionsTable, transactionsOutputsTable, unapprovedTransactionsTable, unspentTransactionsTable, auditLogTable, changeLogTable, anchorsTable} {
+
+		if table == strings.ToLower(dbc.TablesPrefix+t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tables of a node with the blockchain and data of applied transactions. Other tables of a node are local,
+// like known nodes and the pool of transactions
+func (dbc *DatabaseConfig) ChainTables() []string {
+	tables := []string{}
+
+	for _, t := range []string{blocksTable, blockChainTable, transactionsTable, transactionsOutputsTable,
+		unspentTransactionsTable, dataReferencesTable} {
+
+		tables = append(tables, dbc.TablesPrefix+t)
+	}
+	return tables
+}
@@ -0,0 +1,176 @@
+package database
+
+/*
+* Log of data changes for external indexers. Every SQL transaction of a block in the primary chain makes an event
+* with a table, a row key and an operation. Records are never changed, when a block is canceled
+* new events of its transactions are added with canceled flag. ID of an event is a cursor to continue reading
+ */
+
+import (
+	"context"
+	"encoding/hex"
+	"strconv"
+	"sync"
+)
+
+const changeLogTable = "changelog"
+
+var (
+	changeLogReady     = map[string]bool{}
+	changeLogReadyLock sync.Mutex
+)
+
+type ChangeEvent struct {
+	ID          int64
+	Table       string
+	Key         string // empty for operations with a table, like CREATE
+	Operation   string // insert, update, delete, create, alter, drop
+	TXID        []byte
+	BlockHash   []byte
+	BlockHeight int
+	Canceled    bool // the transaction was in a block removed from the primary chain
+}
+
+type ChangeLog struct {
+	DB             *MySQLDB
+	changeLogTable string
+}
+
+func (cl *ChangeLog) getTableName() string {
+	if cl.changeLogTable == "" {
+		cl.changeLogTable = cl.DB.tablesPrefix + changeLogTable
+	}
+	return cl.changeLogTable
+}
+
+// Init DB. The table is created also on first write, a node DB can be created before the log existed
+func (cl *ChangeLog) InitDB() error {
+	table := cl.getTableName()
+
+	id := "id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY"
+
+	if cl.DB.sqlite {
+		id = "id INTEGER PRIMARY KEY AUTOINCREMENT"
+	}
+
+	_, err := cl.DB.exec("CREATE TABLE IF NOT EXISTS " + table + " (" + id + ", " +
+		"table_name VARCHAR(255) NOT NULL, " +
+		"row_key VARCHAR(255) NOT NULL, " +
+		"operation VARCHAR(10) NOT NULL, " +
+		"txid VARCHAR(64) NOT NULL, " +
+		"block_hash VARCHAR(64) NOT NULL, " +
+		"block_height INT NOT NULL, " +
+		"canceled TINYINT NOT NULL)")
+
+	if err != nil {
+		return err
+	}
+
+	changeLogReadyLock.Lock()
+	changeLogReady[table] = true
+	changeLogReadyLock.Unlock()
+
+	return nil
+}
+
+func (cl *ChangeLog) checkTable() error {
+	changeLogReadyLock.Lock()
+	ready := changeLogReady[cl.getTableName()]
+	changeLogReadyLock.Unlock()
+
+	if ready {
+		return nil
+	}
+	return cl.InitDB()
+}
+
+func (cl *ChangeLog) TruncateDB() error {
+	err := cl.checkTable()
+
+	if err != nil {
+		return err
+	}
+	return cl.DB.Truncate(cl.getTableName())
+}
+
+// Appends events. They get IDs in same order
+func (cl *ChangeLog) AddEvents(events []ChangeEvent) error {
+	err := cl.checkTable()
+
+	if err != nil {
+		return err
+	}
+
+	sqlq := "INSERT INTO " + cl.getTableName() +
+		" (table_name, row_key, operation, txid, block_hash, block_height, canceled) VALUES (?, ?, ?, ?, ?, ?, ?)"
+
+	for _, e := range events {
+		canceled := 0
+
+		if e.Canceled {
+			canceled = 1
+		}
+
+		_, err = cl.DB.exec(sqlq, e.Table, e.Key, e.Operation, hex.EncodeToString(e.TXID),
+			hex.EncodeToString(e.BlockHash), e.BlockHeight, canceled)
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns events with ID greater than the cursor, not more than limit
+func (cl *ChangeLog) GetEvents(after int64, limit int) ([]ChangeEvent, error) {
+	err := cl.checkTable()
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := takePoolConnection(cl.DB.db)
+
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(context.Background(), "SELECT id, table_name, row_key, operation, txid, block_hash, block_height, canceled FROM "+
+		cl.getTableName()+" WHERE id > ? ORDER BY id LIMIT "+strconv.Itoa(limit), after)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []ChangeEvent{}
+
+	for rows.Next() {
+		var e ChangeEvent
+		var txID, blockHash string
+		var canceled int
+
+		err = rows.Scan(&e.ID, &e.Table, &e.Key, &e.Operation, &txID, &blockHash, &e.BlockHeight, &canceled)
+
+		if err != nil {
+			return nil, err
+		}
+
+		e.TXID, _ = hex.DecodeString(txID)
+		e.BlockHash, _ = hex.DecodeString(blockHash)
+		e.Canceled = canceled > 0
+
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (cl *ChangeLog) GetCount() (int, error) {
+	err := cl.checkTable()
+
+	if err != nil {
+		return 0, err
+	}
+	return cl.DB.getCountInTable(cl.getTableName())
+}
@@ -1,10 +1,46 @@
 package database
 
 import (
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"sort"
 	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Database engines
+const (
+	DriverMySQL  = "mysql"
+	DriverSQLite = "sqlite"
 )
 
+// TLS modes of MySQL connection. Other values (true, false, skip-verify, preferred)
+// are passed to the driver as is
+const (
+	TLSModeCustom = "custom" // use CA and client certificates from config
+)
+
+// Name of TLS config registered in the MySQL driver for custom certificates
+const tlsConfigName = "oursql"
+
+// Name of a server public key registered in the MySQL driver
+const serverPubKeyName = "oursql"
+
+// Charset of connections if it is not set in params. utf8 is used if a server doesn't support utf8mb4
+const defaultCharset = "utf8mb4,utf8"
+
 type DatabaseConfig struct {
+	// DB engine. mysql (default) or sqlite
+	Driver string
+	// Path to a file of SQLite database
+	SQLiteFile   string
 	MysqlHost    string
 	MysqlPort    int
 	MysqlSocket  string
@@ -12,32 +48,249 @@ type DatabaseConfig struct {
 	DbUser       string
 	DbPassword   string
 	TablesPrefix string
+	// Full DSN of a connection. If it is set then options above are not used to connect
+	DSN string
+	// TLS mode. Empty is no TLS
+	TLSMode       string
+	TLSCAFile     string
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSServerName string
+	// RSA public key of the server in PEM file. It is used by caching_sha2_password and sha256_password
+	// auth without TLS. If it is not set, the key is requested from the server
+	ServerPubKeyFile string
+	// Any other DSN parameters. For example, charset or timeout
+	Params map[string]string
+	// Connections pool. Lifetime and wait timeout are in seconds. 0 means default
+	PoolMaxOpenConns    int
+	PoolMaxIdleConns    int
+	PoolConnMaxLifetime int
+	PoolWaitTimeout     int
+	// DSN of read-only replicas. SELECT queries from the proxy are executed there
+	ReadReplicas []string
+	// Max number of SELECT results cached by the proxy. 0 disables the cache
+	QueryCacheSize int
+	// Session settings to execute queries of blocks. Lock wait timeout is in seconds.
+	// 0 or empty means default. Deadlocks are retried until a query is done
+	ApplyIsolation       string
+	ApplyLockWaitTimeout int
+	// Max seconds of one query of a block, 0 is no limit. A query is killed after it.
+	// Policy is fail (default, the block is not applied) or retry (executed again 3 times)
+	ApplyStatementTimeout int
+	ApplyTimeoutPolicy    string
+	// Queries of a block are executed first in a transaction which is rolled back.
+	// The block is applied only if all queries are fine there
+	ShadowApply bool
+	// Seconds between checks of the DB server. 0 means default, -1 disables checks
+	HealthCheckInterval int
+}
+
+// SQLite is used instead of MySQL server
+func (dbc *DatabaseConfig) IsSQLite() bool {
+	return dbc.Driver == DriverSQLite
+}
+
+// There are replicas to execute SELECT queries. Not used with SQLite
+func (dbc *DatabaseConfig) HasReadReplicas() bool {
+	return len(dbc.ReadReplicas) > 0 && !dbc.IsSQLite()
 }
 
 func (dbc *DatabaseConfig) HasMinimum() bool {
+	if dbc.IsSQLite() {
+		return dbc.SQLiteFile != ""
+	}
+	if dbc.DSN != "" {
+		return true
+	}
 	if (dbc.MysqlHost == "" || dbc.MysqlPort == 0) && dbc.MysqlSocket == "" || dbc.DatabaseName == "" {
 		return false
 	}
 	return true
 }
 
+// Address of MySQL server. It is empty for SQLite, there is no server to proxy queries to
 func (dbc *DatabaseConfig) GetServerAddress() string {
+	if dbc.IsSQLite() {
+		return ""
+	}
+	if dbc.DSN != "" {
+		cfg, err := mysql.ParseDSN(dbc.DSN)
+
+		if err == nil {
+			return cfg.Addr
+		}
+	}
 	if dbc.MysqlSocket != "" {
 		return dbc.MysqlSocket
 	}
 	return dbc.MysqlHost + ":" + strconv.Itoa(dbc.MysqlPort)
 }
 
+// Identifies a database. Nodes with same ID work with same tables
+func (dbc *DatabaseConfig) GetDatabaseID() string {
+	if dbc.IsSQLite() {
+		return "sqlite:" + dbc.SQLiteFile
+	}
+	return dbc.GetServerAddress() + "/" + dbc.GetDatabaseName()
+}
+
+// Name of MySQL database. It is taken from DSN if it is set
+func (dbc *DatabaseConfig) GetDatabaseName() string {
+	if dbc.DSN != "" {
+		cfg, err := mysql.ParseDSN(dbc.DSN)
+
+		if err == nil {
+			return cfg.DBName
+		}
+	}
+	return dbc.DatabaseName
+}
+
 func (dbc *DatabaseConfig) GetMySQLConnString() string {
-	prefix := ""
+	return dbc.GetMySQLConnStringWithParams(nil)
+}
+
+// Connection string with additional parameters. They are added to parameters from config
+func (dbc *DatabaseConfig) GetMySQLConnStringWithParams(extra map[string]string) string {
+	params := map[string]string{}
 
-	if dbc.DbUser != "" {
-		prefix = dbc.DbUser + ":" + dbc.DbPassword + "@"
+	for k, v := range dbc.Params {
+		params[k] = v
 	}
 
-	if dbc.MysqlSocket != "" {
-		return prefix + "unix(" + dbc.MysqlSocket + ")/" + dbc.DatabaseName
+	if dbc.TLSMode == TLSModeCustom {
+		params["tls"] = tlsConfigName
+	} else if dbc.TLSMode != "" {
+		params["tls"] = dbc.TLSMode
+	}
+
+	if dbc.ServerPubKeyFile != "" {
+		params["serverPubKey"] = serverPubKeyName
+	}
+
+	if _, ok := params["charset"]; !ok && !strings.Contains(dbc.DSN, "charset=") {
+		params["charset"] = defaultCharset
 	}
 
-	return prefix + "tcp(" + dbc.MysqlHost + ":" + strconv.Itoa(dbc.MysqlPort) + ")/" + dbc.DatabaseName
+	for k, v := range extra {
+		params[k] = v
+	}
+
+	connstr := dbc.DSN
+
+	if connstr == "" {
+		prefix := ""
+
+		if dbc.DbUser != "" {
+			prefix = dbc.DbUser + ":" + dbc.DbPassword + "@"
+		}
+
+		if dbc.MysqlSocket != "" {
+			connstr = prefix + "unix(" + dbc.MysqlSocket + ")/" + dbc.DatabaseName
+		} else {
+			connstr = prefix + "tcp(" + dbc.MysqlHost + ":" + strconv.Itoa(dbc.MysqlPort) + ")/" + dbc.DatabaseName
+		}
+	}
+
+	if len(params) == 0 {
+		return connstr
+	}
+
+	// keep same order always
+	keys := []string{}
+
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := []string{}
+
+	for _, k := range keys {
+		pairs = append(pairs, url.QueryEscape(k)+"="+url.QueryEscape(params[k]))
+	}
+
+	separator := "?"
+
+	if strings.Contains(connstr, "?") {
+		separator = "&"
+	}
+
+	return connstr + separator + strings.Join(pairs, "&")
+}
+
+// Registers TLS config with custom certificates in the MySQL driver.
+// It must be done before a connection is opened
+func (dbc *DatabaseConfig) RegisterTLSConfig() error {
+	if dbc.TLSMode != TLSModeCustom {
+		return nil
+	}
+
+	tlsConfig := &tls.Config{}
+	tlsConfig.ServerName = dbc.TLSServerName
+
+	if dbc.TLSServerName == "" && dbc.MysqlSocket == "" {
+		tlsConfig.ServerName = dbc.MysqlHost
+	}
+
+	if dbc.TLSCAFile != "" {
+		pem, err := ioutil.ReadFile(dbc.TLSCAFile)
+
+		if err != nil {
+			return err
+		}
+
+		rootCertPool := x509.NewCertPool()
+
+		if !rootCertPool.AppendCertsFromPEM(pem) {
+			return errors.New("Can not add CA certificate for MySQL connection")
+		}
+		tlsConfig.RootCAs = rootCertPool
+	}
+
+	if dbc.TLSCertFile != "" || dbc.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(dbc.TLSCertFile, dbc.TLSKeyFile)
+
+		if err != nil {
+			return err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return mysql.RegisterTLSConfig(tlsConfigName, tlsConfig)
+}
+
+// Registers the server public key in the MySQL driver. It must be done before a connection is opened
+func (dbc *DatabaseConfig) RegisterServerPubKey() error {
+	if dbc.ServerPubKeyFile == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(dbc.ServerPubKeyFile)
+
+	if err != nil {
+		return err
+	}
+
+	block, _ := pem.Decode(data)
+
+	if block == nil {
+		return errors.New("Can not read server public key. PEM file is expected")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+
+	if err != nil {
+		return err
+	}
+
+	rsaKey, ok := key.(*rsa.PublicKey)
+
+	if !ok {
+		return errors.New("Server public key is not RSA key")
+	}
+
+	mysql.RegisterServerPubKey(serverPubKeyName, rsaKey)
+
+	return nil
 }
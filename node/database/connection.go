@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"encoding/hex"
 	"strconv"
@@ -14,6 +15,7 @@ type MySQLDB struct {
 	db           *sql.DB
 	tablesPrefix string
 	Logger       *utils.LoggerMan
+	sqlite       bool
 }
 
 // close DB connection
@@ -37,7 +39,7 @@ func (bdb *MySQLDB) forEachInTable(table string, callback ForEachKeyIteratorInte
 	for {
 		sqlq := "SELECT * FROM " + table + " ORDER BY v LIMIT " + strconv.Itoa(offset) + ",1"
 		//bdb.Logger.Trace.Println(sqlq)
-		err := bdb.db.QueryRow(sqlq).Scan(&k, &v)
+		err := bdb.queryRow(sqlq, &k, &v)
 
 		switch {
 		case err == sql.ErrNoRows:
@@ -69,7 +71,7 @@ func (bdb *MySQLDB) getCountInTable(table string) (int, error) {
 	var c int
 	sqlq := "SELECT count(*) as c FROM " + table
 	//bdb.Logger.Trace.Println(sqlq)
-	err := bdb.db.QueryRow(sqlq).Scan(&c)
+	err := bdb.queryRow(sqlq, &c)
 
 	switch {
 	case err != nil:
@@ -84,7 +86,7 @@ func (bdb *MySQLDB) Get(table string, k []byte) ([]byte, error) {
 	var v string
 	s := "SELECT v FROM " + table + " WHERE k='" + bdb.encodeKey(k) + "'"
 	//bdb.Logger.Trace.Println(s)
-	err := bdb.db.QueryRow(s).Scan(&v)
+	err := bdb.queryRow(s, &v)
 
 	switch {
 	case err == sql.ErrNoRows:
@@ -107,7 +109,14 @@ func (bdb *MySQLDB) GetAll(table string) ([][][]byte, error) {
 
 	s := "SELECT k, v FROM " + table + " LIMIT " + strconv.Itoa(maxPossibleRowsToReturn)
 	//bdb.Logger.Trace.Println(s)
-	rows, err := bdb.db.Query(s)
+	conn, err := takePoolConnection(bdb.db)
+
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(context.Background(), s)
 
 	if err != nil {
 		return nil, err
@@ -138,8 +147,12 @@ func (bdb *MySQLDB) GetAll(table string) ([][][]byte, error) {
 func (bdb *MySQLDB) Put(table string, k, v []byte) error {
 	ve := bdb.encodeValue(v)
 	sqlq := "INSERT INTO " + table + " VALUES ( ? , ? ) ON DUPLICATE KEY UPDATE v=?"
+
+	if bdb.sqlite {
+		sqlq = "INSERT INTO " + table + " VALUES ( ? , ? ) ON CONFLICT(k) DO UPDATE SET v=?"
+	}
 	//bdb.Logger.Trace.Println(sqlq)
-	_, err := bdb.db.Exec(sqlq, bdb.encodeKey(k), ve, ve)
+	_, err := bdb.exec(sqlq, bdb.encodeKey(k), ve, ve)
 	return err
 }
 
@@ -147,22 +160,57 @@ func (bdb *MySQLDB) Put(table string, k, v []byte) error {
 func (bdb *MySQLDB) Delete(table string, k []byte) error {
 	sqlq := "DELETE FROM " + table + " WHERE k= ? "
 	//bdb.Logger.Trace.Println(sqlq)
-	_, err := bdb.db.Exec(sqlq, bdb.encodeKey(k))
+	_, err := bdb.exec(sqlq, bdb.encodeKey(k))
 	return err
 }
 
 // truncate table
 func (bdb *MySQLDB) Truncate(table string) error {
-	_, err := bdb.db.Exec("TRUNCATE TABLE " + table)
+	if bdb.sqlite {
+		// no TRUNCATE in SQLite
+		_, err := bdb.exec("DELETE FROM " + table)
+		return err
+	}
+	_, err := bdb.exec("TRUNCATE TABLE " + table)
 	return err
 }
 
 // create key value table
 func (bdb *MySQLDB) CreateTable(table string, keytype string, valuetype string) error {
-	_, err := bdb.db.Exec("CREATE TABLE " + table + " ( k " + keytype + " PRIMARY KEY, v " + valuetype + " )")
+	if bdb.sqlite {
+		// keys and values are hex strings. With MySQL types SQLite uses numeric affinity
+		// and converts strings like 000000 to numbers
+		keytype = "TEXT"
+		valuetype = "TEXT"
+	}
+	_, err := bdb.exec("CREATE TABLE " + table + " ( k " + keytype + " PRIMARY KEY, v " + valuetype + " )")
 	return err
 }
 
+// Executes a query on a connection of the pool. Waits for a connection not longer than the pool wait timeout
+func (bdb *MySQLDB) exec(query string, args ...interface{}) (sql.Result, error) {
+	conn, err := takePoolConnection(bdb.db)
+
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return conn.ExecContext(context.Background(), query, args...)
+}
+
+// Query of one row. Values are scanned to dest
+func (bdb *MySQLDB) queryRow(query string, dest ...interface{}) error {
+	conn, err := takePoolConnection(bdb.db)
+
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.QueryRowContext(context.Background(), query).Scan(dest...)
+}
+
 // encode bytes to string
 func (bdb *MySQLDB) encodeKey(k []byte) string {
 	return hex.EncodeToString(k)
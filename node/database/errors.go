@@ -4,6 +4,8 @@ package database
 
 import (
 	"fmt"
+
+	"github.com/gelembjuk/oursql/lib/net"
 )
 
 const TXVerifyErrorNoInput = "noinput"
@@ -13,6 +15,7 @@ const DBHashEmptyError = "hashisemptyd"
 const DBHashError = "hashemptyd"
 const DBRowNotFoundError = "rownotfound"
 const DBConfigError = "rownotfound"
+const DBTimeoutError = "timeout"
 
 type DBError struct {
 	err  string
@@ -31,6 +34,19 @@ func (e *DBError) IsKind(kind string) bool {
 	return e.kind == kind
 }
 
+// Code of the error in a response to other node
+func (e *DBError) ErrorCode() int {
+	switch e.kind {
+	case DBUnavailableError:
+		return net.ErrorCodeDBUnavailable
+	case DBTimeoutError:
+		return net.ErrorCodeDBTimeout
+	case DBHashNotFoundError, DBRowNotFoundError:
+		return net.ErrorCodeNotFound
+	}
+	return net.ErrorCodeDatabase
+}
+
 func (e *DBError) IsRowNotFound() bool {
 	return e.kind == DBRowNotFoundError
 }
@@ -73,6 +89,9 @@ func NewHashDBError(err string) error {
 func NewRowNotFoundDBError(err string) error {
 	return &DBError{err, DBRowNotFoundError}
 }
+func NewTimeoutDBError(err string) error {
+	return &DBError{err, DBTimeoutError}
+}
 func NewConfigDBError(err string) error {
 	return &DBError{err, DBConfigError}
 }
@@ -0,0 +1,52 @@
+package database
+
+/*
+* Escaping of values in SQL built by a node (rollback queries, dumps, repairs). Such SQL is stored in transactions
+* and executed by other nodes, so it can not be a query with parameters.
+* Backslash escapes are never used: they depend on sql_mode (NO_BACKSLASH_ESCAPES) and on a connection charset.
+* Values with bytes which need escapes and values which are not valid text are written as hex literals
+ */
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"strings"
+	"unicode/utf8"
+)
+
+// Builds literals of values and identifiers for a DB engine. Zero value is for MySQL
+type Quoter struct {
+	SQLite bool
+}
+
+// String literal of a value
+func (q Quoter) Literal(value string) string {
+	// backslash is escape character in MySQL by default, \x1a is end of file on Windows.
+	// SQLite has no escapes, only NUL can not be in a text literal
+	special := "\\\x00\x1a"
+
+	if q.SQLite {
+		special = "\x00"
+	}
+
+	if !utf8.ValidString(value) || strings.ContainsAny(value, special) {
+		// binary string literal is converted to a charset of a column when it is assigned or compared.
+		// In SQLite it is a BLOB, it is used only for values which are not valid text
+		return "X'" + hex.EncodeToString([]byte(value)) + "'"
+	}
+	// doubled quote works in all sql modes
+	return "'" + strings.Replace(value, "'", "''", -1) + "'"
+}
+
+// Literal of a value which can be NULL
+func (q Quoter) Nullable(value sql.NullString) string {
+	if !value.Valid {
+		return "NULL"
+	}
+	return q.Literal(value.String)
+}
+
+// Quoted name of a table or a column. Backticks work in MySQL and SQLite
+func (q Quoter) Identifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
@@ -0,0 +1,138 @@
+package database
+
+/*
+* Health of the DB server. The server is checked regularly by the node server. When it is not available,
+* blocks are not applied, they are pulled again from other nodes after the server is back.
+* The pool of connections reconnects itself, broken connections are dropped by database/sql
+ */
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const DBUnavailableError = "unavailable"
+
+// Timeout of one check of the server
+const healthCheckTimeout = 5 * time.Second
+
+// Max delay between checks while the server is not available
+const maxReconnectDelay = 30 * time.Second
+
+// State of the DB server. It is returned in a node state
+type ServerHealth struct {
+	Available bool
+	// time when the server became available or not available
+	Since     time.Time
+	LastCheck time.Time
+	LastError string
+	// number of failed checks and number of times the server came back
+	Failures   int64
+	Reconnects int64
+}
+
+var (
+	serverHealth     = ServerHealth{Available: true, Since: time.Now()}
+	serverHealthLock sync.Mutex
+)
+
+func NewDBUnavailableError() error {
+	return &DBError{"Database server is not available", DBUnavailableError}
+}
+
+func GetServerHealth() ServerHealth {
+	serverHealthLock.Lock()
+	defer serverHealthLock.Unlock()
+
+	return serverHealth
+}
+
+// False only after a failed check. Before first check the server is considered available
+func IsServerAvailable() bool {
+	return GetServerHealth().Available
+}
+
+func setServerHealth(err error) {
+	serverHealthLock.Lock()
+	defer serverHealthLock.Unlock()
+
+	serverHealth.LastCheck = time.Now()
+
+	if err != nil {
+		serverHealth.Failures++
+		serverHealth.LastError = err.Error()
+
+		if serverHealth.Available {
+			serverHealth.Available = false
+			serverHealth.Since = serverHealth.LastCheck
+		}
+		return
+	}
+
+	if !serverHealth.Available {
+		serverHealth.Available = true
+		serverHealth.Since = serverHealth.LastCheck
+		serverHealth.Reconnects++
+	}
+}
+
+// Checks the server with ping. Result is saved to the health state
+func (bdm MySQLDBManager) CheckServerHealth() error {
+	db, err := bdm.getConnection()
+
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+
+		err = db.PingContext(ctx)
+
+		cancel()
+	}
+
+	setServerHealth(err)
+
+	return err
+}
+
+// Delay before next check. It grows while the server is not available
+func ReconnectDelay(failedChecks int) time.Duration {
+	delay := time.Second
+
+	for i := 1; i < failedChecks && delay < maxReconnectDelay; i++ {
+		delay = delay * 2
+	}
+
+	if delay > maxReconnectDelay {
+		delay = maxReconnectDelay
+	}
+	return delay
+}
+
+// Waits while the server is back. Returns error if it is not back in maxWait
+func (bdm MySQLDBManager) waitServerAvailable(maxWait time.Duration) error {
+	deadline := time.Now().Add(maxWait)
+
+	for failed := 1; ; failed++ {
+		if bdm.CheckServerHealth() == nil {
+			return nil
+		}
+
+		delay := ReconnectDelay(failed)
+
+		if time.Now().Add(delay).After(deadline) {
+			return errors.New(fmt.Sprintf("%s. Waited %s", NewDBUnavailableError().Error(), maxWait))
+		}
+
+		bdm.Logger.Trace.Printf("DB server is not available. Check again in %s", delay)
+
+		time.Sleep(delay)
+	}
+}
+
+// Connection failed before a query was sent to the server. It is safe to execute the query again
+func isConnectionError(err error) bool {
+	return err == driver.ErrBadConn
+}
@@ -1,6 +1,8 @@
 package database
 
 import (
+	"database/sql"
+
 	"github.com/gelembjuk/oursql/lib/utils"
 )
 
@@ -10,6 +12,7 @@ type DBManager interface {
 	QM() DBQueryManager // get QueryManager object
 
 	SetConfig(config DatabaseConfig) error
+	GetConfig() DatabaseConfig
 	SetLogger(logger *utils.LoggerMan) error
 	GetLockerObject() DatabaseLocker
 	SetLockerObject(lockerobj DatabaseLocker)
@@ -28,19 +31,39 @@ type DBManager interface {
 	GetUnspentOutputsObject() (UnspentOutputsInterface, error)
 	GetNodesObject() (NodesInterface, error)
 	GetDataReferencesObject() (DataReferencesaInterface, error)
+	GetAuditLogObject() (AuditLogInterface, error)
+	GetChangeLogObject() (ChangeLogInterface, error)
+	GetAnchorsObject() (AnchorsInterface, error)
 }
 
 type DBQueryManager interface {
 	Dump(file string) error
+	DumpTables(file string, tables []string) error
 	Restore(file string) error
 	ExecuteSQL(sql string) error
+	ExecuteSQLApply(sql string) error
+	ExecuteSQLApplyList(queries []string) (int, error)
+	GetApplySettings() (ApplySettings, error)
+	ExecuteSQLShadowApply(steps []ShadowApplyStep) (int, error)
+	ExecuteSQLMaintenance(table string, operation string) error
+	CheckServerHealth() error
 	ExecuteSQLExplain(sql string) (SQLExplainInfo, error)
 	ExecuteSQLPrimaryKey(table string) (string, error)
+	ExecuteSQLRowByKey(table string, keyCol string, keyVal string) (map[string]sql.NullString, error)
+	GetQuoter() Quoter
 	ExecuteSQLNextKeyValue(table string) (string, error)
 	ExecuteSQLSelectRow(sqlcommand string) (data map[string]string, err error)
 	ExecuteSQLSelectRows(sqlcommand string) (data []resultRow, err error)
 	ExecuteSQLTableDump(table string, limit int, offset int) ([]string, error)
 	ExecuteSQLCountInTable(table string) (int, error)
+	ExecuteSQLTablesList() ([]string, error)
+	ExecuteSQLCreateTable(table string) (string, error)
+	ExecuteSQLServerVersion() (ServerVersion, error)
+	ExecuteSQLCanonicalCreateTable(createSQL string) (string, error)
+	ExecuteSQLSelectOnReplica(sqlcommand string) (*SelectResult, error)
+	ExecuteSQLSelectResult(sqlcommand string) (*SelectResult, error)
+	ExecuteSQLBinlogPosition() (string, uint64, error)
+	ExecuteSQLBinlogEvents(file string, pos uint64, limit int) ([]BinlogEvent, error)
 }
 
 type SQLExplainInfo struct {
@@ -108,6 +131,30 @@ type DataReferencesaInterface interface {
 	DeleteRefID(RefID []byte) error
 }
 
+type AuditLogInterface interface {
+	InitDB() error
+	TruncateDB() error
+	AddRecords(records []AuditRecord) error
+	DeleteBlockRecords(blockHash []byte) error
+	GetCount() (int, error)
+}
+
+type ChangeLogInterface interface {
+	InitDB() error
+	TruncateDB() error
+	AddEvents(events []ChangeEvent) error
+	GetEvents(after int64, limit int) ([]ChangeEvent, error)
+	GetCount() (int, error)
+}
+
+type AnchorsInterface interface {
+	InitDB() error
+	AddAnchor(anchor Anchor) (int64, error)
+	GetAnchors(limit int, offset int) ([]Anchor, error)
+	GetAnchor(id int64) (*Anchor, error)
+	GetCount() (int, error)
+}
+
 type UnapprovedTransactionsInterface interface {
 	InitDB() error
 	TruncateDB() error
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Tables maintenance operations
+const (
+	MaintenanceAnalyze  = "analyze"
+	MaintenanceOptimize = "optimize"
+	MaintenanceNone     = "none"
+)
+
+// Runs ANALYZE or OPTIMIZE of a table. It is local operation, it is not written to the binary log,
+// so replicas and the binlog monitor don't see it
+func (bdm MySQLDBManager) ExecuteSQLMaintenance(table string, operation string) error {
+	if operation != MaintenanceAnalyze && operation != MaintenanceOptimize {
+		return errors.New(fmt.Sprintf("Unknown maintenance operation %s", operation))
+	}
+
+	if bdm.Config.IsSQLite() {
+		if operation == MaintenanceOptimize {
+			// there is no optimize of one table in SQLite, VACUUM rebuilds all the file
+			return bdm.ExecuteSQL("VACUUM")
+		}
+		return bdm.ExecuteSQL("ANALYZE `" + table + "`")
+	}
+
+	conn, err := bdm.takeConnection()
+
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// errors of these commands are returned as rows of the result, not as a query error
+	rows, err := conn.QueryContext(context.Background(), strings.ToUpper(operation)+" NO_WRITE_TO_BINLOG TABLE `"+table+"`")
+
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tbl, op, msgType, msgText string
+
+		err = rows.Scan(&tbl, &op, &msgType, &msgText)
+
+		if err != nil {
+			return err
+		}
+
+		if strings.ToLower(msgType) == "error" {
+			return errors.New(fmt.Sprintf("%s of %s failed: %s", op, table, msgText))
+		}
+	}
+	return rows.Err()
+}
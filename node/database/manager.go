@@ -1,9 +1,12 @@
 package database
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -11,6 +14,7 @@ import (
 	"database/sql"
 
 	"github.com/JamesStewy/go-mysqldump"
+	"github.com/gelembjuk/oursql/lib/tracing"
 	"github.com/gelembjuk/oursql/lib/utils"
 	_ "github.com/go-sql-driver/mysql"
 )
@@ -23,12 +27,17 @@ const (
 	ClassNameUnspentOutputs         = "unspentoutputs"
 )
 
+// Rows of a table read at once by DumpTables
+const dumpPageSize = 1000
+
 type MySQLDBManager struct {
 	Logger     *utils.LoggerMan
 	Config     DatabaseConfig
 	conn       *sql.DB
 	openedConn bool
 	SessID     string
+	// queries are added as spans to this trace. Can be nil
+	Trace *tracing.Trace
 }
 
 func (bdm *MySQLDBManager) QM() DBQueryManager {
@@ -40,6 +49,10 @@ func (bdm *MySQLDBManager) SetConfig(config DatabaseConfig) error {
 
 	return nil
 }
+
+func (bdm *MySQLDBManager) GetConfig() DatabaseConfig {
+	return bdm.Config
+}
 func (bdm *MySQLDBManager) SetLogger(logger *utils.LoggerMan) error {
 	bdm.Logger = logger
 
@@ -48,18 +61,25 @@ func (bdm *MySQLDBManager) SetLogger(logger *utils.LoggerMan) error {
 
 // try to set up a connection to DB. and close it then
 func (bdm *MySQLDBManager) CheckConnection() error {
-	conn, err := bdm.getConnection()
+	conn, err := bdm.takeConnection()
 
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	_, err = conn.Query("SHOW TABLES")
+	var rows *sql.Rows
+
+	if bdm.Config.IsSQLite() {
+		rows, err = conn.QueryContext(context.Background(), "SELECT name FROM sqlite_master")
+	} else {
+		rows, err = conn.QueryContext(context.Background(), "SHOW TABLES")
+	}
 
 	if err != nil {
 		return err
 	}
+	rows.Close()
 
 	return nil
 }
@@ -82,10 +102,8 @@ func (bdm *MySQLDBManager) CloseConnection() error {
 		return nil
 	}
 
-	if bdm.conn != nil {
-		bdm.conn.Close()
-		bdm.conn = nil
-	}
+	// connection pool is shared, it is not closed here
+	bdm.conn = nil
 
 	bdm.openedConn = false
 	return nil
@@ -171,6 +189,42 @@ func (bdm *MySQLDBManager) InitDatabase() error {
 
 	err = dr.InitDB()
 
+	if err != nil {
+		return err
+	}
+
+	al, err := bdm.GetAuditLogObject()
+
+	if err != nil {
+		return err
+	}
+
+	err = al.InitDB()
+
+	if err != nil {
+		return err
+	}
+
+	cl, err := bdm.GetChangeLogObject()
+
+	if err != nil {
+		return err
+	}
+
+	err = cl.InitDB()
+
+	if err != nil {
+		return err
+	}
+
+	an, err := bdm.GetAnchorsObject()
+
+	if err != nil {
+		return err
+	}
+
+	err = an.InitDB()
+
 	if err != nil {
 		return err
 	}
@@ -208,7 +262,7 @@ func (bdm *MySQLDBManager) GetBlockchainObject() (BlockchainInterface, error) {
 	}
 
 	bc := Blockchain{}
-	bc.DB = &MySQLDB{conn, bdm.Config.TablesPrefix, bdm.Logger}
+	bc.DB = &MySQLDB{conn, bdm.Config.TablesPrefix, bdm.Logger, bdm.Config.IsSQLite()}
 
 	return &bc, nil
 }
@@ -221,11 +275,50 @@ func (bdm *MySQLDBManager) GetDataReferencesObject() (DataReferencesaInterface,
 	}
 
 	dr := dataReferences{}
-	dr.DB = &MySQLDB{conn, bdm.Config.TablesPrefix, bdm.Logger}
+	dr.DB = &MySQLDB{conn, bdm.Config.TablesPrefix, bdm.Logger, bdm.Config.IsSQLite()}
 
 	return &dr, nil
 }
 
+func (bdm *MySQLDBManager) GetAuditLogObject() (AuditLogInterface, error) {
+	conn, err := bdm.getConnection()
+
+	if err != nil {
+		return nil, err
+	}
+
+	al := AuditLog{}
+	al.DB = &MySQLDB{conn, bdm.Config.TablesPrefix, bdm.Logger, bdm.Config.IsSQLite()}
+
+	return &al, nil
+}
+
+func (bdm *MySQLDBManager) GetChangeLogObject() (ChangeLogInterface, error) {
+	conn, err := bdm.getConnection()
+
+	if err != nil {
+		return nil, err
+	}
+
+	cl := ChangeLog{}
+	cl.DB = &MySQLDB{conn, bdm.Config.TablesPrefix, bdm.Logger, bdm.Config.IsSQLite()}
+
+	return &cl, nil
+}
+
+func (bdm *MySQLDBManager) GetAnchorsObject() (AnchorsInterface, error) {
+	conn, err := bdm.getConnection()
+
+	if err != nil {
+		return nil, err
+	}
+
+	an := Anchors{}
+	an.DB = &MySQLDB{conn, bdm.Config.TablesPrefix, bdm.Logger, bdm.Config.IsSQLite()}
+
+	return &an, nil
+}
+
 // returns Transaction Index Database structure. does al init
 func (bdm *MySQLDBManager) GetTransactionsObject() (TranactionsInterface, error) {
 	conn, err := bdm.getConnection()
@@ -235,7 +328,7 @@ func (bdm *MySQLDBManager) GetTransactionsObject() (TranactionsInterface, error)
 	}
 
 	txs := Tranactions{}
-	txs.DB = &MySQLDB{conn, bdm.Config.TablesPrefix, bdm.Logger}
+	txs.DB = &MySQLDB{conn, bdm.Config.TablesPrefix, bdm.Logger, bdm.Config.IsSQLite()}
 
 	return &txs, nil
 }
@@ -249,7 +342,7 @@ func (bdm *MySQLDBManager) GetUnapprovedTransactionsObject() (UnapprovedTransact
 	}
 
 	uos := UnapprovedTransactions{}
-	uos.DB = &MySQLDB{conn, bdm.Config.TablesPrefix, bdm.Logger}
+	uos.DB = &MySQLDB{conn, bdm.Config.TablesPrefix, bdm.Logger, bdm.Config.IsSQLite()}
 
 	return &uos, nil
 }
@@ -263,7 +356,7 @@ func (bdm *MySQLDBManager) GetUnspentOutputsObject() (UnspentOutputsInterface, e
 	}
 
 	uts := UnspentOutputs{}
-	uts.DB = &MySQLDB{conn, bdm.Config.TablesPrefix, bdm.Logger}
+	uts.DB = &MySQLDB{conn, bdm.Config.TablesPrefix, bdm.Logger, bdm.Config.IsSQLite()}
 
 	return &uts, nil
 }
@@ -277,7 +370,7 @@ func (bdm *MySQLDBManager) GetNodesObject() (NodesInterface, error) {
 	}
 
 	ns := Nodes{}
-	ns.DB = &MySQLDB{conn, bdm.Config.TablesPrefix, bdm.Logger}
+	ns.DB = &MySQLDB{conn, bdm.Config.TablesPrefix, bdm.Logger, bdm.Config.IsSQLite()}
 
 	return &ns, nil
 }
@@ -293,19 +386,50 @@ func (bdm *MySQLDBManager) getConnection() (*sql.DB, error) {
 		return bdm.conn, nil
 	}
 
-	db, err := sql.Open("mysql", bdm.Config.GetMySQLConnString())
+	if bdm.Config.IsSQLite() {
+		db, err := bdm.openSQLite()
+
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Can not open DB connection: %s", err.Error()))
+		}
+		bdm.conn = db
+
+		return db, nil
+	}
+
+	err := bdm.Config.RegisterTLSConfig()
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Can not prepare TLS for DB connection: %s", err.Error()))
+	}
+
+	err = bdm.Config.RegisterServerPubKey()
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Can not load server public key for DB connection: %s", err.Error()))
+	}
+
+	db, err := getPool("mysql", bdm.Config.GetMySQLConnString(), bdm.Config)
 
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("Can not open DB connection: %s", err.Error()))
 	}
-	//db.SetMaxOpenConns(2)
-	db.SetMaxIdleConns(2)
 
 	bdm.conn = db
 
 	return db, nil
 }
 
+// Takes a connection of the pool of the manager. It must be closed to return it to the pool
+func (bdm *MySQLDBManager) takeConnection() (*sql.Conn, error) {
+	db, err := bdm.getConnection()
+
+	if err != nil {
+		return nil, err
+	}
+	return takePoolConnection(db)
+}
+
 func (bdm *MySQLDBManager) GetLockerObject() DatabaseLocker {
 	return nil
 }
@@ -314,42 +438,129 @@ func (bdm *MySQLDBManager) SetLockerObject(lockerobj DatabaseLocker) {
 }
 
 func (bdm *MySQLDBManager) Dump(file string) error {
-	conn, err := bdm.getConnection()
+	if bdm.Config.IsSQLite() {
+		return bdm.sqliteDump(file)
+	}
+
+	err := bdm.Config.RegisterTLSConfig()
 
 	if err != nil {
 		return err
 	}
-	// Register database with mysqldump
-	dumpDir, _ := filepath.Abs(filepath.Dir(file))
-	dumpFilename := filepath.Base(file)
 
-	if strings.HasSuffix(dumpFilename, ".sql") {
-		dumpFilename = dumpFilename[:len(dumpFilename)-4]
+	err = bdm.Config.RegisterServerPubKey()
+
+	if err != nil {
+		return err
 	}
-	fmt.Printf("file name %s", dumpFilename)
-	dumper, err := mysqldump.Register(conn, dumpDir, dumpFilename)
+	// mysqldump closes the connection, it is not taken from the pool
+	conn, err := sql.Open("mysql", bdm.Config.GetMySQLConnString())
 
 	if err != nil {
 		return err
 	}
 
-	// Dump database to file
-	_, err = dumper.Dump()
+	// mysqldump makes a name of a file from a time format, the dump is made in an empty folder and moved then
+	dumpDir, err := ioutil.TempDir(filepath.Dir(file), "dump")
 
 	if err != nil {
+		conn.Close()
 		return err
 	}
+	defer os.RemoveAll(dumpDir)
 
-	dumper.Close()
-	return nil
+	dumper, err := mysqldump.Register(conn, dumpDir, "dump")
+
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer dumper.Close()
+
+	dumpFile, err := dumper.Dump()
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(dumpFile, file)
+}
+
+// Dumps tables to a file as list of SQL queries. Tables of the node are created by InitDatabase,
+// only their rows are in the dump
+func (bdm *MySQLDBManager) DumpTables(file string, tables []string) error {
+	f, err := os.Create(file)
+
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+
+	if !bdm.Config.IsSQLite() {
+		// tables are not dumped in order of references
+		w.WriteString("SET FOREIGN_KEY_CHECKS=0;\n")
+	}
+
+	for _, table := range tables {
+		offset := 0
+
+		if bdm.Config.IsNodeTable(table) {
+			// skip CREATE TABLE
+			offset = 1
+		}
+
+		for {
+			sqls, err := bdm.ExecuteSQLTableDump(table, dumpPageSize, offset)
+
+			if err != nil {
+				return err
+			}
+
+			for _, sql := range sqls {
+				w.WriteString(sql + ";\n")
+			}
+			offset += len(sqls)
+
+			if len(sqls) < dumpPageSize {
+				break
+			}
+		}
+	}
+
+	err = w.Flush()
+
+	if err != nil {
+		return err
+	}
+	return f.Close()
 }
+
 func (bdm *MySQLDBManager) Restore(file string) error {
-	connstr := bdm.Config.GetMySQLConnString() + "?multiStatements=true"
+	if bdm.Config.IsSQLite() {
+		return bdm.sqliteRestore(file)
+	}
+
+	err := bdm.Config.RegisterTLSConfig()
+
+	if err != nil {
+		return err
+	}
+
+	err = bdm.Config.RegisterServerPubKey()
+
+	if err != nil {
+		return err
+	}
+
+	connstr := bdm.Config.GetMySQLConnStringWithParams(map[string]string{"multiStatements": "true"})
 	db, err := sql.Open("mysql", connstr)
 
 	if err != nil {
 		return err
 	}
+	defer db.Close()
 
 	// load file to string
 	b, err := ioutil.ReadFile(file)
@@ -366,12 +577,16 @@ func (bdm *MySQLDBManager) Restore(file string) error {
 
 // execute query.
 func (bdm MySQLDBManager) ExecuteSQL(sql string) error {
-	db, err := bdm.getConnection()
+	span := bdm.startSpan("db exec", sql)
 
-	if err != nil {
-		return err
+	conn, err := bdm.takeConnection()
+
+	if err == nil {
+		_, err = conn.ExecContext(context.Background(), sql)
+		conn.Close()
 	}
-	_, err = db.Exec(sql)
+	span.End(err)
+
 	return err
 }
 
@@ -400,6 +615,9 @@ func (bdm MySQLDBManager) ExecuteSQLExplain(sql string) (r SQLExplainInfo, err e
 
 // get primary key column name for a table
 func (bdm MySQLDBManager) ExecuteSQLPrimaryKey(table string) (column string, err error) {
+	if bdm.Config.IsSQLite() {
+		return bdm.sqlitePrimaryKey(table)
+	}
 	row, err := bdm.ExecuteSQLSelectRow("SHOW KEYS FROM " + table + " WHERE Key_name = 'PRIMARY'")
 
 	if err != nil {
@@ -409,25 +627,86 @@ func (bdm MySQLDBManager) ExecuteSQLPrimaryKey(table string) (column string, err
 	return
 }
 
-// get row by table name and primary key value
-func (bdm MySQLDBManager) ExecuteSQLRowByKey(table string, priKeyVal string) (data map[string]string, err error) {
+// Quoter of values for SQL of this DB engine
+func (bdm MySQLDBManager) GetQuoter() Quoter {
+	return Quoter{bdm.Config.IsSQLite()}
+}
+
+// get row by table name and primary key value. The value is sent as a query parameter,
+// NULL values are kept, so the row can be restored exactly
+func (bdm MySQLDBManager) ExecuteSQLRowByKey(table string, keyCol string, keyVal string) (data map[string]sql.NullString, err error) {
+	conn, err := bdm.takeConnection()
+
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(context.Background(), "SELECT * FROM "+table+" WHERE "+bdm.GetQuoter().Identifier(keyCol)+" = ?", keyVal)
+
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+
+	if err != nil {
+		return
+	}
+
+	if !rows.Next() {
+		err = rows.Err()
+
+		if err == nil {
+			err = NewRowNotFoundDBError("Row not found in a table")
+		}
+		return
+	}
+
+	columns := make([]sql.NullString, len(cols))
+	columnPointers := make([]interface{}, len(cols))
+	for i, _ := range columns {
+		columnPointers[i] = &columns[i]
+	}
+
+	err = rows.Scan(columnPointers...)
+
+	if err != nil {
+		return
+	}
+
+	data = make(map[string]sql.NullString)
+
+	for i, colName := range cols {
+		data[colName] = columns[i]
+	}
 	return
 }
 
 // get single row as a map
 func (bdm MySQLDBManager) ExecuteSQLSelectRow(sqlcommand string) (data map[string]string, err error) {
+	span := bdm.startSpan("db select", sqlcommand)
+
+	defer func() {
+		span.End(err)
+	}()
+
 	//bdm.Logger.Trace.Println(sqlcommand)
-	db, err := bdm.getConnection()
+	conn, err := bdm.takeConnection()
 
 	if err != nil {
 		return
 	}
+	// connection is returned to pool only when it is closed. SQLite has single connection
+	defer conn.Close()
 
-	rows, err := db.Query(sqlcommand)
+	rows, err := conn.QueryContext(context.Background(), sqlcommand)
 
 	if err != nil {
 		return
 	}
+	defer rows.Close()
 
 	cols, err := rows.Columns()
 
@@ -458,8 +737,6 @@ func (bdm MySQLDBManager) ExecuteSQLSelectRow(sqlcommand string) (data map[strin
 
 			data[colName] = val
 		}
-
-		rows.Close()
 	} else {
 		err = NewRowNotFoundDBError("Row not found in a table")
 	}
@@ -469,18 +746,27 @@ func (bdm MySQLDBManager) ExecuteSQLSelectRow(sqlcommand string) (data map[strin
 
 // get all rows as array of maps
 func (bdm MySQLDBManager) ExecuteSQLSelectRows(sqlcommand string) (data []resultRow, err error) {
+	span := bdm.startSpan("db select", sqlcommand)
+
+	defer func() {
+		span.End(err)
+	}()
+
 	//bdm.Logger.Trace.Println(sqlcommand)
-	db, err := bdm.getConnection()
+	conn, err := bdm.takeConnection()
 
 	if err != nil {
 		return
 	}
+	// connection is returned to pool only when it is closed. SQLite has single connection
+	defer conn.Close()
 
-	rows, err := db.Query(sqlcommand)
+	rows, err := conn.QueryContext(context.Background(), sqlcommand)
 
 	if err != nil {
 		return
 	}
+	defer rows.Close()
 
 	cols, err := rows.Columns()
 
@@ -523,6 +809,19 @@ func (bdm MySQLDBManager) ExecuteSQLSelectRows(sqlcommand string) (data []result
 
 // Return next auto_increment before query executed
 func (bdm MySQLDBManager) ExecuteSQLNextKeyValue(table string) (string, error) {
+	if bdm.Config.IsSQLite() {
+		return bdm.sqliteNextKeyValue(table)
+	}
+	version, err := bdm.ExecuteSQLServerVersion()
+
+	if err != nil {
+		return "", err
+	}
+
+	if version.IsMySQL() && version.AtLeast(8, 0) {
+		return bdm.nextKeyValueMySQL8(table)
+	}
+
 	row, err := bdm.ExecuteSQLSelectRow("SHOW TABLE STATUS LIKE '" + table + "'")
 
 	if err != nil {
@@ -531,6 +830,53 @@ func (bdm MySQLDBManager) ExecuteSQLNextKeyValue(table string) (string, error) {
 	return row["Auto_increment"], nil
 }
 
+// MySQL 8 caches tables statistics, Auto_increment can be old. The cache is disabled for one connection to read it
+func (bdm MySQLDBManager) nextKeyValueMySQL8(table string) (string, error) {
+	conn, err := bdm.takeConnection()
+
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+
+	_, err = conn.ExecContext(ctx, "SET SESSION information_schema_stats_expiry = 0")
+
+	if err != nil {
+		return "", err
+	}
+	// set back before the connection returns to the pool
+	defer conn.ExecContext(ctx, "SET SESSION information_schema_stats_expiry = DEFAULT")
+
+	var next sql.NullString
+
+	err = conn.QueryRowContext(ctx, "SELECT AUTO_INCREMENT FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?", table).Scan(&next)
+
+	if err == sql.ErrNoRows {
+		return "", errors.New(fmt.Sprintf("Table %s is not found", table))
+	}
+
+	if err != nil {
+		return "", err
+	}
+	return next.String, nil
+}
+
+// Version of the DB server. It is detected when a connection is opened first time
+func (bdm MySQLDBManager) ExecuteSQLServerVersion() (ServerVersion, error) {
+	if bdm.Config.IsSQLite() {
+		return ServerVersion{}, nil
+	}
+
+	_, err := bdm.getConnection()
+
+	if err != nil {
+		return ServerVersion{}, err
+	}
+	return getPoolServerVersion("mysql", bdm.Config.GetMySQLConnString()), nil
+}
+
 // Return list of SQL queries as part of dump
 // If offset is 0 we retrn table create SQL comand too
 func (bdm MySQLDBManager) ExecuteSQLTableDump(table string, limit int, offset int) (list []string, err error) {
@@ -539,13 +885,20 @@ func (bdm MySQLDBManager) ExecuteSQLTableDump(table string, limit int, offset in
 
 	if offset == 0 {
 		// add table create SQL
-		row, errl := bdm.ExecuteSQLSelectRow("SHOW CREATE TABLE `" + table + "`")
+		var sql string
+
+		if bdm.Config.IsSQLite() {
+			sql, err = bdm.sqliteCreateTable(table)
+		} else {
+			var row map[string]string
 
-		if errl != nil {
-			err = errl
+			row, err = bdm.ExecuteSQLSelectRow("SHOW CREATE TABLE `" + table + "`")
+			sql = row["Create Table"]
+		}
+
+		if err != nil {
 			return
 		}
-		sql := row["Create Table"]
 		sql = strings.Replace(sql, "\n", " ", -1)
 		sql = strings.Replace(sql, "\r", "", -1)
 		list = append(list, sql)
@@ -560,11 +913,12 @@ func (bdm MySQLDBManager) ExecuteSQLTableDump(table string, limit int, offset in
 	}
 
 	// select limit rows and make dump records for them
-	db, err := bdm.getConnection()
+	conn, err := bdm.takeConnection()
 
 	if err != nil {
 		return
 	}
+	defer conn.Close()
 
 	sqlcommm := "SELECT * FROM " + table
 
@@ -572,11 +926,12 @@ func (bdm MySQLDBManager) ExecuteSQLTableDump(table string, limit int, offset in
 		sqlcommm = sqlcommm + " LIMIT " + strconv.Itoa(offset) + "," + strconv.Itoa(limit)
 	}
 	bdm.Logger.Trace.Printf("SQL %s", sqlcommm)
-	rows, err := db.Query(sqlcommm)
+	rows, err := conn.QueryContext(context.Background(), sqlcommm)
 
 	if err != nil {
 		return
 	}
+	defer rows.Close()
 
 	cols, err := rows.Columns()
 
@@ -584,6 +939,8 @@ func (bdm MySQLDBManager) ExecuteSQLTableDump(table string, limit int, offset in
 		return
 	}
 
+	quoter := bdm.GetQuoter()
+
 	for rows.Next() {
 
 		columns := make([]sql.NullString, len(cols))
@@ -598,18 +955,15 @@ func (bdm MySQLDBManager) ExecuteSQLTableDump(table string, limit int, offset in
 			return
 		}
 
-		pairs := []string{}
+		names := []string{}
+		values := []string{}
 
 		for i, colName := range cols {
-			val := "NULL"
-
-			if columns[i].Valid {
-				val = "'" + utils.DBQuote(columns[i].String) + "'"
-			}
-			pair := "`" + colName + "` = " + val
-			pairs = append(pairs, pair)
+			names = append(names, quoter.Identifier(colName))
+			values = append(values, quoter.Nullable(columns[i]))
 		}
-		sql := "INSERT INTO " + table + " SET " + strings.Join(pairs, ", ")
+		// this form of insert works both in MySQL and SQLite
+		sql := "INSERT INTO " + table + " (" + strings.Join(names, ", ") + ") VALUES (" + strings.Join(values, ", ") + ")"
 
 		list = append(list, sql)
 	}
@@ -617,6 +971,49 @@ func (bdm MySQLDBManager) ExecuteSQLTableDump(table string, limit int, offset in
 	return list, nil
 }
 
+// Return list of all tables in DB
+func (bdm MySQLDBManager) ExecuteSQLTablesList() ([]string, error) {
+	if bdm.Config.IsSQLite() {
+		return bdm.sqliteTablesList()
+	}
+
+	results, err := bdm.ExecuteSQLSelectRows("SHOW TABLES")
+
+	if err != nil {
+		return nil, err
+	}
+
+	tables := []string{}
+
+	for _, row := range results {
+		table := ""
+
+		for _, t := range row {
+			table = t
+			break
+		}
+		if table != "" {
+			tables = append(tables, table)
+		}
+	}
+
+	return tables, nil
+}
+
+// Returns CREATE TABLE statement of a table
+func (bdm MySQLDBManager) ExecuteSQLCreateTable(table string) (string, error) {
+	if bdm.Config.IsSQLite() {
+		return bdm.sqliteCreateTable(table)
+	}
+
+	row, err := bdm.ExecuteSQLSelectRow("SHOW CREATE TABLE `" + table + "`")
+
+	if err != nil {
+		return "", err
+	}
+	return row["Create Table"], nil
+}
+
 // Get count of rows in table
 func (bdm MySQLDBManager) ExecuteSQLCountInTable(table string) (int, error) {
 
@@ -1,6 +1,8 @@
 package database
 
 import (
+	"database/sql"
+
 	"github.com/gelembjuk/oursql/lib/utils"
 )
 
@@ -18,6 +20,9 @@ func (bdm *mockMySQLDBManager) QM() DBQueryManager {
 func (bdm mockMySQLDBManager) SetConfig(config DatabaseConfig) error {
 	return nil
 }
+func (bdm mockMySQLDBManager) GetConfig() DatabaseConfig {
+	return DatabaseConfig{}
+}
 func (bdm mockMySQLDBManager) SetLogger(logger *utils.LoggerMan) error {
 	return nil
 }
@@ -60,6 +65,22 @@ func (bdm mockMySQLDBManager) GetNodesObject() (NodesInterface, error) {
 	ns := Nodes{}
 	return &ns, nil
 }
+func (bdm mockMySQLDBManager) GetDataReferencesObject() (DataReferencesaInterface, error) {
+	dr := dataReferences{}
+	return &dr, nil
+}
+func (bdm mockMySQLDBManager) GetAuditLogObject() (AuditLogInterface, error) {
+	al := AuditLog{}
+	return &al, nil
+}
+func (bdm mockMySQLDBManager) GetChangeLogObject() (ChangeLogInterface, error) {
+	cl := ChangeLog{}
+	return &cl, nil
+}
+func (bdm mockMySQLDBManager) GetAnchorsObject() (AnchorsInterface, error) {
+	an := Anchors{}
+	return &an, nil
+}
 func (bdm mockMySQLDBManager) GetLockerObject() DatabaseLocker {
 	return nil
 }
@@ -68,12 +89,33 @@ func (bdm mockMySQLDBManager) SetLockerObject(lockerobj DatabaseLocker) {
 func (bdm mockMySQLDBManager) Dump(file string) error {
 	return nil
 }
+func (bdm mockMySQLDBManager) DumpTables(file string, tables []string) error {
+	return nil
+}
 func (bdm mockMySQLDBManager) Restore(file string) error {
 	return nil
 }
 func (bdm mockMySQLDBManager) ExecuteSQL(sql string) error {
 	return nil
 }
+func (bdm mockMySQLDBManager) ExecuteSQLApply(sql string) error {
+	return nil
+}
+func (bdm mockMySQLDBManager) ExecuteSQLApplyList(queries []string) (int, error) {
+	return -1, nil
+}
+func (bdm mockMySQLDBManager) GetApplySettings() (ApplySettings, error) {
+	return ApplySettings{}, nil
+}
+func (bdm mockMySQLDBManager) ExecuteSQLShadowApply(steps []ShadowApplyStep) (int, error) {
+	return -1, nil
+}
+func (bdm mockMySQLDBManager) ExecuteSQLMaintenance(table string, operation string) error {
+	return nil
+}
+func (bdm mockMySQLDBManager) CheckServerHealth() error {
+	return nil
+}
 
 // set explain info to return when requested
 func (bdm *mockMySQLDBManager) SetSQLExplain(si *SQLExplainInfo) {
@@ -90,6 +132,14 @@ func (bdm mockMySQLDBManager) ExecuteSQLPrimaryKey(table string) (column string,
 	return bdm.KeyColumn, nil
 }
 
+func (bdm mockMySQLDBManager) ExecuteSQLRowByKey(table string, keyCol string, keyVal string) (map[string]sql.NullString, error) {
+	return nil, nil
+}
+
+func (bdm mockMySQLDBManager) GetQuoter() Quoter {
+	return Quoter{}
+}
+
 func (bdm mockMySQLDBManager) ExecuteSQLSelectRow(sqlcommand string) (data map[string]string, err error) {
 	return
 }
@@ -109,3 +159,38 @@ func (bdm mockMySQLDBManager) ExecuteSQLTableDump(table string, limit int, offse
 func (bdm mockMySQLDBManager) ExecuteSQLCountInTable(table string) (int, error) {
 	return 0, nil
 }
+
+func (bdm mockMySQLDBManager) ExecuteSQLTablesList() ([]string, error) {
+	return nil, nil
+}
+
+func (bdm mockMySQLDBManager) ExecuteSQLSelectOnReplica(sqlcommand string) (*SelectResult, error) {
+	return nil, nil
+}
+
+func (bdm mockMySQLDBManager) ExecuteSQLSelectResult(sqlcommand string) (*SelectResult, error) {
+	return nil, nil
+}
+
+func (bdm mockMySQLDBManager) ExecuteSQLServerVersion() (ServerVersion, error) {
+	return ServerVersion{}, nil
+}
+
+func (bdm mockMySQLDBManager) ExecuteSQLCreateTable(table string) (string, error) {
+	if bdm.KeyColumn == "" {
+		return "", nil
+	}
+	return "CREATE TABLE `" + table + "` (`" + bdm.KeyColumn + "` int NOT NULL, PRIMARY KEY (`" + bdm.KeyColumn + "`))", nil
+}
+
+func (bdm mockMySQLDBManager) ExecuteSQLCanonicalCreateTable(createSQL string) (string, error) {
+	return createSQL, nil
+}
+
+func (bdm mockMySQLDBManager) ExecuteSQLBinlogPosition() (string, uint64, error) {
+	return "", 0, nil
+}
+
+func (bdm mockMySQLDBManager) ExecuteSQLBinlogEvents(file string, pos uint64, limit int) ([]BinlogEvent, error) {
+	return []BinlogEvent{}, nil
+}
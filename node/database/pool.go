@@ -0,0 +1,159 @@
+package database
+
+/*
+* Pool of connections to the DB server. One pool is shared by all DB managers of a process
+* (block apply, query validation, wallet requests etc.) with same connection options
+ */
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Defaults for the pool if config has no options
+const (
+	defaultPoolMaxIdleConns = 2
+	defaultPoolWaitTimeout  = 30 // seconds
+)
+
+// Pool statistics. It is returned in a node state
+type PoolStats struct {
+	MaxOpenConnections int
+	OpenConnections    int
+	InUse              int
+	Idle               int
+	WaitCount          int64
+	WaitDuration       time.Duration
+	MaxIdleClosed      int64
+	MaxLifetimeClosed  int64
+}
+
+var (
+	pools     = map[string]*sql.DB{}
+	poolsLock sync.Mutex
+	// versions of servers of pools. Not set for SQLite
+	poolsVersions = map[string]ServerVersion{}
+	// how long to wait for a free connection of a pool, seconds
+	poolsWaitTimeouts = map[*sql.DB]int{}
+)
+
+// Returns shared pool for given driver and connection string. Creates it on first call
+func getPool(driver, connstr string, config DatabaseConfig) (*sql.DB, error) {
+	poolsLock.Lock()
+	defer poolsLock.Unlock()
+
+	key := driver + ":" + connstr
+
+	if db, ok := pools[key]; ok {
+		return db, nil
+	}
+
+	db, err := sql.Open(driver, connstr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if driver == "sqlite3" {
+		// SQLite allows only one writer. Keep single connection to avoid "database is locked" errors
+		db.SetMaxOpenConns(1)
+	} else if config.PoolMaxOpenConns > 0 {
+		db.SetMaxOpenConns(config.PoolMaxOpenConns)
+	}
+
+	if config.PoolMaxIdleConns != 0 {
+		db.SetMaxIdleConns(config.PoolMaxIdleConns)
+	} else {
+		db.SetMaxIdleConns(defaultPoolMaxIdleConns)
+	}
+
+	if config.PoolConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(time.Duration(config.PoolConnMaxLifetime) * time.Second)
+	}
+
+	if driver == "mysql" {
+		// this is the first connection to a server. Stop here if the server is not supported
+		version, err := detectServerVersion(db)
+
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		poolsVersions[key] = version
+	}
+
+	if driver == "sqlite3" {
+		// DB files made by old versions can have wrong types of columns
+		err = checkSQLiteKeyValueTables(db, config.TablesPrefix)
+
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	pools[key] = db
+
+	if config.PoolWaitTimeout > 0 {
+		poolsWaitTimeouts[db] = config.PoolWaitTimeout
+	} else {
+		poolsWaitTimeouts[db] = defaultPoolWaitTimeout
+	}
+
+	return db, nil
+}
+
+// Version of a server of a pool. The pool must be created before
+func getPoolServerVersion(driver, connstr string) ServerVersion {
+	poolsLock.Lock()
+	defer poolsLock.Unlock()
+
+	return poolsVersions[driver+":"+connstr]
+}
+
+// Takes a connection from a pool. database/sql waits for a free connection forever,
+// here it waits not longer than the wait timeout of the pool. The connection is returned to the pool with Close
+func takePoolConnection(db *sql.DB) (*sql.Conn, error) {
+	poolsLock.Lock()
+	timeout, ok := poolsWaitTimeouts[db]
+	poolsLock.Unlock()
+
+	if !ok {
+		timeout = defaultPoolWaitTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	conn, err := db.Conn(ctx)
+
+	if err == context.DeadlineExceeded {
+		return nil, NewTimeoutDBError(fmt.Sprintf("No free DB connection in a pool after %d seconds", timeout))
+	}
+	return conn, err
+}
+
+// Returns statistics of all pools of the process
+func GetPoolStats() PoolStats {
+	poolsLock.Lock()
+	defer poolsLock.Unlock()
+
+	result := PoolStats{}
+
+	for _, db := range pools {
+		stats := db.Stats()
+
+		result.MaxOpenConnections += stats.MaxOpenConnections
+		result.OpenConnections += stats.OpenConnections
+		result.InUse += stats.InUse
+		result.Idle += stats.Idle
+		result.WaitCount += stats.WaitCount
+		result.WaitDuration += stats.WaitDuration
+		result.MaxIdleClosed += stats.MaxIdleClosed
+		result.MaxLifetimeClosed += stats.MaxLifetimeClosed
+	}
+	return result
+}
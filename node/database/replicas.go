@@ -0,0 +1,108 @@
+package database
+
+/*
+* Read replicas. SELECT queries can be executed on replicas to keep the primary server free for
+* blocks applying. Replicas are used in turn
+ */
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// Full result of a SELECT query with columns info. Values are in text form
+type SelectResult struct {
+	Columns     []string
+	ColumnTypes []string
+	Rows        [][]sql.NullString
+}
+
+// counter to choose next replica
+var replicaCounter uint32
+
+// Execute SELECT query on next replica. Returns nil if there are no replicas
+func (bdm MySQLDBManager) ExecuteSQLSelectOnReplica(sqlcommand string) (*SelectResult, error) {
+	if !bdm.Config.HasReadReplicas() {
+		return nil, nil
+	}
+
+	n := atomic.AddUint32(&replicaCounter, 1)
+	dsn := bdm.Config.ReadReplicas[int(n)%len(bdm.Config.ReadReplicas)]
+
+	db, err := getPool("mysql", dsn, bdm.Config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := executeSelect(db, sqlcommand)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Replica query error: %s", err.Error()))
+	}
+	return result, nil
+}
+
+// Execute SELECT query on the primary server and return all rows with columns info
+func (bdm MySQLDBManager) ExecuteSQLSelectResult(sqlcommand string) (*SelectResult, error) {
+	db, err := bdm.getConnection()
+
+	if err != nil {
+		return nil, err
+	}
+	return executeSelect(db, sqlcommand)
+}
+
+func executeSelect(db *sql.DB, sqlcommand string) (*SelectResult, error) {
+	conn, err := takePoolConnection(db)
+
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(context.Background(), sqlcommand)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &SelectResult{}
+
+	result.Columns, err = rows.Columns()
+
+	if err != nil {
+		return nil, err
+	}
+
+	types, err := rows.ColumnTypes()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range types {
+		result.ColumnTypes = append(result.ColumnTypes, t.DatabaseTypeName())
+	}
+
+	for rows.Next() {
+		columns := make([]sql.NullString, len(result.Columns))
+		columnPointers := make([]interface{}, len(result.Columns))
+		for i, _ := range columns {
+			columnPointers[i] = &columns[i]
+		}
+
+		err = rows.Scan(columnPointers...)
+
+		if err != nil {
+			return nil, err
+		}
+		result.Rows = append(result.Rows, columns)
+	}
+
+	return result, rows.Err()
+}
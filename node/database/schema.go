@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/gelembjuk/oursql/lib/utils"
+)
+
+var createTableNameRegexp = regexp.MustCompile("(?is)^\\s*create\\s+table\\s+(?:if\\s+not\\s+exists\\s+)?(`[^`]+`|[^\\s(]+)")
+
+// Returns CREATE TABLE statement in the form how MySQL shows it for a table created with given statement.
+// Column types, defaults and keys are written by same rules as for existent tables, so statements can be compared.
+// A temporary table is created for this, it is visible only in one connection
+func (bdm MySQLDBManager) ExecuteSQLCanonicalCreateTable(createSQL string) (string, error) {
+	if bdm.Config.IsSQLite() {
+		// SQLite keeps statements as is
+		return createSQL, nil
+	}
+
+	m := createTableNameRegexp.FindStringSubmatch(createSQL)
+
+	if m == nil {
+		return "", errors.New("Not a CREATE TABLE statement")
+	}
+
+	table := strings.Trim(m[1], "`")
+
+	conn, err := bdm.takeConnection()
+
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+
+	tmpTable := "oursql_tmp_" + strings.ToLower(utils.RandString(8))
+
+	_, err = conn.ExecContext(ctx, "CREATE TEMPORARY TABLE `"+tmpTable+"`"+createSQL[len(m[0]):])
+
+	if err != nil {
+		return "", err
+	}
+	defer conn.ExecContext(ctx, "DROP TEMPORARY TABLE IF EXISTS `"+tmpTable+"`")
+
+	var name, create string
+
+	err = conn.QueryRowContext(ctx, "SHOW CREATE TABLE `"+tmpTable+"`").Scan(&name, &create)
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Replace(create, "CREATE TEMPORARY TABLE `"+tmpTable+"`", "CREATE TABLE `"+table+"`", 1), nil
+}
@@ -0,0 +1,135 @@
+package database
+
+/*
+* Shadow apply of a block. Queries are executed in a transaction which is always rolled back.
+* If some query fails or changes not the row declared in its transaction, the block is not applied,
+* so live tables never have a half of a block
+ */
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// One query of a block. If Table is set, the row with the key must exist (or must not exist) after the query
+type ShadowApplyStep struct {
+	Query     string
+	Table     string
+	KeyCol    string
+	KeyVal    string
+	RowExists bool
+}
+
+// Executes queries in a transaction and rolls it back. Returns index of a failed query, -1 if the
+// error is not related to some query
+func (bdm MySQLDBManager) ExecuteSQLShadowApply(steps []ShadowApplyStep) (int, error) {
+	span := bdm.startSpan("db shadow apply", "")
+	span.SetAttribute("db.queries", len(steps))
+
+	failed, err := bdm.executeSQLShadowApply(steps)
+
+	span.End(err)
+
+	return failed, err
+}
+
+func (bdm MySQLDBManager) executeSQLShadowApply(steps []ShadowApplyStep) (int, error) {
+	settings, err := bdm.Config.GetApplySettings()
+
+	if err != nil {
+		return -1, err
+	}
+
+	conn, err := bdm.takeConnection()
+
+	if err != nil {
+		return -1, err
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+
+	if bdm.Config.IsSQLite() {
+		tx, err := conn.BeginTx(ctx, nil)
+
+		if err != nil {
+			return -1, err
+		}
+		defer tx.Rollback()
+
+		return bdm.shadowSteps(tx, steps, settings, 0)
+	}
+
+	version, err := bdm.ExecuteSQLServerVersion()
+
+	if err != nil {
+		return -1, err
+	}
+
+	var connID int64
+
+	if settings.StatementTimeout > 0 {
+		err = conn.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&connID)
+
+		if err != nil {
+			return -1, err
+		}
+	}
+
+	_, err = prepareApplySession(conn, settings, version)
+
+	if err != nil {
+		return -1, err
+	}
+	defer resetApplySession(conn, version)
+
+	tx, err := conn.BeginTx(ctx, nil)
+
+	if err != nil {
+		return -1, err
+	}
+	defer tx.Rollback()
+
+	return bdm.shadowSteps(tx, steps, settings, connID)
+}
+
+func (bdm MySQLDBManager) shadowSteps(tx *sql.Tx, steps []ShadowApplyStep, settings ApplySettings, connID int64) (int, error) {
+	quoter := bdm.GetQuoter()
+
+	for i, step := range steps {
+		result, err := bdm.execWithTimeout(tx, step.Query, settings.StatementTimeout, connID)
+
+		if err != nil {
+			return i, err
+		}
+
+		if affected, err := result.RowsAffected(); err == nil && affected > 1 {
+			return i, errors.New(fmt.Sprintf("Query changed %d rows, a transaction can change one row", affected))
+		}
+
+		if step.Table == "" {
+			continue
+		}
+
+		var count int
+
+		err = tx.QueryRow("SELECT COUNT(*) FROM "+quoter.Identifier(strings.Trim(step.Table, "`"))+
+			" WHERE "+quoter.Identifier(step.KeyCol)+" = ?", step.KeyVal).Scan(&count)
+
+		if err != nil {
+			return i, err
+		}
+
+		if step.RowExists && count == 0 {
+			return i, errors.New(fmt.Sprintf("Row %s of %s is not found after the query", step.KeyVal, step.Table))
+		}
+
+		if !step.RowExists && count > 0 {
+			return i, errors.New(fmt.Sprintf("Row %s of %s still exists after the query", step.KeyVal, step.Table))
+		}
+	}
+	return -1, nil
+}
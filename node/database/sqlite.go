@@ -0,0 +1,181 @@
+package database
+
+/*
+* SQLite dialect. Used for lightweight nodes where there is no MySQL server.
+* Same manager is used, only queries that differ between engines are here
+ */
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Connection string for SQLite. Busy timeout allows to wait when other connection writes
+func (bdm *MySQLDBManager) getSQLiteConnString() string {
+	return "file:" + bdm.Config.SQLiteFile + "?_busy_timeout=5000"
+}
+
+// opens SQLite DB file. It is created if not exists. Pool has single connection
+func (bdm *MySQLDBManager) openSQLite() (*sql.DB, error) {
+	if bdm.Config.SQLiteFile == "" {
+		return nil, errors.New("SQLite file is not set")
+	}
+	return getPool("sqlite3", bdm.getSQLiteConnString(), bdm.Config)
+}
+
+// Checks key/value tables of a node have TEXT columns. Before it was fixed the tables were created
+// with MySQL types and SQLite could change keys and values like 000001 to numbers. Such DB can not be used
+func checkSQLiteKeyValueTables(db *sql.DB, prefix string) error {
+	for _, t := range []string{blocksTable, blockChainTable, dataReferencesTable, nodesTable,
+		transactionsTable, transactionsOutputsTable, unapprovedTransactionsTable, unspentTransactionsTable} {
+
+		rows, err := db.Query("SELECT name, type FROM pragma_table_info(" + Quoter{true}.Literal(prefix+t) + ") WHERE name IN ('k','v')")
+
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			var name, coltype string
+
+			err = rows.Scan(&name, &coltype)
+
+			if err == nil && strings.ToUpper(coltype) != "TEXT" {
+				err = errors.New(fmt.Sprintf("Column %s of the table %s has type %s, values in it can be broken. Create the DB file again and import the blockchain",
+					name, prefix+t, coltype))
+			}
+			if err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+	}
+	return nil
+}
+
+// list of tables in SQLite DB
+func (bdm MySQLDBManager) sqliteTablesList() ([]string, error) {
+	rows, err := bdm.ExecuteSQLSelectRows("SELECT name FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+
+	if err != nil {
+		return nil, err
+	}
+
+	tables := []string{}
+
+	for _, row := range rows {
+		tables = append(tables, row["name"])
+	}
+	return tables, nil
+}
+
+// primary key column of SQLite table
+func (bdm MySQLDBManager) sqlitePrimaryKey(table string) (string, error) {
+	row, err := bdm.ExecuteSQLSelectRow("SELECT name FROM pragma_table_info(" + bdm.GetQuoter().Literal(table) + ") WHERE pk=1")
+
+	if err != nil {
+		return "", err
+	}
+	return row["name"], nil
+}
+
+// Next key value. SQLite assigns it only for INTEGER PRIMARY KEY columns.
+// It is max of existent keys + 1 or next value from sqlite_sequence for AUTOINCREMENT tables
+func (bdm MySQLDBManager) sqliteNextKeyValue(table string) (string, error) {
+	row, err := bdm.ExecuteSQLSelectRow("SELECT name, type FROM pragma_table_info(" + bdm.GetQuoter().Literal(table) + ") WHERE pk=1")
+
+	if dberr, ok := err.(*DBError); ok && dberr.IsRowNotFound() {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if strings.ToUpper(row["type"]) != "INTEGER" {
+		return "", nil
+	}
+
+	row, err = bdm.ExecuteSQLSelectRow("SELECT IFNULL(MAX(`" + row["name"] + "`), 0) + 1 AS n FROM `" + table + "`")
+
+	if err != nil {
+		return "", err
+	}
+
+	next, err := strconv.Atoi(row["n"])
+
+	if err != nil {
+		return "", err
+	}
+
+	// there is no sqlite_sequence table if no AUTOINCREMENT tables in DB. ignore error
+	seqrow, err := bdm.ExecuteSQLSelectRow("SELECT seq FROM sqlite_sequence WHERE name=" + bdm.GetQuoter().Literal(table) + "")
+
+	if err == nil {
+		seq, err := strconv.Atoi(seqrow["seq"])
+
+		if err == nil && seq+1 > next {
+			next = seq + 1
+		}
+	}
+
+	return strconv.Itoa(next), nil
+}
+
+// table create statement
+func (bdm MySQLDBManager) sqliteCreateTable(table string) (string, error) {
+	row, err := bdm.ExecuteSQLSelectRow("SELECT sql FROM sqlite_master WHERE type='table' AND name=" + bdm.GetQuoter().Literal(table) + "")
+
+	if err != nil {
+		return "", err
+	}
+	return row["sql"], nil
+}
+
+// Dump all tables to a file as list of SQL queries
+func (bdm MySQLDBManager) sqliteDump(file string) error {
+	tables, err := bdm.sqliteTablesList()
+
+	if err != nil {
+		return err
+	}
+
+	list := []string{}
+
+	for _, table := range tables {
+		sqls, err := bdm.ExecuteSQLTableDump(table, 0, 0)
+
+		if err != nil {
+			return err
+		}
+		list = append(list, sqls...)
+	}
+
+	return ioutil.WriteFile(file, []byte(strings.Join(list, ";\n")+";\n"), 0644)
+}
+
+// Restores DB from a file with SQL queries. SQLite driver executes all statements in one call
+func (bdm *MySQLDBManager) sqliteRestore(file string) error {
+	db, err := bdm.openSQLite()
+
+	if err != nil {
+		return err
+	}
+
+	b, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(string(b))
+
+	return err
+}
@@ -0,0 +1,20 @@
+package database
+
+import (
+	"github.com/gelembjuk/oursql/lib/tracing"
+)
+
+// Span of a query in the trace of a request. Nil if the manager has no trace
+func (bdm MySQLDBManager) startSpan(name string, sql string) *tracing.Span {
+	span := bdm.Trace.Start(name, tracing.KindClient)
+
+	if bdm.Config.IsSQLite() {
+		span.SetAttribute("db.system", "sqlite")
+	} else {
+		span.SetAttribute("db.system", "mysql")
+	}
+	if sql != "" {
+		span.SetAttribute("db.statement", sql)
+	}
+	return span
+}
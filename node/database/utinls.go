@@ -1,5 +0,0 @@
-package database
-
-func Quote(s string) string {
-	return s
-}
@@ -0,0 +1,112 @@
+package database
+
+/*
+* Version of a DB server. It is detected when a pool of connections is created.
+* Some queries must be done differently on MySQL 8 and on MariaDB
+ */
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DB servers flavors
+const (
+	ServerFlavorMySQL   = "mysql"
+	ServerFlavorMariaDB = "mariadb"
+)
+
+// Minimum supported versions. Older servers don't have functions used by a node
+const (
+	minMySQLMajor   = 5
+	minMySQLMinor   = 6
+	minMariaDBMajor = 10
+	minMariaDBMinor = 1
+)
+
+var serverVersionRegexp = regexp.MustCompile("^(\\d+)\\.(\\d+)\\.(\\d+)")
+
+type ServerVersion struct {
+	Flavor string
+	Major  int
+	Minor  int
+	Patch  int
+	// version as the server returns it, like 8.0.36 or 10.6.16-MariaDB-1:10.6.16+maria~ubu2004
+	Full string
+}
+
+// Parses a result of VERSION()
+func ParseServerVersion(version string) (ServerVersion, error) {
+	v := ServerVersion{Full: version, Flavor: ServerFlavorMySQL}
+
+	// MariaDB 10 replication protocol adds "5.5.5-" prefix to the version
+	version = strings.TrimPrefix(version, "5.5.5-")
+
+	m := serverVersionRegexp.FindStringSubmatch(version)
+
+	if m == nil {
+		return v, errors.New(fmt.Sprintf("Can not parse DB server version %s", v.Full))
+	}
+
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	v.Patch, _ = strconv.Atoi(m[3])
+
+	if strings.Contains(strings.ToLower(version), "mariadb") {
+		v.Flavor = ServerFlavorMariaDB
+	}
+	return v, nil
+}
+
+func (v ServerVersion) IsMySQL() bool {
+	return v.Flavor == ServerFlavorMySQL
+}
+
+func (v ServerVersion) IsMariaDB() bool {
+	return v.Flavor == ServerFlavorMariaDB
+}
+
+// Check if version is same or newer
+func (v ServerVersion) AtLeast(major, minor int) bool {
+	return v.Major > major || v.Major == major && v.Minor >= minor
+}
+
+// Returns error if a node can not work with this server
+func (v ServerVersion) CheckSupported() error {
+	if v.IsMariaDB() && !v.AtLeast(minMariaDBMajor, minMariaDBMinor) {
+		return errors.New(fmt.Sprintf("MariaDB %s is not supported. Minimum version is %d.%d", v.Full, minMariaDBMajor, minMariaDBMinor))
+	}
+	if v.IsMySQL() && !v.AtLeast(minMySQLMajor, minMySQLMinor) {
+		return errors.New(fmt.Sprintf("MySQL %s is not supported. Minimum version is %d.%d", v.Full, minMySQLMajor, minMySQLMinor))
+	}
+	return nil
+}
+
+func (v ServerVersion) String() string {
+	if v.IsMariaDB() {
+		return "MariaDB " + v.Full
+	}
+	return "MySQL " + v.Full
+}
+
+// Reads version of a server and checks it is supported
+func detectServerVersion(db *sql.DB) (ServerVersion, error) {
+	var version string
+
+	err := db.QueryRow("SELECT VERSION()").Scan(&version)
+
+	if err != nil {
+		return ServerVersion{}, errors.New(fmt.Sprintf("Can not detect DB server version: %s", err.Error()))
+	}
+
+	v, err := ParseServerVersion(version)
+
+	if err != nil {
+		return v, err
+	}
+	return v, v.CheckSupported()
+}
@@ -0,0 +1,317 @@
+package dbquery
+
+/*
+* Large values of INSERT and UPDATE queries are moved out of a transaction. A literal is replaced with
+* OURSQL_BLOB('sha256 hex', size), bytes are saved to the storage of blobs. Before a query is executed,
+* the marker is replaced back with the literal. If the value is not in the storage, it is requested from other nodes
+ */
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gelembjuk/oursql/node/blobs"
+)
+
+// Requests a value from other nodes
+type BlobFetcher func(hash []byte, size int) ([]byte, error)
+
+var (
+	blobsStore   *blobs.Store
+	blobsMinSize int
+	blobsFetcher BlobFetcher
+)
+
+const blobMarkerPrefix = "OURSQL_BLOB("
+
+var blobMarkerRegexp = regexp.MustCompile("^OURSQL_BLOB\\('([0-9a-f]{64})',\\s*([0-9]+)\\)")
+
+// Sets the storage of values. Values of minSize bytes and more are moved out of transactions, 0 means
+// values are always in transactions. Values from other nodes are resolved in any case
+func SetBlobsStorage(store *blobs.Store, minSize int) {
+	blobsStore = store
+	blobsMinSize = minSize
+}
+
+func SetBlobsFetcher(fetcher BlobFetcher) {
+	blobsFetcher = fetcher
+}
+
+func GetBlobsStorage() *blobs.Store {
+	return blobsStore
+}
+
+func makeBlobMarker(hash []byte, size int) string {
+	return blobMarkerPrefix + "'" + hex.EncodeToString(hash) + "', " + strconv.Itoa(size) + ")"
+}
+
+func isIdentifierByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// Goes over literals and markers in SQL text. Callbacks get positions in the text.
+// Backslash escapes strings only in MySQL, double quotes are names in SQLite
+func scanSQLValues(text string, sqlite bool, onLiteral func(start, end int, value []byte), onMarker func(start, end int, hash []byte, size int)) {
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+
+		prevIdent := i > 0 && isIdentifierByte(text[i-1])
+
+		switch {
+		case c == '`' || c == '"' && sqlite:
+			// name
+			if e := strings.IndexByte(text[i+1:], c); e >= 0 {
+				i = i + 1 + e
+			} else {
+				return
+			}
+
+		case c == '/' && strings.HasPrefix(text[i:], "/*"):
+			if e := strings.Index(text[i+2:], "*/"); e >= 0 {
+				i = i + 2 + e + 1
+			} else {
+				return
+			}
+
+		case c == '\'' || c == '"':
+			start := i
+			hexLiteral := false
+
+			if i > 0 && (text[i-1] == 'x' || text[i-1] == 'X') && (i < 2 || !isIdentifierByte(text[i-2])) {
+				hexLiteral = true
+				start = i - 1
+			}
+
+			value := []byte{}
+			closed := false
+
+			for i = i + 1; i < len(text); i++ {
+				b := text[i]
+
+				if b == '\\' && !sqlite && i+1 < len(text) {
+					i++
+					value = append(value, unescapeMySQLByte(text[i])...)
+					continue
+				}
+				if b == c {
+					if i+1 < len(text) && text[i+1] == c {
+						// doubled quote
+						i++
+						value = append(value, c)
+						continue
+					}
+					closed = true
+					break
+				}
+				value = append(value, b)
+			}
+
+			if !closed {
+				return
+			}
+
+			if hexLiteral {
+				decoded, err := hex.DecodeString(string(value))
+
+				if err != nil {
+					continue
+				}
+				value = decoded
+			}
+
+			if onLiteral != nil {
+				onLiteral(start, i+1, value)
+			}
+
+		case c == '0' && !prevIdent && i+2 < len(text) && (text[i+1] == 'x' || text[i+1] == 'X'):
+			e := i + 2
+
+			for e < len(text) && isIdentifierByte(text[e]) {
+				e++
+			}
+
+			if decoded, err := hex.DecodeString(text[i+2 : e]); err == nil && onLiteral != nil {
+				onLiteral(i, e, decoded)
+			}
+			i = e - 1
+
+		case c == 'O' && !prevIdent && strings.HasPrefix(text[i:], blobMarkerPrefix):
+			m := blobMarkerRegexp.FindStringSubmatch(text[i:])
+
+			if m == nil {
+				continue
+			}
+
+			hash, _ := hex.DecodeString(m[1])
+			size, _ := strconv.Atoi(m[2])
+
+			if onMarker != nil {
+				onMarker(i, i+len(m[0]), hash, size)
+			}
+			i = i + len(m[0]) - 1
+		}
+	}
+}
+
+// Value of an escape sequence of MySQL string
+func unescapeMySQLByte(c byte) []byte {
+	switch c {
+	case '0':
+		return []byte{0}
+	case 'n':
+		return []byte{'\n'}
+	case 'r':
+		return []byte{'\r'}
+	case 't':
+		return []byte{'\t'}
+	case 'b':
+		return []byte{'\b'}
+	case 'Z':
+		return []byte{26}
+	case '%', '_':
+		// stay escaped, as in LIKE patterns
+		return []byte{'\\', c}
+	}
+	return []byte{c}
+}
+
+// Replaces large literals with markers. Values are saved to the storage.
+// A literal equal to keep (a value of a primary key) stays in the query
+func (qp queryProcessor) extractBlobs(query string, keep string) (string, error) {
+	if blobsStore == nil || blobsMinSize <= 0 || len(query) < blobsMinSize {
+		return query, nil
+	}
+
+	var result strings.Builder
+	last := 0
+
+	var err error
+
+	scanSQLValues(query, qp.DB.QM().GetQuoter().SQLite, func(start, end int, value []byte) {
+		if err != nil || len(value) < blobsMinSize || string(value) == keep {
+			return
+		}
+
+		var hash []byte
+
+		hash, err = blobsStore.Put(value)
+
+		if err != nil {
+			return
+		}
+
+		result.WriteString(query[last:start])
+		result.WriteString(makeBlobMarker(hash, len(value)))
+		last = end
+	}, nil)
+
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Can not save a value to the storage: %s", err.Error()))
+	}
+
+	result.WriteString(query[last:])
+
+	return result.String(), nil
+}
+
+// Replaces markers with literals. Values missed in the storage are requested from other nodes
+func (qp queryProcessor) resolveBlobs(query string) (string, error) {
+	if !strings.Contains(query, blobMarkerPrefix) {
+		return query, nil
+	}
+
+	quoter := qp.DB.QM().GetQuoter()
+
+	var result strings.Builder
+	last := 0
+
+	var err error
+
+	scanSQLValues(query, quoter.SQLite, nil, func(start, end int, hash []byte, size int) {
+		if err != nil {
+			return
+		}
+
+		var value []byte
+
+		value, err = qp.getBlob(hash, size)
+
+		if err != nil {
+			return
+		}
+
+		result.WriteString(query[last:start])
+		result.WriteString(quoter.Literal(string(value)))
+		last = end
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	result.WriteString(query[last:])
+
+	return result.String(), nil
+}
+
+// Replaces markers with empty strings. It is enough to check syntax of a query
+func (qp queryProcessor) blobsPlaceholders(query string) string {
+	if !strings.Contains(query, blobMarkerPrefix) {
+		return query
+	}
+
+	var result strings.Builder
+	last := 0
+
+	scanSQLValues(query, qp.DB.QM().GetQuoter().SQLite, nil, func(start, end int, hash []byte, size int) {
+		result.WriteString(query[last:start])
+		result.WriteString("''")
+		last = end
+	})
+
+	result.WriteString(query[last:])
+
+	return result.String()
+}
+
+func (qp queryProcessor) getBlob(hash []byte, size int) ([]byte, error) {
+	if blobsStore == nil {
+		return nil, errors.New("Storage of large values is not configured")
+	}
+
+	value, err := blobsStore.Get(hash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if value != nil {
+		return value, blobs.Verify(hash, size, value)
+	}
+
+	if blobsFetcher == nil {
+		return nil, errors.New(fmt.Sprintf("Value %x is not found in the storage", hash))
+	}
+
+	qp.Logger.Trace.Printf("Value %x is not found. Request it from other nodes", hash)
+
+	value, err = blobsFetcher(hash, size)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = blobs.Verify(hash, size, value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = blobsStore.Put(value)
+
+	return value, err
+}
@@ -0,0 +1,302 @@
+package dbquery
+
+/*
+* Columns which get values from the DB engine. DEFAULT CURRENT_TIMESTAMP, DEFAULT (UUID()) and similar
+* give different values on every node. Such defaults are calculated once, on a node where a query is made,
+* and the value is added to the INSERT, so every node writes same value.
+* ON UPDATE and generated columns with such functions can not be fixed this way, schemas with them are rejected
+ */
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gelembjuk/oursql/lib"
+	"github.com/gelembjuk/oursql/node/dbquery/sqlparser"
+)
+
+// Functions and keywords which return different values on different nodes
+var engineFunctionsRegexp = regexp.MustCompile("(?i)\\b(current_timestamp|current_date|current_time|localtime|localtimestamp|utc_timestamp|utc_date|utc_time)\\b|" +
+	"\\b(now|sysdate|curdate|curtime|uuid|uuid_short|rand|random|randomblob|connection_id|user|current_user|session_user|system_user|last_insert_id)\\s*\\(|" +
+	"\\bunix_timestamp\\s*\\(\\s*\\)")
+
+// SQLite date functions, datetime('now')
+var sqliteNowRegexp = regexp.MustCompile("(?i)\\(\\s*'now'")
+
+var columnDefaultRegexp = regexp.MustCompile("(?i)\\bdefault\\s+")
+var columnOnUpdateRegexp = regexp.MustCompile("(?i)\\bon\\s+update\\s+")
+var columnGeneratedRegexp = regexp.MustCompile("(?i)\\b(?:generated\\s+always\\s+)?as\\s*\\(")
+
+// first item of an expression, a literal or a word
+var columnExpressionStartRegexp = regexp.MustCompile("^('[^']*'|\"[^\"]*\"|[^\\s(,]+)")
+
+var alterColumnDefinitionRegexp = regexp.MustCompile("(?is)^(?:add|modify)\\s+(?:column\\s+)?(.+)$")
+var alterChangeColumnRegexp = regexp.MustCompile("(?is)^change\\s+(?:column\\s+)?(?:`[^`]+`|[^\\s]+)\\s+(.+)$")
+
+// Columns of a table with values made by the engine. Keys are lower case column names
+type tableColumns struct {
+	// expressions of non deterministic defaults
+	defaults map[string]string
+	// generated columns, they can not get values in INSERT
+	generated map[string]bool
+	// columns with ON UPDATE, they are set on every update of a row
+	onUpdate map[string]string
+	// names as in a create statement
+	names map[string]string
+}
+
+var tableColumnsCache map[string]*tableColumns
+var tableColumnsLock sync.RWMutex
+
+// Replaces text in quotes with spaces. Keywords are searched out of literals and names
+func maskSQLLiterals(text string) string {
+	b := []rune(text)
+
+	var quote rune
+	escaped := false
+
+	for i, c := range b {
+		if quote == 0 {
+			if c == '\'' || c == '"' || c == '`' {
+				quote = c
+			}
+			continue
+		}
+		if escaped {
+			escaped = false
+		} else if c == '\\' {
+			escaped = true
+		} else if c == quote {
+			quote = 0
+			continue
+		}
+		b[i] = ' '
+	}
+	return string(b)
+}
+
+// Expression after a keyword in a column definition. It is a literal, a word with optional arguments
+// or an expression in parenthesis
+func columnExpression(def string, keyword *regexp.Regexp) string {
+	masked := maskSQLLiterals(def)
+
+	loc := keyword.FindStringIndex(masked)
+
+	if loc == nil {
+		return ""
+	}
+
+	start := loc[1]
+
+	if strings.HasSuffix(masked[:start], "(") {
+		// generated column, the keyword includes opening parenthesis
+		start--
+	}
+
+	rest := masked[start:]
+
+	end := len(rest)
+
+	if strings.HasPrefix(rest, "(") {
+		if e := findClosingParenthesis(rest, 1); e >= 0 {
+			end = e + 1
+		}
+	} else if m := columnExpressionStartRegexp.FindStringIndex(rest); m != nil {
+		end = m[1]
+
+		if strings.HasPrefix(rest[end:], "(") {
+			if e := findClosingParenthesis(rest, end+1); e >= 0 {
+				end = e + 1
+			}
+		}
+	}
+	return def[start : start+end]
+}
+
+func isNonDeterministic(expr string) bool {
+	return engineFunctionsRegexp.MatchString(maskSQLLiterals(expr)) || sqliteNowRegexp.MatchString(expr)
+}
+
+// Checks a column definition. Error if the column gets different values on different nodes
+// and it can not be fixed by adding the value to queries
+func checkColumnDefinition(item TableSchemaItem) error {
+	if item.Kind != SchemaItemColumn {
+		return nil
+	}
+
+	if expr := columnExpression(item.Definition, columnGeneratedRegexp); expr != "" && isNonDeterministic(expr) {
+		return errors.New(fmt.Sprintf("Generated column %s uses non deterministic expression %s. Values would be different on nodes", item.Name, expr))
+	}
+
+	if expr := columnExpression(item.Definition, columnOnUpdateRegexp); expr != "" && isNonDeterministic(expr) {
+		return errors.New(fmt.Sprintf("Column %s has ON UPDATE %s. Values would be different on nodes. Remove it and set the value in UPDATE queries", item.Name, expr))
+	}
+	return nil
+}
+
+// Checks CREATE TABLE and ALTER TABLE queries for columns which can not be replicated
+func checkSchemaQuery(sqlparsed sqlparser.SQLQueryParserInterface) error {
+	query := sqlparsed.GetCanonicalQuery()
+
+	if sqlparsed.GetKind() == lib.QueryKindCreate {
+		schema, err := ParseCreateTable(query)
+
+		if err != nil {
+			// CREATE TABLE ... LIKE and CREATE TABLE ... SELECT. Columns are copied from other table
+			return nil
+		}
+
+		for _, item := range schema.Items {
+			if err := checkColumnDefinition(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if sqlparsed.GetKind() != lib.QueryKindAlter {
+		return nil
+	}
+
+	m := alterTableRegexp.FindStringSubmatch(query)
+
+	if m == nil {
+		return nil
+	}
+
+	for _, op := range SplitSQLList(m[2], ',') {
+		def := ""
+
+		if c := alterChangeColumnRegexp.FindStringSubmatch(op); c != nil {
+			def = c[1]
+		} else if c := alterColumnDefinitionRegexp.FindStringSubmatch(op); c != nil {
+			def = c[1]
+		}
+
+		if def == "" {
+			continue
+		}
+
+		if err := checkColumnDefinition(parseSchemaItem(def)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Columns of a table with values made by the engine. They are cached until the table is changed
+func (qp queryProcessor) getTableColumns(table string) (*tableColumns, error) {
+	tableColumnsLock.RLock()
+	c, ok := tableColumnsCache[table]
+	tableColumnsLock.RUnlock()
+
+	if ok {
+		return c, nil
+	}
+
+	create, err := qp.DB.QM().ExecuteSQLCreateTable(table)
+
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := ParseCreateTable(create)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c = &tableColumns{map[string]string{}, map[string]bool{}, map[string]string{}, map[string]string{}}
+
+	for _, item := range schema.Items {
+		if item.Kind != SchemaItemColumn {
+			continue
+		}
+		name := strings.ToLower(item.Name)
+
+		c.names[name] = item.Name
+
+		if expr := columnExpression(item.Definition, columnGeneratedRegexp); expr != "" {
+			c.generated[name] = true
+			continue
+		}
+
+		if expr := columnExpression(item.Definition, columnDefaultRegexp); expr != "" && isNonDeterministic(expr) {
+			c.defaults[name] = expr
+		}
+
+		if expr := columnExpression(item.Definition, columnOnUpdateRegexp); expr != "" && isNonDeterministic(expr) {
+			c.onUpdate[name] = expr
+		}
+	}
+
+	tableColumnsLock.Lock()
+
+	if tableColumnsCache == nil {
+		tableColumnsCache = make(map[string]*tableColumns)
+	}
+	tableColumnsCache[table] = c
+
+	tableColumnsLock.Unlock()
+
+	return c, nil
+}
+
+// Adds values of non deterministic defaults to INSERT. Every default is calculated by the DB engine of this node.
+// Checks UPDATE sets columns with ON UPDATE. Remembers generated columns, they are skipped in a rollback
+func (qp queryProcessor) patchEngineValues(parsed *QueryParsed) error {
+	kind := parsed.Structure.GetKind()
+
+	if kind != lib.QueryKindInsert && kind != lib.QueryKindUpdate && kind != lib.QueryKindDelete {
+		return nil
+	}
+
+	columns, err := qp.getTableColumns(parsed.Structure.GetTable())
+
+	if err != nil {
+		return err
+	}
+
+	parsed.GeneratedColumns = columns.generated
+
+	set := map[string]bool{}
+
+	for col := range parsed.Structure.GetUpdateColumns() {
+		set[strings.ToLower(strings.Trim(col, "`"))] = true
+	}
+
+	if kind == lib.QueryKindUpdate {
+		for col, expr := range columns.onUpdate {
+			if !set[col] {
+				return errors.New(fmt.Sprintf("Column %s has ON UPDATE %s. The value must be set in the query", columns.names[col], expr))
+			}
+		}
+		return nil
+	}
+
+	if kind != lib.QueryKindInsert {
+		return nil
+	}
+
+	for col, expr := range columns.defaults {
+		if set[col] {
+			continue
+		}
+
+		row, err := qp.DB.QM().ExecuteSQLSelectRow("SELECT " + expr + " AS v")
+
+		if err != nil {
+			return errors.New(fmt.Sprintf("Can not calculate default %s of %s: %s", expr, columns.names[col], err.Error()))
+		}
+
+		err = parsed.Structure.ExtendInsert(parsed.Quoter.Identifier(columns.names[col]), row["v"], "string")
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -8,10 +8,13 @@ import (
 
 type QueryProcessorInterface interface {
 	ParseQuery(sqlquery string, flags int) (QueryParsed, error)
-	ExecuteQuery(sql string) (*structures.SQLUpdate, error)
+	ExecuteQuery(sql string, flags int) (*structures.SQLUpdate, error)
 	ExecuteParsedQuery(qp QueryParsed) (*structures.SQLUpdate, error)
 	ExecuteQueryFromTX(sql structures.SQLUpdate) error
 	ExecuteRollbackQueryFromTX(sql structures.SQLUpdate) error
+	ExecuteQueriesFromTX(list []structures.SQLUpdate) (int, error)
+	ExecuteRollbackQueriesFromTX(list []structures.SQLUpdate) (int, error)
+	ShadowApplyQueriesFromTX(list []structures.SQLUpdate) (int, bool, error)
 	MakeSQLUpdateStructure(parsed QueryParsed) (structures.SQLUpdate, error)
 }
 
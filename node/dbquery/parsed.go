@@ -1,10 +1,13 @@
 package dbquery
 
 import (
+	"database/sql"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/gelembjuk/oursql/lib"
 	"github.com/gelembjuk/oursql/node/database"
@@ -18,14 +21,19 @@ type QueryParsed struct {
 	TransactionBytes []byte
 	KeyCol           string
 	KeyVal           string
-	RowBeforeQuery   map[string]string
+	RowBeforeQuery   map[string]sql.NullString
 	RowDoesNotExist  bool
+	TableBefore      *TableSchema
+	GeneratedColumns map[string]bool
 	Structure        sqlparser.SQLQueryParserInterface
+	// makes literals of values in rollback queries for the DB engine
+	Quoter database.Quoter
 }
 
 func (qp QueryParsed) ReferenceID() string {
 	if qp.Structure.GetKind() == lib.QueryKindCreate ||
-		qp.Structure.GetKind() == lib.QueryKindDrop {
+		qp.Structure.GetKind() == lib.QueryKindDrop ||
+		qp.Structure.GetKind() == lib.QueryKindAlter {
 		return qp.Structure.GetTable() + ":*"
 	}
 	return qp.Structure.GetTable() + ":" + qp.KeyVal
@@ -43,10 +51,11 @@ func (qp QueryParsed) IsUpdateOther() bool {
 	return qp.Structure.GetKind() == lib.QueryKindSet
 }
 
-// Info about a parsed query. Check if is update (insert, update, delete, create table, drop table)
+// Info about a parsed query. Check if is update (insert, update, delete, create table, drop table, alter table)
 func (qp QueryParsed) IsUpdate() bool {
 	return qp.Structure.GetKind() == lib.QueryKindCreate ||
 		qp.Structure.GetKind() == lib.QueryKindDrop ||
+		qp.Structure.GetKind() == lib.QueryKindAlter ||
 		qp.Structure.GetKind() == lib.QueryKindDelete ||
 		qp.Structure.GetKind() == lib.QueryKindInsert ||
 		qp.Structure.GetKind() == lib.QueryKindUpdate
@@ -61,6 +70,12 @@ func (qp QueryParsed) buildRollbackSQL() (string, error) {
 		// no rollback for this operation . this must be processed somehow differently
 		return "", nil
 	}
+	if qp.Structure.GetKind() == lib.QueryKindAlter {
+		if qp.TableBefore == nil {
+			return "", errors.New("Table structure before the query is not known")
+		}
+		return MakeAlterRollback(qp.Structure.GetCanonicalQuery(), qp.TableBefore)
+	}
 	if qp.Structure.GetKind() == lib.QueryKindInsert {
 
 		return qp.makeInsertRollback()
@@ -146,7 +161,7 @@ func (qp QueryParsed) parseInfoFromComments() (PubKey []byte, Signature []byte,
 
 // Build Insert operation rollback
 func (qp QueryParsed) makeInsertRollback() (sql string, err error) {
-	return "DELETE FROM " + qp.Structure.GetTable() + " WHERE " + qp.KeyCol + "='" + database.Quote(qp.KeyVal) + "'", nil
+	return "DELETE FROM " + qp.Structure.GetTable() + " WHERE " + qp.Quoter.Identifier(qp.KeyCol) + "=" + qp.Quoter.Literal(qp.KeyVal), nil
 }
 
 // Build Update operation rollback
@@ -158,40 +173,47 @@ func (qp QueryParsed) makeUpdateRollback() (sql string, err error) {
 	for col, _ := range qp.Structure.GetUpdateColumns() {
 		// for each column to be updated we have current values and we use it
 
-		if curVal, ok := qp.RowBeforeQuery[col]; ok {
+		if curVal, ok := qp.RowBeforeQuery[strings.Trim(col, "`")]; ok {
 			if !first {
 				sql = sql + ", "
 			} else {
 				first = false
 			}
 
-			sql = sql + " " + col + "='" + database.Quote(curVal) + "'"
+			sql = sql + " " + col + "=" + qp.Quoter.Nullable(curVal)
 		} else {
 			err = errors.New(fmt.Sprintf("Can not find current value for column %s", col))
 			return
 		}
 	}
 
-	sql = sql + " WHERE " + qp.KeyCol + "='" + database.Quote(qp.KeyVal) + "'"
+	sql = sql + " WHERE " + qp.Quoter.Identifier(qp.KeyCol) + "=" + qp.Quoter.Literal(qp.KeyVal)
 
 	return
 }
 
 // Build Delete operation rollback
 func (qp QueryParsed) makeDeleteRollback() (sql string, err error) {
-	sql = "INSERT INTO " + qp.Structure.GetTable() + " SET "
-
-	first := true
+	cols := []string{}
 
-	for col, curVal := range qp.RowBeforeQuery {
-		if !first {
-			sql = sql + ", "
-		} else {
-			first = false
+	for col := range qp.RowBeforeQuery {
+		// values of generated columns are made by the engine again
+		if qp.GeneratedColumns[strings.ToLower(col)] {
+			continue
 		}
+		cols = append(cols, col)
+	}
+	// same query for same row always
+	sort.Strings(cols)
+
+	values := []string{}
 
-		sql = sql + " " + col + "='" + database.Quote(curVal) + "'"
+	for i, col := range cols {
+		values = append(values, qp.Quoter.Nullable(qp.RowBeforeQuery[col]))
+		cols[i] = qp.Quoter.Identifier(col)
 	}
+	// this form of insert works both in MySQL and SQLite
+	sql = "INSERT INTO " + qp.Structure.GetTable() + " (" + strings.Join(cols, ", ") + ") VALUES (" + strings.Join(values, ", ") + ")"
 
 	return
 }
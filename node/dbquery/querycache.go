@@ -0,0 +1,278 @@
+package dbquery
+
+/*
+* Cache of SELECT results. A result is removed when any query changes one of tables used in the SELECT.
+* All queries of a node (pool transactions, blocks applying, rollbacks) go through this package, so
+* the cache always knows when data change. Queries passed by the proxy directly to the server must be
+* reported with InvalidateQueryCache.
+* Results are cached per MySQL user and database, a user gets only results of own queries
+ */
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gelembjuk/oursql/lib"
+	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/database"
+	"github.com/gelembjuk/oursql/node/dbquery/sqlparser"
+)
+
+// Results of these functions are different on each call
+var nonDeterministicRegexp = regexp.MustCompile("now\\s*\\(|rand\\s*\\(|uuid|sysdate|curdate|curtime|current_|utc_|unix_timestamp|" +
+	"last_insert_id|found_rows|row_count|connection_id|database\\s*\\(|user\\s*\\(|@|for\\s+update|lock\\s+in\\s+share\\s+mode|sql_no_cache")
+
+// Names after FROM, JOIN and commas. Commas give also column names, it is fine to have extra tables in the list
+var selectTablesRegexp = regexp.MustCompile("(?:\\bfrom|join|,)\\s*([a-z0-9_$.`]+)")
+
+type queryCacheEntry struct {
+	tables []string
+	result *database.SelectResult
+}
+
+type queryCache struct {
+	lock    sync.Mutex
+	size    int
+	entries map[string]*queryCacheEntry
+	order   []string
+	// increased on every change of a table. Used to not put result of a query executed while a table was changed
+	generations map[string]uint64
+	allChanges  uint64
+	hits        int64
+	misses      int64
+}
+
+// Cache statistics
+type QueryCacheStats struct {
+	Entries int
+	Hits    int64
+	Misses  int64
+}
+
+var resultsCache = &queryCache{}
+
+// Set max number of results in the cache. 0 disables the cache
+func SetQueryCacheSize(size int) {
+	resultsCache.lock.Lock()
+	defer resultsCache.lock.Unlock()
+
+	resultsCache.size = size
+	resultsCache.entries = map[string]*queryCacheEntry{}
+	resultsCache.order = []string{}
+	resultsCache.generations = map[string]uint64{}
+}
+
+func GetQueryCacheStats() QueryCacheStats {
+	resultsCache.lock.Lock()
+	defer resultsCache.lock.Unlock()
+
+	return QueryCacheStats{len(resultsCache.entries), resultsCache.hits, resultsCache.misses}
+}
+
+// Query which result is not in the cache yet. The result is added with Put
+type CachedQuery struct {
+	key        string
+	tables     []string
+	generation uint64
+}
+
+// Returns result of SELECT of a user in a database from the cache. If there is no result, returns a query
+// to add the result when it is executed. Both are nil if the query can not be cached
+func GetCachedSelect(user string, dbName string, sql string) (*database.SelectResult, *CachedQuery) {
+	key, tables, ok := queryCacheKey(user, dbName, sql)
+
+	if !ok || !resultsCache.enabled() {
+		return nil, nil
+	}
+
+	result, generation := resultsCache.get(key, tables)
+
+	if result != nil {
+		return result, nil
+	}
+	return nil, &CachedQuery{key, tables, generation}
+}
+
+// Add a result of a query to the cache. It is not added if any of tables was changed after the query was checked
+func (q *CachedQuery) Put(result *database.SelectResult) {
+	resultsCache.put(q.key, q.tables, q.generation, result)
+}
+
+// Remove results of queries using a table changed by this query. If a table is not known, all cache is cleaned
+func InvalidateQueryCache(sql string) {
+	if !resultsCache.enabled() {
+		return
+	}
+
+	parser := sqlparser.NewSqlParser()
+
+	err := parser.Parse(sql)
+
+	if err == nil && parser.GetKind() == lib.QueryKindSelect {
+		return
+	}
+
+	if err != nil || parser.GetTable() == "" {
+		resultsCache.invalidateAll()
+		return
+	}
+	resultsCache.invalidateTable(cacheTableName(parser.GetTable()))
+}
+
+// table name without a DB name
+func cacheTableName(table string) string {
+	table = strings.ToLower(strings.Replace(table, "`", "", -1))
+
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		table = table[i+1:]
+	}
+	return table
+}
+
+// Key of a query of a user in a database and list of tables. Returns false if a query can not be cached.
+// Changes are known only for tables of the database, queries with tables of other databases are not cached
+func queryCacheKey(user string, dbName string, sql string) (string, []string, bool) {
+	query := normalizeCacheQuery(sql)
+	lcase := strings.ToLower(query)
+
+	if !strings.HasPrefix(lcase, "select ") || nonDeterministicRegexp.MatchString(lcase) {
+		return "", nil, false
+	}
+
+	tables := []string{}
+
+	for _, m := range selectTablesRegexp.FindAllStringSubmatch(lcase, -1) {
+		name := strings.Replace(m[1], "`", "", -1)
+
+		if i := strings.LastIndex(name, "."); i >= 0 && name[:i] != strings.ToLower(dbName) {
+			return "", nil, false
+		}
+		tables = append(tables, cacheTableName(name))
+	}
+
+	if len(tables) == 0 {
+		return "", nil, false
+	}
+	return user + "\n" + dbName + "\n" + query, tables, true
+}
+
+// Collapse spaces outside of quoted values. Values are kept as is
+func normalizeCacheQuery(sql string) string {
+	sql = strings.TrimSpace(strings.Trim(strings.TrimSpace(sql), ";"))
+
+	var b strings.Builder
+	var quote rune
+	escaped := false
+	space := false
+
+	for _, c := range sql {
+		if quote != 0 {
+			b.WriteRune(c)
+
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			space = true
+			continue
+		}
+
+		if space {
+			b.WriteRune(' ')
+			space = false
+		}
+
+		if c == '\'' || c == '"' || c == '`' {
+			quote = c
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func (c *queryCache) enabled() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.size > 0
+}
+
+// returns cached result and current generation of tables if there is no result
+func (c *queryCache) get(key string, tables []string) (*database.SelectResult, uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if entry, ok := c.entries[key]; ok {
+		c.hits++
+		return entry.result, 0
+	}
+	c.misses++
+
+	return nil, c.generation(tables)
+}
+
+func (c *queryCache) put(key string, tables []string, generation uint64, result *database.SelectResult) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.size == 0 || c.generation(tables) != generation {
+		// something was changed while the query was executed
+		return
+	}
+
+	if _, ok := c.entries[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = &queryCacheEntry{tables, result}
+
+	// remove oldest results
+	for len(c.order) > c.size {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// sum of generations of tables. It changes if any of tables is changed
+func (c *queryCache) generation(tables []string) uint64 {
+	g := c.allChanges
+
+	for _, t := range tables {
+		g += c.generations[t]
+	}
+	return g
+}
+
+func (c *queryCache) invalidateTable(table string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.generations[table]++
+
+	order := []string{}
+
+	for _, key := range c.order {
+		if utils.StringInSlice(table, c.entries[key].tables) {
+			delete(c.entries, key)
+			continue
+		}
+		order = append(order, key)
+	}
+	c.order = order
+}
+
+func (c *queryCache) invalidateAll() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.allChanges++
+	c.entries = map[string]*queryCacheEntry{}
+	c.order = []string{}
+}
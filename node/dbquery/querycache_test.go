@@ -0,0 +1,207 @@
+package dbquery
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/gelembjuk/oursql/node/database"
+)
+
+func testSelectResult(value string) *database.SelectResult {
+	return &database.SelectResult{Columns: []string{"a"}, ColumnTypes: []string{"VARCHAR"},
+		Rows: [][]sql.NullString{[]sql.NullString{sql.NullString{String: value, Valid: true}}}}
+}
+
+func TestQueryCacheKey(t *testing.T) {
+	// query => tables, empty if it can not be cached
+	queries := map[string]string{
+		"SELECT a FROM t WHERE id=1":                 "t",
+		" select  a\tFROM  `t`  WHERE id=1 ; ":       "t",
+		"SELECT a FROM db.t WHERE id=1":              "t",
+		"SELECT a FROM t JOIN u ON t.id=u.id":        "t,u",
+		"SELECT a FROM other.t WHERE id=1":           "",
+		"SELECT a FROM t WHERE b=NOW()":              "",
+		"SELECT a FROM t WHERE id=@x":                "",
+		"SELECT a FROM t WHERE id=1 FOR UPDATE":      "",
+		"SELECT LAST_INSERT_ID()":                    "",
+		"SELECT 1":                                   "",
+		"UPDATE t SET a=1":                           "",
+		"SELECT a FROM t WHERE b=RAND()":             "",
+		"SELECT a FROM t WHERE b=database()":         "",
+		"SELECT SQL_NO_CACHE a FROM t WHERE b=1":     "",
+		"SELECT a FROM t WHERE b='x  y' AND c=\"z\"": "t",
+	}
+
+	for query, expected := range queries {
+		_, tables, ok := queryCacheKey("u", "db", query)
+
+		if expected == "" {
+			if ok {
+				t.Fatalf("Query can not be cached: %s", query)
+			}
+			continue
+		}
+
+		if !ok {
+			t.Fatalf("Query must be cached: %s", query)
+		}
+
+		list := ""
+
+		for _, table := range tables {
+			if table == "id" || table == "c" {
+				// names after commas and in conditions are fine in the list
+				continue
+			}
+			if list != "" {
+				list += ","
+			}
+			list += table
+		}
+
+		if list != expected {
+			t.Fatalf("Tables %s, expected %s for %s", list, expected, query)
+		}
+	}
+
+	// spaces are collapsed only outside of values
+	k1, _, _ := queryCacheKey("u", "db", "SELECT a  FROM t WHERE b='x  y'")
+	k2, _, _ := queryCacheKey("u", "db", "SELECT a FROM t\nWHERE b='x  y';")
+	k3, _, _ := queryCacheKey("u", "db", "SELECT a FROM t WHERE b='x y'")
+
+	if k1 != k2 {
+		t.Fatalf("Same queries have different keys: %s and %s", k1, k2)
+	}
+	if k1 == k3 {
+		t.Fatalf("Different values have same key: %s", k1)
+	}
+}
+
+func TestQueryCacheUsersAndDatabases(t *testing.T) {
+	SetQueryCacheSize(10)
+	defer SetQueryCacheSize(0)
+
+	query := "SELECT a FROM t WHERE id=1"
+	before := GetQueryCacheStats()
+
+	result, cached := GetCachedSelect("u1", "db", query)
+
+	if result != nil || cached == nil {
+		t.Fatalf("Empty cache returns a result")
+	}
+	cached.Put(testSelectResult("u1"))
+
+	if result, _ := GetCachedSelect("u1", "db", query); result == nil || result.Rows[0][0].String != "u1" {
+		t.Fatalf("Result is not cached")
+	}
+
+	// other users and databases don't get the result
+	if result, cached := GetCachedSelect("u2", "db", query); result != nil || cached == nil {
+		t.Fatalf("Result of other user is returned")
+	}
+	if result, cached := GetCachedSelect("u1", "db2", query); result != nil || cached == nil {
+		t.Fatalf("Result of other database is returned")
+	}
+
+	// not cached queries return nothing
+	if result, cached := GetCachedSelect("u1", "db", "SELECT NOW()"); result != nil || cached != nil {
+		t.Fatalf("Not cached query returns a cache query")
+	}
+
+	stats := GetQueryCacheStats()
+
+	if stats.Entries != 1 || stats.Hits-before.Hits != 1 || stats.Misses-before.Misses != 3 {
+		t.Fatalf("Wrong stats %v", stats)
+	}
+}
+
+func TestQueryCacheInvalidate(t *testing.T) {
+	SetQueryCacheSize(10)
+	defer SetQueryCacheSize(0)
+
+	for _, q := range []string{"SELECT a FROM t WHERE id=1", "SELECT a FROM t2 WHERE id=1"} {
+		_, cached := GetCachedSelect("u", "db", q)
+		cached.Put(testSelectResult(q))
+	}
+
+	InvalidateQueryCache("UPDATE `db`.`t` SET a=2 WHERE id=1")
+
+	if result, _ := GetCachedSelect("u", "db", "SELECT a FROM t WHERE id=1"); result != nil {
+		t.Fatalf("Result of changed table is returned")
+	}
+	if result, _ := GetCachedSelect("u", "db", "SELECT a FROM t2 WHERE id=1"); result == nil {
+		t.Fatalf("Result of other table is removed")
+	}
+
+	// selects don't change the cache
+	InvalidateQueryCache("SELECT a FROM t2")
+
+	if result, _ := GetCachedSelect("u", "db", "SELECT a FROM t2 WHERE id=1"); result == nil {
+		t.Fatalf("Result is removed by SELECT")
+	}
+
+	// a not parsed query removes all
+	InvalidateQueryCache("not a query")
+
+	if result, _ := GetCachedSelect("u", "db", "SELECT a FROM t2 WHERE id=1"); result != nil {
+		t.Fatalf("Result is returned after unknown change")
+	}
+}
+
+func TestQueryCachePutAfterChange(t *testing.T) {
+	SetQueryCacheSize(10)
+	defer SetQueryCacheSize(0)
+
+	query := "SELECT a FROM t WHERE id=1"
+
+	_, cached := GetCachedSelect("u", "db", query)
+
+	// the table is changed while the query is executed
+	InvalidateQueryCache("UPDATE t SET a=2 WHERE id=1")
+
+	cached.Put(testSelectResult("old"))
+
+	if result, _ := GetCachedSelect("u", "db", query); result != nil {
+		t.Fatalf("Result executed before a change is cached")
+	}
+
+	_, cached = GetCachedSelect("u", "db", query)
+
+	InvalidateQueryCache("UPDATE t2 SET a=2 WHERE id=1")
+
+	cached.Put(testSelectResult("new"))
+
+	if result, _ := GetCachedSelect("u", "db", query); result == nil {
+		t.Fatalf("Result is not cached after a change of other table")
+	}
+}
+
+func TestQueryCacheSize(t *testing.T) {
+	SetQueryCacheSize(2)
+	defer SetQueryCacheSize(0)
+
+	queries := []string{"SELECT a FROM t WHERE id=1", "SELECT a FROM t WHERE id=2", "SELECT a FROM t WHERE id=3"}
+
+	for _, q := range queries {
+		_, cached := GetCachedSelect("u", "db", q)
+		cached.Put(testSelectResult(q))
+	}
+
+	if stats := GetQueryCacheStats(); stats.Entries != 2 {
+		t.Fatalf("Cache has %d entries, expected 2", stats.Entries)
+	}
+
+	// oldest result is removed
+	if result, _ := GetCachedSelect("u", "db", queries[0]); result != nil {
+		t.Fatalf("Oldest result is not removed")
+	}
+	if result, _ := GetCachedSelect("u", "db", queries[2]); result == nil {
+		t.Fatalf("Last result is removed")
+	}
+
+	SetQueryCacheSize(0)
+
+	if result, cached := GetCachedSelect("u", "db", queries[2]); result != nil || cached != nil {
+		t.Fatalf("Disabled cache is used")
+	}
+}
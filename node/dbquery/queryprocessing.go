@@ -1,8 +1,10 @@
 package dbquery
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/gelembjuk/oursql/lib"
 	"github.com/gelembjuk/oursql/lib/utils"
@@ -11,7 +13,9 @@ import (
 	"github.com/gelembjuk/oursql/node/structures"
 )
 
+// Primary key columns of tables. A table is removed from it when a query changing a structure is executed
 var primaryKeysCache map[string]string
+var primaryKeysLock sync.RWMutex
 
 type queryProcessor struct {
 	DB     database.DBManager
@@ -35,6 +39,15 @@ func (qp queryProcessor) ParseQuery(sqlquery string, flags int) (r QueryParsed,
 		return
 	}
 
+	if flags&lib.TXFlagsNewQuery > 0 {
+		// other nodes and old blocks can have such schemas, only new queries are checked
+		err = checkSchemaQuery(r.Structure)
+
+		if err != nil {
+			return
+		}
+	}
+
 	// this will extract key column, its value, check if it is present
 	err = qp.patchRowInfo(&r, flags)
 
@@ -43,6 +56,15 @@ func (qp queryProcessor) ParseQuery(sqlquery string, flags int) (r QueryParsed,
 		return
 	}
 
+	if flags&lib.TXFlagsNewQuery > 0 {
+		// values of the engine must be same on all nodes. A query from a transaction has them already
+		err = qp.patchEngineValues(&r)
+
+		if err != nil {
+			return
+		}
+	}
+
 	r.PubKey, r.Signature, r.TransactionBytes, err = r.parseInfoFromComments()
 
 	if err != nil {
@@ -51,6 +73,15 @@ func (qp queryProcessor) ParseQuery(sqlquery string, flags int) (r QueryParsed,
 
 	r.SQL = r.Structure.GetCanonicalQuery()
 
+	if r.Structure.GetKind() == lib.QueryKindInsert || r.Structure.GetKind() == lib.QueryKindUpdate {
+		// large values are not kept in a transaction
+		r.SQL, err = qp.extractBlobs(r.SQL, r.KeyVal)
+
+		if err != nil {
+			return
+		}
+	}
+
 	return r, nil
 }
 
@@ -60,7 +91,7 @@ func (qp queryProcessor) checkQuerySyntax(sqlparsed sqlparser.SQLQueryParserInte
 		sqlparsed.GetKind() == lib.QueryKindDelete ||
 		sqlparsed.GetKind() == lib.QueryKindUpdate {
 
-		_, err := qp.DB.QM().ExecuteSQLExplain(sqlparsed.GetCanonicalQuery())
+		_, err := qp.DB.QM().ExecuteSQLExplain(qp.blobsPlaceholders(sqlparsed.GetCanonicalQuery()))
 
 		if err != nil {
 			return errors.New(fmt.Sprintf("Syntax check error: %s", err.Error()))
@@ -74,31 +105,31 @@ func (qp queryProcessor) checkQuerySyntax(sqlparsed sqlparser.SQLQueryParserInte
 // return a row
 // if it is insert, try to get next autoincrement
 func (qp queryProcessor) patchRowInfo(parsed *QueryParsed, flags int) (err error) {
+	if parsed.Structure.GetKind() == lib.QueryKindAlter {
+		// structure of a table is needed to build rollback
+		var create string
+
+		create, err = qp.DB.QM().ExecuteSQLCreateTable(parsed.Structure.GetTable())
+
+		if err != nil {
+			return
+		}
+		parsed.TableBefore, err = ParseCreateTable(create)
+		return
+	}
 	if parsed.Structure.GetKind() != lib.QueryKindUpdate &&
 		parsed.Structure.GetKind() != lib.QueryKindDelete &&
 		parsed.Structure.GetKind() != lib.QueryKindInsert {
 		return
 	}
-	var keyCol string
-
-	if primaryKeysCache != nil {
-		if k, ok := primaryKeysCache[parsed.Structure.GetTable()]; ok {
-			keyCol = k
-		}
-	}
-	if keyCol == "" {
-		keyCol, err = qp.DB.QM().ExecuteSQLPrimaryKey(parsed.Structure.GetTable())
+	keyCol, err := qp.getPrimaryKey(parsed.Structure.GetTable())
 
-		if err != nil {
-			return
-		}
-		if primaryKeysCache == nil {
-			primaryKeysCache = make(map[string]string, 0)
-		}
-		primaryKeysCache[parsed.Structure.GetTable()] = keyCol
+	if err != nil {
+		return
 	}
 
 	parsed.KeyCol = keyCol
+	parsed.Quoter = qp.DB.QM().GetQuoter()
 
 	if parsed.Structure.GetKind() == lib.QueryKindUpdate ||
 		parsed.Structure.GetKind() == lib.QueryKindDelete {
@@ -110,11 +141,9 @@ func (qp queryProcessor) patchRowInfo(parsed *QueryParsed, flags int) (err error
 			return
 		}
 
-		sqlquery := "SELECT * FROM " + parsed.Structure.GetTable() + " WHERE " + keyCol + "='" + database.Quote(cVal) + "'"
-
-		var currentRow map[string]string
+		var currentRow map[string]sql.NullString
 
-		currentRow, err = qp.DB.QM().ExecuteSQLSelectRow(sqlquery)
+		currentRow, err = qp.DB.QM().ExecuteSQLRowByKey(parsed.Structure.GetTable(), keyCol, cVal)
 
 		parsed.RowDoesNotExist = false
 
@@ -190,9 +219,68 @@ func (qp queryProcessor) patchRowInfo(parsed *QueryParsed, flags int) (err error
 	return
 }
 
+// Primary key column of a table. It is cached until the table is altered
+func (qp queryProcessor) getPrimaryKey(table string) (string, error) {
+	primaryKeysLock.RLock()
+	k, ok := primaryKeysCache[table]
+	primaryKeysLock.RUnlock()
+
+	if ok {
+		return k, nil
+	}
+	keyCol, err := qp.DB.QM().ExecuteSQLPrimaryKey(table)
+
+	if err != nil {
+		return "", err
+	}
+	primaryKeysLock.Lock()
+
+	if primaryKeysCache == nil {
+		primaryKeysCache = make(map[string]string, 0)
+	}
+	primaryKeysCache[table] = keyCol
+
+	primaryKeysLock.Unlock()
+
+	return keyCol, nil
+}
+
+// Forgets a primary key and columns of a table after a query changed a structure of it. Queries from
+// transactions and rollbacks can be not parsed, then all tables are forgotten
+func forgetTableStructure(sql string) {
+	parser := sqlparser.NewSqlParser()
+
+	err := parser.Parse(sql)
+
+	if err == nil && !parser.IsTableManage() {
+		return
+	}
+
+	all := err != nil || parser.GetTable() == ""
+
+	primaryKeysLock.Lock()
+
+	if all {
+		primaryKeysCache = nil
+	} else {
+		delete(primaryKeysCache, parser.GetTable())
+	}
+	primaryKeysLock.Unlock()
+
+	tableColumnsLock.Lock()
+
+	if all {
+		tableColumnsCache = nil
+	} else {
+		delete(tableColumnsCache, parser.GetTable())
+	}
+	tableColumnsLock.Unlock()
+}
+
 // execute query against a DB, returns SQLUpdate. Detects RefID and builds rollback
-func (qp queryProcessor) ExecuteQuery(sql string) (*structures.SQLUpdate, error) {
-	qparsed, err := qp.ParseQuery(sql, 0)
+// flags are passed to ParseQuery, TXFlagsNewQuery if the query is made on this node
+func (qp queryProcessor) ExecuteQuery(sql string, flags int) (*structures.SQLUpdate, error) {
+	qparsed, err := qp.ParseQuery(sql, flags)
 
 	if err != nil {
 		return nil, err
@@ -209,22 +297,118 @@ func (qp queryProcessor) ExecuteParsedQuery(parsed QueryParsed) (*structures.SQL
 		return nil, err
 	}
 
-	err = qp.DB.QM().ExecuteSQL(parsed.SQL)
+	query, err := qp.resolveBlobs(parsed.SQL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = qp.DB.QM().ExecuteSQL(query)
+
+	InvalidateQueryCache(parsed.SQL)
 
 	if err != nil {
 		return nil, err
 	}
+	RememberWrite(parsed.SQL)
+	forgetTableStructure(parsed.SQL)
+
 	return &su, err
 }
 
 // Execute query from TX
 func (qp queryProcessor) ExecuteQueryFromTX(sql structures.SQLUpdate) error {
-	return qp.DB.QM().ExecuteSQL(string(sql.Query))
+	defer InvalidateQueryCache(string(sql.Query))
+
+	query, err := qp.resolveBlobs(string(sql.Query))
+
+	if err != nil {
+		return err
+	}
+
+	err = qp.DB.QM().ExecuteSQLApply(query)
+
+	if err == nil {
+		RememberWrite(string(sql.Query))
+		forgetTableStructure(string(sql.Query))
+	}
+	return err
 }
 
 // Execute rollback query from TX
 func (qp queryProcessor) ExecuteRollbackQueryFromTX(sql structures.SQLUpdate) error {
-	return qp.DB.QM().ExecuteSQL(string(sql.RollbackQuery))
+	defer InvalidateQueryCache(string(sql.RollbackQuery))
+
+	query, err := qp.resolveBlobs(string(sql.RollbackQuery))
+
+	if err != nil {
+		return err
+	}
+
+	err = qp.DB.QM().ExecuteSQLApply(query)
+
+	if err == nil {
+		RememberWrite(string(sql.RollbackQuery))
+		forgetTableStructure(string(sql.RollbackQuery))
+	}
+	return err
+}
+
+// Execute queries of transactions of a block in one DB session. Returns index of a failed query,
+// -1 if the error is not related to some query
+func (qp queryProcessor) ExecuteQueriesFromTX(list []structures.SQLUpdate) (int, error) {
+	queries := []string{}
+
+	for _, sql := range list {
+		queries = append(queries, string(sql.Query))
+	}
+	return qp.executeQueriesList(queries)
+}
+
+// Execute rollback queries of transactions in one DB session, in order of the list
+func (qp queryProcessor) ExecuteRollbackQueriesFromTX(list []structures.SQLUpdate) (int, error) {
+	queries := []string{}
+
+	for _, sql := range list {
+		queries = append(queries, string(sql.RollbackQuery))
+	}
+	return qp.executeQueriesList(queries)
+}
+
+func (qp queryProcessor) executeQueriesList(queries []string) (int, error) {
+	resolved := []string{}
+
+	for i, sql := range queries {
+		query, err := qp.resolveBlobs(sql)
+
+		if err != nil {
+			return i, err
+		}
+		resolved = append(resolved, query)
+	}
+
+	failed, err := qp.DB.QM().ExecuteSQLApplyList(resolved)
+
+	executed := len(queries)
+
+	if err != nil {
+		// the error is not related to a query when connection is lost, any query can be executed
+		executed = 0
+
+		if failed >= 0 {
+			executed = failed
+		}
+	}
+
+	for i, sql := range queries {
+		InvalidateQueryCache(sql)
+
+		if i < executed {
+			RememberWrite(sql)
+			forgetTableStructure(sql)
+		}
+	}
+	return failed, err
 }
 
 // Builds SQL update structure. It fins ID of a record, and build rollback query
@@ -233,6 +417,12 @@ func (qp queryProcessor) MakeSQLUpdateStructure(parsed QueryParsed) (sqlupdate s
 
 	rollSQL, err := parsed.buildRollbackSQL()
 
+	if err != nil {
+		return
+	}
+
+	rollSQL, err = qp.extractBlobs(rollSQL, parsed.KeyVal)
+
 	if err != nil {
 		return
 	}
@@ -3,6 +3,7 @@ package dbquery
 import (
 	"testing"
 
+	"github.com/gelembjuk/oursql/lib"
 	"github.com/gelembjuk/oursql/lib/utils"
 	"github.com/gelembjuk/oursql/node/database"
 )
@@ -21,14 +22,14 @@ func TestParsingUpdate(t *testing.T) {
 		" UPDATE t SET a='b' WHERE id='1';":            []string{"UPDATE t SET a='b' WHERE id='1'", "update", "t:1", "", "", ""},
 		" UPDATE t SET a='b' WHERE id = 'tt\\\"oo' ; ": []string{"UPDATE t SET a='b' WHERE id = 'tt\\\"oo'", "update", "t:tt\"oo", "", "", ""},
 		//" UPDATE t SET a='b' WHERE id = 'tt\\\"oo\\'' ; ":                                     []string{"UPDATE t SET a='b' WHERE id = 'tt\\\"oo\\''", "update", "t:tt\"oo'", "", "", ""},
-		" UPDATE t SET a='b',c = 'X', d = 2 WHERE id='1' ":                                    []string{"UPDATE t SET a='b',c = 'X', d = 2 WHERE id='1'", "update", "t:1", "", "", ""},
-		" UPDATE t SET a='b',c = 'X', d = 2 WHERE id='1' /*SIGN:XXXXXX;DATA:YYYYYYYYYYYYY;*/": []string{"UPDATE t SET a='b',c = 'X', d = 2 WHERE id='1'", "update", "t:1", "", "", ""},
-		"UPDATE t SET a='b',c = 'X', d = 2 WHERE id='2' /*PUBKEY:ZZZZZZZZ;*/":                 []string{"UPDATE t SET a='b',c = 'X', d = 2 WHERE id='2'", "update", "t:2", "", "", ""}}
+		" UPDATE t SET a='b',c = 'X', d = 2 WHERE id='1' ":                             []string{"UPDATE t SET a='b',c = 'X', d = 2 WHERE id='1'", "update", "t:1", "", "", ""},
+		" UPDATE t SET a='b',c = 'X', d = 2 WHERE id='1' /*SIGN:0a0b0c;DATA:0d0e0f;*/": []string{"UPDATE t SET a='b',c = 'X', d = 2 WHERE id='1'", "update", "t:1", "", "", ""},
+		"UPDATE t SET a='b',c = 'X', d = 2 WHERE id='2' /*PUBKEY:0a0b0c0d;*/":          []string{"UPDATE t SET a='b',c = 'X', d = 2 WHERE id='2'", "update", "t:2", "", "", ""}}
 
 	qp := NewQueryProcessor(&DBM, utils.CreateLoggerStdout())
 
 	for sql, res := range sqls {
-		parsed, err := qp.ParseQuery(sql)
+		parsed, err := qp.ParseQuery(sql, 0)
 
 		if err != nil {
 			t.Fatalf("Parse error: %s for %s", err.Error(), sql)
@@ -50,3 +51,51 @@ func TestParsingUpdate(t *testing.T) {
 	}
 
 }
+
+func TestForgetTableStructure(t *testing.T) {
+	primaryKeysCache = map[string]string{"t": "id", "u": "id"}
+	tableColumnsCache = map[string]*tableColumns{"t": &tableColumns{}, "u": &tableColumns{}}
+	defer func() {
+		primaryKeysCache = nil
+		tableColumnsCache = nil
+	}()
+
+	forgetTableStructure("UPDATE t SET a=1 WHERE id=1")
+
+	if len(primaryKeysCache) != 2 || len(tableColumnsCache) != 2 {
+		t.Fatalf("Table is forgotten after data update")
+	}
+
+	forgetTableStructure("ALTER TABLE t DROP PRIMARY KEY, ADD PRIMARY KEY (a)")
+
+	if _, ok := primaryKeysCache["t"]; ok || len(primaryKeysCache) != 1 {
+		t.Fatalf("Key of altered table is not forgotten: %v", primaryKeysCache)
+	}
+	if _, ok := tableColumnsCache["t"]; ok || len(tableColumnsCache) != 1 {
+		t.Fatalf("Columns of altered table are not forgotten")
+	}
+
+	forgetTableStructure("not a query")
+
+	if len(primaryKeysCache) != 0 || len(tableColumnsCache) != 0 {
+		t.Fatalf("Tables are not forgotten after unknown query")
+	}
+}
+
+func TestParsingNewQueryOnly(t *testing.T) {
+	DBM := database.GetDBManagerMock()
+	DBM.SetSQLExplain(&database.SQLExplainInfo{})
+
+	qp := NewQueryProcessor(&DBM, utils.CreateLoggerStdout())
+
+	create := "CREATE TABLE t (id int PRIMARY KEY, changed timestamp DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP)"
+
+	if _, err := qp.ParseQuery(create, lib.TXFlagsNewQuery); err == nil {
+		t.Fatalf("New query with ON UPDATE CURRENT_TIMESTAMP is accepted")
+	}
+
+	// same query in a transaction from other node or in an old block
+	if _, err := qp.ParseQuery(create, 0); err != nil {
+		t.Fatalf("Query from a transaction is rejected: %s", err.Error())
+	}
+}
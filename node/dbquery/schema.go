@@ -0,0 +1,519 @@
+package dbquery
+
+/*
+* Structure of tables. It is used to build rollback of ALTER TABLE queries and to find
+* a difference between current tables and a desired schema for migrations
+ */
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	SchemaItemColumn  = "column"
+	SchemaItemPrimary = "primary"
+	SchemaItemIndex   = "index"
+	SchemaItemForeign = "foreign"
+	SchemaItemCheck   = "check"
+)
+
+var createTableRegexp = regexp.MustCompile("(?is)^\\s*create\\s+table\\s+(?:if\\s+not\\s+exists\\s+)?(`[^`]+`|[^\\s(]+)\\s*\\(")
+var alterTableRegexp = regexp.MustCompile("(?is)^\\s*alter\\s+table\\s+(`[^`]+`|[^\\s]+)\\s+(.+)$")
+var schemaTokenRegexp = regexp.MustCompile("`[^`]*`|\\(|[^\\s(`]+")
+
+// Table structure. Items are columns, keys and constraints in order of a create statement
+type TableSchema struct {
+	Name   string
+	Create string
+	Items  []TableSchemaItem
+}
+
+// Column or index of a table. Definition is a text of it in a create statement
+type TableSchemaItem struct {
+	Kind       string
+	Name       string
+	Definition string
+}
+
+// Parses CREATE TABLE statement
+func ParseCreateTable(create string) (*TableSchema, error) {
+	m := createTableRegexp.FindStringSubmatchIndex(create)
+
+	if m == nil {
+		return nil, errors.New("Can not parse CREATE TABLE statement")
+	}
+
+	schema := TableSchema{}
+	schema.Name = strings.Trim(create[m[2]:m[3]], "`")
+	schema.Create = create
+
+	bodyStart := m[1]
+	bodyEnd := findClosingParenthesis(create, bodyStart)
+
+	if bodyEnd < 0 {
+		return nil, errors.New("Can not parse CREATE TABLE statement. Columns list is not closed")
+	}
+
+	for _, def := range SplitSQLList(create[bodyStart:bodyEnd], ',') {
+		schema.Items = append(schema.Items, parseSchemaItem(def))
+	}
+	return &schema, nil
+}
+
+// Find an item by kind and name. Column names are not case sensitive
+func (s TableSchema) Find(kind, name string) *TableSchemaItem {
+	for i, item := range s.Items {
+		if item.Kind == kind && strings.ToLower(item.Name) == strings.ToLower(name) {
+			return &s.Items[i]
+		}
+	}
+	return nil
+}
+
+// Position of a column for ADD COLUMN. It is after previous column
+func (s TableSchema) columnPosition(name string) string {
+	prev := ""
+
+	for _, item := range s.Items {
+		if item.Kind != SchemaItemColumn {
+			continue
+		}
+		if strings.ToLower(item.Name) == strings.ToLower(name) {
+			break
+		}
+		prev = item.Name
+	}
+	if prev == "" {
+		return "FIRST"
+	}
+	return "AFTER `" + prev + "`"
+}
+
+// Builds rollback of ALTER TABLE query. Every operation is reverted in reverse order.
+// Data of dropped columns can not be restored, a column is added back empty
+func MakeAlterRollback(alter string, before *TableSchema) (string, error) {
+	m := alterTableRegexp.FindStringSubmatch(alter)
+
+	if m == nil {
+		return "", errors.New("Can not parse ALTER TABLE query")
+	}
+
+	rollback := []string{}
+
+	for _, op := range SplitSQLList(m[2], ',') {
+		r, err := alterOperationRollback(op, before)
+
+		if err != nil {
+			return "", err
+		}
+		rollback = append([]string{r}, rollback...)
+	}
+	return "ALTER TABLE " + m[1] + " " + strings.Join(rollback, ", "), nil
+}
+
+// Statements to change current tables to desired. Each statement does one change.
+// Tables and columns missed in desired schema are dropped only if drop is true
+func DiffSchemas(current, desired []*TableSchema, drop bool) ([]string, error) {
+	list := []string{}
+
+	findTable := func(tables []*TableSchema, name string) *TableSchema {
+		for _, t := range tables {
+			if strings.ToLower(t.Name) == strings.ToLower(name) {
+				return t
+			}
+		}
+		return nil
+	}
+
+	for _, d := range desired {
+		c := findTable(current, d.Name)
+
+		if c == nil {
+			list = append(list, strings.TrimSpace(d.Create))
+			continue
+		}
+
+		statements, err := diffTable(c, d, drop)
+
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, statements...)
+	}
+
+	if drop {
+		for _, c := range current {
+			if findTable(desired, c.Name) == nil {
+				list = append(list, "DROP TABLE `"+c.Name+"`")
+			}
+		}
+	}
+	return list, nil
+}
+
+// Splits SQL text by a separator. Separators in quotes, comments and parenthesis are skipped
+func SplitSQLList(text string, sep rune) []string {
+	list := []string{}
+
+	var quote rune
+	escaped := false
+	depth := 0
+	start := 0
+
+	for i, c := range text {
+		if quote != 0 {
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case sep:
+			if depth == 0 {
+				list = appendSQLListItem(list, text[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return appendSQLListItem(list, text[start:])
+}
+
+func appendSQLListItem(list []string, item string) []string {
+	item = strings.TrimSpace(item)
+
+	if item == "" {
+		return list
+	}
+	return append(list, item)
+}
+
+// Position of a parenthesis closing one opened before start
+func findClosingParenthesis(text string, start int) int {
+	var quote rune
+	escaped := false
+	depth := 1
+
+	for i, c := range text[start:] {
+		if quote != 0 {
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+		case '(':
+			depth++
+		case ')':
+			depth--
+
+			if depth == 0 {
+				return start + i
+			}
+		}
+	}
+	return -1
+}
+
+// Detects kind and name of a column or index definition
+func parseSchemaItem(def string) TableSchemaItem {
+	def = normalizeCacheQuery(def)
+	tokens := schemaTokenRegexp.FindAllString(def, -1)
+
+	item := TableSchemaItem{Kind: SchemaItemColumn, Definition: def}
+
+	word := func(i int) string {
+		if i < len(tokens) {
+			return strings.ToLower(tokens[i])
+		}
+		return ""
+	}
+	name := func(i int) string {
+		if i < len(tokens) && tokens[i] != "(" {
+			return strings.Trim(tokens[i], "`")
+		}
+		return ""
+	}
+
+	i := 0
+
+	if word(0) == "constraint" {
+		i = 1
+
+		if !isSchemaKeyword(word(1)) {
+			item.Name = name(1)
+			i = 2
+		}
+	}
+
+	switch word(i) {
+	case "primary":
+		item.Kind = SchemaItemPrimary
+		item.Name = "PRIMARY"
+	case "foreign":
+		item.Kind = SchemaItemForeign
+	case "check":
+		item.Kind = SchemaItemCheck
+	case "unique", "key", "index", "fulltext", "spatial":
+		item.Kind = SchemaItemIndex
+
+		for isSchemaKeyword(word(i)) {
+			i++
+		}
+		if n := name(i); n != "" {
+			item.Name = n
+		}
+	default:
+		item.Name = name(i)
+	}
+	return item
+}
+
+func isSchemaKeyword(word string) bool {
+	switch word {
+	case "primary", "foreign", "check", "unique", "key", "index", "fulltext", "spatial":
+		return true
+	}
+	return false
+}
+
+// Rollback of one operation of ALTER TABLE
+func alterOperationRollback(op string, before *TableSchema) (string, error) {
+	tokens := schemaTokenRegexp.FindAllString(op, -1)
+
+	word := func(i int) string {
+		if i < len(tokens) {
+			return strings.ToLower(tokens[i])
+		}
+		return ""
+	}
+	name := func(i int) string {
+		if i < len(tokens) {
+			return strings.Trim(tokens[i], "`")
+		}
+		return ""
+	}
+	// definition after the operation keywords
+	rest := func(skip ...string) string {
+		r := strings.TrimSpace(op[len(tokens[0]):])
+
+		for _, s := range skip {
+			if strings.HasPrefix(strings.ToLower(r), s+" ") {
+				r = strings.TrimSpace(r[len(s):])
+			}
+		}
+		return r
+	}
+	oldItem := func(kind, n string) (*TableSchemaItem, error) {
+		item := before.Find(kind, n)
+
+		if item == nil {
+			return nil, errors.New(fmt.Sprintf("%s %s is not found in table %s", kind, n, before.Name))
+		}
+		return item, nil
+	}
+
+	switch word(0) {
+	case "add":
+		item := parseSchemaItem(rest("column"))
+
+		switch item.Kind {
+		case SchemaItemColumn:
+			return "DROP COLUMN `" + item.Name + "`", nil
+		case SchemaItemPrimary:
+			return "DROP PRIMARY KEY", nil
+		}
+
+		if item.Name == "" {
+			return "", errors.New("Name of a new key is required to build rollback")
+		}
+
+		switch item.Kind {
+		case SchemaItemIndex:
+			return "DROP INDEX `" + item.Name + "`", nil
+		case SchemaItemForeign:
+			return "DROP FOREIGN KEY `" + item.Name + "`", nil
+		}
+		return "DROP CHECK `" + item.Name + "`", nil
+
+	case "drop":
+		switch word(1) {
+		case "primary":
+			item, err := oldItem(SchemaItemPrimary, "PRIMARY")
+
+			if err != nil {
+				return "", err
+			}
+			return "ADD " + item.Definition, nil
+		case "index", "key":
+			item, err := oldItem(SchemaItemIndex, name(2))
+
+			if err != nil {
+				return "", err
+			}
+			return "ADD " + item.Definition, nil
+		case "foreign":
+			item, err := oldItem(SchemaItemForeign, name(3))
+
+			if err != nil {
+				return "", err
+			}
+			return "ADD " + item.Definition, nil
+		case "check", "constraint":
+			item, err := oldItem(SchemaItemCheck, name(2))
+
+			if err != nil {
+				return "", err
+			}
+			return "ADD " + item.Definition, nil
+		}
+
+		col := name(1)
+
+		if word(1) == "column" {
+			col = name(2)
+		}
+
+		item, err := oldItem(SchemaItemColumn, col)
+
+		if err != nil {
+			return "", err
+		}
+		return "ADD COLUMN " + item.Definition + " " + before.columnPosition(col), nil
+
+	case "modify", "alter":
+		col := name(1)
+
+		if word(1) == "column" {
+			col = name(2)
+		}
+
+		item, err := oldItem(SchemaItemColumn, col)
+
+		if err != nil {
+			return "", err
+		}
+		return "MODIFY COLUMN " + item.Definition, nil
+
+	case "change":
+		i := 1
+
+		if word(1) == "column" {
+			i = 2
+		}
+
+		item, err := oldItem(SchemaItemColumn, name(i))
+
+		if err != nil {
+			return "", err
+		}
+		return "CHANGE COLUMN `" + name(i+1) + "` " + item.Definition, nil
+
+	case "rename":
+		if word(1) == "column" || word(1) == "index" || word(1) == "key" {
+			if word(3) != "to" {
+				return "", errors.New("Can not parse RENAME operation")
+			}
+			return "RENAME " + strings.ToUpper(word(1)) + " `" + name(4) + "` TO `" + name(2) + "`", nil
+		}
+		return "", errors.New("Rename of a table is not supported")
+	}
+
+	return "", errors.New(fmt.Sprintf("ALTER TABLE operation is not supported: %s", op))
+}
+
+// Changes of one table. Indexes are dropped first, so columns used in them can be changed
+func diffTable(c, d *TableSchema, drop bool) ([]string, error) {
+	alter := "ALTER TABLE `" + d.Name + "` "
+
+	dropIndexes := []string{}
+	columns := []string{}
+	addIndexes := []string{}
+	dropColumns := []string{}
+
+	dropItem := func(item TableSchemaItem) string {
+		switch item.Kind {
+		case SchemaItemForeign:
+			return alter + "DROP FOREIGN KEY `" + item.Name + "`"
+		case SchemaItemCheck:
+			return alter + "DROP CHECK `" + item.Name + "`"
+		}
+		return alter + "DROP INDEX `" + item.Name + "`"
+	}
+
+	for _, item := range d.Items {
+		old := c.Find(item.Kind, item.Name)
+
+		if item.Kind == SchemaItemPrimary {
+			if old == nil || old.Definition != item.Definition {
+				return nil, errors.New(fmt.Sprintf("Primary key of %s can not be changed. Rows are identified by it", d.Name))
+			}
+			continue
+		}
+
+		if item.Kind == SchemaItemColumn {
+			if old == nil {
+				columns = append(columns, alter+"ADD COLUMN "+item.Definition+" "+d.columnPosition(item.Name))
+			} else if old.Definition != item.Definition {
+				columns = append(columns, alter+"MODIFY COLUMN "+item.Definition)
+			}
+			continue
+		}
+
+		if item.Name == "" {
+			return nil, errors.New(fmt.Sprintf("Key of %s has no name: %s", d.Name, item.Definition))
+		}
+
+		if old != nil && old.Definition != item.Definition {
+			dropIndexes = append(dropIndexes, dropItem(*old))
+			old = nil
+		}
+
+		if old == nil {
+			addIndexes = append(addIndexes, alter+"ADD "+item.Definition)
+		}
+	}
+
+	for _, item := range c.Items {
+		if d.Find(item.Kind, item.Name) != nil {
+			continue
+		}
+
+		switch item.Kind {
+		case SchemaItemPrimary:
+			return nil, errors.New(fmt.Sprintf("Primary key of %s can not be removed. Rows are identified by it", d.Name))
+		case SchemaItemColumn:
+			if drop {
+				dropColumns = append(dropColumns, alter+"DROP COLUMN `"+item.Name+"`")
+			}
+		default:
+			// keys don't contain data, they are always like in a desired schema
+			dropIndexes = append(dropIndexes, dropItem(item))
+		}
+	}
+
+	list := append(dropIndexes, columns...)
+	list = append(list, addIndexes...)
+
+	return append(list, dropColumns...), nil
+}
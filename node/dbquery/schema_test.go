@@ -0,0 +1,208 @@
+package dbquery
+
+import (
+	"strings"
+	"testing"
+)
+
+const testCreateTable = "CREATE TABLE `users` (\n" +
+	"  `id` int(11) NOT NULL AUTO_INCREMENT,\n" +
+	"  `name` varchar(100) NOT NULL DEFAULT 'a,b',\n" +
+	"  `email` varchar(100) DEFAULT NULL,\n" +
+	"  PRIMARY KEY (`id`),\n" +
+	"  UNIQUE KEY `email` (`email`),\n" +
+	"  KEY `name_email` (`name`,`email`)\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8"
+
+func testParseCreateTable(t *testing.T, create string) *TableSchema {
+	schema, err := ParseCreateTable(create)
+
+	if err != nil {
+		t.Fatalf("Can not parse %s: %s", create, err.Error())
+	}
+	return schema
+}
+
+func TestSplitSQLList(t *testing.T) {
+	tests := map[string][]string{
+		"a, b ,c":                     []string{"a", "b", "c"},
+		"a int DEFAULT 'x,y', b":      []string{"a int DEFAULT 'x,y'", "b"},
+		"KEY k (a,b), c":              []string{"KEY k (a,b)", "c"},
+		"`a,b` int, c varchar(10)":    []string{"`a,b` int", "c varchar(10)"},
+		"a DEFAULT 'it\\'s,', b":      []string{"a DEFAULT 'it\\'s,'", "b"},
+		"a DEFAULT \"(\", b":          []string{"a DEFAULT \"(\"", "b"},
+		" , a,, ":                     []string{"a"},
+		"CHECK ((a > 0) AND (b > 0))": []string{"CHECK ((a > 0) AND (b > 0))"},
+	}
+
+	for text, expected := range tests {
+		list := SplitSQLList(text, ',')
+
+		if strings.Join(list, "|") != strings.Join(expected, "|") {
+			t.Fatalf("Split of %s is %v, expected %v", text, list, expected)
+		}
+	}
+}
+
+func TestParseCreateTable(t *testing.T) {
+	schema := testParseCreateTable(t, testCreateTable)
+
+	if schema.Name != "users" {
+		t.Fatalf("Wrong table name %s", schema.Name)
+	}
+
+	expected := []TableSchemaItem{
+		TableSchemaItem{SchemaItemColumn, "id", "`id` int(11) NOT NULL AUTO_INCREMENT"},
+		TableSchemaItem{SchemaItemColumn, "name", "`name` varchar(100) NOT NULL DEFAULT 'a,b'"},
+		TableSchemaItem{SchemaItemColumn, "email", "`email` varchar(100) DEFAULT NULL"},
+		TableSchemaItem{SchemaItemPrimary, "PRIMARY", "PRIMARY KEY (`id`)"},
+		TableSchemaItem{SchemaItemIndex, "email", "UNIQUE KEY `email` (`email`)"},
+		TableSchemaItem{SchemaItemIndex, "name_email", "KEY `name_email` (`name`,`email`)"},
+	}
+
+	if len(schema.Items) != len(expected) {
+		t.Fatalf("Parsed %d items, expected %d: %v", len(schema.Items), len(expected), schema.Items)
+	}
+
+	for i, item := range expected {
+		if schema.Items[i] != item {
+			t.Fatalf("Item %d is %v, expected %v", i, schema.Items[i], item)
+		}
+	}
+
+	items := map[string]TableSchemaItem{
+		"CONSTRAINT `fk_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)": TableSchemaItem{Kind: SchemaItemForeign, Name: "fk_user"},
+		"CONSTRAINT `positive` CHECK (`a` > 0)":                                  TableSchemaItem{Kind: SchemaItemCheck, Name: "positive"},
+		"FULLTEXT KEY `text` (`body`)":                                           TableSchemaItem{Kind: SchemaItemIndex, Name: "text"},
+		"KEY (`a`)":                                                              TableSchemaItem{Kind: SchemaItemIndex, Name: ""},
+		"value int DEFAULT 0":                                                    TableSchemaItem{Kind: SchemaItemColumn, Name: "value"},
+	}
+
+	for def, expected := range items {
+		item := parseSchemaItem(def)
+
+		if item.Kind != expected.Kind || item.Name != expected.Name {
+			t.Fatalf("Item %s is %s %s, expected %s %s", def, item.Kind, item.Name, expected.Kind, expected.Name)
+		}
+	}
+
+	if _, err := ParseCreateTable("CREATE VIEW v AS SELECT 1"); err == nil {
+		t.Fatalf("Not a table is parsed")
+	}
+	if _, err := ParseCreateTable("CREATE TABLE t (a int"); err == nil {
+		t.Fatalf("Not closed columns list is parsed")
+	}
+}
+
+func TestMakeAlterRollback(t *testing.T) {
+	before := testParseCreateTable(t, testCreateTable)
+
+	tests := map[string]string{
+		"ALTER TABLE `users` ADD COLUMN `age` int":               "ALTER TABLE `users` DROP COLUMN `age`",
+		"ALTER TABLE users ADD age int":                          "ALTER TABLE users DROP COLUMN `age`",
+		"ALTER TABLE users DROP COLUMN name":                     "ALTER TABLE users ADD COLUMN `name` varchar(100) NOT NULL DEFAULT 'a,b' AFTER `id`",
+		"ALTER TABLE users DROP id":                              "ALTER TABLE users ADD COLUMN `id` int(11) NOT NULL AUTO_INCREMENT FIRST",
+		"ALTER TABLE users MODIFY email varchar(200)":            "ALTER TABLE users MODIFY COLUMN `email` varchar(100) DEFAULT NULL",
+		"ALTER TABLE users CHANGE COLUMN email mail varchar(50)": "ALTER TABLE users CHANGE COLUMN `mail` `email` varchar(100) DEFAULT NULL",
+		"ALTER TABLE users RENAME COLUMN email TO mail":          "ALTER TABLE users RENAME COLUMN `mail` TO `email`",
+		"ALTER TABLE users ADD INDEX `age` (`age`)":              "ALTER TABLE users DROP INDEX `age`",
+		"ALTER TABLE users DROP INDEX name_email":                "ALTER TABLE users ADD KEY `name_email` (`name`,`email`)",
+		"ALTER TABLE users DROP PRIMARY KEY":                     "ALTER TABLE users ADD PRIMARY KEY (`id`)",
+		// operations are reverted in reverse order
+		"ALTER TABLE users ADD age int, DROP INDEX email": "ALTER TABLE users ADD UNIQUE KEY `email` (`email`), DROP COLUMN `age`",
+	}
+
+	for alter, expected := range tests {
+		rollback, err := MakeAlterRollback(alter, before)
+
+		if err != nil {
+			t.Fatalf("Rollback of %s fails: %s", alter, err.Error())
+		}
+		if rollback != expected {
+			t.Fatalf("Rollback of %s is %s, expected %s", alter, rollback, expected)
+		}
+	}
+
+	fails := []string{
+		"ALTER TABLE users DROP COLUMN unknown",
+		"ALTER TABLE users ADD INDEX (`age`)",
+		"ALTER TABLE users RENAME TO people",
+		"ALTER TABLE users ENGINE=MyISAM",
+		"DROP TABLE users",
+	}
+
+	for _, alter := range fails {
+		if _, err := MakeAlterRollback(alter, before); err == nil {
+			t.Fatalf("Rollback of %s is built", alter)
+		}
+	}
+}
+
+func TestDiffSchemas(t *testing.T) {
+	current := []*TableSchema{testParseCreateTable(t, testCreateTable),
+		testParseCreateTable(t, "CREATE TABLE `logs` (`id` int NOT NULL, PRIMARY KEY (`id`))")}
+
+	tests := []struct {
+		name     string
+		desired  []string
+		drop     bool
+		expected []string
+	}{
+		{"same", []string{testCreateTable}, false, []string{}},
+		{"new table", []string{testCreateTable, "CREATE TABLE `posts` (`id` int NOT NULL, PRIMARY KEY (`id`))"}, false,
+			[]string{"CREATE TABLE `posts` (`id` int NOT NULL, PRIMARY KEY (`id`))"}},
+		{"add and modify columns",
+			[]string{"CREATE TABLE `users` (`id` int(11) NOT NULL AUTO_INCREMENT, `age` int DEFAULT 0, " +
+				"`name` varchar(200) NOT NULL, `email` varchar(100) DEFAULT NULL, PRIMARY KEY (`id`), " +
+				"UNIQUE KEY `email` (`email`), KEY `name_email` (`name`,`email`))"}, false,
+			[]string{"ALTER TABLE `users` ADD COLUMN `age` int DEFAULT 0 AFTER `id`",
+				"ALTER TABLE `users` MODIFY COLUMN `name` varchar(200) NOT NULL"}},
+		// a changed index is dropped before columns are changed and added after
+		{"change index",
+			[]string{"CREATE TABLE `users` (`id` int(11) NOT NULL AUTO_INCREMENT, " +
+				"`name` varchar(100) NOT NULL DEFAULT 'a,b', `email` varchar(200) DEFAULT NULL, PRIMARY KEY (`id`), " +
+				"UNIQUE KEY `email` (`email`), KEY `name_email` (`email`,`name`))"}, false,
+			[]string{"ALTER TABLE `users` DROP INDEX `name_email`",
+				"ALTER TABLE `users` MODIFY COLUMN `email` varchar(200) DEFAULT NULL",
+				"ALTER TABLE `users` ADD KEY `name_email` (`email`,`name`)"}},
+		// columns are kept without drop, indexes are always removed
+		{"remove column and index",
+			[]string{"CREATE TABLE `users` (`id` int(11) NOT NULL AUTO_INCREMENT, " +
+				"`name` varchar(100) NOT NULL DEFAULT 'a,b', PRIMARY KEY (`id`))"}, false,
+			[]string{"ALTER TABLE `users` DROP INDEX `email`", "ALTER TABLE `users` DROP INDEX `name_email`"}},
+		{"drop column and table",
+			[]string{"CREATE TABLE `users` (`id` int(11) NOT NULL AUTO_INCREMENT, " +
+				"`name` varchar(100) NOT NULL DEFAULT 'a,b', PRIMARY KEY (`id`))"}, true,
+			[]string{"ALTER TABLE `users` DROP INDEX `email`", "ALTER TABLE `users` DROP INDEX `name_email`",
+				"ALTER TABLE `users` DROP COLUMN `email`", "DROP TABLE `logs`"}},
+	}
+
+	for _, test := range tests {
+		desired := []*TableSchema{}
+
+		for _, create := range test.desired {
+			desired = append(desired, testParseCreateTable(t, create))
+		}
+
+		list, err := DiffSchemas(current, desired, test.drop)
+
+		if err != nil {
+			t.Fatalf("Diff %s fails: %s", test.name, err.Error())
+		}
+		if strings.Join(list, "\n") != strings.Join(test.expected, "\n") {
+			t.Fatalf("Diff %s is\n%s\nexpected\n%s", test.name, strings.Join(list, "\n"), strings.Join(test.expected, "\n"))
+		}
+	}
+
+	fails := map[string]string{
+		"change primary key": "CREATE TABLE `users` (`id` int(11) NOT NULL AUTO_INCREMENT, PRIMARY KEY (`id`,`name`))",
+		"remove primary key": "CREATE TABLE `users` (`id` int(11) NOT NULL AUTO_INCREMENT)",
+		"unnamed key":        "CREATE TABLE `users` (`id` int(11) NOT NULL AUTO_INCREMENT, PRIMARY KEY (`id`), KEY (`name`))",
+	}
+
+	for name, create := range fails {
+		if _, err := DiffSchemas(current, []*TableSchema{testParseCreateTable(t, create)}, false); err == nil {
+			t.Fatalf("Diff %s doesn't fail", name)
+		}
+	}
+}
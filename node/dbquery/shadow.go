@@ -0,0 +1,76 @@
+package dbquery
+
+import (
+	"strings"
+
+	"github.com/gelembjuk/oursql/lib"
+	"github.com/gelembjuk/oursql/node/database"
+	"github.com/gelembjuk/oursql/node/dbquery/sqlparser"
+	"github.com/gelembjuk/oursql/node/structures"
+)
+
+// Executes queries of transactions in a transaction which is rolled back. Checks that every INSERT
+// makes and every DELETE removes the row referenced by the TX. Returns index of a failed query or -1.
+// MySQL commits a transaction on CREATE, ALTER and DROP, these queries can not be checked so,
+// skipped is true then
+func (qp queryProcessor) ShadowApplyQueriesFromTX(list []structures.SQLUpdate) (failed int, skipped bool, err error) {
+	failed = -1
+
+	steps := []database.ShadowApplyStep{}
+
+	sqlite := qp.DB.QM().GetQuoter().SQLite
+
+	for i, sql := range list {
+		parser := sqlparser.NewSqlParser()
+
+		err = parser.Parse(string(sql.Query))
+
+		if err != nil {
+			failed = i
+			return
+		}
+
+		var query string
+
+		query, err = qp.resolveBlobs(string(sql.Query))
+
+		if err != nil {
+			failed = i
+			return
+		}
+
+		step := database.ShadowApplyStep{Query: query}
+
+		if parser.IsTableManage() {
+			if !sqlite {
+				skipped = true
+				return
+			}
+			steps = append(steps, step)
+			continue
+		}
+
+		kind := parser.GetKind()
+
+		if kind == lib.QueryKindInsert || kind == lib.QueryKindDelete {
+			ref := strings.SplitN(string(sql.ReferenceID), ":", 2)
+
+			if len(ref) == 2 {
+				keyCol, err := qp.getPrimaryKey(ref[0])
+
+				// table can be created by a previous query of the block. Then only the query is checked
+				if err == nil {
+					step.Table = ref[0]
+					step.KeyCol = keyCol
+					step.KeyVal = ref[1]
+					step.RowExists = kind == lib.QueryKindInsert
+				}
+			}
+		}
+		steps = append(steps, step)
+	}
+
+	failed, err = qp.DB.QM().ExecuteSQLShadowApply(steps)
+
+	return
+}
@@ -7,6 +7,7 @@ const (
 	QueryKindDelete = "delete"
 	QueryKindCreate = "create"
 	QueryKindDrop   = "drop"
+	QueryKindAlter  = "alter"
 	QueryKindOther  = "other"
 )
 
@@ -2,7 +2,9 @@ package sqlparser
 
 import (
 	"errors"
+	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/gelembjuk/oursql/lib"
@@ -83,26 +85,22 @@ func (q *sqlParser) ExtendInsert(column string, value string, coltype string) er
 		return nil
 	}
 
+	extraValue, err := insertValueLiteral(value, coltype)
+
+	if err != nil {
+		return err
+	}
+
 	if q.subkind == querySubKindInsertSet {
-		extraCond := column + "="
+		extraCond := column + "=" + extraValue
 
-		if coltype == "int" {
-			extraCond = extraCond + database.Quote(value)
-		} else {
-			extraCond = extraCond + "'" + database.Quote(value) + "'"
-		}
 		q.canonicalQuery = q.canonicalQuery + ", " + extraCond
 
 		return nil
 
 	}
 	if q.subkind == querySubKindInsertValues {
-		var extraCond string
-		if coltype == "int" {
-			extraCond = database.Quote(value)
-		} else {
-			extraCond = "'" + database.Quote(value) + "'"
-		}
+		extraCond := extraValue
 		// insert as a first column
 		re, err := regexp.Compile("(?i)^(.+into\\s+" + q.GetTable() + "\\s+\\()(.+\\)\\s+values\\s+\\()(.+)$")
 
@@ -122,6 +120,18 @@ func (q *sqlParser) ExtendInsert(column string, value string, coltype string) er
 	return errors.New("Unknown query type")
 }
 
+// Literal of a value added to insert. It is a key generated by a node, the literal is same for all DB engines
+func insertValueLiteral(value string, coltype string) (string, error) {
+	if coltype != "int" {
+		return database.Quoter{}.Literal(value), nil
+	}
+
+	if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+		return "", errors.New(fmt.Sprintf("Value %s is not integer", value))
+	}
+	return value, nil
+}
+
 // ================== PARSERS =============================
 // extract comments from the query
 func (q *sqlParser) parseComments(originalsqlquery string) (sqlquery string, comments []string, err error) {
@@ -193,6 +203,10 @@ func (q *sqlParser) parseKindAndTable(sqlquery string) (kind string, table strin
 		kind = lib.QueryKindDrop
 		re = "drop\\s+table\\s+([^ ]+)"
 
+	} else if strings.HasPrefix(lcase, "alter table ") {
+		kind = lib.QueryKindAlter
+		re = "alter\\s+table\\s+([^ ]+)\\s"
+
 	} else if strings.HasPrefix(lcase, "set ") {
 		kind = lib.QueryKindSet
 		re = ""
@@ -624,7 +638,7 @@ func (q sqlParser) GetTable() string {
 
 }
 func (q sqlParser) IsTableManage() bool {
-	return q.kind == QueryKindDrop || q.kind == QueryKindCreate
+	return q.kind == QueryKindDrop || q.kind == QueryKindCreate || q.kind == QueryKindAlter
 }
 func (q sqlParser) IsTableDataUpdate() bool {
 	return q.kind == QueryKindDelete || q.kind == QueryKindInsert || q.kind == QueryKindUpdate
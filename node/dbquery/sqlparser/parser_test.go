@@ -21,6 +21,7 @@ func TestBasic(t *testing.T) {
 		"delete FROM t WHERE x=y":                                                             []string{"delete FROM t WHERE x=y", "delete", "t", "0"},
 		"create table ttt (a int, b varchar(10))":                                             []string{"create table ttt (a int, b varchar(10))", "create", "ttt", "0"},
 		" drop table ttt;":                                                                    []string{"drop table ttt", "drop", "ttt", "0"},
+		"ALTER TABLE `ttt` ADD COLUMN c int":                                                  []string{"ALTER TABLE `ttt` ADD COLUMN c int", "alter", "ttt", "0"},
 		" UPDATE t SET a='b',c = 'X\\\"q', `d` = 2, `e`= \"3\\'33\",p = `oo\\r`": []string{"UPDATE t SET a='b',c = 'X\\\"q', `d` = 2, `e`= \"3\\'33\",p = `oo\\r`", "update", "t", "5"}}
 
 	for sql, res := range sqls {
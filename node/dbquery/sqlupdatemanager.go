@@ -48,7 +48,8 @@ func (um sqlUpdateManager) CheckUpdateCanFollow(sqlUpdPrev *structures.SQLUpdate
 	if um.Parsed.GetKind() != lib.QueryKindCreate &&
 		um.Parsed.GetKind() != lib.QueryKindInsert &&
 		um.Parsed.GetKind() != lib.QueryKindUpdate &&
-		um.Parsed.GetKind() != lib.QueryKindDelete {
+		um.Parsed.GetKind() != lib.QueryKindDelete &&
+		um.Parsed.GetKind() != lib.QueryKindAlter {
 
 		return errors.New("Operation is not an update query")
 	}
@@ -68,10 +69,12 @@ func (um sqlUpdateManager) CheckUpdateCanFollow(sqlUpdPrev *structures.SQLUpdate
 		return errors.New("Table of this SQL query must be same as a base transaction")
 	}
 
-	if um.Parsed.GetKind() == lib.QueryKindInsert {
+	if um.Parsed.GetKind() == lib.QueryKindInsert ||
+		um.Parsed.GetKind() == lib.QueryKindAlter {
 		// only after create and on same table
-		if sqlparsed1.GetKind() == lib.QueryKindCreate {
-			// previous TX is a table create
+		if sqlparsed1.GetKind() == lib.QueryKindCreate ||
+			sqlparsed1.GetKind() == lib.QueryKindAlter {
+			// previous TX is a table create or a change of the table
 			return
 		}
 	}
@@ -115,7 +118,8 @@ func (um sqlUpdateManager) CheckAllowsMultipleSubtransactions(sqlUpdPrev *struct
 		return
 	}
 
-	if sqlparsed1.GetKind() == lib.QueryKindCreate && um.Parsed.GetKind() == lib.QueryKindInsert {
+	if (sqlparsed1.GetKind() == lib.QueryKindCreate || sqlparsed1.GetKind() == lib.QueryKindAlter) &&
+		um.Parsed.GetKind() == lib.QueryKindInsert {
 		allow = true
 		return
 	}
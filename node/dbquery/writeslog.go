@@ -0,0 +1,100 @@
+package dbquery
+
+/*
+* Log of updates executed by the node. The binary log monitor uses it to find updates done directly in the DB.
+* Every update seen in the binary log must be in this log, otherwise it was not done by the node
+ */
+
+import (
+	"sync"
+	"time"
+)
+
+// How long to keep a record. The binary log is read with a delay, but not such long
+const writesLogTTL = 3600 // seconds
+
+type writesLogEntry struct {
+	key  string
+	time int64
+}
+
+type writesLog struct {
+	lock    sync.Mutex
+	enabled bool
+	// execution times of each update
+	times map[string][]int64
+	order []writesLogEntry
+}
+
+var executedWrites = &writesLog{}
+
+// The log is kept only if something reads it
+func SetWritesLog(enabled bool) {
+	executedWrites.lock.Lock()
+	defer executedWrites.lock.Unlock()
+
+	executedWrites.enabled = enabled
+	executedWrites.times = map[string][]int64{}
+	executedWrites.order = []writesLogEntry{}
+}
+
+// Remember an update after the server executed it. A failed update must not hide same update done not by the node
+func RememberWrite(sql string) {
+	executedWrites.lock.Lock()
+	defer executedWrites.lock.Unlock()
+
+	if !executedWrites.enabled {
+		return
+	}
+
+	executedWrites.cleanExpired()
+
+	key := normalizeCacheQuery(sql)
+	now := time.Now().Unix()
+
+	executedWrites.times[key] = append(executedWrites.times[key], now)
+	executedWrites.order = append(executedWrites.order, writesLogEntry{key, now})
+}
+
+// Checks if an update was executed by the node. The record is removed, every execution is found once
+func IsKnownWrite(sql string) bool {
+	executedWrites.lock.Lock()
+	defer executedWrites.lock.Unlock()
+
+	key := normalizeCacheQuery(sql)
+
+	times := executedWrites.times[key]
+
+	if len(times) == 0 {
+		return false
+	}
+
+	if len(times) == 1 {
+		delete(executedWrites.times, key)
+	} else {
+		executedWrites.times[key] = times[1:]
+	}
+	return true
+}
+
+func (l *writesLog) cleanExpired() {
+	expired := time.Now().Unix() - writesLogTTL
+
+	for len(l.order) > 0 && l.order[0].time < expired {
+		key := l.order[0].key
+		l.order = l.order[1:]
+
+		// the update can be already found, then there are only newer times
+		times := l.times[key]
+
+		for len(times) > 0 && times[0] < expired {
+			times = times[1:]
+		}
+
+		if len(times) == 0 {
+			delete(l.times, key)
+		} else {
+			l.times[key] = times
+		}
+	}
+}
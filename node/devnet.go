@@ -0,0 +1,146 @@
+package main
+
+/*
+* Local network for development. Nodes work in this process with SQLite databases in the devnet folder,
+* test wallets get coins from the genesis block. Works till Ctrl+C
+ */
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gelembjuk/oursql/lib/remoteclient"
+	"github.com/gelembjuk/oursql/node/simulation"
+)
+
+const (
+	devnetDefaultNodes  = 3
+	devnetDefaultPort   = 8800
+	devnetDefaultAmount = 100
+	devnetWaitTimeout   = 60 * time.Second
+)
+
+func (c *NodeCLI) commandDevnet() error {
+	dir := c.ConfigDir + "devnet" + string(os.PathSeparator)
+
+	if c.Input.Args.Clean {
+		os.RemoveAll(dir)
+	}
+
+	if files, err := ioutil.ReadDir(dir); err == nil && len(files) > 0 {
+		return errors.New(fmt.Sprintf("Folder %s is not empty. Add -clean to create new devnet", dir))
+	}
+
+	nodes := c.Input.Args.Nodes
+
+	if nodes < 1 {
+		nodes = devnetDefaultNodes
+	}
+
+	port := c.Input.Args.Port
+
+	if port < 1 {
+		port = devnetDefaultPort
+	}
+
+	amount := c.Input.Args.Amount
+
+	if amount <= 0 {
+		amount = devnetDefaultAmount
+	}
+
+	walletsCount := c.Input.Args.Wallets
+
+	if walletsCount < 0 {
+		walletsCount = 0
+	}
+
+	// genesis block has coins for all test wallets
+	consensusConfig := simulation.DefaultConsensus()
+	consensusConfig.CoinsForBlockMade = float64(walletsCount)*amount + 10
+	consensusConfig.Application.Name = "devnet"
+
+	network, err := simulation.NewNetwork(simulation.Config{
+		Nodes:     nodes,
+		Dir:       dir,
+		StartPort: port,
+		Consensus: consensusConfig,
+		Logs:      c.Input.Logs})
+
+	if err != nil {
+		return err
+	}
+	defer network.Stop()
+
+	fmt.Printf("Starting %d nodes in %s\n", nodes, dir)
+
+	err = network.Start()
+
+	if err != nil {
+		return err
+	}
+
+	wallets := remoteclient.NewWallets(dir + "wallets" + string(os.PathSeparator))
+
+	err = os.MkdirAll(wallets.ConfigDir, 0755)
+
+	if err != nil {
+		return err
+	}
+
+	addresses := []string{}
+
+	for i := 0; i < walletsCount; i++ {
+		address, err := wallets.CreateWallet()
+
+		if err != nil {
+			return err
+		}
+
+		_, err = network.Nodes[0].Send(address, amount)
+
+		if err != nil {
+			return err
+		}
+
+		err = network.WaitConvergence(devnetWaitTimeout)
+
+		if err != nil {
+			return err
+		}
+		addresses = append(addresses, address)
+	}
+
+	fmt.Println("Nodes:")
+
+	for _, node := range network.Nodes {
+		fmt.Printf("  %d. %s\t%s\n", node.Index, node.Address.NodeAddrToString(), node.Dir)
+	}
+
+	if len(addresses) > 0 {
+		fmt.Printf("Wallets with %.2f coins, saved to %s\n", amount, wallets.ConfigDir)
+
+		for _, address := range addresses {
+			fmt.Printf("  %s\n", address)
+		}
+		fmt.Printf("Use them with a wallet app: -configdir %s -nodehost %s -nodeport %d\n",
+			wallets.ConfigDir, network.Nodes[0].Address.Host, network.Nodes[0].Address.Port)
+	}
+
+	fmt.Println("Press Ctrl+C to stop")
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+
+	<-ch
+	signal.Stop(ch)
+
+	fmt.Println("Stopping nodes")
+
+	return nil
+}
@@ -0,0 +1,253 @@
+package main
+
+/*
+* Export of the blockchain for analytics. Blocks, transactions and the current unspent outputs are saved
+* to 3 files in a folder, as newline delimited JSON or CSV. Every line is one record, so files can be loaded
+* to a warehouse as is
+ */
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/structures"
+)
+
+var exportBlockColumns = []string{"hash", "height", "prev_hash", "timestamp", "nonce", "transactions"}
+
+var exportTransactionColumns = []string{"id", "block_hash", "block_height", "index", "time", "type", "signer",
+	"query", "rollback_query", "reference_id", "base_tx", "inputs", "outputs", "outputs_value", "fee"}
+
+var exportUnspentColumns = []string{"tx_id", "output", "address", "value", "from_address", "is_base", "block_hash"}
+
+type exportFile struct {
+	file    *os.File
+	csv     *csv.Writer
+	json    *json.Encoder
+	columns []string
+	count   int
+}
+
+func (c *NodeCLI) commandExportChain() error {
+	dir := c.Input.Args.DestinationFile
+
+	if dir == "" {
+		return errors.New("Destination folder is not provided")
+	}
+
+	format := c.Input.Args.Format
+
+	if format == "" {
+		format = "json"
+	}
+
+	if format != "json" && format != "csv" {
+		return errors.New(fmt.Sprintf("Unknown format %s. Use json or csv", format))
+	}
+
+	err := os.MkdirAll(dir, 0755)
+
+	if err != nil {
+		return err
+	}
+
+	blocksFile, err := newExportFile(filepath.Join(dir, "blocks."+format), format, exportBlockColumns)
+
+	if err != nil {
+		return err
+	}
+	defer blocksFile.close()
+
+	txFile, err := newExportFile(filepath.Join(dir, "transactions."+format), format, exportTransactionColumns)
+
+	if err != nil {
+		return err
+	}
+	defer txFile.close()
+
+	unspentFile, err := newExportFile(filepath.Join(dir, "unspent."+format), format, exportUnspentColumns)
+
+	if err != nil {
+		return err
+	}
+	defer unspentFile.close()
+
+	// outputs to this wallet are fees of paid SQL transactions
+	var paidPubKeyHash []byte
+
+	if paidWallet := c.Node.ConsensusConfig.GetPaidTransactionsWallet(); paidWallet != "" {
+		paidPubKeyHash, _ = utils.AddresToPubKeyHash(paidWallet)
+	}
+
+	bci, err := c.Node.GetBlockChainIterator()
+
+	if err != nil {
+		return err
+	}
+
+	for {
+		block, err := bci.Next()
+
+		if err != nil {
+			return err
+		}
+
+		if block == nil {
+			return errors.New("Next block can not be loaded")
+		}
+
+		err = blocksFile.write(
+			hex.EncodeToString(block.Hash),
+			block.Height,
+			hex.EncodeToString(block.PrevBlockHash),
+			block.Timestamp,
+			block.Nonce,
+			len(block.Transactions))
+
+		if err != nil {
+			return err
+		}
+
+		for i, tx := range block.Transactions {
+			err = exportTransaction(txFile, block, i, tx, paidPubKeyHash)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	err = c.Node.GetTransactionsManager().ForEachUnspent(func(out structures.TXOutputIndependent) error {
+		address, _ := utils.PubKeyHashToAddres(out.DestPubKeyHash)
+		fromAddress := ""
+
+		if len(out.SendPubKeyHash) > 0 {
+			fromAddress, _ = utils.PubKeyHashToAddres(out.SendPubKeyHash)
+		}
+
+		return unspentFile.write(
+			hex.EncodeToString(out.TXID),
+			out.OIndex,
+			address,
+			out.Value,
+			fromAddress,
+			out.IsBase,
+			hex.EncodeToString(out.BlockHash))
+	})
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Exported %d blocks, %d transactions, %d unspent outputs to %s\n",
+		blocksFile.count, txFile.count, unspentFile.count, dir)
+
+	return nil
+}
+
+func exportTransaction(f *exportFile, block *structures.Block, index int, tx structures.Transaction, paidPubKeyHash []byte) error {
+	txType := "currency"
+
+	if tx.IsCoinbaseTransfer() {
+		txType = "coinbase"
+	} else if tx.IsSQLCommand() {
+		txType = "sql"
+	}
+
+	signer := ""
+
+	if len(tx.ByPubKey) > 0 {
+		signer, _ = utils.PubKeyToAddres(tx.ByPubKey)
+	}
+
+	outputsValue := float64(0)
+	fee := float64(0)
+
+	for _, out := range tx.Vout {
+		outputsValue += out.Value
+
+		if tx.IsSQLCommand() && len(paidPubKeyHash) > 0 && bytes.Equal(out.PubKeyHash, paidPubKeyHash) {
+			fee += out.Value
+		}
+	}
+
+	return f.write(
+		hex.EncodeToString(tx.GetID()),
+		hex.EncodeToString(block.Hash),
+		block.Height,
+		index,
+		tx.Time,
+		txType,
+		signer,
+		string(tx.SQLCommand.Query),
+		string(tx.SQLCommand.RollbackQuery),
+		string(tx.SQLCommand.ReferenceID),
+		hex.EncodeToString(tx.GetSQLBaseTX()),
+		len(tx.Vin),
+		len(tx.Vout),
+		outputsValue,
+		fee)
+}
+
+func newExportFile(path string, format string, columns []string) (*exportFile, error) {
+	file, err := os.Create(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	f := &exportFile{file: file, columns: columns}
+
+	if format == "csv" {
+		f.csv = csv.NewWriter(file)
+
+		err = f.csv.Write(columns)
+
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	} else {
+		f.json = json.NewEncoder(file)
+	}
+	return f, nil
+}
+
+// Writes one record. Values must be in order of columns
+func (f *exportFile) write(values ...interface{}) error {
+	f.count++
+
+	if f.json != nil {
+		record := map[string]interface{}{}
+
+		for i, column := range f.columns {
+			record[column] = values[i]
+		}
+		return f.json.Encode(record)
+	}
+
+	row := []string{}
+
+	for _, v := range values {
+		row = append(row, fmt.Sprint(v))
+	}
+	return f.csv.Write(row)
+}
+
+func (f *exportFile) close() {
+	if f.csv != nil {
+		f.csv.Flush()
+	}
+	f.file.Close()
+}
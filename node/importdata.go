@@ -0,0 +1,148 @@
+package main
+
+/*
+* Bulk import of rows to tables. Rows are sent to the running node as SQL transactions by batches.
+* Before every batch we wait while the pool of unapproved transactions has room for it
+ */
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+func (c *NodeCLI) commandImportData() error {
+	if c.AlreadyRunningPort == 0 {
+		return errors.New("The node server must be running. Transactions are sent to other nodes by it")
+	}
+
+	if c.Input.Args.FilePath == "" {
+		return errors.New("Data file is not provided")
+	}
+
+	batch := c.Input.Args.Batch
+
+	if batch < 1 {
+		batch = 1
+	}
+
+	poolLimit := c.Input.Args.PoolLimit
+
+	if poolLimit < batch {
+		poolLimit = batch
+	}
+
+	data, err := c.Node.OpenDataImport(c.Input.Args.FilePath, c.Input.Args.Table)
+
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+
+	walletscli, err := c.getWalletsCLI()
+
+	if err != nil {
+		return err
+	}
+
+	row := 0
+	sent := 0
+	started := time.Now()
+
+	for {
+		queries := []string{}
+
+		for len(queries) < batch {
+			sql, err := data.Next()
+
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				return errors.New(fmt.Sprintf("Can not read row %d: %s", row+len(queries)+1, err.Error()))
+			}
+
+			if row < c.Input.Args.Offset {
+				row++
+				continue
+			}
+			queries = append(queries, sql)
+		}
+
+		if len(queries) == 0 {
+			break
+		}
+
+		err = c.waitPoolRoom(poolLimit-len(queries), c.Input.Args.Wait)
+
+		if err != nil {
+			return errors.New(fmt.Sprintf("%s. Imported %d rows. Continue with -offset %d", err.Error(), row, row))
+		}
+
+		for _, sql := range queries {
+			_, err := walletscli.SendSQL(c.Input.Args.From, sql)
+
+			if err != nil {
+				return errors.New(fmt.Sprintf("Row %d failed: %s. Imported %d rows. Continue with -offset %d", row+1, err.Error(), row, row))
+			}
+			row++
+			sent++
+		}
+
+		fmt.Printf("Imported %d rows, %.1f rows/sec\n", row, float64(sent)/time.Since(started).Seconds())
+	}
+
+	if sent == 0 {
+		fmt.Println("No rows to import")
+		return nil
+	}
+
+	fmt.Printf("Sent %d rows. Wait while they are added to blocks\n", sent)
+
+	err = c.waitPoolRoom(0, c.Input.Args.Wait)
+
+	if err != nil {
+		return errors.New("Transactions are not confirmed yet. They stay in the pool, check them with unapprovedtransactions")
+	}
+
+	fmt.Println("Success. All transactions are in blocks")
+
+	return nil
+}
+
+// Waits while number of unapproved transactions is more than max. Error if there is no progress in wait seconds
+func (c *NodeCLI) waitPoolRoom(max int, wait int) error {
+	last := -1
+	idle := 0
+
+	for {
+		count, err := c.Node.GetTransactionsManager().GetUnapprovedCount()
+
+		if err != nil {
+			return err
+		}
+
+		if count <= max {
+			return nil
+		}
+
+		if count != last {
+			last = count
+			idle = 0
+		} else {
+			idle++
+		}
+
+		if idle >= wait {
+			return errors.New(fmt.Sprintf("Pool of transactions is not changed in %d seconds, it has %d transactions", wait, count))
+		}
+
+		if idle > 0 && idle%10 == 0 {
+			fmt.Printf("Wait for blocks. %d transactions in the pool\n", count)
+		}
+
+		time.Sleep(1 * time.Second)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/gelembjuk/oursql/lib"
+	"github.com/gelembjuk/oursql/lib/tracing"
 	"github.com/gelembjuk/oursql/node/config"
 )
 
@@ -50,6 +51,8 @@ func main() {
 		if err != nil {
 			fmt.Printf("Error: %s\n", err.Error())
 		}
+		// send spans which are not yet exported
+		tracing.Stop()
 		os.Exit(0)
 	}
 
@@ -61,6 +64,7 @@ func main() {
 			fmt.Printf("Node Manage Error: %s\n", err.Error())
 		}
 
+		tracing.Stop()
 		os.Exit(0)
 	}
 
@@ -4,46 +4,62 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"time"
 
+	"github.com/gelembjuk/oursql/lib/anchoring"
 	"github.com/gelembjuk/oursql/lib/net"
 	"github.com/gelembjuk/oursql/lib/nodeclient"
 	"github.com/gelembjuk/oursql/lib/remoteclient"
+	"github.com/gelembjuk/oursql/lib/signers"
+	"github.com/gelembjuk/oursql/lib/tracing"
+	"github.com/gelembjuk/oursql/lib/txvalidation"
 	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/blobs"
 	"github.com/gelembjuk/oursql/node/config"
 	"github.com/gelembjuk/oursql/node/consensus"
+	"github.com/gelembjuk/oursql/node/dbquery"
 	"github.com/gelembjuk/oursql/node/nodemanager"
 	"github.com/gelembjuk/oursql/node/server"
 )
 
 var allowWithoutBCReady = []string{"initblockchain",
 	"importblockchain",
+	config.CommandImportSnapshot,
 	"interactiveautocreate",
 	"restoreblockchain",
+	"setconsensusmodule",
 	"createwallet",
 	config.CommandImportWallet,
 	config.CommandExportWallet,
 	"listaddresses",
+	"shell",
 	"nodestate"}
 
 var disableWithBCReady = []string{"initblockchain",
 	"initblockchain",
 	"importblockchain",
 	"importandstart",
+	config.CommandImportSnapshot,
 	"restoreblockchain"}
 
 var commandsInteractiveMode = []string{
 	"initblockchain",
 	"importblockchain",
+	config.CommandImportSnapshot,
 	config.CommandRestoreBlockchain,
 	config.CommandDumpBlockchain,
 	"exportconsensusconfig",
+	"setconsensusmodule",
 	"pullupdates",
 	"printchain",
+	"exportchain",
 	"makeblock",
 	"reindexcache",
 	"send",
 	"sql",
+	"migrate",
+	"importdata",
 	"getbalance",
 	"getbalances",
 	"createwallet",
@@ -56,9 +72,21 @@ var commandsInteractiveMode = []string{
 	"dropblock",
 	"addrhistory",
 	"showunspent",
+	"showchanges",
+	"makeanchor",
+	"showanchors",
+	"verifyanchor",
 	"shownodes",
 	"addnode",
-	"removenode"}
+	"removenode",
+	"setlogs",
+	"profile",
+	"showbans",
+	"clearbans",
+	"showsettings",
+	"setsettings",
+	"bench",
+	"shell"}
 
 var commandNodeManageMode = []string{
 	"interactiveautocreate",
@@ -67,7 +95,8 @@ var commandNodeManageMode = []string{
 	"startintnode",
 	"stopnode",
 	config.Daemonprocesscommandline,
-	"nodestate"}
+	"nodestate",
+	"devnet"}
 
 type NodeCLI struct {
 	Input                      config.AppInput
@@ -141,6 +170,9 @@ func (c *NodeCLI) CreateNode() error {
 
 	node.Logger = c.Logger
 	node.MinterAddress = c.Input.MinterAddress
+	node.TXVerifyWorkers = c.Input.TXVerifyWorkers
+	node.HeadersFirstSync = c.Input.Sync.HeadersFirst
+	node.CompactBlocks = c.Input.CompactBlocks
 
 	var err error
 	// load consensus config
@@ -161,9 +193,54 @@ func (c *NodeCLI) CreateNode() error {
 	node.InitNodes(c.Input.Nodes, false)
 
 	node.NodeClient.SetAuthStr(c.NodeAuthStr)
+	node.NodeClient.Timeouts = c.Input.NodeTimeouts
+	node.NodeClient.Retry = c.Input.NodeRetry
+	node.NodeClient.MaxResponseSize = c.Input.NodeMaxResponseSize
+	node.NodeClient.RateLimiter = nodeclient.NewRateLimiter(c.Input.NodeRateLimit)
+	node.NodeClient.Bandwidth = net.NewBandwidth(c.Input.NodeBandwidth)
+	node.NodeClient.Outbound = net.NewOutboundSlots(c.Input.NodeConnLimits)
+	node.NodeClient.Metrics = nodeclient.NewClientMetrics()
 
 	c.Node = &node
 
+	dbquery.SetBlobsStorage(blobs.NewStore(c.ConfigDir), c.Input.Blobs.MinSize)
+	dbquery.SetBlobsFetcher(c.Node.FetchBlob)
+	consensus.SetIPFSGateway(c.Input.IPFSGateway)
+	consensus.SetMaxPoolSize(c.Input.MaxPoolSize)
+
+	if c.Input.Tracing.ServiceName == "" {
+		c.Input.Tracing.ServiceName = "oursql-node"
+	}
+	tracing.Init(c.Input.Tracing, c.Logger)
+	net.InitFaults(c.Input.NetworkFaults, c.Logger)
+
+	err = net.InitTLS(c.Input.NodeTLS, c.Logger)
+
+	if err != nil {
+		c.Logger.Error.Printf("Error when init TLS %s", err.Error())
+		return err
+	}
+
+	err = net.InitProxy(c.Input.NodeProxy, c.Logger)
+
+	if err != nil {
+		c.Logger.Error.Printf("Error when init proxy %s", err.Error())
+		return err
+	}
+
+	err = net.CheckWireFormat(c.Input.WireFormat)
+
+	if err != nil {
+		return err
+	}
+
+	err = txvalidation.Load(c.Input.TXValidators)
+
+	if err != nil {
+		c.Logger.Error.Printf("Error when load transaction validators %s", err.Error())
+		return err
+	}
+
 	c.setNodeProxyKeys()
 
 	return nil
@@ -175,8 +252,32 @@ func (c *NodeCLI) getApplicationName() string {
 }
 
 // Check if there is internal keys pair to sign DB proxy transactions. Attach if it is set
+// External signer has priority. Private key is not on this host in such case
 func (c *NodeCLI) setNodeProxyKeys() error {
-	c.Node.ProxyPubKey = []byte{}
+	c.Node.ProxySigner = nil
+	c.Node.ProxyUserSigners = map[string]utils.Signer{}
+
+	for _, user := range c.Input.ProxyUsers {
+		signer, err := c.getProxyUserSigner(user)
+
+		if err != nil {
+			// keep nil signer. The user will not get the default key
+			c.Logger.Error.Printf("Can not init signer of proxy user %s: %s", user.User, err.Error())
+		}
+		c.Node.ProxyUserSigners[user.User] = signer
+	}
+
+	if c.Input.ProxySigner.Type != "" {
+		signer, err := signers.NewSigner(c.Input.ProxySigner)
+
+		if err != nil {
+			c.Logger.Error.Printf("Can not init proxy signer %s: %s", c.Input.ProxySigner.Type, err.Error())
+			return err
+		}
+		c.Node.ProxySigner = signer
+
+		return nil
+	}
 
 	if c.Input.ProxyKey != "" {
 		walletscli, err := c.getWalletsCLI()
@@ -185,8 +286,7 @@ func (c *NodeCLI) setNodeProxyKeys() error {
 			walletobj, err := walletscli.WalletsObj.GetWallet(c.Input.ProxyKey)
 
 			if err == nil {
-				c.Node.ProxyPubKey = walletobj.GetPublicKey()
-				c.Node.ProxyPrivateKey = walletobj.GetPrivateKey()
+				c.Node.ProxySigner = walletobj.GetSigner()
 			}
 		}
 
@@ -195,6 +295,52 @@ func (c *NodeCLI) setNodeProxyKeys() error {
 	return nil
 }
 
+// Signer for a MySQL user of DB proxy. External signer or a wallet of this node
+func (c *NodeCLI) getProxyUserSigner(user config.ProxyUser) (utils.Signer, error) {
+	if user.Signer.Type != "" {
+		return signers.NewSigner(user.Signer)
+	}
+
+	if user.Address == "" {
+		return nil, errors.New("Address or signer is not set")
+	}
+
+	walletscli, err := c.getWalletsCLI()
+
+	if err != nil {
+		return nil, err
+	}
+
+	walletobj, err := walletscli.WalletsObj.GetWallet(user.Address)
+
+	if err != nil {
+		return nil, err
+	}
+	return walletobj.GetSigner(), nil
+}
+
+// Options of the binary log monitor. Signer is needed only to convert updates to transactions
+func (c NodeCLI) getBinlogMonitorOptions() server.BinlogMonitorOptions {
+	options := server.BinlogMonitorOptions{}
+
+	options.Policy = c.Input.BinlogMonitor.Policy
+	options.Interval = c.Input.BinlogMonitor.Interval
+
+	if options.Policy != server.BinlogPolicyConvert {
+		return options
+	}
+
+	signer, err := c.getProxyUserSigner(config.ProxyUser{Address: c.Input.BinlogMonitor.Address, Signer: c.Input.BinlogMonitor.Signer})
+
+	if err != nil {
+		c.Logger.Error.Printf("Can not init signer of binary log monitor: %s", err.Error())
+		return options
+	}
+	options.Signer = signer
+
+	return options
+}
+
 // Detects if this request is not related to node server management and must return response right now
 func (c NodeCLI) isInteractiveMode() bool {
 
@@ -236,6 +382,9 @@ func (c NodeCLI) ExecuteCommand() error {
 	case "importblockchain":
 		return c.commandImportBlockchain()
 
+	case config.CommandImportSnapshot:
+		return c.commandImportSnapshot()
+
 	case config.CommandRestoreBlockchain:
 		return c.commandRestoreBlockchain()
 
@@ -245,12 +394,18 @@ func (c NodeCLI) ExecuteCommand() error {
 	case "exportconsensusconfig":
 		return c.commandExportConsensusConfig()
 
+	case "setconsensusmodule":
+		return c.commandSetConsensusModule()
+
 	case "pullupdates":
 		return c.commandPullUpdates()
 
 	case "printchain":
 		return c.commandPrintChain()
 
+	case "exportchain":
+		return c.commandExportChain()
+
 	case "reindexcache":
 		return c.commandReindexCache()
 
@@ -278,6 +433,12 @@ func (c NodeCLI) ExecuteCommand() error {
 	case "sql":
 		return c.commandSQL()
 
+	case "migrate":
+		return c.commandMigrate()
+
+	case "importdata":
+		return c.commandImportData()
+
 	case "unapprovedtransactions":
 		return c.commandUnapprovedTransactions()
 
@@ -296,6 +457,18 @@ func (c NodeCLI) ExecuteCommand() error {
 	case "showunspent":
 		return c.commandShowUnspent()
 
+	case "showchanges":
+		return c.commandShowChanges()
+
+	case "makeanchor":
+		return c.commandMakeAnchor()
+
+	case "showanchors":
+		return c.commandShowAnchors()
+
+	case "verifyanchor":
+		return c.commandVerifyAnchor()
+
 	case "shownodes":
 		return c.commandShowNodes()
 
@@ -304,6 +477,30 @@ func (c NodeCLI) ExecuteCommand() error {
 
 	case "removenode":
 		return c.commandRemoveNode()
+
+	case "setlogs":
+		return c.commandSetLogs()
+
+	case "profile":
+		return c.commandProfile()
+
+	case "showbans":
+		return c.commandShowBans()
+
+	case "clearbans":
+		return c.commandClearBans()
+
+	case "showsettings":
+		return c.commandShowSettings()
+
+	case "setsettings":
+		return c.commandSetSettings()
+
+	case "bench":
+		return c.commandBench()
+
+	case "shell":
+		return c.commandShell()
 	}
 
 	return errors.New("Unknown management command")
@@ -319,6 +516,13 @@ func (c NodeCLI) createDaemonManager() (*server.NodeDaemon, error) {
 		return nil, errors.New("Blockchain is not found. Must be created or inited")
 	}
 
+	// a consensus config can be copied without a module
+	err := c.Node.ConsensusConfig.FetchModule(c.Logger)
+
+	if err != nil {
+		return nil, err
+	}
+
 	nd.ConfigDir = c.ConfigDir
 	nd.Logger = c.Logger
 	nd.Port = c.Input.Port
@@ -327,6 +531,44 @@ func (c NodeCLI) createDaemonManager() (*server.NodeDaemon, error) {
 	nd.Node = c.Node
 	nd.DBProxyAddr = c.Input.DBProxyAddress
 	nd.DBAddr = c.Input.Database.GetServerAddress()
+	nd.ProfilingAddr = c.Input.ProfilingAddress
+	nd.GraphQLAddr = c.Input.GraphQLAddress
+	nd.MetricsAddr = c.Input.MetricsAddress
+	nd.RESTAddr = c.Input.RESTAddress
+	nd.RESTAllowOrigin = c.Input.RESTAllowOrigin
+	nd.JSONRPC = c.Input.JSONRPC
+	nd.SubscriptionsAddr = c.Input.SubscriptionsAddress
+	nd.LocalSocket = c.Input.LocalSocket
+	nd.LocalSocketMode = c.Input.LocalSocketMode
+	nd.WebSocketAddr = c.Input.WebSocketAddress
+	nd.ConnTimeouts = c.Input.ServerTimeouts
+	nd.MaxRequestSize = c.Input.ServerMaxRequestSize
+	nd.PortMap = c.Input.NodePortMap
+	nd.Banning = c.Input.Banning
+	nd.PeerLists = c.Input.PeerLists
+	nd.LANDiscovery = c.Input.LANDiscovery
+	nd.ConnLimits = c.Input.NodeConnLimits
+	nd.Sync = server.SyncOptions{
+		Interval:         c.Input.Sync.Interval,
+		IntervalNoIncome: c.Input.Sync.IntervalNoIncome}
+	nd.WireFormat = c.Input.WireFormat
+	nd.BinlogMonitor = c.getBinlogMonitorOptions()
+	nd.RowsCheck = server.RowsCheckOptions{Interval: c.Input.RowsCheck.Interval, Repair: c.Input.RowsCheck.Repair}
+	nd.ClockCheck = server.ClockCheckOptions{
+		MaxOffset:    c.Input.ClockCheck.MaxOffset,
+		MinPeers:     c.Input.ClockCheck.MinPeers,
+		RefuseMining: c.Input.ClockCheck.RefuseMining}
+	nd.Keepalive = server.KeepaliveOptions{
+		Interval:    c.Input.Keepalive.Interval,
+		MissedPings: c.Input.Keepalive.MissedPings,
+		NodeMaxAge:  c.Input.Keepalive.NodeMaxAge,
+		MinNodes:    c.Input.Keepalive.MinNodes}
+	nd.Maintenance = server.MaintenanceOptions{
+		Window:    c.Input.Maintenance.Window,
+		Interval:  c.Input.Maintenance.Interval,
+		Operation: c.Input.Maintenance.Operation,
+		Tables:    c.Input.Maintenance.Tables}
+	nd.Anchoring = c.Input.Anchoring
 	nd.Init()
 
 	return &nd, nil
@@ -335,6 +577,10 @@ func (c NodeCLI) createDaemonManager() (*server.NodeDaemon, error) {
 // Execute server management command
 
 func (c NodeCLI) ExecuteManageCommand() error {
+	if c.Command == "devnet" {
+		// nodes of devnet are created in own folder
+		return c.commandDevnet()
+	}
 	err := c.CreateNode()
 
 	if err != nil {
@@ -354,12 +600,34 @@ func (c NodeCLI) ExecuteManageCommand() error {
 	}
 
 	if c.Command == "startnode" {
-		return noddaemon.StartServer()
+		schemas, err := c.getSchemasInputs()
+
+		if err != nil {
+			return err
+		}
+
+		err = noddaemon.StartServer()
+
+		if err != nil {
+			return err
+		}
+		c.commandSchemas(schemas)
+
+		return nil
 
 	} else if c.Command == "startintnode" {
 		return noddaemon.StartServerInteractive()
 
 	} else if c.Command == "stopnode" {
+		schemas, err := c.getSchemasInputs()
+
+		if err != nil {
+			// main node must be stopped anyway
+			fmt.Printf("Schemas are not stopped: %s\n", err.Error())
+		} else {
+			c.commandSchemas(schemas)
+		}
+
 		return noddaemon.StopServer()
 
 	} else if c.Command == config.Daemonprocesscommandline {
@@ -384,6 +652,7 @@ func (c *NodeCLI) getWalletsCLI() (*remoteclient.WalletCLI, error) {
 	winput.ToAddress = c.Input.Args.To
 	winput.SQL = c.Input.Args.SQL
 	winput.Filepath = c.Input.Args.FilePath
+	winput.Scheme = c.Input.Args.Scheme
 
 	if c.Input.Args.From != "" {
 		winput.Address = c.Input.Args.From
@@ -437,7 +706,7 @@ func (c *NodeCLI) commandInitBlockchain() error {
 		return err
 	}
 
-	err = c.Node.CreateBlockchain(c.Input.MinterAddress, walletobj.GetPublicKey(), walletobj.GetPrivateKey())
+	err = c.Node.CreateBlockchain(c.Input.MinterAddress, walletobj.GetSigner())
 
 	if err != nil {
 		return err
@@ -479,6 +748,40 @@ func (c *NodeCLI) commandImportBlockchain() error {
 	return nil
 }
 
+// To init blockchain from a snapshot of a trusted node. SQL of blocks is not executed
+func (c *NodeCLI) commandImportSnapshot() error {
+	if c.Input.Args.NodePort == 0 || c.Input.Args.NodeHost == "" {
+		addr := c.Node.ConsensusConfig.GetRandomInitialAddress()
+
+		if addr == nil {
+			return errors.New("No address to import from")
+		}
+		c.Input.Args.NodePort = addr.Port
+		c.Input.Args.NodeHost = addr.Host
+	}
+
+	trusted := c.Input.SnapshotTrusted
+
+	if c.Input.Args.Identity != "" {
+		trusted = append(trusted, c.Input.Args.Identity)
+	}
+
+	if c.Input.Args.AuthStr != "" {
+		c.Node.NodeClient.SetAuthStr(c.Input.Args.AuthStr)
+	}
+
+	height, err := c.Node.InitBlockchainFromSnapshot(net.NewNodeAddr(c.Input.Args.NodeHost, c.Input.Args.NodePort), trusted)
+
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Done! Blockchain was inited from snapshot, height %d. Next blocks will be loaded when node started\n", height)
+
+	c.Input.UpdateConfig()
+
+	return nil
+}
+
 // To restore blockchain from full dump to empty database
 func (c *NodeCLI) commandRestoreBlockchain() error {
 	if c.Input.Args.DumpFile == "" {
@@ -686,6 +989,111 @@ func (c *NodeCLI) commandShowUnspent() error {
 	return nil
 }
 
+// Display events of the change log after a cursor
+func (c *NodeCLI) commandShowChanges() error {
+	events, err := c.Node.GetTransactionsManager().GetChangeEvents(int64(c.Input.Args.Offset), c.Input.Args.Batch)
+
+	if err != nil {
+		return err
+	}
+
+	cursor := int64(c.Input.Args.Offset)
+
+	for _, e := range events {
+		op := e.Operation
+
+		if e.Canceled {
+			op = "canceled " + op
+		}
+		fmt.Printf("%d\t%s\t%s\t%s\ttx %x\tblock %d\n", e.ID, op, e.Table, e.Key, e.TXID, e.BlockHeight)
+		cursor = e.ID
+	}
+
+	fmt.Printf("\nNext cursor - %d\n", cursor)
+
+	return nil
+}
+
+func (c *NodeCLI) getAnchoringAdapter() (anchoring.Adapter, error) {
+	if c.Input.Anchoring.Adapter == "" {
+		return nil, errors.New("Anchoring adapter is not set in config")
+	}
+	return anchoring.NewAdapter(c.Input.Anchoring)
+}
+
+// Publish the top block hash now, not waiting for the node schedule
+func (c *NodeCLI) commandMakeAnchor() error {
+	adapter, err := c.getAnchoringAdapter()
+
+	if err != nil {
+		return err
+	}
+
+	anchor, err := c.Node.MakeAnchor(adapter, c.Input.Anchoring.Adapter)
+
+	if err != nil {
+		return err
+	}
+
+	if anchor == nil {
+		fmt.Println("Top block is already anchored")
+		return nil
+	}
+
+	fmt.Printf("Anchor %d of block %x at height %d\nReference - %s\n", anchor.ID, anchor.BlockHash, anchor.BlockHeight, anchor.Reference)
+
+	return nil
+}
+
+// Display anchors of blocks, from the last one
+func (c *NodeCLI) commandShowAnchors() error {
+	anchors, err := c.Node.GetAnchors(c.Input.Args.Batch, c.Input.Args.Offset)
+
+	if err != nil {
+		return err
+	}
+
+	for _, a := range anchors {
+		fmt.Printf("%d\t%s\tblock %d %x\t%s %s\n", a.ID, time.Unix(a.Time, 0).Format("2006-01-02 15:04:05"),
+			a.BlockHeight, a.BlockHash, a.Adapter, a.Reference)
+	}
+	return nil
+}
+
+// Check an anchor in the external blockchain
+func (c *NodeCLI) commandVerifyAnchor() error {
+	anchor, err := c.Node.GetAnchor(int64(c.Input.Args.Anchor))
+
+	if err != nil {
+		return err
+	}
+
+	if anchor == nil {
+		return errors.New(fmt.Sprintf("Anchor %d is not found", c.Input.Args.Anchor))
+	}
+
+	adapter, err := c.getAnchoringAdapter()
+
+	if err != nil {
+		return err
+	}
+
+	state, err := c.Node.VerifyAnchor(*anchor, adapter, c.Input.Anchoring.Adapter)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Block %x at height %d\n", anchor.BlockHash, anchor.BlockHeight)
+	fmt.Printf("In the primary chain - %v\n", state.InChain)
+	fmt.Printf("Found in %s as %s - %v\n", anchor.Adapter, anchor.Reference, state.Found)
+
+	if state.Found {
+		fmt.Printf("Confirmations - %d\n", state.Confirmations)
+	}
+	return nil
+}
+
 // Display balance for address
 func (c *NodeCLI) commandGetBalance() error {
 	if c.AlreadyRunningPort > 0 {
@@ -728,7 +1136,7 @@ func (c *NodeCLI) commandSend() error {
 		return err
 	}
 
-	txid, err := c.Node.Send(walletobj.GetPublicKey(), walletobj.GetPrivateKey(),
+	txid, err := c.Node.Send(walletobj.GetSigner(),
 		c.Input.Args.To, c.Input.Args.Amount)
 
 	if err != nil {
@@ -848,6 +1256,17 @@ func (c *NodeCLI) commandShowState(daemon *server.NodeDaemon) error {
 		return err
 	}
 
+	if info.Identity != "" {
+		fmt.Printf("Node identity - %s\n", info.Identity)
+	}
+
+	if !info.DBAvailable && Runnning {
+		fmt.Printf("DB server is not available since %s. Error: %s\n", time.Unix(info.DBHealthSince, 0).Format("2006-01-02 15:04:05"), info.DBLastError)
+		fmt.Println("Blocks are not applied until it is back")
+
+		return c.showSchemasState()
+	}
+
 	fmt.Println("Blockchain state:")
 
 	fmt.Printf("  Number of blocks - %d\n", info.BlocksNumber)
@@ -860,7 +1279,75 @@ func (c *NodeCLI) commandShowState(daemon *server.NodeDaemon) error {
 
 	fmt.Printf("  Number of unspent transactions outputs - %d\n", info.UnspentOutputs)
 
-	return nil
+	if info.DBServerVersion != "" {
+		fmt.Printf("DB server: %s\n", info.DBServerVersion)
+	}
+
+	if info.DBHealthFailures > 0 {
+		fmt.Printf("  Failed checks - %d, reconnects - %d, last error - %s\n", info.DBHealthFailures, info.DBReconnects, info.DBLastError)
+	}
+
+	if info.DBApplySettings != "" {
+		fmt.Printf("  Blocks are applied with %s\n", info.DBApplySettings)
+	}
+
+	if info.ApplyTimeouts > 0 {
+		fmt.Printf("  Queries of blocks stopped by timeout - %d, last in TX %s\n", info.ApplyTimeouts, info.ApplyTimeoutLastTX)
+	}
+
+	fmt.Println("DB connections pool:")
+
+	fmt.Printf("  Open - %d, in use - %d, idle - %d, max - %d\n", info.DBPoolOpen, info.DBPoolInUse, info.DBPoolIdle, info.DBPoolMaxOpen)
+
+	fmt.Printf("  Waited for connection - %d times, %d ms total\n", info.DBPoolWaitCount, info.DBPoolWaitTime)
+
+	if info.QueryCacheHits+info.QueryCacheMisses > 0 {
+		fmt.Println("Query cache:")
+
+		fmt.Printf("  Results - %d, hits - %d, misses - %d\n", info.QueryCacheEntries, info.QueryCacheHits, info.QueryCacheMisses)
+	}
+
+	if info.BinlogMonitor {
+		fmt.Println("Binary log monitor:")
+
+		fmt.Printf("  Updates done not by the node - %d\n", info.OutOfBandChanges)
+	}
+
+	if info.RowsCheck {
+		fmt.Println("Rows check:")
+
+		fmt.Printf("  Rows different from other nodes - %d\n", info.DifferentRows)
+	}
+
+	if info.Maintenance {
+		fmt.Printf("Tables maintenance in %s:\n", info.MaintenanceWindow)
+
+		fmt.Printf("  Done operations - %d\n", info.MaintenanceRuns)
+
+		if info.MaintenanceLast != "" {
+			fmt.Printf("  Last - %s\n", info.MaintenanceLast)
+		}
+	}
+
+	if info.ClockPeers > 0 {
+		fmt.Printf("Clock offset from other nodes - %d seconds, by %d nodes\n", info.ClockOffset, info.ClockPeers)
+
+		if info.ClockDrift {
+			fmt.Println("  Clock of this node is not synced with the network")
+		}
+	}
+
+	if info.Anchoring {
+		fmt.Printf("Anchoring with %s:\n", info.AnchoringVia)
+
+		fmt.Printf("  Made anchors - %d\n", info.AnchorsMade)
+
+		if info.AnchorsLast != "" {
+			fmt.Printf("  Last - %s\n", info.AnchorsLast)
+		}
+	}
+
+	return c.showSchemasState()
 }
 
 // Displays list of nodes (connections)
@@ -882,6 +1369,10 @@ func (c *NodeCLI) commandShowNodes() error {
 	fmt.Println("Nodes:")
 
 	for _, n := range nodes {
+		if len(n.Identity) > 0 {
+			fmt.Println("  ", n.NodeAddrToString(), "identity", net.IdentityID(n.Identity))
+			continue
+		}
 		fmt.Println("  ", n.NodeAddrToString())
 
 	}
@@ -889,6 +1380,48 @@ func (c *NodeCLI) commandShowNodes() error {
 	return nil
 }
 
+// Show peers banned by the running node
+func (c *NodeCLI) commandShowBans() error {
+	if c.AlreadyRunningPort == 0 {
+		return errors.New("The node server is not running")
+	}
+
+	nc := c.getLocalNetworkClient()
+
+	bans, err := nc.SendGetBans()
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Bans:")
+
+	for _, ban := range bans {
+		fmt.Printf("   %s till %s: %s\n", ban.Host, time.Unix(ban.Until, 0).Format("2006-01-02 15:04:05"), ban.Reason)
+	}
+
+	return nil
+}
+
+// Remove a ban of a peer or all bans
+func (c *NodeCLI) commandClearBans() error {
+	if c.AlreadyRunningPort == 0 {
+		return errors.New("The node server is not running")
+	}
+
+	nc := c.getLocalNetworkClient()
+
+	count, err := nc.SendClearBans(c.Input.Args.IP)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed %d bans\n", count)
+
+	return nil
+}
+
 // Add a node to connections
 func (c *NodeCLI) commandAddNode() error {
 	newaddr := net.NewNodeAddr(c.Input.Args.NodeHost, c.Input.Args.NodePort)
@@ -903,6 +1436,13 @@ func (c *NodeCLI) commandAddNode() error {
 		}
 	} else {
 		c.Node.AddNodeToKnown(newaddr, false)
+
+		manual, err := net.NewManualNodes(c.ConfigDir + config.ManualNodesFileName)
+
+		if err != nil {
+			return err
+		}
+		manual.Add(newaddr)
 	}
 
 	fmt.Println("Success!")
@@ -926,6 +1466,13 @@ func (c *NodeCLI) commandRemoveNode() error {
 		}
 	} else {
 		c.Node.NodeNet.RemoveNodeFromKnown(remaddr)
+
+		manual, err := net.NewManualNodes(c.ConfigDir + config.ManualNodesFileName)
+
+		if err != nil {
+			return err
+		}
+		manual.Remove(remaddr)
 	}
 	fmt.Println("Success!")
 
@@ -953,7 +1500,7 @@ func (c *NodeCLI) commandSQL() error {
 		return err
 	}
 
-	txid, err := c.Node.SQLTransaction(walletobj.GetPublicKey(), walletobj.GetPrivateKey(), c.Input.Args.SQL)
+	txid, err := c.Node.SQLTransaction(walletobj.GetSigner(), c.Input.Args.SQL)
 
 	if err != nil {
 		return err
@@ -968,6 +1515,92 @@ func (c *NodeCLI) commandSQL() error {
 	return nil
 }
 
+// Change tables to a schema from a file. Queries are sent to the running node as SQL transactions
+// and then we wait while all of them are added to blocks
+func (c *NodeCLI) commandMigrate() error {
+	if c.AlreadyRunningPort == 0 {
+		return errors.New("The node server must be running. Transactions are sent to other nodes by it")
+	}
+
+	if c.Input.Args.FilePath == "" {
+		return errors.New("Schema file is not provided")
+	}
+
+	schema, err := ioutil.ReadFile(c.Input.Args.FilePath)
+
+	if err != nil {
+		return err
+	}
+
+	queries, err := c.Node.GetSchemaMigration(string(schema), c.Input.Args.Clean)
+
+	if err != nil {
+		return err
+	}
+
+	if len(queries) == 0 {
+		fmt.Println("Tables are same as in the schema. Nothing to do")
+		return nil
+	}
+
+	fmt.Printf("Queries to execute: %d\n", len(queries))
+
+	for _, sql := range queries {
+		fmt.Printf("  %s\n", sql)
+	}
+
+	if c.Input.Args.DryRun {
+		return nil
+	}
+
+	walletscli, err := c.getWalletsCLI()
+
+	if err != nil {
+		return err
+	}
+
+	txids := [][]byte{}
+
+	for _, sql := range queries {
+		txid, err := walletscli.SendSQL(c.Input.Args.From, sql)
+
+		if err != nil {
+			return errors.New(fmt.Sprintf("Query failed: %s. Error: %s", sql, err.Error()))
+		}
+
+		if txid != nil {
+			fmt.Printf("Transaction %x: %s\n", txid, sql)
+			txids = append(txids, txid)
+		}
+	}
+
+	fmt.Printf("Wait for confirmation of %d transactions\n", len(txids))
+
+	for wait := c.Input.Args.Wait; wait > 0; wait-- {
+		confirmed := 0
+
+		for _, txid := range txids {
+			// an error means the transaction is not yet in a block
+			if blockHash, err := c.Node.GetTransactionsManager().GetTransactionBlock(txid); err == nil && blockHash != nil {
+				confirmed++
+			}
+		}
+
+		if confirmed == len(txids) {
+			fmt.Println("Success. All transactions are in blocks")
+			return nil
+		}
+
+		if wait%10 == 0 {
+			fmt.Printf("Confirmed %d of %d\n", confirmed, len(txids))
+		}
+
+		time.Sleep(1 * time.Second)
+	}
+
+	return errors.New("Transactions are not confirmed yet. They stay in the pool, check them with unapprovedtransactions")
+}
+
 // Prepare wallet, import BC and start interactive. If BC exists we just start a server (do nothign before it)
 func (c *NodeCLI) commandImportStartInteractive() error {
 
@@ -1093,3 +1726,26 @@ func (c *NodeCLI) commandExportConsensusConfig() error {
 		c.Input.Args.AppName,
 		ownAddres.NodeAddrToString())
 }
+
+// Adds a module to the consensus config. It is referenced by hash, other nodes download it from URL or IPFS
+func (c *NodeCLI) commandSetConsensusModule() error {
+	if c.Input.Args.FilePath == "" {
+		return errors.New("Module file path missed")
+	}
+
+	data, err := ioutil.ReadFile(c.Input.Args.FilePath)
+
+	if err != nil {
+		return err
+	}
+
+	err = c.Node.ConsensusConfig.SetModule(data, c.Input.Args.URL, c.Input.Args.CID)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Consensus module hash - %s\n", c.Node.ConsensusConfig.Module.Hash)
+
+	return nil
+}
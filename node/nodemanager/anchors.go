@@ -0,0 +1,114 @@
+package nodemanager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gelembjuk/oursql/lib/anchoring"
+	"github.com/gelembjuk/oursql/node/database"
+)
+
+// Result of anchor verification
+type AnchorState struct {
+	anchoring.Verification
+	InChain bool // the block is still in the primary chain of this node
+}
+
+// Publishes hash of the top block with the adapter and saves the anchor.
+// Returns nil if the top block is same as in the last anchor
+func (n *Node) MakeAnchor(adapter anchoring.Adapter, adapterName string) (*database.Anchor, error) {
+	andb, err := n.DBConn.DB().GetAnchorsObject()
+
+	if err != nil {
+		return nil, err
+	}
+
+	topHash, height, err := n.NodeBC.GetBCManager().GetState()
+
+	if err != nil {
+		return nil, err
+	}
+
+	last, err := andb.GetAnchors(1, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(last) > 0 && bytes.Equal(last[0].BlockHash, topHash) {
+		return nil, nil
+	}
+
+	anchor := database.Anchor{}
+	anchor.BlockHash = topHash
+	anchor.BlockHeight = height
+	anchor.Adapter = adapterName
+	anchor.Time = time.Now().Unix()
+
+	anchor.Reference, err = anchoring.Publish(adapter, topHash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	anchor.ID, err = andb.AddAnchor(anchor)
+
+	if err != nil {
+		// it is published already. the reference is in the log to add it manually
+		n.Logger.Error.Printf("Anchor of block %x with reference %s is not saved", topHash, anchor.Reference)
+		return nil, err
+	}
+
+	n.Logger.Trace.Printf("Anchor of block %x at height %d, reference %s", topHash, height, anchor.Reference)
+
+	return &anchor, nil
+}
+
+// Returns anchors from the last one
+func (n *Node) GetAnchors(limit int, offset int) ([]database.Anchor, error) {
+	andb, err := n.DBConn.DB().GetAnchorsObject()
+
+	if err != nil {
+		return nil, err
+	}
+	return andb.GetAnchors(limit, offset)
+}
+
+// Returns nil if there is no such anchor
+func (n *Node) GetAnchor(id int64) (*database.Anchor, error) {
+	andb, err := n.DBConn.DB().GetAnchorsObject()
+
+	if err != nil {
+		return nil, err
+	}
+	return andb.GetAnchor(id)
+}
+
+// Checks the anchor in the external chain and in the blockchain of this node.
+// The adapter must be of same type as the anchor was published with
+func (n *Node) VerifyAnchor(anchor database.Anchor, adapter anchoring.Adapter, adapterName string) (AnchorState, error) {
+	state := AnchorState{}
+
+	if anchor.Adapter != adapterName {
+		return state, errors.New(fmt.Sprintf("Anchor %d was published with %s adapter, configured adapter is %s",
+			anchor.ID, anchor.Adapter, adapterName))
+	}
+
+	bcdb, err := n.DBConn.DB().GetBlockchainObject()
+
+	if err != nil {
+		return state, err
+	}
+
+	state.InChain, err = bcdb.BlockInChain(anchor.BlockHash)
+
+	if err != nil {
+		return state, err
+	}
+
+	state.Verification, err = anchoring.Verify(adapter, anchor.Reference, anchor.BlockHash)
+
+	return state, err
+}
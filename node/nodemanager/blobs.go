@@ -0,0 +1,48 @@
+package nodemanager
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gelembjuk/oursql/node/blobs"
+	"github.com/gelembjuk/oursql/node/dbquery"
+)
+
+// Returns a large value from the storage of this node. Nil if there is no such value
+func (n *Node) GetBlob(hash []byte) ([]byte, error) {
+	store := dbquery.GetBlobsStorage()
+
+	if store == nil {
+		return nil, errors.New("Storage of large values is not configured")
+	}
+	return store.Get(hash)
+}
+
+// Requests a large value from known nodes. Returns the first value with correct hash and size
+func (n *Node) FetchBlob(hash []byte, size int) ([]byte, error) {
+	n.InitClient()
+
+	for _, node := range n.NodeNet.GetNodes() {
+		if node.CompareToAddress(n.NodeClient.NodeAddress) {
+			continue
+		}
+
+		result, err := n.NodeClient.SendGetBlob(node, hash)
+
+		if err != nil {
+			n.Logger.Trace.Printf("Value %x is not received from %s: %s", hash, node.NodeAddrToString(), err.Error())
+			continue
+		}
+
+		err = blobs.Verify(hash, size, result.Data)
+
+		if err != nil {
+			n.Logger.Trace.Printf("Wrong value received from %s: %s", node.NodeAddrToString(), err.Error())
+			continue
+		}
+
+		return result.Data, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("Value %x is not found on other nodes", hash))
+}
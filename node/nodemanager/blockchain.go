@@ -4,7 +4,9 @@ import (
 	"errors"
 
 	"github.com/gelembjuk/oursql/lib"
+	"github.com/gelembjuk/oursql/lib/net"
 	"github.com/gelembjuk/oursql/lib/remoteclient"
+	"github.com/gelembjuk/oursql/lib/tracing"
 	"github.com/gelembjuk/oursql/lib/utils"
 	"github.com/gelembjuk/oursql/node/blockchain"
 	"github.com/gelembjuk/oursql/node/consensus"
@@ -87,6 +89,39 @@ func (n *NodeBlockchain) GetAddressHistory(address string) ([]structures.Transac
 	return bci.GetAddressHistory(pubKeyHash, address)
 }
 
+// Returns a page of history of an address. A page starts after a record of previous page, the record is found
+// by its block, TX and IO type. Pages don't change when new blocks are added. Empty block means the top
+func (n *NodeBlockchain) GetAddressHistoryPage(address string, afterBlock []byte, afterTX []byte, afterIOType bool,
+	limit int) ([]structures.TransactionsHistory, error) {
+
+	if address == "" {
+		return nil, errors.New("Address is missed")
+	}
+	w := remoteclient.Wallet{}
+
+	if !w.ValidateAddress(address) {
+		return nil, errors.New("Address is not valid")
+	}
+
+	var bci *blockchain.BlockchainIterator
+	var err error
+
+	if len(afterBlock) > 0 {
+		bci, err = blockchain.NewBlockchainIteratorFrom(n.DBConn.DB(), afterBlock)
+	} else {
+		bci, err = blockchain.NewBlockchainIterator(n.DBConn.DB())
+		afterTX = nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	pubKeyHash, _ := utils.AddresToPubKeyHash(address)
+
+	return bci.GetAddressHistoryPage(pubKeyHash, address, afterTX, afterIOType, limit)
+}
+
 // Drop block from a top of blockchain
 func (n *NodeBlockchain) DropBlock() (*structures.Block, error) {
 	return n.GetBCManager().DeleteBlock()
@@ -116,9 +151,17 @@ func (n *NodeBlockchain) AddBlock(block *structures.Block) (uint, error) {
 	Minter := consensus.NewBlockMakerManager(n.consensusConfig, n.MinterAddress, n.DBConn.DB(), n.Logger)
 
 	// verify this block against rules.
+	span := n.DBConn.GetTrace().Start("block verify", tracing.KindInternal)
+
 	err = Minter.VerifyBlock(block, lib.TXFlagsSkipSQLBaseCheckIfNotOnTop)
 
+	span.End(err)
+
 	if err != nil {
+		// errors of rules have no code. other node sent a wrong block
+		if net.GetErrorCode(err) == net.ErrorCodeInternal {
+			err = net.NewRemoteError(net.ErrorCodeBlockVerify, err.Error())
+		}
 		return 0, err
 	}
 
@@ -1,10 +1,10 @@
 package nodemanager
 
 import (
-	"crypto/ecdsa"
 	"errors"
 	"fmt"
 
+	"github.com/gelembjuk/oursql/lib"
 	"github.com/gelembjuk/oursql/lib/net"
 	"github.com/gelembjuk/oursql/lib/nodeclient"
 	"github.com/gelembjuk/oursql/lib/remoteclient"
@@ -18,8 +18,7 @@ import (
 type makeBlockchain struct {
 	Logger          *utils.LoggerMan
 	MinterAddress   string
-	PubKey          []byte
-	PrivateKey      ecdsa.PrivateKey
+	Signer          utils.Signer
 	BC              *NodeBlockchain
 	DBConn          *Database
 	consensusConfig *consensus.ConsensusConfig
@@ -33,7 +32,7 @@ func (n *makeBlockchain) getBCManager() *blockchain.Blockchain {
 
 // Init SQL transactions manager
 func (n *makeBlockchain) getSQLQueryManager() (consensus.SQLTransactionsInterface, error) {
-	return consensus.NewSQLQueryManager(n.consensusConfig, n.DBConn.DB(), n.Logger, n.PubKey, n.PrivateKey)
+	return consensus.NewSQLQueryManager(n.consensusConfig, n.DBConn.DB(), n.Logger, n.Signer)
 }
 
 // Transactions manager object
@@ -90,6 +89,16 @@ func (n *makeBlockchain) CreateBlockchain(genesisCoinbaseData string, initOnNotE
 
 	n.Logger.Trace.Printf("Blockchain ready! Now looks existent tables\n")
 
+	// names registry is a part of any new blockchain. It is added to blocks same way as existent tables
+	if !utils.StringInSlice(lib.NamesTable, tables) {
+		err = n.DBConn.DB().QM().ExecuteSQL(consensus.NamesTableCreateSQL)
+
+		if err != nil {
+			return err
+		}
+		tables = append(tables, lib.NamesTable)
+	}
+
 	if len(tables) > 0 {
 		countTables, countRows, err := n.addExistentTables(tables)
 
@@ -195,7 +204,17 @@ func (n *makeBlockchain) importBlockchainConsensusInfo(fromnode net.NodeAddr, no
 		return err
 	}
 	//n.Logger.Trace.Printf("Loaded consensus file with len %d and contents %s", len(result.ConfigFile), string(result.ConfigFile))
-	return n.consensusConfig.UpdateConfig(result.ConfigFile)
+	err = n.consensusConfig.UpdateConfig(result.ConfigFile)
+
+	if err != nil || !n.consensusConfig.HasModule() {
+		return err
+	}
+
+	// old nodes can send a module itself. Usually it is referenced by hash and downloaded
+	if len(result.Module) > 0 {
+		return n.consensusConfig.SaveModule(result.Module)
+	}
+	return n.consensusConfig.FetchModule(n.Logger)
 }
 
 // BUilds a genesis block. It is used only to start new blockchain
@@ -390,7 +409,7 @@ func (n *makeBlockchain) makeNewInitialBlock(sqls []string, nextBlockHeigh int)
 		return err
 	}
 	for _, sql := range sqls {
-		_, err := qm.NewQueryByNodeInit(sql, n.PubKey, n.PrivateKey)
+		_, err := qm.NewQueryByNodeInit(sql, n.Signer)
 
 		if err != nil {
 			return err
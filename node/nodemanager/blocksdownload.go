@@ -0,0 +1,256 @@
+package nodemanager
+
+/*
+* Download of bodies of blocks from several nodes at same time. Every node has a window of requests sent
+* and not answered yet, a node which answers faster gets more requests. A request which is not answered in time
+* is sent to other node too, first good body wins. A node which fails many times is not used more.
+* Blocks are added to the chain in order of headers, bodies received before they can be added wait in memory
+ */
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/nodeclient"
+)
+
+const (
+	// requests to one node sent and not answered
+	blocksDownloadPeerWindow = 16
+	// blocks requested or received and not yet added to the chain
+	blocksDownloadAhead = 256
+	// request is sent to other node if there is no answer in this time
+	blocksDownloadTimeout = 15 * time.Second
+	// node is not used after this number of errors and timeouts
+	blocksDownloadMaxFailures = 3
+	// how often timeouts are checked
+	blocksDownloadCheckInterval = time.Second
+)
+
+type downloadPeer struct {
+	addr     net.NodeAddr
+	inFlight int
+	failures int
+}
+
+type blockRequest struct {
+	peer     *downloadPeer
+	sent     time.Time
+	timedOut bool
+}
+
+type blockResponse struct {
+	index    int
+	request  *blockRequest
+	response nodeclient.AsyncResponse
+}
+
+type blocksDownload struct {
+	n       *communicationManager
+	headers []nodeclient.ComBlockHeader
+	peers   []*downloadPeer
+	// requests in flight by index of a header
+	requests map[int][]*blockRequest
+	// bodies which are received and not yet added
+	bodies map[int][]byte
+	// indexes to request again after errors
+	retry []int
+	// next index which was never requested
+	next      int
+	connected int
+	results   chan blockResponse
+}
+
+// Requests bodies of blocks from all nodes at same time and adds them in order of headers
+func (n *communicationManager) loadBlocksByHeaders(peers []headersSyncPeer, headers []nodeclient.ComBlockHeader) ([][]byte, error) {
+	d := &blocksDownload{
+		n:        n,
+		headers:  headers,
+		requests: map[int][]*blockRequest{},
+		bodies:   map[int][]byte{},
+		// requests can be answered after the download is complete, they must not block
+		results: make(chan blockResponse, len(peers)*blocksDownloadPeerWindow*2)}
+
+	for _, p := range peers {
+		d.peers = append(d.peers, &downloadPeer{addr: p.addr})
+	}
+
+	addedBlocks, err := d.run()
+
+	n.logger.Trace.Printf("Headers-first sync. Added %d blocks", len(addedBlocks))
+
+	return addedBlocks, err
+}
+
+func (d *blocksDownload) run() ([][]byte, error) {
+	addedBlocks := [][]byte{}
+
+	ticker := time.NewTicker(blocksDownloadCheckInterval)
+	defer ticker.Stop()
+
+	for d.connected < len(d.headers) {
+		if blockdata, ok := d.bodies[d.connected]; ok {
+			delete(d.bodies, d.connected)
+
+			blockstate, _, block, err := d.n.node.ReceivedFullBlockFromOtherNode(blockdata)
+
+			if err != nil {
+				return addedBlocks, err
+			}
+
+			if blockstate == 0 {
+				addedBlocks = append(addedBlocks, block.Hash)
+			}
+			d.connected++
+			continue
+		}
+
+		if err := d.sendRequests(); err != nil {
+			return addedBlocks, err
+		}
+
+		select {
+		case r := <-d.results:
+			d.received(r)
+		case <-ticker.C:
+		}
+	}
+	return addedBlocks, nil
+}
+
+// Sends requests again after errors and timeouts, then new requests while nodes have free windows
+func (d *blocksDownload) sendRequests() error {
+	now := time.Now()
+
+	for index, requests := range d.requests {
+		for _, r := range requests {
+			if r.timedOut || now.Sub(r.sent) < blocksDownloadTimeout {
+				continue
+			}
+			r.timedOut = true
+			r.peer.failures++
+
+			d.n.logger.Trace.Printf("Block %x is not loaded from %s in time, request other node", d.headers[index].Hash, r.peer.addr.NodeAddrToString())
+
+			d.retry = append(d.retry, index)
+		}
+	}
+
+	retry := d.retry
+	d.retry = nil
+
+	for _, index := range retry {
+		if _, ok := d.bodies[index]; ok || index < d.connected {
+			continue
+		}
+		if !d.request(index) {
+			d.retry = append(d.retry, index)
+		}
+	}
+
+	for d.next < len(d.headers) && d.next < d.connected+blocksDownloadAhead {
+		if !d.request(d.next) {
+			break
+		}
+		d.next++
+	}
+
+	if _, ok := d.bodies[d.connected]; ok || len(d.requests[d.connected]) > 0 {
+		return nil
+	}
+
+	// nothing will bring a block which is needed now
+	for _, p := range d.peers {
+		if p.failures < blocksDownloadMaxFailures {
+			return nil
+		}
+	}
+	return errors.New("No nodes to load blocks from")
+}
+
+// Requests a body from a node with less requests in flight, not from a node which is asked for it already.
+// Returns false if all nodes are busy
+func (d *blocksDownload) request(index int) bool {
+	var peer *downloadPeer
+
+	for _, p := range d.peers {
+		if p.failures >= blocksDownloadMaxFailures || p.inFlight >= blocksDownloadPeerWindow || d.isRequested(index, p) {
+			continue
+		}
+
+		if peer == nil || p.inFlight < peer.inFlight || p.inFlight == peer.inFlight && p.failures < peer.failures {
+			peer = p
+		}
+	}
+
+	if peer == nil {
+		return false
+	}
+
+	r := &blockRequest{peer: peer, sent: time.Now()}
+
+	peer.inFlight++
+	d.requests[index] = append(d.requests[index], r)
+
+	response := d.n.node.NodeClient.SendGetBlockAsync(peer.addr, d.headers[index].Hash)
+
+	go func() {
+		d.results <- blockResponse{index, r, <-response}
+	}()
+
+	return true
+}
+
+func (d *blocksDownload) isRequested(index int, peer *downloadPeer) bool {
+	for _, r := range d.requests[index] {
+		if r.peer == peer && !r.timedOut {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *blocksDownload) received(r blockResponse) {
+	r.request.peer.inFlight--
+
+	requests := d.requests[r.index]
+
+	for i, req := range requests {
+		if req == r.request {
+			requests = append(requests[:i], requests[i+1:]...)
+			break
+		}
+	}
+
+	if _, ok := d.bodies[r.index]; ok || r.index < d.connected {
+		// other node was faster
+		return
+	}
+
+	blockdata, err := d.n.getBlockBody(r.response, d.headers[r.index])
+
+	if err != nil {
+		d.n.logger.Trace.Printf("Block %x is not loaded from %s: %s", d.headers[r.index].Hash, r.request.peer.addr.NodeAddrToString(), err.Error())
+
+		d.n.node.NodeNet.HookNeworkOperationResultForNode(err, &r.request.peer.addr)
+
+		if !r.request.timedOut {
+			r.request.peer.failures++
+		}
+
+		if len(requests) == 0 {
+			delete(d.requests, r.index)
+			// a timed out request is in the retry list already
+			if !r.request.timedOut {
+				d.retry = append(d.retry, r.index)
+			}
+		} else {
+			d.requests[r.index] = requests
+		}
+		return
+	}
+
+	d.bodies[r.index] = blockdata
+	delete(d.requests, r.index)
+}
@@ -5,11 +5,15 @@ import (
 
 	"github.com/gelembjuk/oursql/lib"
 	"github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/nodeclient"
 	"github.com/gelembjuk/oursql/lib/utils"
 
 	"github.com/gelembjuk/oursql/node/structures"
 )
 
+// Bodies of next blocks are requested while a block is added
+const blocksRequestedAhead = 8
+
 type communicationManager struct {
 	logger *utils.LoggerMan
 	node   *Node
@@ -29,12 +33,9 @@ func (n communicationManager) sendVersionToNodes(nodes []net.NodeAddr, bestHeigh
 		nodes = n.node.NodeNet.Nodes
 	}
 
-	for _, node := range nodes {
-		if node.CompareToAddress(n.node.NodeClient.NodeAddress) {
-			continue
-		}
-		n.node.NodeClient.SendVersion(node, bestHeight)
-	}
+	n.node.NodeClient.Broadcast(nodes, func(client *nodeclient.NodeClient, addr net.NodeAddr) error {
+		return client.SendVersion(addr, bestHeight)
+	})
 }
 
 // Send transaction to all known nodes. This wil send only hash and node hash to check if hash exists or no
@@ -54,14 +55,12 @@ func (n *communicationManager) sendTransactionToAll(tx *structures.Transaction)
 func (n *communicationManager) sendTransactionToAllASync(tx *structures.Transaction) error {
 	n.logger.Trace.Printf("Send transaction to %d nodes in async mode", len(n.node.NodeNet.Nodes))
 
-	for i, node := range n.node.NodeNet.Nodes {
-		if node.CompareToAddress(n.node.NodeClient.NodeAddress) {
-			continue
-		}
-		n.logger.Trace.Printf("Send TX %x to %s", tx.GetID(), node.NodeAddrToString())
-		err := n.node.NodeClient.SendInv(node, "tx", [][]byte{tx.GetID()})
-		n.node.NodeNet.HookNeworkOperationResult(err, i) // to know if this node is available
-	}
+	summary := n.node.NodeClient.BroadcastInv(n.node.NodeNet.GetNodes(), "tx", [][]byte{tx.GetID()})
+
+	n.hookBroadcastResults(summary) // to know if nodes are available
+
+	n.logger.Trace.Printf("TX %x is sent to %d nodes, failed %d", tx.GetID(), summary.Sent, summary.Failed)
+
 	return nil
 }
 
@@ -77,14 +76,12 @@ func (n *communicationManager) sendTransactionToAllSync(tx *structures.Transacti
 		return err
 	}
 
-	for i, node := range n.node.NodeNet.Nodes {
-		if node.CompareToAddress(n.node.NodeClient.NodeAddress) {
-			continue
-		}
-		n.logger.Trace.Printf("Send TX %x to %s", tx.GetID(), node.NodeAddrToString())
-		err := n.node.NodeClient.SendTx(node, txser)
-		n.node.NodeNet.HookNeworkOperationResult(err, i) // to know if this node is available
-	}
+	summary := n.node.NodeClient.BroadcastTx(n.node.NodeNet.GetNodes(), txser)
+
+	n.hookBroadcastResults(summary) // to know if nodes are available
+
+	n.logger.Trace.Printf("TX %x is sent to %d nodes, failed %d", tx.GetID(), summary.Sent, summary.Failed)
+
 	return nil
 }
 
@@ -95,6 +92,10 @@ func (n *communicationManager) sendTransactionToAllSync(tx *structures.Transacti
 // Address from where we get it will be skipped
 func (n *communicationManager) SendBlockToAll(newBlock *structures.Block, skipaddr net.NodeAddr) error {
 	n.logger.Trace.Printf("Send block to all nodes. ")
+
+	if n.node.CompactBlocks {
+		return n.SendCompactBlockToAll(newBlock, skipaddr)
+	}
 	// decide how to send, async or sync
 	if n.node.NodeNet.CheckHadInputConnects() {
 		// can send async. Other nodes can connect to us
@@ -114,15 +115,12 @@ func (n *communicationManager) SendBlockToAllASync(newBlock *structures.Block, s
 		return err
 	}
 
-	for i, node := range n.node.NodeNet.Nodes {
-		if node.CompareToAddress(n.node.NodeClient.NodeAddress) {
-			continue
-		}
+	summary := n.node.NodeClient.BroadcastInv(n.node.NodeNet.GetNodes(), "block", [][]byte{blockshortdata})
 
-		errc := n.node.NodeClient.SendInv(node, "block", [][]byte{blockshortdata})
-		n.node.NodeNet.HookNeworkOperationResult(errc, i) // to know if this node is available
+	n.hookBroadcastResults(summary) // to know if nodes are available
+
+	n.logger.Trace.Printf("Block %x is sent to %d nodes, failed %d", newBlock.Hash, summary.Sent, summary.Failed)
 
-	}
 	return nil
 }
 
@@ -137,34 +135,75 @@ func (n *communicationManager) SendBlockToAllSync(newBlock *structures.Block, sk
 		return err
 	}
 
-	for i, node := range n.node.NodeNet.Nodes {
-		if node.CompareToAddress(n.node.NodeClient.NodeAddress) {
-			continue
-		}
-		result, err := n.node.NodeClient.SendCheckBlock(node, blockshortdata)
+	// full block is sent to nodes which don't have it. it is serialised once for all nodes
+	blockdata, err := newBlock.Serialize()
 
-		n.node.NodeNet.HookNeworkOperationResult(err, i) // to know if this node is available
+	if err != nil {
+		n.logger.Trace.Printf("Error when serialise a block %s for %x", err.Error(), newBlock.Hash)
+		return err
+	}
 
-		if err != nil {
-			n.logger.Trace.Printf("Error when check if block exists on other node %s for %s", err.Error(), node.NodeAddrToString())
-			continue
-		}
+	summary := n.node.NodeClient.BroadcastBlock(n.node.NodeNet.GetNodes(), blockshortdata, blockdata)
 
-		if !result.Exists {
-			// send full block this this node
-			bs, err := newBlock.Serialize()
+	n.hookBroadcastResults(summary) // to know if nodes are available
 
-			if err != nil {
-				n.logger.Trace.Printf("Error when serialise a block %s for %x", err.Error(), newBlock.Hash)
-				continue
-			}
-			n.node.NodeClient.SendBlock(node, bs)
+	for _, r := range summary.Results {
+		if r.Err != nil {
+			n.logger.Trace.Printf("Error when send block to other node %s for %s", r.Err.Error(), r.Addr.NodeAddrToString())
 		}
+	}
+	return nil
+}
+
+// Send compact block to nodes which accept it, full block to other nodes. A node which doesn't have some
+// transactions in the pool requests them
+func (n *communicationManager) SendCompactBlockToAll(newBlock *structures.Block, skipaddr net.NodeAddr) error {
+	n.logger.Trace.Printf("Send compact block to all nodes. %x", newBlock.Hash)
+
+	blockcompactdata, err := newBlock.GetCompactCopy().Serialize()
 
+	if err != nil {
+		return err
 	}
+
+	blockshortdata, err := newBlock.GetShortCopy().Serialize()
+
+	if err != nil {
+		return err
+	}
+
+	blockdata, err := newBlock.Serialize()
+
+	if err != nil {
+		return err
+	}
+
+	nodes := []net.NodeAddr{}
+
+	for _, node := range n.node.NodeNet.GetNodes() {
+		// it has the block already
+		if !node.CompareToAddress(skipaddr) {
+			nodes = append(nodes, node)
+		}
+	}
+
+	summary := n.node.NodeClient.BroadcastCompactBlock(nodes, blockcompactdata, blockshortdata, blockdata)
+
+	n.hookBroadcastResults(summary) // to know if nodes are available
+
+	n.logger.Trace.Printf("Compact block %x of %d bytes, full %d. Sent to %d nodes, failed %d",
+		newBlock.Hash, len(blockcompactdata), len(blockdata), summary.Sent, summary.Failed)
+
 	return nil
 }
 
+// Remembers results of a broadcast for every node
+func (n *communicationManager) hookBroadcastResults(summary nodeclient.BroadcastSummary) {
+	for _, r := range summary.Results {
+		n.node.NodeNet.HookNeworkOperationResultForNode(r.Err, &r.Addr)
+	}
+}
+
 // Check for updates on other nodes
 func (n *communicationManager) CheckForChangesOnOtherNodes(lastCheckTime int64) (ChangesPullResults, error) {
 	result := ChangesPullResults{}
@@ -180,6 +219,21 @@ func (n *communicationManager) CheckForChangesOnOtherNodes(lastCheckTime int64)
 		return result, err
 	}
 
+	// when this node is far behind, missed blocks are loaded with headers first
+	result.AddedBlocks, err = n.syncHeadersFirst(nodes, myBestHeight)
+
+	if err != nil {
+		n.logger.Error.Printf("Error in headers-first sync %s", err.Error())
+	}
+
+	if len(result.AddedBlocks) > 0 {
+		myBestHeight, topHashes, err = n.node.NodeBC.GetBCTopState(5)
+
+		if err != nil {
+			return result, err
+		}
+	}
+
 	for _, node := range nodes {
 		n.logger.TraceExt.Printf("Check node %s", node.NodeAddrToString())
 		if node.CompareToAddress(n.node.NodeClient.NodeAddress) {
@@ -238,7 +292,27 @@ func (n *communicationManager) processBlocksFromOtherNode(node *net.NodeAddr, bl
 
 	addedBlocks := [][]byte{}
 
+	// requests of blocks which are not in the chain, sent before they are needed
+	pending := map[int]<-chan nodeclient.AsyncResponse{}
+	next := l - 1
+
+	requestAhead := func(i int) {
+		for ; next >= 0 && next >= i-blocksRequestedAhead; next-- {
+			bs, err := structures.NewBlockShortFromBytes(blocks[next])
+
+			if err != nil {
+				continue
+			}
+
+			if exists, err := n.node.NodeBC.CheckBlockExists(bs.Hash); err != nil || exists {
+				continue
+			}
+			pending[next] = n.node.NodeClient.SendGetBlockAsync(*node, bs.Hash)
+		}
+	}
+
 	for i := l - 1; i >= 0; i-- {
+		requestAhead(i)
 
 		bs, err := structures.NewBlockShortFromBytes(blocks[i])
 
@@ -267,7 +341,19 @@ func (n *communicationManager) processBlocksFromOtherNode(node *net.NodeAddr, bl
 		if blockstate == 0 {
 			// in this case we can request this block full info
 
-			result, err := n.node.NodeClient.SendGetBlock(*node, bs.Hash)
+			var result *nodeclient.ResponseGetBlock
+
+			if request, ok := pending[i]; ok {
+				response := <-request
+
+				err = response.Err
+
+				if err == nil {
+					result = response.Payload.(*nodeclient.ResponseGetBlock)
+				}
+			} else {
+				result, err = n.node.NodeClient.SendGetBlock(*node, bs.Hash)
+			}
 
 			if err != nil {
 				n.logger.Error.Printf("Error when reuest block body %s", err.Error())
@@ -297,7 +383,7 @@ func (n *communicationManager) processTransactionsFromPoolOnOtherNode(node *net.
 		return nil, nil
 	}
 
-	addedTransaction := [][]byte{}
+	toLoad := [][]byte{}
 
 	for _, txID := range transactions {
 		// if not exist , request for full body of a TX and add to a pool
@@ -305,25 +391,40 @@ func (n *communicationManager) processTransactionsFromPoolOnOtherNode(node *net.
 			//n.logger.Trace.Printf("TX already exists: %x ", txID)
 			continue
 		}
+		toLoad = append(toLoad, txID)
+	}
+
+	if len(toLoad) == 0 {
+		return nil, nil
+	}
+
+	// transactions are requested while previous are verified. a trace can not be used from 2 goroutines,
+	// so requests are not traced
+	client := *n.node.NodeClient
+	client.Trace = nil
+
+	// the pipeline admits only transactions with correct signatures
+	pipeline := newTXPipeline(n.node.TXVerifyWorkers, n.logger, func(tx *structures.Transaction) error {
+		return n.node.getBlockMakeManager().AddTransactionToPool(tx, lib.TXFlagsExecute|lib.TXFlagsSignatureVerified)
+	})
+
+	addedTransaction := pipeline.Process(len(toLoad), func(i int) (*structures.Transaction, error) {
 		// request this TX and add to the pool
-		result, err := n.node.NodeClient.SendGetTransaction(*node, txID)
+		result, err := client.SendGetTransaction(*node, toLoad[i])
 
 		if err != nil {
 			n.logger.Error.Printf("Error when request for TX from other node %s", err.Error())
-			continue
+			return nil, err
 		}
 		tx, err := structures.DeserializeTransaction(result.Transaction)
 
 		if err != nil {
 			n.logger.Error.Printf("Error when deserialize TX %s", err.Error())
-			continue
+			return nil, err
 		}
-		err = n.node.getBlockMakeManager().AddTransactionToPool(tx, lib.TXFlagsExecute)
+		return tx, nil
+	})
 
-		if err == nil {
-			addedTransaction = append(addedTransaction, tx.GetID())
-		}
-	}
 	return addedTransaction, nil
 }
 
@@ -0,0 +1,157 @@
+package nodemanager
+
+/*
+* Compact blocks relay. A new block is sent as a header with short IDs of transactions, a node makes the block
+* from transactions of own pool and requests only missed ones. If the block made this way has wrong hash
+* (a transaction in the pool is different or short IDs collide) the full block is loaded
+ */
+
+import (
+	"bytes"
+	"encoding/hex"
+	"sort"
+
+	"github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/node/blockchain"
+	"github.com/gelembjuk/oursql/node/structures"
+)
+
+// Compact block received from other node. Returns same as ReceivedFullBlockFromOtherNode
+func (n *Node) ReceivedCompactBlockFromOtherNode(addr net.NodeAddr, data []byte) (int, uint, *structures.Block, error) {
+	compact, err := structures.NewBlockCompactFromBytes(data)
+
+	if err != nil {
+		return -1, uint(blockchain.BCBAddState_error), nil, net.NewRemoteError(net.ErrorCodeBadRequest, "Compact block can not be parsed: "+err.Error())
+	}
+
+	blockstate, err := n.NodeBC.CheckBlockState(compact.Hash, compact.PrevBlockHash)
+
+	if err != nil {
+		return -1, uint(blockchain.BCBAddState_error), nil, err
+	}
+
+	if blockstate == 1 {
+		n.Logger.Trace.Printf("Compact block %x exists", compact.Hash)
+		return blockstate, uint(blockchain.BCBAddState_error), nil, nil
+	}
+
+	ids, err := compact.GetShortIDs()
+
+	if err != nil {
+		return -1, uint(blockchain.BCBAddState_error), nil, net.NewRemoteError(net.ErrorCodeBadRequest, err.Error())
+	}
+
+	block, err := n.makeBlockFromCompact(addr, compact, ids)
+
+	if err != nil {
+		n.Logger.Trace.Printf("Block %x is not made from compact block: %s. Load full block", compact.Hash, err.Error())
+
+		result, err := n.NodeClient.SendGetBlock(addr, compact.Hash)
+
+		if err != nil {
+			return -1, uint(blockchain.BCBAddState_error), nil, err
+		}
+		return n.ReceivedFullBlockFromOtherNode(result.Block)
+	}
+
+	blockdata, err := block.Serialize()
+
+	if err != nil {
+		return -1, uint(blockchain.BCBAddState_error), nil, err
+	}
+	return n.ReceivedFullBlockFromOtherNode(blockdata)
+}
+
+// Finds transactions in the pool by short IDs and requests others. The block must have correct hash
+func (n *Node) makeBlockFromCompact(addr net.NodeAddr, compact *structures.BlockCompact, ids map[int][]byte) (*structures.Block, error) {
+	indexes := map[string]int{}
+
+	for i, id := range ids {
+		if _, ok := indexes[string(id)]; ok {
+			return nil, net.NewRemoteError(net.ErrorCodeBadRequest, "Short IDs of transactions are not unique")
+		}
+		indexes[string(id)] = i
+	}
+
+	txman := n.GetTransactionsManager()
+
+	inPool := map[int][]byte{}
+
+	_, err := txman.ForEachUnapprovedTransaction(func(txhash, txstr string) error {
+		txID, err := hex.DecodeString(txhash)
+
+		if err != nil {
+			return nil
+		}
+
+		if i, ok := indexes[string(structures.CompactShortID(compact.Hash, txID))]; ok {
+			inPool[i] = txID
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	transactions := map[int]structures.Transaction{}
+
+	for i, txID := range inPool {
+		tx, err := txman.GetIfUnapprovedExists(txID)
+
+		if err == nil && tx != nil {
+			transactions[i] = *tx
+		}
+	}
+
+	missed := []int{}
+
+	for i := range ids {
+		if _, ok := transactions[i]; !ok {
+			missed = append(missed, i)
+		}
+	}
+	sort.Ints(missed)
+
+	n.Logger.Trace.Printf("Compact block %x. %d transactions from the pool, request %d", compact.Hash, len(transactions), len(missed))
+
+	if len(missed) > 0 {
+		list, err := n.NodeClient.SendGetBlockTxs(addr, compact.Hash, missed)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for k, txdata := range list {
+			tx, err := structures.DeserializeTransaction(txdata)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if !bytes.Equal(structures.CompactShortID(compact.Hash, tx.GetID()), ids[missed[k]]) {
+				return nil, net.NewRemoteError(net.ErrorCodeBadRequest, "Node returned wrong transaction")
+			}
+			transactions[missed[k]] = *tx
+		}
+	}
+
+	block, err := compact.ToBlock(transactions)
+
+	if err != nil {
+		return nil, err
+	}
+
+	merkleRoot, err := block.HashTransactions()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = n.getBlockMakeManager().VerifyBlockHeader(block, merkleRoot)
+
+	if err != nil {
+		return nil, err
+	}
+	return block, nil
+}
@@ -3,6 +3,7 @@ package nodemanager
 import (
 	"sync"
 
+	"github.com/gelembjuk/oursql/lib/tracing"
 	"github.com/gelembjuk/oursql/lib/utils"
 	"github.com/gelembjuk/oursql/node/database"
 )
@@ -13,6 +14,8 @@ type Database struct {
 	Config    database.DatabaseConfig
 	lockerObj database.DatabaseLocker
 	locallock *sync.Mutex
+	// trace of a request served with this object. Can be nil
+	trace *tracing.Trace
 }
 
 func (db *Database) DB() database.DBManager {
@@ -55,6 +58,19 @@ func (db *Database) Clone() Database {
 	*/
 }
 
+// Queries of this object are added as spans to the trace
+func (db *Database) SetTrace(trace *tracing.Trace) {
+	db.trace = trace
+
+	if m, ok := db.db.(*database.MySQLDBManager); ok {
+		m.Trace = trace
+	}
+}
+
+func (db *Database) GetTrace() *tracing.Trace {
+	return db.trace
+}
+
 func (db *Database) SetLogger(Logger *utils.LoggerMan) {
 	db.Logger = Logger
 }
@@ -70,27 +86,7 @@ func (db *Database) CheckConnection() error {
 
 // check if connection to DB can be set
 func (db *Database) GetAllTables() ([]string, error) {
-	results, err := db.DB().QM().ExecuteSQLSelectRows("SHOW TABLES")
-
-	if err != nil {
-		return nil, err
-	}
-
-	tables := []string{}
-
-	for _, row := range results {
-		table := ""
-
-		for _, t := range row {
-			table = t
-			break
-		}
-		if table != "" {
-			tables = append(tables, table)
-		}
-	}
-
-	return tables, nil
+	return db.DB().QM().ExecuteSQLTablesList()
 }
 
 // open DB connection if it is not yet opened
@@ -111,6 +107,7 @@ func (db *Database) OpenConnection(sessid string) error {
 func (db *Database) PrepareConnection(sessid string) {
 	obj := &database.MySQLDBManager{}
 	obj.SessID = sessid
+	obj.Trace = db.trace
 	db.db = obj
 	db.db.SetLogger(db.Logger)
 	db.db.SetConfig(db.Config)
@@ -171,6 +168,11 @@ func (db *Database) Dump(file string) error {
 	return db.DB().QM().Dump(file)
 }
 
+// dump some tables of DB to file
+func (db *Database) DumpTables(file string, tables []string) error {
+	return db.DB().QM().DumpTables(file, tables)
+}
+
 // restore from dump
 func (db *Database) Restore(file string) error {
 	return db.DB().QM().Restore(file)
@@ -0,0 +1,219 @@
+package nodemanager
+
+/*
+* Headers-first sync. When this node is far behind other nodes, headers of missed blocks are loaded first from
+* several nodes and verified, a header has a hash of transactions, so a hash of a block is checked without body.
+* Then bodies are requested from all these nodes at same time and added to the chain in order of height
+ */
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/nodeclient"
+	"github.com/gelembjuk/oursql/node/structures"
+)
+
+const (
+	// default number of blocks behind other nodes when the sync is done with headers first
+	headersSyncMinBehind = 100
+	// headers in one request
+	headersSyncPageSize = 500
+)
+
+// Top of the chain of a node
+type headersSyncPeer struct {
+	addr net.NodeAddr
+	top  nodeclient.ComBlockHeader
+}
+
+// Loads the chain with headers first if other nodes have more blocks than HeadersFirstSync. Returns hashes
+// of added blocks, nothing if this node is not far behind
+func (n *communicationManager) syncHeadersFirst(nodes []*net.NodeAddr, myBestHeight int) ([][]byte, error) {
+	minBehind := n.node.HeadersFirstSync
+
+	if minBehind < 0 {
+		return nil, nil
+	}
+
+	if minBehind == 0 {
+		minBehind = headersSyncMinBehind
+	}
+
+	peers := n.getHeadersSyncPeers(nodes, myBestHeight+minBehind)
+
+	if len(peers) == 0 {
+		return nil, nil
+	}
+
+	n.logger.Trace.Printf("Headers-first sync from %d nodes. Height %d, other nodes have %d", len(peers), myBestHeight, peers[0].top.Height)
+
+	headers, err := n.loadHeadersChain(peers)
+
+	if err != nil {
+		return nil, err
+	}
+
+	n.logger.Trace.Printf("Headers-first sync. Loaded %d headers, load blocks", len(headers))
+
+	return n.loadBlocksByHeaders(peers, headers)
+}
+
+// Returns nodes which have at least minHeight blocks. A node with the highest top is first
+func (n *communicationManager) getHeadersSyncPeers(nodes []*net.NodeAddr, minHeight int) []headersSyncPeer {
+	peers := []headersSyncPeer{}
+
+	for _, node := range nodes {
+		if node.CompareToAddress(n.node.NodeClient.NodeAddress) {
+			continue
+		}
+
+		headers, err := n.node.NodeClient.SendGetBlockHeaders(*node, []byte{}, 1)
+
+		if err != nil {
+			n.node.NodeNet.HookNeworkOperationResultForNode(err, node)
+			continue
+		}
+
+		if len(headers) == 0 || headers[0].Height < minHeight {
+			continue
+		}
+
+		peers = append(peers, headersSyncPeer{*node, headers[0]})
+
+		if last := len(peers) - 1; peers[last].top.Height > peers[0].top.Height {
+			peers[0], peers[last] = peers[last], peers[0]
+		}
+	}
+	return peers
+}
+
+// Loads headers going down from the top of the first node till a block which exists in this chain.
+// Pages are requested from different nodes, if a node fails next one is used. Returns headers from lowest
+func (n *communicationManager) loadHeadersChain(peers []headersSyncPeer) ([]nodeclient.ComBlockHeader, error) {
+	headers := []nodeclient.ComBlockHeader{}
+
+	lowest := peers[0].top
+	startFrom := lowest.Hash
+
+	for page := 0; ; page++ {
+		var pageHeaders []nodeclient.ComBlockHeader
+		var err error
+
+		for i := 0; i < len(peers); i++ {
+			peer := peers[(page+i)%len(peers)]
+
+			pageHeaders, err = n.node.NodeClient.SendGetBlockHeaders(peer.addr, startFrom, headersSyncPageSize)
+
+			if err == nil {
+				err = n.checkHeadersPage(startFrom, headers, pageHeaders)
+			}
+
+			if err == nil {
+				break
+			}
+			n.node.NodeNet.HookNeworkOperationResultForNode(err, &peer.addr)
+
+			n.logger.Trace.Printf("Headers from %s are not loaded: %s", peer.addr.NodeAddrToString(), err.Error())
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, h := range pageHeaders {
+			headers = append(headers, h)
+
+			exists, err := n.node.NodeBC.CheckBlockExists(h.PrevBlockHash)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if exists {
+				// reverse, blocks are added from lowest
+				for i, j := 0, len(headers)-1; i < j; i, j = i+1, j-1 {
+					headers[i], headers[j] = headers[j], headers[i]
+				}
+				return headers, nil
+			}
+
+			if len(h.PrevBlockHash) == 0 {
+				return nil, errors.New("Chain of other nodes has no common blocks with this chain")
+			}
+		}
+
+		startFrom = headers[len(headers)-1].PrevBlockHash
+	}
+}
+
+// Checks a page of headers continues loaded headers. Headers must be linked and have correct hashes
+func (n *communicationManager) checkHeadersPage(startFrom []byte, loaded []nodeclient.ComBlockHeader,
+	page []nodeclient.ComBlockHeader) error {
+
+	if len(page) == 0 {
+		return errors.New("Node returned no block headers")
+	}
+
+	if bytes.Compare(page[0].Hash, startFrom) != 0 {
+		return errors.New("Node returned wrong first header")
+	}
+
+	var upper *nodeclient.ComBlockHeader
+
+	if len(loaded) > 0 {
+		upper = &loaded[len(loaded)-1]
+	}
+
+	bm := n.node.getBlockMakeManager()
+
+	for i := range page {
+		h := page[i]
+
+		if upper != nil && (bytes.Compare(upper.PrevBlockHash, h.Hash) != 0 || upper.Height != h.Height+1) {
+			return errors.New(fmt.Sprintf("Blocks chain is broken at height %d", h.Height))
+		}
+
+		block := &structures.Block{
+			Timestamp:     h.Timestamp,
+			PrevBlockHash: h.PrevBlockHash,
+			Hash:          h.Hash,
+			Nonce:         h.Nonce,
+			Height:        h.Height}
+
+		if err := bm.VerifyBlockHeader(block, h.MerkleRoot); err != nil {
+			return err
+		}
+		upper = &page[i]
+	}
+	return nil
+}
+
+// Returns a body of a block if it is same as the header
+func (n *communicationManager) getBlockBody(response nodeclient.AsyncResponse, h nodeclient.ComBlockHeader) ([]byte, error) {
+	if response.Err != nil {
+		return nil, response.Err
+	}
+
+	blockdata := response.Payload.(*nodeclient.ResponseGetBlock).Block
+
+	block, err := structures.NewBlockFromBytes(blockdata)
+
+	if err != nil {
+		return nil, err
+	}
+
+	merkleRoot, err := block.HashTransactions()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Compare(block.Hash, h.Hash) != 0 || bytes.Compare(block.PrevBlockHash, h.PrevBlockHash) != 0 ||
+		bytes.Compare(merkleRoot, h.MerkleRoot) != 0 {
+		return nil, errors.New("Block is not same as its header")
+	}
+	return blockdata, nil
+}
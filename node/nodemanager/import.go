@@ -0,0 +1,172 @@
+package nodemanager
+
+/*
+* Reads data to import to tables. A transaction references one row (and has rollback for one row),
+* so every row becomes separate INSERT query. Extended INSERTs of dumps are split to rows
+ */
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/gelembjuk/oursql/node/database"
+	"github.com/gelembjuk/oursql/node/dbquery"
+)
+
+// NULL value in CSV, same as mysqldump and SELECT INTO OUTFILE write it
+const importCSVNull = "\\N"
+
+var importInsertRegexp = regexp.MustCompile("(?is)^(insert\\s+(?:ignore\\s+)?into\\s+[^\\s(]+\\s*(?:\\([^)]*\\))?\\s*values)\\s*(.*)$")
+
+// Statements of dumps that do nothing for tables data
+var importSkipPrefixes = []string{"/*", "set ", "lock tables", "unlock tables"}
+
+type DataImport struct {
+	file    *os.File
+	csv     *csv.Reader
+	table   string
+	quoter  database.Quoter
+	columns []string
+	// queries of SQL file which are not yet returned
+	queries []string
+}
+
+// Opens a file for import. CSV file (.csv extension) must have column names in the first line,
+// rows are inserted to the table. Other files are SQL with INSERT and CREATE TABLE statements
+func (n *Node) OpenDataImport(filePath string, table string) (*DataImport, error) {
+	di := &DataImport{}
+
+	if !strings.HasSuffix(strings.ToLower(filePath), ".csv") {
+		return di, di.loadSQL(filePath)
+	}
+
+	if table == "" {
+		return nil, errors.New("Table is not provided. It is required for CSV file")
+	}
+
+	if !n.IsManagedTable(table) {
+		return nil, errors.New(fmt.Sprintf("Table %s is not managed by the blockchain", table))
+	}
+
+	file, err := os.Open(filePath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	di.file = file
+	di.table = table
+	di.quoter = n.DBConn.DB().QM().GetQuoter()
+	di.csv = csv.NewReader(file)
+
+	di.columns, err = di.csv.Read()
+
+	if err != nil {
+		file.Close()
+		return nil, errors.New(fmt.Sprintf("Can not read columns from the first line: %s", err.Error()))
+	}
+
+	for i, c := range di.columns {
+		di.columns[i] = di.quoter.Identifier(strings.Trim(strings.TrimSpace(c), "`"))
+	}
+	return di, nil
+}
+
+func (di *DataImport) loadSQL(filePath string) error {
+	data, err := ioutil.ReadFile(filePath)
+
+	if err != nil {
+		return err
+	}
+
+	lines := []string{}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		l := strings.TrimSpace(line)
+
+		if strings.HasPrefix(l, "--") || strings.HasPrefix(l, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	for _, sql := range dbquery.SplitSQLList(strings.Join(lines, "\n"), ';') {
+		lower := strings.ToLower(sql)
+
+		if importSkip(lower) {
+			continue
+		}
+
+		if strings.HasPrefix(lower, "create table") {
+			di.queries = append(di.queries, sql)
+			continue
+		}
+
+		m := importInsertRegexp.FindStringSubmatch(sql)
+
+		if m == nil {
+			return errors.New(fmt.Sprintf("Only CREATE TABLE and INSERT statements can be imported. Found: %s", sql))
+		}
+
+		for _, row := range dbquery.SplitSQLList(m[2], ',') {
+			di.queries = append(di.queries, m[1]+" "+row)
+		}
+	}
+	return nil
+}
+
+func importSkip(lowerSQL string) bool {
+	for _, prefix := range importSkipPrefixes {
+		if strings.HasPrefix(lowerSQL, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns next query. io.EOF error is returned when there are no more queries
+func (di *DataImport) Next() (string, error) {
+	if di.csv == nil {
+		if len(di.queries) == 0 {
+			return "", io.EOF
+		}
+		sql := di.queries[0]
+		di.queries = di.queries[1:]
+
+		return sql, nil
+	}
+
+	record, err := di.csv.Read()
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(record) != len(di.columns) {
+		return "", errors.New(fmt.Sprintf("Row has %d values, but there are %d columns", len(record), len(di.columns)))
+	}
+
+	values := []string{}
+
+	for _, v := range record {
+		if v == importCSVNull {
+			values = append(values, "NULL")
+		} else {
+			values = append(values, di.quoter.Literal(v))
+		}
+	}
+
+	return "INSERT INTO " + di.table + " (" + strings.Join(di.columns, ", ") + ") VALUES (" + strings.Join(values, ", ") + ")", nil
+}
+
+func (di *DataImport) Close() {
+	if di.file != nil {
+		di.file.Close()
+	}
+}
@@ -0,0 +1,30 @@
+package nodemanager
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Runs a maintenance operation of a managed table. Blocks and transactions are not applied while it works,
+// so they don't wait for locks of the table and fail
+func (n *Node) RunTableMaintenance(table string, operation string) error {
+	if !n.IsManagedTable(table) {
+		return errors.New(fmt.Sprintf("Table %s is not managed by the blockchain", table))
+	}
+
+	n.locks.transactionsExecute.Lock()
+	defer n.locks.transactionsExecute.Unlock()
+
+	started := time.Now()
+
+	err := n.DBConn.DB().QM().ExecuteSQLMaintenance(table, operation)
+
+	if err != nil {
+		return err
+	}
+
+	n.Logger.Trace.Printf("Maintenance %s of %s done in %s", operation, table, time.Since(started))
+
+	return nil
+}
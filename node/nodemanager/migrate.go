@@ -0,0 +1,81 @@
+package nodemanager
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gelembjuk/oursql/node/dbquery"
+)
+
+// Builds SQL queries to change tables of a DB to the schema. The schema is a list of CREATE TABLE statements.
+// Queries are in order they must be executed. Tables and columns not in the schema are dropped only if drop is true
+func (n *Node) GetSchemaMigration(schemaSQL string, drop bool) ([]string, error) {
+	qm := n.DBConn.DB().QM()
+
+	lines := []string{}
+
+	for _, line := range strings.Split(schemaSQL, "\n") {
+		l := strings.TrimSpace(line)
+
+		if strings.HasPrefix(l, "--") || strings.HasPrefix(l, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	desired := []*dbquery.TableSchema{}
+
+	for _, create := range dbquery.SplitSQLList(strings.Join(lines, "\n"), ';') {
+		if !strings.HasPrefix(strings.ToLower(create), "create table") {
+			return nil, errors.New(fmt.Sprintf("Only CREATE TABLE statements are allowed in a schema. Found: %s", create))
+		}
+
+		// desired tables must be written same way as MySQL shows existent tables, otherwise everything will look different
+		canonical, err := qm.ExecuteSQLCanonicalCreateTable(create)
+
+		if err != nil {
+			n.Logger.Trace.Printf("Can not get canonical form of a table. Use as is. %s", err.Error())
+			canonical = create
+		}
+
+		table, err := dbquery.ParseCreateTable(canonical)
+
+		if err != nil {
+			return nil, err
+		}
+		// new tables are created with a query from the schema file
+		table.Create = create
+
+		if !n.IsManagedTable(table.Name) {
+			return nil, errors.New(fmt.Sprintf("Table %s is not managed by the blockchain", table.Name))
+		}
+
+		desired = append(desired, table)
+	}
+
+	tables, err := n.GetManagedTables()
+
+	if err != nil {
+		return nil, err
+	}
+
+	current := []*dbquery.TableSchema{}
+
+	for _, name := range tables {
+		create, err := qm.ExecuteSQLCreateTable(name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		table, err := dbquery.ParseCreateTable(create)
+
+		if err != nil {
+			return nil, err
+		}
+		current = append(current, table)
+	}
+
+	return dbquery.DiffSchemas(current, desired, drop)
+}
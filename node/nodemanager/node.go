@@ -1,8 +1,9 @@
 package nodemanager
 
 import (
-	"crypto/ecdsa"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"math/rand"
 	"sync"
 	"time"
@@ -11,9 +12,12 @@ import (
 	"github.com/gelembjuk/oursql/lib/net"
 	"github.com/gelembjuk/oursql/lib/nodeclient"
 	"github.com/gelembjuk/oursql/lib/remoteclient"
+	"github.com/gelembjuk/oursql/lib/tracing"
 	"github.com/gelembjuk/oursql/lib/utils"
 	"github.com/gelembjuk/oursql/node/blockchain"
 	"github.com/gelembjuk/oursql/node/consensus"
+	"github.com/gelembjuk/oursql/node/database"
+	"github.com/gelembjuk/oursql/node/dbquery"
 	"github.com/gelembjuk/oursql/node/structures"
 	"github.com/gelembjuk/oursql/node/transactions"
 )
@@ -26,15 +30,29 @@ type Node struct {
 	NodeClient *nodeclient.NodeClient
 	DBConn     *Database
 
-	ConfigDir       string
-	MinterAddress   string
-	ProxyPubKey     []byte
-	ProxyPrivateKey ecdsa.PrivateKey
+	ConfigDir     string
+	MinterAddress string
+	// Signs SQL transactions in a proxy. Can be nil
+	ProxySigner utils.Signer
+	// Signers of proxy transactions per MySQL user. Nil signer means the user must sign transactions itself
+	ProxyUserSigners map[string]utils.Signer
 
 	OtherNodes []net.NodeAddr
+	// Goroutines to verify transactions received from other node. 0 means number of CPUs
+	TXVerifyWorkers int
+	// Blocks behind other nodes when headers of blocks are loaded before bodies. 0 means 100, -1 turns it off
+	HeadersFirstSync int
+	// Send new blocks as compact blocks to nodes which accept them
+	CompactBlocks bool
+	// Checked before a block is made. If it returns an error, a block is not made, new transaction is sent to other nodes
+	BlockMakingCheck func() error
+	// Called when other branch becomes the primary chain, after SQL of blocks is rolled back and executed.
+	// It must not wait long, new blocks are not added till it returns
+	OnReorg func(event *ReorgEvent)
 
 	SessionID       string
 	locks           *NodeLocks
+	orphans         *OrphanBlocks
 	ConsensusConfig *consensus.ConsensusConfig
 }
 type NodeLocks struct {
@@ -70,6 +88,10 @@ func (n *Node) Init() {
 	n.locks = &NodeLocks{}
 	n.locks.InitLocks()
 
+	if n.orphans == nil {
+		n.orphans = newOrphanBlocks()
+	}
+
 	rand.Seed(time.Now().UTC().UnixNano())
 }
 
@@ -80,20 +102,40 @@ func (orignode *Node) Clone() *Node {
 	node.ConfigDir = orignode.ConfigDir
 	node.Logger = orignode.Logger
 	node.MinterAddress = orignode.MinterAddress
-	node.ProxyPubKey = orignode.ProxyPubKey
-	node.ProxyPrivateKey = orignode.ProxyPrivateKey
+	node.ProxySigner = orignode.ProxySigner
+	node.ProxyUserSigners = orignode.ProxyUserSigners
+	node.TXVerifyWorkers = orignode.TXVerifyWorkers
+	node.HeadersFirstSync = orignode.HeadersFirstSync
+	node.CompactBlocks = orignode.CompactBlocks
+	node.BlockMakingCheck = orignode.BlockMakingCheck
+	node.OnReorg = orignode.OnReorg
 	// clone DB object
 	ndb := orignode.DBConn.Clone()
 	node.DBConn = &ndb
 
 	node.locks = orignode.locks
+	node.orphans = orignode.orphans
 	node.ConsensusConfig = orignode.ConsensusConfig
 
 	node.Init()
 
+	node.NodeClient.Identity = orignode.NodeClient.Identity
+	node.NodeClient.WireFormat = orignode.NodeClient.WireFormat
+	node.NodeClient.PeerFormats = orignode.NodeClient.PeerFormats
+	node.NodeClient.Timeouts = orignode.NodeClient.Timeouts
+	node.NodeClient.Retry = orignode.NodeClient.Retry
+	node.NodeClient.MaxResponseSize = orignode.NodeClient.MaxResponseSize
+	node.NodeClient.RateLimiter = orignode.NodeClient.RateLimiter
+	node.NodeClient.Bandwidth = orignode.NodeClient.Bandwidth
+	node.NodeClient.Outbound = orignode.NodeClient.Outbound
+	node.NodeClient.Transport = orignode.NodeClient.Transport
+	node.NodeClient.Metrics = orignode.NodeClient.Metrics
+	node.NodeClient.BroadcastWorkers = orignode.NodeClient.BroadcastWorkers
+	node.NodeClient.SetContext(orignode.NodeClient.Context())
 	node.NodeClient.SetNodeAddress(orignode.NodeClient.NodeAddress)
 
 	node.InitNodes(orignode.NodeNet.Nodes, true) // set list of nodes and skip loading default if this is empty list
+	node.NodeNet.Identity = orignode.NodeNet.Identity
 
 	return &node
 }
@@ -104,6 +146,14 @@ func (n *NodeLocks) InitLocks() {
 	n.transactionsExecute = &sync.Mutex{}
 }
 
+// Sets a trace of a request served by this node object. Requests to other nodes and DB queries are added to it
+func (n *Node) SetTrace(trace *tracing.Trace) {
+	n.DBConn.SetTrace(trace)
+
+	n.InitClient()
+	n.NodeClient.Trace = trace
+}
+
 // Build transaction manager structure
 func (n *Node) GetTransactionsManager() transactions.TransactionsManagerInterface {
 	return transactions.NewManager(n.DBConn.DB(), n.Logger, n.ConsensusConfig.GetInfoForTransactions())
@@ -126,7 +176,29 @@ func (n *Node) getBlockMakeManager() consensus.BlockMakerInterface {
 
 // Init SQL transactions manager
 func (n *Node) GetSQLQueryManager() (consensus.SQLTransactionsInterface, error) {
-	return consensus.NewSQLQueryManager(n.ConsensusConfig, n.DBConn.DB(), n.Logger, n.ProxyPubKey, n.ProxyPrivateKey)
+	return consensus.NewSQLQueryManager(n.ConsensusConfig, n.DBConn.DB(), n.Logger, n.ProxySigner)
+}
+
+// Signer of proxy transactions for a MySQL user. Default proxy signer is used only if there is no list of users.
+// Returns false if the user is not in the list
+func (n *Node) GetProxySigner(user string) (utils.Signer, bool) {
+	if len(n.ProxyUserSigners) == 0 {
+		return n.ProxySigner, true
+	}
+	signer, ok := n.ProxyUserSigners[user]
+
+	return signer, ok
+}
+
+// Init SQL transactions manager which signs transactions of a MySQL user of a proxy.
+// If proxy users are set, other users can not use the proxy. It is also a user not known to the proxy (SSL connection)
+func (n *Node) GetSQLQueryManagerForUser(user string) (consensus.SQLTransactionsInterface, error) {
+	signer, ok := n.GetProxySigner(user)
+
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("MySQL user '%s' is not in the list of proxy users", user))
+	}
+	return consensus.NewSQLQueryManager(n.ConsensusConfig, n.DBConn.DB(), n.Logger, signer)
 }
 
 // Create communication object to do requests to othernodes
@@ -160,6 +232,7 @@ func (n *Node) InitClient() error {
 
 	client.Logger = n.Logger
 	client.NodeNet = &n.NodeNet
+	client.PeerFormats = net.NewPeerWireFormats()
 
 	n.NodeClient = &client
 
@@ -201,11 +274,10 @@ func (n *Node) BlockchainExist() bool {
 }
 
 // Create new blockchain, add genesis block witha given text
-func (n *Node) CreateBlockchain(minterAddress string, pubKey []byte, privateKey ecdsa.PrivateKey) error {
+func (n *Node) CreateBlockchain(minterAddress string, signer utils.Signer) error {
 	bccreator := n.getCreateManager()
 	bccreator.MinterAddress = minterAddress
-	bccreator.PubKey = pubKey
-	bccreator.PrivateKey = privateKey
+	bccreator.Signer = signer
 	bccreator.BC = &n.NodeBC
 	genesisCoinbaseData := "some string. this is TEMP"
 
@@ -295,12 +367,17 @@ func (n *Node) CheckAddressKnown(addr net.NodeAddr) bool {
 // and send list of all addresses to that node
 
 func (n *Node) checkAddressKnown(addr net.NodeAddr, afterinputconnect bool) bool {
+	if addr.IsLocal() {
+		// other node can not tell to connect to a socket on this machine
+		return false
+	}
+
 	added := false
 
 	n.Logger.Trace.Printf("Check node is known %s", addr.NodeAddrToString())
 
 	if !n.NodeNet.CheckIsKnown(addr) &&
-		!addr.CompareToAddress(n.NodeClient.NodeAddress) {
+		!addr.CompareToAddress(n.NodeClient.NodeAddress) && !n.NodeNet.IsThisNode(addr) {
 		// send him all addresses
 		n.Logger.Trace.Printf("Adding to known to %s", addr.NodeAddrToString())
 		n.NodeClient.SendAddrList(addr, n.NodeNet.Nodes)
@@ -320,7 +397,7 @@ func (n *Node) checkAddressKnown(addr net.NodeAddr, afterinputconnect bool) bool
 // Send money .
 // This adds a transaction directly to the DB. Can be executed when a node server is not running
 // This creates currency transfer transaction where SQL command is not present
-func (n *Node) Send(PubKey []byte, privKey ecdsa.PrivateKey, to string, amount float64) ([]byte, error) {
+func (n *Node) Send(signer utils.Signer, to string, amount float64) ([]byte, error) {
 	// get pubkey of the wallet with "from" address
 	if to == "" {
 		return nil, errors.New("Recipient address is not provided")
@@ -328,10 +405,23 @@ func (n *Node) Send(PubKey []byte, privKey ecdsa.PrivateKey, to string, amount f
 	w := remoteclient.Wallet{}
 
 	if !w.ValidateAddress(to) {
-		return nil, errors.New("Recipient address is not valid")
+		// it can be a name from the names registry
+		if !utils.IsValidName(to) {
+			return nil, errors.New("Recipient address is not valid")
+		}
+		record, err := consensus.NewNamesManager(n.DBConn.DB(), n.Logger).GetByName(to)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if record == nil {
+			return nil, errors.New("Recipient name is not registered")
+		}
+		to = record.Address
 	}
 
-	tx, err := n.GetTransactionsManager().CreateCurrencyTransaction(PubKey, privKey, to, amount)
+	tx, err := n.GetTransactionsManager().CreateCurrencyTransaction(signer, to, amount)
 
 	if err != nil {
 		return nil, err
@@ -344,13 +434,13 @@ func (n *Node) Send(PubKey []byte, privKey ecdsa.PrivateKey, to string, amount f
 // Execute SQL query
 // This adds a transaction directly to the DB. Can be executed when a node server is not running
 // This creates SQL transaction . Currency part can be present if SQL query "costs money"
-func (n *Node) SQLTransaction(PubKey []byte, privKey ecdsa.PrivateKey, sqlcommand string) ([]byte, error) {
+func (n *Node) SQLTransaction(signer utils.Signer, sqlcommand string) ([]byte, error) {
 	qm, err := n.GetSQLQueryManager()
 	if err != nil {
 		return nil, err
 	}
 
-	_, tx, err := qm.NewQueryByNode(sqlcommand, PubKey, privKey)
+	_, tx, err := qm.NewQueryByNode(sqlcommand, signer)
 
 	if err != nil {
 		return nil, err
@@ -368,12 +458,28 @@ func (n *Node) SQLTransaction(PubKey []byte, privKey ecdsa.PrivateKey, sqlcomman
 func (n *Node) TryToMakeBlock(newTransactionID []byte, callback PreparedTransactionsCallback) ([]byte, error) {
 	n.Logger.Trace.Println("Try to make new block")
 
+	if !database.IsServerAvailable() {
+		return nil, database.NewDBUnavailableError()
+	}
+
 	w := remoteclient.Wallet{}
 
 	if n.MinterAddress == "" || !w.ValidateAddress(n.MinterAddress) {
 		return nil, errors.New("Minter address is not provided")
 	}
 
+	if n.BlockMakingCheck != nil {
+		err := n.BlockMakingCheck()
+
+		if err != nil {
+			n.Logger.Trace.Printf("Block is not made: %s", err.Error())
+			n.sendNewTransactionToAll(newTransactionID)
+			n.DBConn.CloseConnection()
+
+			return nil, nil
+		}
+	}
+
 	//n.Logger.Trace.Println("Create block maker")
 	// check how many transactions are ready to be added to a block
 	Minter := n.getBlockMakeManager()
@@ -392,22 +498,7 @@ func (n *Node) TryToMakeBlock(newTransactionID []byte, callback PreparedTransact
 	if prepres != consensus.BlockPrepare_Done {
 		n.Logger.Trace.Println("No anough transactions to make a block")
 
-		if len(newTransactionID) > 1 {
-			n.Logger.Trace.Printf("Send this new transaction to all other")
-			// block was not created and txID is real transaction ID
-			// send this transaction to all other nodes.
-
-			tx, err := n.GetTransactionsManager().GetIfUnapprovedExists(newTransactionID)
-
-			if err == nil && tx != nil {
-				// send TX to all other nodes
-				n.GetCommunicationManager().sendTransactionToAll(tx)
-			} else if err != nil {
-				n.Logger.Trace.Printf("Error: %s", err.Error())
-			} else if tx == nil {
-				n.Logger.Trace.Printf("Error: TX %x is not found", newTransactionID)
-			}
-		}
+		n.sendNewTransactionToAll(newTransactionID)
 
 		return nil, nil
 	}
@@ -452,10 +543,41 @@ func (n *Node) TryToMakeBlock(newTransactionID []byte, callback PreparedTransact
 
 }
 
+// When a block was not created and txID is real transaction ID, send this transaction to all other nodes
+func (n *Node) sendNewTransactionToAll(newTransactionID []byte) {
+	if len(newTransactionID) < 2 {
+		return
+	}
+	n.Logger.Trace.Printf("Send this new transaction to all other")
+
+	tx, err := n.GetTransactionsManager().GetIfUnapprovedExists(newTransactionID)
+
+	if err == nil && tx != nil {
+		// send TX to all other nodes
+		n.GetCommunicationManager().sendTransactionToAll(tx)
+	} else if err != nil {
+		n.Logger.Trace.Printf("Error: %s", err.Error())
+	} else if tx == nil {
+		n.Logger.Trace.Printf("Error: TX %x is not found", newTransactionID)
+	}
+}
+
 // Add new block to blockchain.
 // It can be executed when new block was created locally or received from other node
 
-func (n *Node) AddBlock(block *structures.Block) (uint, error) {
+func (n *Node) AddBlock(block *structures.Block) (state uint, err error) {
+	span := n.DBConn.GetTrace().Start("block add", tracing.KindInternal)
+	span.SetAttribute("block.hash", hex.EncodeToString(block.Hash))
+	span.SetAttribute("block.height", block.Height)
+
+	defer func() {
+		span.End(err)
+	}()
+
+	// a block is not applied if we know the DB server is down. Otherwise it can be applied partially
+	if !database.IsServerAvailable() {
+		return 0, database.NewDBUnavailableError()
+	}
 
 	bcm, err := n.GetBCManager()
 
@@ -534,6 +656,8 @@ func (n *Node) AddBlock(block *structures.Block) (uint, error) {
 
 				return 0, err
 			}
+
+			n.reorgHappened(oldChain, newChain)
 		}
 	}
 
@@ -592,8 +716,13 @@ func (n *Node) ReceivedFullBlockFromOtherNode(blockdata []byte) (int, uint, *str
 	block, err := structures.NewBlockFromBytes(blockdata)
 
 	if err != nil {
-		return -1, addstate, nil, err
+		return -1, addstate, nil, net.NewRemoteError(net.ErrorCodeBadRequest, "Block can not be parsed: "+err.Error())
+	}
+	if !database.IsServerAvailable() {
+		// it will be pulled again when the server is back
+		return -1, addstate, nil, database.NewDBUnavailableError()
 	}
+
 	// lock this process to prevent conflicts
 	n.locks.transactionsExecute.Lock()
 	defer n.locks.transactionsExecute.Unlock()
@@ -616,6 +745,14 @@ func (n *Node) ReceivedFullBlockFromOtherNode(blockdata []byte) (int, uint, *str
 			return -1, addstate, nil, err
 		}
 		n.Logger.Trace.Printf("Added block %x\n", block.Hash)
+
+		n.connectOrphanBlocks(block.Hash)
+	} else if blockstate == 2 {
+		err = n.addOrphanBlock(block)
+
+		if err != nil {
+			return -1, addstate, nil, err
+		}
 	} else {
 		n.Logger.Trace.Printf("Block can not be added. State is %d\n", blockstate)
 	}
@@ -624,7 +761,14 @@ func (n *Node) ReceivedFullBlockFromOtherNode(blockdata []byte) (int, uint, *str
 
 // Received new transaction . This must verify and if all ok it adds to the pool
 func (n *Node) ReceivedNewTransaction(tx *structures.Transaction, flags int) error {
-	return n.getBlockMakeManager().AddTransactionToPool(tx, flags)
+	span := n.DBConn.GetTrace().Start("transaction add", tracing.KindInternal)
+	span.SetAttribute("transaction.id", hex.EncodeToString(tx.GetID()))
+
+	err := n.getBlockMakeManager().AddTransactionToPool(tx, flags)
+
+	span.End(err)
+
+	return err
 }
 
 // New transactions created. It is received in serialysed view and signatures separately
@@ -657,6 +801,19 @@ func (n *Node) GetNodeState() (nodeclient.ComGetNodeState, error) {
 
 	result.ExpectingBlocksHeight = 0
 
+	health := database.GetServerHealth()
+
+	result.DBAvailable = health.Available
+	result.DBHealthSince = health.Since.Unix()
+	result.DBHealthFailures = health.Failures
+	result.DBReconnects = health.Reconnects
+	result.DBLastError = health.LastError
+
+	if !health.Available {
+		// nothing else can be read now
+		return result, nil
+	}
+
 	bh, err := n.NodeBC.GetBestHeight()
 
 	if err != nil {
@@ -679,5 +836,45 @@ func (n *Node) GetNodeState() (nodeclient.ComGetNodeState, error) {
 
 	result.UnspentOutputs = unspent
 
+	version, err := n.DBConn.DB().QM().ExecuteSQLServerVersion()
+
+	if err != nil {
+		return result, err
+	}
+
+	if version.Full != "" {
+		result.DBServerVersion = version.String()
+
+		apply, err := n.DBConn.Config.GetApplySettings()
+
+		if err != nil {
+			return result, err
+		}
+		result.DBApplySettings = apply.String()
+	}
+
+	timeouts, timeoutTX := transactions.GetApplyTimeouts()
+
+	result.ApplyTimeouts = timeouts
+
+	if timeoutTX != nil {
+		result.ApplyTimeoutLastTX = hex.EncodeToString(timeoutTX)
+	}
+
+	pool := database.GetPoolStats()
+
+	result.DBPoolOpen = pool.OpenConnections
+	result.DBPoolInUse = pool.InUse
+	result.DBPoolIdle = pool.Idle
+	result.DBPoolMaxOpen = pool.MaxOpenConnections
+	result.DBPoolWaitCount = pool.WaitCount
+	result.DBPoolWaitTime = int64(pool.WaitDuration / time.Millisecond)
+
+	cache := dbquery.GetQueryCacheStats()
+
+	result.QueryCacheEntries = cache.Entries
+	result.QueryCacheHits = cache.Hits
+	result.QueryCacheMisses = cache.Misses
+
 	return result, nil
 }
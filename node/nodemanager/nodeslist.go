@@ -1,6 +1,10 @@
 package nodemanager
 
 import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
 	"github.com/gelembjuk/oursql/lib/net"
 )
 
@@ -20,9 +24,22 @@ func (s NodesListStorage) GetNodes() ([]net.NodeAddr, error) {
 	nodes := []net.NodeAddr{}
 
 	nddb.ForEach(func(k, v []byte) error {
-		addr := string(v)
+		// a value is the address from the key, then /identity and |stats if they are known.
+		// The address is not parsed from the value, an URL of a WebSocket has slashes
 		node := net.NodeAddr{}
-		node.LoadFromString(addr)
+		node.LoadFromString(string(k))
+
+		rest := strings.TrimPrefix(string(v), string(k))
+
+		if i := strings.Index(rest, "|"); i >= 0 {
+			fmt.Sscanf(rest[i+1:], "%d,%d,%d,%d,%d", &node.LastSeen, &node.SuccessConnections,
+				&node.FailedConnections, &node.SuccessIncomeConnections, &node.Services)
+			rest = rest[:i]
+		}
+
+		if strings.HasPrefix(rest, "/") {
+			node.Identity, _ = hex.DecodeString(rest[1:])
+		}
 
 		nodes = append(nodes, node)
 		return nil
@@ -46,8 +63,20 @@ func (s NodesListStorage) AddNodeToKnown(addr net.NodeAddr) {
 	}
 	address := addr.NodeAddrToString()
 	key := []byte(address)
+	value := address
+
+	if len(addr.Identity) > 0 {
+		// identity is remembered to check it after restart
+		value = value + "/" + hex.EncodeToString(addr.Identity)
+	}
+
+	if addr.LastSeen > 0 || addr.Services > 0 {
+		// to choose better nodes after restart
+		value = value + fmt.Sprintf("|%d,%d,%d,%d,%d", addr.LastSeen, addr.SuccessConnections,
+			addr.FailedConnections, addr.SuccessIncomeConnections, addr.Services)
+	}
 
-	nddb.PutNode(key, key)
+	nddb.PutNode(key, []byte(value))
 
 	return
 }
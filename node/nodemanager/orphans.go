@@ -0,0 +1,241 @@
+package nodemanager
+
+/*
+* Orphan blocks. A block received before its previous block is kept in memory and added when the previous block
+* is added, the previous block is requested from the node which sent the orphan. Only blocks with correct hash
+* are kept, the pool is limited, oldest blocks are removed first
+ */
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/node/structures"
+)
+
+const (
+	// blocks in the pool
+	orphanBlocksMax = 100
+	// a block is removed from the pool after this time
+	orphanBlockMaxAge = time.Hour
+	// a missed block is not requested again before this time
+	orphanRequestInterval = time.Minute
+)
+
+type orphanBlock struct {
+	block *structures.Block
+	added time.Time
+}
+
+type OrphanBlocks struct {
+	lock   sync.Mutex
+	blocks map[string]orphanBlock
+	// hashes of orphans by previous hash
+	children map[string][]string
+	// missed blocks which are requested
+	requested map[string]time.Time
+}
+
+func newOrphanBlocks() *OrphanBlocks {
+	return &OrphanBlocks{
+		blocks:    map[string]orphanBlock{},
+		children:  map[string][]string{},
+		requested: map[string]time.Time{}}
+}
+
+// Adds a block. Returns false if it is in the pool already
+func (o *OrphanBlocks) Add(block *structures.Block) bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if _, ok := o.blocks[string(block.Hash)]; ok {
+		return false
+	}
+
+	now := time.Now()
+
+	for hash, b := range o.blocks {
+		if now.Sub(b.added) > orphanBlockMaxAge {
+			o.remove(hash)
+		}
+	}
+
+	for len(o.blocks) >= orphanBlocksMax {
+		oldest := ""
+
+		for hash, b := range o.blocks {
+			if oldest == "" || b.added.Before(o.blocks[oldest].added) {
+				oldest = hash
+			}
+		}
+		o.remove(oldest)
+	}
+
+	o.blocks[string(block.Hash)] = orphanBlock{block, now}
+	o.children[string(block.PrevBlockHash)] = append(o.children[string(block.PrevBlockHash)], string(block.Hash))
+
+	return true
+}
+
+// Must be called with the lock
+func (o *OrphanBlocks) remove(hash string) {
+	b, ok := o.blocks[hash]
+
+	if !ok {
+		return
+	}
+	delete(o.blocks, hash)
+
+	prev := string(b.block.PrevBlockHash)
+	list := o.children[prev]
+
+	for i, h := range list {
+		if h == hash {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+
+	if len(list) == 0 {
+		delete(o.children, prev)
+	} else {
+		o.children[prev] = list
+	}
+}
+
+// Removes and returns orphans which have this previous block
+func (o *OrphanBlocks) TakeChildren(hash []byte) []*structures.Block {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	delete(o.requested, string(hash))
+
+	blocks := []*structures.Block{}
+
+	for _, h := range o.children[string(hash)] {
+		blocks = append(blocks, o.blocks[h].block)
+	}
+
+	for _, b := range blocks {
+		o.remove(string(b.Hash))
+	}
+	return blocks
+}
+
+// Returns true if a missed block can be requested now. It is not requested again from other goroutines
+func (o *OrphanBlocks) startRequest(hash []byte) bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if _, ok := o.blocks[string(hash)]; ok {
+		return false
+	}
+
+	if t, ok := o.requested[string(hash)]; ok && time.Since(t) < orphanRequestInterval {
+		return false
+	}
+
+	for h, t := range o.requested {
+		if time.Since(t) >= orphanRequestInterval {
+			delete(o.requested, h)
+		}
+	}
+	o.requested[string(hash)] = time.Now()
+
+	return true
+}
+
+func (o *OrphanBlocks) Count() int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	return len(o.blocks)
+}
+
+// Keeps a block which can not be added because there is no previous block. The hash must be correct
+func (n *Node) addOrphanBlock(block *structures.Block) error {
+	merkleRoot, err := block.HashTransactions()
+
+	if err != nil {
+		return err
+	}
+
+	err = n.getBlockMakeManager().VerifyBlockHeader(block, merkleRoot)
+
+	if err != nil {
+		return net.NewRemoteError(net.ErrorCodeBlockVerify, err.Error())
+	}
+
+	if n.orphans.Add(block) {
+		n.Logger.Trace.Printf("Orphan block %x is kept, previous block %x is not found. Orphans %d", block.Hash, block.PrevBlockHash, n.orphans.Count())
+	}
+	return nil
+}
+
+// Adds orphans which wait for this block, then orphans which wait for them. Must be called with the lock
+// of transactions execute
+func (n *Node) connectOrphanBlocks(hash []byte) {
+	queue := [][]byte{hash}
+
+	for len(queue) > 0 {
+		children := n.orphans.TakeChildren(queue[0])
+		queue = queue[1:]
+
+		for _, block := range children {
+			blockstate, err := n.NodeBC.CheckBlockState(block.Hash, block.PrevBlockHash)
+
+			if err != nil || blockstate != 0 {
+				continue
+			}
+
+			_, err = n.AddBlock(block)
+
+			if err != nil {
+				n.Logger.Trace.Printf("Orphan block %x is not added: %s", block.Hash, err.Error())
+				continue
+			}
+			n.Logger.Trace.Printf("Added orphan block %x", block.Hash)
+
+			queue = append(queue, block.Hash)
+		}
+	}
+}
+
+// Requests missed previous blocks of an orphan in background. Every received block is added or becomes an orphan,
+// then its previous block is requested, till a block which can be added
+func (n *Node) RequestOrphanAncestors(addr net.NodeAddr, block *structures.Block) {
+	hash := block.PrevBlockHash
+
+	if !n.orphans.startRequest(hash) {
+		return
+	}
+
+	node := n.Clone()
+
+	go func() {
+		defer node.DBConn.CloseConnection()
+
+		for i := 0; i < orphanBlocksMax; i++ {
+			result, err := node.NodeClient.SendGetBlock(addr, hash)
+
+			if err != nil {
+				node.Logger.Trace.Printf("Missed block %x is not loaded from %s: %s", hash, addr.NodeAddrToString(), err.Error())
+				return
+			}
+
+			blockstate, _, parent, err := node.ReceivedFullBlockFromOtherNode(result.Block)
+
+			if err != nil || blockstate != 2 || !bytes.Equal(parent.Hash, hash) {
+				return
+			}
+
+			hash = parent.PrevBlockHash
+
+			if !node.orphans.startRequest(hash) {
+				return
+			}
+		}
+	}()
+}
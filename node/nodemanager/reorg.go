@@ -0,0 +1,125 @@
+package nodemanager
+
+/*
+* Events of reorganization. When other branch becomes the primary chain, SQL of blocks of the old branch is rolled
+* back and SQL of the new branch is executed. Apps which keep data from the DB need to know which rows were changed,
+* an event has both lists of blocks with changes of their transactions
+ */
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/gelembjuk/oursql/node/structures"
+	"github.com/gelembjuk/oursql/node/transactions"
+)
+
+// Change of data by SQL transaction. Key is empty for table operations
+type ReorgChange struct {
+	TXID      []byte
+	Table     string
+	Key       string
+	Operation string
+	// a canceled transaction is in a block of the new branch too
+	Reapplied bool
+}
+
+type ReorgBlock struct {
+	Hash    []byte
+	Height  int
+	Changes []ReorgChange
+}
+
+type ReorgEvent struct {
+	OldTop []byte
+	NewTop []byte
+	// last block which is in both branches
+	CommonBlock []byte
+	// from the old top, changes are in order of rollback
+	Disconnected []ReorgBlock
+	// from the lowest block, changes are in order of execution
+	Connected []ReorgBlock
+	// tables changed in both branches
+	Tables []string
+}
+
+// Builds an event from branches returned by GetBranchesReplacement. oldChain is from the top, newChain from lowest
+func newReorgEvent(oldChain []*structures.Block, newChain []*structures.Block) *ReorgEvent {
+	event := &ReorgEvent{}
+
+	if len(oldChain) > 0 {
+		event.OldTop = oldChain[0].Hash
+		event.CommonBlock = oldChain[len(oldChain)-1].PrevBlockHash
+	}
+
+	if len(newChain) > 0 {
+		event.NewTop = newChain[len(newChain)-1].Hash
+	}
+
+	tables := map[string]bool{}
+	newTXs := map[string]bool{}
+
+	for _, block := range newChain {
+		b := ReorgBlock{Hash: block.Hash, Height: block.Height}
+
+		for _, tx := range block.Transactions {
+			if !tx.IsSQLCommand() {
+				continue
+			}
+			newTXs[string(tx.GetID())] = true
+
+			b.Changes = append(b.Changes, newReorgChange(tx, tables))
+		}
+		event.Connected = append(event.Connected, b)
+	}
+
+	for _, block := range oldChain {
+		b := ReorgBlock{Hash: block.Hash, Height: block.Height}
+
+		for i := len(block.Transactions) - 1; i >= 0; i-- {
+			tx := block.Transactions[i]
+
+			if !tx.IsSQLCommand() {
+				continue
+			}
+			c := newReorgChange(tx, tables)
+			c.Reapplied = newTXs[string(tx.GetID())]
+
+			b.Changes = append(b.Changes, c)
+		}
+		event.Disconnected = append(event.Disconnected, b)
+	}
+
+	for table := range tables {
+		event.Tables = append(event.Tables, table)
+	}
+	sort.Strings(event.Tables)
+
+	return event
+}
+
+func newReorgChange(tx structures.Transaction, tables map[string]bool) ReorgChange {
+	c := ReorgChange{TXID: tx.GetID()}
+	c.Table, c.Key, c.Operation = transactions.GetChangeOfTransaction(tx)
+
+	if c.Table != "" {
+		tables[c.Table] = true
+	}
+	return c
+}
+
+// Notifies the hook about switch of branches. Nothing is done if the top is not changed
+func (n *Node) reorgHappened(oldChain []*structures.Block, newChain []*structures.Block) {
+	event := newReorgEvent(oldChain, newChain)
+
+	if bytes.Equal(event.OldTop, event.NewTop) {
+		return
+	}
+
+	n.Logger.Trace.Printf("Reorganization from %x to %x. Disconnected %d blocks, connected %d, tables %v",
+		event.OldTop, event.NewTop, len(event.Disconnected), len(event.Connected), event.Tables)
+
+	if n.OnReorg != nil {
+		n.OnReorg(event)
+	}
+}
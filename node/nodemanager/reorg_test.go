@@ -0,0 +1,113 @@
+package nodemanager
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/gelembjuk/oursql/node/dbquery/sqlparser"
+	"github.com/gelembjuk/oursql/node/structures"
+)
+
+func makeTestReorgTX(id string, sql string, referenceID string) structures.Transaction {
+	tx := structures.Transaction{ID: []byte(id)}
+
+	if sql != "" {
+		tx.SQLCommand = structures.NewSQLUpdate(sql, referenceID, "")
+	}
+	return tx
+}
+
+func makeTestReorgBlock(hash string, prev string, height int, txs ...structures.Transaction) *structures.Block {
+	return &structures.Block{Hash: []byte(hash), PrevBlockHash: []byte(prev), Height: height, Transactions: txs}
+}
+
+func TestNewReorgEvent(t *testing.T) {
+	txA := makeTestReorgTX("a", "INSERT INTO members (id, name) VALUES (1, 'John')", "members:1")
+	txB := makeTestReorgTX("b", "UPDATE members SET name = 'Jane' WHERE id = 2", "members:2")
+	txC := makeTestReorgTX("c", "CREATE TABLE posts (id INT NOT NULL PRIMARY KEY)", "posts:*")
+	txD := makeTestReorgTX("d", "DELETE FROM logs WHERE id = 3", "logs:3")
+	// currency transactions have no changes
+	coin := makeTestReorgTX("coin", "", "")
+
+	changeA := ReorgChange{TXID: []byte("a"), Table: "members", Key: "1", Operation: sqlparser.QueryKindInsert}
+	changeB := ReorgChange{TXID: []byte("b"), Table: "members", Key: "2", Operation: sqlparser.QueryKindUpdate}
+	changeC := ReorgChange{TXID: []byte("c"), Table: "posts", Key: "", Operation: sqlparser.QueryKindCreate}
+	changeD := ReorgChange{TXID: []byte("d"), Table: "logs", Key: "3", Operation: sqlparser.QueryKindDelete}
+
+	reappliedA := changeA
+	reappliedA.Reapplied = true
+	reappliedB := changeB
+	reappliedB.Reapplied = true
+
+	// old chain is from the top, new chain from the lowest block
+	oldChain := []*structures.Block{
+		makeTestReorgBlock("old3", "old2", 3, txA, txB),
+		makeTestReorgBlock("old2", "common", 2, coin, txD),
+	}
+	newChain := []*structures.Block{
+		makeTestReorgBlock("new2", "common", 2, txB),
+		makeTestReorgBlock("new3", "new2", 3, txC, coin),
+		makeTestReorgBlock("new4", "new3", 4),
+	}
+
+	tests := []struct {
+		name     string
+		oldChain []*structures.Block
+		newChain []*structures.Block
+		expected *ReorgEvent
+	}{
+		// B is in both branches, it is rolled back and executed again. Changes of a disconnected block are reversed
+		{"shared transaction", oldChain, newChain, &ReorgEvent{
+			OldTop:      []byte("old3"),
+			NewTop:      []byte("new4"),
+			CommonBlock: []byte("common"),
+			Disconnected: []ReorgBlock{
+				ReorgBlock{[]byte("old3"), 3, []ReorgChange{reappliedB, changeA}},
+				ReorgBlock{[]byte("old2"), 2, []ReorgChange{changeD}},
+			},
+			Connected: []ReorgBlock{
+				ReorgBlock{[]byte("new2"), 2, []ReorgChange{changeB}},
+				ReorgBlock{[]byte("new3"), 3, []ReorgChange{changeC}},
+				ReorgBlock{[]byte("new4"), 4, nil},
+			},
+			Tables: []string{"logs", "members", "posts"},
+		}},
+		// the old branch is shorter, the top block of it is taken to the new branch
+		{"shared top", oldChain[:1], []*structures.Block{makeTestReorgBlock("new3", "old2", 3, txB, txA)}, &ReorgEvent{
+			OldTop:       []byte("old3"),
+			NewTop:       []byte("new3"),
+			CommonBlock:  []byte("old2"),
+			Disconnected: []ReorgBlock{ReorgBlock{[]byte("old3"), 3, []ReorgChange{reappliedB, reappliedA}}},
+			Connected:    []ReorgBlock{ReorgBlock{[]byte("new3"), 3, []ReorgChange{changeB, changeA}}},
+			Tables:       []string{"members"},
+		}},
+		{"no old blocks", nil, newChain[:1], &ReorgEvent{
+			NewTop:    []byte("new2"),
+			Connected: []ReorgBlock{ReorgBlock{[]byte("new2"), 2, []ReorgChange{changeB}}},
+			Tables:    []string{"members"},
+		}},
+		{"no blocks", nil, nil, &ReorgEvent{}},
+	}
+
+	for _, test := range tests {
+		event := newReorgEvent(test.oldChain, test.newChain)
+
+		if !bytes.Equal(event.OldTop, test.expected.OldTop) || !bytes.Equal(event.NewTop, test.expected.NewTop) ||
+			!bytes.Equal(event.CommonBlock, test.expected.CommonBlock) {
+			t.Fatalf("%s: tops are %s %s %s", test.name, event.OldTop, event.NewTop, event.CommonBlock)
+		}
+
+		if !reflect.DeepEqual(event.Disconnected, test.expected.Disconnected) {
+			t.Fatalf("%s: disconnected %+v, expected %+v", test.name, event.Disconnected, test.expected.Disconnected)
+		}
+
+		if !reflect.DeepEqual(event.Connected, test.expected.Connected) {
+			t.Fatalf("%s: connected %+v, expected %+v", test.name, event.Connected, test.expected.Connected)
+		}
+
+		if !reflect.DeepEqual(event.Tables, test.expected.Tables) {
+			t.Fatalf("%s: tables %v, expected %v", test.name, event.Tables, test.expected.Tables)
+		}
+	}
+}
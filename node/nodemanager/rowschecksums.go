@@ -0,0 +1,193 @@
+package nodemanager
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gelembjuk/oursql/lib/utils"
+)
+
+// Number of groups of rows in table checksums. A group of a row is found by its key,
+// so all nodes put a row to same group even if other rows are different
+const RowsChecksumsGroups = 64
+
+// rows are read from a table by pages
+const rowsChecksumsPageSize = 1000
+
+// Max number of keys excluded from checksums in a request. Checksums of a table with more rows in pools are not compared
+const RowsChecksumsMaxExclude = 10000
+
+// Tables with data of an application. Node tables are not included
+func (n *Node) GetManagedTables() ([]string, error) {
+	tables, err := n.DBConn.DB().QM().ExecuteSQLTablesList()
+
+	if err != nil {
+		return nil, err
+	}
+
+	list := []string{}
+
+	for _, table := range tables {
+		if n.IsManagedTable(table) {
+			list = append(list, table)
+		}
+	}
+	return list, nil
+}
+
+// Checks if updates of a table are done with transactions. Node tables and unmanaged tables of the consensus are not
+func (n *Node) IsManagedTable(table string) bool {
+	if n.DBConn.Config.IsNodeTable(table) {
+		return false
+	}
+	return !utils.StringInSlice(table, n.ConsensusConfig.UnmanagedTables)
+}
+
+// Keys of rows of a table changed by transactions in the pool. Such rows can be different on other nodes
+func (n *Node) GetPoolRowsKeys(table string) ([]string, error) {
+	refIDs, err := n.GetTransactionsManager().GetUnapprovedSQLReferences()
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+
+	for _, refID := range refIDs {
+		parts := strings.SplitN(string(refID), ":", 2)
+
+		if len(parts) == 2 && parts[0] == table && !utils.StringInSlice(parts[1], keys) {
+			keys = append(keys, parts[1])
+		}
+	}
+	return keys, nil
+}
+
+// Checksums of all groups of rows of a table. Group checksum is empty if there are no rows in it
+func (n *Node) GetTableChecksums(table string, exclude []string) ([][]byte, error) {
+	groups := make([][]string, RowsChecksumsGroups)
+
+	err := n.forEachRowChecksum(table, exclude, func(key string, checksum []byte) {
+		g := GetRowChecksumGroup(key)
+		groups[g] = append(groups[g], fmt.Sprintf("%s:%x", key, checksum))
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	checksums := make([][]byte, RowsChecksumsGroups)
+
+	for i, rows := range groups {
+		if len(rows) == 0 {
+			continue
+		}
+		// rows order can be different on nodes
+		sort.Strings(rows)
+
+		sum := md5.Sum([]byte(strings.Join(rows, "\n")))
+		checksums[i] = sum[:]
+	}
+	return checksums, nil
+}
+
+// Checksums of rows of one group. Key is a primary key value of a row
+func (n *Node) GetTableGroupRowsChecksums(table string, group int, exclude []string) (map[string][]byte, error) {
+	rows := map[string][]byte{}
+
+	err := n.forEachRowChecksum(table, exclude, func(key string, checksum []byte) {
+		if GetRowChecksumGroup(key) == group {
+			rows[key] = checksum
+		}
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// Group of a row in table checksums
+func GetRowChecksumGroup(key string) int {
+	return int(crc32.ChecksumIEEE([]byte(key)) % RowsChecksumsGroups)
+}
+
+// Calls a function with checksum of every row of a table. Columns are sorted, so order of columns in a table is not important.
+// Rows are read by pages after last key of previous page
+func (n *Node) forEachRowChecksum(table string, exclude []string, callback func(key string, checksum []byte)) error {
+	qm := n.DBConn.DB().QM()
+	quoter := qm.GetQuoter()
+
+	keyCol, err := qm.ExecuteSQLPrimaryKey(table)
+
+	if err != nil {
+		return err
+	}
+
+	excluded := map[string]bool{}
+
+	for _, key := range exclude {
+		excluded[key] = true
+	}
+
+	condition := ""
+
+	for {
+		result, err := qm.ExecuteSQLSelectResult("SELECT * FROM " + quoter.Identifier(table) + condition +
+			" ORDER BY " + quoter.Identifier(keyCol) + " LIMIT " + strconv.Itoa(rowsChecksumsPageSize))
+
+		if err != nil {
+			return err
+		}
+
+		keyIndex := -1
+
+		// index of each column in sorted order
+		columns := make([]int, len(result.Columns))
+
+		for i, col := range result.Columns {
+			columns[i] = i
+
+			if col == keyCol {
+				keyIndex = i
+			}
+		}
+
+		if keyIndex < 0 {
+			return errors.New(fmt.Sprintf("Primary key %s is not found in rows of %s", keyCol, table))
+		}
+		sort.Slice(columns, func(i, j int) bool { return result.Columns[columns[i]] < result.Columns[columns[j]] })
+
+		for _, row := range result.Rows {
+			key := row[keyIndex].String
+
+			if excluded[key] {
+				continue
+			}
+
+			data := ""
+
+			for _, i := range columns {
+				// length of a value is in data, so NULL is different from any string
+				if row[i].Valid {
+					data = data + fmt.Sprintf("%s=%d:%s\x00", result.Columns[i], len(row[i].String), row[i].String)
+				} else {
+					data = data + result.Columns[i] + "=NULL\x00"
+				}
+			}
+
+			sum := md5.Sum([]byte(data))
+			callback(key, sum[:])
+		}
+
+		if len(result.Rows) < rowsChecksumsPageSize {
+			return nil
+		}
+		condition = " WHERE " + quoter.Identifier(keyCol) + " > " + quoter.Literal(result.Rows[len(result.Rows)-1][keyIndex].String)
+	}
+}
@@ -0,0 +1,50 @@
+package nodemanager
+
+import (
+	"github.com/gelembjuk/oursql/node/dbquery"
+	"github.com/gelembjuk/oursql/node/structures"
+)
+
+// Restores a row to the state made by transactions. The row is deleted and all updates of it
+// from the blockchain and the pool are executed again. Returns number of executed transactions
+func (n *Node) RepairRow(table, key string) (int, error) {
+	// lock this process to prevent conflicts with new blocks and transactions
+	n.locks.transactionsExecute.Lock()
+	defer n.locks.transactionsExecute.Unlock()
+
+	history, err := n.GetTransactionsManager().GetRowHistory([]byte(table + ":" + key))
+
+	if err != nil {
+		return 0, err
+	}
+
+	keyCol, err := n.DBConn.DB().QM().ExecuteSQLPrimaryKey(table)
+
+	if err != nil {
+		return 0, err
+	}
+
+	n.Logger.Trace.Printf("Repair row %s of %s, %d transactions", key, table, len(history))
+
+	qp := dbquery.NewQueryProcessor(n.DBConn.DB(), n.Logger)
+
+	quoter := n.DBConn.DB().QM().GetQuoter()
+
+	deleteSQL := "DELETE FROM " + table + " WHERE " + quoter.Identifier(keyCol) + "=" + quoter.Literal(key)
+
+	err = qp.ExecuteQueryFromTX(structures.NewSQLUpdate(deleteSQL, "", ""))
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, tx := range history {
+		err = qp.ExecuteQueryFromTX(tx.SQLCommand)
+
+		if err != nil {
+			n.Logger.Error.Printf("Repair of row %s of %s failed on TX %x: %s", key, table, tx.GetID(), err.Error())
+			return 0, err
+		}
+	}
+	return len(history), nil
+}
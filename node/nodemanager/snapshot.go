@@ -0,0 +1,324 @@
+package nodemanager
+
+/*
+* Snapshots of the DB for fast sync of new nodes. A node makes a dump of the DB on its top block and signs it with
+* its identity. A new node loads it from a trusted node instead of executing SQL of all blocks. The snapshot is checked
+* against the chain: headers from its top block to the first block must be linked and have correct hashes, and other
+* nodes must have the top block too. After restore the top block and unspent outputs must be same as in the snapshot.
+* A snapshot has tables of the blockchain and tables managed by transactions, local tables of the node are not in it.
+* Rows of managed tables are not checked against the chain, there is no commitment to them in blocks.
+* A new node trusts them because of the signature, so only snapshots of trusted identities are loaded
+ */
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/nodeclient"
+)
+
+// Bytes of the dump in one chunk of a streamed snapshot
+const SnapshotChunkSize = 1 << 20
+
+// Dumps the DB to a file. Blocks are not added while it works, so the dump is on the returned block
+func (n *Node) MakeSnapshot(file string) (*nodeclient.SnapshotInfo, error) {
+	n.locks.transactionsExecute.Lock()
+	defer n.locks.transactionsExecute.Unlock()
+
+	n.locks.blockAddLock.Lock()
+	defer n.locks.blockAddLock.Unlock()
+
+	bcm, err := n.GetBCManager()
+
+	if err != nil {
+		return nil, err
+	}
+
+	topHash, height, err := bcm.GetState()
+
+	if err != nil {
+		return nil, err
+	}
+
+	unspentHash, err := n.getUnspentOutputsHash()
+
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := n.GetManagedTables()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = n.DBConn.DumpTables(file, append(n.DBConn.Config.ChainTables(), tables...))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &nodeclient.SnapshotInfo{Height: height, TopHash: topHash, UnspentHash: unspentHash}, nil
+}
+
+// Hash of all unspent outputs. It doesn't depend on order of records in the DB
+func (n *Node) getUnspentOutputsHash() ([]byte, error) {
+	uodb, err := n.DBConn.DB().GetUnspentOutputsObject()
+
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := [][]byte{}
+
+	err = uodb.ForEach(func(key, value []byte) error {
+		var buff bytes.Buffer
+
+		binary.Write(&buff, binary.BigEndian, uint32(len(key)))
+		buff.Write(key)
+		buff.Write(value)
+
+		hash := sha256.Sum256(buff.Bytes())
+		hashes = append(hashes, hash[:])
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(hashes, func(i, j int) bool { return bytes.Compare(hashes[i], hashes[j]) < 0 })
+
+	hash := sha256.Sum256(bytes.Join(hashes, []byte{}))
+
+	return hash[:], nil
+}
+
+// Creates the DB from a snapshot of a node. The snapshot must be signed by one of trusted identities.
+// Returns height of the top block
+func (n *Node) InitBlockchainFromSnapshot(addr net.NodeAddr, trusted []string) (int, error) {
+	if len(trusted) == 0 {
+		return 0, errors.New("No trusted identities to check a snapshot")
+	}
+
+	err := n.DBConn.CheckConnection()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if n.BlockchainExist() {
+		return 0, errors.New("Blockchain already exists. Snapshot can be restored only to empty DB")
+	}
+
+	err = n.getCreateManager().importBlockchainConsensusInfo(addr, n.NodeClient)
+
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := ioutil.TempFile(n.ConfigDir, "snapshot")
+
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	var info *nodeclient.SnapshotInfo
+	var size int64
+
+	hash := sha256.New()
+
+	err = n.NodeClient.SendGetSnapshot(addr, func(chunk *nodeclient.ResponseGetSnapshot) error {
+		if info == nil {
+			if chunk.Info == nil {
+				return errors.New("Snapshot has no info")
+			}
+			info = chunk.Info
+
+			return n.checkSnapshotInfo(info, trusted)
+		}
+
+		size += int64(len(chunk.Data))
+
+		if size > info.DumpSize {
+			return errors.New("Snapshot is longer than expected")
+		}
+		hash.Write(chunk.Data)
+
+		_, err := file.Write(chunk.Data)
+
+		return err
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	if info == nil || size != info.DumpSize || bytes.Compare(hash.Sum(nil), info.DumpHash) != 0 {
+		return 0, errors.New("Snapshot is not complete or damaged")
+	}
+
+	n.Logger.Trace.Printf("Loaded snapshot of %d bytes on block %x, height %d", size, info.TopHash, info.Height)
+
+	err = n.GetCommunicationManager().checkSnapshotChain(addr, info)
+
+	if err != nil {
+		return 0, err
+	}
+
+	file.Close()
+
+	// tables of the node are created empty, the snapshot has rows of them
+	err = n.DBConn.InitDatabase()
+
+	if err != nil {
+		return 0, err
+	}
+
+	err = n.DBConn.Restore(file.Name())
+
+	if err != nil {
+		return 0, err
+	}
+	defer n.DBConn.CloseConnection()
+
+	err = n.checkRestoredSnapshot(info)
+
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("Restored DB is not same as the snapshot, the DB must be cleaned: %s", err.Error()))
+	}
+
+	n.NodeNet.AddNodeToKnown(addr)
+
+	return info.Height, nil
+}
+
+// Checks the snapshot is signed by a trusted identity
+func (n *Node) checkSnapshotInfo(info *nodeclient.SnapshotInfo, trusted []string) error {
+	id := net.IdentityID(info.Identity)
+
+	found := false
+
+	for _, t := range trusted {
+		if t == id {
+			found = true
+		}
+	}
+
+	if !found {
+		return errors.New(fmt.Sprintf("Snapshot is made by not trusted node %s", id))
+	}
+
+	return net.VerifyIdentityMessage(info.Identity, info.Signature, info.SignedParts()...)
+}
+
+// Compares the DB with the snapshot after restore
+func (n *Node) checkRestoredSnapshot(info *nodeclient.SnapshotInfo) error {
+	bcm, err := n.GetBCManager()
+
+	if err != nil {
+		return err
+	}
+
+	topHash, height, err := bcm.GetState()
+
+	if err != nil {
+		return err
+	}
+
+	if bytes.Compare(topHash, info.TopHash) != 0 || height != info.Height {
+		return errors.New("Top block is different")
+	}
+
+	unspentHash, err := n.getUnspentOutputsHash()
+
+	if err != nil {
+		return err
+	}
+
+	if bytes.Compare(unspentHash, info.UnspentHash) != 0 {
+		return errors.New("Unspent outputs are different")
+	}
+	return nil
+}
+
+// Checks the top block of a snapshot is in the chain. Headers are loaded from the node of the snapshot to the first
+// block, then other nodes are asked for the top block
+func (n *communicationManager) checkSnapshotChain(addr net.NodeAddr, info *nodeclient.SnapshotInfo) error {
+	headers := []nodeclient.ComBlockHeader{}
+	startFrom := info.TopHash
+
+	for {
+		page, err := n.node.NodeClient.SendGetBlockHeaders(addr, startFrom, headersSyncPageSize)
+
+		if err != nil {
+			return err
+		}
+
+		err = n.checkHeadersPage(startFrom, headers, page)
+
+		if err != nil {
+			return err
+		}
+
+		headers = append(headers, page...)
+
+		lowest := headers[len(headers)-1]
+
+		if len(lowest.PrevBlockHash) == 0 {
+			break
+		}
+		startFrom = lowest.PrevBlockHash
+	}
+
+	if headers[0].Height != info.Height || headers[len(headers)-1].Height != 0 {
+		return errors.New("Height of snapshot is wrong")
+	}
+
+	n.logger.Trace.Printf("Snapshot chain of %d blocks is verified", len(headers))
+
+	// other nodes must know the top block, it must not be made only for this snapshot
+	others := []net.NodeAddr{}
+
+	for _, a := range n.node.ConsensusConfig.InitNodesAddreses {
+		na := net.NodeAddr{}
+		na.LoadFromString(a)
+
+		others = append(others, na)
+	}
+	others = append(others, n.node.NodeNet.GetNodes()...)
+
+	asked := 0
+
+	for _, other := range others {
+		if other.CompareToAddress(addr) || other.CompareToAddress(n.node.NodeClient.NodeAddress) {
+			continue
+		}
+		asked++
+
+		confirm, err := n.node.NodeClient.SendGetBlockHeaders(other, info.TopHash, 1)
+
+		if err == nil && len(confirm) == 1 && bytes.Compare(confirm[0].Hash, info.TopHash) == 0 {
+			n.logger.Trace.Printf("Snapshot top block is confirmed by %s", other.NodeAddrToString())
+			return nil
+		}
+	}
+
+	if asked > 0 {
+		return errors.New(fmt.Sprintf("Top block of snapshot is not found on %d other nodes", asked))
+	}
+
+	n.logger.Trace.Printf("No other nodes to confirm snapshot top block")
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package nodemanager
+
+/*
+* Verification of many transactions received from other node. Checks which don't need a DB (signature, SQL syntax)
+* are done by a pool of workers. Adding to the pool is done one by one in original order, because a transaction
+* can use outputs or rows of a previous transaction from the list
+ */
+
+import (
+	"runtime"
+
+	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/dbquery/sqlparser"
+	"github.com/gelembjuk/oursql/node/structures"
+)
+
+type txPipelineItem struct {
+	tx   *structures.Transaction
+	err  error
+	done chan bool
+}
+
+type txPipeline struct {
+	workers int
+	logger  *utils.LoggerMan
+	// final check and adding to the pool
+	admit func(tx *structures.Transaction) error
+}
+
+func newTXPipeline(workers int, logger *utils.LoggerMan, admit func(tx *structures.Transaction) error) *txPipeline {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return &txPipeline{workers, logger, admit}
+}
+
+// Checks which can be done in parallel with other transactions
+func preverifyTransaction(tx *structures.Transaction) error {
+	if tx.IsCoinbaseTransfer() {
+		return nil
+	}
+
+	err := tx.VerifySignature()
+
+	if err != nil {
+		return err
+	}
+
+	if tx.IsSQLCommand() {
+		return sqlparser.NewSqlParser().Parse(tx.GetSQLQuery())
+	}
+	return nil
+}
+
+// Loads count transactions with the load function and processes them. Load is called sequentially,
+// it can read a transaction from network while previous are verified. Returns IDs of added transactions
+func (p *txPipeline) Process(count int, load func(i int) (*structures.Transaction, error)) [][]byte {
+	jobs := make(chan *txPipelineItem, p.workers)
+	// bufer limits how many transactions are loaded in advance
+	queue := make(chan *txPipelineItem, p.workers*2)
+
+	for w := 0; w < p.workers; w++ {
+		go func() {
+			for item := range jobs {
+				item.err = preverifyTransaction(item.tx)
+				close(item.done)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(queue)
+		defer close(jobs)
+
+		for i := 0; i < count; i++ {
+			item := &txPipelineItem{done: make(chan bool)}
+
+			item.tx, item.err = load(i)
+
+			if item.err != nil {
+				close(item.done)
+			} else {
+				jobs <- item
+			}
+			queue <- item
+		}
+	}()
+
+	added := [][]byte{}
+
+	for item := range queue {
+		<-item.done
+
+		if item.err != nil {
+			p.logger.Trace.Printf("Transaction is not accepted: %s", item.err.Error())
+			continue
+		}
+
+		err := p.admit(item.tx)
+
+		if err != nil {
+			p.logger.Trace.Printf("Transaction %x is not added to the pool: %s", item.tx.GetID(), err.Error())
+			continue
+		}
+		added = append(added, item.tx.GetID())
+	}
+	return added
+}
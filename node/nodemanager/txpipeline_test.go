@@ -0,0 +1,121 @@
+package nodemanager
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+
+	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/structures"
+)
+
+func makeTestPipelineTX(t *testing.T, signer utils.Signer, value float64) *structures.Transaction {
+	inputs := []structures.TXCurrencyInput{structures.TXCurrencyInput{Txid: []byte{1, 2, 3}, Vout: 0}}
+	outputs := []structures.TXCurrrencyOutput{structures.TXCurrrencyOutput{Value: value, PubKeyHash: []byte{4, 3, 2, 1}}}
+
+	tx, _ := structures.NewTransaction(inputs, outputs)
+	tx.ByPubKey = signer.GetPublicKey()
+
+	data, err := tx.GetSignData()
+
+	if err != nil {
+		t.Fatalf("Can not get sign data: %s", err.Error())
+	}
+
+	signature, err := utils.SignDataBySigner(signer, data)
+
+	if err != nil {
+		t.Fatalf("Can not sign: %s", err.Error())
+	}
+	tx.CompleteTransaction(signature)
+
+	return tx
+}
+
+func TestTXPipelineOrder(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(nil)
+	signer := utils.NewEd25519Signer(key)
+
+	list := []*structures.Transaction{}
+
+	for i := 0; i < 50; i++ {
+		list = append(list, makeTestPipelineTX(t, signer, float64(i+1)))
+	}
+
+	for _, workers := range []int{1, 4, 16} {
+		admitted := [][]byte{}
+
+		pipeline := newTXPipeline(workers, utils.CreateLoggerStdout(), func(tx *structures.Transaction) error {
+			admitted = append(admitted, tx.GetID())
+			return nil
+		})
+
+		added := pipeline.Process(len(list), func(i int) (*structures.Transaction, error) {
+			return list[i], nil
+		})
+
+		if len(added) != len(list) || len(admitted) != len(list) {
+			t.Fatalf("%d workers added %d of %d transactions", workers, len(added), len(list))
+		}
+
+		for i, tx := range list {
+			if !bytes.Equal(admitted[i], tx.GetID()) || !bytes.Equal(added[i], tx.GetID()) {
+				t.Fatalf("%d workers admitted transaction %d out of order", workers, i)
+			}
+		}
+	}
+}
+
+func TestTXPipelineErrors(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(nil)
+	signer := utils.NewEd25519Signer(key)
+
+	list := []*structures.Transaction{}
+
+	for i := 0; i < 6; i++ {
+		list = append(list, makeTestPipelineTX(t, signer, float64(i+1)))
+	}
+	// wrong signature
+	list[1].Vout[0].Value = 100
+
+	// admission is called from one goroutine
+	admitted := map[int]bool{}
+
+	pipeline := newTXPipeline(3, utils.CreateLoggerStdout(), func(tx *structures.Transaction) error {
+		for i, item := range list {
+			if item == tx {
+				admitted[i] = true
+			}
+		}
+
+		if tx == list[4] {
+			return errors.New("Pool is full")
+		}
+		return nil
+	})
+
+	added := pipeline.Process(len(list), func(i int) (*structures.Transaction, error) {
+		if i == 2 {
+			return nil, errors.New("No response")
+		}
+		return list[i], nil
+	})
+
+	// not loaded and not verified transactions don't reach admission, failed admission is not added
+	if admitted[1] || admitted[2] || !admitted[4] {
+		t.Fatalf("Wrong transactions are admitted: %v", admitted)
+	}
+
+	expected := [][]byte{list[0].GetID(), list[3].GetID(), list[5].GetID()}
+
+	if len(added) != len(expected) {
+		t.Fatalf("Added %d transactions, expected %d", len(added), len(expected))
+	}
+
+	for i := range expected {
+		if !bytes.Equal(added[i], expected[i]) {
+			t.Fatalf("Added transaction %d is wrong", i)
+		}
+	}
+}
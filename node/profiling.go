@@ -0,0 +1,130 @@
+package main
+
+/*
+* Commands to debug a running node. Logs and other settings can be changed without restart and a profile can be collected
+ */
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/gelembjuk/oursql/lib/nodeclient"
+)
+
+func (c *NodeCLI) commandSetLogs() error {
+	if c.AlreadyRunningPort == 0 {
+		return errors.New("The node server is not running")
+	}
+
+	nc := c.getLocalNetworkClient()
+
+	state, err := nc.SendSetLogs(c.Input.Logs)
+
+	if err != nil {
+		return err
+	}
+
+	if state == "" {
+		state = "none"
+	}
+	fmt.Printf("Enabled logs: %s\n", state)
+
+	return nil
+}
+
+func (c *NodeCLI) commandProfile() error {
+	if c.AlreadyRunningPort == 0 {
+		return errors.New("The node server is not running")
+	}
+
+	if c.Input.Args.FilePath == "" {
+		return errors.New("File to save a profile is not provided")
+	}
+
+	nc := c.getLocalNetworkClient()
+
+	if c.Input.Args.Profile == "cpu" || c.Input.Args.Profile == "trace" {
+		fmt.Printf("Collecting %s for %d seconds\n", c.Input.Args.Profile, c.Input.Args.Seconds)
+	}
+
+	data, err := nc.SendProfile(c.Input.Args.Profile, c.Input.Args.Seconds)
+
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(c.Input.Args.FilePath, data, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Profile is saved to %s, %d bytes\n", c.Input.Args.FilePath, len(data))
+
+	return nil
+}
+
+func (c *NodeCLI) commandShowSettings() error {
+	if c.AlreadyRunningPort == 0 {
+		return errors.New("The node server is not running")
+	}
+
+	nc := c.getLocalNetworkClient()
+
+	settings, err := nc.SendGetSettings()
+
+	if err != nil {
+		return err
+	}
+
+	printSettings(settings)
+
+	return nil
+}
+
+func (c *NodeCLI) commandSetSettings() error {
+	if c.AlreadyRunningPort == 0 {
+		return errors.New("The node server is not running")
+	}
+
+	nc := c.getLocalNetworkClient()
+
+	settings := nodeclient.NodeSettings{
+		MaxInbound:           c.Input.Args.MaxInbound,
+		MaxOutbound:          c.Input.Args.MaxOutbound,
+		Eviction:             c.Input.Args.Eviction,
+		MaxPoolSize:          c.Input.Args.MaxPool,
+		SyncInterval:         c.Input.Args.SyncInterval,
+		SyncIntervalNoIncome: c.Input.Args.SyncIntervalNoIncome}
+
+	// logs from the config are not a change
+	if c.Input.Args.LogsSet {
+		settings.Logs = c.Input.Logs
+	}
+
+	settings, err := nc.SendSetSettings(settings, c.Input.Args.Save)
+
+	if err != nil {
+		return err
+	}
+
+	printSettings(settings)
+
+	if c.Input.Args.Save {
+		fmt.Println("Settings are saved to the config file")
+	}
+	return nil
+}
+
+func printSettings(settings nodeclient.NodeSettings) {
+	if settings.Logs == "" {
+		settings.Logs = "none"
+	}
+	fmt.Printf("Logs: %s\n", settings.Logs)
+	fmt.Printf("Max inbound connections: %d\n", settings.MaxInbound)
+	fmt.Printf("Max outbound connections: %d\n", settings.MaxOutbound)
+	fmt.Printf("Eviction: %s\n", settings.Eviction)
+	fmt.Printf("Max pool size: %d\n", settings.MaxPoolSize)
+	fmt.Printf("Sync interval: %d seconds, %d seconds without income connections\n", settings.SyncInterval, settings.SyncIntervalNoIncome)
+}
@@ -0,0 +1,156 @@
+package main
+
+/*
+* Other DB schemas managed by this node. Each schema has own blockchain, consensus config and a node process.
+* A process of a schema is started and stopped together with the main node
+ */
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/gelembjuk/oursql/node/config"
+	"github.com/gelembjuk/oursql/node/server"
+)
+
+// Loads configs of schemas and checks they don't share a database or ports with other schemas or the main node
+func (c NodeCLI) getSchemasInputs() ([]config.AppInput, error) {
+	inputs := []config.AppInput{}
+
+	used := map[string]string{}
+
+	use := func(name, kind, value string) error {
+		if value == "" {
+			return nil
+		}
+		key := kind + " " + value
+
+		if other, ok := used[key]; ok {
+			return errors.New(fmt.Sprintf("Schema %s uses same %s %s as %s", name, kind, value, other))
+		}
+		used[key] = name
+		return nil
+	}
+
+	check := func(name string, input config.AppInput) error {
+		err := use(name, "database", input.Database.GetDatabaseID())
+
+		if err != nil {
+			return err
+		}
+
+		err = use(name, "port", strconv.Itoa(input.Port))
+
+		if err != nil {
+			return err
+		}
+
+		if input.LocalPort != input.Port {
+			err = use(name, "port", strconv.Itoa(input.LocalPort))
+
+			if err != nil {
+				return err
+			}
+		}
+		return use(name, "DB proxy address", input.DBProxyAddress)
+	}
+
+	err := check("main node", c.Input)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, schema := range c.Input.Schemas {
+		if schema.Name == "" {
+			return nil, errors.New("Schema name is not set")
+		}
+
+		input, err := config.GetSchemaAppInput(c.Command, schema)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.TrimRight(input.ConfigDir, "/") == strings.TrimRight(c.ConfigDir, "/") {
+			return nil, errors.New(fmt.Sprintf("Schema %s must have own config directory", schema.Name))
+		}
+
+		if !input.Database.HasMinimum() {
+			return nil, errors.New(fmt.Sprintf("Schema %s has no database config", schema.Name))
+		}
+
+		if input.Port < 1 {
+			return nil, errors.New(fmt.Sprintf("Schema %s has no node port", schema.Name))
+		}
+
+		err = check(schema.Name, input)
+
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs, nil
+}
+
+// Executes a node manage command for every schema. A command runs in separate process with config directory of a schema
+func (c NodeCLI) commandSchemas(inputs []config.AppInput) {
+	for i, input := range inputs {
+		name := c.Input.Schemas[i].Name
+
+		c.Logger.Trace.Printf("Execute %s for schema %s", c.Command, name)
+
+		cmd := exec.Command(os.Args[0], c.Command, "-configdir="+input.ConfigDir)
+
+		output, err := cmd.CombinedOutput()
+
+		if err != nil {
+			fmt.Printf("Schema %s: %s. %s\n", name, err.Error(), strings.TrimSpace(string(output)))
+			continue
+		}
+		// a node doesn't print anything on success, only errors
+		if strings.Contains(string(output), "Error") {
+			fmt.Printf("Schema %s: %s\n", name, strings.TrimSpace(string(output)))
+		}
+	}
+}
+
+// Prints if nodes of schemas are running
+func (c NodeCLI) showSchemasState() error {
+	if len(c.Input.Schemas) == 0 {
+		return nil
+	}
+
+	fmt.Println("Schemas:")
+
+	for _, schema := range c.Input.Schemas {
+		input, err := config.GetSchemaAppInput(c.Command, schema)
+
+		if err != nil {
+			fmt.Printf("  %s - %s\n", schema.Name, err.Error())
+			continue
+		}
+
+		nd := server.NodeDaemon{}
+		nd.ConfigDir = input.ConfigDir
+		nd.Logger = c.Logger
+
+		running, processID, port, err := nd.GetServerState()
+
+		if err != nil {
+			return err
+		}
+
+		if running {
+			fmt.Printf("  %s - running. Process: %d, port %d, database %s\n", schema.Name, processID, port, input.Database.GetDatabaseID())
+		} else {
+			fmt.Printf("  %s - not running, database %s\n", schema.Name, input.Database.GetDatabaseID())
+		}
+	}
+	return nil
+}
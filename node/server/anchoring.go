@@ -0,0 +1,129 @@
+package server
+
+/*
+* Periodic anchoring of the top block hash to an external public blockchain.
+* It gives externally provable time of blocks for private networks
+ */
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gelembjuk/oursql/lib/anchoring"
+	"github.com/gelembjuk/oursql/lib/utils"
+)
+
+type anchoringRunner struct {
+	S            *NodeServer
+	logger       *utils.LoggerMan
+	options      anchoring.Config
+	adapter      anchoring.Adapter
+	stopChan     chan bool
+	completeChan chan bool
+	ticker       int
+	lock         sync.Mutex
+	anchors      int64
+	last         string
+}
+
+func StartAnchoring(s *NodeServer, options anchoring.Config) (*anchoringRunner, error) {
+	c := &anchoringRunner{}
+
+	var err error
+
+	c.adapter, err = anchoring.NewAdapter(options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Interval < 1 {
+		options.Interval = anchoring.DefaultInterval
+	}
+
+	c.logger = s.Logger
+	c.S = s
+	c.options = options
+
+	c.stopChan = make(chan bool)     // to notify routine to stop
+	c.completeChan = make(chan bool) // routine to notify it stopped
+
+	c.ticker = c.options.Interval
+
+	go c.Run()
+
+	return c, nil
+}
+
+// Run function to publish anchors regularly
+func (c *anchoringRunner) Run() {
+	for {
+		exit := false
+
+		select {
+		case <-c.stopChan:
+			exit = true
+		default:
+		}
+
+		if exit {
+			break
+		}
+
+		if c.ticker > 0 {
+			time.Sleep(1 * time.Second)
+			c.ticker = c.ticker - 1
+			continue
+		}
+
+		err := c.anchor()
+
+		if err != nil {
+			c.logger.Error.Printf("Anchoring error: %s", err.Error())
+		}
+
+		c.ticker = c.options.Interval
+	}
+	c.logger.Trace.Printf("Anchoring Return routine")
+	c.completeChan <- true
+}
+
+func (c *anchoringRunner) Stop() error {
+	c.logger.Trace.Println("Stop anchoring")
+
+	close(c.stopChan) // notify routine to stop
+
+	// wait when it is stopped
+	<-c.completeChan
+
+	close(c.completeChan)
+
+	c.logger.TraceExt.Println("Anchoring Stopped")
+
+	return nil
+}
+
+// Number of made anchors and description of the last one
+func (c *anchoringRunner) GetState() (int64, string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.anchors, c.last
+}
+
+func (c *anchoringRunner) anchor() error {
+	anchor, err := c.S.Node.MakeAnchor(c.adapter, c.options.Adapter)
+
+	if err != nil || anchor == nil {
+		return err
+	}
+
+	c.lock.Lock()
+	c.anchors++
+	c.last = fmt.Sprintf("block %d as %s at %s", anchor.BlockHeight, anchor.Reference,
+		time.Unix(anchor.Time, 0).Format("2006-01-02 15:04"))
+	c.lock.Unlock()
+
+	return nil
+}
@@ -0,0 +1,370 @@
+package server
+
+/*
+* Monitor of MySQL binary log. Finds updates of tables done directly in the DB, not by the node.
+* Every update executed by the node is remembered in the dbquery writes log, any other update
+* found in the binary log is out-of-band. Depending on a policy the monitor only reports it, reverts it
+* or reverts and executes it again as a transaction of the node, signed with a configured key
+ */
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gelembjuk/oursql/lib"
+	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/database"
+	"github.com/gelembjuk/oursql/node/dbquery"
+	"github.com/gelembjuk/oursql/node/dbquery/sqlparser"
+)
+
+const (
+	BinlogPolicyAlert   = "alert"
+	BinlogPolicyRevert  = "revert"
+	BinlogPolicyConvert = "convert"
+)
+
+// max number of events read in one request
+const binlogEventsLimit = 1000
+
+// prefix of a statement in Query events
+var binlogUseDBRegexp = regexp.MustCompile("(?is)^use\\s+`[^`]*`\\s*;\\s*")
+
+// Options of the binary log monitor. Empty policy means the monitor is off
+type BinlogMonitorOptions struct {
+	Policy   string
+	Interval int          // seconds between checks
+	Signer   utils.Signer // signs transactions for the convert policy
+}
+
+type binlogMonitor struct {
+	S            *NodeServer
+	logger       *utils.LoggerMan
+	options      BinlogMonitorOptions
+	stopChan     chan bool
+	completeChan chan bool
+	ticker       int
+	file         string
+	pos          uint64
+	// auto_increment value of the next insert. Intvar event goes before a statement
+	insertID string
+	// statements not found in the writes log on the last check
+	unknown []binlogStatement
+	lock    sync.Mutex
+	changes int64
+}
+
+// Statement of the binary log. The node remembers an update after the server executed it, so a statement
+// which is not in the writes log is checked again on next check before it is counted as out-of-band
+type binlogStatement struct {
+	sql      string
+	table    string
+	insertID string
+}
+
+func StartBinlogMonitor(s *NodeServer, options BinlogMonitorOptions) (m *binlogMonitor, err error) {
+	if options.Policy != BinlogPolicyAlert &&
+		options.Policy != BinlogPolicyRevert &&
+		options.Policy != BinlogPolicyConvert {
+		return nil, errors.New(fmt.Sprintf("Unknown binary log monitor policy %s", options.Policy))
+	}
+
+	if options.Policy == BinlogPolicyConvert && options.Signer == nil {
+		return nil, errors.New("Binary log monitor needs a signer to convert updates to transactions")
+	}
+
+	m = &binlogMonitor{}
+
+	m.logger = s.Logger
+	m.S = s
+	m.options = options
+
+	if m.options.Interval <= 0 {
+		m.options.Interval = 10
+	}
+
+	err = m.checkFormat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// updates done before the start are not checked. Changes of the node were not logged
+	m.file, m.pos, err = s.Node.DBConn.DB().QM().ExecuteSQLBinlogPosition()
+
+	if err != nil {
+		return nil, err
+	}
+
+	dbquery.SetWritesLog(true)
+
+	m.stopChan = make(chan bool)     // to notify routine to stop
+	m.completeChan = make(chan bool) // routine to notify it stopped
+
+	m.ticker = m.options.Interval
+
+	m.logger.Trace.Printf("Binary log monitor started from %s:%d, policy %s", m.file, m.pos, m.options.Policy)
+
+	go m.Run()
+
+	return m, nil
+}
+
+// Run function to read new events of the binary log regularly
+func (m *binlogMonitor) Run() {
+	for {
+		exit := false
+
+		select {
+		case <-m.stopChan:
+			exit = true
+		default:
+		}
+
+		if exit {
+			break
+		}
+
+		if m.ticker > 0 {
+			time.Sleep(1 * time.Second)
+			m.ticker = m.ticker - 1
+			continue
+		}
+
+		err := m.check()
+
+		if err != nil {
+			m.logger.Error.Printf("Binary log check error: %s", err.Error())
+		}
+
+		m.ticker = m.options.Interval
+	}
+	m.logger.Trace.Printf("Binary log monitor Return routine")
+	m.completeChan <- true
+}
+
+func (m *binlogMonitor) Stop() error {
+	m.logger.Trace.Println("Stop binary log monitor")
+
+	close(m.stopChan) // notify routine to stop
+
+	// wait when it is stopped
+	<-m.completeChan
+
+	close(m.completeChan)
+
+	dbquery.SetWritesLog(false)
+
+	m.logger.TraceExt.Println("Binary log monitor Stopped")
+
+	return nil
+}
+
+// Number of found updates done not by the node
+func (m *binlogMonitor) GetChangesCount() int64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.changes
+}
+
+// With ROW format statements are in the log only if rows query events are enabled
+func (m *binlogMonitor) checkFormat() error {
+	row, err := m.S.Node.DBConn.DB().QM().ExecuteSQLSelectRow("SELECT @@binlog_format AS f, @@binlog_rows_query_log_events AS q")
+
+	if err != nil {
+		// MariaDB has no rows query events option. Check only the format
+		row, err = m.S.Node.DBConn.DB().QM().ExecuteSQLSelectRow("SELECT @@binlog_format AS f, @@binlog_annotate_row_events AS q")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if strings.ToUpper(row["f"]) == "ROW" && row["q"] != "1" && strings.ToUpper(row["q"]) != "ON" {
+		return errors.New("Binary log has ROW format without SQL of statements. Enable binlog_rows_query_log_events or use MIXED format")
+	}
+	return nil
+}
+
+// Reads all new events
+func (m *binlogMonitor) check() error {
+	qm := m.S.Node.DBConn.DB().QM()
+
+	unknown := m.unknown
+	m.unknown = nil
+
+	for _, statement := range unknown {
+		if !dbquery.IsKnownWrite(statement.sql) {
+			m.applyPolicy(statement)
+		}
+	}
+
+	for {
+		events, err := qm.ExecuteSQLBinlogEvents(m.file, m.pos, binlogEventsLimit)
+
+		if err != nil {
+			// the file could be removed. Continue from the current position, some updates can be missed
+			m.logger.Error.Printf("Can not read binary log %s from %d. Continue from current position", m.file, m.pos)
+
+			m.file, m.pos, err = qm.ExecuteSQLBinlogPosition()
+
+			return err
+		}
+
+		rotated := false
+
+		for _, e := range events {
+			m.pos = e.EndLogPos
+
+			if m.processEvent(e) {
+				rotated = true
+				break
+			}
+		}
+
+		if !rotated && len(events) < binlogEventsLimit {
+			return nil
+		}
+	}
+}
+
+// Checks statements of an event. Returns true if the log was moved to next file
+func (m *binlogMonitor) processEvent(e database.BinlogEvent) bool {
+	switch e.EventType {
+	case "Rotate":
+		// Info is "next_file;pos=4"
+		parts := strings.SplitN(e.Info, ";pos=", 2)
+
+		if len(parts) == 2 && parts[0] != m.file {
+			m.file = parts[0]
+			fmt.Sscanf(parts[1], "%d", &m.pos)
+
+			return true
+		}
+	case "Intvar":
+		if strings.HasPrefix(e.Info, "INSERT_ID=") {
+			m.insertID = strings.TrimPrefix(e.Info, "INSERT_ID=")
+		}
+	case "Query":
+		m.processStatement(binlogUseDBRegexp.ReplaceAllString(e.Info, ""))
+		m.insertID = ""
+	case "Rows_query", "Annotate_rows":
+		m.processStatement(strings.TrimPrefix(e.Info, "# "))
+		m.insertID = ""
+	case "Xid":
+		m.insertID = ""
+	}
+	return false
+}
+
+// Finds if a statement was done by the node. Not found statements are checked again on next check
+func (m *binlogMonitor) processStatement(sql string) {
+	parser := sqlparser.NewSqlParser()
+
+	if parser.Parse(sql) != nil || !(parser.IsTableDataUpdate() || parser.IsTableManage()) {
+		// BEGIN, COMMIT etc
+		return
+	}
+
+	table := strings.Replace(parser.GetTable(), "`", "", -1)
+
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		// DB name is not needed, the node works with one DB
+		table = table[i+1:]
+	}
+
+	// node tables and unmanaged tables of the consensus are updated without transactions
+	if m.S.Node.DBConn.Config.IsNodeTable(table) ||
+		utils.StringInSlice(table, m.S.Node.ConsensusConfig.UnmanagedTables) {
+		return
+	}
+
+	if dbquery.IsKnownWrite(sql) {
+		return
+	}
+	m.unknown = append(m.unknown, binlogStatement{sql, table, m.insertID})
+}
+
+// Statement is not done by the node. Applies a policy
+func (m *binlogMonitor) applyPolicy(statement binlogStatement) {
+	sql, table := statement.sql, statement.table
+
+	m.lock.Lock()
+	m.changes++
+	m.lock.Unlock()
+
+	m.logger.Error.Printf("Update of the DB not by the node: %s", sql)
+
+	if m.options.Policy == BinlogPolicyAlert {
+		return
+	}
+
+	parser := sqlparser.NewSqlParser()
+
+	if parser.Parse(sql) != nil || !parser.IsTableDataUpdate() {
+		m.logger.Error.Printf("Can not revert update of a table structure")
+		return
+	}
+
+	key, err := m.getRowKey(parser, table, statement.insertID)
+
+	if err != nil {
+		m.logger.Error.Printf("Can not revert the update: %s", err.Error())
+		return
+	}
+
+	_, err = m.S.Node.RepairRow(table, key)
+
+	if err != nil {
+		m.logger.Error.Printf("Revert of row %s of %s failed: %s", key, table, err.Error())
+		return
+	}
+	m.logger.Trace.Printf("Row %s of %s reverted", key, table)
+
+	if m.options.Policy != BinlogPolicyConvert {
+		return
+	}
+
+	txID, err := m.S.Node.SQLTransaction(m.options.Signer, sql)
+
+	if err != nil {
+		m.logger.Error.Printf("Can not convert the update to a transaction: %s", err.Error())
+		return
+	}
+
+	if txID != nil {
+		m.logger.Trace.Printf("The update converted to TX %x", txID)
+		m.S.blocksMakerObj.NewTransaction(txID)
+	}
+}
+
+// Primary key value of a row changed by a statement
+func (m *binlogMonitor) getRowKey(parser sqlparser.SQLQueryParserInterface, table string, insertID string) (string, error) {
+	keyCol, err := m.S.Node.DBConn.DB().QM().ExecuteSQLPrimaryKey(table)
+
+	if err != nil {
+		return "", err
+	}
+
+	if parser.GetKind() == lib.QueryKindInsert {
+		if val, ok := parser.GetUpdateColumns()[keyCol]; ok {
+			return val, nil
+		}
+		if insertID != "" {
+			return insertID, nil
+		}
+		return "", errors.New("Inserted key value is unknown")
+	}
+
+	cKey, cVal := parser.GetOneColumnCondition()
+
+	if cKey != keyCol {
+		return "", errors.New("Query condition has no a primary key")
+	}
+	return cVal, nil
+}
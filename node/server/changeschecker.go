@@ -1,12 +1,19 @@
 package server
 
 import (
+	"sync"
 	"time"
 
 	"github.com/gelembjuk/oursql/lib/utils"
 	"github.com/gelembjuk/oursql/node/nodemanager"
 )
 
+// Seconds between pulls of changes from other nodes
+type SyncOptions struct {
+	Interval         int // when other nodes connect to this node, 0 is 180
+	IntervalNoIncome int // when other nodes can not connect to this node and it can miss pushed blocks, 0 is 5
+}
+
 type changesChecker struct {
 	S             *NodeServer
 	logger        *utils.LoggerMan
@@ -14,6 +21,8 @@ type changesChecker struct {
 	completeChan  chan bool
 	ticker        int
 	lastCheckTime int64
+	options       SyncOptions
+	lock          sync.Mutex
 }
 
 func StartChangesChecker(s *NodeServer) (c *changesChecker) {
@@ -21,6 +30,7 @@ func StartChangesChecker(s *NodeServer) (c *changesChecker) {
 
 	c.logger = s.Logger
 	c.S = s
+	c.SetOptions(s.Sync)
 
 	c.stopChan = make(chan bool)     // to notify routine to stop
 	c.completeChan = make(chan bool) // routine to notify it stopped
@@ -50,10 +60,10 @@ func (c *changesChecker) Run() {
 			break
 		}
 
-		if c.ticker > 0 {
+		if c.getTicker() > 0 {
 			//c.logger.Trace.Printf("Changes Checker ticker value %d", c.ticker)
 			time.Sleep(1 * time.Second)
-			c.ticker = c.ticker - 1
+			c.setTicker(c.getTicker() - 1)
 			continue
 		}
 		c.logger.TraceExt.Printf("Changes Checker. Go to check state")
@@ -65,11 +75,14 @@ func (c *changesChecker) Run() {
 		}
 
 		// decide when to do next check
+		options := c.GetOptions()
+
 		if c.S.Node.NodeNet.CheckHadInputConnects() {
 			// other nodes can connect to this node. No need to do extra check often
-			c.ticker = 180 // try again in 3 minutes
+			c.setTicker(options.Interval)
 		} else {
-			c.ticker = 5 // 5 seconds as it looks like other nodes can not connect to this node
+			// it looks like other nodes can not connect to this node
+			c.setTicker(options.IntervalNoIncome)
 		}
 
 		//c.S.Node.NodeNet.StartNewSessionForInputConnects()
@@ -77,6 +90,53 @@ func (c *changesChecker) Run() {
 	c.logger.Trace.Printf("Changes Checker Return routine")
 	c.completeChan <- true
 }
+
+// Do the check on next tick, without waiting for the interval
+func (c *changesChecker) CheckNow() {
+	c.setTicker(0)
+}
+
+func (c *changesChecker) getTicker() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.ticker
+}
+
+func (c *changesChecker) setTicker(ticker int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.ticker = ticker
+}
+
+// Changes intervals. A next check is not later than a new interval
+func (c *changesChecker) SetOptions(options SyncOptions) {
+	if options.Interval <= 0 {
+		options.Interval = 180
+	}
+
+	if options.IntervalNoIncome <= 0 {
+		options.IntervalNoIncome = 5
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.options = options
+
+	if c.ticker > options.Interval {
+		c.ticker = options.Interval
+	}
+}
+
+func (c *changesChecker) GetOptions() SyncOptions {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.options
+}
+
 func (c *changesChecker) Stop() error {
 	c.logger.Trace.Println("Stop changes checker")
 
@@ -0,0 +1,112 @@
+package server
+
+/*
+* Checks the clock of this node against clocks of other nodes. Block times and updates checks expect clocks
+* are synced. It is warned when the median offset of peers is more than allowed, blocks are not made then
+* if it is configured
+ */
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/utils"
+)
+
+const (
+	defaultClockMaxOffset = 60 // seconds
+	defaultClockMinPeers  = 3
+)
+
+// Options of the clock check. MaxOffset -1 means the check is off
+type ClockCheckOptions struct {
+	MaxOffset    int  // seconds, 0 is default
+	MinPeers     int  // peers needed to decide the clock is off, 0 is default
+	RefuseMining bool // don't make blocks while the clock is off
+}
+
+type clockChecker struct {
+	logger  *utils.LoggerMan
+	options ClockCheckOptions
+	times   *net.NetworkTime
+	drifted bool
+	lock    *sync.Mutex
+}
+
+func newClockChecker(s *NodeServer, options ClockCheckOptions) *clockChecker {
+	if options.MaxOffset == 0 {
+		options.MaxOffset = defaultClockMaxOffset
+	}
+
+	if options.MinPeers < 1 {
+		options.MinPeers = defaultClockMinPeers
+	}
+
+	c := &clockChecker{}
+	c.logger = s.Logger
+	c.options = options
+	c.times = net.NewNetworkTime()
+	c.lock = &sync.Mutex{}
+
+	return c
+}
+
+// Time of other node from a version command. Node is identified by identity, so one node has one vote
+func (c *clockChecker) AddSample(addr net.NodeAddr, peerTime int64) {
+	if peerTime == 0 {
+		// older nodes don't send a time
+		return
+	}
+
+	peer := addr.String()
+
+	if addr.IsSigned() {
+		peer = net.IdentityID(addr.Identity)
+	}
+
+	c.times.AddSample(peer, peerTime)
+
+	offset, peers := c.times.GetOffset()
+
+	drifted := peers >= c.options.MinPeers && (offset > int64(c.options.MaxOffset) || offset < -int64(c.options.MaxOffset))
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if drifted && !c.drifted {
+		c.logger.Warning.Printf("Clock of this node differs from %d other nodes by %d seconds. Check time sync", peers, offset)
+
+		if c.options.RefuseMining {
+			c.logger.Warning.Printf("Blocks are not made until the clock is fixed")
+		}
+	} else if !drifted && c.drifted {
+		c.logger.Warning.Printf("Clock of this node is synced with the network again, offset %d seconds", offset)
+	}
+	c.drifted = drifted
+}
+
+// Returns median offset from other nodes, number of nodes and if it is more than allowed
+func (c *clockChecker) GetState() (int64, int, bool) {
+	offset, peers := c.times.GetOffset()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return offset, peers, c.drifted
+}
+
+// It is called before a block is made
+func (c *clockChecker) checkBlockMaking() error {
+	if !c.options.RefuseMining {
+		return nil
+	}
+
+	offset, peers, drifted := c.GetState()
+
+	if drifted {
+		return errors.New(fmt.Sprintf("Clock differs from %d other nodes by %d seconds", peers, offset))
+	}
+	return nil
+}
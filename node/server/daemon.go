@@ -12,6 +12,8 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/gelembjuk/oursql/lib/anchoring"
+	"github.com/gelembjuk/oursql/lib/jsonrpc"
 	"github.com/gelembjuk/oursql/lib/net"
 	"github.com/gelembjuk/oursql/lib/remoteclient"
 	"github.com/gelembjuk/oursql/lib/utils"
@@ -29,6 +31,55 @@ type NodeDaemon struct {
 	Node        *nodemanager.Node
 	DBProxyAddr string
 	DBAddr      string
+	// address of pprof HTTP endpoints. Empty means profiling is off
+	ProfilingAddr string
+	// address of GraphQL HTTP endpoint. Empty means it is off
+	GraphQLAddr string
+	// address of Prometheus metrics HTTP endpoint. Empty means it is off
+	MetricsAddr string
+	// address of REST API of wallet operations. Empty means it is off
+	RESTAddr string
+	// value of Access-Control-Allow-Origin of REST API. Empty means no CORS headers
+	RESTAllowOrigin string
+	// JSON-RPC server for node control. Empty address means it is off
+	JSONRPC jsonrpc.Config
+	// address of WebSocket notifications about new blocks and transactions. Empty means it is off
+	SubscriptionsAddr string
+	// path of unix socket for local clients and permissions of it, like 0660. Empty path means it is off
+	LocalSocket     string
+	LocalSocketMode string
+	// host:port of HTTP server for WebSocket connections of nodes and wallets. Empty means it is off
+	WebSocketAddr string
+	// options of the binary log monitor
+	BinlogMonitor BinlogMonitorOptions
+	// options of rows comparing with other nodes
+	RowsCheck RowsCheckOptions
+	// options of tables maintenance
+	Maintenance MaintenanceOptions
+	// options of anchoring to an external blockchain
+	Anchoring anchoring.Config
+	// options of the clock check against other nodes
+	ClockCheck ClockCheckOptions
+	// options of pings of known nodes
+	Keepalive KeepaliveOptions
+	// format of payloads of commands to other nodes. Empty is gob
+	WireFormat string
+	// longest pauses of reading requests and writing responses
+	ConnTimeouts net.ConnTimeouts
+	// longest request of a client in bytes
+	MaxRequestSize int64
+	// mapping of the port on a router
+	PortMap net.PortMapConfig
+	// banning of misbehaving peers
+	Banning net.BanConfig
+	// whitelisted and blacklisted peers
+	PeerLists net.PeerListsConfig
+	// finding of nodes in the local network
+	LANDiscovery net.LANDiscoveryConfig
+	// maximums of connections with other nodes
+	ConnLimits net.ConnLimits
+	// intervals of pulls of changes from other nodes
+	Sync SyncOptions
 }
 
 func (n *NodeDaemon) Init() error {
@@ -64,11 +115,37 @@ func (n *NodeDaemon) createServer() error {
 	server.Logger = n.Logger
 
 	server.Transit.Init(n.Logger)
+	server.Inventory.Init(inventoryCacheSize)
 
 	server.Node = n.Node
 
 	server.DBProxyAddr = n.DBProxyAddr
 	server.DBAddr = n.DBAddr
+	server.ProfilingAddr = n.ProfilingAddr
+	server.GraphQLAddr = n.GraphQLAddr
+	server.MetricsAddr = n.MetricsAddr
+	server.RESTAddr = n.RESTAddr
+	server.RESTAllowOrigin = n.RESTAllowOrigin
+	server.JSONRPC = n.JSONRPC
+	server.SubscriptionsAddr = n.SubscriptionsAddr
+	server.LocalSocket = n.LocalSocket
+	server.LocalSocketMode = n.LocalSocketMode
+	server.WebSocketAddr = n.WebSocketAddr
+	server.BinlogMonitor = n.BinlogMonitor
+	server.RowsCheck = n.RowsCheck
+	server.Maintenance = n.Maintenance
+	server.Anchoring = n.Anchoring
+	server.ClockCheck = n.ClockCheck
+	server.Keepalive = n.Keepalive
+	server.WireFormat = n.WireFormat
+	server.ConnTimeouts = n.ConnTimeouts
+	server.MaxRequestSize = n.MaxRequestSize
+	server.PortMap = n.PortMap
+	server.Banning = n.Banning
+	server.PeerLists = n.PeerLists
+	server.LANDiscovery = n.LANDiscovery
+	server.ConnLimits = n.ConnLimits
+	server.Sync = n.Sync
 
 	n.Server = &server
 
@@ -241,6 +318,39 @@ func (n *NodeDaemon) StartServerInteractive() error {
 	return nil
 }
 
+// Starts a node server in a goroutine of this process, without a PID file and signals handling.
+// Returns when the server is started. It is used to run many nodes in one process
+func (n *NodeDaemon) StartInProcess() error {
+	n.Server.NodeAuthStr = utils.RandString(net.CommandLength)
+
+	serverStartResult := make(chan string, 1)
+
+	go n.Server.StartServer(serverStartResult)
+
+	result := <-serverStartResult
+
+	if result != "" {
+		return errors.New(result)
+	}
+	return nil
+}
+
+// Stops a server started with StartInProcess. Waits till all routines of the server are stopped
+func (n *NodeDaemon) StopInProcess() error {
+	close(n.Server.StopMainChan)
+
+	// unblock accepting of connections. The server closes this connection without reading, so
+	// a write error is possible
+	err := n.Server.GetClient().SendVoid(net.NewNodeAddr("localhost", n.Server.NodePort))
+
+	if err != nil {
+		n.Logger.Trace.Println(err.Error())
+	}
+	<-n.Server.StopMainConfirmChan
+
+	return nil
+}
+
 // Stops a node daemon. Finds a process and kills it.
 
 func (n *NodeDaemon) StopServer() error {
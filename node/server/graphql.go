@@ -0,0 +1,627 @@
+package server
+
+/*
+* GraphQL API over blocks, transactions, addresses, history of rows and a state of a node. It is started on
+* a separate HTTP address when it is set in config. Only reading queries, every request uses own DB connection.
+* Objects are loaded when their fields are requested, so nested queries like block { transactions { block } } work.
+* A query can resolve graphql.MaxFields fields at most
+ */
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gelembjuk/oursql/lib/anchoring"
+	"github.com/gelembjuk/oursql/lib/graphql"
+	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/database"
+	"github.com/gelembjuk/oursql/node/nodemanager"
+	"github.com/gelembjuk/oursql/node/structures"
+)
+
+const (
+	graphQLDefaultLimit = 10
+	graphQLMaxLimit     = 100
+)
+
+type graphQLSchema struct {
+	node      *nodemanager.Node
+	anchoring anchoring.Config
+}
+
+// Starts HTTP server with GraphQL endpoint. It works till the node server stops
+func (s *NodeServer) startGraphQL() error {
+	if s.GraphQLAddr == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/graphql", graphql.Handler(s.executeGraphQL))
+
+	var err error
+
+	s.graphQLServer, err = s.startHTTPServer(s.GraphQLAddr, "GraphQL", mux)
+
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Trace.Printf("GraphQL endpoint is on http://%s/graphql", s.GraphQLAddr)
+
+	return nil
+}
+
+func (s *NodeServer) stopGraphQL() {
+	if s.graphQLServer == nil {
+		return
+	}
+	s.graphQLServer.Close()
+	s.graphQLServer = nil
+}
+
+func (s *NodeServer) executeGraphQL(query string, variables map[string]interface{}, operationName string) graphql.Response {
+	node := s.Node.Clone()
+	defer node.DBConn.CloseConnection()
+
+	schema := graphQLSchema{node, s.Anchoring}
+
+	return graphql.Execute(schema.root(), query, variables, operationName)
+}
+
+func (g graphQLSchema) root() graphql.Object {
+	return graphql.Object{
+		"__typename": graphql.Value("Query"),
+		"block": func(args graphql.Args) (interface{}, error) {
+			if args.Has("hash") {
+				hash, err := hexArg(args, "hash")
+
+				if err != nil {
+					return nil, err
+				}
+				return g.blockByHash(hash)
+			}
+
+			height, err := args.Int("height", -1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if height < 0 {
+				return nil, errors.New("Hash or height of a block is required")
+			}
+			return g.blockByHeight(height)
+		},
+		// blocks from the top of the chain down
+		"blocks": func(args graphql.Args) (interface{}, error) {
+			limit, offset, err := pageArgs(args)
+
+			if err != nil {
+				return nil, err
+			}
+
+			bestHeight, err := g.node.NodeBC.GetBestHeight()
+
+			if err != nil {
+				return nil, err
+			}
+
+			list := []graphql.Object{}
+
+			for h := bestHeight - offset; h >= 0 && len(list) < limit; h-- {
+				block, err := g.blockByHeight(h)
+
+				if err != nil {
+					return nil, err
+				}
+
+				if block != nil {
+					list = append(list, block)
+				}
+			}
+			return list, nil
+		},
+		"transaction": func(args graphql.Args) (interface{}, error) {
+			txID, err := hexArg(args, "id")
+
+			if err != nil {
+				return nil, err
+			}
+			return g.transactionByID(txID)
+		},
+		"pendingTransactions": func(args graphql.Args) (interface{}, error) {
+			limit, offset, err := pageArgs(args)
+
+			if err != nil {
+				return nil, err
+			}
+
+			ids := []string{}
+			i := 0
+
+			_, err = g.node.GetTransactionsManager().ForEachUnapprovedTransaction(func(txhash, txstr string) error {
+				if i >= offset && len(ids) < limit {
+					ids = append(ids, txhash)
+				}
+				i++
+				return nil
+			})
+
+			if err != nil {
+				return nil, err
+			}
+
+			list := []graphql.Object{}
+
+			for _, id := range ids {
+				txID, _ := hex.DecodeString(id)
+
+				tx, err := g.node.GetTransactionsManager().GetIfUnapprovedExists(txID)
+
+				if err != nil {
+					return nil, err
+				}
+
+				if tx != nil {
+					list = append(list, g.transaction(tx, nil))
+				}
+			}
+			return list, nil
+		},
+		"address": func(args graphql.Args) (interface{}, error) {
+			address, err := args.String("address", "")
+
+			if err != nil {
+				return nil, err
+			}
+
+			if address == "" {
+				return nil, errors.New("Address is missed")
+			}
+			return g.address(address), nil
+		},
+		// SQL transactions which changed a row, from first to last
+		"rowHistory": func(args graphql.Args) (interface{}, error) {
+			table, err := args.String("table", "")
+
+			if err != nil {
+				return nil, err
+			}
+
+			key, err := args.String("key", "")
+
+			if err != nil {
+				return nil, err
+			}
+
+			if table == "" || key == "" {
+				return nil, errors.New("Table and key of a row are required")
+			}
+
+			history, err := g.node.GetTransactionsManager().GetRowHistory([]byte(table + ":" + key))
+
+			if err != nil {
+				return nil, err
+			}
+
+			list := []graphql.Object{}
+
+			for _, tx := range history {
+				list = append(list, g.transaction(tx, nil))
+			}
+			return list, nil
+		},
+		// events of the change log after a cursor. Cursor of a result is used to request next events
+		"changes": func(args graphql.Args) (interface{}, error) {
+			after, err := args.Int("after", 0)
+
+			if err != nil {
+				return nil, err
+			}
+
+			limit, _, err := pageArgs(args)
+
+			if err != nil {
+				return nil, err
+			}
+
+			events, err := g.node.GetTransactionsManager().GetChangeEvents(int64(after), limit)
+
+			if err != nil {
+				return nil, err
+			}
+
+			cursor := int64(after)
+			list := []graphql.Object{}
+
+			for _, e := range events {
+				list = append(list, g.changeEvent(e))
+				cursor = e.ID
+			}
+
+			return graphql.Object{
+				"__typename": graphql.Value("ChangesPage"),
+				"cursor":     graphql.Value(cursor),
+				"hasMore":    graphql.Value(len(events) == limit),
+				"events":     graphql.Value(list),
+			}, nil
+		},
+		// anchors of blocks in an external blockchain, from the last one
+		"anchors": func(args graphql.Args) (interface{}, error) {
+			limit, offset, err := pageArgs(args)
+
+			if err != nil {
+				return nil, err
+			}
+
+			anchors, err := g.node.GetAnchors(limit, offset)
+
+			if err != nil {
+				return nil, err
+			}
+
+			list := []graphql.Object{}
+
+			for _, a := range anchors {
+				list = append(list, g.anchor(a))
+			}
+			return list, nil
+		},
+		"anchor": func(args graphql.Args) (interface{}, error) {
+			id, err := args.Int("id", 0)
+
+			if err != nil {
+				return nil, err
+			}
+
+			anchor, err := g.node.GetAnchor(int64(id))
+
+			if err != nil || anchor == nil {
+				return nil, err
+			}
+			return g.anchor(*anchor), nil
+		},
+		"node": func(args graphql.Args) (interface{}, error) {
+			return g.nodeState()
+		},
+	}
+}
+
+func (g graphQLSchema) anchor(a database.Anchor) graphql.Object {
+	return graphql.Object{
+		"__typename":  graphql.Value("Anchor"),
+		"id":          graphql.Value(a.ID),
+		"blockHash":   graphql.Value(hex.EncodeToString(a.BlockHash)),
+		"blockHeight": graphql.Value(a.BlockHeight),
+		"adapter":     graphql.Value(a.Adapter),
+		"reference":   graphql.Value(a.Reference),
+		"time":        graphql.Value(a.Time),
+		"block": func(args graphql.Args) (interface{}, error) {
+			return g.blockByHash(a.BlockHash)
+		},
+		// requests the external chain, so it is done only when the field is in a query
+		"verification": func(args graphql.Args) (interface{}, error) {
+			if g.anchoring.Adapter == "" {
+				return nil, errors.New("Anchoring is not configured on this node")
+			}
+
+			adapter, err := anchoring.NewAdapter(g.anchoring)
+
+			if err != nil {
+				return nil, err
+			}
+
+			state, err := g.node.VerifyAnchor(a, adapter, g.anchoring.Adapter)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return graphql.Object{
+				"__typename":    graphql.Value("AnchorVerification"),
+				"found":         graphql.Value(state.Found),
+				"confirmations": graphql.Value(state.Confirmations),
+				"inChain":       graphql.Value(state.InChain),
+				"valid":         graphql.Value(state.Found && state.InChain),
+			}, nil
+		},
+	}
+}
+
+func (g graphQLSchema) changeEvent(e database.ChangeEvent) graphql.Object {
+	return graphql.Object{
+		"__typename":  graphql.Value("ChangeEvent"),
+		"id":          graphql.Value(e.ID),
+		"table":       graphql.Value(e.Table),
+		"key":         graphql.Value(e.Key),
+		"operation":   graphql.Value(e.Operation),
+		"txId":        graphql.Value(hex.EncodeToString(e.TXID)),
+		"blockHash":   graphql.Value(hex.EncodeToString(e.BlockHash)),
+		"blockHeight": graphql.Value(e.BlockHeight),
+		"canceled":    graphql.Value(e.Canceled),
+		"transaction": func(args graphql.Args) (interface{}, error) {
+			return g.transactionByID(e.TXID)
+		},
+	}
+}
+
+func (g graphQLSchema) blockByHash(hash []byte) (interface{}, error) {
+	exists, err := g.node.NodeBC.CheckBlockExists(hash)
+
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	block, err := g.node.NodeBC.GetBlock(hash)
+
+	if err != nil {
+		return nil, err
+	}
+	return g.block(block), nil
+}
+
+func (g graphQLSchema) blockByHeight(height int) (graphql.Object, error) {
+	block, err := g.node.NodeBC.GetBCManager().GetBlockAtHeight(height)
+
+	if err != nil || block == nil {
+		return nil, err
+	}
+	return g.block(block), nil
+}
+
+func (g graphQLSchema) block(block *structures.Block) graphql.Object {
+	return graphql.Object{
+		"__typename":        graphql.Value("Block"),
+		"hash":              graphql.Value(hex.EncodeToString(block.Hash)),
+		"height":            graphql.Value(block.Height),
+		"prevHash":          graphql.Value(hex.EncodeToString(block.PrevBlockHash)),
+		"timestamp":         graphql.Value(block.Timestamp),
+		"nonce":             graphql.Value(block.Nonce),
+		"transactionsCount": graphql.Value(len(block.Transactions)),
+		"transactions": func(args graphql.Args) (interface{}, error) {
+			limit, offset, err := pageArgs(args)
+
+			if err != nil {
+				return nil, err
+			}
+
+			list := []graphql.Object{}
+
+			for i := offset; i < len(block.Transactions) && len(list) < limit; i++ {
+				list = append(list, g.transaction(&block.Transactions[i], block))
+			}
+			return list, nil
+		},
+		"prevBlock": func(args graphql.Args) (interface{}, error) {
+			if len(block.PrevBlockHash) == 0 {
+				return nil, nil
+			}
+			return g.blockByHash(block.PrevBlockHash)
+		},
+	}
+}
+
+func (g graphQLSchema) transactionByID(txID []byte) (interface{}, error) {
+	tx, err := g.node.GetTransactionsManager().GetIfExists(txID)
+
+	if err != nil || tx == nil {
+		return nil, err
+	}
+	return g.transaction(tx, nil), nil
+}
+
+// Block is nil if it is not known yet. It is found when requested
+func (g graphQLSchema) transaction(tx *structures.Transaction, block *structures.Block) graphql.Object {
+	txType := "currency"
+
+	if tx.IsCoinbaseTransfer() {
+		txType = "coinbase"
+	} else if tx.IsSQLCommand() {
+		txType = "sql"
+	}
+
+	signer := ""
+
+	if len(tx.ByPubKey) > 0 {
+		signer, _ = utils.PubKeyToAddres(tx.ByPubKey)
+	}
+
+	inputs := []graphql.Object{}
+
+	for _, in := range tx.Vin {
+		in := in
+
+		inputs = append(inputs, graphql.Object{
+			"__typename": graphql.Value("Input"),
+			"txId":       graphql.Value(hex.EncodeToString(in.Txid)),
+			"output":     graphql.Value(in.Vout),
+			"transaction": func(args graphql.Args) (interface{}, error) {
+				if len(in.Txid) == 0 {
+					return nil, nil
+				}
+				return g.transactionByID(in.Txid)
+			},
+		})
+	}
+
+	outputs := []graphql.Object{}
+
+	for _, out := range tx.Vout {
+		address, _ := utils.PubKeyHashToAddres(out.PubKeyHash)
+
+		outputs = append(outputs, graphql.Object{
+			"__typename": graphql.Value("Output"),
+			"value":      graphql.Value(out.Value),
+			"address":    graphql.Value(address),
+		})
+	}
+
+	return graphql.Object{
+		"__typename":    graphql.Value("Transaction"),
+		"id":            graphql.Value(hex.EncodeToString(tx.GetID())),
+		"time":          graphql.Value(tx.Time),
+		"type":          graphql.Value(txType),
+		"signer":        graphql.Value(signer),
+		"query":         graphql.Value(string(tx.SQLCommand.Query)),
+		"rollbackQuery": graphql.Value(string(tx.SQLCommand.RollbackQuery)),
+		"referenceId":   graphql.Value(string(tx.SQLCommand.ReferenceID)),
+		"baseTxId":      graphql.Value(hex.EncodeToString(tx.GetSQLBaseTX())),
+		"inputs":        graphql.Value(inputs),
+		"outputs":       graphql.Value(outputs),
+		"baseTransaction": func(args graphql.Args) (interface{}, error) {
+			if len(tx.GetSQLBaseTX()) == 0 {
+				return nil, nil
+			}
+			return g.transactionByID(tx.GetSQLBaseTX())
+		},
+		"pending": func(args graphql.Args) (interface{}, error) {
+			if block != nil {
+				return false, nil
+			}
+			ptx, err := g.node.GetTransactionsManager().GetIfUnapprovedExists(tx.GetID())
+
+			return ptx != nil, err
+		},
+		// nil for transactions in the pool
+		"block": func(args graphql.Args) (interface{}, error) {
+			if block != nil {
+				return g.block(block), nil
+			}
+			blockHash, err := g.node.GetTransactionsManager().GetTransactionBlock(tx.GetID())
+
+			if err != nil {
+				return nil, nil
+			}
+			return g.blockByHash(blockHash)
+		},
+	}
+}
+
+func (g graphQLSchema) address(address string) graphql.Object {
+	return graphql.Object{
+		"__typename": graphql.Value("Address"),
+		"address":    graphql.Value(address),
+		"balance": func(args graphql.Args) (interface{}, error) {
+			balance, err := g.node.GetTransactionsManager().GetAddressBalance(address)
+
+			if err != nil {
+				return nil, err
+			}
+			return graphql.Object{
+				"__typename": graphql.Value("Balance"),
+				"total":      graphql.Value(balance.Total),
+				"approved":   graphql.Value(balance.Approved),
+				"pending":    graphql.Value(balance.Pending),
+			}, nil
+		},
+		// currency transfers of the address from the newest
+		"history": func(args graphql.Args) (interface{}, error) {
+			limit, offset, err := pageArgs(args)
+
+			if err != nil {
+				return nil, err
+			}
+
+			history, err := g.node.NodeBC.GetAddressHistory(address)
+
+			if err != nil {
+				return nil, err
+			}
+
+			list := []graphql.Object{}
+
+			for i := offset; i < len(history) && len(list) < limit; i++ {
+				h := history[i]
+
+				list = append(list, graphql.Object{
+					"__typename":  graphql.Value("HistoryRecord"),
+					"incoming":    graphql.Value(h.IOType),
+					"txId":        graphql.Value(hex.EncodeToString(h.TXID)),
+					"address":     graphql.Value(h.Address),
+					"value":       graphql.Value(h.Value),
+					"time":        graphql.Value(h.Time),
+					"blockHash":   graphql.Value(hex.EncodeToString(h.BlockHash)),
+					"blockHeight": graphql.Value(h.BlockHeight),
+					"transaction": func(args graphql.Args) (interface{}, error) {
+						return g.transactionByID(h.TXID)
+					},
+				})
+			}
+			return list, nil
+		},
+	}
+}
+
+func (g graphQLSchema) nodeState() (interface{}, error) {
+	state, err := g.node.GetNodeState()
+
+	if err != nil {
+		return nil, err
+	}
+
+	peers := []string{}
+
+	for _, addr := range g.node.NodeNet.GetNodes() {
+		peers = append(peers, addr.NodeAddrToString())
+	}
+
+	return graphql.Object{
+		"__typename":         graphql.Value("NodeState"),
+		"address":            graphql.Value(g.node.NodeClient.NodeAddress.NodeAddrToString()),
+		"blocks":             graphql.Value(state.BlocksNumber),
+		"transactionsCached": graphql.Value(state.TransactionsCached),
+		"unspentOutputs":     graphql.Value(state.UnspentOutputs),
+		"dbAvailable":        graphql.Value(state.DBAvailable),
+		"peers":              graphql.Value(peers),
+		"topBlock": func(args graphql.Args) (interface{}, error) {
+			hash, err := g.node.NodeBC.GetTopBlockHash()
+
+			if err != nil {
+				return nil, err
+			}
+			return g.blockByHash(hash)
+		},
+	}, nil
+}
+
+func pageArgs(args graphql.Args) (limit int, offset int, err error) {
+	limit, err = args.Int("limit", graphQLDefaultLimit)
+
+	if err != nil {
+		return
+	}
+
+	offset, err = args.Int("offset", 0)
+
+	if err != nil {
+		return
+	}
+
+	if limit < 1 || limit > graphQLMaxLimit {
+		err = errors.New(fmt.Sprintf("Limit must be from 1 to %d", graphQLMaxLimit))
+	} else if offset < 0 {
+		err = errors.New("Offset can not be negative")
+	}
+	return
+}
+
+func hexArg(args graphql.Args, name string) ([]byte, error) {
+	s, err := args.String(name, "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if s == "" {
+		return nil, errors.New(fmt.Sprintf("Argument %s is missed", name))
+	}
+
+	data, err := hex.DecodeString(s)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Argument %s must be hex encoded", name))
+	}
+	return data, nil
+}
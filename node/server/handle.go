@@ -2,13 +2,14 @@ package server
 
 import (
 	"bytes"
-	"encoding/gob"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/gelembjuk/oursql/lib"
 	"github.com/gelembjuk/oursql/lib/net"
 	"github.com/gelembjuk/oursql/lib/nodeclient"
+	"github.com/gelembjuk/oursql/lib/remoteclient"
 	"github.com/gelembjuk/oursql/lib/utils"
 	"github.com/gelembjuk/oursql/node/blockchain"
 	"github.com/gelembjuk/oursql/node/consensus"
@@ -27,6 +28,15 @@ type NodeServerRequest struct {
 	Response          []byte
 	NodeAuthStrIsGood bool
 	SessID            string
+	// ID of identity of a node which sent the request. Empty if it is not known
+	PeerIdentity string
+	// format of payloads of the request and the response
+	WireFormat string
+	// set if a client asked for a streamed response
+	Stream *net.StreamWriter
+	// misbehavior of a peer in this request
+	BanPoints int
+	BanReason string
 }
 
 func (s *NodeServerRequest) Init() {
@@ -36,19 +46,26 @@ func (s *NodeServerRequest) Init() {
 
 // Reads and parses request from network data
 func (s *NodeServerRequest) parseRequestData(payload interface{}) error {
-	var buff bytes.Buffer
-
-	buff.Write(s.Request)
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(payload)
+	err := net.DecodePayload(s.WireFormat, s.Request, payload)
 
 	if err != nil {
-		return errors.New("Parse request: " + err.Error())
+		s.addBanPoints(net.BanPointsBadRequest, "Payload can not be parsed")
+		return net.NewRemoteError(net.ErrorCodeBadRequest, "Parse request: "+err.Error())
 	}
 
 	return nil
 }
 
+func (s *NodeServerRequest) addBanPoints(points int, reason string) {
+	s.BanPoints += points
+	s.BanReason = reason
+}
+
+// Encodes a response in same format as the request
+func (s *NodeServerRequest) encodeResponse(result interface{}) ([]byte, error) {
+	return net.EncodePayload(s.WireFormat, result)
+}
+
 // Find and return the list of unspent transactions
 func (s *NodeServerRequest) handleGetUnspent() error {
 	s.HasResponse = true
@@ -86,7 +103,7 @@ func (s *NodeServerRequest) handleGetUnspent() error {
 		return err
 	}
 
-	s.Response, err = net.GobEncode(result)
+	s.Response, err = s.encodeResponse(result)
 
 	if err != nil {
 		return err
@@ -109,17 +126,45 @@ func (s *NodeServerRequest) handleGetHistory() error {
 
 	result := []nodeclient.ComHistoryTransaction{}
 
-	history, err := s.Node.NodeBC.GetAddressHistory(payload.Address)
+	var history []structures.TransactionsHistory
+
+	if payload.Offset > 0 {
+		history, err = s.Node.NodeBC.GetAddressHistory(payload.Address)
+	} else {
+		history, err = s.Node.NodeBC.GetAddressHistoryPage(payload.Address, payload.AfterBlock, payload.AfterTX,
+			payload.AfterIOType, payload.Limit)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	bestHeight, err := s.Node.NodeBC.GetBestHeight()
 
 	if err != nil {
 		return err
 	}
 
+	if payload.Offset > 0 {
+		if payload.Offset > len(history) {
+			payload.Offset = len(history)
+		}
+		history = history[payload.Offset:]
+	}
+
+	if payload.Limit > 0 && payload.Limit < len(history) {
+		history = history[:payload.Limit]
+	}
+
 	for _, t := range history {
 		ut := nodeclient.ComHistoryTransaction{}
 		ut.Amount = t.Value
 		ut.IOType = t.IOType
 		ut.TXID = t.TXID
+		ut.Time = t.Time
+		ut.BlockHash = t.BlockHash
+		ut.BlockHeight = t.BlockHeight
+		ut.Confirmations = bestHeight - t.BlockHeight + 1
 
 		if t.IOType {
 			ut.From = t.Address
@@ -129,7 +174,7 @@ func (s *NodeServerRequest) handleGetHistory() error {
 		result = append(result, ut)
 	}
 
-	s.Response, err = net.GobEncode(result)
+	s.Response, err = s.encodeResponse(result)
 
 	if err != nil {
 		return err
@@ -162,7 +207,7 @@ func (s *NodeServerRequest) handleGetBalance() error {
 	balance.Approved = balancen.Approved
 	balance.Pending = balancen.Pending
 
-	s.Response, err = net.GobEncode(balance)
+	s.Response, err = s.encodeResponse(balance)
 
 	if err != nil {
 		return err
@@ -188,7 +233,8 @@ func (s *NodeServerRequest) handleTxData() error {
 	TX, err := s.Node.ReceivedNewCurrencyTransactionData(payload.TX, payload.Signature)
 
 	if err != nil {
-		return errors.New(fmt.Sprintf("Transaction accepting error: %s", err.Error()))
+		// code of the error is kept, a client must know why the transaction is not accepted
+		return net.NewRemoteError(net.GetErrorCode(err), fmt.Sprintf("Transaction accepting error: %s", err.Error()))
 	}
 
 	s.Logger.Trace.Printf("Acceppted new transaction from %s\n", payload.Address)
@@ -197,7 +243,7 @@ func (s *NodeServerRequest) handleTxData() error {
 
 	s.S.blocksMakerObj.NewTransaction(TX.GetID())
 
-	s.Response, err = net.GobEncode(TX.GetID())
+	s.Response, err = s.encodeResponse(TX.GetID())
 
 	if err != nil {
 		return errors.New(fmt.Sprintf("TXFull Response Error: %s", err.Error()))
@@ -228,7 +274,7 @@ func (s *NodeServerRequest) handleGetTransaction() error {
 	}
 
 	if tx == nil {
-		return errors.New("Transaction not found in a pool")
+		return net.NewRemoteError(net.ErrorCodeNotFound, "Transaction not found in a pool")
 	}
 
 	result.Transaction, err = structures.SerializeTransaction(tx)
@@ -237,7 +283,7 @@ func (s *NodeServerRequest) handleGetTransaction() error {
 		return err
 	}
 
-	s.Response, err = net.GobEncode(result)
+	s.Response, err = s.encodeResponse(result)
 
 	if err != nil {
 		return err
@@ -276,8 +322,9 @@ func (s *NodeServerRequest) handleCheckBlock() error {
 	}
 
 	result.Exists = blockstate != 0
+	result.CompactBlocks = true
 
-	s.Response, err = net.GobEncode(result)
+	s.Response, err = s.encodeResponse(result)
 
 	if err != nil {
 		return err
@@ -302,8 +349,14 @@ func (s *NodeServerRequest) handleTxCurRequest() error {
 
 	result := nodeclient.ComRequestTransactionData{}
 
+	w := remoteclient.Wallet{}
+
+	if payload.ChangeAddress != "" && !w.ValidateAddress(payload.ChangeAddress) {
+		return net.NewRemoteError(net.ErrorCodeBadRequest, "Change address is not valid")
+	}
+
 	TXBytes, DataToSign, err := s.Node.GetTransactionsManager().
-		PrepareNewCurrencyTransaction(payload.PubKey, payload.To, payload.Amount)
+		PrepareNewCurrencyTransaction(payload.PubKey, payload.To, payload.Amount, payload.ChangeAddress)
 
 	if err != nil {
 		return err
@@ -312,7 +365,7 @@ func (s *NodeServerRequest) handleTxCurRequest() error {
 	result.DataToSign = DataToSign
 	result.TX = TXBytes
 
-	s.Response, err = net.GobEncode(result)
+	s.Response, err = s.encodeResponse(result)
 
 	if err != nil {
 		return err
@@ -362,7 +415,7 @@ func (s *NodeServerRequest) handleTxSQLRequest() error {
 	result.DataToSign = DataToSign
 	result.TX = TXBytes
 
-	s.Response, err = net.GobEncode(result)
+	s.Response, err = s.encodeResponse(result)
 
 	if err != nil {
 		return err
@@ -398,7 +451,7 @@ func (s *NodeServerRequest) handleGetFirstBlocks() error {
 		result.Blocks = append(result.Blocks, blockdata)
 	}
 
-	s.Response, err = net.GobEncode(result)
+	s.Response, err = s.encodeResponse(result)
 
 	if err != nil {
 		return err
@@ -409,7 +462,7 @@ func (s *NodeServerRequest) handleGetFirstBlocks() error {
 }
 
 // Handle request from a new node to get consensus information
-// Returns consensus config if any and consensus module ( TODO )
+// Returns consensus config if any. A consensus module is not sent, the config has its hash and URL or IPFS CID
 func (s *NodeServerRequest) handleGetConsensusData() error {
 	s.HasResponse = true
 
@@ -429,7 +482,7 @@ func (s *NodeServerRequest) handleGetConsensusData() error {
 		return err
 	}
 
-	s.Response, err = net.GobEncode(result)
+	s.Response, err = s.encodeResponse(result)
 
 	if err != nil {
 		return err
@@ -451,6 +504,12 @@ func (s *NodeServerRequest) handleAddr() error {
 		return err
 	}
 
+	err = s.checkPeerIdentity(payload.AddrFrom)
+
+	if err != nil {
+		return err
+	}
+
 	s.Node.CheckAddressKnown(payload.AddrFrom)
 
 	addednodes := []net.NodeAddr{}
@@ -487,10 +546,26 @@ func (s *NodeServerRequest) handleBlock() error {
 		return err
 	}
 
+	err = s.checkPeerMessage(payload.AddrFrom, payload.Signature, payload.SignedData())
+
+	if err != nil {
+		return err
+	}
+
 	blockstate, addstate, block, err := s.Node.ReceivedFullBlockFromOtherNode(payload.Block)
 	s.Logger.Trace.Printf("adding new block %d, %d", blockstate, addstate)
+
+	if err == nil && block != nil && (blockstate == 0 || blockstate == 1) {
+		s.S.Inventory.SetKnown(inventoryBlock, block.Hash)
+	}
 	// state of this adding we don't check. not interesting in this place
 	if err != nil {
+		switch net.GetErrorCode(err) {
+		case net.ErrorCodeBadRequest:
+			s.addBanPoints(net.BanPointsBadRequest, "Block can not be parsed")
+		case net.ErrorCodeBlockVerify, net.ErrorCodeTransactionVerify:
+			s.addBanPoints(net.BanPointsInvalidBlock, "Invalid block: "+err.Error())
+		}
 		return err
 	}
 
@@ -499,6 +574,11 @@ func (s *NodeServerRequest) handleBlock() error {
 		// block was added, now we can send it to all other nodes.
 		s.Node.GetCommunicationManager().SendBlockToAll(block, payload.AddrFrom)
 	}
+
+	if blockstate == 2 {
+		// the block is kept till previous blocks are loaded
+		s.Node.RequestOrphanAncestors(payload.AddrFrom, block)
+	}
 	// this is the list of hashes some node posted before. If there are yes some data then try to get that blocks.
 	s.Logger.Trace.Printf("check count blocks left %d ", s.S.Transit.GetBlocksCount(payload.AddrFrom))
 	if s.S.Transit.GetBlocksCount(payload.AddrFrom) > 0 {
@@ -566,13 +646,37 @@ func (s *NodeServerRequest) handleInv() error {
 		return err
 	}
 
+	err = s.checkPeerMessage(payload.AddrFrom, payload.Signature, payload.SignedData())
+
+	if err != nil {
+		return err
+	}
+
 	s.Logger.Trace.Printf("SessID: %s . Recevied inventory with %d %s\n", s.SessID, len(payload.Items), payload.Type)
 
 	if payload.Type == "block" {
+		// blocks which this node has or requested from other node already are not loaded again
+		items := [][]byte{}
+
+		for _, blockdata := range payload.Items {
+			bs, err := structures.NewBlockShortFromBytes(blockdata)
+
+			if err != nil {
+				s.addBanPoints(net.BanPointsBadRequest, "Inventory block can not be parsed")
+				return err
+			}
+
+			if !s.S.Inventory.StartRequest(inventoryBlock, bs.Hash) {
+				s.Logger.Trace.Printf("Block %x was seen already. Skip", bs.Hash)
+				continue
+			}
+			items = append(items, blockdata)
+		}
+
 		// this structure is used to keep info about blocks while loading them one by one
-		s.S.Transit.AddBlocks(payload.AddrFrom, payload.Items)
+		s.S.Transit.AddBlocks(payload.AddrFrom, items)
 
-		for {
+		for len(items) > 0 {
 
 			blockdata, err := s.S.Transit.ShiftNextBlock(payload.AddrFrom)
 
@@ -615,6 +719,12 @@ func (s *NodeServerRequest) handleInv() error {
 	if payload.Type == "tx" {
 		txID := payload.Items[0]
 
+		if !s.S.Inventory.StartRequest(inventoryTX, txID) {
+			s.Logger.Trace.Printf("TX %x was seen already. Skip\n", txID)
+			s.Node.CheckAddressKnown(payload.AddrFrom)
+			return nil
+		}
+
 		s.Logger.Trace.Printf("Check if TX exists %x\n", txID)
 
 		tx, err := s.Node.GetTransactionsManager().GetIfExists(txID)
@@ -623,6 +733,10 @@ func (s *NodeServerRequest) handleInv() error {
 			// not exists
 			s.Logger.Trace.Printf("Not exist. Request it\n")
 			s.Node.NodeClient.SendGetData(payload.AddrFrom, "tx", txID)
+		} else if tx != nil {
+			s.S.Inventory.SetKnown(inventoryTX, txID)
+		} else {
+			s.S.Inventory.Forget(inventoryTX, txID)
 		}
 	}
 	s.Node.CheckAddressKnown(payload.AddrFrom)
@@ -731,7 +845,7 @@ func (s *NodeServerRequest) handleGetBlock() error {
 		return err
 	}
 
-	s.Response, err = net.GobEncode(result)
+	s.Response, err = s.encodeResponse(result)
 
 	if err != nil {
 		return err
@@ -740,67 +854,94 @@ func (s *NodeServerRequest) handleGetBlock() error {
 	return nil
 }
 
-/*
-* Response on request to get full body of a block or transaction
- */
-func (s *NodeServerRequest) handleGetData() error {
+// Compact block received from other node. Missed transactions are requested back
+func (s *NodeServerRequest) handleCompactBlock() error {
+	var payload nodeclient.ComCompactBlock
+	err := s.parseRequestData(&payload)
 
-	var payload nodeclient.ComGetData
+	if err != nil {
+		return err
+	}
 
-	err := s.parseRequestData(&payload)
+	err = s.checkPeerMessage(payload.AddrFrom, payload.Signature, payload.SignedData())
 
 	if err != nil {
 		return err
 	}
 
-	s.Logger.Trace.Printf("SessID: %s . Data Requested of type %s, id %x\n", s.SessID, payload.Type, payload.ID)
+	blockstate, _, block, err := s.Node.ReceivedCompactBlockFromOtherNode(payload.AddrFrom, payload.Block)
 
-	if payload.Type == "block" {
+	if err == nil && block != nil && (blockstate == 0 || blockstate == 1) {
+		s.S.Inventory.SetKnown(inventoryBlock, block.Hash)
+	}
 
-		block, err := s.Node.NodeBC.GetBlock([]byte(payload.ID))
-		if err != nil {
-			return err
+	if err != nil {
+		switch net.GetErrorCode(err) {
+		case net.ErrorCodeBadRequest:
+			s.addBanPoints(net.BanPointsBadRequest, "Compact block is not valid: "+err.Error())
+		case net.ErrorCodeBlockVerify, net.ErrorCodeTransactionVerify:
+			s.addBanPoints(net.BanPointsInvalidBlock, "Invalid block: "+err.Error())
 		}
+		return err
+	}
 
-		bs, err := block.Serialize()
+	if blockstate == 0 {
+		s.Node.GetCommunicationManager().SendBlockToAll(block, payload.AddrFrom)
+	}
 
-		if err == nil {
-			s.Node.NodeClient.SendBlock(payload.AddrFrom, bs)
-		}
+	if blockstate == 2 {
+		s.Node.RequestOrphanAncestors(payload.AddrFrom, block)
+	}
+	return nil
+}
+
+// Sends transactions of a block which other node doesn't have to make the block from compact block
+func (s *NodeServerRequest) handleGetBlockTxs() error {
+	s.HasResponse = true
+
+	var payload nodeclient.ComGetBlockTxs
+
+	err := s.parseRequestData(&payload)
 
+	if err != nil {
+		return err
 	}
 
-	if payload.Type == "tx" {
+	block, err := s.Node.NodeBC.GetBlock(payload.BlockHash)
 
-		if txe, err := s.Node.GetTransactionsManager().GetIfUnapprovedExists(payload.ID); err == nil && txe != nil {
+	if err != nil {
+		return err
+	}
 
-			s.Logger.Trace.Printf("Return transaction with ID %x to %s\n", payload.ID, payload.AddrFrom.NodeAddrToString())
-			// exists
-			txser, err := structures.SerializeTransaction(txe)
+	result := nodeclient.ResponseGetBlockTxs{}
 
-			if err != nil {
-				return err
-			}
+	for _, i := range payload.Indexes {
+		if i < 0 || i >= len(block.Transactions) {
+			return net.NewRemoteError(net.ErrorCodeBadRequest, fmt.Sprintf("Block has no transaction %d", i))
+		}
 
-			s.Node.NodeClient.SendTx(payload.AddrFrom, txser)
+		txdata, err := structures.SerializeTransaction(&block.Transactions[i])
 
+		if err != nil {
+			return err
 		}
+		result.Transactions = append(result.Transactions, txdata)
 	}
 
-	s.Node.CheckAddressKnown(payload.AddrFrom)
+	s.Response, err = s.encodeResponse(result)
 
-	return nil
+	return err
 }
 
-/*
-* Handle new transaction. Verify it before doing something (verify is done in the NodeTX object)
-* This is transaction received from other node. We expect that other node aready posted it to all other
-* Here we have a choice. Or we also send it to all other or not.
-* For now we don't send it to all other
- */
-func (s *NodeServerRequest) handleTx() error {
+// Streams full blocks going up. Every block is sent when it is loaded, so a long chain is not in memory
+func (s *NodeServerRequest) handleGetBlocksStream() error {
+	s.HasResponse = true
 
-	var payload nodeclient.ComTx
+	if s.Stream == nil {
+		return net.NewRemoteError(net.ErrorCodeBadRequest, "Streamed response is required")
+	}
+
+	var payload nodeclient.ComGetBlocksStream
 
 	err := s.parseRequestData(&payload)
 
@@ -808,64 +949,39 @@ func (s *NodeServerRequest) handleTx() error {
 		return err
 	}
 
-	txData := payload.Transaction
-	tx, err := structures.DeserializeTransaction(txData)
-
-	if err != nil {
-		return err
-	}
+	count := 0
 
-	if txe, err := s.Node.GetTransactionsManager().GetIfExists(tx.GetID()); err == nil && txe != nil {
-		s.Logger.Trace.Printf("Received transaction. It already exists: %x ", tx.GetID())
-		// exists , nothing to do, it was already processed before
-		return nil
-	}
-	s.Logger.Trace.Printf("Received transaction. It does not exists: %x ", tx.GetID())
-	// this will also verify a transaction
-	err = s.Node.ReceivedNewTransaction(tx, lib.TXFlagsExecute)
+	err = s.Node.NodeBC.GetBCManager().ForEachNextBlock(payload.StartFrom, payload.MaxCount, func(block *structures.Block) error {
+		result := nodeclient.ResponseGetBlock{}
 
-	if err != nil {
-		// if error is because some input transaction is not found, then request it and after it this TX again
-		s.Logger.Trace.Println("Error ", err.Error())
+		var err error
 
-		if err, ok := err.(*transactions.TXVerifyError); ok {
-			s.Logger.Trace.Println("Custom errro of kind ", err.GetKind())
+		result.Block, err = block.Serialize()
 
-			if err.GetKind() == transactions.TXVerifyErrorNoInput {
-				/*
-					* we will not do somethign in this case. If no base TX that is not yet approved we wil ignore it
-					* previous TX must exist on a node that sent this TX, so, let it complete this work abd build a block
-					* This case is possible if a node was not online when previous TX was created
-					s.Logger.Trace.Printf("Request another 2 TX %x , %x", err.TX, tx.ID)
-					s.Node.NodeClient.SendGetData(payload.AddFrom, "tx", err.TX)
-					time.Sleep(1 * time.Second) // wait to get a chance to return that TX
-					// TODO we need to be able to request more TX in order in single request
-					s.Node.NodeClient.SendGetData(payload.AddFrom, "tx", tx.ID)
-					return nil*/
+		if err != nil {
+			return err
+		}
 
-				// TODO in future we can createsomethign more start here. Like, get TX with all previous TXs that are not approved yet
-			}
+		chunk, err := s.encodeResponse(result)
 
+		if err != nil {
+			return err
 		}
-		return err
-	}
+		count++
 
-	// send this transaction to all other nodes
-	// TODO
-	// maybe we should not send transaction here to all other nodes.
-	// this node should try to make a block first.
+		return s.Stream.WriteChunk(chunk)
+	})
 
-	// try to mine new block. don't send the transaction to other nodes after block make attempt
-	s.S.blocksMakerObj.DoNewBlock()
+	s.Logger.Trace.Printf("Streamed %d blocks\n", count)
 
-	return nil
+	return err
 }
 
-// Other node requests for last changes on this server and expects to get response on real time
-func (s *NodeServerRequest) handleGetUpdates() error {
+// Handles commands of a batch one by one. An error of a command is its response, other commands are still done
+func (s *NodeServerRequest) handleBatch() error {
 	s.HasResponse = true
 
-	var payload nodeclient.ComGetUpdates
+	var payload nodeclient.ComBatch
 
 	err := s.parseRequestData(&payload)
 
@@ -873,70 +989,115 @@ func (s *NodeServerRequest) handleGetUpdates() error {
 		return err
 	}
 
-	result := nodeclient.ResponseGetUpdates{}
+	if len(payload.Requests) > nodeclient.MaxBatchRequests {
+		return net.NewRemoteError(net.ErrorCodeBadRequest, fmt.Sprintf("Batch of %d requests is too long", len(payload.Requests)))
+	}
 
-	result.CurrentBlockHeight, err = s.Node.NodeBC.GetBestHeight()
+	result := nodeclient.ResponseBatch{}
 
-	if err != nil {
-		return err
+	for _, request := range payload.Requests {
+		sub := *s
+		sub.Init()
+		sub.Request = request.Data
+		sub.Stream = nil
+
+		var rerr error
+
+		if request.Command == nodeclient.CommandBatch || request.Command == nodeclient.CommandGetBlocksStream ||
+			request.Command == nodeclient.CommandGetSnapshot {
+			rerr = net.NewRemoteError(net.ErrorCodeBadRequest, fmt.Sprintf("Command %s can not be in a batch", request.Command))
+		} else {
+			rerr = sub.handleCommand(request.Command)
+		}
+
+		response := nodeclient.ComBatchResponse{}
+
+		if rerr != nil {
+			s.Logger.Trace.Printf("Batch command %s error: %s", request.Command, rerr.Error())
+
+			response.Data, err = net.EncodeErrorResponseAs(s.WireFormat, rerr)
+
+			if err != nil {
+				return err
+			}
+		} else {
+			response.Success = true
+			response.Data = sub.Response
+		}
+		result.Responses = append(result.Responses, response)
 	}
-	// load blocks. maximum 50 and created not older 5 minutes since last update check
-	blocks, err := s.Node.NodeBC.GetBCManager().GetBlocksSince(payload.TopBlocks, payload.LastCheckTime-60*5, 50)
+
+	s.Response, err = s.encodeResponse(result)
 
 	if err != nil {
 		return err
 	}
 
-	s.Logger.TraceExt.Printf("Loaded %d block hashes", len(blocks))
+	return nil
+}
 
-	result.Blocks = [][]byte{}
+// Returns headers of blocks. It is used by lite wallets to check a chain
+// and Merkle proofs without loading full blocks
+func (s *NodeServerRequest) handleGetBlockHeaders() error {
+	s.HasResponse = true
 
-	for i := len(blocks) - 1; i >= 0; i-- {
-		bdata, _ := blocks[i].Serialize()
-		result.Blocks = append(result.Blocks, bdata)
-	}
+	var payload nodeclient.ComGetBlockHeaders
 
-	// load transactions from pool only created recently
-	result.CountTransactionsInPool, err = s.Node.GetTransactionsManager().GetUnapprovedCount()
+	err := s.parseRequestData(&payload)
 
 	if err != nil {
 		return err
 	}
-	// NOTE. this shouold not return transactions that are currently under minting.
-	result.TransactionsInPool, err = s.Node.GetTransactionsManager().
-		GetUnapprovedTransactionsFiltered(
-			payload.LastCheckTime-60*30,
-			1000,
-			s.S.blocksMakerObj.GetLockedTransactions()) // list of transactions locked by block maker, skip them
 
-	if err != nil {
-		return err
+	if payload.MaxCount < 1 || payload.MaxCount > 1000 {
+		payload.MaxCount = 1000
 	}
 
-	result.Nodes = s.Node.NodeNet.GetNodesToExport()
+	hash := payload.StartFrom
 
-	s.Logger.TraceExt.Println("Return transaction on request")
-	for _, tx := range result.TransactionsInPool {
-		s.Logger.TraceExt.Printf("   tx in pool: %x", tx)
+	if len(hash) == 0 {
+		hash, err = s.Node.NodeBC.GetTopBlockHash()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	result := nodeclient.ResponseGetBlockHeaders{}
+
+	for len(result.Headers) < payload.MaxCount && len(hash) > 0 {
+		block, err := s.Node.NodeBC.GetBlock(hash)
+
+		if err != nil {
+			return err
+		}
+
+		header, err := s.getBlockHeader(block)
+
+		if err != nil {
+			return err
+		}
+
+		result.Headers = append(result.Headers, header)
+
+		hash = block.PrevBlockHash
 	}
 
-	s.Response, err = net.GobEncode(result)
+	s.Response, err = s.encodeResponse(result)
 
 	if err != nil {
 		return err
 	}
 
-	s.Logger.TraceExt.Printf("Return first %d blocks\n", len(blocks))
+	s.Logger.Trace.Printf("Return %d block headers\n", len(result.Headers))
 	return nil
 }
 
-/*
-* Process version command. Other node sends own address and index of top block.
-* This node checks if index is bogger then request for a rest of blocks. If index is less
-* then sends own version command and that node will request for blocks
- */
-func (s *NodeServerRequest) handleVersion() error {
-	var payload nodeclient.ComVersion
+// Returns Merkle proof for a transaction and header of a block where it is included
+func (s *NodeServerRequest) handleGetTransactionProof() error {
+	s.HasResponse = true
+
+	var payload nodeclient.ComGetTransactionProof
 
 	err := s.parseRequestData(&payload)
 
@@ -944,23 +1105,664 @@ func (s *NodeServerRequest) handleVersion() error {
 		return err
 	}
 
-	topHash, myBestHeight, err := s.Node.NodeBC.GetBCManager().GetState()
+	blockHash, err := s.Node.GetTransactionsManager().GetTransactionBlock(payload.TransactionID)
 
 	if err != nil {
 		return err
 	}
 
-	if payload.AddrFrom.Host == "localhost" {
-		payload.AddrFrom.Host = s.RequestIP
+	block, err := s.Node.NodeBC.GetBlock(blockHash)
+
+	if err != nil {
+		return err
 	}
 
-	s.Logger.Trace.Printf("Received version from %s. Their heigh %d, our heigh %d\n",
-		payload.AddrFrom.NodeAddrToString(), payload.BestHeight, myBestHeight)
+	proof, err := block.GetTransactionProof(payload.TransactionID)
 
-	foreignerBestHeight := payload.BestHeight
+	if err != nil {
+		return err
+	}
 
-	if myBestHeight < foreignerBestHeight {
-		s.Logger.Trace.Printf("Request blocks from %s\n", payload.AddrFrom.NodeAddrToString())
+	result := nodeclient.ResponseGetTransactionProof{}
+
+	result.Header, err = s.getBlockHeader(block)
+
+	if err != nil {
+		return err
+	}
+
+	for _, tx := range block.Transactions {
+		if bytes.Compare(tx.GetID(), payload.TransactionID) == 0 {
+			result.Transaction, err = structures.SerializeTransaction(&tx)
+
+			if err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	result.Proof = proof.Hashes
+	result.ProofLeft = proof.Left
+
+	s.Response, err = s.encodeResponse(result)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Returns a record of the names registry. Found is false if a name is not registered
+func (s *NodeServerRequest) handleGetName() error {
+	s.HasResponse = true
+
+	var payload nodeclient.ComGetName
+
+	err := s.parseRequestData(&payload)
+
+	if err != nil {
+		return err
+	}
+
+	namesManager := consensus.NewNamesManager(s.Node.DBConn.DB(), s.Logger)
+
+	var record *consensus.NameRecord
+
+	if payload.Name != "" {
+		record, err = namesManager.GetByName(payload.Name)
+	} else {
+		record, err = namesManager.GetByAddress(payload.Address)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	result := nodeclient.ResponseGetName{}
+
+	if record != nil {
+		result.Found = true
+		result.Name = record.Name
+		result.PubKey = record.PubKey
+		result.Address = record.Address
+	}
+
+	s.Response, err = s.encodeResponse(result)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Returns checksums of a table rows. Used by other nodes to find rows different from this node
+func (s *NodeServerRequest) handleGetChecksums() error {
+	s.HasResponse = true
+
+	var payload nodeclient.ComGetChecksums
+
+	err := s.parseRequestData(&payload)
+
+	if err != nil {
+		return err
+	}
+
+	// every request reads all rows of a table
+	if !s.S.peers.IsWhitelisted(s.RequestIP) && !s.S.checksumsLimiter.Allow(s.RequestIP) {
+		return net.NewRemoteError(net.ErrorCodeTooManyRequest, "Too many checksums requests")
+	}
+
+	if len(payload.Exclude) > nodemanager.RowsChecksumsMaxExclude {
+		return net.NewRemoteError(net.ErrorCodeBadRequest, "Too many excluded keys")
+	}
+
+	tables, err := s.Node.GetManagedTables()
+
+	if err != nil {
+		return err
+	}
+
+	if !utils.StringInSlice(payload.Table, tables) {
+		return net.NewRemoteError(net.ErrorCodeNotFound, "Table is not found")
+	}
+
+	result := nodeclient.ResponseGetChecksums{}
+
+	result.TopHash, err = s.Node.NodeBC.GetTopBlockHash()
+
+	if err != nil {
+		return err
+	}
+
+	result.Exclude, err = s.Node.GetPoolRowsKeys(payload.Table)
+
+	if err != nil {
+		return err
+	}
+
+	exclude := append(result.Exclude, payload.Exclude...)
+
+	if payload.Group < 0 {
+		result.Groups, err = s.Node.GetTableChecksums(payload.Table, exclude)
+	} else {
+		result.Rows, err = s.Node.GetTableGroupRowsChecksums(payload.Table, payload.Group, exclude)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	s.Response, err = s.encodeResponse(result)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Returns a large value of a column from the storage of this node
+func (s *NodeServerRequest) handleGetBlob() error {
+	s.HasResponse = true
+
+	var payload nodeclient.ComGetBlob
+
+	err := s.parseRequestData(&payload)
+
+	if err != nil {
+		return err
+	}
+
+	result := nodeclient.ResponseGetBlob{}
+
+	result.Data, err = s.Node.GetBlob(payload.Hash)
+
+	if err != nil {
+		return err
+	}
+
+	if result.Data == nil {
+		return net.NewRemoteError(net.ErrorCodeNotFound, "Value is not found")
+	}
+
+	s.Response, err = s.encodeResponse(result)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Answers a ping of other node
+func (s *NodeServerRequest) handlePing() error {
+	s.HasResponse = true
+
+	var payload nodeclient.ComPing
+
+	err := s.parseRequestData(&payload)
+
+	if err != nil {
+		return err
+	}
+
+	s.Response, err = s.encodeResponse(nodeclient.ResponsePing{Time: time.Now().Unix()})
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Changes enabled logs of the node. Returns new state of logs
+func (s *NodeServerRequest) handleSetLogs() error {
+	if !s.NodeAuthStrIsGood {
+		return net.NewRemoteError(net.ErrorCodeAuthRequired, "Local Network Auth is required")
+	}
+
+	s.HasResponse = true
+
+	var payload nodeclient.ComSetLogs
+
+	err := s.parseRequestData(&payload)
+
+	if err != nil {
+		return err
+	}
+
+	err = s.S.Logger.SetLogs(payload.Logs)
+
+	if err != nil {
+		return net.NewRemoteError(net.ErrorCodeBadRequest, err.Error())
+	}
+
+	s.S.Logger.Trace.Printf("Logs are changed to %s", s.S.Logger.GetState())
+
+	s.Response, err = s.encodeResponse(nodeclient.ResponseSetLogs{State: s.S.Logger.GetState()})
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Returns banned peers of the node
+func (s *NodeServerRequest) handleGetBans() error {
+	if !s.NodeAuthStrIsGood {
+		return net.NewRemoteError(net.ErrorCodeAuthRequired, "Local Network Auth is required")
+	}
+
+	s.HasResponse = true
+
+	var err error
+
+	s.Response, err = s.encodeResponse(nodeclient.ResponseGetBans{Bans: s.S.bans.GetBans()})
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Removes a ban of a peer, or all bans
+func (s *NodeServerRequest) handleClearBans() error {
+	if !s.NodeAuthStrIsGood {
+		return net.NewRemoteError(net.ErrorCodeAuthRequired, "Local Network Auth is required")
+	}
+
+	s.HasResponse = true
+
+	var payload nodeclient.ComClearBans
+
+	err := s.parseRequestData(&payload)
+
+	if err != nil {
+		return err
+	}
+
+	count := s.S.bans.ClearBans(payload.Host)
+
+	s.S.Logger.Trace.Printf("Removed %d bans of %s", count, payload.Host)
+
+	s.Response, err = s.encodeResponse(nodeclient.ResponseClearBans{Count: count})
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Returns settings which can be changed at runtime
+func (s *NodeServerRequest) handleGetSettings() error {
+	if !s.NodeAuthStrIsGood {
+		return net.NewRemoteError(net.ErrorCodeAuthRequired, "Local Network Auth is required")
+	}
+
+	s.HasResponse = true
+
+	var err error
+
+	s.Response, err = s.encodeResponse(nodeclient.ResponseSettings{Settings: s.S.getSettings()})
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Changes settings without restart. Saves them to the config file if it is requested
+func (s *NodeServerRequest) handleSetSettings() error {
+	if !s.NodeAuthStrIsGood {
+		return net.NewRemoteError(net.ErrorCodeAuthRequired, "Local Network Auth is required")
+	}
+
+	s.HasResponse = true
+
+	var payload nodeclient.ComSetSettings
+
+	err := s.parseRequestData(&payload)
+
+	if err != nil {
+		return err
+	}
+
+	err = s.S.applySettings(payload.Settings)
+
+	if err != nil {
+		return err
+	}
+
+	if payload.Save {
+		err = s.S.saveSettings()
+
+		if err != nil {
+			return net.NewRemoteError(net.ErrorCodeInternal, "Settings are not saved: "+err.Error())
+		}
+	}
+
+	s.Response, err = s.encodeResponse(nodeclient.ResponseSettings{Settings: s.S.getSettings()})
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Collects a runtime profile and returns it in pprof format (or go trace format for trace)
+func (s *NodeServerRequest) handleProfile() error {
+	if !s.NodeAuthStrIsGood {
+		return net.NewRemoteError(net.ErrorCodeAuthRequired, "Local Network Auth is required")
+	}
+
+	s.HasResponse = true
+
+	var payload nodeclient.ComProfile
+
+	err := s.parseRequestData(&payload)
+
+	if err != nil {
+		return err
+	}
+
+	s.S.Logger.Trace.Printf("Profile %s requested for %d seconds", payload.Type, payload.Seconds)
+
+	result := nodeclient.ResponseProfile{}
+
+	result.Data, err = makeProfile(payload.Type, payload.Seconds)
+
+	if err != nil {
+		return net.NewRemoteError(net.ErrorCodeBadRequest, err.Error())
+	}
+
+	s.Response, err = s.encodeResponse(result)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Builds block header to return to a client
+func (s *NodeServerRequest) getBlockHeader(block *structures.Block) (nodeclient.ComBlockHeader, error) {
+	header := nodeclient.ComBlockHeader{}
+
+	root, err := block.HashTransactions()
+
+	if err != nil {
+		return header, err
+	}
+
+	header.Timestamp = block.Timestamp
+	header.PrevBlockHash = block.PrevBlockHash
+	header.Hash = block.Hash
+	header.Nonce = block.Nonce
+	header.Height = block.Height
+	header.MerkleRoot = root
+	header.Complexity = consensus.HeaderComplexity(s.Node.ConsensusConfig.Settings)
+
+	return header, nil
+}
+
+/*
+* Response on request to get full body of a block or transaction
+ */
+func (s *NodeServerRequest) handleGetData() error {
+
+	var payload nodeclient.ComGetData
+
+	err := s.parseRequestData(&payload)
+
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Trace.Printf("SessID: %s . Data Requested of type %s, id %x\n", s.SessID, payload.Type, payload.ID)
+
+	if payload.Type == "block" {
+
+		block, err := s.Node.NodeBC.GetBlock([]byte(payload.ID))
+		if err != nil {
+			return err
+		}
+
+		bs, err := block.Serialize()
+
+		if err == nil {
+			s.Node.NodeClient.SendBlock(payload.AddrFrom, bs)
+		}
+
+	}
+
+	if payload.Type == "tx" {
+
+		if txe, err := s.Node.GetTransactionsManager().GetIfUnapprovedExists(payload.ID); err == nil && txe != nil {
+
+			s.Logger.Trace.Printf("Return transaction with ID %x to %s\n", payload.ID, payload.AddrFrom.NodeAddrToString())
+			// exists
+			txser, err := structures.SerializeTransaction(txe)
+
+			if err != nil {
+				return err
+			}
+
+			s.Node.NodeClient.SendTx(payload.AddrFrom, txser)
+
+		}
+	}
+
+	s.Node.CheckAddressKnown(payload.AddrFrom)
+
+	return nil
+}
+
+/*
+* Handle new transaction. Verify it before doing something (verify is done in the NodeTX object)
+* This is transaction received from other node. We expect that other node aready posted it to all other
+* Here we have a choice. Or we also send it to all other or not.
+* For now we don't send it to all other
+ */
+func (s *NodeServerRequest) handleTx() error {
+
+	var payload nodeclient.ComTx
+
+	err := s.parseRequestData(&payload)
+
+	if err != nil {
+		return err
+	}
+
+	txData := payload.Transaction
+	tx, err := structures.DeserializeTransaction(txData)
+
+	if err != nil {
+		return err
+	}
+
+	if s.S.Inventory.IsKnown(inventoryTX, tx.GetID()) {
+		s.Logger.Trace.Printf("Received transaction. It was seen already: %x ", tx.GetID())
+		return nil
+	}
+
+	if txe, err := s.Node.GetTransactionsManager().GetIfExists(tx.GetID()); err == nil && txe != nil {
+		s.Logger.Trace.Printf("Received transaction. It already exists: %x ", tx.GetID())
+		// exists , nothing to do, it was already processed before
+		s.S.Inventory.SetKnown(inventoryTX, tx.GetID())
+		return nil
+	}
+	s.Logger.Trace.Printf("Received transaction. It does not exists: %x ", tx.GetID())
+	// this will also verify a transaction
+	err = s.Node.ReceivedNewTransaction(tx, lib.TXFlagsExecute)
+
+	if err != nil {
+		// it can be requested again, maybe input transactions will be known then
+		s.S.Inventory.Forget(inventoryTX, tx.GetID())
+
+		// if error is because some input transaction is not found, then request it and after it this TX again
+		s.Logger.Trace.Println("Error ", err.Error())
+
+		if err, ok := err.(*transactions.TXVerifyError); ok {
+			s.Logger.Trace.Println("Custom errro of kind ", err.GetKind())
+
+			if err.GetKind() == transactions.TXVerifyErrorNoInput {
+				/*
+					* we will not do somethign in this case. If no base TX that is not yet approved we wil ignore it
+					* previous TX must exist on a node that sent this TX, so, let it complete this work abd build a block
+					* This case is possible if a node was not online when previous TX was created
+					s.Logger.Trace.Printf("Request another 2 TX %x , %x", err.TX, tx.ID)
+					s.Node.NodeClient.SendGetData(payload.AddFrom, "tx", err.TX)
+					time.Sleep(1 * time.Second) // wait to get a chance to return that TX
+					// TODO we need to be able to request more TX in order in single request
+					s.Node.NodeClient.SendGetData(payload.AddFrom, "tx", tx.ID)
+					return nil*/
+
+				// TODO in future we can createsomethign more start here. Like, get TX with all previous TXs that are not approved yet
+			}
+
+		}
+		return err
+	}
+
+	// send this transaction to all other nodes
+	// TODO
+	// maybe we should not send transaction here to all other nodes.
+	// this node should try to make a block first.
+
+	// try to mine new block. don't send the transaction to other nodes after block make attempt
+	s.S.blocksMakerObj.DoNewBlock()
+
+	return nil
+}
+
+// Other node requests for last changes on this server and expects to get response on real time
+func (s *NodeServerRequest) handleGetUpdates() error {
+	s.HasResponse = true
+
+	var payload nodeclient.ComGetUpdates
+
+	err := s.parseRequestData(&payload)
+
+	if err != nil {
+		return err
+	}
+
+	result := nodeclient.ResponseGetUpdates{}
+
+	result.CurrentBlockHeight, err = s.Node.NodeBC.GetBestHeight()
+
+	if err != nil {
+		return err
+	}
+	// load blocks. maximum 50 and created not older 5 minutes since last update check
+	blocks, err := s.Node.NodeBC.GetBCManager().GetBlocksSince(payload.TopBlocks, payload.LastCheckTime-60*5, 50)
+
+	if err != nil {
+		return err
+	}
+
+	s.Logger.TraceExt.Printf("Loaded %d block hashes", len(blocks))
+
+	result.Blocks = [][]byte{}
+
+	for i := len(blocks) - 1; i >= 0; i-- {
+		bdata, _ := blocks[i].Serialize()
+		result.Blocks = append(result.Blocks, bdata)
+	}
+
+	// load transactions from pool only created recently
+	result.CountTransactionsInPool, err = s.Node.GetTransactionsManager().GetUnapprovedCount()
+
+	if err != nil {
+		return err
+	}
+	// NOTE. this shouold not return transactions that are currently under minting.
+	result.TransactionsInPool, err = s.Node.GetTransactionsManager().
+		GetUnapprovedTransactionsFiltered(
+			payload.LastCheckTime-60*30,
+			1000,
+			s.S.blocksMakerObj.GetLockedTransactions()) // list of transactions locked by block maker, skip them
+
+	if err != nil {
+		return err
+	}
+
+	result.Nodes = s.Node.NodeNet.GetNodesToExport()
+
+	s.Logger.TraceExt.Println("Return transaction on request")
+	for _, tx := range result.TransactionsInPool {
+		s.Logger.TraceExt.Printf("   tx in pool: %x", tx)
+	}
+
+	s.Response, err = s.encodeResponse(result)
+
+	if err != nil {
+		return err
+	}
+
+	s.Logger.TraceExt.Printf("Return first %d blocks\n", len(blocks))
+	return nil
+}
+
+/*
+* Process version command. Other node sends own address and index of top block.
+* This node checks if index is bogger then request for a rest of blocks. If index is less
+* then sends own version command and that node will request for blocks
+ */
+func (s *NodeServerRequest) handleVersion() error {
+	var payload nodeclient.ComVersion
+
+	err := s.parseRequestData(&payload)
+
+	if err != nil {
+		return err
+	}
+
+	// it is checked before the host is replaced, the host is signed
+	err = s.checkPeerIdentity(payload.AddrFrom)
+
+	if err != nil {
+		return err
+	}
+
+	if s.S.clockCheckerObj != nil {
+		s.S.clockCheckerObj.AddSample(payload.AddrFrom, payload.Time)
+	}
+
+	topHash, myBestHeight, err := s.Node.NodeBC.GetBCManager().GetState()
+
+	if err != nil {
+		return err
+	}
+
+	if payload.AddrFrom.Host == "localhost" {
+		payload.AddrFrom.Host = s.RequestIP
+	}
+
+	// commands to the node are sent in gob if it doesn't accept the format of this node
+	if s.Node.NodeClient.PeerFormats != nil {
+		s.Node.NodeClient.PeerFormats.Set(payload.AddrFrom, payload.WireFormats)
+	}
+
+	if s.S.WireFormat == net.WireFormatProtobuf && !utils.StringInSlice(net.WireFormatProtobuf, payload.WireFormats) {
+		s.Logger.Trace.Printf("Node %s doesn't accept protobuf, commands are sent to it in gob", payload.AddrFrom.NodeAddrToString())
+	}
+
+	s.Logger.Trace.Printf("Received version from %s. Their heigh %d, our heigh %d\n",
+		payload.AddrFrom.NodeAddrToString(), payload.BestHeight, myBestHeight)
+
+	foreignerBestHeight := payload.BestHeight
+
+	if myBestHeight < foreignerBestHeight {
+		s.Logger.Trace.Printf("Request blocks from %s\n", payload.AddrFrom.NodeAddrToString())
 
 		if foreignerBestHeight > s.S.Transit.MaxKnownHeigh {
 			s.S.Transit.MaxKnownHeigh = foreignerBestHeight
@@ -992,7 +1794,7 @@ func (s *NodeServerRequest) handleGetNodes() error {
 
 	var err error
 
-	s.Response, err = net.GobEncode(&nodes)
+	s.Response, err = s.encodeResponse(&nodes)
 
 	if err != nil {
 		return err
@@ -1003,7 +1805,7 @@ func (s *NodeServerRequest) handleGetNodes() error {
 // Add new node to list of nodes
 func (s *NodeServerRequest) handleAddNode() error {
 	if !s.NodeAuthStrIsGood {
-		return errors.New("Local Network Auth is required")
+		return net.NewRemoteError(net.ErrorCodeAuthRequired, "Local Network Auth is required")
 	}
 
 	s.HasResponse = true
@@ -1017,6 +1819,8 @@ func (s *NodeServerRequest) handleAddNode() error {
 	}
 
 	s.S.Node.AddNodeToKnown(payload.Node, true)
+	// it is kept after restart and is connected again when it is lost
+	s.S.manualNodes.Add(payload.Node)
 
 	s.Response = []byte{}
 
@@ -1026,7 +1830,7 @@ func (s *NodeServerRequest) handleAddNode() error {
 // Remove node from list of nodes
 func (s *NodeServerRequest) handleRemoveNode() error {
 	if !s.NodeAuthStrIsGood {
-		return errors.New("Local Network Auth is required")
+		return net.NewRemoteError(net.ErrorCodeAuthRequired, "Local Network Auth is required")
 	}
 
 	s.HasResponse = true
@@ -1040,6 +1844,7 @@ func (s *NodeServerRequest) handleRemoveNode() error {
 	}
 
 	s.S.Node.NodeNet.RemoveNodeFromKnown(payload.Node)
+	s.S.manualNodes.Remove(payload.Node)
 
 	s.Logger.Trace.Printf("Removed node %s\n", payload.Node.NodeAddrToString())
 	s.Logger.Trace.Println(s.S.Node.NodeNet.Nodes)
@@ -1052,7 +1857,7 @@ func (s *NodeServerRequest) handleRemoveNode() error {
 // Return node state, including pending blocks to load
 func (s *NodeServerRequest) handleGetState() error {
 	if !s.NodeAuthStrIsGood {
-		return errors.New("Local Network Auth is required")
+		return net.NewRemoteError(net.ErrorCodeAuthRequired, "Local Network Auth is required")
 	}
 
 	s.HasResponse = true
@@ -1065,7 +1870,37 @@ func (s *NodeServerRequest) handleGetState() error {
 
 	info.ExpectingBlocksHeight = s.S.Transit.MaxKnownHeigh
 
-	s.Response, err = net.GobEncode(&info)
+	if s.S.Node.NodeClient.Identity != nil {
+		info.Identity = s.S.Node.NodeClient.Identity.ID()
+	}
+
+	if s.S.clockCheckerObj != nil {
+		info.ClockOffset, info.ClockPeers, info.ClockDrift = s.S.clockCheckerObj.GetState()
+	}
+
+	if s.S.binlogMonitorObj != nil {
+		info.BinlogMonitor = true
+		info.OutOfBandChanges = s.S.binlogMonitorObj.GetChangesCount()
+	}
+
+	if s.S.rowsCheckerObj != nil {
+		info.RowsCheck = true
+		info.DifferentRows = s.S.rowsCheckerObj.GetDifferentCount()
+	}
+
+	if s.S.maintenanceObj != nil {
+		info.Maintenance = true
+		info.MaintenanceWindow = s.S.Maintenance.Window
+		info.MaintenanceRuns, info.MaintenanceLast = s.S.maintenanceObj.GetState()
+	}
+
+	if s.S.anchoringObj != nil {
+		info.Anchoring = true
+		info.AnchoringVia = s.S.Anchoring.Adapter
+		info.AnchorsMade, info.AnchorsLast = s.S.anchoringObj.GetState()
+	}
+
+	s.Response, err = s.encodeResponse(&info)
 
 	if err != nil {
 		return err
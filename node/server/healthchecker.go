@@ -0,0 +1,120 @@
+package server
+
+/*
+* Regular check of the DB server. When the server is not available, checks are done with growing delays
+* and blocks are not applied. After the server is back the node pulls missed blocks from other nodes
+ */
+
+import (
+	"time"
+
+	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/database"
+)
+
+// Default seconds between checks
+const defaultHealthCheckInterval = 5
+
+type healthChecker struct {
+	S            *NodeServer
+	logger       *utils.LoggerMan
+	interval     int
+	stopChan     chan bool
+	completeChan chan bool
+	ticker       time.Duration
+	failed       int
+}
+
+func StartHealthChecker(s *NodeServer, interval int) (c *healthChecker) {
+	c = &healthChecker{}
+
+	c.logger = s.Logger
+	c.S = s
+	c.interval = interval
+
+	if c.interval == 0 {
+		c.interval = defaultHealthCheckInterval
+	}
+
+	c.stopChan = make(chan bool)     // to notify routine to stop
+	c.completeChan = make(chan bool) // routine to notify it stopped
+
+	c.ticker = time.Duration(c.interval) * time.Second
+
+	go c.Run()
+
+	return c
+}
+
+// Run function to check the DB server regularly
+func (c *healthChecker) Run() {
+	for {
+		exit := false
+
+		select {
+		case <-c.stopChan:
+			exit = true
+		default:
+		}
+
+		if exit {
+			break
+		}
+
+		if c.ticker > 0 {
+			time.Sleep(1 * time.Second)
+			c.ticker = c.ticker - time.Second
+			continue
+		}
+
+		c.check()
+	}
+	c.logger.Trace.Printf("Health Checker Return routine")
+	c.completeChan <- true
+}
+
+func (c *healthChecker) Stop() error {
+	c.logger.Trace.Println("Stop health checker")
+
+	close(c.stopChan) // notify routine to stop
+
+	// wait when it is stopped
+	<-c.completeChan
+
+	close(c.completeChan)
+
+	c.logger.TraceExt.Println("Health Checker Stopped")
+
+	return nil
+}
+
+func (c *healthChecker) check() {
+	wasAvailable := database.IsServerAvailable()
+
+	err := c.S.Node.DBConn.DB().QM().CheckServerHealth()
+
+	if err != nil {
+		c.failed++
+		c.ticker = database.ReconnectDelay(c.failed)
+
+		if wasAvailable {
+			c.logger.Error.Printf("DB server is not available: %s. Blocks are not applied until it is back", err.Error())
+		}
+		return
+	}
+
+	if !wasAvailable {
+		health := database.GetServerHealth()
+
+		c.logger.Error.Printf("DB server is available again after %d failed checks", c.failed)
+		c.logger.Trace.Printf("Reconnected to DB server, number of reconnects %d", health.Reconnects)
+
+		// get blocks added by other nodes while the server was not available
+		if c.S.changesCheckerObj != nil {
+			c.S.changesCheckerObj.CheckNow()
+		}
+	}
+
+	c.failed = 0
+	c.ticker = time.Duration(c.interval) * time.Second
+}
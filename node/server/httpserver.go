@@ -0,0 +1,40 @@
+package server
+
+/*
+* HTTP servers of a node: REST, GraphQL, JSON-RPC, metrics, profiling and subscriptions. Every one is on own address.
+* A client must send headers in time and an idle connection is closed, so slow clients don't keep connections
+ */
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	httpReadHeaderTimeout = 10 * time.Second
+	httpIdleTimeout       = 120 * time.Second
+)
+
+// Starts HTTP server on the address. It works till it is closed. Name is used in errors
+func (s *NodeServer) startHTTPServer(addr, name string, h http.Handler) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Can not start %s on %s: %s", name, addr, err.Error()))
+	}
+
+	srv := &http.Server{Handler: h, ReadHeaderTimeout: httpReadHeaderTimeout, IdleTimeout: httpIdleTimeout}
+
+	go func() {
+		err := srv.Serve(ln)
+
+		if err != nil && err != http.ErrServerClosed {
+			s.Logger.Error.Printf("%s server error: %s", name, err.Error())
+		}
+	}()
+
+	return srv, nil
+}
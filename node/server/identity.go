@@ -0,0 +1,71 @@
+package server
+
+/*
+* Identity of this node and checks of identities of other nodes. Address of a node is signed by its identity,
+* a node can not send messages from an address known with other identity
+ */
+
+import (
+	"github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/node/config"
+)
+
+// Loads the identity key from the config folder, it is created on first start
+func (s *NodeServer) loadIdentity() error {
+	identity, err := net.LoadNodeIdentity(s.ConfigDir + config.IdentityFileName)
+
+	if err != nil {
+		return err
+	}
+
+	s.Node.NodeClient.SetIdentity(identity)
+	// this node is not added to known nodes by other address
+	s.Node.NodeNet.Identity = identity.PublicKey()
+
+	s.Logger.Trace.Printf("Node identity %s", identity.ID())
+
+	return nil
+}
+
+// Checks the identity of a node which sent the request. It is remembered in the request for later checks
+func (s *NodeServerRequest) checkPeerIdentity(addr net.NodeAddr) error {
+	err := s.S.Node.NodeNet.CheckIdentity(addr)
+
+	if err != nil {
+		s.Logger.Warning.Printf("Request from %s is rejected: %s", addr.NodeAddrToString(), err.Error())
+		return net.NewRemoteError(net.ErrorCodeBadRequest, err.Error())
+	}
+
+	if addr.IsSigned() {
+		id := net.IdentityID(addr.Identity)
+
+		if !s.S.peers.IsWhitelisted(s.RequestIP) && s.S.bans.IsBanned(identityBanKey(id)) {
+			s.Logger.Warning.Printf("Request from %s is rejected: identity %s is banned", addr.NodeAddrToString(), id)
+			return net.NewRemoteError(net.ErrorCodeBadRequest, "Identity is banned")
+		}
+		s.PeerIdentity = id
+	}
+	return nil
+}
+
+// Key of an identity in the ban list, it doesn't look like an IP
+func identityBanKey(id string) string {
+	return "identity:" + id
+}
+
+// Same as checkPeerIdentity and the message must be signed by the identity
+func (s *NodeServerRequest) checkPeerMessage(addr net.NodeAddr, signature []byte, parts [][]byte) error {
+	err := s.checkPeerIdentity(addr)
+
+	if err != nil {
+		return err
+	}
+
+	err = addr.VerifyMessage(signature, parts...)
+
+	if err != nil {
+		s.Logger.Warning.Printf("Request from %s is rejected: %s", addr.NodeAddrToString(), err.Error())
+		return net.NewRemoteError(net.ErrorCodeBadRequest, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package server
+
+/*
+* Recently seen blocks and transactions. Many nodes announce same inventory, a node remembers hashes which it has
+* or requested already, so same data is not requested from every node and not verified again.
+* Oldest hashes are removed when the cache is full
+ */
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	inventoryCacheSize = 50000
+	// a hash requested from one node can be requested from other node after this time
+	inventoryRequestTimeout = 30 * time.Second
+
+	inventoryBlock = "block"
+	inventoryTX    = "tx"
+)
+
+type inventoryEntry struct {
+	key   string
+	known bool
+	// when it was requested. Not used for known entries
+	requested time.Time
+}
+
+type inventoryCache struct {
+	lock  sync.Mutex
+	size  int
+	items map[string]*list.Element
+	order *list.List
+	// announcements which were not requested because of the cache
+	duplicates int64
+}
+
+func (c *inventoryCache) Init(size int) {
+	c.size = size
+	c.items = map[string]*list.Element{}
+	c.order = list.New()
+}
+
+// Returns true if data must be requested. Then it is not requested from other nodes for some time
+func (c *inventoryCache) StartRequest(kind string, hash []byte) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if e, ok := c.items[kind+string(hash)]; ok {
+		entry := e.Value.(*inventoryEntry)
+
+		if entry.known || time.Since(entry.requested) < inventoryRequestTimeout {
+			c.order.MoveToFront(e)
+			c.duplicates++
+			return false
+		}
+		entry.requested = time.Now()
+		c.order.MoveToFront(e)
+		return true
+	}
+
+	c.add(&inventoryEntry{key: kind + string(hash), requested: time.Now()})
+
+	return true
+}
+
+// Data is in this node, it is not requested or verified again
+func (c *inventoryCache) SetKnown(kind string, hash []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if e, ok := c.items[kind+string(hash)]; ok {
+		e.Value.(*inventoryEntry).known = true
+		c.order.MoveToFront(e)
+		return
+	}
+	c.add(&inventoryEntry{key: kind + string(hash), known: true})
+}
+
+func (c *inventoryCache) IsKnown(kind string, hash []byte) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	e, ok := c.items[kind+string(hash)]
+
+	if !ok || !e.Value.(*inventoryEntry).known {
+		return false
+	}
+	c.duplicates++
+
+	return true
+}
+
+// Data was not accepted, it can be requested again from any node
+func (c *inventoryCache) Forget(kind string, hash []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if e, ok := c.items[kind+string(hash)]; ok {
+		c.order.Remove(e)
+		delete(c.items, kind+string(hash))
+	}
+}
+
+func (c *inventoryCache) GetDuplicates() int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.duplicates
+}
+
+// Must be called with the lock
+func (c *inventoryCache) add(entry *inventoryEntry) {
+	c.items[entry.key] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*inventoryEntry).key)
+	}
+}
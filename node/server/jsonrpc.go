@@ -0,0 +1,389 @@
+package server
+
+/*
+* JSON-RPC 2.0 interface of a node: state, blocks, transactions and management of nodes, for tools in any language.
+* Methods which read chain data are public by default, other methods need a user from config
+ */
+
+import (
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gelembjuk/oursql/lib/jsonrpc"
+	netlib "github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/nodemanager"
+	"github.com/gelembjuk/oursql/node/structures"
+)
+
+// Methods which can be called without auth if other list is not set in config
+var jsonRPCPublicMethods = []string{
+	"getblockcount",
+	"getbestblockhash",
+	"getblock",
+	"gettransaction",
+	"getpendingtransactions",
+	"getbalance",
+	"getnodes",
+}
+
+type jsonRPCMethod func(node *nodemanager.Node, params jsonrpc.Params) (interface{}, error)
+
+// Starts HTTP server with JSON-RPC. It works till the node server stops
+func (s *NodeServer) startJSONRPC() error {
+	if s.JSONRPC.Address == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", jsonrpc.Handler(s.handleJSONRPC))
+
+	var err error
+
+	s.jsonRPCServer, err = s.startHTTPServer(s.JSONRPC.Address, "JSON-RPC", mux)
+
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Trace.Printf("JSON-RPC is on http://%s/", s.JSONRPC.Address)
+
+	return nil
+}
+
+func (s *NodeServer) stopJSONRPC() {
+	if s.jsonRPCServer == nil {
+		return
+	}
+	s.jsonRPCServer.Close()
+	s.jsonRPCServer = nil
+}
+
+func (s *NodeServer) jsonRPCMethods() map[string]jsonRPCMethod {
+	return map[string]jsonRPCMethod{
+		"getblockcount":          s.rpcGetBlockCount,
+		"getbestblockhash":       s.rpcGetBestBlockHash,
+		"getblock":               s.rpcGetBlock,
+		"gettransaction":         s.rpcGetTransaction,
+		"getpendingtransactions": s.rpcGetPendingTransactions,
+		"getbalance":             s.rpcGetBalance,
+		"getnodes":               s.rpcGetNodes,
+		"getstate":               s.rpcGetState,
+		"addnode":                s.rpcAddNode,
+		"removenode":             s.rpcRemoveNode,
+		"setlogs":                s.rpcSetLogs,
+	}
+}
+
+func (s *NodeServer) handleJSONRPC(r *http.Request, method string, params jsonrpc.Params) (interface{}, error) {
+	handler, ok := s.jsonRPCMethods()[method]
+
+	if !ok {
+		return nil, jsonrpc.NewError(jsonrpc.CodeMethodNotFound, "Method not found: "+method)
+	}
+
+	err := s.JSONRPC.Authorize(r, method, jsonRPCPublicMethods)
+
+	if err != nil {
+		s.Logger.Trace.Printf("JSON-RPC %s is not allowed for %s: %s", method, r.RemoteAddr, err.Error())
+		return nil, err
+	}
+
+	node := s.Node.Clone()
+	node.SessionID = utils.RandString(5)
+
+	err = node.DBConn.OpenConnection(node.SessionID)
+
+	if err != nil {
+		return nil, jsonRPCError(netlib.NewRemoteError(netlib.ErrorCodeDatabase, "Blockchain open Error: "+err.Error()))
+	}
+	defer node.DBConn.CloseConnection()
+
+	result, err := handler(node, params)
+
+	if err != nil {
+		return nil, jsonRPCError(err)
+	}
+	return result, nil
+}
+
+// Errors of a node have a code and a category in data
+func jsonRPCError(err error) error {
+	if _, ok := err.(*jsonrpc.Error); ok {
+		return err
+	}
+
+	rerr := netlib.MakeRemoteError(err)
+
+	return &jsonrpc.Error{
+		Code:    jsonrpc.CodeServerError,
+		Message: rerr.Message,
+		Data:    map[string]interface{}{"code": rerr.Code, "category": rerr.Category, "retryable": rerr.Retryable}}
+}
+
+func jsonRPCHexParam(params jsonrpc.Params, name string, pos int) ([]byte, bool, error) {
+	value := ""
+
+	ok, err := params.Get(name, pos, &value)
+
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+
+	data, err := hex.DecodeString(value)
+
+	if err != nil {
+		return nil, true, jsonrpc.NewError(jsonrpc.CodeInvalidParams, "Param "+name+" must be in hex")
+	}
+	return data, true, nil
+}
+
+func jsonRPCAddressParam(params jsonrpc.Params) (netlib.NodeAddr, error) {
+	address := ""
+	addr := netlib.NodeAddr{}
+
+	err := params.Require("address", 0, &address)
+
+	if err != nil {
+		return addr, err
+	}
+
+	if addr.LoadFromString(address) != nil {
+		return addr, jsonrpc.NewError(jsonrpc.CodeInvalidParams, "Wrong address of a node "+address)
+	}
+	return addr, nil
+}
+
+func (s *NodeServer) rpcGetBlockCount(node *nodemanager.Node, params jsonrpc.Params) (interface{}, error) {
+	height, err := node.NodeBC.GetBestHeight()
+
+	if err != nil {
+		return nil, err
+	}
+	return height + 1, nil
+}
+
+func (s *NodeServer) rpcGetBestBlockHash(node *nodemanager.Node, params jsonrpc.Params) (interface{}, error) {
+	hash, err := node.NodeBC.GetTopBlockHash()
+
+	if err != nil {
+		return nil, err
+	}
+	return hex.EncodeToString(hash), nil
+}
+
+// Block by hash or height. Null if it is not found
+func (s *NodeServer) rpcGetBlock(node *nodemanager.Node, params jsonrpc.Params) (interface{}, error) {
+	hash, ok, err := jsonRPCHexParam(params, "hash", 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var block *structures.Block
+
+	if ok {
+		exists, err := node.NodeBC.CheckBlockExists(hash)
+
+		if err != nil || !exists {
+			return nil, err
+		}
+
+		block, err = node.NodeBC.GetBlock(hash)
+
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		height := 0
+
+		err = params.Require("height", 1, &height)
+
+		if err != nil {
+			return nil, jsonrpc.NewError(jsonrpc.CodeInvalidParams, "Hash or height of a block is required")
+		}
+
+		block, err = node.NodeBC.GetBCManager().GetBlockAtHeight(height)
+
+		if err != nil || block == nil {
+			return nil, err
+		}
+	}
+
+	ids := []string{}
+
+	for _, tx := range block.Transactions {
+		ids = append(ids, hex.EncodeToString(tx.GetID()))
+	}
+
+	return map[string]interface{}{
+		"hash":         hex.EncodeToString(block.Hash),
+		"height":       block.Height,
+		"prevHash":     hex.EncodeToString(block.PrevBlockHash),
+		"timestamp":    block.Timestamp,
+		"nonce":        block.Nonce,
+		"transactions": ids,
+	}, nil
+}
+
+// Transaction from blocks or the pool. Null if it is not found
+func (s *NodeServer) rpcGetTransaction(node *nodemanager.Node, params jsonrpc.Params) (interface{}, error) {
+	txID, ok, err := jsonRPCHexParam(params, "id", 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, jsonrpc.NewError(jsonrpc.CodeInvalidParams, "Param id is required")
+	}
+
+	tx, err := node.GetTransactionsManager().GetIfExists(txID)
+
+	if err != nil || tx == nil {
+		return nil, err
+	}
+
+	txType := "currency"
+
+	if tx.IsCoinbaseTransfer() {
+		txType = "coinbase"
+	} else if tx.IsSQLCommand() {
+		txType = "sql"
+	}
+
+	signer := ""
+
+	if len(tx.ByPubKey) > 0 {
+		signer, _ = utils.PubKeyToAddres(tx.ByPubKey)
+	}
+
+	inputs := []map[string]interface{}{}
+
+	for _, in := range tx.Vin {
+		inputs = append(inputs, map[string]interface{}{"txId": hex.EncodeToString(in.Txid), "output": in.Vout})
+	}
+
+	outputs := []map[string]interface{}{}
+
+	for _, out := range tx.Vout {
+		address, _ := utils.PubKeyHashToAddres(out.PubKeyHash)
+
+		outputs = append(outputs, map[string]interface{}{"value": out.Value, "address": address})
+	}
+
+	blockHash := ""
+
+	if hash, err := node.GetTransactionsManager().GetTransactionBlock(tx.GetID()); err == nil {
+		blockHash = hex.EncodeToString(hash)
+	}
+
+	return map[string]interface{}{
+		"id":            hex.EncodeToString(tx.GetID()),
+		"time":          tx.Time,
+		"type":          txType,
+		"signer":        signer,
+		"query":         string(tx.SQLCommand.Query),
+		"rollbackQuery": string(tx.SQLCommand.RollbackQuery),
+		"referenceId":   string(tx.SQLCommand.ReferenceID),
+		"baseTxId":      hex.EncodeToString(tx.GetSQLBaseTX()),
+		"inputs":        inputs,
+		"outputs":       outputs,
+		// empty for transactions in the pool
+		"blockHash": blockHash,
+	}, nil
+}
+
+// IDs of transactions in the pool
+func (s *NodeServer) rpcGetPendingTransactions(node *nodemanager.Node, params jsonrpc.Params) (interface{}, error) {
+	ids := []string{}
+
+	_, err := node.GetTransactionsManager().ForEachUnapprovedTransaction(func(txhash, txstr string) error {
+		ids = append(ids, txhash)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (s *NodeServer) rpcGetBalance(node *nodemanager.Node, params jsonrpc.Params) (interface{}, error) {
+	address := ""
+
+	err := params.Require("address", 0, &address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := node.GetTransactionsManager().GetAddressBalance(address)
+
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"total": balance.Total, "approved": balance.Approved, "pending": balance.Pending}, nil
+}
+
+func (s *NodeServer) rpcGetNodes(node *nodemanager.Node, params jsonrpc.Params) (interface{}, error) {
+	nodes := []string{}
+
+	for _, addr := range node.NodeNet.GetNodes() {
+		nodes = append(nodes, addr.NodeAddrToString())
+	}
+	return nodes, nil
+}
+
+func (s *NodeServer) rpcGetState(node *nodemanager.Node, params jsonrpc.Params) (interface{}, error) {
+	return node.GetNodeState()
+}
+
+func (s *NodeServer) rpcAddNode(node *nodemanager.Node, params jsonrpc.Params) (interface{}, error) {
+	addr, err := jsonRPCAddressParam(params)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.Node.AddNodeToKnown(addr, true)
+	s.manualNodes.Add(addr)
+
+	return true, nil
+}
+
+func (s *NodeServer) rpcRemoveNode(node *nodemanager.Node, params jsonrpc.Params) (interface{}, error) {
+	addr, err := jsonRPCAddressParam(params)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.Node.NodeNet.RemoveNodeFromKnown(addr)
+	s.manualNodes.Remove(addr)
+
+	s.Logger.Trace.Printf("Removed node %s\n", addr.NodeAddrToString())
+
+	return true, nil
+}
+
+// Changes enabled logs, like "trace,traceext". Returns new state of logs
+func (s *NodeServer) rpcSetLogs(node *nodemanager.Node, params jsonrpc.Params) (interface{}, error) {
+	logs := ""
+
+	err := params.Require("logs", 0, &logs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.Logger.SetLogs(logs)
+
+	if err != nil {
+		return nil, jsonrpc.NewError(jsonrpc.CodeInvalidParams, err.Error())
+	}
+
+	s.Logger.Trace.Printf("Logs are changed to %s", s.Logger.GetState())
+
+	return s.Logger.GetState(), nil
+}
@@ -0,0 +1,182 @@
+package server
+
+/*
+* Regular ping of known nodes. A node which doesn't answer some pings in a row is stale, it is used for sync
+* only when there are no other nodes. A stale node is pinged further and it is not stale after it answers.
+* Without this a dead node is found only when a request to it fails. A stale node which was not seen long time
+* is removed from known nodes
+ */
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/utils"
+)
+
+// Default seconds between pings, pings a node can miss before it is stale, seconds a stale node is kept
+// and number of nodes which are not removed
+const (
+	defaultKeepaliveInterval    = 60
+	defaultKeepaliveMissedPings = 3
+	defaultKeepaliveNodeMaxAge  = 7 * 24 * 3600
+	defaultKeepaliveMinNodes    = 8
+)
+
+// Options of pings of nodes. Interval -1 means off
+type KeepaliveOptions struct {
+	Interval    int // seconds between pings of a node
+	MissedPings int // pings in a row a node can miss before it is stale
+	NodeMaxAge  int // seconds a stale node is kept since it was seen last time. -1 means forever
+	MinNodes    int // so many nodes are kept even if they are stale long time
+}
+
+type keepaliveRunner struct {
+	S            *NodeServer
+	logger       *utils.LoggerMan
+	options      KeepaliveOptions
+	stopChan     chan bool
+	completeChan chan bool
+	ticker       time.Duration
+}
+
+func StartKeepalive(s *NodeServer, options KeepaliveOptions) (c *keepaliveRunner) {
+	c = &keepaliveRunner{}
+
+	c.logger = s.Logger
+	c.S = s
+
+	if options.Interval == 0 {
+		options.Interval = defaultKeepaliveInterval
+	}
+
+	if options.MissedPings < 1 {
+		options.MissedPings = defaultKeepaliveMissedPings
+	}
+
+	if options.NodeMaxAge == 0 {
+		options.NodeMaxAge = defaultKeepaliveNodeMaxAge
+	}
+
+	if options.MinNodes < 1 {
+		options.MinNodes = defaultKeepaliveMinNodes
+	}
+
+	c.options = options
+
+	c.stopChan = make(chan bool)     // to notify routine to stop
+	c.completeChan = make(chan bool) // routine to notify it stopped
+
+	c.ticker = time.Duration(c.options.Interval) * time.Second
+
+	go c.Run()
+
+	return c
+}
+
+// Run function to ping nodes regularly
+func (c *keepaliveRunner) Run() {
+	for {
+		exit := false
+
+		select {
+		case <-c.stopChan:
+			exit = true
+		default:
+		}
+
+		if exit {
+			break
+		}
+
+		if c.ticker > 0 {
+			time.Sleep(1 * time.Second)
+			c.ticker = c.ticker - time.Second
+			continue
+		}
+
+		c.pingNodes()
+		c.ageOutNodes()
+
+		c.ticker = time.Duration(c.options.Interval) * time.Second
+	}
+	c.logger.Trace.Printf("Keepalive Return routine")
+	c.completeChan <- true
+}
+
+func (c *keepaliveRunner) Stop() error {
+	c.logger.Trace.Println("Stop keepalive")
+
+	close(c.stopChan) // notify routine to stop
+
+	// wait when it is stopped
+	<-c.completeChan
+
+	close(c.completeChan)
+
+	c.logger.TraceExt.Println("Keepalive Stopped")
+
+	return nil
+}
+
+// Pings all known nodes at same time and waits all answers
+func (c *keepaliveRunner) pingNodes() {
+	nodes := c.S.Node.NodeNet.GetNodes()
+
+	var wg sync.WaitGroup
+
+	for _, node := range nodes {
+		if node.CompareToAddress(c.S.Node.NodeClient.NodeAddress) {
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(node net.NodeAddr) {
+			defer wg.Done()
+
+			c.pingNode(node)
+		}(node)
+	}
+
+	wg.Wait()
+}
+
+func (c *keepaliveRunner) pingNode(node net.NodeAddr) {
+	// a trace can not be used from many goroutines
+	client := *c.S.Node.NodeClient
+	client.Trace = nil
+
+	rtt, err := client.SendPing(node)
+
+	if _, ok := err.(*net.RemoteError); ok {
+		// older node doesn't know the command, but it answered
+		err = nil
+	}
+
+	if err != nil {
+		if c.S.Node.NodeNet.ReportMissedPing(node, c.options.MissedPings) {
+			c.logger.Trace.Printf("Node %s is stale, it didn't answer %d pings: %s",
+				node.NodeAddrToString(), c.options.MissedPings, err.Error())
+		}
+		return
+	}
+
+	if c.S.Node.NodeNet.ReportAnsweredPing(node) {
+		c.logger.Trace.Printf("Node %s is alive again", node.NodeAddrToString())
+	}
+	c.logger.TraceExt.Printf("Ping of %s %s", node.NodeAddrToString(), rtt)
+}
+
+// Removes nodes which are stale long time and saves state of others
+func (c *keepaliveRunner) ageOutNodes() {
+	if c.options.NodeMaxAge > 0 {
+		for _, node := range c.S.Node.NodeNet.AgeOutNodes(int64(c.options.NodeMaxAge), c.options.MinNodes) {
+			c.logger.Trace.Printf("Node %s is removed, it was not seen since %s", node.NodeAddrToString(),
+				time.Unix(node.LastSeen, 0).Format(time.RFC3339))
+		}
+	}
+
+	c.S.Node.NodeNet.SaveNodes()
+}
@@ -0,0 +1,134 @@
+package server
+
+/*
+* Discovery of nodes in a local network with UDP broadcast. The node announces its port regularly and adds
+* nodes of same network which it hears to known nodes. The name of a network is the name of the application
+* in the consensus config if it is not set
+ */
+
+import (
+	"time"
+
+	"github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/utils"
+)
+
+type lanDiscoveryRunner struct {
+	S            *NodeServer
+	logger       *utils.LoggerMan
+	discovery    *net.LANDiscovery
+	stopChan     chan bool
+	completeChan chan bool
+	receiveChan  chan bool
+	ticker       time.Duration
+}
+
+// Starts announcing and listening. Returns nil if the UDP port can not be used, the node works without it
+func StartLANDiscovery(s *NodeServer, config net.LANDiscoveryConfig) (c *lanDiscoveryRunner) {
+	if config.Network == "" && s.Node.ConsensusConfig != nil {
+		config.Network = s.Node.ConsensusConfig.Application.Name
+	}
+
+	// nodes of the local network connect to the local port, not to a port mapped on a router
+	discovery, err := net.ListenLAN(config, s.NodePort)
+
+	if err != nil {
+		s.Logger.Error.Printf("LAN discovery is not started: %s", err.Error())
+		return nil
+	}
+
+	s.Logger.Trace.Printf("LAN discovery of network %s is started", config.Network)
+
+	c = &lanDiscoveryRunner{}
+
+	c.logger = s.Logger
+	c.S = s
+	c.discovery = discovery
+
+	c.stopChan = make(chan bool)     // to notify routine to stop
+	c.completeChan = make(chan bool) // routine to notify it stopped
+	c.receiveChan = make(chan bool)
+
+	go c.Run()
+	go c.receive()
+
+	return c
+}
+
+// Run function to announce the node regularly
+func (c *lanDiscoveryRunner) Run() {
+	for {
+		exit := false
+
+		select {
+		case <-c.stopChan:
+			exit = true
+		default:
+		}
+
+		if exit {
+			break
+		}
+
+		if c.ticker > 0 {
+			time.Sleep(1 * time.Second)
+			c.ticker = c.ticker - time.Second
+			continue
+		}
+
+		err := c.discovery.Announce()
+
+		if err != nil {
+			c.logger.TraceExt.Printf("LAN announcement is not sent: %s", err.Error())
+		}
+
+		c.ticker = time.Duration(c.discovery.Interval) * time.Second
+	}
+	c.logger.Trace.Printf("LAN discovery Return routine")
+	c.completeChan <- true
+}
+
+func (c *lanDiscoveryRunner) Stop() error {
+	c.logger.Trace.Println("Stop LAN discovery")
+
+	close(c.stopChan) // notify routine to stop
+
+	// wait when it is stopped
+	<-c.completeChan
+
+	close(c.completeChan)
+
+	// receiving stops when the port is closed
+	c.discovery.Close()
+	<-c.receiveChan
+
+	c.logger.TraceExt.Println("LAN discovery Stopped")
+
+	return nil
+}
+
+// Adds nodes which announced themselves. Works till the port is closed
+func (c *lanDiscoveryRunner) receive() {
+	for {
+		addr, err := c.discovery.Receive()
+
+		if err != nil {
+			break
+		}
+
+		if c.S.peers.IsBlacklisted(addr.Host) || c.S.Node.NodeNet.CheckIsKnown(addr) {
+			continue
+		}
+
+		c.logger.Trace.Printf("Node %s is found in the local network", addr.NodeAddrToString())
+
+		c.S.Node.NodeNet.AddNodeToKnown(addr)
+
+		n := c.S.Node.Clone()
+
+		n.SendVersionToNodes([]net.NodeAddr{addr})
+
+		n.DBConn.CloseConnection()
+	}
+	close(c.receiveChan)
+}
@@ -0,0 +1,60 @@
+package server
+
+/*
+* Commands from clients on same machine by a unix socket. Access is controlled by permissions of the socket file,
+* so requests by the socket are trusted same as requests with the auth string of the node
+ */
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	netlib "github.com/gelembjuk/oursql/lib/net"
+)
+
+// Starts accepting connections on the local socket. It works till the node server stops
+func (s *NodeServer) startLocalSocket() error {
+	if s.LocalSocket == "" {
+		return nil
+	}
+
+	mode, err := netlib.ParseLocalSocketMode(s.LocalSocketMode)
+
+	if err != nil {
+		return err
+	}
+
+	ln, err := netlib.ListenLocal(s.LocalSocket, mode)
+
+	if err != nil {
+		return errors.New(fmt.Sprintf("Can not listen socket %s: %s", s.LocalSocket, err.Error()))
+	}
+
+	s.localListener = ln
+
+	go func(ln net.Listener) {
+		for {
+			conn, err := ln.Accept()
+
+			if err != nil {
+				// listener is closed
+				return
+			}
+			go s.handleConnection(netlib.WrapConn(conn), true)
+		}
+	}(ln)
+
+	s.Logger.Trace.Printf("Start listening local connections on %s", s.LocalSocket)
+
+	return nil
+}
+
+func (s *NodeServer) stopLocalSocket() {
+	if s.localListener == nil {
+		return
+	}
+	// socket file is removed on close
+	s.localListener.Close()
+	s.localListener = nil
+}
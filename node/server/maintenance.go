@@ -0,0 +1,225 @@
+package server
+
+/*
+* Regular maintenance of managed tables (ANALYZE, OPTIMIZE). It runs only in a window of low traffic.
+* It is local work of this node, queries are not sent as transactions and not written to the binary log
+ */
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/database"
+)
+
+// Default hours between maintenance of same table
+const defaultMaintenanceInterval = 24
+
+// Options of maintenance. Empty window means the maintenance is off
+type MaintenanceOptions struct {
+	Window    string            // local time, like 02:00-05:00
+	Interval  int               // hours between runs for a table
+	Operation string            // analyze (default), optimize or none
+	Tables    map[string]string // operation per table
+}
+
+type maintenanceRunner struct {
+	S            *NodeServer
+	logger       *utils.LoggerMan
+	options      MaintenanceOptions
+	windowStart  int // minutes from midnight
+	windowEnd    int
+	stopChan     chan bool
+	completeChan chan bool
+	ticker       int
+	lastRun      map[string]time.Time
+	lock         sync.Mutex
+	runs         int64
+	last         string
+}
+
+// Parses a window like 02:00-05:00 to minutes from midnight. End can be less than start, the window goes over midnight
+func parseMaintenanceWindow(window string) (int, int, error) {
+	var sh, sm, eh, em int
+
+	n, err := fmt.Sscanf(window, "%d:%d-%d:%d", &sh, &sm, &eh, &em)
+
+	if err != nil || n != 4 || sh > 23 || eh > 23 || sm > 59 || em > 59 || sh < 0 || eh < 0 || sm < 0 || em < 0 {
+		return 0, 0, errors.New(fmt.Sprintf("Wrong maintenance window %s. Expected format is HH:MM-HH:MM", window))
+	}
+	return sh*60 + sm, eh*60 + em, nil
+}
+
+func StartMaintenance(s *NodeServer, options MaintenanceOptions) (*maintenanceRunner, error) {
+	c := &maintenanceRunner{}
+
+	var err error
+
+	c.windowStart, c.windowEnd, err = parseMaintenanceWindow(options.Window)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Interval < 1 {
+		options.Interval = defaultMaintenanceInterval
+	}
+
+	if options.Operation == "" {
+		options.Operation = database.MaintenanceAnalyze
+	}
+
+	for table, operation := range options.Tables {
+		if !isMaintenanceOperation(operation) {
+			return nil, errors.New(fmt.Sprintf("Unknown maintenance operation %s for table %s", operation, table))
+		}
+	}
+
+	if !isMaintenanceOperation(options.Operation) {
+		return nil, errors.New(fmt.Sprintf("Unknown maintenance operation %s", options.Operation))
+	}
+
+	c.logger = s.Logger
+	c.S = s
+	c.options = options
+	c.lastRun = map[string]time.Time{}
+
+	c.stopChan = make(chan bool)     // to notify routine to stop
+	c.completeChan = make(chan bool) // routine to notify it stopped
+
+	go c.Run()
+
+	return c, nil
+}
+
+func isMaintenanceOperation(operation string) bool {
+	return operation == database.MaintenanceAnalyze ||
+		operation == database.MaintenanceOptimize ||
+		operation == database.MaintenanceNone
+}
+
+// Run function to check every minute if it is time of maintenance
+func (c *maintenanceRunner) Run() {
+	for {
+		exit := false
+
+		select {
+		case <-c.stopChan:
+			exit = true
+		default:
+		}
+
+		if exit {
+			break
+		}
+
+		if c.ticker > 0 {
+			time.Sleep(1 * time.Second)
+			c.ticker = c.ticker - 1
+			continue
+		}
+
+		err := c.maintain()
+
+		if err != nil {
+			c.logger.Error.Printf("Maintenance error: %s", err.Error())
+		}
+
+		c.ticker = 60
+	}
+	c.logger.Trace.Printf("Maintenance Return routine")
+	c.completeChan <- true
+}
+
+func (c *maintenanceRunner) Stop() error {
+	c.logger.Trace.Println("Stop maintenance")
+
+	close(c.stopChan) // notify routine to stop
+
+	// wait when it is stopped
+	<-c.completeChan
+
+	close(c.completeChan)
+
+	c.logger.TraceExt.Println("Maintenance Stopped")
+
+	return nil
+}
+
+// Number of done operations and description of the last one
+func (c *maintenanceRunner) GetState() (int64, string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.runs, c.last
+}
+
+func (c *maintenanceRunner) inWindow(now time.Time) bool {
+	minute := now.Hour()*60 + now.Minute()
+
+	if c.windowStart <= c.windowEnd {
+		return minute >= c.windowStart && minute < c.windowEnd
+	}
+	return minute >= c.windowStart || minute < c.windowEnd
+}
+
+func (c *maintenanceRunner) stopped() bool {
+	select {
+	case <-c.stopChan:
+		return true
+	default:
+	}
+	return false
+}
+
+// Runs operations of tables which were not maintained during the interval. Stops when the window ends
+func (c *maintenanceRunner) maintain() error {
+	if !c.inWindow(time.Now()) {
+		return nil
+	}
+
+	tables, err := c.S.Node.GetManagedTables()
+
+	if err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		if c.stopped() || !c.inWindow(time.Now()) {
+			return nil
+		}
+
+		operation := c.options.Operation
+
+		if op, ok := c.options.Tables[table]; ok {
+			operation = op
+		}
+
+		if operation == database.MaintenanceNone {
+			continue
+		}
+
+		if last, ok := c.lastRun[table]; ok && time.Since(last) < time.Duration(c.options.Interval)*time.Hour {
+			continue
+		}
+
+		err = c.S.Node.RunTableMaintenance(table, operation)
+
+		// don't repeat failed table in this window
+		c.lastRun[table] = time.Now()
+
+		if err != nil {
+			c.logger.Error.Printf("Maintenance %s of %s failed: %s", operation, table, err.Error())
+			continue
+		}
+
+		c.lock.Lock()
+		c.runs++
+		c.last = fmt.Sprintf("%s %s at %s", operation, table, time.Now().Format("2006-01-02 15:04"))
+		c.lock.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package server
+
+/*
+* Reconnect of nodes added with addnode. Every such node is pinged, when it doesn't answer next ping is later,
+* up to 10 minutes. When it answers after it was not connected, it is added to known nodes again if it was
+* removed, and it gets the version of this node, so nodes sync
+ */
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/utils"
+)
+
+type manualNodesRunner struct {
+	S            *NodeServer
+	logger       *utils.LoggerMan
+	stopChan     chan bool
+	completeChan chan bool
+}
+
+func StartManualNodes(s *NodeServer) (c *manualNodesRunner) {
+	c = &manualNodesRunner{}
+
+	c.logger = s.Logger
+	c.S = s
+
+	c.stopChan = make(chan bool)     // to notify routine to stop
+	c.completeChan = make(chan bool) // routine to notify it stopped
+
+	go c.Run()
+
+	return c
+}
+
+// Run function to connect manual nodes when it is time
+func (c *manualNodesRunner) Run() {
+	for {
+		exit := false
+
+		select {
+		case <-c.stopChan:
+			exit = true
+		default:
+		}
+
+		if exit {
+			break
+		}
+
+		c.connectNodes()
+
+		time.Sleep(1 * time.Second)
+	}
+	c.logger.Trace.Printf("Manual nodes Return routine")
+	c.completeChan <- true
+}
+
+func (c *manualNodesRunner) Stop() error {
+	c.logger.Trace.Println("Stop manual nodes")
+
+	close(c.stopChan) // notify routine to stop
+
+	// wait when it is stopped
+	<-c.completeChan
+
+	close(c.completeChan)
+
+	c.logger.TraceExt.Println("Manual nodes Stopped")
+
+	return nil
+}
+
+// Connects all nodes which must be connected now at same time and waits all answers
+func (c *manualNodesRunner) connectNodes() {
+	var wg sync.WaitGroup
+
+	for _, node := range c.S.manualNodes.GetDue(time.Now().Unix()) {
+		if node.CompareToAddress(c.S.Node.NodeClient.NodeAddress) {
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(node net.NodeAddr) {
+			defer wg.Done()
+
+			c.connectNode(node)
+		}(node)
+	}
+
+	wg.Wait()
+}
+
+func (c *manualNodesRunner) connectNode(node net.NodeAddr) {
+	// a trace can not be used from many goroutines
+	client := *c.S.Node.NodeClient
+	client.Trace = nil
+
+	_, err := client.SendPing(node)
+
+	if _, ok := err.(*net.RemoteError); ok {
+		// older node doesn't know the command, but it answered
+		err = nil
+	}
+
+	if err != nil {
+		c.S.manualNodes.ReportAttempt(node, false, time.Now().Unix())
+		c.logger.TraceExt.Printf("Manual node %s is not connected: %s", node.NodeAddrToString(), err.Error())
+		return
+	}
+
+	if !c.S.manualNodes.ReportAttempt(node, true, time.Now().Unix()) {
+		return
+	}
+
+	c.logger.Trace.Printf("Manual node %s is connected", node.NodeAddrToString())
+
+	c.S.Node.NodeNet.AddNodeToKnown(node)
+
+	n := c.S.Node.Clone()
+	defer n.DBConn.CloseConnection()
+
+	n.SendVersionToNodes([]net.NodeAddr{node})
+}
@@ -0,0 +1,172 @@
+package server
+
+/*
+* Metrics of a node in Prometheus text format on /metrics: blocks, pending transactions, nodes, lag of sync,
+* transactions rate and requests to other nodes. HTTP server is started on a separate address when it is set
+* in config, there is no auth, it should be a local address
+ */
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gelembjuk/oursql/lib/nodeclient"
+	"github.com/gelembjuk/oursql/node/consensus"
+	"github.com/gelembjuk/oursql/node/database"
+)
+
+// Starts HTTP server with metrics. It works till the node server stops
+func (s *NodeServer) startMetrics() error {
+	if s.MetricsAddr == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", s.handleMetrics)
+
+	var err error
+
+	s.metricsServer, err = s.startHTTPServer(s.MetricsAddr, "metrics", mux)
+
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Trace.Printf("Metrics endpoint is on http://%s/metrics", s.MetricsAddr)
+
+	return nil
+}
+
+func (s *NodeServer) stopMetrics() {
+	if s.metricsServer == nil {
+		return
+	}
+	s.metricsServer.Close()
+	s.metricsServer = nil
+}
+
+func (s *NodeServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	buf := bytes.NewBuffer(nil)
+
+	s.writeMetrics(buf)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// Writes metrics in Prometheus text format
+func (s *NodeServer) writeMetrics(w io.Writer) {
+	metric := func(name, kind, help string, value interface{}) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+	}
+
+	health := database.GetServerHealth()
+
+	if health.Available {
+		metric("oursql_db_available", "gauge", "1 if the database is available", 1)
+
+		node := s.Node.Clone()
+
+		height, err := node.NodeBC.GetBestHeight()
+
+		if err == nil {
+			metric("oursql_block_height", "gauge", "Height of the top block", height)
+
+			lag := s.Transit.MaxKnownHeigh - height
+
+			if lag < 0 {
+				lag = 0
+			}
+			metric("oursql_sync_lag_blocks", "gauge", "Blocks of other nodes which are not loaded yet", lag)
+		}
+
+		pending, err := node.GetTransactionsManager().GetUnapprovedCount()
+
+		if err == nil {
+			metric("oursql_mempool_transactions", "gauge", "Transactions which are not in a block yet", pending)
+		}
+		node.DBConn.CloseConnection()
+	} else {
+		metric("oursql_db_available", "gauge", "1 if the database is available", 0)
+	}
+
+	metric("oursql_peers", "gauge", "Known nodes", len(s.Node.NodeNet.GetNodes()))
+	metric("oursql_peers_stale", "gauge", "Known nodes which don't answer pings", s.Node.NodeNet.GetCountOfStaleNodes())
+
+	total, rate := consensus.GetPoolTransactionsStats()
+
+	metric("oursql_transactions_total", "counter", "Transactions added to the pool", total)
+	metric("oursql_transactions_per_second", "gauge", "Transactions added to the pool per second in the last minute", rate)
+	metric("oursql_inventory_duplicates_total", "counter", "Announcements of blocks and transactions which were seen already", s.Inventory.GetDuplicates())
+
+	writeClientMetrics(w, s.Node.NodeClient.Stats())
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Writes metrics of requests to other nodes by node and command
+func writeClientMetrics(w io.Writer, stats map[string]nodeclient.PeerStats) {
+	peers := []string{}
+
+	for peer := range stats {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+
+	types := [][]string{
+		{"oursql_peer_sent_bytes_total", "counter", "Bytes sent to a node"},
+		{"oursql_peer_received_bytes_total", "counter", "Bytes received from a node"},
+		{"oursql_peer_requests_total", "counter", "Requests to a node by command"},
+		{"oursql_peer_request_errors_total", "counter", "Failed requests to a node by command"},
+		{"oursql_peer_request_duration_seconds", "histogram", "Time of requests to a node by command"},
+	}
+
+	lines := make([][]string, len(types))
+
+	for _, peer := range peers {
+		ps := stats[peer]
+		label := `peer="` + labelEscaper.Replace(peer) + `"`
+
+		lines[0] = append(lines[0], fmt.Sprintf("%s{%s} %d", types[0][0], label, ps.BytesSent))
+		lines[1] = append(lines[1], fmt.Sprintf("%s{%s} %d", types[1][0], label, ps.BytesReceived))
+
+		commands := []string{}
+
+		for command := range ps.Commands {
+			commands = append(commands, command)
+		}
+		sort.Strings(commands)
+
+		for _, command := range commands {
+			cs := ps.Commands[command]
+			labels := label + `,command="` + labelEscaper.Replace(command) + `"`
+
+			lines[2] = append(lines[2], fmt.Sprintf("%s{%s} %d", types[2][0], labels, cs.Requests))
+			lines[3] = append(lines[3], fmt.Sprintf("%s{%s} %d", types[3][0], labels, cs.Errors))
+
+			name := types[4][0]
+			count := int64(0)
+
+			for i, bound := range nodeclient.LatencyBuckets {
+				if i < len(cs.Latency) {
+					count += cs.Latency[i]
+				}
+				lines[4] = append(lines[4], fmt.Sprintf(`%s_bucket{%s,le="%g"} %d`, name, labels, float64(bound)/1000, count))
+			}
+			lines[4] = append(lines[4], fmt.Sprintf(`%s_bucket{%s,le="+Inf"} %d`, name, labels, cs.Requests))
+			lines[4] = append(lines[4], fmt.Sprintf("%s_sum{%s} %g", name, labels, float64(cs.LatencyTotal)/1000000))
+			lines[4] = append(lines[4], fmt.Sprintf("%s_count{%s} %d", name, labels, cs.Requests))
+		}
+	}
+
+	for i, t := range types {
+		if len(lines[i]) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s\n", t[0], t[2], t[0], t[1], strings.Join(lines[i], "\n"))
+	}
+}
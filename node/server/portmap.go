@@ -0,0 +1,141 @@
+package server
+
+/*
+* Mapping of the port of the node on a router with UPnP or NAT-PMP. A node behind NAT gets connections of other
+* nodes only when the port is mapped. Then the node announces the external address of the router in requests
+* to other nodes. The mapping is renewed after half of its lifetime and removed when the server stops
+ */
+
+import (
+	"time"
+
+	"github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/utils"
+)
+
+type portMapRunner struct {
+	S            *NodeServer
+	logger       *utils.LoggerMan
+	mapping      *net.PortMapping
+	stopChan     chan bool
+	completeChan chan bool
+	ticker       time.Duration
+}
+
+// Maps the port and starts renewing of the mapping. Returns nil if the port can not be mapped,
+// the node works without it
+func StartPortMap(s *NodeServer, config net.PortMapConfig) (c *portMapRunner) {
+	mapping, err := net.MapPort(config, s.NodePort)
+
+	if err != nil {
+		s.Logger.Error.Printf("Port %d is not mapped on a router: %s", s.NodePort, err.Error())
+		return nil
+	}
+
+	s.Logger.Trace.Printf("Port %d is mapped with %s to %s", s.NodePort, mapping.Method, mapping.Address().NodeAddrToString())
+
+	// other nodes connect to the router
+	s.NodeAddress = mapping.Address()
+
+	c = &portMapRunner{}
+
+	c.logger = s.Logger
+	c.S = s
+	c.mapping = mapping
+
+	c.stopChan = make(chan bool)     // to notify routine to stop
+	c.completeChan = make(chan bool) // routine to notify it stopped
+
+	c.ticker = c.renewInterval()
+
+	go c.Run()
+
+	return c
+}
+
+func (c *portMapRunner) renewInterval() time.Duration {
+	interval := c.mapping.Lifetime / 2
+
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	return interval
+}
+
+// Run function to renew the mapping regularly
+func (c *portMapRunner) Run() {
+	for {
+		exit := false
+
+		select {
+		case <-c.stopChan:
+			exit = true
+		default:
+		}
+
+		if exit {
+			break
+		}
+
+		if c.ticker > 0 {
+			time.Sleep(1 * time.Second)
+			c.ticker = c.ticker - time.Second
+			continue
+		}
+
+		c.renew()
+
+		c.ticker = c.renewInterval()
+	}
+	c.logger.Trace.Printf("Port mapping Return routine")
+	c.completeChan <- true
+}
+
+func (c *portMapRunner) Stop() error {
+	c.logger.Trace.Println("Stop port mapping")
+
+	close(c.stopChan) // notify routine to stop
+
+	// wait when it is stopped
+	<-c.completeChan
+
+	close(c.completeChan)
+
+	err := c.mapping.Remove()
+
+	if err != nil {
+		c.logger.Trace.Printf("Port mapping is not removed: %s", err.Error())
+	}
+
+	c.logger.TraceExt.Println("Port mapping Stopped")
+
+	return nil
+}
+
+// Renews the mapping. If the external address is changed, other nodes get new address
+func (c *portMapRunner) renew() {
+	err := c.mapping.Renew()
+
+	if err != nil {
+		c.logger.Error.Printf("Port mapping is not renewed: %s", err.Error())
+		return
+	}
+
+	addr := c.mapping.Address()
+
+	if addr.CompareToAddress(c.S.NodeAddress) {
+		return
+	}
+
+	c.logger.Trace.Printf("External address is changed to %s", addr.NodeAddrToString())
+
+	addr.Services = c.S.NodeAddress.Services
+
+	c.S.NodeAddress = addr
+	c.S.Node.NodeClient.SetNodeAddress(addr)
+
+	node := c.S.Node.Clone()
+	defer node.DBConn.CloseConnection()
+
+	node.SendVersionToNodes([]net.NodeAddr{})
+}
@@ -0,0 +1,107 @@
+package server
+
+/*
+* Runtime profiling of a node. pprof HTTP endpoints are started on a separate address when it is set in config,
+* it should be a local address. Same profiles can be requested with the "profile" command of a node
+ */
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime/trace"
+	"time"
+
+	runtimepprof "runtime/pprof"
+)
+
+const (
+	ProfileCPU       = "cpu"
+	ProfileHeap      = "heap"
+	ProfileGoroutine = "goroutine"
+	ProfileTrace     = "trace"
+)
+
+// Max seconds to collect cpu profile or trace
+const maxProfileSeconds = 300
+
+// Starts HTTP server with pprof handlers. It works till the node server stops
+func (s *NodeServer) startProfiling() error {
+	if s.ProfilingAddr == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	var err error
+
+	s.profilingServer, err = s.startHTTPServer(s.ProfilingAddr, "profiling", mux)
+
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Trace.Printf("Profiling endpoints are on http://%s/debug/pprof/", s.ProfilingAddr)
+
+	return nil
+}
+
+func (s *NodeServer) stopProfiling() {
+	if s.profilingServer == nil {
+		return
+	}
+	s.profilingServer.Close()
+	s.profilingServer = nil
+}
+
+// Collects a profile. For cpu and trace it waits given number of seconds
+func makeProfile(profileType string, seconds int) ([]byte, error) {
+	if seconds <= 0 {
+		seconds = 30
+	}
+	if seconds > maxProfileSeconds {
+		return nil, errors.New(fmt.Sprintf("Profile can be collected not more %d seconds", maxProfileSeconds))
+	}
+
+	buf := new(bytes.Buffer)
+
+	switch profileType {
+	case ProfileCPU:
+		err := runtimepprof.StartCPUProfile(buf)
+
+		if err != nil {
+			// other CPU profile is running, possibly from HTTP endpoint
+			return nil, err
+		}
+		time.Sleep(time.Duration(seconds) * time.Second)
+		runtimepprof.StopCPUProfile()
+
+	case ProfileTrace:
+		err := trace.Start(buf)
+
+		if err != nil {
+			return nil, err
+		}
+		time.Sleep(time.Duration(seconds) * time.Second)
+		trace.Stop()
+
+	case ProfileHeap, ProfileGoroutine:
+		err := runtimepprof.Lookup(profileType).WriteTo(buf, 0)
+
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, errors.New(fmt.Sprintf("Unknown profile type %s", profileType))
+	}
+
+	return buf.Bytes(), nil
+}
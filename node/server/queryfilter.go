@@ -6,23 +6,59 @@ Errors returned by the proxy must have MySQL codes.
 2 - Query requires public key
 3 - Query requires data to sign
 4 - Error preparing of query parsing
+3002 - Query was executed but transaction was not added to a pool. The query is rolled back
 
 */
 import (
+	"database/sql"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
 
 	"github.com/gelembjuk/oursql/lib"
 	"github.com/gelembjuk/oursql/lib/dbproxy"
 	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/database"
+	"github.com/gelembjuk/oursql/node/dbquery"
 	"github.com/gelembjuk/oursql/node/nodemanager"
 	"github.com/gelembjuk/oursql/node/structures"
 )
 
+// SELECT queries reading state of a session or locking rows. They are executed only in a session of a client
+var sessionSelectRegexp = regexp.MustCompile("(?i)last_insert_id|found_rows|row_count|connection_id|@|\\bfor\\s+update\\b|" +
+	"\\bfor\\s+share\\b|\\block\\s+in\\s+share\\s+mode\\b|get_lock|\\binto\\b")
+
+// Not SELECT queries which don't change data or a state of a session. After other queries a session uses only the primary server
+var sessionNeutralRegexp = regexp.MustCompile("(?i)^\\s*(show\\s|set\\s+names\\s|set\\s+character\\s+set\\s|" +
+	"set\\s+(@@session\\.|session\\s+)?autocommit\\s*=\\s*(1|on|true)\\s*;?\\s*$)")
+
+// Queries starting and ending a transaction. Results of queries inside a transaction are not cached
+var transactionBeginRegexp = regexp.MustCompile("(?i)^\\s*(begin|start\\s+transaction)\\b")
+var transactionEndRegexp = regexp.MustCompile("(?i)^\\s*(commit|rollback)\\b")
+var transactionContinueRegexp = regexp.MustCompile("(?i)^\\s*rollback\\s+(work\\s+)?to\\b|\\band\\s+chain\\b")
+var autocommitRegexp = regexp.MustCompile("(?i)^\\s*set\\s+(@@session\\.|session\\s+)?autocommit\\s*=\\s*(0|1|on|off|true|false)\\s*;?\\s*$")
+
 type queryFilter struct {
 	DBProxy             dbproxy.DBProxyInterface
 	Node                *nodemanager.Node
 	Logger              *utils.LoggerMan
 	sessionTransactions map[string]*structures.Transaction
+	// updates passed to the server. Cached results are removed after the server executes them
+	sessionWrites map[string]string
+	// MySQL user of each session. Transactions are signed with a key of the user
+	sessionUsers map[string]string
+	// sessions which started a transaction or changed data. Replicas can be behind, so they read from the primary server
+	sessionPrimary map[string]bool
+	// current database of each session. The cache and replicas are used only in the node database
+	sessionDatabases map[string]string
+	// sessions with open transaction or with autocommit off. They don't use the cache
+	sessionInTransaction map[string]bool
+	sessionNoAutocommit  map[string]bool
+	// every proxy connection is served in own goroutine
+	sessionLock sync.Mutex
 	// Use this to notify a main server process about new transaction was added to a pool
 	newTransactionChan chan []byte
 	blockmakerObj      *blocksMaker
@@ -34,6 +70,14 @@ func InitQueryFilter(proxyAddr, dbAddr string, node *nodemanager.Node, logger *u
 	q.Logger = logger
 	q.Node = node
 	q.sessionTransactions = make(map[string]*structures.Transaction)
+	q.sessionWrites = make(map[string]string)
+	q.sessionUsers = make(map[string]string)
+	q.sessionPrimary = make(map[string]bool)
+	q.sessionDatabases = make(map[string]string)
+	q.sessionInTransaction = make(map[string]bool)
+	q.sessionNoAutocommit = make(map[string]bool)
+
+	dbquery.SetQueryCacheSize(node.DBConn.Config.QueryCacheSize)
 	q.blockmakerObj = bmo
 
 	q.Logger.Trace.Printf("DB Proxy Start on %s  %s", proxyAddr, dbAddr)
@@ -67,7 +111,11 @@ func InitQueryFilter(proxyAddr, dbAddr string, node *nodemanager.Node, logger *u
 	return
 }
 func (q *queryFilter) RequestCallback(query string, sessionID string) (dbproxy.CustomRequestActionInterface, error) {
-	qm, err := q.Node.GetSQLQueryManager()
+	q.sessionLock.Lock()
+	user := q.sessionUsers[sessionID]
+	q.sessionLock.Unlock()
+
+	qm, err := q.Node.GetSQLQueryManagerForUser(user)
 
 	if err != nil {
 		return nil, err
@@ -100,12 +148,41 @@ func (q *queryFilter) RequestCallback(query string, sessionID string) (dbproxy.C
 	if result.TX != nil {
 		q.Logger.Trace.Printf("Query: %s, sessID: %s, TX created %x\n", query, sessionID, result.TX.GetID())
 
+		q.sessionLock.Lock()
 		q.sessionTransactions[sessionID] = result.TX
+		q.sessionLock.Unlock()
 
 	} else {
 		q.Logger.Trace.Printf("Query: %s, sessID: %s, no TX needed\n", query, sessionID)
 	}
 
+	q.sessionLock.Lock()
+
+	if !result.IsSelect && !sessionNeutralRegexp.MatchString(query) {
+		q.sessionPrimary[sessionID] = true
+	}
+	primary := q.sessionPrimary[sessionID]
+	inTransaction := q.updateTransactionState(sessionID, query)
+	nodeDatabase := q.sessionDatabases[sessionID] == q.Node.DBConn.Config.GetDatabaseName()
+
+	q.sessionLock.Unlock()
+
+	if result.Status == 3 && result.IsSelect && nodeDatabase {
+		useReplica := !primary && !sessionSelectRegexp.MatchString(query)
+
+		return q.selectQuery(query, user, !inTransaction, useReplica), nil
+	}
+
+	q.sessionLock.Lock()
+
+	if result.Status == 3 {
+		q.sessionWrites[sessionID] = query
+	} else {
+		q.sessionWrites[sessionID] = result.ReplaceQuery
+	}
+
+	q.sessionLock.Unlock()
+
 	if result.Status == 3 {
 		// it means query was not executed and must be passed to a server
 		return nil, nil
@@ -115,32 +192,174 @@ func (q *queryFilter) RequestCallback(query string, sessionID string) (dbproxy.C
 	// empty list of rows means to return OK response
 	return dbproxy.NewCustomQueryRequest(result.ReplaceQuery), nil
 }
-func (q *queryFilter) ResponseCallback(sessionID string, err error) {
+
+// Change transaction state of a session by a query. Returns true if the query is in a transaction.
+// Must be called with the session lock
+func (q *queryFilter) updateTransactionState(sessionID string, query string) bool {
+	if m := autocommitRegexp.FindStringSubmatch(query); m != nil {
+		switch strings.ToLower(m[2]) {
+		case "0", "off", "false":
+			q.sessionNoAutocommit[sessionID] = true
+		default:
+			// enabling of autocommit commits a transaction
+			delete(q.sessionNoAutocommit, sessionID)
+			delete(q.sessionInTransaction, sessionID)
+		}
+	} else if transactionBeginRegexp.MatchString(query) {
+		q.sessionInTransaction[sessionID] = true
+	} else if transactionEndRegexp.MatchString(query) && !transactionContinueRegexp.MatchString(query) {
+		delete(q.sessionInTransaction, sessionID)
+	}
+	return q.sessionInTransaction[sessionID] || q.sessionNoAutocommit[sessionID]
+}
+
+// Execute SELECT from the cache or on a read replica. If nil is returned, the query goes to the primary server.
+// If a result is not in the cache, the query is executed in the session of the client and the result is captured
+// to the cache. Replicas can be behind, they are used only for not cached queries which don't depend on a session
+func (q *queryFilter) selectQuery(query string, user string, useCache bool, useReplica bool) dbproxy.CustomRequestActionInterface {
+	if useCache {
+		result, cached := dbquery.GetCachedSelect(user, q.Node.DBConn.Config.GetDatabaseName(), query)
+
+		if result != nil {
+			q.Logger.Trace.Printf("Query result from the cache, %d rows", len(result.Rows))
+			return newSelectResultResponse(result)
+		}
+
+		if cached != nil {
+			return dbproxy.NewCaptureResultRequest(func(columns []dbproxy.CustomResponseColumn, rows [][]dbproxy.CustomResponseValue) {
+				cached.Put(newSelectResult(columns, rows))
+			})
+		}
+	}
+
+	if !useReplica || !q.Node.DBConn.Config.HasReadReplicas() {
+		return nil
+	}
+
+	result, err := q.Node.DBConn.DB().QM().ExecuteSQLSelectOnReplica(query)
 
 	if err != nil {
-		q.Logger.Trace.Printf("DB Proxy Response Error: %s. Canceling TX from a pool", err.Error())
+		q.Logger.Trace.Printf("Replica error, use primary: %s", err.Error())
+		return nil
+	}
+	q.Logger.Trace.Printf("Query executed on a replica, %d rows", len(result.Rows))
 
-		if _, ok := q.sessionTransactions[sessionID]; ok {
-			delete(q.sessionTransactions, sessionID)
+	return newSelectResultResponse(result)
+}
+
+// Result of a query captured from a response of the server
+func newSelectResult(columns []dbproxy.CustomResponseColumn, rows [][]dbproxy.CustomResponseValue) *database.SelectResult {
+	result := &database.SelectResult{}
+
+	for _, c := range columns {
+		result.Columns = append(result.Columns, c.Name)
+		result.ColumnTypes = append(result.ColumnTypes, c.Type)
+	}
+
+	for _, row := range rows {
+		values := []sql.NullString{}
+
+		for _, v := range row {
+			values = append(values, sql.NullString{String: v.Value, Valid: !v.Null})
 		}
+		result.Rows = append(result.Rows, values)
+	}
+	return result
+}
 
-	} else if tx, ok := q.sessionTransactions[sessionID]; ok {
-		// Add the TX to the pool
-		err := q.Node.ReceivedNewTransaction(tx, lib.TXFlagsVerifyAllowMissedForDelete)
+// Response to a client with rows of a result
+func newSelectResultResponse(result *database.SelectResult) dbproxy.CustomRequestActionInterface {
+	columns := []dbproxy.CustomResponseColumn{}
 
-		if err != nil {
-			// Rollback?
-			// TODO
-			q.Logger.Trace.Printf("Error adding TX to pool from proxy %x %s", tx.GetID(), err.Error())
+	for i, name := range result.Columns {
+		columns = append(columns, dbproxy.CustomResponseColumn{name, result.ColumnTypes[i]})
+	}
+
+	rows := [][]dbproxy.CustomResponseValue{}
+
+	for _, row := range result.Rows {
+		values := []dbproxy.CustomResponseValue{}
+
+		for _, v := range row {
+			values = append(values, dbproxy.CustomResponseValue{v.String, !v.Valid})
 		}
+		rows = append(rows, values)
+	}
+	return dbproxy.NewCustomDataRowsResponse(columns, rows)
+}
 
-		// Notify server thread about new TX completed fine
+func (q *queryFilter) ResponseCallback(sessionID string, err error) error {
+	q.sessionLock.Lock()
+	tx, ok := q.sessionTransactions[sessionID]
+	delete(q.sessionTransactions, sessionID)
+	write, hasWrite := q.sessionWrites[sessionID]
+	delete(q.sessionWrites, sessionID)
+	q.sessionLock.Unlock()
 
-		q.blockmakerObj.NewTransaction(tx.GetID())
+	if hasWrite {
+		dbquery.InvalidateQueryCache(write)
 
-		delete(q.sessionTransactions, sessionID)
+		if err == nil {
+			dbquery.RememberWrite(write)
+		}
 	}
+
+	if !ok {
+		return nil
+	}
+
+	if err != nil {
+		q.Logger.Trace.Printf("DB Proxy Response Error: %s. Canceling TX from a pool", err.Error())
+		return nil
+	}
+	// Add the TX to the pool. Client gets the response only after this
+	err = q.Node.ReceivedNewTransaction(tx, lib.TXFlagsVerifyAllowMissedForDelete)
+
+	if err != nil {
+		q.Logger.Trace.Printf("Error adding TX to pool from proxy %x %s", tx.GetID(), err.Error())
+
+		// the query is already executed. Revert it, there is no TX for this change
+		rerr := dbquery.NewQueryProcessor(q.Node.DBConn.DB(), q.Logger).ExecuteRollbackQueryFromTX(tx.SQLCommand)
+
+		if rerr != nil {
+			q.Logger.Error.Printf("Rollback of proxy query failed for TX %x %s", tx.GetID(), rerr.Error())
+		}
+
+		return errors.New(fmt.Sprintf("Transaction was not created: %s", err.Error()))
+	}
+
+	// Notify server thread about new TX completed fine
+	q.blockmakerObj.NewTransaction(tx.GetID())
+
+	return nil
 }
+func (q *queryFilter) SessionUserCallback(sessionID string, user string) {
+	q.sessionLock.Lock()
+	defer q.sessionLock.Unlock()
+
+	q.sessionUsers[sessionID] = user
+}
+
+func (q *queryFilter) SessionDatabaseCallback(sessionID string, database string) {
+	q.sessionLock.Lock()
+	defer q.sessionLock.Unlock()
+
+	q.sessionDatabases[sessionID] = database
+}
+
+func (q *queryFilter) SessionCloseCallback(sessionID string) {
+	q.sessionLock.Lock()
+	defer q.sessionLock.Unlock()
+
+	delete(q.sessionUsers, sessionID)
+	delete(q.sessionPrimary, sessionID)
+	delete(q.sessionDatabases, sessionID)
+	delete(q.sessionInTransaction, sessionID)
+	delete(q.sessionNoAutocommit, sessionID)
+	delete(q.sessionTransactions, sessionID)
+	delete(q.sessionWrites, sessionID)
+}
+
 func (q *queryFilter) Stop() error {
 	q.Logger.Trace.Println("Stop DB proxy")
 
@@ -0,0 +1,429 @@
+package server
+
+/*
+* REST API of wallet operations: balance, unspent outputs, history, preparing and sending of transactions.
+* It is for web and mobile apps which can not use the protocol of nodes. Requests go to same handlers as commands
+* of lite wallets, only a request and a response are JSON. Binary data is in hex.
+* Blacklists, bans and limits of requests are same as for connections of nodes
+ */
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	netlib "github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/nodeclient"
+	"github.com/gelembjuk/oursql/lib/utils"
+)
+
+// Max size of a request body
+const maxRESTRequestSize = 1 << 20
+
+const restPrefix = "/api/v1/"
+
+type restBalance struct {
+	Total    float64 `json:"total"`
+	Approved float64 `json:"approved"`
+	Pending  float64 `json:"pending"`
+}
+
+type restOutput struct {
+	TXID   string  `json:"txId"`
+	Vout   int     `json:"vout"`
+	Amount float64 `json:"amount"`
+	IsBase bool    `json:"isBase"`
+	From   string  `json:"from"`
+}
+
+type restUnspent struct {
+	LastBlock string       `json:"lastBlock"`
+	Outputs   []restOutput `json:"outputs"`
+}
+
+type restHistoryRecord struct {
+	TXID          string  `json:"txId"`
+	Out           bool    `json:"out"`
+	Amount        float64 `json:"amount"`
+	From          string  `json:"from"`
+	To            string  `json:"to"`
+	Time          int64   `json:"time"`
+	BlockHash     string  `json:"blockHash"`
+	BlockHeight   int     `json:"blockHeight"`
+	Confirmations int     `json:"confirmations"`
+}
+
+type restHistory struct {
+	Transactions []restHistoryRecord `json:"transactions"`
+}
+
+type restPrepareRequest struct {
+	PubKey        string  `json:"pubKey"`
+	To            string  `json:"to"`
+	Amount        float64 `json:"amount"`
+	ChangeAddress string  `json:"changeAddress"`
+	// for SQL transaction
+	SQL string `json:"sql"`
+}
+
+type restPrepared struct {
+	// SQL query is executed without a transaction
+	Finished   bool   `json:"finished"`
+	TX         string `json:"tx"`
+	DataToSign string `json:"dataToSign"`
+}
+
+type restSendRequest struct {
+	Address   string `json:"address"`
+	TX        string `json:"tx"`
+	Signature string `json:"signature"`
+}
+
+type restSent struct {
+	ID string `json:"id"`
+}
+
+type restErrorBody struct {
+	Code      int    `json:"code"`
+	Category  string `json:"category"`
+	Message   string `json:"message"`
+	Retryable bool   `json:"retryable"`
+}
+
+type restError struct {
+	Error restErrorBody `json:"error"`
+}
+
+func newRESTError(err error) restError {
+	rerr := netlib.MakeRemoteError(err)
+
+	return restError{restErrorBody{rerr.Code, rerr.Category, rerr.Message, rerr.Retryable}}
+}
+
+// Starts HTTP server with REST API. It works till the node server stops
+func (s *NodeServer) startREST() error {
+	if s.RESTAddr == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(restPrefix, s.handleREST)
+
+	var err error
+
+	s.restServer, err = s.startHTTPServer(s.RESTAddr, "REST API", mux)
+
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Trace.Printf("REST API is on http://%s%s", s.RESTAddr, restPrefix)
+
+	return nil
+}
+
+func (s *NodeServer) stopREST() {
+	if s.restServer == nil {
+		return
+	}
+	s.restServer.Close()
+	s.restServer = nil
+}
+
+// Routes:
+// GET  /api/v1/addresses/ADDRESS/balance
+// GET  /api/v1/addresses/ADDRESS/unspent
+// GET  /api/v1/addresses/ADDRESS/history?offset=N&limit=N
+// POST /api/v1/transactions/prepare     {"pubKey","to","amount","changeAddress"}
+// POST /api/v1/transactions/preparesql  {"pubKey","sql"}
+// POST /api/v1/transactions             {"address","tx","signature"}
+func (s *NodeServer) handleREST(w http.ResponseWriter, r *http.Request) {
+	// same controls as for connections of nodes
+	host := restPeerHost(r)
+	whitelisted := s.peers.IsWhitelisted(host)
+
+	if s.peers.IsBlacklisted(host) || !whitelisted && s.bans.IsBanned(host) {
+		s.Logger.TraceExt.Printf("REST request from blocked %s is refused", host)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if !whitelisted && s.bans.CountRequest(host) {
+		s.misbehaving(host, netlib.BanPointsTooManyRequest, "Too many requests")
+	}
+
+	if s.RESTAllowOrigin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", s.RESTAllowOrigin)
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, restPrefix), "/"), "/")
+
+	var result interface{}
+	var err error
+
+	switch {
+	case len(path) == 3 && path[0] == "addresses" && r.Method == http.MethodGet:
+		result, err = s.restAddress(path[1], path[2], r)
+
+	case len(path) == 2 && path[0] == "transactions" && r.Method == http.MethodPost:
+		result, err = s.restPrepare(path[1], r)
+
+	case len(path) == 1 && path[0] == "transactions" && r.Method == http.MethodPost:
+		result, err = s.restSend(r)
+
+	default:
+		err = netlib.NewRemoteError(netlib.ErrorCodeUnknownCommand, "Unknown method "+r.Method+" "+r.URL.Path)
+	}
+
+	if err != nil {
+		writeRESTError(w, err)
+		return
+	}
+	writeRESTResponse(w, http.StatusOK, result)
+}
+
+func (s *NodeServer) restAddress(address string, operation string, r *http.Request) (interface{}, error) {
+	switch operation {
+	case "balance":
+		balance := nodeclient.ComWalletBalance{}
+
+		err := s.restCall(r, (*NodeServerRequest).handleGetBalance, nodeclient.ComGetWalletBalance{Address: address}, &balance)
+
+		if err != nil {
+			return nil, err
+		}
+		return restBalance{balance.Total, balance.Approved, balance.Pending}, nil
+
+	case "unspent":
+		unspent := nodeclient.ComUnspentTransactions{}
+
+		err := s.restCall(r, (*NodeServerRequest).handleGetUnspent, nodeclient.ComGetUnspentTransactions{Address: address}, &unspent)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result := restUnspent{LastBlock: hex.EncodeToString(unspent.LastBlock), Outputs: []restOutput{}}
+
+		for _, t := range unspent.Transactions {
+			result.Outputs = append(result.Outputs, restOutput{hex.EncodeToString(t.TXID), t.Vout, t.Amount, t.IsBase, t.From})
+		}
+		return result, nil
+
+	case "history":
+		request := nodeclient.ComGetHistoryTransactions{Address: address}
+
+		request.Offset, _ = strconv.Atoi(r.URL.Query().Get("offset"))
+		request.Limit, _ = strconv.Atoi(r.URL.Query().Get("limit"))
+		// cursor of next page is the last record of previous page
+		request.AfterBlock, _ = hex.DecodeString(r.URL.Query().Get("afterblock"))
+		request.AfterTX, _ = hex.DecodeString(r.URL.Query().Get("aftertx"))
+		request.AfterIOType = r.URL.Query().Get("afterio") == "true"
+
+		history := []nodeclient.ComHistoryTransaction{}
+
+		err := s.restCall(r, (*NodeServerRequest).handleGetHistory, request, &history)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result := restHistory{Transactions: []restHistoryRecord{}}
+
+		for _, t := range history {
+			result.Transactions = append(result.Transactions, restHistoryRecord{
+				hex.EncodeToString(t.TXID), t.IOType, t.Amount, t.From, t.To, t.Time,
+				hex.EncodeToString(t.BlockHash), t.BlockHeight, t.Confirmations})
+		}
+		return result, nil
+	}
+	return nil, netlib.NewRemoteError(netlib.ErrorCodeUnknownCommand, "Unknown operation "+operation)
+}
+
+// Prepares a currency or SQL transaction. A client signs data and sends the transaction
+func (s *NodeServer) restPrepare(kind string, r *http.Request) (interface{}, error) {
+	request := restPrepareRequest{}
+
+	err := s.readRESTRequest(r, &request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pubKey, err := hex.DecodeString(request.PubKey)
+
+	if err != nil || len(pubKey) == 0 {
+		return nil, s.restBadRequest(r, "pubKey must be a key in hex")
+	}
+
+	prepared := nodeclient.ComRequestTransactionData{}
+
+	switch kind {
+	case "prepare":
+		err = s.restCall(r, (*NodeServerRequest).handleTxCurRequest,
+			nodeclient.ComRequestTransaction{PubKey: pubKey, To: request.To, Amount: request.Amount, ChangeAddress: request.ChangeAddress}, &prepared)
+	case "preparesql":
+		err = s.restCall(r, (*NodeServerRequest).handleTxSQLRequest,
+			nodeclient.ComRequestSQLTransaction{PubKey: pubKey, SQL: request.SQL}, &prepared)
+	default:
+		return nil, netlib.NewRemoteError(netlib.ErrorCodeUnknownCommand, "Unknown operation "+kind)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return restPrepared{prepared.Finished, hex.EncodeToString(prepared.TX), hex.EncodeToString(prepared.DataToSign)}, nil
+}
+
+// Accepts a signed transaction
+func (s *NodeServer) restSend(r *http.Request) (interface{}, error) {
+	request := restSendRequest{}
+
+	err := s.readRESTRequest(r, &request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data := nodeclient.ComNewTransactionData{Address: request.Address}
+
+	data.TX, err = hex.DecodeString(request.TX)
+
+	if err != nil {
+		return nil, s.restBadRequest(r, "tx must be in hex")
+	}
+
+	data.Signature, err = hex.DecodeString(request.Signature)
+
+	if err != nil {
+		return nil, s.restBadRequest(r, "signature must be in hex")
+	}
+
+	txID := []byte{}
+
+	err = s.restCall(r, (*NodeServerRequest).handleTxData, data, &txID)
+
+	if err != nil {
+		return nil, err
+	}
+	return restSent{hex.EncodeToString(txID)}, nil
+}
+
+// Calls a handler of a command with the payload and decodes its response to the result
+func (s *NodeServer) restCall(r *http.Request, handler func(*NodeServerRequest) error, payload interface{}, result interface{}) error {
+	sessid := utils.RandString(5)
+
+	requestobj := NodeServerRequest{}
+	requestobj.Node = s.Node.Clone()
+	requestobj.Node.SessionID = sessid
+	requestobj.Logger = s.Logger
+	requestobj.S = s
+	requestobj.SessID = sessid
+	requestobj.WireFormat = netlib.WireFormatGob
+	requestobj.RequestIP = restPeerHost(r)
+
+	var err error
+
+	requestobj.Request, err = netlib.EncodePayload(requestobj.WireFormat, payload)
+
+	if err != nil {
+		return err
+	}
+
+	err = requestobj.Node.DBConn.OpenConnection(sessid)
+
+	if err != nil {
+		return netlib.NewRemoteError(netlib.ErrorCodeDatabase, "Blockchain open Error: "+err.Error())
+	}
+
+	err = handler(&requestobj)
+
+	requestobj.Node.DBConn.CloseConnection()
+
+	// a REST client is never authorized as a node
+	s.misbehaving(requestobj.RequestIP, requestobj.BanPoints, requestobj.BanReason)
+
+	if err != nil {
+		return err
+	}
+	return netlib.DecodePayload(requestobj.WireFormat, requestobj.Response, result)
+}
+
+func (s *NodeServer) readRESTRequest(r *http.Request, request interface{}) error {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, maxRESTRequestSize))
+
+	if err != nil {
+		return s.restBadRequest(r, err.Error())
+	}
+
+	if json.Unmarshal(body, request) != nil {
+		return s.restBadRequest(r, "Request is not valid JSON")
+	}
+	return nil
+}
+
+// A client gets ban points for a request which can not be parsed, same as a node for a bad payload
+func (s *NodeServer) restBadRequest(r *http.Request, message string) error {
+	s.misbehaving(restPeerHost(r), netlib.BanPointsBadRequest, message)
+
+	return netlib.NewRemoteError(netlib.ErrorCodeBadRequest, message)
+}
+
+// IP of a client. It is empty if an address is not IP, like for local connections of nodes
+func restPeerHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil || net.ParseIP(host) == nil {
+		return ""
+	}
+	return host
+}
+
+// HTTP status of an error by its category
+func writeRESTError(w http.ResponseWriter, err error) {
+	rerr := netlib.MakeRemoteError(err)
+
+	status := http.StatusInternalServerError
+
+	switch rerr.Category {
+	case netlib.ErrorCategoryRequest:
+		status = http.StatusBadRequest
+	case netlib.ErrorCategoryNotFound:
+		status = http.StatusNotFound
+	case netlib.ErrorCategoryVerification:
+		status = http.StatusUnprocessableEntity
+	}
+
+	if rerr.Code == netlib.ErrorCodeUnknownCommand {
+		status = http.StatusNotFound
+	}
+
+	if rerr.Retryable && status == http.StatusInternalServerError {
+		status = http.StatusServiceUnavailable
+	}
+	writeRESTResponse(w, status, newRESTError(rerr))
+}
+
+func writeRESTResponse(w http.ResponseWriter, status int, resp interface{}) {
+	data, err := json.Marshal(resp)
+
+	if err != nil {
+		status = http.StatusInternalServerError
+		data, _ = json.Marshal(newRESTError(err))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
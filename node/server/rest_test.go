@@ -0,0 +1,261 @@
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	netlib "github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/remoteclient"
+	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/consensus"
+	"github.com/gelembjuk/oursql/node/database"
+	"github.com/gelembjuk/oursql/node/nodemanager"
+)
+
+// Server with a new blockchain in SQLite. Coins of first block are on the wallet
+func makeTestRESTServer(t *testing.T, banning netlib.BanConfig, lists netlib.PeerListsConfig) (*NodeServer, *remoteclient.Wallet) {
+	dir, err := ioutil.TempDir("", "oursqlrest")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir += string(os.PathSeparator)
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	w := &remoteclient.Wallet{}
+	w.MakeWallet()
+
+	logger := utils.CreateLogger()
+
+	c, _ := consensus.NewConfigDefault()
+	c.Settings["Complexity"] = 8
+	data, _ := json.Marshal(c)
+
+	err = ioutil.WriteFile(dir+"consensus.json", data, 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node := &nodemanager.Node{ConfigDir: dir, Logger: logger, MinterAddress: string(w.GetAddress())}
+
+	node.ConsensusConfig, err = consensus.NewConfigFromFile(dir + "consensus.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node.DBConn = &nodemanager.Database{}
+	node.DBConn.SetLogger(logger)
+	node.DBConn.SetConfig(database.DatabaseConfig{Driver: database.DriverSQLite, SQLiteFile: dir + "db.sqlite"})
+	node.DBConn.Init()
+	node.Init()
+
+	err = node.CreateBlockchain(node.MinterAddress, w.GetSigner())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &NodeServer{Node: node, Logger: logger, ConfigDir: dir}
+	// blocks are not made, the maker is not started
+	s.blocksMakerObj = InitBlocksMaker(s)
+
+	s.bans, err = netlib.NewBanList(banning, dir+"bans.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.peers, err = netlib.NewPeerLists(lists)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, w
+}
+
+func testRESTRequest(s *NodeServer, method, path, body, remoteAddr string) (int, map[string]interface{}) {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.RemoteAddr = remoteAddr
+
+	rec := httptest.NewRecorder()
+	s.handleREST(rec, r)
+
+	result := map[string]interface{}{}
+	json.Unmarshal(rec.Body.Bytes(), &result)
+
+	return rec.Code, result
+}
+
+func TestRESTRoutes(t *testing.T) {
+	s, w := makeTestRESTServer(t, netlib.BanConfig{}, netlib.PeerListsConfig{})
+
+	address := string(w.GetAddress())
+
+	other := remoteclient.Wallet{}
+	other.MakeWallet()
+
+	status, balance := testRESTRequest(s, "GET", restPrefix+"addresses/"+address+"/balance", "", "10.0.0.1:1000")
+
+	if status != http.StatusOK || balance["total"].(float64) <= 0 {
+		t.Fatalf("Balance %d %v", status, balance)
+	}
+
+	status, unspent := testRESTRequest(s, "GET", restPrefix+"addresses/"+address+"/unspent", "", "10.0.0.1:1000")
+
+	if status != http.StatusOK || len(unspent["outputs"].([]interface{})) == 0 {
+		t.Fatalf("Unspent %d %v", status, unspent)
+	}
+
+	status, history := testRESTRequest(s, "GET", restPrefix+"addresses/"+address+"/history?limit=10", "", "10.0.0.1:1000")
+
+	if status != http.StatusOK || history["transactions"] == nil {
+		t.Fatalf("History %d %v", status, history)
+	}
+
+	prepare := `{"pubKey":"` + hex.EncodeToString(w.GetPublicKey()) + `","to":"` + string(other.GetAddress()) + `","amount":1}`
+
+	status, prepared := testRESTRequest(s, "POST", restPrefix+"transactions/prepare", prepare, "10.0.0.1:1000")
+
+	if status != http.StatusOK || prepared["tx"] == "" {
+		t.Fatalf("Prepare %d %v", status, prepared)
+	}
+
+	dataToSign, _ := hex.DecodeString(prepared["dataToSign"].(string))
+	signature, err := utils.SignDataBySigner(w.GetSigner(), dataToSign)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := `{"address":"` + address + `","tx":"` + prepared["tx"].(string) + `","signature":"` + hex.EncodeToString(signature) + `"}`
+
+	status, sent := testRESTRequest(s, "POST", restPrefix+"transactions", send, "10.0.0.1:1000")
+
+	if status != http.StatusOK || sent["id"] == "" {
+		t.Fatalf("Send %d %v", status, sent)
+	}
+
+	preparesql := `{"pubKey":"` + hex.EncodeToString(w.GetPublicKey()) + `","sql":"CREATE TABLE members (id INT NOT NULL PRIMARY KEY)"}`
+
+	status, prepared = testRESTRequest(s, "POST", restPrefix+"transactions/preparesql", preparesql, "10.0.0.1:1000")
+
+	if status != http.StatusOK || prepared["tx"] == "" {
+		t.Fatalf("Prepare SQL %d %v", status, prepared)
+	}
+
+	status, _ = testRESTRequest(s, "GET", restPrefix+"blocks", "", "10.0.0.1:1000")
+
+	if status != http.StatusNotFound {
+		t.Fatalf("Unknown route status %d", status)
+	}
+}
+
+func TestRESTBadRequests(t *testing.T) {
+	s, _ := makeTestRESTServer(t, netlib.BanConfig{Threshold: 100}, netlib.PeerListsConfig{})
+
+	requests := []struct {
+		path string
+		body string
+	}{
+		{"transactions/prepare", `{"pubKey":`},
+		{"transactions/prepare", `{"pubKey":"xyz","to":"a","amount":1}`},
+		{"transactions/preparesql", `{"sql":"SELECT 1"}`},
+		{"transactions", `{"address":"a","tx":"xyz","signature":"00"}`},
+		{"transactions", `{"address":"a","tx":"00","signature":"xyz"}`},
+	}
+
+	for _, r := range requests {
+		status, result := testRESTRequest(s, "POST", restPrefix+r.path, r.body, "10.0.0.2:1000")
+
+		if status != http.StatusBadRequest {
+			t.Fatalf("Status %d for %s %s", status, r.path, r.body)
+		}
+
+		body := result["error"].(map[string]interface{})
+
+		if body["code"].(float64) != netlib.ErrorCodeBadRequest || body["category"] != netlib.ErrorCategoryRequest {
+			t.Fatalf("Error %v for %s %s", body, r.path, r.body)
+		}
+	}
+
+	// every bad request has ban points
+	if !s.bans.IsBanned("10.0.0.2") {
+		t.Fatalf("Client with bad requests must be banned")
+	}
+}
+
+func TestRESTPeerControls(t *testing.T) {
+	s, w := makeTestRESTServer(t, netlib.BanConfig{Threshold: 2, RequestsPerMinute: 2},
+		netlib.PeerListsConfig{Blacklist: []string{"10.0.1.0/24"}, Whitelist: []string{"10.0.2.1"}})
+
+	path := restPrefix + "addresses/" + string(w.GetAddress()) + "/balance"
+
+	if status, _ := testRESTRequest(s, "GET", path, "", "10.0.1.5:1000"); status != http.StatusForbidden {
+		t.Fatalf("Blacklisted status %d", status)
+	}
+
+	s.misbehaving("10.0.0.3", netlib.BanPointsInvalidBlock*2, "test")
+
+	if status, _ := testRESTRequest(s, "GET", path, "", "10.0.0.3:1000"); status != http.StatusForbidden {
+		t.Fatalf("Banned status %d", status)
+	}
+
+	// every request over the limit gives a ban point, whitelisted peers are not limited
+	for i := 0; i < 4; i++ {
+		for _, addr := range []string{"10.0.0.4:1000", "10.0.2.1:1000"} {
+			if status, _ := testRESTRequest(s, "GET", path, "", addr); status != http.StatusOK {
+				t.Fatalf("Status %d for %s", status, addr)
+			}
+		}
+	}
+
+	if status, _ := testRESTRequest(s, "GET", path, "", "10.0.0.4:1000"); status != http.StatusForbidden {
+		t.Fatalf("Status %d after too many requests", status)
+	}
+
+	if s.bans.IsBanned("10.0.2.1") {
+		t.Fatalf("Whitelisted peer must not be banned")
+	}
+
+	s.misbehaving("10.0.2.1", netlib.BanPointsInvalidBlock*2, "test")
+
+	if status, _ := testRESTRequest(s, "GET", path, "", "10.0.2.1:1000"); status != http.StatusOK {
+		t.Fatalf("Whitelisted status %d", status)
+	}
+}
+
+func TestRESTErrorStatus(t *testing.T) {
+	errs := map[int]error{
+		http.StatusBadRequest:          netlib.NewRemoteError(netlib.ErrorCodeBadRequest, ""),
+		http.StatusNotFound:            netlib.NewRemoteError(netlib.ErrorCodeUnknownCommand, ""),
+		http.StatusUnprocessableEntity: netlib.NewRemoteError(netlib.ErrorCodeNoEnoughFunds, ""),
+		http.StatusServiceUnavailable:  netlib.NewRemoteError(netlib.ErrorCodeDBUnavailable, ""),
+		http.StatusInternalServerError: errors.New("Other error"),
+	}
+
+	for status, err := range errs {
+		rec := httptest.NewRecorder()
+		writeRESTError(rec, err)
+
+		if rec.Code != status {
+			t.Fatalf("Status %d for %s, expected %d", rec.Code, err.Error(), status)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	writeRESTError(rec, netlib.NewRemoteError(netlib.ErrorCodeNotFound, ""))
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("Status %d for not found", rec.Code)
+	}
+}
@@ -0,0 +1,252 @@
+package server
+
+/*
+* Anti-entropy check of DB data. Checksums of application tables are compared with other nodes.
+* Different rows are reported and can be restored from transactions of the blockchain.
+* Nodes are compared only if they have same top block, rows changed by transactions in pools are skipped
+ */
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"time"
+
+	netlib "github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/nodemanager"
+)
+
+// Options of rows checker. Zero interval means the check is off
+type RowsCheckOptions struct {
+	Interval int  // seconds between checks
+	Repair   bool // restore different rows from transactions
+}
+
+type rowsChecker struct {
+	S            *NodeServer
+	logger       *utils.LoggerMan
+	options      RowsCheckOptions
+	stopChan     chan bool
+	completeChan chan bool
+	ticker       int
+	lock         sync.Mutex
+	different    int64
+}
+
+func StartRowsChecker(s *NodeServer, options RowsCheckOptions) (c *rowsChecker) {
+	c = &rowsChecker{}
+
+	c.logger = s.Logger
+	c.S = s
+	c.options = options
+
+	c.stopChan = make(chan bool)     // to notify routine to stop
+	c.completeChan = make(chan bool) // routine to notify it stopped
+
+	c.ticker = c.options.Interval
+
+	go c.Run()
+
+	return c
+}
+
+// Run function to compare rows with other nodes regularly
+func (c *rowsChecker) Run() {
+	for {
+		exit := false
+
+		select {
+		case <-c.stopChan:
+			exit = true
+		default:
+		}
+
+		if exit {
+			break
+		}
+
+		if c.ticker > 0 {
+			time.Sleep(1 * time.Second)
+			c.ticker = c.ticker - 1
+			continue
+		}
+
+		err := c.check()
+
+		if err != nil {
+			c.logger.Error.Printf("Rows check error: %s", err.Error())
+		}
+
+		c.ticker = c.options.Interval
+	}
+	c.logger.Trace.Printf("Rows Checker Return routine")
+	c.completeChan <- true
+}
+
+func (c *rowsChecker) Stop() error {
+	c.logger.Trace.Println("Stop rows checker")
+
+	close(c.stopChan) // notify routine to stop
+
+	// wait when it is stopped
+	<-c.completeChan
+
+	close(c.completeChan)
+
+	c.logger.TraceExt.Println("Rows Checker Stopped")
+
+	return nil
+}
+
+// Number of found rows different from other nodes
+func (c *rowsChecker) GetDifferentCount() int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.different
+}
+
+// Compare all tables with one random node
+func (c *rowsChecker) check() error {
+	addr := c.S.Node.NodeNet.GetConnecttionVerifiedNodeAddr()
+
+	if addr == nil {
+		return nil
+	}
+
+	tables, err := c.S.Node.GetManagedTables()
+
+	if err != nil {
+		return err
+	}
+
+	c.logger.Trace.Printf("Check rows of %d tables with %s", len(tables), addr.NodeAddrToString())
+
+	for _, table := range tables {
+		err = c.checkTable(*addr, table)
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *rowsChecker) checkTable(addr netlib.NodeAddr, table string) error {
+	exclude, err := c.S.Node.GetPoolRowsKeys(table)
+
+	if err != nil {
+		return err
+	}
+
+	if len(exclude) > nodemanager.RowsChecksumsMaxExclude {
+		c.logger.Trace.Printf("Too many rows of %s are changed in the pool. Skip rows check", table)
+		return nil
+	}
+
+	remote, err := c.S.Node.NodeClient.SendGetChecksums(addr, table, -1, exclude)
+
+	if err != nil {
+		return err
+	}
+
+	if len(remote.Groups) != nodemanager.RowsChecksumsGroups {
+		return errors.New("Wrong number of checksums groups from other node")
+	}
+
+	// rows changed by transactions in the pool of other node are skipped too
+	exclude = append(exclude, remote.Exclude...)
+
+	if len(exclude) > nodemanager.RowsChecksumsMaxExclude {
+		c.logger.Trace.Printf("Too many rows of %s are changed in pools. Skip rows check", table)
+		return nil
+	}
+
+	groups, err := c.S.Node.GetTableChecksums(table, exclude)
+
+	if err != nil {
+		return err
+	}
+
+	if !c.isSameTopBlock(remote.TopHash) {
+		c.logger.Trace.Printf("Other node has different top block. Skip rows check")
+		return nil
+	}
+
+	for g := range groups {
+		if bytes.Compare(groups[g], remote.Groups[g]) == 0 {
+			continue
+		}
+
+		err = c.checkGroup(addr, table, g, exclude)
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Find different rows in a group and restore them if needed
+func (c *rowsChecker) checkGroup(addr netlib.NodeAddr, table string, group int, exclude []string) error {
+	remote, err := c.S.Node.NodeClient.SendGetChecksums(addr, table, group, exclude)
+
+	if err != nil {
+		return err
+	}
+
+	rows, err := c.S.Node.GetTableGroupRowsChecksums(table, group, exclude)
+
+	if err != nil {
+		return err
+	}
+
+	if !c.isSameTopBlock(remote.TopHash) {
+		return nil
+	}
+
+	keys := []string{}
+
+	for key, checksum := range rows {
+		if bytes.Compare(checksum, remote.Rows[key]) != 0 {
+			keys = append(keys, key)
+		}
+	}
+
+	for key := range remote.Rows {
+		if _, ok := rows[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, key := range keys {
+		c.lock.Lock()
+		c.different++
+		c.lock.Unlock()
+
+		c.logger.Error.Printf("Row %s of %s is different on node %s", key, table, addr.NodeAddrToString())
+
+		if !c.options.Repair {
+			continue
+		}
+
+		count, err := c.S.Node.RepairRow(table, key)
+
+		if err != nil {
+			c.logger.Error.Printf("Repair of row %s of %s failed: %s", key, table, err.Error())
+			continue
+		}
+		c.logger.Trace.Printf("Row %s of %s restored from %d transactions", key, table, count)
+	}
+	return nil
+}
+
+func (c *rowsChecker) isSameTopBlock(hash []byte) bool {
+	topHash, err := c.S.Node.NodeBC.GetTopBlockHash()
+
+	if err != nil {
+		return false
+	}
+	return bytes.Compare(topHash, hash) == 0
+}
@@ -2,21 +2,42 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"net"
-	"strconv"
+	"net/http"
 	"time"
 
+	"github.com/gelembjuk/oursql/lib/anchoring"
 	"github.com/gelembjuk/oursql/lib/dbproxy"
+	"github.com/gelembjuk/oursql/lib/jsonrpc"
 	netlib "github.com/gelembjuk/oursql/lib/net"
 	"github.com/gelembjuk/oursql/lib/nodeclient"
+	"github.com/gelembjuk/oursql/lib/tracing"
 	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/config"
 	"github.com/gelembjuk/oursql/node/nodemanager"
 )
 
+// Requests of rows checksums a peer can do in the period (seconds). A check of a table with different rows
+// needs a request for each different group
+const (
+	checksumsRequestsLimit  = 200
+	checksumsRequestsPeriod = 600
+)
+
+// Snapshots of the DB a peer can request in the period (seconds). Every snapshot is a dump of all the DB
+const (
+	snapshotsRequestsLimit  = 2
+	snapshotsRequestsPeriod = 3600
+)
+
+// Lengths of a request are sent by a client before auth, a request over the limit is not read
+var errRequestTooLarge = errors.New("Request is too large")
+
 type NodeServer struct {
 	ConfigDir string
 	Node      *nodemanager.Node
@@ -25,6 +46,8 @@ type NodeServer struct {
 	NodePort    int             // This is the port where a server will listen
 
 	Transit nodeTransit
+	// recently seen blocks and transactions
+	Inventory inventoryCache
 
 	Logger *utils.LoggerMan
 	// Channels to manipulate roitunes
@@ -33,12 +56,85 @@ type NodeServer struct {
 
 	changesCheckerObj *changesChecker
 	blocksMakerObj    *blocksMaker
+	binlogMonitorObj  *binlogMonitor
+	rowsCheckerObj    *rowsChecker
+	maintenanceObj    *maintenanceRunner
+	anchoringObj      *anchoringRunner
+	clockCheckerObj   *clockChecker
+	healthCheckerObj  *healthChecker
+	keepaliveObj      *keepaliveRunner
+	manualNodesObj    *manualNodesRunner
+	lanDiscoveryObj   *lanDiscoveryRunner
+	portMapObj        *portMapRunner
 
 	DBProxyAddr string
 	DBAddr      string
 	QueryFilter *queryFilter
 
+	ProfilingAddr   string
+	profilingServer *http.Server
+
+	GraphQLAddr   string
+	graphQLServer *http.Server
+
+	MetricsAddr   string
+	metricsServer *http.Server
+
+	RESTAddr        string
+	RESTAllowOrigin string
+	restServer      *http.Server
+
+	JSONRPC       jsonrpc.Config
+	jsonRPCServer *http.Server
+
+	SubscriptionsAddr   string
+	subscriptionsServer *http.Server
+	subscriptionsObj    *subscriptionsHub
+
+	LocalSocket     string
+	LocalSocketMode string
+	localListener   net.Listener
+
+	WebSocketAddr     string
+	webSocketListener net.Listener
+
+	BinlogMonitor BinlogMonitorOptions
+	RowsCheck     RowsCheckOptions
+	Maintenance   MaintenanceOptions
+	Anchoring     anchoring.Config
+	ClockCheck    ClockCheckOptions
+	Keepalive     KeepaliveOptions
+	WireFormat    string
+	ConnTimeouts  netlib.ConnTimeouts
+	PortMap       netlib.PortMapConfig
+	Banning       netlib.BanConfig
+	PeerLists     netlib.PeerListsConfig
+	LANDiscovery  netlib.LANDiscoveryConfig
+	ConnLimits    netlib.ConnLimits
+	Sync          SyncOptions
+
+	// longest request of a client in bytes. 0 means netlib.DefaultMaxRequestSize
+	MaxRequestSize int64
+
+	// misbehavior points and bans of peers
+	bans *netlib.BanList
+	// requests of rows checksums of each peer
+	checksumsLimiter *netlib.RequestLimiter
+	// requests of snapshots of each peer
+	snapshotsLimiter *netlib.RequestLimiter
+	// whitelisted and blacklisted peers
+	peers *netlib.PeerLists
+	// nodes added with addnode
+	manualNodes *netlib.ManualNodes
+	// open connections of other nodes
+	inbound *netlib.InboundSlots
+
 	NodeAuthStr string
+
+	// cancels requests to other nodes when the server stops
+	cancelRequests context.CancelFunc
+	// nonces of signed requests
+	requestVerifier *netlib.RequestVerifier
 }
 
 func (s *NodeServer) GetClient() *nodeclient.NodeClient {
@@ -48,20 +144,80 @@ func (s *NodeServer) GetClient() *nodeclient.NodeClient {
 
 // handle received data. It can be one way command or a request for some data
 
-func (s *NodeServer) handleConnection(conn net.Conn) {
+func (s *NodeServer) handleConnection(conn net.Conn, local bool) {
 	starttime := time.Now().UnixNano()
 	sessid := utils.RandString(5)
 
 	//s.Logger.Trace.Printf("New command. Start reading %s", sessid)
 
-	command, request, authstring, err := s.readRequest(conn)
+	host := ""
+
+	if !local {
+		host = netlib.PeerHost(conn)
+	}
+
+	whitelisted := s.peers.IsWhitelisted(host)
+
+	if s.peers.IsBlacklisted(host) {
+		s.Logger.TraceExt.Printf("Connection from blacklisted %s is closed", host)
+		conn.Close()
+		return
+	}
+
+	if !whitelisted && s.bans.IsBanned(host) {
+		s.Logger.TraceExt.Printf("Connection from banned %s is closed", host)
+		conn.Close()
+		return
+	}
+
+	if !whitelisted && s.bans.CountRequest(host) {
+		s.misbehaving(host, netlib.BanPointsTooManyRequest, "Too many requests")
+	}
+
+	// whitelisted peers don't take inbound slots, they are always accepted and never evicted
+	if !local && !whitelisted {
+		var ok bool
+
+		conn, ok = s.inbound.Accept(conn, host)
+
+		if !ok {
+			s.Logger.TraceExt.Printf("No free slots for a connection from %s", host)
+			conn.Close()
+			return
+		}
+	}
+
+	// a stalled client can not keep the connection forever
+	conn = netlib.WithDeadlines(conn, s.ConnTimeouts)
+
+	if !local {
+		// traffic with other nodes is limited. it is same limit as for requests of this node
+		conn = s.GetClient().Bandwidth.Wrap(conn, host)
+	}
+
+	command, request, extra, err := s.readRequest(conn)
+
+	if err == errRequestTooLarge {
+		s.misbehaving(host, netlib.BanPointsBadRequest, err.Error())
+	}
 
 	if err != nil {
-		s.sendErrorBack(conn, errors.New("Network Data Reading Error: "+err.Error()))
+		// flags of the request are not known, the error is sent in old format
+		s.sendErrorBack(conn, 0, netlib.WireFormatGob, netlib.NewRemoteError(netlib.ErrorCodeBadRequest, "Network Data Reading Error: "+err.Error()))
 		conn.Close()
 		return
 	}
 
+	_, traceparent, flags, signature := parseExtraData(extra)
+
+	streamed := flags&netlib.RequestFlagStreamResponse > 0
+
+	format := netlib.WireFormatGob
+
+	if flags&netlib.RequestFlagProtobuf > 0 {
+		format = netlib.WireFormatProtobuf
+	}
+
 	s.Logger.TraceExt.Printf("Received %s command", command)
 
 	requestobj := NodeServerRequest{}
@@ -69,154 +225,314 @@ func (s *NodeServer) handleConnection(conn net.Conn) {
 	requestobj.Node.SessionID = sessid
 	requestobj.Logger = s.Logger
 	requestobj.Request = request[:]
-	requestobj.NodeAuthStrIsGood = (s.NodeAuthStr == authstring && len(authstring) > 0)
+	requestobj.NodeAuthStrIsGood = local || s.checkManageAuth(conn, command, request, flags, signature)
 	requestobj.S = s
 	requestobj.S.Node.SessionID = sessid
 	requestobj.SessID = sessid
+	requestobj.WireFormat = format
+
+	if streamed && flags&netlib.RequestFlagChecksum > 0 {
+		requestobj.Stream = netlib.NewCheckedStreamWriter(conn)
+	} else if streamed {
+		requestobj.Stream = netlib.NewStreamWriter(conn)
+	}
 
 	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
 		requestobj.RequestIP = addr.IP.String()
 	}
 	request = nil
 
+	// continue a trace of a client. if it has no trace context, new trace is started
+	parent, _ := tracing.ParseTraceParent(traceparent)
+
+	trace := tracing.NewTrace()
+	span := trace.StartRemote("handle "+command, tracing.KindServer, parent)
+	span.SetAttribute("net.peer.ip", requestobj.RequestIP)
+
+	requestobj.Node.SetTrace(trace)
+
 	// open blockchain. and close in the end ofthis function
 	err = requestobj.Node.DBConn.OpenConnection(sessid)
 
 	if err != nil {
-		s.sendErrorBack(conn, errors.New("Blockchain open Error: "+err.Error()))
+		s.sendErrorBack(conn, flags, format, netlib.NewRemoteError(netlib.ErrorCodeDatabase, "Blockchain open Error: "+err.Error()))
 		conn.Close()
 		return
 	}
 
 	//s.Logger.Trace.Printf("Nodes Network State: %d , %s", len(requestobj.Node.NodeNet.Nodes), requestobj.Node.NodeNet.Nodes)
 
+	rerr := requestobj.handleCommand(command)
+
+	requestobj.Node.DBConn.CloseConnection()
+
+	if !requestobj.NodeAuthStrIsGood {
+		s.misbehaving(host, requestobj.BanPoints, requestobj.BanReason)
+
+		if requestobj.PeerIdentity != "" && !s.peers.IsWhitelisted(host) {
+			// points of a node stay with it when its IP is changed
+			s.misbehaving(identityBanKey(requestobj.PeerIdentity), requestobj.BanPoints, requestobj.BanReason)
+		}
+	}
+
+	// a handler streams a response if there is no prepared response
+	stream := requestobj.Stream
+
+	if stream != nil && !stream.Started() && requestobj.Response != nil {
+		stream = nil
+	}
+
+	if rerr != nil {
+		s.Logger.Error.Println("Network Command Handle Error: ", rerr.Error())
+		s.Logger.Trace.Println("Network Command Handle Error: ", rerr.Error())
+
+		if stream != nil && stream.Started() {
+			// a part of the response is sent, the error ends the stream
+			s.sendStreamErrorBack(stream, format, rerr)
+		} else if requestobj.HasResponse {
+			// return error to the client
+			// first byte is bool false to indicate there was error
+			s.sendErrorBack(conn, flags, format, rerr)
+		}
+	}
+
+	span.End(rerr)
+
+	if stream != nil && requestobj.HasResponse && rerr == nil {
+		err := stream.End()
+
+		if err != nil {
+			s.Logger.Error.Println("Sending response error: ", err.Error())
+		}
+	} else if requestobj.HasResponse && requestobj.Response != nil && rerr == nil {
+		// send this response back
+		// first byte is true to indicate request was success
+		s.Logger.TraceExt.Printf("Responding %d bytes\n", len(requestobj.Response))
+
+		err := netlib.WriteResponseForFlags(conn, flags, true, requestobj.Response)
+
+		if err != nil {
+			s.Logger.Error.Println("Sending response error: ", err.Error())
+		}
+	}
+	duration := time.Since(time.Unix(0, starttime))
+	ms := duration.Nanoseconds() / int64(time.Millisecond)
+	s.Logger.TraceExt.Printf("Complete processing %s command. Time: %d ms, sess %s", command, ms, sessid)
+
+	conn.Close()
+}
+
+// Calls a handler of a command
+func (s *NodeServerRequest) handleCommand(command string) error {
 	var rerr error
 
 	switch command {
 	case nodeclient.CommandAddresses:
-		rerr = requestobj.handleAddr()
+		rerr = s.handleAddr()
 	case "viod":
 		// do nothing
 		s.Logger.Trace.Println("Void command reveived")
 
 	case nodeclient.CommandBlock:
-		rerr = requestobj.handleBlock()
+		rerr = s.handleBlock()
 
 	case nodeclient.CommandGetBlock:
-		rerr = requestobj.handleGetBlock()
+		rerr = s.handleGetBlock()
 
 	case "inv":
-		rerr = requestobj.handleInv()
+		rerr = s.handleInv()
 
 	case "getblocks":
-		rerr = requestobj.handleGetBlocks()
+		rerr = s.handleGetBlocks()
 
 	case "getblocksup":
-		rerr = requestobj.handleGetBlocksUpper()
+		rerr = s.handleGetBlocksUpper()
 
 	case "getdata":
-		rerr = requestobj.handleGetData()
+		rerr = s.handleGetData()
 
 	case "getunspent":
-		rerr = requestobj.handleGetUnspent()
+		rerr = s.handleGetUnspent()
 
 	case "gethistory":
-		rerr = requestobj.handleGetHistory()
+		rerr = s.handleGetHistory()
 
 	case nodeclient.CommandGetBalance:
-		rerr = requestobj.handleGetBalance()
+		rerr = s.handleGetBalance()
 
 	case nodeclient.CommandGetFirstBlocks:
-		rerr = requestobj.handleGetFirstBlocks()
+		rerr = s.handleGetFirstBlocks()
 
 	case nodeclient.CommandGetConsensusData:
-		rerr = requestobj.handleGetConsensusData()
+		rerr = s.handleGetConsensusData()
 
 	case "tx":
-		rerr = requestobj.handleTx()
+		rerr = s.handleTx()
 
 	case "txdata":
-		rerr = requestobj.handleTxData()
+		rerr = s.handleTxData()
 
 	case "txcurrequest":
-		rerr = requestobj.handleTxCurRequest()
+		rerr = s.handleTxCurRequest()
 
 	case "txsqlrequest":
-		rerr = requestobj.handleTxSQLRequest()
+		rerr = s.handleTxSQLRequest()
 
 	case "getnodes":
-		rerr = requestobj.handleGetNodes()
+		rerr = s.handleGetNodes()
 
 	case "addnode":
-		rerr = requestobj.handleAddNode()
+		rerr = s.handleAddNode()
 
 	case "removenode":
-		rerr = requestobj.handleRemoveNode()
+		rerr = s.handleRemoveNode()
 
 	case nodeclient.CommandGetState:
-		rerr = requestobj.handleGetState()
+		rerr = s.handleGetState()
 
 	case nodeclient.CommandGetUpdates:
-		rerr = requestobj.handleGetUpdates()
+		rerr = s.handleGetUpdates()
 
 	case nodeclient.CommandGetTransaction:
-		rerr = requestobj.handleGetTransaction()
+		rerr = s.handleGetTransaction()
 
 	case nodeclient.CommandCheckBlock:
-		rerr = requestobj.handleCheckBlock()
+		rerr = s.handleCheckBlock()
+
+	case nodeclient.CommandGetBlockHeaders:
+		rerr = s.handleGetBlockHeaders()
+
+	case nodeclient.CommandGetTXProof:
+		rerr = s.handleGetTransactionProof()
+
+	case nodeclient.CommandGetName:
+		rerr = s.handleGetName()
+
+	case nodeclient.CommandGetChecksums:
+		rerr = s.handleGetChecksums()
+
+	case nodeclient.CommandGetBlob:
+		rerr = s.handleGetBlob()
+
+	case nodeclient.CommandSetLogs:
+		rerr = s.handleSetLogs()
+
+	case nodeclient.CommandProfile:
+		rerr = s.handleProfile()
+
+	case nodeclient.CommandBatch:
+		rerr = s.handleBatch()
+
+	case nodeclient.CommandPing:
+		rerr = s.handlePing()
+
+	case nodeclient.CommandGetBans:
+		rerr = s.handleGetBans()
+
+	case nodeclient.CommandClearBans:
+		rerr = s.handleClearBans()
+
+	case nodeclient.CommandGetSettings:
+		rerr = s.handleGetSettings()
+
+	case nodeclient.CommandSetSettings:
+		rerr = s.handleSetSettings()
+
+	case nodeclient.CommandGetBlocksStream:
+		rerr = s.handleGetBlocksStream()
+
+	case nodeclient.CommandGetSnapshot:
+		rerr = s.handleGetSnapshot()
+
+	case nodeclient.CommandCompactBlock:
+		rerr = s.handleCompactBlock()
+
+	case nodeclient.CommandGetBlockTxs:
+		rerr = s.handleGetBlockTxs()
 
 	case "version":
-		rerr = requestobj.handleVersion()
+		rerr = s.handleVersion()
 	default:
-		rerr = errors.New("Unknown command!")
+		s.addBanPoints(netlib.BanPointsUnknownCommand, "Unknown command "+command)
+		rerr = netlib.NewRemoteError(netlib.ErrorCodeUnknownCommand, "Unknown command!")
 	}
 
-	requestobj.Node.DBConn.CloseConnection()
+	return rerr
+}
 
-	if rerr != nil {
-		s.Logger.Error.Println("Network Command Handle Error: ", rerr.Error())
-		s.Logger.Trace.Println("Network Command Handle Error: ", rerr.Error())
+// Best score of known nodes on a host. Inbound connections of worse peers are closed first
+func (s *NodeServer) peerScore(host string) float64 {
+	now := time.Now().Unix()
+	score := 0.0
 
-		if requestobj.HasResponse {
-			// return error to the client
-			// first byte is bool false to indicate there was error
-			s.sendErrorBack(conn, rerr)
+	for _, node := range s.Node.NodeNet.GetNodes() {
+		if node.Host == host && node.Score(now) > score {
+			score = node.Score(now)
 		}
 	}
+	return score
+}
 
-	if requestobj.HasResponse && requestobj.Response != nil && rerr == nil {
-		// send this response back
-		// first byte is bool true to indicate request was success
-		dataresponse := append([]byte{1}, requestobj.Response...)
+// Adds points to a peer. It is banned when it has too many points
+func (s *NodeServer) misbehaving(host string, points int, reason string) {
+	if s.peers.IsWhitelisted(host) {
+		s.Logger.Trace.Printf("Whitelisted peer %s is not banned: %s", host, reason)
+		return
+	}
 
-		s.Logger.TraceExt.Printf("Responding %d bytes\n", len(dataresponse))
+	if s.bans.Misbehaving(host, points, reason) {
+		s.Logger.Warning.Printf("Peer %s is banned: %s", host, reason)
+	}
+}
 
-		_, err := conn.Write(dataresponse)
+// Checks if a client can send management commands. When a CA of operators is set, only a certificate signed by it
+// is accepted, in other case a signature with the auth string
+func (s *NodeServer) checkManageAuth(conn net.Conn, command string, request []byte, flags byte, signature []byte) bool {
+	if netlib.ManageCertificateRequired() {
+		return netlib.HasManageCertificate(conn)
+	}
+	return s.checkSignature(command, request, flags, signature)
+}
 
-		if err != nil {
-			s.Logger.Error.Println("Sending response error: ", err.Error())
-		}
+// Checks a signature of a management request. The auth string is not accepted in cleartext
+func (s *NodeServer) checkSignature(command string, request []byte, flags byte, signature []byte) bool {
+	if flags&netlib.RequestFlagSigned == 0 {
+		return false
 	}
-	duration := time.Since(time.Unix(0, starttime))
-	ms := duration.Nanoseconds() / int64(time.Millisecond)
-	s.Logger.TraceExt.Printf("Complete processing %s command. Time: %d ms, sess %s", command, ms, sessid)
 
-	conn.Close()
+	err := s.requestVerifier.Verify(s.NodeAuthStr, command, request, signature)
+
+	if err != nil {
+		s.Logger.Trace.Printf("Signature of %s is not accepted: %s", command, err.Error())
+		return false
+	}
+	return true
+}
+
+// Ends a streamed response with an error
+func (s *NodeServer) sendStreamErrorBack(stream *netlib.StreamWriter, format string, err error) {
+	payload, err := netlib.EncodeErrorResponseAs(format, err)
+
+	if err == nil {
+		err = stream.Fail(payload)
+	}
+
+	if err != nil {
+		s.Logger.Error.Println("Sending response error: ", err.Error())
+	}
 }
 
 // response error to a client
-func (s *NodeServer) sendErrorBack(conn net.Conn, err error) {
+func (s *NodeServer) sendErrorBack(conn net.Conn, flags byte, format string, err error) {
 	s.Logger.Error.Println("Sending back error message: ", err.Error())
 	s.Logger.Trace.Println("Sending back error message: ", err.Error())
 
-	payload, err := netlib.GobEncode(err.Error())
+	payload, err := netlib.EncodeErrorResponseAs(format, err)
 
 	if err == nil {
-		dataresponse := append([]byte{0}, payload...)
-
-		s.Logger.Trace.Printf("Responding %d bytes as error message\n", len(dataresponse))
+		s.Logger.Trace.Printf("Responding %d bytes as error message\n", len(payload))
 
-		_, err = conn.Write(dataresponse)
+		err = netlib.WriteResponseForFlags(conn, flags, false, payload)
 
 		if err != nil {
 			s.Logger.Error.Println("Sending response error: ", err.Error())
@@ -238,6 +554,9 @@ func (s *NodeServer) StartServer(serverStartResult chan string) error {
 
 		return err
 	}
+	// nodes cloned for the DB proxy and routines must have the hook
+	s.Node.OnReorg = s.reorgHappened
+
 	// this channel must be inited here. It is used inside StartDatabaseProxy()
 	// DB proxy wil notify about new transactions using this channel
 	err := s.initBlocksMaker()
@@ -256,16 +575,116 @@ func (s *NodeServer) StartServer(serverStartResult chan string) error {
 		s.Logger.Trace.Printf("DB Proxy was not started, was not requested in config")
 	}
 
+	s.bans, err = netlib.NewBanList(s.Banning, s.ConfigDir+config.BansFileName)
+
+	if err != nil {
+		return returnWithError(err)
+	}
+
+	s.checksumsLimiter = netlib.NewRequestLimiter(checksumsRequestsLimit, checksumsRequestsPeriod)
+	s.snapshotsLimiter = netlib.NewRequestLimiter(snapshotsRequestsLimit, snapshotsRequestsPeriod)
+
+	s.peers, err = netlib.NewPeerLists(s.PeerLists)
+
+	if err != nil {
+		return returnWithError(err)
+	}
+
+	s.manualNodes, err = netlib.NewManualNodes(s.ConfigDir + config.ManualNodesFileName)
+
+	if err != nil {
+		return returnWithError(err)
+	}
+	s.Node.NodeNet.Manual = s.manualNodes
+
+	for _, node := range s.manualNodes.GetNodes() {
+		// they could be aged out before
+		s.Node.NodeNet.AddNodeToKnown(node)
+	}
+
+	s.inbound = netlib.NewInboundSlots(s.ConnLimits, s.peerScore)
+
+	if s.GetClient().Outbound == nil {
+		s.GetClient().Outbound = netlib.NewOutboundSlots(s.ConnLimits)
+	}
+
+	err = s.startProfiling()
+
+	if err != nil {
+		return returnWithError(err)
+	}
+
+	err = s.startGraphQL()
+
+	if err != nil {
+		return returnWithError(err)
+	}
+
+	err = s.startMetrics()
+
+	if err != nil {
+		return returnWithError(err)
+	}
+
+	err = s.startREST()
+
+	if err != nil {
+		return returnWithError(err)
+	}
+
+	err = s.startJSONRPC()
+
+	if err != nil {
+		return returnWithError(err)
+	}
+
+	err = s.startSubscriptions()
+
+	if err != nil {
+		return returnWithError(err)
+	}
+
 	// We listen on a port on all interfaces
-	ln, err := net.Listen(netlib.Protocol, ":"+strconv.Itoa(s.NodePort))
+	ln, err := netlib.Listen(s.NodePort)
 
 	if err != nil {
 		return returnWithError(err)
 	}
 	defer ln.Close()
 
+	err = s.startLocalSocket()
+
+	if err != nil {
+		return returnWithError(err)
+	}
+
+	err = s.startWebSocket()
+
+	if err != nil {
+		return returnWithError(err)
+	}
+
+	err = s.loadIdentity()
+
+	if err != nil {
+		return returnWithError(err)
+	}
+
+	if s.PortMap.Enabled {
+		// the external address must be known before requests to other nodes
+		s.portMapObj = StartPortMap(s, s.PortMap)
+	}
+
 	// client will use the address to include it in requests
+	s.NodeAddress.Services = netlib.ServiceNetwork
 	s.Node.NodeClient.SetNodeAddress(s.NodeAddress)
+	s.Node.NodeClient.WireFormat = s.WireFormat
+
+	var ctx context.Context
+	ctx, s.cancelRequests = context.WithCancel(context.Background())
+	s.Node.NodeClient.SetContext(ctx)
+
+	s.requestVerifier = netlib.NewRequestVerifier()
 
 	s.Node.SendVersionToNodes([]netlib.NodeAddr{})
 
@@ -279,6 +698,47 @@ func (s *NodeServer) StartServer(serverStartResult chan string) error {
 	if err != nil {
 		return returnWithError(err)
 	}
+
+	s.startBinlogMonitor()
+
+	if s.RowsCheck.Interval > 0 {
+		s.rowsCheckerObj = StartRowsChecker(s, s.RowsCheck)
+	}
+
+	if s.Node.DBConn.Config.HealthCheckInterval >= 0 {
+		s.healthCheckerObj = StartHealthChecker(s, s.Node.DBConn.Config.HealthCheckInterval)
+	}
+
+	if s.Maintenance.Window != "" {
+		s.maintenanceObj, err = StartMaintenance(s, s.Maintenance)
+
+		if err != nil {
+			return returnWithError(err)
+		}
+	}
+
+	if s.Keepalive.Interval >= 0 {
+		s.keepaliveObj = StartKeepalive(s, s.Keepalive)
+	}
+
+	s.manualNodesObj = StartManualNodes(s)
+
+	if s.LANDiscovery.Enabled {
+		s.lanDiscoveryObj = StartLANDiscovery(s, s.LANDiscovery)
+	}
+
+	if s.ClockCheck.MaxOffset >= 0 {
+		s.clockCheckerObj = newClockChecker(s, s.ClockCheck)
+		s.Node.BlockMakingCheck = s.clockCheckerObj.checkBlockMaking
+	}
+
+	if s.Anchoring.Adapter != "" {
+		s.anchoringObj, err = StartAnchoring(s, s.Anchoring)
+
+		if err != nil {
+			return returnWithError(err)
+		}
+	}
 	// run blocks maker routine
 	err = s.blocksMakerObj.Start()
 
@@ -311,6 +771,7 @@ func (s *NodeServer) StartServer(serverStartResult chan string) error {
 		}
 
 		if stop {
+			conn.Close()
 
 			// complete all tasks. save data if needed
 			ln.Close()
@@ -321,7 +782,7 @@ func (s *NodeServer) StartServer(serverStartResult chan string) error {
 			break
 		}
 
-		go s.handleConnection(conn)
+		go s.handleConnection(netlib.WrapConn(conn), false)
 	}
 	return nil
 }
@@ -363,6 +824,22 @@ func (s *NodeServer) startChangesChecker() error {
 	return nil
 }
 
+// Binary log monitor to find updates done not by the node. The node works without it if it can not start
+func (s *NodeServer) startBinlogMonitor() {
+	if s.BinlogMonitor.Policy == "" {
+		return
+	}
+
+	var err error
+
+	s.binlogMonitorObj, err = StartBinlogMonitor(s, s.BinlogMonitor)
+
+	if err != nil {
+		s.binlogMonitorObj = nil
+		s.Logger.Error.Printf("Binary log monitor is not started: %s", err.Error())
+	}
+}
+
 // MySQL proxy server. It is in the middle between a DB server and DB client an reads requests
 func (s *NodeServer) initBlocksMaker() error {
 
@@ -373,6 +850,11 @@ func (s *NodeServer) initBlocksMaker() error {
 
 // Stop all sub routines on server stop
 func (s *NodeServer) stopAllSubroutines() {
+	if s.cancelRequests != nil {
+		// requests waiting for other nodes don't block the stop
+		s.cancelRequests()
+	}
+
 	if s.QueryFilter != nil {
 		// MySQL proxy server. It is in the middle between a DB server and DB client an reads requests
 		err := s.QueryFilter.Stop()
@@ -383,11 +865,65 @@ func (s *NodeServer) stopAllSubroutines() {
 		s.QueryFilter = nil
 	}
 
+	s.stopProfiling()
+	s.stopGraphQL()
+	s.stopMetrics()
+	s.stopREST()
+	s.stopJSONRPC()
+	s.stopSubscriptions()
+	s.stopLocalSocket()
+	s.stopWebSocket()
+
 	if s.changesCheckerObj != nil {
 		s.changesCheckerObj.Stop()
 		s.changesCheckerObj = nil
 	}
 
+	if s.binlogMonitorObj != nil {
+		s.binlogMonitorObj.Stop()
+		s.binlogMonitorObj = nil
+	}
+
+	if s.rowsCheckerObj != nil {
+		s.rowsCheckerObj.Stop()
+		s.rowsCheckerObj = nil
+	}
+
+	if s.healthCheckerObj != nil {
+		s.healthCheckerObj.Stop()
+		s.healthCheckerObj = nil
+	}
+
+	if s.keepaliveObj != nil {
+		s.keepaliveObj.Stop()
+		s.keepaliveObj = nil
+	}
+
+	if s.manualNodesObj != nil {
+		s.manualNodesObj.Stop()
+		s.manualNodesObj = nil
+	}
+
+	if s.lanDiscoveryObj != nil {
+		s.lanDiscoveryObj.Stop()
+		s.lanDiscoveryObj = nil
+	}
+
+	if s.portMapObj != nil {
+		s.portMapObj.Stop()
+		s.portMapObj = nil
+	}
+
+	if s.maintenanceObj != nil {
+		s.maintenanceObj.Stop()
+		s.maintenanceObj = nil
+	}
+
+	if s.anchoringObj != nil {
+		s.anchoringObj.Stop()
+		s.anchoringObj = nil
+	}
+
 	if s.blocksMakerObj != nil {
 		s.blocksMakerObj.Stop()
 
@@ -399,12 +935,12 @@ func (s *NodeServer) stopAllSubroutines() {
 }
 
 // Reads and parses request from network data
-func (s *NodeServer) readRequest(conn net.Conn) (string, []byte, string, error) {
+func (s *NodeServer) readRequest(conn net.Conn) (string, []byte, []byte, error) {
 	// 1. Read command
 	commandbuffer, err := s.readFromConnection(conn, netlib.CommandLength)
 
 	if err != nil {
-		return "", nil, "", err
+		return "", nil, nil, err
 	}
 
 	command := netlib.BytesToCommand(commandbuffer)
@@ -414,7 +950,7 @@ func (s *NodeServer) readRequest(conn net.Conn) (string, []byte, string, error)
 	lengthbuffer, err := s.readFromConnection(conn, 4)
 
 	if err != nil {
-		return "", nil, "", err
+		return "", nil, nil, err
 	}
 
 	var datalength uint32
@@ -424,12 +960,17 @@ func (s *NodeServer) readRequest(conn net.Conn) (string, []byte, string, error)
 	lengthbuffer, err = s.readFromConnection(conn, 4)
 
 	if err != nil {
-		return "", nil, "", err
+		return "", nil, nil, err
 	}
 
 	var extradatalength uint32
 	binary.Read(bytes.NewReader(lengthbuffer), binary.LittleEndian, &extradatalength)
 
+	if int64(datalength)+int64(extradatalength) > s.maxRequestSize() {
+		s.Logger.Trace.Printf("Request %s of %d and %d bytes is not read", command, datalength, extradatalength)
+		return "", nil, nil, errRequestTooLarge
+	}
+
 	// 4. read command data by length
 	//s.Logger.Trace.Printf("Before read data %d bytes", datalength)
 
@@ -439,28 +980,54 @@ func (s *NodeServer) readRequest(conn net.Conn) (string, []byte, string, error)
 		databuffer, err = s.readFromConnection(conn, int(datalength))
 
 		if err != nil {
-			return "", nil, "", errors.New(fmt.Sprintf("Error reading %d bytes of request: %s", datalength, err.Error()))
+			return "", nil, nil, errors.New(fmt.Sprintf("Error reading %d bytes of request: %s", datalength, err.Error()))
 		}
 	}
 
 	// 5. read extra data by length
-
-	authstr := ""
+	extradatabuffer := []byte{}
 
 	if extradatalength > 0 {
-		extradatabuffer, err := s.readFromConnection(conn, int(extradatalength))
+		extradatabuffer, err = s.readFromConnection(conn, int(extradatalength))
 
 		if err != nil {
-			return "", nil, "", errors.New(fmt.Sprintf("Error reading %d bytes of extra data: %s", extradatalength, err.Error()))
+			return "", nil, nil, errors.New(fmt.Sprintf("Error reading %d bytes of extra data: %s", extradatalength, err.Error()))
+		}
+	}
+
+	return command, databuffer, extradatabuffer, nil
+}
+
+func (s *NodeServer) maxRequestSize() int64 {
+	if s.MaxRequestSize > 0 {
+		return s.MaxRequestSize
+	}
+	return netlib.DefaultMaxRequestSize
+}
+
+// Extra data is an auth string. It can be followed by a trace context and flags of a request,
+// a signed request has a signature after flags
+func parseExtraData(extra []byte) (authstr string, traceparent string, flags byte, signature []byte) {
+	if len(extra) > netlib.CommandLength {
+		rest := extra[netlib.CommandLength:]
+		extra = extra[:netlib.CommandLength]
+
+		if len(rest) >= tracing.TraceParentLength {
+			traceparent = string(rest[:tracing.TraceParentLength])
+			rest = rest[tracing.TraceParentLength:]
 		}
 
-		authstr = netlib.BytesToCommand(extradatabuffer)
+		if len(rest) > 0 {
+			flags = rest[0]
+			signature = rest[1:]
+		}
 	}
 
-	return command, databuffer, authstr, nil
+	authstr = netlib.BytesToCommand(extra)
+
+	return
 }
 
-// Read given amount of bytes from connection
 func (s *NodeServer) readFromConnection(conn net.Conn, countofbytes int) ([]byte, error) {
 	buff := new(bytes.Buffer)
 
@@ -1,9 +1,65 @@
 package server
 
 import (
+	"bytes"
+	"encoding/binary"
+	"net"
 	"testing"
+
+	netlib "github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/utils"
 )
 
 func TestServerStart(t *testing.T) {
 
 }
+
+func TestReadRequestMaxSize(t *testing.T) {
+	s := &NodeServer{Logger: utils.CreateLogger(), MaxRequestSize: 100}
+
+	tests := []struct {
+		datalength      uint32
+		extradatalength uint32
+		err             error
+	}{
+		{60, 40, nil},
+		{60, 41, errRequestTooLarge},
+		// a length near 4 GB must not be allocated
+		{0xFFFFFFFF, 0xFFFFFFFF, errRequestTooLarge},
+	}
+
+	for _, test := range tests {
+		var request bytes.Buffer
+
+		request.Write(netlib.CommandToBytes("getblocks"))
+		binary.Write(&request, binary.LittleEndian, test.datalength)
+		binary.Write(&request, binary.LittleEndian, test.extradatalength)
+
+		if test.err == nil {
+			request.Write(make([]byte, test.datalength+test.extradatalength))
+		}
+
+		client, server := net.Pipe()
+
+		go func() {
+			client.Write(request.Bytes())
+			client.Close()
+		}()
+
+		command, data, extra, err := s.readRequest(server)
+
+		server.Close()
+
+		if err != test.err {
+			t.Fatalf("Error %v for %d and %d bytes, expected %v", err, test.datalength, test.extradatalength, test.err)
+		}
+
+		if err == nil && (command != "getblocks" || len(data) != int(test.datalength) || len(extra) != int(test.extradatalength)) {
+			t.Fatalf("Request %s of %d and %d bytes", command, len(data), len(extra))
+		}
+	}
+
+	if (&NodeServer{}).maxRequestSize() != netlib.DefaultMaxRequestSize {
+		t.Fatalf("Expected default max size of a request")
+	}
+}
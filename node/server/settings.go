@@ -0,0 +1,119 @@
+package server
+
+/*
+* Settings which can be changed while a node works: logs, limits of connections, size of the pool and intervals
+* of sync. A change can be saved to the config file, then it is used after restart too
+ */
+
+import (
+	"strings"
+
+	netlib "github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/nodeclient"
+	"github.com/gelembjuk/oursql/node/config"
+	"github.com/gelembjuk/oursql/node/consensus"
+)
+
+func (s *NodeServer) getSettings() nodeclient.NodeSettings {
+	inbound := s.inbound.Limits()
+
+	settings := nodeclient.NodeSettings{
+		Logs:        s.Logger.GetState(),
+		MaxInbound:  inbound.Inbound,
+		MaxOutbound: s.GetClient().Outbound.Limits().Outbound,
+		Eviction:    inbound.Eviction,
+		MaxPoolSize: consensus.GetMaxPoolSize(),
+	}
+
+	if settings.Eviction == "" {
+		settings.Eviction = netlib.EvictionScore
+	}
+
+	if settings.MaxPoolSize == 0 {
+		settings.MaxPoolSize = -1
+	}
+
+	sync := s.Sync
+
+	if s.changesCheckerObj != nil {
+		sync = s.changesCheckerObj.GetOptions()
+	}
+	settings.SyncInterval = sync.Interval
+	settings.SyncIntervalNoIncome = sync.IntervalNoIncome
+
+	return settings
+}
+
+// Applies not empty values
+func (s *NodeServer) applySettings(settings nodeclient.NodeSettings) error {
+	if settings.Eviction != "" && settings.Eviction != netlib.EvictionScore && settings.Eviction != netlib.EvictionIdle {
+		return netlib.NewRemoteError(netlib.ErrorCodeBadRequest, "Unknown eviction "+settings.Eviction)
+	}
+
+	if settings.Logs != "" {
+		err := s.Logger.SetLogs(settings.Logs)
+
+		if err != nil {
+			return netlib.NewRemoteError(netlib.ErrorCodeBadRequest, err.Error())
+		}
+	}
+
+	if settings.MaxInbound != 0 || settings.Eviction != "" {
+		limits := s.inbound.Limits()
+
+		if settings.MaxInbound != 0 {
+			limits.Inbound = settings.MaxInbound
+		}
+		if settings.Eviction != "" {
+			limits.Eviction = settings.Eviction
+		}
+		s.inbound.SetLimits(limits)
+	}
+
+	if settings.MaxOutbound != 0 {
+		s.GetClient().Outbound.SetLimits(netlib.ConnLimits{Outbound: settings.MaxOutbound})
+	}
+
+	if settings.MaxPoolSize != 0 {
+		consensus.SetMaxPoolSize(settings.MaxPoolSize)
+	}
+
+	if settings.SyncInterval != 0 || settings.SyncIntervalNoIncome != 0 {
+		if s.changesCheckerObj != nil {
+			s.Sync = s.changesCheckerObj.GetOptions()
+		}
+		if settings.SyncInterval > 0 {
+			s.Sync.Interval = settings.SyncInterval
+		}
+		if settings.SyncIntervalNoIncome > 0 {
+			s.Sync.IntervalNoIncome = settings.SyncIntervalNoIncome
+		}
+		if s.changesCheckerObj != nil {
+			s.changesCheckerObj.SetOptions(s.Sync)
+		}
+	}
+
+	s.Logger.Trace.Printf("Settings are changed: %+v", s.getSettings())
+
+	return nil
+}
+
+// Writes current settings to the config file
+func (s *NodeServer) saveSettings() error {
+	settings := s.getSettings()
+
+	return config.UpdateConfigFile(s.ConfigDir, func(c *config.AppConfig) {
+		c.Logs = []string{}
+
+		if settings.Logs != "" {
+			c.Logs = strings.Split(settings.Logs, ",")
+		}
+
+		c.NodeConnLimits.Inbound = settings.MaxInbound
+		c.NodeConnLimits.Outbound = settings.MaxOutbound
+		c.NodeConnLimits.Eviction = settings.Eviction
+		c.MaxPoolSize = settings.MaxPoolSize
+		c.Sync.Interval = settings.SyncInterval
+		c.Sync.IntervalNoIncome = settings.SyncIntervalNoIncome
+	})
+}
@@ -0,0 +1,120 @@
+package server
+
+/*
+* Snapshots of the DB for new nodes. A dump is made to a temporary file, signed by the identity of the node
+* and streamed by chunks, so a large DB is not in memory.
+* A snapshot has all data of the DB, it is given only to whitelisted peers or with the auth string of the node
+ */
+
+import (
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/nodeclient"
+	"github.com/gelembjuk/oursql/node/nodemanager"
+)
+
+func (s *NodeServerRequest) handleGetSnapshot() error {
+	s.HasResponse = true
+
+	if s.Stream == nil {
+		return net.NewRemoteError(net.ErrorCodeBadRequest, "Streamed response is required")
+	}
+
+	whitelisted := s.S.peers.IsWhitelisted(s.RequestIP)
+
+	if !s.NodeAuthStrIsGood && !whitelisted {
+		return net.NewRemoteError(net.ErrorCodeAuthRequired, "Snapshot is given only to whitelisted peers or with auth")
+	}
+
+	if !whitelisted && !s.S.snapshotsLimiter.Allow(s.RequestIP) {
+		return net.NewRemoteError(net.ErrorCodeTooManyRequest, "Too many snapshot requests")
+	}
+
+	identity := s.Node.NodeClient.Identity
+
+	if identity == nil {
+		return net.NewRemoteError(net.ErrorCodeInternal, "Node has no identity to sign a snapshot")
+	}
+
+	file, err := ioutil.TempFile(s.Node.ConfigDir, "snapshot")
+
+	if err != nil {
+		return err
+	}
+	file.Close()
+
+	defer os.Remove(file.Name())
+
+	info, err := s.Node.MakeSnapshot(file.Name())
+
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(file.Name())
+
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+
+	info.DumpSize, err = io.Copy(hash, f)
+
+	if err != nil {
+		return err
+	}
+	info.DumpHash = hash.Sum(nil)
+	info.Identity = identity.PublicKey()
+	info.Signature = identity.SignMessage(info.SignedParts()...)
+
+	err = s.writeSnapshotChunk(nodeclient.ResponseGetSnapshot{Info: info})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+
+	if err != nil {
+		return err
+	}
+
+	buff := make([]byte, nodemanager.SnapshotChunkSize)
+
+	for {
+		n, err := io.ReadFull(f, buff)
+
+		if n > 0 {
+			if werr := s.writeSnapshotChunk(nodeclient.ResponseGetSnapshot{Data: buff[:n]}); werr != nil {
+				return werr
+			}
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	s.Logger.Trace.Printf("Streamed snapshot of %d bytes on block %x\n", info.DumpSize, info.TopHash)
+
+	return nil
+}
+
+func (s *NodeServerRequest) writeSnapshotChunk(chunk nodeclient.ResponseGetSnapshot) error {
+	data, err := s.encodeResponse(chunk)
+
+	if err != nil {
+		return err
+	}
+	return s.Stream.WriteChunk(data)
+}
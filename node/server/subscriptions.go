@@ -0,0 +1,620 @@
+package server
+
+/*
+* Push notifications for wallets and apps by a WebSocket. A client subscribes to new blocks, transactions of addresses,
+* changes of tables or reorganizations and gets JSON messages, so it doesn't need to poll a node.
+* Changes are found by a watcher which compares the top of the chain and the pool every second, reorganizations
+* are sent by the node when branches are switched
+ */
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	netlib "github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/dbquery/sqlparser"
+	"github.com/gelembjuk/oursql/node/nodemanager"
+	"github.com/gelembjuk/oursql/node/structures"
+)
+
+const (
+	// max blocks notified on one check, if a client was away of a long sync it will load other blocks itself
+	maxNotifiedBlocks = 50
+	// messages waiting to be sent to a client. A client which can not read so fast is disconnected
+	subscriberQueueSize = 256
+	// addresses and tables of one client
+	maxClientSubscriptions = 100
+	subscriberWriteTimeout = 10 * time.Second
+)
+
+// A message of a client
+type subscriptionRequest struct {
+	// subscribe or unsubscribe
+	Action string `json:"action"`
+	// blocks, transactions, table or reorgs
+	Topic string `json:"topic"`
+	// address for transactions. Empty means all transactions
+	Address string `json:"address"`
+	// name of a table. Empty means all tables
+	Table string `json:"table"`
+}
+
+type subscriber struct {
+	conn      net.Conn
+	send      chan []byte
+	blocks    bool
+	reorgs    bool
+	addresses map[string]bool
+	tables    map[string]bool
+}
+
+type subscriptionsHub struct {
+	S            *NodeServer
+	logger       *utils.LoggerMan
+	lock         sync.Mutex
+	clients      map[*subscriber]bool
+	stopped      bool
+	stopChan     chan bool
+	completeChan chan bool
+	lastBlock    []byte
+	// IDs of transactions in the pool on last check. nil if it was not loaded yet
+	pool map[string]bool
+}
+
+// Starts HTTP server for WebSocket subscriptions. It works till the node server stops
+func (s *NodeServer) startSubscriptions() error {
+	if s.SubscriptionsAddr == "" {
+		return nil
+	}
+
+	s.subscriptionsObj = startSubscriptionsHub(s)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.subscriptionsObj.handleClient)
+
+	var err error
+
+	s.subscriptionsServer, err = s.startHTTPServer(s.SubscriptionsAddr, "subscriptions", mux)
+
+	if err != nil {
+		s.subscriptionsObj.Stop()
+		s.subscriptionsObj = nil
+		return err
+	}
+
+	s.Logger.Trace.Printf("Subscriptions are on ws://%s/", s.SubscriptionsAddr)
+
+	return nil
+}
+
+func (s *NodeServer) stopSubscriptions() {
+	if s.subscriptionsServer == nil {
+		return
+	}
+	// hijacked connections are not closed by the HTTP server, the hub closes them
+	s.subscriptionsServer.Close()
+	s.subscriptionsServer = nil
+
+	s.subscriptionsObj.Stop()
+	s.subscriptionsObj = nil
+}
+
+func startSubscriptionsHub(s *NodeServer) (h *subscriptionsHub) {
+	h = &subscriptionsHub{}
+
+	h.S = s
+	h.logger = s.Logger
+	h.clients = map[*subscriber]bool{}
+
+	h.stopChan = make(chan bool)     // to notify routine to stop
+	h.completeChan = make(chan bool) // routine to notify it stopped
+
+	go h.Run()
+
+	return h
+}
+
+// Run function to find new blocks and transactions regularly
+func (h *subscriptionsHub) Run() {
+	for {
+		exit := false
+
+		select {
+		case <-h.stopChan:
+			exit = true
+		default:
+		}
+
+		if exit {
+			break
+		}
+
+		h.check()
+
+		time.Sleep(1 * time.Second)
+	}
+	h.logger.Trace.Printf("Subscriptions Return routine")
+	h.completeChan <- true
+}
+
+func (h *subscriptionsHub) Stop() error {
+	h.logger.Trace.Println("Stop subscriptions")
+
+	close(h.stopChan) // notify routine to stop
+
+	// wait when it is stopped
+	<-h.completeChan
+
+	close(h.completeChan)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.stopped = true
+
+	for c := range h.clients {
+		h.dropClient(c)
+	}
+
+	h.logger.TraceExt.Println("Subscriptions Stopped")
+
+	return nil
+}
+
+// Upgrades a request to a WebSocket and reads messages of the client till it disconnects
+func (h *subscriptionsHub) handleClient(w http.ResponseWriter, r *http.Request) {
+	conn, err := netlib.AcceptWebSocket(w, r, true)
+
+	if err != nil {
+		return
+	}
+
+	c := &subscriber{
+		conn:      conn,
+		send:      make(chan []byte, subscriberQueueSize),
+		addresses: map[string]bool{},
+		tables:    map[string]bool{}}
+
+	h.lock.Lock()
+
+	if h.stopped {
+		h.lock.Unlock()
+		conn.Close()
+		return
+	}
+	h.clients[c] = true
+	h.lock.Unlock()
+
+	h.logger.TraceExt.Printf("Subscriptions client %s connected", r.RemoteAddr)
+
+	go c.writer()
+
+	decoder := json.NewDecoder(conn)
+
+	for {
+		request := subscriptionRequest{}
+
+		err = decoder.Decode(&request)
+
+		if err != nil {
+			break
+		}
+
+		h.sendTo(c, h.processRequest(c, request))
+	}
+
+	h.lock.Lock()
+	h.dropClient(c)
+	h.lock.Unlock()
+
+	h.logger.TraceExt.Printf("Subscriptions client %s disconnected", r.RemoteAddr)
+}
+
+// Changes subscriptions of a client. Returns a response to send
+func (h *subscriptionsHub) processRequest(c *subscriber, request subscriptionRequest) map[string]interface{} {
+	subscribe := request.Action == "subscribe"
+
+	if !subscribe && request.Action != "unsubscribe" {
+		return map[string]interface{}{"error": "Action must be subscribe or unsubscribe"}
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	switch request.Topic {
+	case "blocks":
+		c.blocks = subscribe
+	case "reorgs":
+		c.reorgs = subscribe
+	case "transactions":
+		address := request.Address
+
+		if address != "" {
+			var err error
+
+			if address, err = canonicalAddress(address); err != nil {
+				return map[string]interface{}{"error": "Address is not valid"}
+			}
+		}
+		if !c.set(c.addresses, address, subscribe) {
+			return map[string]interface{}{"error": "Too many subscriptions"}
+		}
+	case "table":
+		if !c.set(c.tables, request.Table, subscribe) {
+			return map[string]interface{}{"error": "Too many subscriptions"}
+		}
+	default:
+		return map[string]interface{}{"error": "Topic must be blocks, transactions, table or reorgs"}
+	}
+
+	return map[string]interface{}{
+		"action":  request.Action + "d",
+		"topic":   request.Topic,
+		"address": request.Address,
+		"table":   request.Table}
+}
+
+func (c *subscriber) set(list map[string]bool, key string, subscribe bool) bool {
+	if !subscribe {
+		delete(list, key)
+		return true
+	}
+
+	if !list[key] && len(c.addresses)+len(c.tables) >= maxClientSubscriptions {
+		return false
+	}
+	list[key] = true
+
+	return true
+}
+
+// Sends messages of the queue. Stops when the queue is closed
+func (c *subscriber) writer() {
+	for data := range c.send {
+		c.conn.SetWriteDeadline(time.Now().Add(subscriberWriteTimeout))
+
+		if _, err := c.conn.Write(data); err != nil {
+			// the reader gets an error too and removes the client
+			c.conn.Close()
+		}
+	}
+}
+
+// Must be called with the lock
+func (h *subscriptionsHub) dropClient(c *subscriber) {
+	if !h.clients[c] {
+		return
+	}
+	delete(h.clients, c)
+	close(c.send)
+	// closing waits for a write in progress, don't keep the lock so long
+	go c.conn.Close()
+}
+
+func (h *subscriptionsHub) sendTo(c *subscriber, message map[string]interface{}) {
+	data, err := json.Marshal(message)
+
+	if err != nil {
+		h.logger.Error.Printf("Subscriptions message error: %s", err.Error())
+		return
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.queue(c, data)
+}
+
+// Must be called with the lock
+func (h *subscriptionsHub) queue(c *subscriber, data []byte) {
+	if !h.clients[c] {
+		return
+	}
+
+	select {
+	case c.send <- data:
+	default:
+		h.logger.Trace.Printf("Subscriptions client %s is too slow, disconnect", c.conn.RemoteAddr())
+		h.dropClient(c)
+	}
+}
+
+// Sends a message to all clients which are subscribed to it
+func (h *subscriptionsHub) publish(message map[string]interface{}, match func(c *subscriber) bool) {
+	data, err := json.Marshal(message)
+
+	if err != nil {
+		h.logger.Error.Printf("Subscriptions message error: %s", err.Error())
+		return
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for c := range h.clients {
+		if match(c) {
+			h.queue(c, data)
+		}
+	}
+}
+
+func (h *subscriptionsHub) hasClients() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return len(h.clients) > 0
+}
+
+// Finds blocks and transactions which were added since last check
+func (h *subscriptionsHub) check() {
+	if !h.hasClients() {
+		// new clients get only new changes
+		h.lastBlock = nil
+		h.pool = nil
+		return
+	}
+
+	node := h.S.Node.Clone()
+	defer node.DBConn.CloseConnection()
+
+	top, err := node.NodeBC.GetTopBlockHash()
+
+	if err != nil {
+		h.logger.TraceExt.Printf("Subscriptions can not get top block: %s", err.Error())
+		return
+	}
+
+	if h.lastBlock != nil && !bytes.Equal(top, h.lastBlock) {
+		blocks := []*structures.Block{}
+		hash := top
+
+		// down to the last notified block. After a fork it is not found, blocks of a new branch are notified
+		for len(hash) > 0 && !bytes.Equal(hash, h.lastBlock) && len(blocks) < maxNotifiedBlocks {
+			block, err := node.NodeBC.GetBlock(hash)
+
+			if err != nil {
+				break
+			}
+			blocks = append(blocks, block)
+			hash = block.PrevBlockHash
+		}
+
+		for i := len(blocks) - 1; i >= 0; i-- {
+			h.blockAdded(blocks[i])
+		}
+	}
+	h.lastBlock = top
+
+	pool := map[string]bool{}
+
+	_, err = node.GetTransactionsManager().ForEachUnapprovedTransaction(func(txhash, txstr string) error {
+		pool[txhash] = true
+		return nil
+	})
+
+	if err != nil {
+		return
+	}
+
+	if h.pool != nil {
+		for id := range pool {
+			if h.pool[id] {
+				continue
+			}
+			h.pendingTransactionAdded(node, id)
+		}
+	}
+	h.pool = pool
+}
+
+func (h *subscriptionsHub) blockAdded(block *structures.Block) {
+	ids := []string{}
+
+	for _, tx := range block.Transactions {
+		ids = append(ids, hex.EncodeToString(tx.GetID()))
+	}
+
+	h.publish(map[string]interface{}{
+		"topic":        "block",
+		"hash":         hex.EncodeToString(block.Hash),
+		"height":       block.Height,
+		"prevHash":     hex.EncodeToString(block.PrevBlockHash),
+		"timestamp":    block.Timestamp,
+		"transactions": ids,
+	}, func(c *subscriber) bool {
+		return c.blocks
+	})
+
+	for i := range block.Transactions {
+		h.transactionAdded(&block.Transactions[i], block.Hash)
+	}
+}
+
+func (h *subscriptionsHub) pendingTransactionAdded(node *nodemanager.Node, id string) {
+	txID, err := hex.DecodeString(id)
+
+	if err != nil {
+		return
+	}
+
+	tx, err := node.GetTransactionsManager().GetIfUnapprovedExists(txID)
+
+	if err != nil || tx == nil {
+		// already in a block
+		return
+	}
+	h.transactionAdded(tx, nil)
+}
+
+// Notifies about a transaction in the pool (blockHash is nil) or in a new block
+func (h *subscriptionsHub) transactionAdded(tx *structures.Transaction, blockHash []byte) {
+	addresses := transactionAddresses(tx)
+
+	h.publish(map[string]interface{}{
+		"topic":     "transaction",
+		"id":        hex.EncodeToString(tx.GetID()),
+		"time":      tx.Time,
+		"addresses": addresses,
+		"pending":   blockHash == nil,
+		"blockHash": hex.EncodeToString(blockHash),
+	}, func(c *subscriber) bool {
+		if c.addresses[""] {
+			return true
+		}
+		for _, address := range addresses {
+			if c.addresses[address] {
+				return true
+			}
+		}
+		return false
+	})
+
+	if !tx.IsSQLCommand() {
+		return
+	}
+
+	table := transactionTable(tx)
+
+	if table == "" {
+		return
+	}
+
+	h.publish(map[string]interface{}{
+		"topic":     "table",
+		"table":     table,
+		"id":        hex.EncodeToString(tx.GetID()),
+		"query":     tx.GetSQLQuery(),
+		"pending":   blockHash == nil,
+		"blockHash": hex.EncodeToString(blockHash),
+	}, func(c *subscriber) bool {
+		return c.tables[""] || c.tables[table]
+	})
+}
+
+// Called by the node when other branch becomes the primary chain
+func (s *NodeServer) reorgHappened(event *nodemanager.ReorgEvent) {
+	s.Logger.Info.Printf("Reorganization from %x to %x, %d blocks canceled", event.OldTop, event.NewTop, len(event.Disconnected))
+
+	if h := s.subscriptionsObj; h != nil && h.hasClients() {
+		h.reorgHappened(event)
+	}
+}
+
+// Notifies about blocks of both branches. Subscribers of tables get canceled changes, new changes come
+// with blocks of the new branch
+func (h *subscriptionsHub) reorgHappened(event *nodemanager.ReorgEvent) {
+	h.publish(map[string]interface{}{
+		"topic":        "reorg",
+		"oldTop":       hex.EncodeToString(event.OldTop),
+		"newTop":       hex.EncodeToString(event.NewTop),
+		"commonBlock":  hex.EncodeToString(event.CommonBlock),
+		"disconnected": reorgBlocksMessage(event.Disconnected),
+		"connected":    reorgBlocksMessage(event.Connected),
+		"tables":       event.Tables,
+	}, func(c *subscriber) bool {
+		return c.reorgs
+	})
+
+	for _, block := range event.Disconnected {
+		for _, change := range block.Changes {
+			if change.Table == "" {
+				continue
+			}
+			table := change.Table
+
+			h.publish(map[string]interface{}{
+				"topic":     "table",
+				"table":     table,
+				"id":        hex.EncodeToString(change.TXID),
+				"key":       change.Key,
+				"operation": change.Operation,
+				"canceled":  true,
+				"reapplied": change.Reapplied,
+				"blockHash": hex.EncodeToString(block.Hash),
+			}, func(c *subscriber) bool {
+				return c.tables[""] || c.tables[table]
+			})
+		}
+	}
+}
+
+func reorgBlocksMessage(blocks []nodemanager.ReorgBlock) []map[string]interface{} {
+	list := []map[string]interface{}{}
+
+	for _, block := range blocks {
+		changes := []map[string]interface{}{}
+
+		for _, change := range block.Changes {
+			changes = append(changes, map[string]interface{}{
+				"id":        hex.EncodeToString(change.TXID),
+				"table":     change.Table,
+				"key":       change.Key,
+				"operation": change.Operation,
+				"reapplied": change.Reapplied})
+		}
+
+		list = append(list, map[string]interface{}{
+			"hash":    hex.EncodeToString(block.Hash),
+			"height":  block.Height,
+			"changes": changes})
+	}
+	return list
+}
+
+// Same address in a form with a key scheme or without it
+func canonicalAddress(address string) (string, error) {
+	pubKeyHash, err := utils.AddresToPubKeyHash(address)
+
+	if err != nil {
+		return "", err
+	}
+	return utils.PubKeyHashToAddres(pubKeyHash)
+}
+
+// A signer and addresses of outputs
+func transactionAddresses(tx *structures.Transaction) []string {
+	addresses := []string{}
+	added := map[string]bool{}
+
+	add := func(address string, err error) {
+		if err == nil {
+			address, err = canonicalAddress(address)
+		}
+		if err == nil && address != "" && !added[address] {
+			added[address] = true
+			addresses = append(addresses, address)
+		}
+	}
+
+	if len(tx.ByPubKey) > 0 {
+		add(utils.PubKeyToAddres(tx.ByPubKey))
+	}
+
+	for _, out := range tx.Vout {
+		add(utils.PubKeyHashToAddres(out.PubKeyHash))
+	}
+	return addresses
+}
+
+// Name of a table changed by SQL transaction, without a DB name
+func transactionTable(tx *structures.Transaction) string {
+	parser := sqlparser.NewSqlParser()
+
+	if parser.Parse(tx.GetSQLQuery()) != nil {
+		return ""
+	}
+
+	table := strings.Replace(parser.GetTable(), "`", "", -1)
+
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		table = table[i+1:]
+	}
+	return table
+}
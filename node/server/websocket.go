@@ -0,0 +1,53 @@
+package server
+
+/*
+* Commands of nodes and wallets by a WebSocket, for clients which can use only HTTP(S). Requests are same
+* as by TCP and need the auth string same way
+ */
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	netlib "github.com/gelembjuk/oursql/lib/net"
+)
+
+// Starts accepting WebSocket connections. It works till the node server stops
+func (s *NodeServer) startWebSocket() error {
+	if s.WebSocketAddr == "" {
+		return nil
+	}
+
+	ln, err := netlib.ListenWebSocket(s.WebSocketAddr)
+
+	if err != nil {
+		return errors.New(fmt.Sprintf("Can not listen WebSocket on %s: %s", s.WebSocketAddr, err.Error()))
+	}
+
+	s.webSocketListener = ln
+
+	go func(ln net.Listener) {
+		for {
+			conn, err := ln.Accept()
+
+			if err != nil {
+				// listener is closed
+				return
+			}
+			go s.handleConnection(netlib.WrapConn(conn), false)
+		}
+	}(ln)
+
+	s.Logger.Trace.Printf("Start listening WebSocket connections on %s", s.WebSocketAddr)
+
+	return nil
+}
+
+func (s *NodeServer) stopWebSocket() {
+	if s.webSocketListener == nil {
+		return
+	}
+	s.webSocketListener.Close()
+	s.webSocketListener = nil
+}
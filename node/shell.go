@@ -0,0 +1,315 @@
+package main
+
+/*
+* Interactive shell. Commands are typed same as in command line, without ./node. SQL queries are typed as is,
+* SELECT is executed on the local DB and other queries are signed by the current wallet and sent as transactions
+ */
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/config"
+	"github.com/gelembjuk/oursql/node/dbquery/sqlparser"
+	"github.com/gelembjuk/oursql/node/server"
+)
+
+// Commands which don't return or start other shells
+var shellNotAllowed = []string{
+	"shell",
+	"interactiveautocreate",
+	"importandstart",
+	"startintnode",
+	"devnet",
+	config.Daemonprocesscommandline}
+
+// Short names of frequent commands
+var shellAliases = map[string]string{
+	"state":   "nodestate",
+	"peers":   "shownodes",
+	"pool":    "unapprovedtransactions",
+	"mempool": "unapprovedtransactions",
+	"balance": "getbalance",
+	"history": "addrhistory",
+	"wallets": "listaddresses",
+}
+
+var shellSQLKeywords = []string{"select", "show", "describe", "desc", "explain",
+	"insert", "update", "delete", "replace", "create", "alter", "drop"}
+
+type nodeShell struct {
+	cli NodeCLI
+	// wallet to sign SQL and send money. It is used when -from or -address is not set
+	wallet string
+}
+
+func (c NodeCLI) commandShell() error {
+	sh := nodeShell{}
+	sh.cli = c
+	sh.wallet = c.Input.Args.From
+
+	if sh.wallet == "" {
+		sh.wallet = c.Input.Args.Address
+	}
+
+	fmt.Println("Type a command without ./node, a SQL query, \"use ADDRESS\" to set a wallet, \"help\" or \"exit\"")
+
+	reader := bufio.NewReader(os.Stdin)
+
+	for {
+		fmt.Print(sh.prompt())
+
+		line, err := reader.ReadString('\n')
+
+		line = strings.TrimSpace(line)
+
+		if line != "" {
+			if line == "exit" || line == "quit" {
+				return nil
+			}
+
+			cerr := sh.execute(line)
+
+			if cerr != nil {
+				fmt.Printf("Error: %s\n", cerr.Error())
+			}
+		}
+
+		if err != nil {
+			// end of input
+			fmt.Println()
+			return nil
+		}
+	}
+}
+
+func (sh *nodeShell) prompt() string {
+	if sh.wallet == "" {
+		return "oursql> "
+	}
+
+	wallet := sh.wallet
+
+	if len(wallet) > 8 {
+		wallet = wallet[:8] + ".."
+	}
+	return "oursql [" + wallet + "]> "
+}
+
+func (sh *nodeShell) execute(line string) error {
+	words := strings.Fields(line)
+	first := strings.ToLower(words[0])
+
+	if first == "help" {
+		sh.cli.Input.PrintUsage()
+		return nil
+	}
+
+	if first == "use" {
+		if len(words) != 2 {
+			return errors.New("Usage: use ADDRESS")
+		}
+		sh.wallet = words[1]
+		return nil
+	}
+
+	if utils.StringInSlice(first, shellSQLKeywords) {
+		return sh.executeSQL(strings.TrimSuffix(line, ";"))
+	}
+
+	args, err := splitShellLine(line)
+
+	if err != nil {
+		return err
+	}
+
+	if command, ok := shellAliases[args[0]]; ok {
+		args[0] = command
+	}
+	return sh.executeCommand(args)
+}
+
+// SELECT is done on the local DB. Other queries are transactions
+func (sh *nodeShell) executeSQL(query string) error {
+	parser := sqlparser.NewSqlParser()
+
+	if parser.Parse(query) == nil && parser.IsRead() {
+		err := sh.cli.CreateNode()
+
+		if err != nil {
+			return err
+		}
+
+		result, err := sh.cli.Node.DBConn.DB().QM().ExecuteSQLSelectResult(query)
+
+		if err != nil {
+			return err
+		}
+		printShellTable(result.Columns, result.Rows)
+		return nil
+	}
+
+	if sh.wallet == "" {
+		return errors.New("Wallet to sign the query is not set. Type: use ADDRESS")
+	}
+	return sh.executeCommand([]string{"sql", "-from", sh.wallet, "-sql", query})
+}
+
+// Executes a command with the node of the shell. Config is parsed again, so arguments of one command
+// don't stay for next commands
+func (sh *nodeShell) executeCommand(args []string) error {
+	if utils.StringInSlice(args[0], shellNotAllowed) {
+		return errors.New(fmt.Sprintf("Command %s can not be used in the shell", args[0]))
+	}
+
+	input, err := config.GetAppInputFromArgs(args, sh.cli.ConfigDir)
+
+	if err != nil {
+		return err
+	}
+
+	if sh.wallet != "" {
+		if input.Args.From == "" {
+			input.Args.From = sh.wallet
+		}
+		if input.Args.Address == "" {
+			input.Args.Address = sh.wallet
+		}
+	}
+
+	cli := sh.cli
+	cli.Input = input
+	cli.Command = input.Command
+
+	// the node server could be started or stopped by previous command
+	nd := server.NodeDaemon{}
+	nd.ConfigDir = cli.ConfigDir
+	nd.Logger = cli.Logger
+
+	cli.AlreadyRunningPort, cli.NodeAuthStr = nd.GetRunningProcessInfo()
+
+	if cli.Node != nil {
+		cli.Node.NodeClient.SetAuthStr(cli.NodeAuthStr)
+	}
+
+	if cli.isInteractiveMode() {
+		err = cli.ExecuteCommand()
+	} else if cli.isNodeManageMode() {
+		err = cli.ExecuteManageCommand()
+	} else {
+		return errors.New(fmt.Sprintf("Unknown command %s", args[0]))
+	}
+
+	if cli.Node != nil {
+		// node is created by first command, next commands use it
+		sh.cli.Node = cli.Node
+	}
+	return err
+}
+
+// Splits a line to arguments. Arguments with spaces are in double or single quotes, \ escapes a quote
+func splitShellLine(line string) ([]string, error) {
+	args := []string{}
+	current := []rune{}
+	var quote rune
+	inArg := false
+	escaped := false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			current = append(current, r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current = append(current, r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, string(current))
+				current = []rune{}
+				inArg = false
+			}
+		default:
+			current = append(current, r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.New("Quote is not closed")
+	}
+
+	if inArg {
+		args = append(args, string(current))
+	}
+
+	if len(args) == 0 {
+		return nil, errors.New("Empty command")
+	}
+	return args, nil
+}
+
+func printShellTable(columns []string, rows [][]sql.NullString) {
+	widths := make([]int, len(columns))
+
+	for i, c := range columns {
+		widths[i] = len(c)
+	}
+
+	cells := [][]string{}
+
+	for _, row := range rows {
+		line := []string{}
+
+		for i, v := range row {
+			s := "NULL"
+
+			if v.Valid {
+				s = v.String
+			}
+
+			if i < len(widths) && len(s) > widths[i] {
+				widths[i] = len(s)
+			}
+			line = append(line, s)
+		}
+		cells = append(cells, line)
+	}
+
+	printRow := func(values []string) {
+		for i, v := range values {
+			if i < len(widths) {
+				fmt.Printf("%-*s  ", widths[i], v)
+			}
+		}
+		fmt.Println()
+	}
+
+	printRow(columns)
+
+	separator := []string{}
+
+	for _, w := range widths {
+		separator = append(separator, strings.Repeat("-", w))
+	}
+	printRow(separator)
+
+	for _, line := range cells {
+		printRow(line)
+	}
+	fmt.Printf("%d rows\n", len(rows))
+}
@@ -0,0 +1,460 @@
+package simulation
+
+/*
+* Many nodes in one process, for integration tests and consensus experiments. Every node has own SQLite database
+* in a folder of the network and a server started in a goroutine. All nodes know each other as peers.
+* Connections can be made in memory instead of TCP on localhost.
+* Some state is global in a process, like network faults and blobs storage, it is same for all nodes
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	stdnet "net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gelembjuk/oursql/lib/net"
+	"github.com/gelembjuk/oursql/lib/remoteclient"
+	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/consensus"
+	"github.com/gelembjuk/oursql/node/database"
+	"github.com/gelembjuk/oursql/node/nodemanager"
+	"github.com/gelembjuk/oursql/node/server"
+)
+
+const (
+	// first port of nodes connected in memory
+	memoryStartPort = 20000
+	// how often state of nodes is checked while waiting
+	waitCheckInterval = 100 * time.Millisecond
+)
+
+type Config struct {
+	Nodes int
+	// folder for databases and logs of nodes. Temporary folder is created and removed on Stop if it is empty
+	Dir string
+	// connect nodes in memory. Otherwise TCP on localhost is used
+	MemoryTransport bool
+	// port of first node, next nodes use next ports. Free ports are used if it is not set
+	StartPort int
+	// consensus of a network. Default is PoW with low complexity and a block for every transaction
+	Consensus *consensus.ConsensusConfig
+	// logs of nodes, like "trace,error". Empty means no logs
+	Logs string
+}
+
+type Node struct {
+	Index   int
+	Address net.NodeAddr
+	// wallet of a node. It gets coins for blocks and signs transactions
+	Minter string
+	Signer utils.Signer
+	Node   *nodemanager.Node
+	Logger *utils.LoggerMan
+
+	// folder of a database, logs and config files of a node
+	Dir    string
+	daemon *server.NodeDaemon
+}
+
+type Network struct {
+	Nodes []*Node
+
+	config  Config
+	dir     string
+	tempDir bool
+}
+
+// Node state which must be same on all nodes when a network converged
+type NodeState struct {
+	TopHash            []byte
+	Height             int
+	TransactionsCached int
+}
+
+// Settings to make blocks fast. A block is made when there is at least one transaction
+func DefaultConsensus() *consensus.ConsensusConfig {
+	c, _ := consensus.NewConfigDefault()
+
+	c.Settings["Complexity"] = 8
+	c.Settings["ComplexityStep2"] = 8
+	c.Settings["MaxMinNumberTransactionInBlock"] = 1
+	c.Settings["MaxNumberTransactionInBlock"] = 100
+	c.Application.Name = "simulation"
+
+	return c
+}
+
+// Creates nodes. Databases are empty, blockchain is created by Start
+func NewNetwork(config Config) (*Network, error) {
+	if config.Nodes < 1 {
+		return nil, errors.New("Number of nodes must be positive")
+	}
+
+	n := &Network{config: config}
+
+	if n.config.Consensus == nil {
+		n.config.Consensus = DefaultConsensus()
+	}
+
+	n.dir = config.Dir
+
+	if n.dir == "" {
+		dir, err := ioutil.TempDir("", "oursqlsim")
+
+		if err != nil {
+			return nil, err
+		}
+		n.dir = dir
+		n.tempDir = true
+	}
+
+	net.UseMemoryTransport(config.MemoryTransport)
+
+	for i := 0; i < config.Nodes; i++ {
+		node, err := n.newNode(i)
+
+		if err != nil {
+			n.cleanup()
+			return nil, err
+		}
+		n.Nodes = append(n.Nodes, node)
+	}
+
+	// all nodes are peers of each other
+	for _, node := range n.Nodes {
+		peers := []net.NodeAddr{}
+
+		for _, p := range n.Nodes {
+			if p != node {
+				peers = append(peers, p.Address)
+			}
+		}
+		node.Node.InitNodes(peers, true)
+	}
+	return n, nil
+}
+
+func (n *Network) newNode(i int) (*Node, error) {
+	node := &Node{Index: i}
+
+	node.Dir = filepath.Join(n.dir, "node"+strconv.Itoa(i)) + string(os.PathSeparator)
+
+	err := os.MkdirAll(node.Dir, 0755)
+
+	if err != nil {
+		return nil, err
+	}
+
+	port := memoryStartPort + i
+
+	if n.config.StartPort > 0 {
+		port = n.config.StartPort + i
+	} else if !n.config.MemoryTransport {
+		port, err = getFreePort()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+	node.Address = net.NewNodeAddr("localhost", port)
+
+	node.Logger = utils.CreateLogger()
+
+	if n.config.Logs != "" {
+		node.Logger.EnableLogs(n.config.Logs)
+		node.Logger.LogToFiles(node.Dir, "log_trace.txt", "log_traceext.txt", "log_info.txt", "log_warning.txt", "log_error.txt")
+	}
+
+	w := remoteclient.Wallet{}
+	w.MakeWallet()
+
+	node.Minter = string(w.GetAddress())
+	node.Signer = w.GetSigner()
+
+	// every node has own copy of consensus. It is replaced with a config of first node on import
+	consensusData, err := json.Marshal(n.config.Consensus)
+
+	if err != nil {
+		return nil, err
+	}
+	consensusFile := node.Dir + "consensus.json"
+
+	err = ioutil.WriteFile(consensusFile, consensusData, 0644)
+
+	if err != nil {
+		return nil, err
+	}
+
+	nm := &nodemanager.Node{}
+
+	nm.ConfigDir = node.Dir
+	nm.Logger = node.Logger
+	nm.MinterAddress = node.Minter
+
+	nm.ConsensusConfig, err = consensus.NewConfigFromFile(consensusFile)
+
+	if err != nil {
+		return nil, err
+	}
+	nm.ConsensusConfig.SetConfigFilePath(consensusFile)
+
+	nm.DBConn = &nodemanager.Database{}
+	nm.DBConn.SetLogger(node.Logger)
+	nm.DBConn.SetConfig(database.DatabaseConfig{Driver: database.DriverSQLite, SQLiteFile: node.Dir + "db.sqlite"})
+	nm.DBConn.Init()
+
+	nm.Init()
+	nm.NodeClient.SetNodeAddress(node.Address)
+
+	node.Node = nm
+
+	return node, nil
+}
+
+// Creates a blockchain on the first node, other nodes import it. Starts servers of all nodes
+func (n *Network) Start() error {
+	first := n.Nodes[0]
+
+	err := first.Node.CreateBlockchain(first.Minter, first.Signer)
+
+	if err != nil {
+		return err
+	}
+
+	for _, node := range n.Nodes {
+		if node != first {
+			_, err = node.Node.InitBlockchainFromOther(first.Address.Host, first.Address.Port)
+
+			if err != nil {
+				return errors.New(fmt.Sprintf("Node %d can not import blockchain: %s", node.Index, err.Error()))
+			}
+		}
+
+		err = node.start()
+
+		if err != nil {
+			return errors.New(fmt.Sprintf("Node %d can not start: %s", node.Index, err.Error()))
+		}
+	}
+	return nil
+}
+
+func (node *Node) start() error {
+	nd := &server.NodeDaemon{}
+
+	nd.ConfigDir = node.Dir
+	nd.Logger = node.Logger
+	nd.Port = node.Address.Port
+	nd.Host = node.Address.Host
+	nd.LocalPort = node.Address.Port
+	nd.Node = node.Node
+	nd.Init()
+
+	err := nd.StartInProcess()
+
+	if err != nil {
+		return err
+	}
+	node.daemon = nd
+
+	return nil
+}
+
+// Stops one node. Other nodes continue to work, it can be started again
+func (node *Node) Stop() error {
+	if node.daemon == nil {
+		return nil
+	}
+	err := node.daemon.StopInProcess()
+
+	node.daemon = nil
+
+	return err
+}
+
+// Starts a node stopped before
+func (node *Node) Start() error {
+	if node.daemon != nil {
+		return nil
+	}
+	return node.start()
+}
+
+func (node *Node) IsRunning() bool {
+	return node.daemon != nil
+}
+
+// Executes SQL query as a transaction signed by the wallet of a node. Returns ID of the transaction.
+// A transaction is added to the pool and a running node tries to make a block, same as for queries from DB proxy
+func (node *Node) SQL(query string) ([]byte, error) {
+	qm, err := node.Node.Clone().GetSQLQueryManager()
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, tx, err := qm.NewQueryByNode(query, node.Signer)
+
+	if err != nil || tx == nil {
+		return nil, err
+	}
+	node.newTransaction(tx.GetID())
+
+	return tx.GetID(), nil
+}
+
+// Sends coins from the wallet of a node to an address
+func (node *Node) Send(to string, amount float64) ([]byte, error) {
+	tx, err := node.Node.Clone().GetTransactionsManager().CreateCurrencyTransaction(node.Signer, to, amount)
+
+	if err != nil {
+		return nil, err
+	}
+	node.newTransaction(tx.GetID())
+
+	return tx.GetID(), nil
+}
+
+// Notifies blocks maker of a running node. If a block is not made the transaction is sent to other nodes
+func (node *Node) newTransaction(txID []byte) {
+	if node.daemon != nil {
+		node.daemon.Server.TryToMakeNewBlock(txID)
+	}
+}
+
+// Returns first row of a SELECT query as strings
+func (node *Node) QueryRow(query string) (map[string]string, error) {
+	return node.Node.Clone().DBConn.DB().QM().ExecuteSQLSelectRow(query)
+}
+
+func (node *Node) GetState() (NodeState, error) {
+	state := NodeState{}
+
+	nm := node.Node.Clone()
+
+	hash, height, err := nm.NodeBC.GetBCManager().GetState()
+
+	if err != nil {
+		return state, err
+	}
+	state.TopHash = hash
+	state.Height = height
+
+	state.TransactionsCached, err = nm.GetTransactionsManager().GetUnapprovedCount()
+
+	return state, err
+}
+
+// Stops all nodes. Removes temporary folder of a network
+func (n *Network) Stop() error {
+	var lastErr error
+
+	for _, node := range n.Nodes {
+		err := node.Stop()
+
+		if err != nil {
+			lastErr = err
+		}
+	}
+	n.cleanup()
+
+	return lastErr
+}
+
+func (n *Network) cleanup() {
+	if n.config.MemoryTransport {
+		net.UseMemoryTransport(false)
+	}
+	if n.tempDir {
+		os.RemoveAll(n.dir)
+	}
+}
+
+// Waits till all running nodes have same top block and no transactions in pools
+func (n *Network) WaitConvergence(timeout time.Duration) error {
+	return n.wait(timeout, func(states []NodeState) bool {
+		for _, s := range states {
+			if s.TransactionsCached > 0 || !bytes.Equal(s.TopHash, states[0].TopHash) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Waits till all running nodes have a block with the height or higher
+func (n *Network) WaitHeight(height int, timeout time.Duration) error {
+	return n.wait(timeout, func(states []NodeState) bool {
+		for _, s := range states {
+			if s.Height < height {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func (n *Network) wait(timeout time.Duration, done func(states []NodeState) bool) error {
+	started := time.Now()
+
+	for {
+		states, err := n.GetStates()
+
+		if err == nil && done(states) {
+			return nil
+		}
+
+		if time.Since(started) > timeout {
+			if err != nil {
+				return err
+			}
+			return errors.New(fmt.Sprintf("Nodes didn't converge in %s. %s", timeout, describeStates(states)))
+		}
+		time.Sleep(waitCheckInterval)
+	}
+}
+
+// States of running nodes
+func (n *Network) GetStates() ([]NodeState, error) {
+	states := []NodeState{}
+
+	for _, node := range n.Nodes {
+		if !node.IsRunning() {
+			continue
+		}
+		s, err := node.GetState()
+
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Node %d state error: %s", node.Index, err.Error()))
+		}
+		states = append(states, s)
+	}
+	return states, nil
+}
+
+func describeStates(states []NodeState) string {
+	s := ""
+
+	for i, state := range states {
+		s += fmt.Sprintf("[%d: height %d, top %x, pool %d] ", i, state.Height, state.TopHash, state.TransactionsCached)
+	}
+	return s
+}
+
+func getFreePort() (int, error) {
+	ln, err := stdnet.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		return 0, err
+	}
+	defer ln.Close()
+
+	return ln.Addr().(*stdnet.TCPAddr).Port, nil
+}
@@ -0,0 +1,147 @@
+package simulation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gelembjuk/oursql/lib/net"
+)
+
+func TestNetworkConvergence(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Network of nodes is slow")
+	}
+
+	network, err := NewNetwork(Config{Nodes: 3, MemoryTransport: true})
+
+	if err != nil {
+		t.Fatalf("Network create error: %s", err.Error())
+	}
+	defer network.Stop()
+
+	err = network.Start()
+
+	if err != nil {
+		t.Fatalf("Network start error: %s", err.Error())
+	}
+
+	_, err = network.Nodes[0].SQL("CREATE TABLE members (id INT NOT NULL PRIMARY KEY, name VARCHAR(100) NOT NULL)")
+
+	if err != nil {
+		t.Fatalf("Create table error: %s", err.Error())
+	}
+
+	err = network.WaitConvergence(20 * time.Second)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	_, err = network.Nodes[1].SQL("INSERT INTO members (id, name) VALUES (1, 'John')")
+
+	if err != nil {
+		t.Fatalf("Insert error: %s", err.Error())
+	}
+
+	err = network.WaitConvergence(20 * time.Second)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for _, node := range network.Nodes {
+		row, err := node.QueryRow("SELECT name FROM members WHERE id = 1")
+
+		if err != nil || row["name"] != "John" {
+			t.Fatalf("Node %d has row %v, error %v", node.Index, row, err)
+		}
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Network of nodes is slow")
+	}
+
+	network, err := NewNetwork(Config{Nodes: 2, MemoryTransport: true})
+
+	if err != nil {
+		t.Fatalf("Network create error: %s", err.Error())
+	}
+	defer network.Stop()
+
+	err = network.Start()
+
+	if err != nil {
+		t.Fatalf("Network start error: %s", err.Error())
+	}
+
+	queries := []string{
+		"CREATE TABLE members (id INT NOT NULL PRIMARY KEY, name VARCHAR(100) NOT NULL, note VARCHAR(100))",
+		"INSERT INTO members (id, name, note) VALUES (1, 'John', NULL)",
+		"INSERT INTO members (id, name, note) VALUES (2, 'Jane', 'a;b')",
+	}
+
+	for _, query := range queries {
+		_, err = network.Nodes[0].SQL(query)
+
+		if err != nil {
+			t.Fatalf("Query %s error: %s", query, err.Error())
+		}
+
+		err = network.WaitConvergence(20 * time.Second)
+
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	source := network.Nodes[0]
+
+	node, err := network.newNode(len(network.Nodes))
+
+	if err != nil {
+		t.Fatalf("Node create error: %s", err.Error())
+	}
+	node.Node.InitNodes([]net.NodeAddr{network.Nodes[1].Address}, true)
+
+	trusted := []string{source.Node.NodeClient.Identity.ID()}
+
+	// a snapshot is not given without the auth string
+	_, err = node.Node.InitBlockchainFromSnapshot(source.Address, trusted)
+
+	if net.GetErrorCode(err) != net.ErrorCodeAuthRequired {
+		t.Fatalf("Snapshot without auth got error %v", err)
+	}
+
+	node.Node.NodeClient.SetAuthStr(source.daemon.Server.NodeAuthStr)
+
+	height, err := node.Node.InitBlockchainFromSnapshot(source.Address, trusted)
+
+	if err != nil {
+		t.Fatalf("Snapshot import error: %s", err.Error())
+	}
+
+	expected, err := source.GetState()
+
+	if err != nil {
+		t.Fatalf("State error: %s", err.Error())
+	}
+
+	if height != expected.Height {
+		t.Fatalf("Snapshot height %d, expected %d", height, expected.Height)
+	}
+
+	rows := map[string]map[string]string{
+		"1": map[string]string{"name": "John", "note": ""},
+		"2": map[string]string{"name": "Jane", "note": "a;b"},
+	}
+
+	for id, expectedRow := range rows {
+		row, err := node.QueryRow("SELECT name, IFNULL(note, '') AS note FROM members WHERE id = " + id)
+
+		if err != nil || row["name"] != expectedRow["name"] || row["note"] != expectedRow["note"] {
+			t.Fatalf("Restored row %s is %v, error %v", id, row, err)
+		}
+	}
+}
@@ -18,6 +18,8 @@ type Block struct {
 	Hash          []byte
 	Nonce         int
 	Height        int
+	// bytes the block was decoded from. They are used again to store or send the block. Not serialized
+	data []byte
 }
 
 // short info about a block. to exchange over network
@@ -162,6 +164,7 @@ func (b *Block) PrepareNewBlock(transactions []Transaction, prevBlockHash []byte
 	b.Hash = []byte{}
 	b.Nonce = 0
 	b.Height = height
+	b.data = nil
 
 	return nil
 }
@@ -185,8 +188,40 @@ func (b *Block) HashTransactions() ([]byte, error) {
 	return mTree.RootNode.Data, nil
 }
 
-// Serialize serializes the block
+// Returns Merkle proof for a transaction in the block. The proof is valid for
+// a root returned by HashTransactions
+func (b *Block) GetTransactionProof(txID []byte) (*utils.MerkleProof, error) {
+	var transactions [][]byte
+
+	index := -1
+
+	for i, tx := range b.Transactions {
+		txser, err := tx.ToBytes()
+
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, txser)
+
+		if bytes.Compare(tx.GetID(), txID) == 0 {
+			index = i
+		}
+	}
+
+	if index < 0 {
+		return nil, errors.New("Transaction is not found in the block")
+	}
+
+	return utils.NewMerkleProof(transactions, index)
+}
+
+// Serialize serializes the block. If the block was decoded from bytes, same bytes are returned,
+// it is not encoded again on every relay to other node
 func (b *Block) Serialize() ([]byte, error) {
+	if len(b.data) > 0 {
+		return b.data, nil
+	}
+
 	var result bytes.Buffer
 
 	gob.Register(&Transaction{})
@@ -204,12 +239,20 @@ func (b *Block) Serialize() ([]byte, error) {
 // DeserializeBlock deserializes a block
 func (b *Block) DeserializeBlock(d []byte) error {
 	gob.Register(&Transaction{})
-	decoder := gob.NewDecoder(bytes.NewReader(d))
+	reader := bytes.NewReader(d)
+	decoder := gob.NewDecoder(reader)
 	err := decoder.Decode(&b)
 
 	if err != nil {
 		return err
 	}
 
+	// bytes after the block are not sent further
+	if reader.Len() == 0 {
+		b.data = d
+	} else {
+		b.data = nil
+	}
+
 	return nil
 }
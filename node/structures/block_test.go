@@ -1,6 +1,7 @@
 package structures
 
 import (
+	"bytes"
 	"testing"
 )
 
@@ -8,6 +9,50 @@ func TestCopyBlock(t *testing.T) {
 
 }
 
+func TestSerializeReusesBytes(t *testing.T) {
+	b := Block{Timestamp: 1, Hash: []byte{1, 2}, PrevBlockHash: []byte{3, 4}, Height: 2}
+
+	data, err := b.Serialize()
+
+	if err != nil {
+		t.Fatalf("Serialize error: %s", err.Error())
+	}
+
+	decoded, err := NewBlockFromBytes(data)
+
+	if err != nil {
+		t.Fatalf("Deserialize error: %s", err.Error())
+	}
+
+	again, _ := decoded.Serialize()
+
+	if &again[0] != &data[0] {
+		t.Fatalf("Received bytes are not reused")
+	}
+
+	// extra bytes after a block are not kept
+	decoded, err = NewBlockFromBytes(append(append([]byte{}, data...), 7, 7))
+
+	if err != nil {
+		t.Fatalf("Deserialize error: %s", err.Error())
+	}
+
+	again, _ = decoded.Serialize()
+
+	if !bytes.Equal(again, data) {
+		t.Fatalf("Block with extra bytes is not encoded again")
+	}
+
+	// new block made from decoded one is encoded again
+	decoded.PrepareNewBlock([]Transaction{}, decoded.Hash, 3)
+
+	again, _ = decoded.Serialize()
+
+	if bytes.Equal(again, data) {
+		t.Fatalf("Old bytes are used for new block")
+	}
+}
+
 /*
 func TestDeserialiseBlock(t *testing.T) {
 	data := []string{
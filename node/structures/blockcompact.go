@@ -0,0 +1,134 @@
+package structures
+
+/*
+* Compact block. It has a header of a block and short IDs of transactions instead of transactions, a node
+* which has them in the pool makes the full block without loading it. Short IDs are hashes of a block hash
+* and a transaction ID, so same transaction has other ID in every block and collisions can not be prepared
+ */
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"fmt"
+)
+
+// Bytes of a short ID of a transaction
+const CompactShortIDLength = 8
+
+type BlockCompact struct {
+	Timestamp     int64
+	PrevBlockHash []byte
+	Hash          []byte
+	Nonce         int
+	Height        int
+	// number of transactions in the block
+	Count int
+	// short IDs of transactions which are not prefilled, in order of transactions
+	ShortIDs [][]byte
+	// transactions which other nodes don't have in a pool, like coinbase
+	Prefilled []PrefilledTransaction
+}
+
+type PrefilledTransaction struct {
+	Index int
+	TX    Transaction
+}
+
+func CompactShortID(blockHash []byte, txID []byte) []byte {
+	hash := sha256.Sum256(append(append([]byte{}, blockHash...), txID...))
+
+	return hash[:CompactShortIDLength]
+}
+
+// Returns compact copy of a block. Coinbase transaction is always prefilled
+func (b *Block) GetCompactCopy() *BlockCompact {
+	bc := BlockCompact{}
+	bc.Timestamp = b.Timestamp
+	bc.PrevBlockHash = b.PrevBlockHash[:]
+	bc.Hash = b.Hash[:]
+	bc.Nonce = b.Nonce
+	bc.Height = b.Height
+	bc.Count = len(b.Transactions)
+
+	for i, tx := range b.Transactions {
+		if tx.IsCoinbaseTransfer() {
+			bc.Prefilled = append(bc.Prefilled, PrefilledTransaction{i, tx})
+			continue
+		}
+		bc.ShortIDs = append(bc.ShortIDs, CompactShortID(b.Hash, tx.GetID()))
+	}
+	return &bc
+}
+
+// Returns short IDs by index of a transaction in the block. Prefilled transactions are not in the map
+func (b *BlockCompact) GetShortIDs() (map[int][]byte, error) {
+	if b.Count != len(b.ShortIDs)+len(b.Prefilled) {
+		return nil, errors.New("Number of transactions of compact block is wrong")
+	}
+
+	prefilled := map[int]bool{}
+
+	for _, p := range b.Prefilled {
+		if p.Index < 0 || p.Index >= b.Count || prefilled[p.Index] {
+			return nil, errors.New(fmt.Sprintf("Wrong index of prefilled transaction %d", p.Index))
+		}
+		prefilled[p.Index] = true
+	}
+
+	ids := map[int][]byte{}
+	next := 0
+
+	for i := 0; i < b.Count; i++ {
+		if prefilled[i] {
+			continue
+		}
+		ids[i] = b.ShortIDs[next]
+		next++
+	}
+	return ids, nil
+}
+
+// Makes a full block. Transactions are in order of the block, prefilled are added here
+func (b *BlockCompact) ToBlock(transactions map[int]Transaction) (*Block, error) {
+	for _, p := range b.Prefilled {
+		transactions[p.Index] = p.TX
+	}
+
+	block := Block{}
+	block.Timestamp = b.Timestamp
+	block.PrevBlockHash = b.PrevBlockHash
+	block.Hash = b.Hash
+	block.Nonce = b.Nonce
+	block.Height = b.Height
+	block.Transactions = []Transaction{}
+
+	for i := 0; i < b.Count; i++ {
+		tx, ok := transactions[i]
+
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("Transaction %d of compact block is missed", i))
+		}
+		block.Transactions = append(block.Transactions, tx)
+	}
+	return &block, nil
+}
+
+func (b *BlockCompact) Serialize() ([]byte, error) {
+	var result bytes.Buffer
+	encoder := gob.NewEncoder(&result)
+
+	err := encoder.Encode(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Bytes(), nil
+}
+
+func (b *BlockCompact) DeserializeBlock(d []byte) error {
+	decoder := gob.NewDecoder(bytes.NewReader(d))
+
+	return decoder.Decode(b)
+}
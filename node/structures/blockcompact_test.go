@@ -0,0 +1,67 @@
+package structures
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompactBlock(t *testing.T) {
+	coinbase := Transaction{ID: []byte{1}, Vin: []TXCurrencyInput{TXCurrencyInput{Txid: []byte{}, Vout: -1}}}
+	tx1 := Transaction{ID: []byte{2}, Time: 10}
+	tx2 := Transaction{ID: []byte{3}, Time: 20}
+
+	b := Block{Timestamp: 1, Hash: []byte{1, 2}, PrevBlockHash: []byte{3, 4}, Height: 2,
+		Transactions: []Transaction{coinbase, tx1, tx2}}
+
+	data, err := b.GetCompactCopy().Serialize()
+
+	if err != nil {
+		t.Fatalf("Serialize error: %s", err.Error())
+	}
+
+	compact, err := NewBlockCompactFromBytes(data)
+
+	if err != nil {
+		t.Fatalf("Deserialize error: %s", err.Error())
+	}
+
+	if len(compact.Prefilled) != 1 || len(compact.ShortIDs) != 2 {
+		t.Fatalf("Coinbase must be prefilled, got %d prefilled and %d short IDs", len(compact.Prefilled), len(compact.ShortIDs))
+	}
+
+	ids, err := compact.GetShortIDs()
+
+	if err != nil {
+		t.Fatalf("Short IDs error: %s", err.Error())
+	}
+
+	if !bytes.Equal(ids[2], CompactShortID(b.Hash, tx2.ID)) {
+		t.Fatalf("Short ID of transaction 2 is wrong")
+	}
+
+	if bytes.Equal(CompactShortID(b.Hash, tx2.ID), CompactShortID([]byte{5}, tx2.ID)) {
+		t.Fatalf("Short ID must depend on a block")
+	}
+
+	_, err = compact.ToBlock(map[int]Transaction{1: tx1})
+
+	if err == nil {
+		t.Fatalf("Block is made without a transaction")
+	}
+
+	block, err := compact.ToBlock(map[int]Transaction{1: tx1, 2: tx2})
+
+	if err != nil {
+		t.Fatalf("Block make error: %s", err.Error())
+	}
+
+	if len(block.Transactions) != 3 || block.Transactions[2].Time != 20 || !block.Transactions[0].IsCoinbaseTransfer() {
+		t.Fatalf("Transactions of the block are wrong")
+	}
+
+	compact.Count = 4
+
+	if _, err = compact.GetShortIDs(); err == nil {
+		t.Fatalf("Wrong number of transactions is not found")
+	}
+}
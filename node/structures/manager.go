@@ -28,6 +28,17 @@ func NewBlockFromBytes(bsdata []byte) (*Block, error) {
 	return bs, nil
 }
 
+// Make compact block from bytes
+func NewBlockCompactFromBytes(bsdata []byte) (*BlockCompact, error) {
+	bc := &BlockCompact{}
+	err := bc.DeserializeBlock(bsdata)
+
+	if err != nil {
+		return nil, err
+	}
+	return bc, nil
+}
+
 // New "currency" transaction.
 func NewTransaction(inputs []TXCurrencyInput, outputs []TXCurrrencyOutput) (*Transaction, error) {
 	tx := &Transaction{}
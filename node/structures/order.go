@@ -0,0 +1,109 @@
+package structures
+
+/*
+* Order of transactions in a block. SQL of a block is executed in this order (and rolled back in reversed order),
+* so a block maker and every node verifying a block must get same order from same transactions:
+*  - transactions are sorted by time, transactions with same time by ID
+*  - a transaction goes after transactions of the block it is based on (spends output or changes same row)
+*  - coinbase transaction is the last
+ */
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Sorts transactions by time and moves a transaction after transactions from the list it is based on.
+// It can be based on other transaction if it spends its output or updates same SQL row
+func SortTransactionsByDependencies(txset []*Transaction) []*Transaction {
+	sort.SliceStable(txset, func(i, j int) bool {
+		if txset[i].GetTime() != txset[j].GetTime() {
+			return txset[i].GetTime() < txset[j].GetTime()
+		}
+		return bytes.Compare(txset[i].GetID(), txset[j].GetID()) < 0
+	})
+
+	byID := make(map[string]*Transaction)
+
+	for _, tx := range txset {
+		byID[string(tx.GetID())] = tx
+	}
+
+	result := make([]*Transaction, 0, len(txset))
+	added := make(map[string]bool)
+
+	var add func(tx *Transaction)
+
+	add = func(tx *Transaction) {
+		id := string(tx.GetID())
+
+		if added[id] {
+			return
+		}
+		// mark before parents are added. it protects from a loop if the pool has bad data
+		added[id] = true
+
+		parents := [][]byte{}
+
+		for _, vin := range tx.Vin {
+			parents = append(parents, vin.Txid)
+		}
+
+		if len(tx.GetSQLBaseTX()) > 0 {
+			parents = append(parents, tx.GetSQLBaseTX())
+		}
+
+		for _, parentID := range parents {
+			if parent, ok := byID[string(parentID)]; ok {
+				add(parent)
+			}
+		}
+		result = append(result, tx)
+	}
+
+	for _, tx := range txset {
+		add(tx)
+	}
+
+	return result
+}
+
+// Returns transactions of a block in the order of execution. Coinbase transaction is moved to the end
+func SortBlockTransactions(transactions []Transaction) []Transaction {
+	list := []*Transaction{}
+
+	var coinbase *Transaction
+
+	for i := range transactions {
+		if transactions[i].IsCoinbaseTransfer() && coinbase == nil {
+			coinbase = &transactions[i]
+			continue
+		}
+		list = append(list, &transactions[i])
+	}
+
+	result := []Transaction{}
+
+	for _, tx := range SortTransactionsByDependencies(list) {
+		result = append(result, *tx)
+	}
+
+	if coinbase != nil {
+		result = append(result, *coinbase)
+	}
+	return result
+}
+
+// Error if transactions of a block are not in the order of execution
+func CheckBlockTransactionsOrder(transactions []Transaction) error {
+	expected := SortBlockTransactions(transactions)
+
+	for i, tx := range transactions {
+		if !bytes.Equal(tx.GetID(), expected[i].GetID()) {
+			return errors.New(fmt.Sprintf("Transaction %x is at position %d, expected %x there. Transactions are not in order of execution", tx.GetID(), i, expected[i].GetID()))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package structures
+
+import (
+	"testing"
+)
+
+func makeOrderTestTX(id byte, time int64, base byte) Transaction {
+	tx := Transaction{ID: []byte{id}, Time: time}
+
+	if base > 0 {
+		tx.SQLBaseTX = []byte{base}
+	}
+	return tx
+}
+
+func orderIDs(list []Transaction) []byte {
+	ids := []byte{}
+
+	for _, tx := range list {
+		ids = append(ids, tx.ID[0])
+	}
+	return ids
+}
+
+func TestSortBlockTransactions(t *testing.T) {
+	coinbase := Transaction{ID: []byte{9}, Time: 1, Vin: []TXCurrencyInput{TXCurrencyInput{[]byte{}, -1}}}
+
+	// 4 updates a row inserted by 3, but has earlier time. 2 and 1 have same time
+	list := []Transaction{
+		coinbase,
+		makeOrderTestTX(4, 10, 3),
+		makeOrderTestTX(2, 20, 0),
+		makeOrderTestTX(3, 30, 0),
+		makeOrderTestTX(1, 20, 0),
+		makeOrderTestTX(5, 40, 4),
+	}
+
+	sorted := SortBlockTransactions(list)
+
+	expected := []byte{3, 4, 1, 2, 5, 9}
+
+	if string(orderIDs(sorted)) != string(expected) {
+		t.Fatalf("Got order %v, expected %v", orderIDs(sorted), expected)
+	}
+
+	// with other order of input, the result is same
+	reversed := []Transaction{}
+
+	for i := len(list) - 1; i >= 0; i-- {
+		reversed = append(reversed, list[i])
+	}
+
+	if string(orderIDs(SortBlockTransactions(reversed))) != string(expected) {
+		t.Fatalf("Got order %v for reversed list, expected %v", orderIDs(SortBlockTransactions(reversed)), expected)
+	}
+
+	if err := CheckBlockTransactionsOrder(sorted); err != nil {
+		t.Fatalf("Sorted list is not accepted: %s", err.Error())
+	}
+
+	if err := CheckBlockTransactionsOrder(list); err == nil {
+		t.Fatalf("List in wrong order is accepted")
+	}
+}
+
+func TestSortTransactionsByCurrencyInput(t *testing.T) {
+	// 2 spends output of 1
+	tx1 := makeOrderTestTX(1, 20, 0)
+	tx2 := makeOrderTestTX(2, 10, 0)
+	tx2.Vin = []TXCurrencyInput{TXCurrencyInput{[]byte{1}, 0}}
+
+	sorted := SortBlockTransactions([]Transaction{tx2, tx1})
+
+	if string(orderIDs(sorted)) != string([]byte{1, 2}) {
+		t.Fatalf("Got order %v, expected [1 2]", orderIDs(sorted))
+	}
+}
@@ -160,6 +160,18 @@ func (tx *Transaction) CompleteTransaction(signature []byte) error {
 // And total amount of inputs and outputs
 // TODO in future to replace coinstoadd with some Config structure where all external things for verify are included
 func (tx *Transaction) Verify(prevTXs map[int]*Transaction, coinstoadd float64) error {
+	if !tx.IsCoinbaseTransfer() {
+		err := tx.VerifySignature()
+
+		if err != nil {
+			return err
+		}
+	}
+	return tx.VerifyInputs(prevTXs, coinstoadd)
+}
+
+// Same as Verify but without the signature check. It is used when the signature was checked before
+func (tx *Transaction) VerifyInputs(prevTXs map[int]*Transaction, coinstoadd float64) error {
 	if tx.IsCoinbaseTransfer() {
 		// coinbase has only 1 output and it must have value equal to constant
 		if tx.Vout[0].Value != coinstoadd {
@@ -182,30 +194,6 @@ func (tx *Transaction) Verify(prevTXs map[int]*Transaction, coinstoadd float64)
 		amount := prevTx.Vout[vin.Vout].Value
 		totalinput += amount
 	}
-	// VERIFY signature
-	// build copy to make sign data
-	txCopy, err := tx.Copy()
-	if err != nil {
-		return err
-	}
-	txCopy.Signature = []byte{}
-	txCopy.ID = []byte{}
-
-	stringtosign, err := txCopy.ToBytes()
-
-	if err != nil {
-		return err
-	}
-
-	v, err := utils.VerifySignature(tx.Signature, stringtosign, tx.ByPubKey)
-
-	if err != nil {
-		return err
-	}
-
-	if !v {
-		return errors.New(fmt.Sprintf("Signatire doe not match for TX %x.", tx.GetID()))
-	}
 
 	pubKeyHash, _ := utils.HashPubKey(tx.ByPubKey)
 
@@ -235,6 +223,40 @@ func (tx *Transaction) Verify(prevTXs map[int]*Transaction, coinstoadd float64)
 	return nil
 }
 
+// Verifies signature of a transaction. It doesn't need inputs, so it can be done before other checks
+func (tx *Transaction) VerifySignature() error {
+	stringtosign, err := tx.GetSignData()
+
+	if err != nil {
+		return err
+	}
+
+	v, err := utils.VerifySignature(tx.Signature, stringtosign, tx.ByPubKey)
+
+	if err != nil {
+		return err
+	}
+
+	if !v {
+		return errors.New(fmt.Sprintf("Signatire doe not match for TX %x.", tx.GetID()))
+	}
+
+	return nil
+}
+
+// Returns data which are signed by an author of the transaction. It is same as PrepareSignData returns
+func (tx Transaction) GetSignData() ([]byte, error) {
+	// build copy to make sign data
+	txCopy, err := tx.Copy()
+	if err != nil {
+		return nil, err
+	}
+	txCopy.Signature = []byte{}
+	txCopy.ID = []byte{}
+
+	return txCopy.ToBytes()
+}
+
 // Serialize returns a serialized Transaction
 func (tx Transaction) serialize() ([]byte, error) {
 	// to remove any references to other ponters
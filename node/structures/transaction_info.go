@@ -7,4 +7,8 @@ type TransactionsHistory struct {
 	TXID    []byte
 	Address string
 	Value   float64
+	// info about a block where TX is included
+	Time        int64
+	BlockHash   []byte
+	BlockHeight int
 }
@@ -0,0 +1,48 @@
+package transactions
+
+import (
+	"sync"
+
+	"github.com/gelembjuk/oursql/node/database"
+	"github.com/gelembjuk/oursql/node/structures"
+)
+
+// Queries of blocks stopped by the apply timeout. The last TX is kept to find a bad query
+var (
+	applyTimeoutsLock   sync.Mutex
+	applyTimeoutsCount  int64
+	applyTimeoutsLastTX []byte
+)
+
+// Returns number of timed out queries and ID of the last TX
+func GetApplyTimeouts() (int64, []byte) {
+	applyTimeoutsLock.Lock()
+	defer applyTimeoutsLock.Unlock()
+
+	return applyTimeoutsCount, applyTimeoutsLastTX
+}
+
+// Logs failed query of a block with ID of TX. Timeouts are counted
+func (n *txManager) logApplyError(tx structures.Transaction, operation string, err error) {
+	n.Logger.Error.Printf("Error when execute SQL of TX %x on %s: %s", tx.GetID(), operation, err.Error())
+
+	if dberr, ok := err.(*database.DBError); !ok || !dberr.IsKind(database.DBTimeoutError) {
+		return
+	}
+
+	applyTimeoutsLock.Lock()
+	defer applyTimeoutsLock.Unlock()
+
+	applyTimeoutsCount++
+	applyTimeoutsLastTX = tx.GetID()
+}
+
+// Error of queries of a block executed together. failed is index of a TX with the failed query,
+// -1 if the error is not related to some query
+func (n *txManager) logApplyListError(txList []structures.Transaction, failed int, operation string, err error) {
+	if failed >= 0 && failed < len(txList) {
+		n.logApplyError(txList[failed], operation, err)
+		return
+	}
+	n.Logger.Error.Printf("Error when execute SQL of a block on %s: %s", operation, err.Error())
+}
@@ -0,0 +1,109 @@
+package transactions
+
+import (
+	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/blockchain"
+	"github.com/gelembjuk/oursql/node/database"
+	"github.com/gelembjuk/oursql/node/structures"
+)
+
+// Keeps the audit log of SQL transactions of blocks in the primary chain.
+// A record says who signed a query and in which block it was applied
+
+type auditLog struct {
+	DB     database.DBManager
+	Logger *utils.LoggerMan
+}
+
+// Block is added to the primary chain. Save records for all SQL transactions, also for ones executed from the pool
+func (al auditLog) UpdateOnBlockAdd(block *structures.Block) error {
+	aldb, err := al.DB.GetAuditLogObject()
+
+	if err != nil {
+		return err
+	}
+
+	records := []database.AuditRecord{}
+
+	for _, tx := range block.Transactions {
+		if !tx.IsSQLCommand() {
+			continue
+		}
+
+		r := database.AuditRecord{}
+		r.TXID = tx.GetID()
+		r.BlockHash = block.Hash
+		r.BlockHeight = block.Height
+		r.BlockTime = block.Timestamp
+		r.TXTime = tx.GetTime()
+		r.PubKey = tx.ByPubKey
+		r.RefID = string(tx.SQLCommand.ReferenceID)
+		r.Query = string(tx.SQLCommand.Query)
+
+		// address is only for convenience, a record is saved without it if a key is bad
+		r.Address, _ = utils.PubKeyToAddres(tx.ByPubKey)
+
+		records = append(records, r)
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	al.Logger.Trace.Printf("Audit log on block add %x, %d records", block.Hash, len(records))
+
+	return aldb.AddRecords(records)
+}
+
+// Block Removed Fom Main branch. Its queries are rolled back or returned to the pool
+func (al auditLog) UpdateOnBlockCancel(block *structures.Block) error {
+	aldb, err := al.DB.GetAuditLogObject()
+
+	if err != nil {
+		return err
+	}
+
+	al.Logger.Trace.Printf("Audit log on block remove %x", block.Hash)
+
+	return aldb.DeleteBlockRecords(block.Hash)
+}
+
+// Builds the log again from blocks of the primary chain. Returns number of records
+func (al auditLog) Reindex() (int, error) {
+	aldb, err := al.DB.GetAuditLogObject()
+
+	if err != nil {
+		return 0, err
+	}
+
+	err = aldb.TruncateDB()
+
+	if err != nil {
+		return 0, err
+	}
+
+	bci, err := blockchain.NewBlockchainIterator(al.DB)
+
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		block, err := bci.Next()
+
+		if err != nil {
+			return 0, err
+		}
+
+		err = al.UpdateOnBlockAdd(block)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+	return aldb.GetCount()
+}
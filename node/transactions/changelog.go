@@ -0,0 +1,156 @@
+package transactions
+
+import (
+	"strings"
+
+	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/blockchain"
+	"github.com/gelembjuk/oursql/node/database"
+	"github.com/gelembjuk/oursql/node/dbquery/sqlparser"
+	"github.com/gelembjuk/oursql/node/structures"
+)
+
+// Keeps the log of data changes made by SQL transactions of blocks in the primary chain.
+// Indexers read it by a cursor and don't need to parse blocks
+
+type changeLog struct {
+	DB     database.DBManager
+	Logger *utils.LoggerMan
+}
+
+// Block is added to the primary chain. Events in order of transactions
+func (cl changeLog) UpdateOnBlockAdd(block *structures.Block) error {
+	return cl.addEvents(block, false)
+}
+
+// Block is removed from the primary chain. Events of canceled transactions in reversed order,
+// same as their rollback queries are executed
+func (cl changeLog) UpdateOnBlockCancel(block *structures.Block) error {
+	return cl.addEvents(block, true)
+}
+
+func (cl changeLog) addEvents(block *structures.Block, canceled bool) error {
+	cldb, err := cl.DB.GetChangeLogObject()
+
+	if err != nil {
+		return err
+	}
+
+	events := []database.ChangeEvent{}
+
+	for _, tx := range block.Transactions {
+		if !tx.IsSQLCommand() {
+			continue
+		}
+
+		e := database.ChangeEvent{}
+		e.TXID = tx.GetID()
+		e.BlockHash = block.Hash
+		e.BlockHeight = block.Height
+		e.Canceled = canceled
+		e.Table, e.Key, e.Operation = GetChangeOfTransaction(tx)
+
+		if canceled {
+			events = append([]database.ChangeEvent{e}, events...)
+		} else {
+			events = append(events, e)
+		}
+	}
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	cl.Logger.Trace.Printf("Change log on block %x, %d events, canceled %v", block.Hash, len(events), canceled)
+
+	return cldb.AddEvents(events)
+}
+
+// Table and row key are from a reference ID, like table:key. Key is * for table operations, it is empty in the log
+func GetChangeOfTransaction(tx structures.Transaction) (table string, key string, operation string) {
+	refID := string(tx.SQLCommand.ReferenceID)
+
+	if i := strings.Index(refID, ":"); i >= 0 {
+		table = refID[:i]
+		key = refID[i+1:]
+	} else {
+		table = refID
+	}
+
+	if key == "*" {
+		key = ""
+	}
+
+	operation = sqlparser.QueryKindOther
+
+	parser := sqlparser.NewSqlParser()
+
+	if parser.Parse(tx.GetSQLQuery()) == nil {
+		operation = parser.GetKind()
+
+		if table == "" {
+			table = parser.GetTable()
+		}
+	}
+	return
+}
+
+// Builds the log again from blocks of the primary chain, from first block. Cursors of readers are not valid after it.
+// Returns number of events
+func (cl changeLog) Reindex() (int, error) {
+	cldb, err := cl.DB.GetChangeLogObject()
+
+	if err != nil {
+		return 0, err
+	}
+
+	err = cldb.TruncateDB()
+
+	if err != nil {
+		return 0, err
+	}
+
+	bci, err := blockchain.NewBlockchainIterator(cl.DB)
+
+	if err != nil {
+		return 0, err
+	}
+
+	// iterator goes from the top. hashes are collected to add events from first block
+	hashes := [][]byte{}
+
+	for {
+		block, err := bci.Next()
+
+		if err != nil {
+			return 0, err
+		}
+
+		hashes = append(hashes, block.Hash)
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	bcMan, err := blockchain.NewBlockchainManager(cl.DB, cl.Logger)
+
+	if err != nil {
+		return 0, err
+	}
+
+	for i := len(hashes) - 1; i >= 0; i-- {
+		block, err := bcMan.GetBlock(hashes[i])
+
+		if err != nil {
+			return 0, err
+		}
+
+		err = cl.UpdateOnBlockAdd(&block)
+
+		if err != nil {
+			return 0, err
+		}
+	}
+	return cldb.GetCount()
+}
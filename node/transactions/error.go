@@ -4,6 +4,8 @@ package transactions
 
 import (
 	"fmt"
+
+	"github.com/gelembjuk/oursql/lib/net"
 )
 
 const TXVerifyErrorNoInput = "noinput"
@@ -61,6 +63,25 @@ func (e TXVerifyError) IsKind(kind string) bool {
 	return e.kind == kind
 }
 
+// Codes of errors in responses to other nodes
+func (e TXVerifyError) ErrorCode() int {
+	if e.kind == TXSQLBaseDifferentError {
+		return net.ErrorCodeSQLBaseDifferent
+	}
+	return net.ErrorCodeTransactionVerify
+}
+
+func (e *TXNotFoundError) ErrorCode() int {
+	return net.ErrorCodeNotFound
+}
+
+func (e *TXPrepareError) ErrorCode() int {
+	if e.kind == TXPrepareNoFundsError {
+		return net.ErrorCodeNoEnoughFunds
+	}
+	return net.ErrorCodeTransactionVerify
+}
+
 func (e *TXNotFoundError) GetKind() string {
 	return e.kind
 }
@@ -468,6 +468,24 @@ func (ti *transactionsIndex) GetCurrencyTransactionAllInfo(txID []byte, topHash
 	return tx, spentOuts, blockHash, nil
 }
 
+// Get hash of a block where TX is included. Only primary branch is checked
+// Returns nil if TX is not found in the primary branch
+func (ti *transactionsIndex) GetTransactionBlock(txID []byte) ([]byte, error) {
+	blockHashes, err := ti.GetTranactionBlocks(txID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bcMan, err := blockchain.NewBlockchainManager(ti.DB, ti.Logger)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return bcMan.ChooseHashUnderTip(blockHashes, []byte{})
+}
+
 // Get TX object from BC under given topHash
 func (ti *transactionsIndex) GetTransaction(txID []byte, topHash []byte) (*structures.Transaction, error) {
 	localError := func(err error) (*structures.Transaction, error) {
@@ -1,9 +1,9 @@
 package transactions
 
 import (
-	"crypto/ecdsa"
-
 	"github.com/gelembjuk/oursql/lib/remoteclient"
+	"github.com/gelembjuk/oursql/lib/utils"
+	"github.com/gelembjuk/oursql/node/database"
 	"github.com/gelembjuk/oursql/node/structures"
 )
 
@@ -19,15 +19,24 @@ type TransactionsManagerInterface interface {
 	GetUnapprovedTransactionsFiltered(minCreateTime int64, maxCount int, ignoreTransactions [][]byte) ([][]byte, error)
 	GetIfExists(txid []byte) (*structures.Transaction, error)
 	GetIfUnapprovedExists(txid []byte) (*structures.Transaction, error)
+	// Returns hash of a block in primary branch where a transaction is included
+	GetTransactionBlock(txid []byte) ([]byte, error)
+	// Returns SQL transactions which changed a row, from first to last. Transactions from the pool are included
+	GetRowHistory(refID []byte) ([]*structures.Transaction, error)
+	// Reference IDs of rows changed by transactions in the pool
+	GetUnapprovedSQLReferences() ([][]byte, error)
+	// Events of data changes with ID after the cursor, from the change log
+	GetChangeEvents(after int64, limit int) ([]database.ChangeEvent, error)
 
 	VerifyTransaction(tx *structures.Transaction, prevtxs []structures.Transaction, tip []byte, flags int) (bool, error)
 
 	ForEachUnspentOutput(address string, callback UnspentTransactionOutputCallbackInterface) error
+	ForEachUnspent(callback func(out structures.TXOutputIndependent) error) error
 	ForEachUnapprovedTransaction(callback UnApprovedTransactionCallbackInterface) (int, error)
 
 	// Create transaction methods
-	CreateCurrencyTransaction(PubKey []byte, privKey ecdsa.PrivateKey, to string, amount float64) (*structures.Transaction, error)
-	PrepareNewCurrencyTransaction(PubKey []byte, to string, amount float64) ([]byte, []byte, error)
+	CreateCurrencyTransaction(signer utils.Signer, to string, amount float64) (*structures.Transaction, error)
+	PrepareNewCurrencyTransaction(PubKey []byte, to string, amount float64, change string) ([]byte, []byte, error)
 	AddNewTransaction(tx *structures.Transaction, flags int) error
 	PrepareNewSQLTransaction(PubKey []byte, sqlUpdate structures.SQLUpdate, amount float64, to string) ([]byte, []byte, error)
 	PrepareSQLTransactionSignatureData(tx *structures.Transaction) (txBytes []byte, datatosign []byte, err error)
@@ -2,7 +2,6 @@ package transactions
 
 import (
 	"bytes"
-	"crypto/ecdsa"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -69,6 +68,15 @@ func (n txManager) getDataRowsAndTransacionsManager() *rowsToTransactions {
 	return &rowsToTransactions{n.DB, n.Logger}
 }
 
+// Create audit log manage object to use in this package
+func (n txManager) getAuditLogManager() *auditLog {
+	return &auditLog{n.DB, n.Logger}
+}
+
+func (n txManager) getChangeLogManager() *changeLog {
+	return &changeLog{n.DB, n.Logger}
+}
+
 // Reindex caches
 func (n *txManager) ReindexData() (map[string]int, error) {
 	err := n.getIndexManager().Reindex()
@@ -85,6 +93,18 @@ func (n *txManager) ReindexData() (map[string]int, error) {
 
 	info := map[string]int{"unspentoutputs": count}
 
+	info["auditlog"], err = n.getAuditLogManager().Reindex()
+
+	if err != nil {
+		return nil, err
+	}
+
+	info["changelog"], err = n.getChangeLogManager().Reindex()
+
+	if err != nil {
+		return nil, err
+	}
+
 	return info, nil
 }
 
@@ -146,8 +166,8 @@ func (n *txManager) GetUnapprovedTransactionsForNewBlock(number int) ([]structur
 		vtx, err := n.VerifyTransaction(tx, txs, []byte{}, lib.TXFlagsNothing)
 
 		if err != nil {
-			// this can be case when a transaction is based on other unapproved transaction
-			// and that transaction was created in same second
+			// transactions are ordered so a parent is always before. this can be case when
+			// a transaction is based on other unapproved transaction and that one was invalid
 			n.Logger.Trace.Printf("Ignore transaction %x. Verify failed with error: %s\n", tx.GetID(), err.Error())
 			// we delete this transaction. no sense to keep it
 			n.CancelTransaction(tx.GetID(), true)
@@ -283,6 +303,11 @@ func (n *txManager) ForEachUnspentOutput(address string, callback UnspentTransac
 	return n.getUnspentOutputsManager().forEachUnspentOutput(address, callback)
 }
 
+// Iterate over all unspent transactions outputs, for example to export them
+func (n *txManager) ForEachUnspent(callback func(out structures.TXOutputIndependent) error) error {
+	return n.getUnspentOutputsManager().forEachOutput(callback)
+}
+
 // Remove all transactions from unapproved cache (transactions pool)
 func (n *txManager) CleanUnapprovedCache() error {
 	return n.getUnapprovedTransactionsManager().CleanUnapprovedCache()
@@ -307,6 +332,8 @@ func (n *txManager) BlockAdded(block *structures.Block, ontopofchain bool) error
 		// add association of transactions and SQL references
 		n.Logger.Trace.Printf("TX Man. process rows associations %x", block.Hash)
 		n.getDataRowsAndTransacionsManager().UpdateOnBlockAdd(block)
+
+		n.logsUpdate(block, true)
 	}
 	return nil
 }
@@ -324,6 +351,8 @@ func (n *txManager) BlockRemoved(block *structures.Block) error {
 
 	// remove association of transactions and SQL references
 	n.getDataRowsAndTransacionsManager().UpdateOnBlockCancel(block)
+
+	n.logsUpdate(block, false)
 	return nil
 }
 
@@ -340,6 +369,8 @@ func (n *txManager) BlockAddedToPrimaryChain(block *structures.Block) error {
 	// update references/transactions linking
 	n.getDataRowsAndTransacionsManager().UpdateOnBlockAdd(block)
 
+	n.logsUpdate(block, true)
+
 	return nil
 }
 
@@ -348,6 +379,9 @@ func (n *txManager) BlockRemovedFromPrimaryChain(block *structures.Block) error
 	//n.Logger.Trace.Printf("TX Man. block removed from primary %x", block.Hash)
 	// we need to reverse transactions slice. execution of rollback should go
 	// in reversed order
+	toRollback := []structures.Transaction{}
+	list := []structures.SQLUpdate{}
+
 	l := len(block.Transactions)
 	for i := l - 1; i > -1; i-- {
 		tx := block.Transactions[i]
@@ -361,21 +395,61 @@ func (n *txManager) BlockRemovedFromPrimaryChain(block *structures.Block) error
 		n.Logger.Trace.Printf("Execute On Block Remove: rollback %s ", string(tx.SQLCommand.Query))
 		n.Logger.Trace.Printf("Execute On Block Remove: %s from tx %x", string(tx.SQLCommand.RollbackQuery), tx.GetID())
 
-		err := n.getQueryParser().ExecuteRollbackQueryFromTX(tx.SQLCommand)
+		toRollback = append(toRollback, tx)
+		list = append(list, tx.SQLCommand)
+	}
 
-		if err != nil {
-			n.Logger.Trace.Printf("Error On Block Remove: %s", err.Error())
-			return err
-		}
+	failed, err := n.getQueryParser().ExecuteRollbackQueriesFromTX(list)
+
+	if err != nil {
+		n.logApplyListError(toRollback, failed, "Block Remove", err)
+		return err
 	}
 
 	n.getUnspentOutputsManager().UpdateOnBlockCancel(block)
 
 	// remove association of transactions and SQL references
 	n.getDataRowsAndTransacionsManager().UpdateOnBlockCancel(block)
+
+	n.logsUpdate(block, false)
 	return nil
 }
 
+// The logs are not a part of the blockchain state, a block is not stopped if they fail. They can be rebuilt with reindex
+func (n *txManager) logsUpdate(block *structures.Block, added bool) {
+	var err error
+
+	if added {
+		err = n.getAuditLogManager().UpdateOnBlockAdd(block)
+	} else {
+		err = n.getAuditLogManager().UpdateOnBlockCancel(block)
+	}
+
+	if err != nil {
+		n.Logger.Error.Printf("Audit log is not updated for block %x: %s", block.Hash, err.Error())
+	}
+
+	if added {
+		err = n.getChangeLogManager().UpdateOnBlockAdd(block)
+	} else {
+		err = n.getChangeLogManager().UpdateOnBlockCancel(block)
+	}
+
+	if err != nil {
+		n.Logger.Error.Printf("Change log is not updated for block %x: %s", block.Hash, err.Error())
+	}
+}
+
+// Events of data changes after the cursor
+func (n *txManager) GetChangeEvents(after int64, limit int) ([]database.ChangeEvent, error) {
+	cldb, err := n.DB.GetChangeLogObject()
+
+	if err != nil {
+		return nil, err
+	}
+	return cldb.GetEvents(after, limit)
+}
+
 // find which transactions in a pool conflict with this list
 // and remove if any conflicts
 func (n *txManager) rollbackConflictingFromPool(txList []structures.Transaction) error {
@@ -447,6 +521,8 @@ func (n *txManager) transactionsFromAddedBlock(txList []structures.Transaction)
 
 	pendingPoolObj := n.getUnapprovedTransactionsManager()
 
+	toExecute := []structures.Transaction{}
+
 	for _, tx := range txList {
 		if tx.IsSQLCommand() {
 			// execute only if not in a pool
@@ -456,15 +532,29 @@ func (n *txManager) transactionsFromAddedBlock(txList []structures.Transaction)
 				//n.Logger.Trace.Printf("Exists in poll. Skip SQL: %x", tx.GetID())
 				continue
 			}
+			toExecute = append(toExecute, tx)
+		}
+	}
 
-			n.Logger.Trace.Printf("Execute On Block Add: %s", tx.GetSQLQuery())
+	err = n.shadowApply(toExecute)
 
-			err := n.getQueryParser().ExecuteQueryFromTX(tx.SQLCommand)
-			if err != nil {
-				n.Logger.Error.Printf("Error when execute SQL on Block Add: %s", err.Error())
-				return err
-			}
-		}
+	if err != nil {
+		return err
+	}
+
+	list := []structures.SQLUpdate{}
+
+	for _, tx := range toExecute {
+		n.Logger.Trace.Printf("Execute On Block Add: %s", tx.GetSQLQuery())
+
+		list = append(list, tx.SQLCommand)
+	}
+
+	failed, err := n.getQueryParser().ExecuteQueriesFromTX(list)
+
+	if err != nil {
+		n.logApplyListError(toExecute, failed, "Block Add", err)
+		return err
 	}
 	return nil
 }
@@ -475,7 +565,7 @@ func (n *txManager) transactionsFromAddedBlock(txList []structures.Transaction)
 //
 // Returns new transaction hash. This return can be used to try to send transaction
 // to other nodes or to try mining
-func (n *txManager) CreateCurrencyTransaction(PubKey []byte, privKey ecdsa.PrivateKey, to string, amount float64) (*structures.Transaction, error) {
+func (n *txManager) CreateCurrencyTransaction(signer utils.Signer, to string, amount float64) (*structures.Transaction, error) {
 
 	if amount <= 0 {
 		return nil, errors.New("Amount must be positive value")
@@ -484,13 +574,13 @@ func (n *txManager) CreateCurrencyTransaction(PubKey []byte, privKey ecdsa.Priva
 		return nil, errors.New("Recipient address is not provided")
 	}
 
-	txBytes, DataToSign, err := n.PrepareNewCurrencyTransaction(PubKey, to, amount)
+	txBytes, DataToSign, err := n.PrepareNewCurrencyTransaction(signer.GetPublicKey(), to, amount, "")
 
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("Prepare error: %s", err.Error()))
 	}
 
-	signatures, err := utils.SignDataByPubKey(PubKey, privKey, DataToSign)
+	signatures, err := utils.SignDataBySigner(signer, DataToSign)
 
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("Sign error: %s", err.Error()))
@@ -524,7 +614,8 @@ func (n *txManager) AddNewTransaction(tx *structures.Transaction, flags int) (er
 	if tx.IsSQLCommand() && flags&lib.TXFlagsExecute > 0 {
 		n.Logger.Trace.Printf("Execute: %s , refID is %s", tx.GetSQLQuery(), string(tx.SQLCommand.ReferenceID))
 
-		_, err := n.getQueryParser().ExecuteQuery(tx.GetSQLQuery())
+		// the query was checked when the TX was made, on this node or other
+		_, err := n.getQueryParser().ExecuteQuery(tx.GetSQLQuery(), 0)
 
 		if err != nil {
 			return errors.New(fmt.Sprintf("Can not execute query from new TX: %s", err.Error()))
@@ -582,7 +673,11 @@ func (n *txManager) VerifyTransaction(tx *structures.Transaction, prevtxs []stru
 	}
 
 	// do final check against inputs
-	err = tx.Verify(inputTXs, n.consensusInfo.CoinsForBlockMade)
+	if flags&lib.TXFlagsSignatureVerified > 0 {
+		err = tx.VerifyInputs(inputTXs, n.consensusInfo.CoinsForBlockMade)
+	} else {
+		err = tx.Verify(inputTXs, n.consensusInfo.CoinsForBlockMade)
+	}
 
 	if err != nil {
 		n.Logger.Trace.Printf("VT error 6: %s", err.Error())
@@ -705,14 +800,15 @@ func (n *txManager) getCurrencyInputTransactionsState(tx *structures.Transaction
 // Request to make new transaction and prepare data to sign
 // This function should find good input transactions for this amount
 // Including inputs from unapproved transactions if no good approved transactions yet
-func (n *txManager) PrepareNewCurrencyTransaction(PubKey []byte, to string, amount float64) ([]byte, []byte, error) {
+// Change is sent to change address. If it is empty then change is returned to the sender address
+func (n *txManager) PrepareNewCurrencyTransaction(PubKey []byte, to string, amount float64, change string) ([]byte, []byte, error) {
 	PubKey, amount, inputs, totalamount, prevTXs, err := n.prepareNewCurrencyTransactionStart(PubKey, to, amount)
 
 	if err != nil {
 		return nil, nil, err
 	}
 
-	txBytes, stringtosign, _, err := n.prepareNewCurrencyTransactionComplete(PubKey, to, amount, inputs, totalamount, prevTXs)
+	txBytes, stringtosign, _, err := n.prepareNewCurrencyTransactionComplete(PubKey, to, amount, change, inputs, totalamount, prevTXs)
 	return txBytes, stringtosign, err
 }
 
@@ -747,7 +843,7 @@ func (n *txManager) PrepareNewSQLTransaction(PubKey []byte, sqlUpdate structures
 			return
 		}
 
-		txBytes, _, inputsTX, err = n.prepareNewCurrencyTransactionComplete(PubKey, to, amount, inputs, totalamount, prevTXs)
+		txBytes, _, inputsTX, err = n.prepareNewCurrencyTransactionComplete(PubKey, to, amount, "", inputs, totalamount, prevTXs)
 
 		if err != nil {
 			return
@@ -892,17 +988,19 @@ func (n *txManager) prepareNewCurrencyTransactionStart(PubKey []byte, to string,
 }
 
 //
-func (n *txManager) prepareNewCurrencyTransactionComplete(PubKey []byte, to string, amount float64,
+func (n *txManager) prepareNewCurrencyTransactionComplete(PubKey []byte, to string, amount float64, change string,
 	inputs []structures.TXCurrencyInput, totalamount float64, prevTXs map[string]*structures.Transaction) ([]byte, []byte, map[int]*structures.Transaction, error) {
 
 	var outputs []structures.TXCurrrencyOutput
 
 	// Build a list of outputs
-	from, _ := utils.PubKeyToAddres(PubKey)
+	if change == "" {
+		change, _ = utils.PubKeyToAddres(PubKey)
+	}
 	outputs = append(outputs, *structures.NewTXOutput(amount, to))
 
 	if totalamount > amount && totalamount-amount > lib.CurrencySmallestUnit {
-		outputs = append(outputs, *structures.NewTXOutput(totalamount-amount, from)) // a change
+		outputs = append(outputs, *structures.NewTXOutput(totalamount-amount, change)) // a change
 	}
 
 	inputTXs := make(map[int]*structures.Transaction)
@@ -944,6 +1042,66 @@ func (n *txManager) GetIfExists(txid []byte) (*structures.Transaction, error) {
 	return tx, err
 }
 
+// Returns hash of a block in primary branch where a transaction is included
+func (n *txManager) GetTransactionBlock(txid []byte) ([]byte, error) {
+	blockHash, err := n.getIndexManager().GetTransactionBlock(txid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if blockHash == nil {
+		return nil, errors.New("Transaction is not found in the blockchain")
+	}
+	return blockHash, nil
+}
+
+// Returns SQL transactions which changed a row, from first to last. Transactions from the pool are included.
+// Every update of a row is based on previous update, so the list is made from the last TX back to the first
+func (n *txManager) GetRowHistory(refID []byte) ([]*structures.Transaction, error) {
+	txID, err := n.getUnapprovedTransactionsManager().FindLastSQLTransactionForRefID(refID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(txID) == 0 {
+		txID, err = n.getDataRowsAndTransacionsManager().GetTXForRefID(refID)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	history := []*structures.Transaction{}
+
+	for len(txID) > 0 {
+		tx, err := n.GetIfExists(txID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if tx == nil {
+			return nil, errors.New(fmt.Sprintf("Transaction %x is not found", txID))
+		}
+
+		if !tx.IsSQLCommand() || bytes.Compare(tx.SQLCommand.ReferenceID, refID) != 0 {
+			// it is a base of first update of the row. For example, table create
+			break
+		}
+		history = append([]*structures.Transaction{tx}, history...)
+
+		txID = tx.GetSQLBaseTX()
+	}
+	return history, nil
+}
+
+// Reference IDs of rows changed by transactions in the pool. These rows are not yet final
+func (n *txManager) GetUnapprovedSQLReferences() ([][]byte, error) {
+	return n.getUnapprovedTransactionsManager().GetSQLReferenceIDs()
+}
+
 // check if transaction exists in unapproved cache
 func (n *txManager) GetIfUnapprovedExists(txid []byte) (*structures.Transaction, error) {
 	// check in pending first
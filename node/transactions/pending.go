@@ -5,7 +5,6 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"sort"
 	"sync"
 
 	"github.com/gelembjuk/oursql/lib/utils"
@@ -17,7 +16,8 @@ import (
 const maxCountOfTransactionInMemoryCache = 20000
 const transactionsCacheEnable = true
 
-var transactionsCache map[string]structures.Transaction
+// caches of pools per database. Usually there is one, but many nodes can work in one process in a simulation
+var transactionsCaches = map[string]map[string]structures.Transaction{}
 var transactionsCacheLock *sync.Mutex
 
 type unApprovedTransactions struct {
@@ -44,12 +44,35 @@ func (u unApprovedTransactions) unlockCache() {
 	transactionsCacheLock.Unlock()
 }
 
+// Cache of the pool of this DB. Nil if it is not loaded
+func (u unApprovedTransactions) getCache() map[string]structures.Transaction {
+	return transactionsCaches[u.getCacheKey()]
+}
+
+func (u unApprovedTransactions) setCache(cache map[string]structures.Transaction) {
+	if cache == nil {
+		delete(transactionsCaches, u.getCacheKey())
+		return
+	}
+	transactionsCaches[u.getCacheKey()] = cache
+}
+
+func (u unApprovedTransactions) getCacheKey() string {
+	config := u.DB.GetConfig()
+
+	return config.GetDatabaseID() + "/" + config.TablesPrefix
+}
+
 func (u unApprovedTransactions) renewCacheIfNeeded() error {
 	if !transactionsCacheEnable {
 		return nil
 	}
 
-	if transactionsCache != nil {
+	u.lockCache()
+	cache := u.getCache()
+	u.unlockCache()
+
+	if cache != nil {
 		return nil
 	}
 
@@ -65,7 +88,7 @@ func (u *unApprovedTransactions) renewCache() error {
 	u.lockCache()
 	defer u.unlockCache()
 	// get count of TX in pool
-	transactionsCache = nil
+	u.setCache(nil)
 
 	c, err := u.GetCount()
 
@@ -81,7 +104,7 @@ func (u *unApprovedTransactions) renewCache() error {
 	if err != nil {
 		return err
 	}
-	transactionsCache = make(map[string]structures.Transaction, 0)
+	cache := make(map[string]structures.Transaction, 0)
 
 	allPairs, err := utdb.GetAll()
 
@@ -98,8 +121,9 @@ func (u *unApprovedTransactions) renewCache() error {
 			return err
 		}
 		//u.Logger.Trace.Printf("TX adding to cache %x", tx.GetID())
-		transactionsCache[tx.GetIDString()] = *tx
+		cache[tx.GetIDString()] = *tx
 	}
+	u.setCache(cache)
 
 	return nil
 }
@@ -112,10 +136,10 @@ func (u unApprovedTransactions) forEachTransaction(callback foreachFunction) err
 		u.lockCache()
 	}
 
-	if transactionsCacheEnable && transactionsCache != nil {
+	if cache := u.getCache(); transactionsCacheEnable && cache != nil {
 		defer u.unlockCache()
 
-		for _, txC := range transactionsCache {
+		for _, txC := range cache {
 			tx := txC
 			stop, err := callback(&tx)
 
@@ -361,13 +385,13 @@ func (u *unApprovedTransactions) GetInputValue(input structures.TXCurrencyInput)
 func (u *unApprovedTransactions) GetIfExists(txid []byte) (*structures.Transaction, error) {
 	u.lockCache()
 
-	if transactionsCacheEnable && transactionsCache != nil {
+	if cache := u.getCache(); transactionsCacheEnable && cache != nil {
 
 		defer u.unlockCache()
 
 		txIDString := fmt.Sprintf("%x", txid)
 
-		if tx, ok := transactionsCache[txIDString]; ok {
+		if tx, ok := cache[txIDString]; ok {
 			//u.Logger.Trace.Printf("Found TX in cache %x", tx.GetID())
 			return &tx, nil
 		}
@@ -404,22 +428,18 @@ func (u *unApprovedTransactions) GetIfExists(txid []byte) (*structures.Transacti
 }
 
 // Get all unapproved transactions
+// A transaction based on other pending transaction goes after it. So, number of first transactions
+// can be put to a block, all inputs are before
 func (u *unApprovedTransactions) GetTransactions(number int) ([]*structures.Transaction, error) {
 
 	txset := []*structures.Transaction{}
 
-	totalnumber := 0
 	u.Logger.Trace.Println("GetTransactions")
 
+	// all transactions are needed. if we stop on the number, parent of some transaction can be missed
 	err := u.forEachTransaction(func(tx *structures.Transaction) (bool, error) {
 
 		txset = append(txset, tx)
-		totalnumber++
-
-		if totalnumber >= number {
-			// time to exit the loop. we don't need more
-			return true, nil
-		}
 
 		return false, nil
 	})
@@ -427,8 +447,11 @@ func (u *unApprovedTransactions) GetTransactions(number int) ([]*structures.Tran
 		return nil, err
 	}
 
-	// we need to sort transactions. oldest should be first
-	sort.Sort(structures.Transactions(txset))
+	txset = structures.SortTransactionsByDependencies(txset)
+
+	if len(txset) > number {
+		txset = txset[:number]
+	}
 	return txset, nil
 }
 
@@ -461,9 +484,8 @@ func (u *unApprovedTransactions) GetTransactionsFilteredByList(number int, ignor
 		return nil, err
 	}
 
-	// we need to sort transactions. oldest should be first
-	sort.Sort(structures.Transactions(txset))
-	return txset, nil
+	// we need to sort transactions. oldest should be first, but after transactions they are based on
+	return structures.SortTransactionsByDependencies(txset), nil
 }
 
 // Get all unapproved transactions filtered by create time and list to skip. Return only more recent
@@ -500,9 +522,8 @@ func (u *unApprovedTransactions) GetTransactionsFilteredByTime(number int,
 		return nil, err
 	}
 
-	// we need to sort transactions. oldest should be first
-	sort.Sort(structures.Transactions(txset))
-	return txset, nil
+	// we need to sort transactions. oldest should be first, but after transactions they are based on
+	return structures.SortTransactionsByDependencies(txset), nil
 }
 
 // Get number of unapproved transactions in a cache
@@ -577,11 +598,13 @@ func (u *unApprovedTransactions) Add(txadd *structures.Transaction) error {
 		return errors.New("Adding new transaction to unapproved cache: " + err.Error())
 	}
 
-	if transactionsCacheEnable && transactionsCache != nil {
+	if transactionsCacheEnable {
 		u.lockCache()
 		defer u.unlockCache()
 
-		transactionsCache[string(txadd.GetIDString())] = *txadd
+		if cache := u.getCache(); cache != nil {
+			cache[string(txadd.GetIDString())] = *txadd
+		}
 		//u.Logger.Trace.Printf("Added TX to TX cache %x %s", txadd.GetID(), txadd.GetIDString())
 	}
 
@@ -620,8 +643,8 @@ func (u *unApprovedTransactions) Delete(txid []byte) (bool, error) {
 
 			txIDString := fmt.Sprintf("%x", txid)
 			//u.Logger.Trace.Printf("Delete TX from cache %s", txIDString)
-			if transactionsCache != nil {
-				delete(transactionsCache, txIDString)
+			if cache := u.getCache(); cache != nil {
+				delete(cache, txIDString)
 			}
 		}
 
@@ -830,7 +853,7 @@ func (u *unApprovedTransactions) CleanUnapprovedCache() error {
 		u.lockCache()
 		defer u.unlockCache()
 
-		transactionsCache = make(map[string]structures.Transaction, 0)
+		u.setCache(make(map[string]structures.Transaction, 0))
 	}
 
 	return nil
@@ -908,6 +931,44 @@ func (u *unApprovedTransactions) FindSQLReferenceTransaction(sqlUpdate structure
 	return
 }
 
+// Find last SQL TX in the pool which changed a row. Other TXs of the row are based on it
+func (u *unApprovedTransactions) FindLastSQLTransactionForRefID(refID []byte) (txID []byte, err error) {
+	found := [][]byte{}
+	bases := [][]byte{}
+
+	err = u.forEachTransaction(func(tx *structures.Transaction) (bool, error) {
+		if !tx.IsSQLCommand() || bytes.Compare(tx.SQLCommand.ReferenceID, refID) != 0 {
+			return false, nil
+		}
+		found = append(found, utils.CopyBytes(tx.GetID()))
+
+		if len(tx.GetSQLBaseTX()) > 0 {
+			bases = append(bases, utils.CopyBytes(tx.GetSQLBaseTX()))
+		}
+		return false, nil
+	})
+
+	for _, id := range found {
+		if !u.helperCheckTXInList(id, bases) {
+			txID = id
+		}
+	}
+	return
+}
+
+// Reference IDs of all rows changed by SQL TXs in the pool
+func (u *unApprovedTransactions) GetSQLReferenceIDs() (refIDs [][]byte, err error) {
+	refIDs = [][]byte{}
+
+	err = u.forEachTransaction(func(tx *structures.Transaction) (bool, error) {
+		if tx.IsSQLCommand() && len(tx.SQLCommand.ReferenceID) > 0 {
+			refIDs = append(refIDs, utils.CopyBytes(tx.SQLCommand.ReferenceID))
+		}
+		return false, nil
+	})
+	return
+}
+
 // Find SQL TX based on specific TX
 func (u *unApprovedTransactions) FindSQLBasedOnTransaction(txid []byte) (txIDs [][]byte, err error) {
 	// it i needed to go over all tranactions in cache and check each of them
@@ -0,0 +1,42 @@
+package transactions
+
+import (
+	"github.com/gelembjuk/oursql/node/structures"
+)
+
+// Checks queries of a block in a transaction which is rolled back, if it is enabled in config.
+// Error means the block must not be applied, nothing is changed in tables yet
+func (n *txManager) shadowApply(txList []structures.Transaction) error {
+	if len(txList) == 0 {
+		return nil
+	}
+
+	settings, err := n.DB.QM().GetApplySettings()
+
+	if err != nil || !settings.ShadowApply {
+		return err
+	}
+
+	list := []structures.SQLUpdate{}
+
+	for _, tx := range txList {
+		list = append(list, tx.SQLCommand)
+	}
+
+	failed, skipped, err := n.getQueryParser().ShadowApplyQueriesFromTX(list)
+
+	if skipped {
+		n.Logger.Trace.Printf("Shadow apply is skipped, a block changes tables structure")
+		return nil
+	}
+
+	if err != nil {
+		if failed >= 0 {
+			n.logApplyError(txList[failed], "Shadow Apply", err)
+		} else {
+			n.Logger.Error.Printf("Shadow apply of a block failed: %s", err.Error())
+		}
+		return err
+	}
+	return nil
+}
@@ -229,6 +229,32 @@ func (u unspentTransactions) forEachUnspentOutput(address string, callback Unspe
 	return nil
 }
 
+// execute callback function for every unspent output of all addresses
+func (u unspentTransactions) forEachOutput(callback func(out structures.TXOutputIndependent) error) error {
+	uodb, err := u.DB.GetUnspentOutputsObject()
+
+	if err != nil {
+		return err
+	}
+
+	return uodb.ForEach(func(txID, txData []byte) error {
+		outs, err := u.deserializeOutputs(txData)
+
+		if err != nil {
+			return err
+		}
+
+		for _, out := range outs {
+			err := callback(out)
+
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // Returns list of unspent transactions outputs for address
 func (u unspentTransactions) GetunspentTransactionsOutputs(address string) ([]structures.TXOutputIndependent, error) {
 	if address == "" {
@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
+	"github.com/gelembjuk/oursql/lib/net"
 	"github.com/gelembjuk/oursql/lib/remoteclient"
 )
 
@@ -28,6 +30,26 @@ func GetAppInput() (remoteclient.AppInput, error) {
 	cmd.StringVar(&input.NodeHost, "nodehost", "", "Node Server Host")
 	cmd.Float64Var(&input.Amount, "amount", 0, "Amount money to send")
 	cmd.StringVar(&input.LogDest, "logdest", "file", "Destination of logs. file or stdout")
+	cmd.StringVar(&input.WatchCommand, "oncommand", "", "Command to execute on watch event")
+	cmd.StringVar(&input.WatchWebhook, "webhook", "", "URL to post watch events to")
+	cmd.IntVar(&input.WatchInterval, "interval", 0, "Interval of watch checks in seconds")
+	cmd.StringVar(&input.Filepath, "filepath", "", "File path for import/export")
+	cmd.StringVar(&input.Format, "format", "csv", "Export format. csv or json")
+	cmd.StringVar(&input.SQL, "sql", "", "SQL query to sign")
+	cmd.StringVar(&input.Purpose, "purpose", "", "Purpose of derived address. Application or table name")
+	cmd.IntVar(&input.Index, "index", -1, "Index of derived address to restore")
+	cmd.StringVar(&input.Seed, "seed", "", "Seed of derived addresses")
+	cmd.IntVar(&input.Quorum, "quorum", 0, "Number of nodes that must agree on balance")
+	cmd.IntVar(&input.MinComplexity, "mincomplexity", 0, "Lowest complexity of blocks accepted by verifyunspent. Default 16")
+	cmd.StringVar(&input.PaperKey, "key", "", "Private key of a paper wallet")
+	cmd.StringVar(&input.Name, "name", "", "Name in the names registry")
+	cmd.StringVar(&input.Scheme, "scheme", "", "Signature scheme of new wallet. ecdsa or ed25519")
+	cmd.BoolVar(&input.ReuseChange, "reusechange", false, "Return change to the sender address")
+	cmd.StringVar(&input.RPCAddress, "rpcaddr", "", "Listening address of RPC server. Default is 127.0.0.1:8332")
+	cmd.StringVar(&input.RPCUser, "rpcuser", "", "User name for RPC server")
+	cmd.StringVar(&input.RPCPassword, "rpcpassword", "", "Password for RPC server")
+	cmd.StringVar(&input.ConfirmCode, "code", "", "One time code to confirm a transaction")
+	nodesPtr := cmd.String("nodes", "", "List of nodes to check. host:port,host:port")
 
 	datadirPtr := cmd.String("configdir", "", "Location of data files, config")
 
@@ -37,6 +59,19 @@ func GetAppInput() (remoteclient.AppInput, error) {
 		log.Panic(err)
 	}
 
+	if *nodesPtr != "" {
+		for _, a := range strings.Split(*nodesPtr, ",") {
+			node := net.NodeAddr{}
+
+			err := node.LoadFromString(strings.TrimSpace(a))
+
+			if err != nil {
+				return input, err
+			}
+			input.Nodes = append(input.Nodes, node)
+		}
+	}
+
 	if *datadirPtr != "" {
 		input.ConfigDir = *datadirPtr
 		if input.ConfigDir[len(input.ConfigDir)-1:] != "/" {
@@ -78,6 +113,26 @@ func GetAppInput() (remoteclient.AppInput, error) {
 		if input.Address == "" && config.Address != "" {
 			input.Address = config.Address
 		}
+		if len(input.Nodes) == 0 && len(config.Nodes) > 0 {
+			input.Nodes = config.Nodes
+		}
+		input.Policy = config.Policy
+		input.Tracing = config.Tracing
+		input.NodeTLS = config.NodeTLS
+		input.WireFormat = config.WireFormat
+		input.NodeTimeouts = config.NodeTimeouts
+		input.NodeRetry = config.NodeRetry
+		input.NodeProxy = config.NodeProxy
+		input.NodeMaxResponseSize = config.NodeMaxResponseSize
+		input.NodeRateLimit = config.NodeRateLimit
+
+		if input.RPCUser == "" && config.RPCUser != "" {
+			input.RPCUser = config.RPCUser
+			input.RPCPassword = config.RPCPassword
+		}
+		if input.RPCAddress == "" && config.RPCAddress != "" {
+			input.RPCAddress = config.RPCAddress
+		}
 	}
 
 	return input, nil
@@ -147,12 +202,26 @@ func printUsage() {
 	fmt.Println("Usage:")
 	fmt.Println("  help - Prints this help")
 	fmt.Println("  == Any of next commands can have optional argument [-configdir /path/to/dir] [-logdest stdout] ==")
-	fmt.Println("  createwallet\n\t- Generates a new key-pair and saves it into the wallet file")
+	fmt.Println("  createwallet [-scheme ecdsa|ed25519]\n\t- Generates a new key-pair and saves it into the wallet file")
+	fmt.Println("  deriveaddress -purpose PURPOSE [-index INDEX]\n\t- Creates new address derived from the wallet seed for PURPOSE (like app:name or table:name). With -index restores existing address")
+	fmt.Println("  exportseed\n\t- Prints the seed of derived addresses. Keep it to recover derived addresses")
+	fmt.Println("  importseed -seed SEED\n\t- Sets the seed of derived addresses in a new wallets file")
 	fmt.Println("  showunspent -address ADDRESS\n\t- Displays the list of all unspent transactions and total balance")
 	fmt.Println("  showhistory -address ADDRESS\n\t- Displays the wallet history. All In?Out transactions")
+	fmt.Println("  verifyunspent -address ADDRESS [-mincomplexity N]\n\t- Checks unspent transactions are really included in blocks of the chain (Merkle proofs) and hashes of blocks have proof of work")
+	fmt.Println("  exporthistory [-address ADDRESS] -filepath FILEPATH [-format csv|json]\n\t- Exports history of transactions of ADDRESS (or all wallet addresses) to a file")
 	fmt.Println("  getbalance -address ADDRESS\n\t- Get balance of ADDRESS")
+	fmt.Println("  quorumbalance -address ADDRESS [-nodes HOST:PORT,HOST:PORT] [-quorum N]\n\t- Get balance of ADDRESS from several nodes and check that at least N of them agree")
 	fmt.Println("  listaddresses\n\t- Lists all addresses from the wallet file")
+	fmt.Println("  exportpaper -address ADDRESS [-filepath PNGFILE]\n\t- Prints ADDRESS and its private key as paper wallet with QR codes. Optionally saves QR of the key to PNG file")
+	fmt.Println("  sweeppaper -key PRIVATEKEY [-to TO]\n\t- Moves all funds of a paper wallet key to TO address of this wallet (or new address) in one transaction")
 	fmt.Println("  listbalances\n\t- Lists all addresses from the wallet file and show balance for each")
-	fmt.Println("  send -from FROM -to TO -amount AMOUNT\n\t- Send AMOUNT of coins from FROM address to TO. ")
+	fmt.Println("  send -from FROM -to TO -amount AMOUNT [-reusechange]\n\t- Send AMOUNT of coins from FROM address to TO (address or registered name). A change goes to new derived address unless -reusechange is set")
+	fmt.Println("  watch [-address ADDRESS] [-oncommand COMMAND] [-webhook URL] [-interval SECONDS]\n\t- Watches new blocks and notifies when ADDRESS (or any wallet address) receives funds or own row is modified. Event reorg is sent when checked blocks are replaced by other branch")
+	fmt.Println("  registername -address ADDRESS -name NAME\n\t- Registers unique NAME for ADDRESS in the names registry. NAME can be used in place of TO address")
+	fmt.Println("  resolvename -name NAME | -address ADDRESS\n\t- Displays address and public key registered for NAME or a name of ADDRESS")
+	fmt.Println("  signsql -from FROM -sql SQLCOMMAND\n\t- Prepares and signs SQL query by FROM address. Prints the query with signature comment to execute with any MySQL client")
+	fmt.Println("  == send, sql, signsql and sweeppaper ask for confirmation when Policy from config.json requires it. [-code CODE] gives TOTP code ==")
+	fmt.Println("  rpcserver -rpcuser USER -rpcpassword PASSWORD [-rpcaddr HOST:PORT]\n\t- Starts JSON-RPC server compatible with bitcoind wallet calls getbalance, listtransactions, sendtoaddress, getnewaddress")
 	fmt.Println("  setnode -nodehost HOST -nodeport PORT\n\t- Saves a node host and port to configfile. ")
 }
@@ -6,6 +6,7 @@ import (
 
 	"github.com/gelembjuk/oursql/lib"
 	"github.com/gelembjuk/oursql/lib/remoteclient"
+	"github.com/gelembjuk/oursql/lib/tracing"
 	"github.com/gelembjuk/oursql/lib/utils"
 )
 
@@ -43,8 +44,14 @@ func main() {
 
 	walletscli.NodeMode = false
 
+	// requests to nodes are children of this span
+	span := walletscli.NodeCLI.Trace.Start("wallet "+input.Command, tracing.KindInternal)
+
 	err := walletscli.ExecuteCommand()
 
+	span.End(err)
+	tracing.Stop()
+
 	if err != nil {
 		fmt.Printf("Error: %s\n", err.Error())
 	}